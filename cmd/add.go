@@ -1,10 +1,19 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/metalink"
+	"github.com/surge-downloader/surge/internal/engine/types"
 )
 
 var addCmd = &cobra.Command{
@@ -18,6 +27,16 @@ var addCmd = &cobra.Command{
 
 		batchFile, _ := cmd.Flags().GetString("batch")
 		output, _ := cmd.Flags().GetString("output")
+		expectedChecksum, _ := cmd.Flags().GetString("checksum")
+		piecesFile, _ := cmd.Flags().GetString("pieces")
+		category, _ := cmd.Flags().GetString("category")
+		onConflict, _ := cmd.Flags().GetString("on-conflict")
+		hooks := hookFlags(cmd)
+		request, err := requestFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 
 		// Collect URLs
 		var urls []string
@@ -40,12 +59,49 @@ var addCmd = &cobra.Command{
 			return
 		}
 
+		if onConflict != "" && !config.ValidConflictPolicy(onConflict) {
+			fmt.Fprintf(os.Stderr, "Error: --on-conflict must be one of %s\n", strings.Join(config.ConflictPolicies, ", "))
+			os.Exit(1)
+		}
+
+		if expectedChecksum != "" {
+			if len(urls) > 1 {
+				fmt.Fprintln(os.Stderr, "Error: --checksum can only be used with a single URL")
+				os.Exit(1)
+			}
+			if _, err := checksum.Parse(expectedChecksum); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid checksum: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		var pieces string
+		if piecesFile != "" {
+			if len(urls) > 1 {
+				fmt.Fprintln(os.Stderr, "Error: --pieces can only be used with a single URL")
+				os.Exit(1)
+			}
+			p, err := readPieces(piecesFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			pieces = checksum.FormatPieces(p)
+		}
+
 		baseURL, token, err := resolveAPIConnection(true)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			os.Exit(1)
 		}
 
+		// The downloads of a batch file are grouped together
+		var batchID, batchName string
+		if batchFile != "" {
+			batchID = uuid.New().String()
+			batchName = filepath.Base(batchFile)
+		}
+
 		// Send downloads to server
 		count := 0
 		for _, arg := range urls {
@@ -53,7 +109,12 @@ var addCmd = &cobra.Command{
 			if url == "" {
 				continue
 			}
-			if err := sendToServer(url, mirrors, output, baseURL, token); err != nil {
+			req := request
+			req.URL, req.Mirrors, req.Path = url, mirrors, output
+			req.Checksum, req.Pieces = expectedChecksum, pieces
+			req.BatchID, req.BatchName = batchID, batchName
+			req.Category, req.ConflictPolicy, req.Hooks = category, onConflict, hooks
+			if err := sendToServer(req, baseURL, token); err != nil {
 				fmt.Printf("Error adding %s: %v\n", url, err)
 				continue
 			}
@@ -70,4 +131,84 @@ func init() {
 	rootCmd.AddCommand(addCmd)
 	addCmd.Flags().StringP("batch", "b", "", "File containing URLs to download (one per line)")
 	addCmd.Flags().StringP("output", "o", "", "Output directory")
+	addCmd.Flags().String("checksum", "", "Expected checksum of the file, e.g. sha256:abcd... (md5, sha1, sha256, sha512, blake2b-256, blake2b-512)")
+	addCmd.Flags().String("pieces", "", "Piece hash manifest or metalink to verify each piece of the file against")
+	addCmd.Flags().StringP("category", "c", "", "Category to file the downloads under instead of matching one by its rules")
+	addCmd.Flags().String("on-conflict", "", "What to do if a file of the same name exists: rename, overwrite, skip, same-size or compare")
+	addCmd.Flags().String("on-complete", "", "Command to run when the download completes, instead of the configured one")
+	addCmd.Flags().String("on-error", "", "Command to run when the download fails, instead of the configured one")
+	addCmd.Flags().String("webhook", "", "URL to POST to when the download completes or fails, instead of the configured one")
+	addCmd.Flags().Duration("hook-timeout", 0, "Time limit for the hooks of the download, e.g. 2m")
+	addRequestFlags(addCmd.Flags())
+}
+
+// addRequestFlags registers the flags setting the headers and proxy of the
+// added downloads
+func addRequestFlags(flags *pflag.FlagSet) {
+	flags.StringArrayP("header", "H", nil, "Header to send, as 'Name: value' (repeatable)")
+	flags.String("user-agent", "", "User-Agent to send instead of the configured one")
+	flags.String("referer", "", "Referer to send")
+	flags.String("cookie", "", "Cookies to send, e.g. 'session=abc; lang=en'")
+	flags.String("proxy", "", "Proxy for the downloads instead of the configured one, e.g. socks5://127.0.0.1:1080")
+}
+
+// requestFlags returns a request carrying the headers and proxy set by the
+// flags of addRequestFlags
+func requestFlags(cmd *cobra.Command) (DownloadRequest, error) {
+	var req DownloadRequest
+	headerFlags, _ := cmd.Flags().GetStringArray("header")
+	headers, err := parseHeaders(headerFlags)
+	if err != nil {
+		return req, err
+	}
+	req.Headers = headers
+	req.UserAgent, _ = cmd.Flags().GetString("user-agent")
+	req.Referer, _ = cmd.Flags().GetString("referer")
+	req.Cookie, _ = cmd.Flags().GetString("cookie")
+	req.Proxy, _ = cmd.Flags().GetString("proxy")
+	if req.Proxy != "" {
+		if err := types.ValidateProxyURL(req.Proxy); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+// hookFlags returns the hooks set with --on-complete, --on-error, --webhook
+// and --hook-timeout, or nil if none are
+func hookFlags(cmd *cobra.Command) *config.HookSettings {
+	var h config.HookSettings
+	h.OnComplete, _ = cmd.Flags().GetString("on-complete")
+	h.OnError, _ = cmd.Flags().GetString("on-error")
+	h.WebhookURL, _ = cmd.Flags().GetString("webhook")
+	h.Timeout, _ = cmd.Flags().GetDuration("hook-timeout")
+	if h.Empty() && h.Timeout == 0 {
+		return nil
+	}
+	return &h
+}
+
+// readPieces loads piece hashes from a manifest file, or from a metalink
+// describing a single file
+func readPieces(path string) (*types.PieceHashes, error) {
+	if metalink.IsMetalink(path, "") {
+		f, err := metalink.Resolve(context.Background(), path, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if f.Pieces == nil {
+			return nil, fmt.Errorf("%s has no piece hashes", path)
+		}
+		return f.Pieces, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pieces, err := checksum.ParsePieces(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid piece manifest %s: %w", path, err)
+	}
+	return pieces, nil
 }
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/auth"
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage stored credentials for download hosts",
+	Long: `Manage the logins, tokens and headers Surge sends to download hosts.
+They are kept encrypted and apply to every request to their host, including
+downloads that are already queued. Cookies and .netrc logins are read from the
+files set as cookies_file and netrc_file in the settings.`,
+}
+
+var authAddCmd = &cobra.Command{
+	Use:   "add <host>",
+	Short: "Store credentials for a host",
+	Long: `Store credentials for a host, replacing any stored for it before.
+The host can be a name, "host:port", "*.example.com" for every subdomain of
+example.com, or a URL whose host is taken. Without --password, the password
+is read from standard input.`,
+	Example: `  surge auth add files.example.com --user alice
+  surge auth add api.example.com --token $TOKEN
+  surge auth add '*.example.com' -H 'X-Api-Key: abc123'`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := auth.Credential{Host: args[0]}
+		c.Username, _ = cmd.Flags().GetString("user")
+		c.Password, _ = cmd.Flags().GetString("password")
+		c.Token, _ = cmd.Flags().GetString("token")
+		headerFlags, _ := cmd.Flags().GetStringArray("header")
+
+		headers, err := parseHeaders(headerFlags)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		c.Headers = headers
+		if c.Username != "" && !cmd.Flags().Changed("password") {
+			if c.Password, err = readPassword(os.Stdin); err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading password: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if err := auth.DefaultStore().Add(c); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Stored credentials for %s\n", auth.NormalizeHost(c.Host))
+	},
+}
+
+var authLsCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "List the hosts credentials are stored for",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		creds, err := auth.DefaultStore().Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(creds) == 0 {
+			fmt.Println("No credentials stored.")
+			return
+		}
+		printCredentials(os.Stdout, creds)
+	},
+}
+
+var authRmCmd = &cobra.Command{
+	Use:   "rm <host>",
+	Short: "Remove the credentials stored for a host",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		removed, err := auth.DefaultStore().Remove(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if !removed {
+			fmt.Fprintf(os.Stderr, "Error: no credentials stored for %s\n", auth.NormalizeHost(args[0]))
+			os.Exit(1)
+		}
+		fmt.Printf("Removed credentials for %s\n", auth.NormalizeHost(args[0]))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(authCmd)
+	authCmd.AddCommand(authAddCmd)
+	authCmd.AddCommand(authLsCmd)
+	authCmd.AddCommand(authRmCmd)
+
+	authAddCmd.Flags().StringP("user", "u", "", "User name for HTTP Basic auth")
+	authAddCmd.Flags().StringP("password", "p", "", "Password for HTTP Basic auth (read from stdin if not given)")
+	authAddCmd.Flags().String("token", "", "Bearer token sent in the Authorization header")
+	authAddCmd.Flags().StringArrayP("header", "H", nil, "Header to send, as 'Name: value' (repeatable)")
+}
+
+// parseHeaders parses "Name: value" flags into a header map
+func parseHeaders(flags []string) (map[string]string, error) {
+	if len(flags) == 0 {
+		return nil, nil
+	}
+	headers := make(map[string]string, len(flags))
+	for _, h := range flags {
+		name, value, ok := strings.Cut(h, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid header %q, expected 'Name: value'", h)
+		}
+		headers[name] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// readPassword reads the first line of r, prompting for it on a terminal
+func readPassword(r io.Reader) (string, error) {
+	if f, ok := r.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			fmt.Fprint(os.Stderr, "Password: ")
+		}
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// printCredentials lists stored credentials without their secrets
+func printCredentials(out io.Writer, creds []auth.Credential) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "HOST\tTYPE\tUSER\tHEADERS")
+	_, _ = fmt.Fprintln(w, "----\t----\t----\t-------")
+	for _, c := range creds {
+		user := c.Username
+		if user == "" {
+			user = "-"
+		}
+		names := make([]string, 0, len(c.Headers))
+		for name := range c.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		headers := strings.Join(names, ", ")
+		if headers == "" {
+			headers = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Host, c.Kind(), user, headers)
+	}
+	_ = w.Flush()
+}
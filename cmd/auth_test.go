@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/auth"
+)
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := parseHeaders([]string{"X-Api-Key: abc:123", "Referer:https://example.com/", "X-Empty:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headers["X-Api-Key"] != "abc:123" || headers["Referer"] != "https://example.com/" || headers["X-Empty"] != "" || len(headers) != 3 {
+		t.Errorf("headers = %v", headers)
+	}
+
+	for _, bad := range []string{"no colon", ": value", "Two Words: value"} {
+		if _, err := parseHeaders([]string{bad}); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestReadPassword(t *testing.T) {
+	got, err := readPassword(strings.NewReader("s3cret\r\nrest\n"))
+	if err != nil || got != "s3cret" {
+		t.Errorf("readPassword = %q, %v", got, err)
+	}
+	if got, err := readPassword(strings.NewReader("no newline")); err != nil || got != "no newline" {
+		t.Errorf("readPassword without a newline = %q, %v", got, err)
+	}
+}
+
+func TestPrintCredentials_HidesSecrets(t *testing.T) {
+	var out bytes.Buffer
+	printCredentials(&out, []auth.Credential{
+		{Host: "files.example.com", Username: "alice", Password: "s3cret"},
+		{Host: "api.example.com", Token: "tok3n", Headers: map[string]string{"X-Api-Key": "k3y"}},
+	})
+	text := out.String()
+	for _, want := range []string{"files.example.com", "basic", "alice", "bearer+headers", "X-Api-Key"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("listing lacks %q:\n%s", want, text)
+		}
+	}
+	for _, secret := range []string{"s3cret", "tok3n", "k3y"} {
+		if strings.Contains(text, secret) {
+			t.Errorf("listing shows the secret %q:\n%s", secret, text)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/core"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// batchActionStatus is the status a batch endpoint reports after each action
+var batchActionStatus = map[string]string{
+	"pause":    "paused",
+	"resume":   "resumed",
+	"delete":   "deleted",
+	"priority": "updated",
+}
+
+// handleBatches lists every batch, or the one named by the id parameter
+func handleBatches(w http.ResponseWriter, r *http.Request, service core.DownloadService) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	var result any
+	if id := r.URL.Query().Get("id"); id != "" {
+		batch, err := core.FindBatch(service, id)
+		if errors.Is(err, core.ErrBatchNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result = batch
+	} else {
+		batches, err := core.ListBatches(service)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if batches == nil {
+			batches = []types.BatchStatus{}
+		}
+		result = batches
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
+
+// handleBatchRoute serves /batches/pause, /batches/resume, /batches/delete
+// and /batches/priority for the batch in the id parameter
+func handleBatchRoute(w http.ResponseWriter, r *http.Request, service core.DownloadService) {
+	action := strings.TrimPrefix(r.URL.Path, "/batches/")
+	if _, ok := batchActionStatus[action]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost && !(action == "delete" && r.Method == http.MethodDelete) {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing id parameter", http.StatusBadRequest)
+		return
+	}
+
+	if action == "priority" {
+		priority, err := types.ParsePriority(r.URL.Query().Get("priority"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if service == nil {
+			http.Error(w, "Service unavailable", http.StatusInternalServerError)
+			return
+		}
+		n, err := core.BatchSetPriority(service, id, priority)
+		writeBatchResult(w, id, action, n, err)
+		return
+	}
+	handleBatchAction(w, service, id, action)
+}
+
+// handleBatchAction pauses, resumes or deletes every download of a batch
+func handleBatchAction(w http.ResponseWriter, service core.DownloadService, batchID string, action string) {
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	var (
+		n   int
+		err error
+	)
+	switch action {
+	case "pause":
+		n, err = core.BatchPause(service, batchID)
+	case "resume":
+		n, err = core.BatchResume(service, batchID)
+	case "delete":
+		n, err = core.BatchDelete(service, batchID)
+	default:
+		http.Error(w, "Unknown batch action "+action, http.StatusBadRequest)
+		return
+	}
+	writeBatchResult(w, batchID, action, n, err)
+}
+
+func writeBatchResult(w http.ResponseWriter, batchID, action string, n int, err error) {
+	if errors.Is(err, core.ErrBatchNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"status": batchActionStatus[action], "batch": batchID, "count": n}); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
+
+// GetRemoteBatches fetches the batches of a running server
+func GetRemoteBatches(baseURL string, token string) ([]types.BatchStatus, error) {
+	resp, err := doAPIRequest(http.MethodGet, baseURL, token, "/batches", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			utils.Debug("Error closing response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned status: %s", resp.Status)
+	}
+
+	var batches []types.BatchStatus
+	if err := json.NewDecoder(resp.Body).Decode(&batches); err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
+
+// resolveBatchID expands a batch ID prefix, as printed by "surge mirror", to
+// the full ID of a batch known to the server
+func resolveBatchID(baseURL, token, partialID string) (string, error) {
+	batches, err := GetRemoteBatches(baseURL, token)
+	if err != nil {
+		return "", fmt.Errorf("failed to list batches: %w", err)
+	}
+	var candidates []string
+	for _, b := range batches {
+		candidates = append(candidates, b.ID)
+	}
+	return resolveIDFromCandidates(partialID, candidates)
+}
+
+// sendBatchAction runs a batch action on the server and returns how many
+// downloads it affected. query holds extra parameters, e.g. the priority.
+func sendBatchAction(baseURL, token, batchID, action string, query url.Values) (int, error) {
+	batchID, err := resolveBatchID(baseURL, token, batchID)
+	if err != nil {
+		return 0, err
+	}
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("id", batchID)
+	resp, err := doAPIRequest(http.MethodPost, baseURL, token, "/batches/"+action+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("error connecting to server: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			utils.Debug("Error closing response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, fmt.Errorf("%s", strings.TrimSpace(string(msg)))
+	}
+	var result struct {
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("invalid response: %w", err)
+	}
+	return result.Count, nil
+}
@@ -389,7 +389,7 @@ func TestPrintDownloads_FromDatabase_TableAndJSON(t *testing.T) {
 	}
 
 	tableOut := captureStdout(t, func() {
-		printDownloads(false, "", "", false)
+		printDownloads(false, false, "", "", false)
 	})
 	if !strings.Contains(tableOut, "ID") {
 		t.Fatalf("expected table header in output, got: %s", tableOut)
@@ -405,7 +405,7 @@ func TestPrintDownloads_FromDatabase_TableAndJSON(t *testing.T) {
 	}
 
 	jsonOut := captureStdout(t, func() {
-		printDownloads(true, "", "", false)
+		printDownloads(true, false, "", "", false)
 	})
 	var infos []downloadInfo
 	if err := json.Unmarshal([]byte(jsonOut), &infos); err != nil {
@@ -416,12 +416,56 @@ func TestPrintDownloads_FromDatabase_TableAndJSON(t *testing.T) {
 	}
 }
 
+func TestPrintDownloads_GroupedByBatch(t *testing.T) {
+	setupIsolatedCmdState(t)
+	removeActivePort()
+
+	if err := state.SaveBatch(types.Batch{ID: "9c1e04b7-0000-0000-0000-000000000000", Name: "releases"}); err != nil {
+		t.Fatalf("failed to seed batch: %v", err)
+	}
+	for _, entry := range []types.DownloadEntry{
+		{ID: "aaaaaaaa-1111", Filename: "one.iso", Status: "completed", Downloaded: 100, TotalSize: 100, BatchID: "9c1e04b7-0000-0000-0000-000000000000"},
+		{ID: "bbbbbbbb-2222", Filename: "two.iso", Status: "paused", Downloaded: 0, TotalSize: 100, BatchID: "9c1e04b7-0000-0000-0000-000000000000"},
+		{ID: "cccccccc-3333", Filename: "loose.bin", Status: "paused", TotalSize: 10},
+	} {
+		if err := state.AddToMasterList(entry); err != nil {
+			t.Fatalf("failed to seed db entry: %v", err)
+		}
+	}
+
+	tableOut := captureStdout(t, func() {
+		printDownloads(false, true, "", "", false)
+	})
+	for _, want := range []string{"9c1e04b7", "releases", "50.0%", "  aaaaaaaa", "cccccccc"} {
+		if !strings.Contains(tableOut, want) {
+			t.Errorf("expected %q in grouped output, got:\n%s", want, tableOut)
+		}
+	}
+	if strings.Index(tableOut, "cccccccc") < strings.Index(tableOut, "bbbbbbbb") {
+		t.Errorf("expected downloads outside a batch after the batches, got:\n%s", tableOut)
+	}
+
+	jsonOut := captureStdout(t, func() {
+		printDownloads(true, true, "", "", false)
+	})
+	var grouped groupedDownloads
+	if err := json.Unmarshal([]byte(jsonOut), &grouped); err != nil {
+		t.Fatalf("failed to decode json output: %v (out=%q)", err, jsonOut)
+	}
+	if len(grouped.Batches) != 1 || grouped.Batches[0].Count != 2 || grouped.Batches[0].Name != "releases" {
+		t.Errorf("unexpected batches: %+v", grouped.Batches)
+	}
+	if len(grouped.Downloads) != 1 || grouped.Downloads[0].ID != "cccccccc-3333" {
+		t.Errorf("unexpected loose downloads: %+v", grouped.Downloads)
+	}
+}
+
 func TestPrintDownloads_JSONEmpty(t *testing.T) {
 	setupIsolatedCmdState(t)
 	removeActivePort()
 
 	out := captureStdout(t, func() {
-		printDownloads(true, "", "", false)
+		printDownloads(true, false, "", "", false)
 	})
 	if strings.TrimSpace(out) != "[]" {
 		t.Fatalf("expected empty json array, got %q", strings.TrimSpace(out))
@@ -451,7 +495,7 @@ func TestPrintDownloads_StrictRemoteEmpty_DoesNotFallbackToDB(t *testing.T) {
 	defer server.Close()
 
 	out := captureStdout(t, func() {
-		printDownloads(true, server.URL, "", true)
+		printDownloads(true, false, server.URL, "", true)
 	})
 	if strings.TrimSpace(out) != "[]" {
 		t.Fatalf("expected strict remote empty json array, got %q", strings.TrimSpace(out))
@@ -529,7 +573,7 @@ func TestSendToServer_SuccessAndServerError(t *testing.T) {
 			})
 
 			port := ln.Addr().(*net.TCPAddr).Port
-			err = sendToServer("https://example.com/file.zip", nil, "", fmt.Sprintf("http://127.0.0.1:%d", port), "")
+			err = sendToServer(DownloadRequest{URL: "https://example.com/file.zip"}, fmt.Sprintf("http://127.0.0.1:%d", port), "")
 			if tt.wantErr && err == nil {
 				t.Fatal("expected error, got nil")
 			}
@@ -564,7 +608,7 @@ func TestSendToServer_UsesBearerTokenFromEnv(t *testing.T) {
 	t.Cleanup(func() { _ = server.Close() })
 
 	port := ln.Addr().(*net.TCPAddr).Port
-	err = sendToServer("https://example.com/file.zip", nil, "", fmt.Sprintf("http://127.0.0.1:%d", port), resolveLocalToken())
+	err = sendToServer(DownloadRequest{URL: "https://example.com/file.zip"}, fmt.Sprintf("http://127.0.0.1:%d", port), resolveLocalToken())
 	if err != nil {
 		t.Fatalf("expected authenticated request to succeed, got error: %v", err)
 	}
@@ -646,10 +690,14 @@ func TestProcessDownloads_RemoteAndLocal(t *testing.T) {
 		}
 		defer func() { _ = ln.Close() }()
 
-		var received int32
+		var received, withReferer int32
 		mux := http.NewServeMux()
 		mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
 			atomic.AddInt32(&received, 1)
+			var req DownloadRequest
+			if json.NewDecoder(r.Body).Decode(&req) == nil && req.Referer == "https://example.com/" {
+				atomic.AddInt32(&withReferer, 1)
+			}
 			w.WriteHeader(http.StatusAccepted)
 			_, _ = w.Write([]byte(`{"id":"ok"}`))
 		})
@@ -662,7 +710,7 @@ func TestProcessDownloads_RemoteAndLocal(t *testing.T) {
 			"https://example.com/a.zip,https://mirror.example.com/a.zip",
 			"",
 			"https://example.com/b.zip",
-		}, "", port)
+		}, "", port, DownloadRequest{Referer: "https://example.com/"})
 
 		if count != 2 {
 			t.Fatalf("expected 2 successful remote adds, got %d", count)
@@ -670,6 +718,9 @@ func TestProcessDownloads_RemoteAndLocal(t *testing.T) {
 		if atomic.LoadInt32(&received) != 2 {
 			t.Fatalf("expected 2 remote requests, got %d", received)
 		}
+		if atomic.LoadInt32(&withReferer) != 2 {
+			t.Fatalf("expected the referer in both remote requests, got %d", withReferer)
+		}
 	})
 
 	t.Run("local-mode", func(t *testing.T) {
@@ -683,7 +734,7 @@ func TestProcessDownloads_RemoteAndLocal(t *testing.T) {
 		count := processDownloads([]string{
 			"https://example.com/local.zip",
 			"",
-		}, t.TempDir(), 0)
+		}, t.TempDir(), 0, DownloadRequest{})
 
 		if count != 1 {
 			t.Fatalf("expected 1 successful local add, got %d", count)
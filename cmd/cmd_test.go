@@ -16,6 +16,7 @@ import (
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/core"
 	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/testutil"
 )
 
@@ -370,6 +371,56 @@ func TestHandleDownload_PathTraversal(t *testing.T) {
 	}
 }
 
+func TestHandleDownload_InvalidChecksum(t *testing.T) {
+	for _, sum := range []string{"sha256:abcd", "crc32:deadbeef", "not-a-digest"} {
+		body := `{"url": "http://x.com/f", "checksum": "` + sum + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/download", bytes.NewBufferString(body))
+		rec := httptest.NewRecorder()
+		svc := core.NewLocalDownloadService(nil)
+		handleDownload(rec, req, "", svc)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("checksum %q: expected 400, got %d", sum, rec.Code)
+		}
+		if !bytes.Contains(rec.Body.Bytes(), []byte("Invalid checksum")) {
+			t.Errorf("checksum %q: expected 'Invalid checksum' in response body", sum)
+		}
+	}
+}
+
+func TestHandleDownload_InvalidPieces(t *testing.T) {
+	body := `{"url": "http://x.com/f", "pieces": "sha256 1024\nabcd\n"}`
+	req := httptest.NewRequest(http.MethodPost, "/download", bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+	svc := core.NewLocalDownloadService(nil)
+	handleDownload(rec, req, "", svc)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+	if !bytes.Contains(rec.Body.Bytes(), []byte("Invalid pieces")) {
+		t.Errorf("expected 'Invalid pieces' in response body, got %q", rec.Body.String())
+	}
+}
+
+func TestFormatVerifyResult(t *testing.T) {
+	tests := []struct {
+		result types.VerifyResult
+		want   string
+	}{
+		{types.VerifyResult{ID: "0123456789", Status: "verified", Pieces: 12}, "Download 01234567: all 12 pieces verified"},
+		{types.VerifyResult{ID: "0123456789", Status: "repaired", Pieces: 12, Failed: 2, Repaired: 2}, "Download 01234567: repaired 2 of 12 pieces"},
+		{types.VerifyResult{ID: "0123456789", Status: "requeued", Pieces: 5, Failed: 1}, "Download 01234567: 1 of 5 pieces are bad and will be fetched again on resume"},
+		{types.VerifyResult{ID: "0123456789", Status: "mismatch", Pieces: 12, Failed: 3, Repaired: 1}, "Download 01234567: 3 of 12 pieces are bad, 1 could be repaired"},
+		{types.VerifyResult{ID: "abc", Status: "mismatch"}, "Download abc doesn't match its checksum"},
+	}
+	for _, tt := range tests {
+		if got := formatVerifyResult(&tt.result); got != tt.want {
+			t.Errorf("formatVerifyResult(%+v) = %q, want %q", tt.result, got, tt.want)
+		}
+	}
+}
+
 // func TestHandleDownload_StatusQuery(t *testing.T) {
 // 	// Setup mock download
 // 	id := "test-status-id"
@@ -7,12 +7,15 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/core"
 	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
 )
 
 func TestHandleDownload_PathResolution(t *testing.T) {
@@ -173,3 +176,465 @@ func TestHandleDownload_PathResolution(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleDownload_UnknownCategory(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	if err := config.SaveSettings(config.DefaultSettings()); err != nil {
+		t.Fatal(err)
+	}
+	svc := core.NewLocalDownloadService(download.NewWorkerPool(nil, 1))
+
+	body, _ := json.Marshal(DownloadRequest{URL: "http://example.com/song.mp3", Path: tempDir, Category: "Music"})
+	req := httptest.NewRequest("POST", "/download", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	handleDownload(w, req, tempDir, svc)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Music") {
+		t.Errorf("Expected 400 naming the category, got %d. Body: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleDownload_UnknownConflictPolicy(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	if err := config.SaveSettings(config.DefaultSettings()); err != nil {
+		t.Fatal(err)
+	}
+	svc := core.NewLocalDownloadService(download.NewWorkerPool(nil, 1))
+
+	body, _ := json.Marshal(DownloadRequest{URL: "http://example.com/song.mp3", Path: tempDir, ConflictPolicy: "ask"})
+	req := httptest.NewRequest("POST", "/download", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	handleDownload(w, req, tempDir, svc)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d. Body: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleDownload_HookCommands(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+	settings := config.DefaultSettings()
+	if err := config.SaveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	pool := download.NewWorkerPool(nil, 1)
+	pool.Hold() // Keep the downloads queued
+	svc := core.NewLocalDownloadService(pool)
+	defer func() { _ = svc.Shutdown() }()
+
+	post := func(hooks config.HookSettings, remoteAddr string) int {
+		body, _ := json.Marshal(DownloadRequest{URL: "http://127.0.0.1:1/file.bin", Path: tempDir, SkipApproval: true, Hooks: &hooks})
+		req := httptest.NewRequest("POST", "/download", bytes.NewBuffer(body))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handleDownload(w, req, tempDir, svc)
+		return w.Code
+	}
+
+	command := config.HookSettings{OnComplete: "touch /tmp/pwned"}
+	webhook := config.HookSettings{WebhookURL: "https://hooks.example.com/surge"}
+	if code := post(command, "192.0.2.1:1234"); code != http.StatusForbidden {
+		t.Errorf("command from another machine: expected 403, got %d", code)
+	}
+	if code := post(webhook, "192.0.2.1:1234"); code != http.StatusOK {
+		t.Errorf("webhook from another machine: expected 200, got %d", code)
+	}
+	if code := post(command, "127.0.0.1:1234"); code != http.StatusOK {
+		t.Errorf("command from this machine: expected 200, got %d", code)
+	}
+
+	settings.Hooks.AllowRemoteCommands = true
+	if err := config.SaveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if code := post(command, "192.0.2.1:1234"); code != http.StatusOK {
+		t.Errorf("command from another machine when allowed: expected 200, got %d", code)
+	}
+}
+
+func TestHandleDownload_InvalidProxy(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	if err := config.SaveSettings(config.DefaultSettings()); err != nil {
+		t.Fatal(err)
+	}
+	svc := core.NewLocalDownloadService(download.NewWorkerPool(nil, 1))
+
+	for _, proxy := range []string{"ftp://proxy.example.com", "socks5://", "127.0.0.1:1080"} {
+		body, _ := json.Marshal(DownloadRequest{URL: "http://example.com/song.mp3", Path: tempDir, Proxy: proxy})
+		req := httptest.NewRequest("POST", "/download", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		handleDownload(w, req, tempDir, svc)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("proxy %q: expected 400, got %d. Body: %s", proxy, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestDownloadRequest_RequestHeaders(t *testing.T) {
+	req := DownloadRequest{
+		Headers:   map[string]string{"user-agent": "browser/1.0", "X-Token": "abc"},
+		UserAgent: "surge-test/1.0",
+		Referer:   "https://example.com/page",
+	}
+	want := map[string]string{"User-Agent": "surge-test/1.0", "Referer": "https://example.com/page", "X-Token": "abc"}
+	if got := req.requestHeaders(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requestHeaders() = %v, want %v", got, want)
+	}
+	if req.Headers["user-agent"] != "browser/1.0" {
+		t.Errorf("requestHeaders changed the request's headers: %v", req.Headers)
+	}
+
+	plain := DownloadRequest{Headers: map[string]string{"Cookie": "a=b"}}
+	if got := plain.requestHeaders(); !reflect.DeepEqual(got, plain.Headers) {
+		t.Errorf("requestHeaders() without fields = %v, want %v", got, plain.Headers)
+	}
+}
+
+func TestHandleRateLimit(t *testing.T) {
+	pool := download.NewWorkerPool(nil, 1)
+	svc := core.NewLocalDownloadService(pool)
+
+	t.Run("Global", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/ratelimit?limit=1048576", nil)
+		w := httptest.NewRecorder()
+		handleRateLimit(w, req, svc)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected OK, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		if got := pool.GlobalRateLimit(); got != 1048576 {
+			t.Errorf("GlobalRateLimit = %d, want 1048576", got)
+		}
+	})
+
+	t.Run("InvalidLimit", func(t *testing.T) {
+		for _, q := range []string{"", "limit=abc", "limit=-1"} {
+			req := httptest.NewRequest("POST", "/ratelimit?"+q, nil)
+			w := httptest.NewRecorder()
+			handleRateLimit(w, req, svc)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("query %q: expected 400, got %d", q, w.Code)
+			}
+		}
+	})
+
+	t.Run("MethodNotAllowed", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/ratelimit?limit=0", nil)
+		w := httptest.NewRecorder()
+		handleRateLimit(w, req, svc)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected 405, got %d", w.Code)
+		}
+	})
+
+	t.Run("UnknownDownload", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/ratelimit?id=missing&limit=1024", nil)
+		w := httptest.NewRecorder()
+		handleRateLimit(w, req, svc)
+		if w.Code == http.StatusOK {
+			t.Error("expected error for unknown download")
+		}
+	})
+}
+
+func TestHandleMoveAndPriority(t *testing.T) {
+	pool := download.NewWorkerPool(nil, 1)
+	pool.Hold() // Keep everything queued
+	svc := core.NewLocalDownloadService(pool)
+
+	for _, id := range []string{"a", "b", "c"} {
+		pool.Add(types.DownloadConfig{ID: id, URL: "http://example.com/" + id})
+	}
+
+	t.Run("Move", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/move?id=c&to=top", nil)
+		w := httptest.NewRecorder()
+		handleMove(w, req, svc)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected OK, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		if got := pool.Queue(); len(got) != 3 || got[0] != "c" {
+			t.Errorf("queue = %v, want c first", got)
+		}
+	})
+
+	t.Run("MoveNotQueued", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/move?id=missing&to=top", nil)
+		w := httptest.NewRecorder()
+		handleMove(w, req, svc)
+		if w.Code != http.StatusConflict {
+			t.Errorf("expected 409, got %d", w.Code)
+		}
+	})
+
+	t.Run("MoveInvalid", func(t *testing.T) {
+		for _, q := range []string{"id=a", "to=top", "id=a&to=sideways"} {
+			req := httptest.NewRequest("POST", "/move?"+q, nil)
+			w := httptest.NewRecorder()
+			handleMove(w, req, svc)
+			if w.Code == http.StatusOK {
+				t.Errorf("query %q: expected an error", q)
+			}
+		}
+	})
+
+	t.Run("Priority", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/priority?id=b&priority=high", nil)
+		w := httptest.NewRecorder()
+		handlePriority(w, req, svc)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected OK, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		if got := pool.Queue(); got[0] != "b" {
+			t.Errorf("queue = %v, want high priority b first", got)
+		}
+	})
+
+	t.Run("PriorityInvalid", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/priority?id=b&priority=urgent", nil)
+		w := httptest.NewRecorder()
+		handlePriority(w, req, svc)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestHandleConcurrency(t *testing.T) {
+	pool := download.NewWorkerPool(nil, 3)
+	svc := core.NewLocalDownloadService(pool)
+
+	req := httptest.NewRequest("POST", "/concurrency?max=5", nil)
+	w := httptest.NewRecorder()
+	handleConcurrency(w, req, svc)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected OK, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if got := pool.MaxDownloads(); got != 5 {
+		t.Errorf("MaxDownloads() = %d, want 5", got)
+	}
+
+	for _, q := range []string{"", "max=0", "max=abc"} {
+		req := httptest.NewRequest("POST", "/concurrency?"+q, nil)
+		w := httptest.NewRecorder()
+		handleConcurrency(w, req, svc)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("query %q: expected 400, got %d", q, w.Code)
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/concurrency?max=2", nil)
+	w = httptest.NewRecorder()
+	handleConcurrency(w, req, svc)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+}
+
+func TestHandleMirrorAndBatchActions(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	webRoot := t.TempDir()
+	for _, f := range []string{"pub/a.iso", "pub/sub/b.iso", "pub/sub/notes.txt"} {
+		p := filepath.Join(webRoot, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(f), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(webRoot)))
+	defer server.Close()
+
+	outDir := filepath.Join(tempDir, "out")
+	// Already mirrored earlier
+	if err := os.MkdirAll(filepath.Join(outDir, "pub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "pub", "a.iso"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := download.NewWorkerPool(nil, 1)
+	pool.Hold() // Keep everything queued
+	svc := core.NewLocalDownloadService(pool)
+
+	body, _ := json.Marshal(MirrorRequest{URL: server.URL + "/pub/", Path: outDir, Exclude: []string{"*.txt"}})
+	req := httptest.NewRequest("POST", "/mirror", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handleMirror(w, req, "", svc)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected OK, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var result MirrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.IDs) != 1 || result.Skipped != 1 || result.BatchID == "" {
+		t.Fatalf("result = %+v, want one download and one skipped file", result)
+	}
+	cfg := pool.GetAll()[0]
+	if cfg.BatchID != result.BatchID || cfg.OutputPath != filepath.Join(outDir, "pub", "sub") || cfg.Filename != "b.iso" {
+		t.Errorf("queued %+v", cfg)
+	}
+
+	t.Run("PauseBatch", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handleBatchAction(w, svc, result.BatchID, "pause")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected OK, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		if len(pool.Queue()) != 0 {
+			t.Errorf("queue = %v, want the batch taken out", pool.Queue())
+		}
+		entry, err := state.GetDownload(result.IDs[0])
+		if err != nil || entry.Status != "paused" || entry.BatchID != result.BatchID {
+			t.Errorf("entry = %+v, err = %v, want paused in the batch", entry, err)
+		}
+	})
+
+	t.Run("ResumeBatch", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handleBatchAction(w, svc, result.BatchID, "resume")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected OK, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		if got := pool.Queue(); len(got) != 1 || got[0] != result.IDs[0] {
+			t.Errorf("queue = %v, want the batch queued again", got)
+		}
+	})
+
+	t.Run("UnknownBatch", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handleBatchAction(w, svc, "missing", "pause")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("NotAnIndex", func(t *testing.T) {
+		body, _ := json.Marshal(MirrorRequest{URL: server.URL + "/pub/a.iso", Path: outDir})
+		w := httptest.NewRecorder()
+		handleMirror(w, httptest.NewRequest("POST", "/mirror", bytes.NewReader(body)), "", svc)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422, got %d", w.Code)
+		}
+	})
+}
+
+func TestHandleBatches(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Setenv("HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	pool := download.NewWorkerPool(nil, 1)
+	pool.Hold() // Keep everything queued
+	svc := core.NewLocalDownloadService(pool)
+
+	opts := &types.AddOptions{BatchID: "3f2a1c9e-batch", BatchName: "urls.txt"}
+	var ids []string
+	for _, name := range []string{"a.bin", "b.bin"} {
+		id, err := svc.Add("http://127.0.0.1:1/"+name, tempDir, name, nil, nil, "", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if _, err := svc.Add("http://127.0.0.1:1/loose.bin", tempDir, "loose.bin", nil, nil, "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("List", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handleBatches(w, httptest.NewRequest("GET", "/batches", nil), svc)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected OK, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		var batches []types.BatchStatus
+		if err := json.NewDecoder(w.Body).Decode(&batches); err != nil {
+			t.Fatal(err)
+		}
+		if len(batches) != 1 || batches[0].Name != "urls.txt" || batches[0].Count != 2 || batches[0].Status != "queued" {
+			t.Errorf("batches = %+v, want one queued batch of two", batches)
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handleBatches(w, httptest.NewRequest("GET", "/batches?id="+opts.BatchID, nil), svc)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected OK, got %d. Body: %s", w.Code, w.Body.String())
+		}
+
+		w = httptest.NewRecorder()
+		handleBatches(w, httptest.NewRequest("GET", "/batches?id=missing", nil), svc)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("Priority", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handleBatchRoute(w, httptest.NewRequest("POST", "/batches/priority?id="+opts.BatchID+"&priority=high", nil), svc)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected OK, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		for _, id := range ids {
+			if st := pool.GetStatus(id); st == nil || st.Priority != types.PriorityHigh.String() {
+				t.Errorf("status of %s = %+v, want high priority", id, st)
+			}
+		}
+
+		w = httptest.NewRecorder()
+		handleBatchRoute(w, httptest.NewRequest("POST", "/batches/priority?id="+opts.BatchID+"&priority=urgent", nil), svc)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for an unknown priority, got %d", w.Code)
+		}
+	})
+
+	t.Run("BadRequests", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handleBatchRoute(w, httptest.NewRequest("POST", "/batches/explode?id="+opts.BatchID, nil), svc)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("unknown action: expected 404, got %d", w.Code)
+		}
+		w = httptest.NewRecorder()
+		handleBatchRoute(w, httptest.NewRequest("POST", "/batches/pause", nil), svc)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("missing id: expected 400, got %d", w.Code)
+		}
+		w = httptest.NewRecorder()
+		handleBatchRoute(w, httptest.NewRequest("GET", "/batches/pause?id="+opts.BatchID, nil), svc)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET: expected 405, got %d", w.Code)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handleBatchRoute(w, httptest.NewRequest("DELETE", "/batches/delete?id="+opts.BatchID, nil), svc)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected OK, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		if got := pool.Queue(); len(got) != 1 {
+			t.Errorf("queue = %v, want only the loose download left", got)
+		}
+	})
+}
@@ -6,10 +6,12 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/core"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
@@ -26,6 +28,7 @@ var lsCmd = &cobra.Command{
 
 		jsonOutput, _ := cmd.Flags().GetBool("json")
 		watch, _ := cmd.Flags().GetBool("watch")
+		group, _ := cmd.Flags().GetBool("group")
 
 		baseURL, token, err := resolveAPIConnection(false)
 		if err != nil {
@@ -45,11 +48,11 @@ var lsCmd = &cobra.Command{
 			for {
 				// Clear screen first for watch mode
 				fmt.Print("\033[H\033[2J")
-				printDownloads(jsonOutput, baseURL, token, strictRemote)
+				printDownloads(jsonOutput, group, baseURL, token, strictRemote)
 				time.Sleep(1 * time.Second)
 			}
 		} else {
-			printDownloads(jsonOutput, baseURL, token, strictRemote)
+			printDownloads(jsonOutput, group, baseURL, token, strictRemote)
 		}
 	},
 }
@@ -64,56 +67,20 @@ type downloadInfo struct {
 	TotalSize  int64   `json:"total_size"`
 	Downloaded int64   `json:"downloaded"`
 	Speed      float64 `json:"speed,omitempty"`
+	BatchID    string  `json:"batch_id,omitempty"`
+	Category   string  `json:"category,omitempty"`
 }
 
-func printDownloads(jsonOutput bool, baseURL string, token string, strictRemote bool) {
-	var downloads []downloadInfo
-
-	// Try to get from running server first
-	if baseURL != "" {
-		serverDownloads, err := GetRemoteDownloads(baseURL, token)
-		if err != nil {
-			if strictRemote {
-				fmt.Fprintf(os.Stderr, "Error listing remote downloads: %v\n", err)
-				os.Exit(1)
-			}
-		} else {
-			for _, s := range serverDownloads {
-				downloads = append(downloads, downloadInfo{
-					ID:         s.ID,
-					Filename:   s.Filename,
-					Status:     s.Status,
-					Progress:   s.Progress,
-					TotalSize:  s.TotalSize,
-					Downloaded: s.Downloaded,
-					Speed:      s.Speed,
-				})
-			}
-		}
+func printDownloads(jsonOutput bool, group bool, baseURL string, token string, strictRemote bool) {
+	statuses := listDownloadStatuses(baseURL, token, strictRemote)
+	if group {
+		printGroupedDownloads(statuses, jsonOutput)
+		return
 	}
 
-	// Fall back to database only when not explicitly targeting a remote host.
-	if len(downloads) == 0 && !(strictRemote && baseURL != "") {
-		dbDownloads, err := state.ListAllDownloads()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error listing downloads: %v\n", err)
-			os.Exit(1)
-		}
-
-		for _, d := range dbDownloads {
-			var progress float64
-			if d.TotalSize > 0 {
-				progress = float64(d.Downloaded) * 100 / float64(d.TotalSize)
-			}
-			downloads = append(downloads, downloadInfo{
-				ID:         d.ID,
-				Filename:   d.Filename,
-				Status:     d.Status,
-				Progress:   progress,
-				TotalSize:  d.TotalSize,
-				Downloaded: d.Downloaded,
-			})
-		}
+	var downloads []downloadInfo
+	for _, s := range statuses {
+		downloads = append(downloads, newDownloadInfo(s))
 	}
 
 	if len(downloads) == 0 {
@@ -133,8 +100,8 @@ func printDownloads(jsonOutput bool, baseURL string, token string, strictRemote
 
 	// Table output
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	_, _ = fmt.Fprintln(w, "ID\tFILENAME\tSTATUS\tPROGRESS\tSPEED\tSIZE")
-	_, _ = fmt.Fprintln(w, "--\t--------\t------\t--------\t-----\t----")
+	_, _ = fmt.Fprintln(w, "ID\tFILENAME\tSTATUS\tPROGRESS\tSPEED\tSIZE\tCATEGORY")
+	_, _ = fmt.Fprintln(w, "--\t--------\t------\t--------\t-----\t----\t--------")
 
 	for _, d := range downloads {
 		progress := fmt.Sprintf("%.1f%%", d.Progress)
@@ -160,11 +127,169 @@ func printDownloads(jsonOutput bool, baseURL string, token string, strictRemote
 			filename = filename[:22] + "..."
 		}
 
-		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", id, filename, d.Status, progress, speed, size)
+		category := d.Category
+		if category == "" {
+			category = "-"
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", id, filename, d.Status, progress, speed, size, category)
+	}
+	_ = w.Flush()
+}
+
+// listDownloadStatuses returns the downloads of the running server, or of the
+// database when no server is running
+func listDownloadStatuses(baseURL string, token string, strictRemote bool) []types.DownloadStatus {
+	// Try to get from running server first
+	if baseURL != "" {
+		serverDownloads, err := GetRemoteDownloads(baseURL, token)
+		if err != nil {
+			if strictRemote {
+				fmt.Fprintf(os.Stderr, "Error listing remote downloads: %v\n", err)
+				os.Exit(1)
+			}
+		} else if len(serverDownloads) > 0 {
+			return serverDownloads
+		}
+	}
+
+	// Fall back to database only when not explicitly targeting a remote host.
+	if strictRemote && baseURL != "" {
+		return nil
+	}
+	dbDownloads, err := state.ListAllDownloads()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing downloads: %v\n", err)
+		os.Exit(1)
+	}
+	names := make(map[string]string)
+	if batches, err := state.ListBatches(); err == nil {
+		for _, b := range batches {
+			names[b.ID] = b.Name
+		}
+	}
+
+	var statuses []types.DownloadStatus
+	for _, d := range dbDownloads {
+		var progress float64
+		if d.TotalSize > 0 {
+			progress = float64(d.Downloaded) * 100 / float64(d.TotalSize)
+		}
+		statuses = append(statuses, types.DownloadStatus{
+			ID:         d.ID,
+			Filename:   d.Filename,
+			Status:     d.Status,
+			Progress:   progress,
+			TotalSize:  d.TotalSize,
+			Downloaded: d.Downloaded,
+			BatchID:    d.BatchID,
+			BatchName:  names[d.BatchID],
+			Category:   d.Category,
+		})
+	}
+	return statuses
+}
+
+func newDownloadInfo(s types.DownloadStatus) downloadInfo {
+	return downloadInfo{
+		ID:         s.ID,
+		Filename:   s.Filename,
+		Status:     s.Status,
+		Progress:   s.Progress,
+		TotalSize:  s.TotalSize,
+		Downloaded: s.Downloaded,
+		Speed:      s.Speed,
+		BatchID:    s.BatchID,
+		Category:   s.Category,
+	}
+}
+
+// groupedDownloads is the JSON output of "surge ls --group"
+type groupedDownloads struct {
+	Batches   []types.BatchStatus `json:"batches"`
+	Downloads []downloadInfo      `json:"downloads"` // Downloads outside any batch
+}
+
+// printGroupedDownloads lists each batch with its totals above its
+// downloads, then the downloads outside any batch
+func printGroupedDownloads(statuses []types.DownloadStatus, jsonOutput bool) {
+	batches := core.SummarizeBatches(statuses)
+	members := make(map[string][]downloadInfo)
+	var loose []downloadInfo
+	for _, s := range statuses {
+		if s.BatchID == "" {
+			loose = append(loose, newDownloadInfo(s))
+		} else {
+			members[s.BatchID] = append(members[s.BatchID], newDownloadInfo(s))
+		}
+	}
+
+	if jsonOutput {
+		out := groupedDownloads{Batches: batches, Downloads: loose}
+		if out.Batches == nil {
+			out.Batches = []types.BatchStatus{}
+		}
+		if out.Downloads == nil {
+			out.Downloads = []downloadInfo{}
+		}
+		data, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No downloads found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tNAME\tSTATUS\tPROGRESS\tSPEED\tSIZE\tETA")
+	_, _ = fmt.Fprintln(w, "--\t----\t------\t--------\t-----\t----\t---")
+	for _, b := range batches {
+		name := b.Name
+		if name == "" {
+			name = "batch"
+		}
+		files := fmt.Sprintf("%s (%d/%d)", truncateName(name, 25), b.Completed, b.Count)
+		eta := "-"
+		if b.ETA > 0 {
+			eta = (time.Duration(b.ETA) * time.Second).String()
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%.1f%%\t%s\t%s\t%s\n", shortID(b.ID), files, b.Status, b.Progress,
+			formatSpeed(b.Speed), utils.ConvertBytesToHumanReadable(b.TotalSize), eta)
+		for _, d := range members[b.ID] {
+			_, _ = fmt.Fprintf(w, "  %s\t  %s\t%s\t%.1f%%\t%s\t%s\t\n", shortID(d.ID), truncateName(d.Filename, 23), d.Status, d.Progress,
+				formatSpeed(d.Speed), utils.ConvertBytesToHumanReadable(d.TotalSize))
+		}
+	}
+	for _, d := range loose {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%.1f%%\t%s\t%s\t\n", shortID(d.ID), truncateName(d.Filename, 25), d.Status, d.Progress,
+			formatSpeed(d.Speed), utils.ConvertBytesToHumanReadable(d.TotalSize))
 	}
 	_ = w.Flush()
 }
 
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+func truncateName(name string, max int) string {
+	if len(name) > max {
+		return name[:max-3] + "..."
+	}
+	return name
+}
+
+func formatSpeed(mbps float64) string {
+	if mbps > 0 {
+		return fmt.Sprintf("%.1f MB/s", mbps)
+	}
+	return "-"
+}
+
 func showDownloadDetails(partialID string, jsonOutput bool, baseURL string, token string) {
 	strictRemote := resolveHostTarget() != ""
 
@@ -243,6 +368,9 @@ func showDownloadDetails(partialID string, jsonOutput bool, baseURL string, toke
 		TotalSize:  found.TotalSize,
 		Downloaded: found.Downloaded,
 		Progress:   progress,
+		BatchID:    found.BatchID,
+		Category:   found.Category,
+		HookOutput: found.HookOutput,
 	}
 	printDownloadDetail(status, jsonOutput)
 }
@@ -263,13 +391,33 @@ func printDownloadDetail(d types.DownloadStatus, jsonOutput bool) {
 	if d.Speed > 0 {
 		fmt.Printf("Speed:      %.1f MB/s\n", d.Speed)
 	}
+	if d.Priority != "" {
+		fmt.Printf("Priority:   %s\n", d.Priority)
+	}
+	if d.QueuePosition > 0 {
+		fmt.Printf("Queue:      #%d\n", d.QueuePosition)
+	}
+	if d.BatchID != "" {
+		fmt.Printf("Batch:      %s (%s)\n", d.BatchName, shortID(d.BatchID))
+	}
+	if d.Category != "" {
+		fmt.Printf("Category:   %s\n", d.Category)
+	}
 	if d.Error != "" {
 		fmt.Printf("Error:      %s\n", d.Error)
 	}
+	if d.HookOutput != "" {
+		fmt.Printf("Hooks:\n%s\n", indent(d.HookOutput, "  "))
+	}
+}
+
+func indent(text, prefix string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
 }
 
 func init() {
 	rootCmd.AddCommand(lsCmd)
 	lsCmd.Flags().Bool("json", false, "Output in JSON format")
 	lsCmd.Flags().Bool("watch", false, "Watch mode: refresh every second")
+	lsCmd.Flags().Bool("group", false, "Group downloads by batch with the totals of each batch")
 }
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/core"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/crawl"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// MirrorRequest asks the server to crawl a directory index and download
+// every file below it
+type MirrorRequest struct {
+	URL      string            `json:"url"`
+	Path     string            `json:"path,omitempty"`      // Output directory, the default download directory if empty
+	Depth    *int              `json:"depth,omitempty"`     // Levels of subdirectories, crawl.DefaultMaxDepth if unset, < 0 for no limit
+	Include  []string          `json:"include,omitempty"`   // Globs a file must match one of
+	Exclude  []string          `json:"exclude,omitempty"`   // Globs of files and directories to skip
+	SameHost *bool             `json:"same_host,omitempty"` // Skip files on other hosts, true if unset
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+// MirrorResponse lists the downloads a mirror request queued
+type MirrorResponse struct {
+	BatchID string   `json:"batch_id"`
+	IDs     []string `json:"ids"`
+	Skipped int      `json:"skipped,omitempty"` // Files already present in the output directory
+}
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror <url>",
+	Short: "Download every file below a directory index",
+	Long: `Crawl an HTTP directory listing (Apache or nginx autoindex and the like)
+and add one download per file, recreating its subdirectories in a directory
+named after the listing. Files that already exist are skipped. The downloads
+form a batch that can be paused and resumed together with --batch.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		depth, _ := cmd.Flags().GetInt("depth")
+		include, _ := cmd.Flags().GetStringArray("include")
+		exclude, _ := cmd.Flags().GetStringArray("exclude")
+		sameHost, _ := cmd.Flags().GetBool("same-host")
+		output, _ := cmd.Flags().GetString("output")
+		if output != "" {
+			output = utils.EnsureAbsPath(output)
+		}
+
+		baseURL, token, err := resolveAPIConnection(true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		body, err := json.Marshal(MirrorRequest{
+			URL:      args[0],
+			Path:     output,
+			Depth:    &depth,
+			Include:  include,
+			Exclude:  exclude,
+			SameHost: &sameHost,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		resp, err := doAPIRequest(http.MethodPost, baseURL, token, "/mirror", bytes.NewReader(body))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				utils.Debug("Error closing response body: %v", err)
+			}
+		}()
+
+		if resp.StatusCode != http.StatusOK {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			fmt.Fprintf(os.Stderr, "Error: %s\n", strings.TrimSpace(string(msg)))
+			os.Exit(1)
+		}
+
+		var result MirrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid response: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Added %d downloads as batch %s", len(result.IDs), result.BatchID[:8])
+		if result.Skipped > 0 {
+			fmt.Printf(" (%d files already present)", result.Skipped)
+		}
+		fmt.Println()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mirrorCmd)
+	mirrorCmd.Flags().StringP("output", "o", "", "Output directory")
+	mirrorCmd.Flags().IntP("depth", "d", crawl.DefaultMaxDepth, "Levels of subdirectories to crawl (-1 for no limit)")
+	mirrorCmd.Flags().StringArray("include", nil, "Only download files matching this glob, e.g. '*.iso' (repeatable)")
+	mirrorCmd.Flags().StringArray("exclude", nil, "Skip files and directories matching this glob (repeatable)")
+	mirrorCmd.Flags().Bool("same-host", true, "Skip files linked from other hosts")
+}
+
+// handleMirror crawls the directory index in a MirrorRequest and queues a
+// download for every file found, all in one new batch
+func handleMirror(w http.ResponseWriter, r *http.Request, defaultOutputDir string, service core.DownloadService) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	var req MirrorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.URL == "" {
+		http.Error(w, "URL is required", http.StatusBadRequest)
+		return
+	}
+	if strings.Contains(req.Path, "..") {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := config.LoadSettings()
+	if err != nil {
+		settings = config.DefaultSettings()
+	}
+	outPath := req.Path
+	if outPath == "" {
+		outPath = defaultOutputDir
+	}
+	if outPath == "" {
+		outPath = settings.General.DefaultDownloadDir
+	}
+	if outPath == "" {
+		outPath = "."
+	}
+	outPath = utils.EnsureAbsPath(outPath)
+
+	opts := crawl.Options{
+		MaxDepth: crawl.DefaultMaxDepth,
+		Include:  req.Include,
+		Exclude:  req.Exclude,
+		SameHost: req.SameHost == nil || *req.SameHost,
+		Headers:  req.Headers,
+	}
+	if req.Depth != nil {
+		opts.MaxDepth = *req.Depth
+	}
+	runtime := types.ConvertRuntimeConfig(settings.ToRuntimeConfig())
+	download.AttachCredentials(runtime)
+	files, err := crawl.Crawl(r.Context(), req.URL, opts, runtime)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, crawl.ErrNotIndex) {
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if len(files) == 0 {
+		http.Error(w, "No files found below "+req.URL, http.StatusNotFound)
+		return
+	}
+
+	// With PreserveURLPath the manager lays out host and path itself
+	rootDir := filepath.Join(outPath, crawl.RootName(req.URL))
+	result := MirrorResponse{BatchID: uuid.New().String()}
+	for _, f := range files {
+		dir := filepath.Join(rootDir, filepath.FromSlash(f.Dir()))
+		if settings.General.PreserveURLPath {
+			dir = outPath
+		} else if _, err := os.Stat(filepath.Join(dir, f.Name())); err == nil {
+			result.Skipped++
+			continue
+		}
+		id, err := service.Add(f.URL, dir, f.Name(), nil, req.Headers, "", &types.AddOptions{BatchID: result.BatchID, BatchName: crawl.RootName(req.URL)})
+		if err != nil {
+			utils.Debug("Mirror: failed to add %s: %v", f.URL, err)
+			continue
+		}
+		result.IDs = append(result.IDs, id)
+		atomic.AddInt32(&activeDownloads, 1)
+	}
+	utils.Debug("Mirror %s: queued %d files as batch %s", req.URL, len(result.IDs), result.BatchID)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/surge-downloader/surge/internal/testutil"
+	"github.com/surge-downloader/surge/internal/utils"
 )
 
 // TestMirrors_CLI_Integration verifies that the processDownloads function (used by CLI)
@@ -55,7 +56,7 @@ func TestMirrors_CLI_Integration(t *testing.T) {
 	arg := fmt.Sprintf("%s,%s,%s", primaryURL, mirror1, mirror2)
 
 	// Simulate "surge add <arg>"
-	processDownloads([]string{arg}, ".", port)
+	processDownloads([]string{arg}, ".", port, DownloadRequest{})
 
 	// 3. Verify the server received the correct request
 	select {
@@ -109,6 +110,24 @@ func TestParseURLArg_Unit(t *testing.T) {
 			expectedURL:     "http://a.com",
 			expectedMirrors: []string{"http://a.com", "http://b.com"},
 		},
+		{
+			name:            "Local metalink",
+			input:           "releases.meta4",
+			expectedURL:     utils.EnsureAbsPath("releases.meta4"),
+			expectedMirrors: []string{utils.EnsureAbsPath("releases.meta4")},
+		},
+		{
+			name:            "Local torrent",
+			input:           "ubuntu.torrent",
+			expectedURL:     utils.EnsureAbsPath("ubuntu.torrent"),
+			expectedMirrors: []string{utils.EnsureAbsPath("ubuntu.torrent")},
+		},
+		{
+			name:            "Magnet with commas in the name",
+			input:           "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=a,b",
+			expectedURL:     "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=a,b",
+			expectedMirrors: []string{"magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=a,b"},
+		},
 		{
 			name:            "Empty URL",
 			input:           "",
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+var moveCmd = &cobra.Command{
+	Use:   "move <ID>",
+	Short: "Change the place of a queued download",
+	Long: `Move a queued download within the queue.
+Use exactly one of --top, --bottom, --up, --down or --to.
+Moving past downloads of another priority takes on their priority.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		to, err := moveTarget(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		baseURL, token, err := resolveAPIConnection(true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Resolve partial ID to full ID
+		id, err := resolveDownloadID(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		path := fmt.Sprintf("/move?id=%s&to=%s", url.QueryEscape(id), url.QueryEscape(to))
+		resp, err := doAPIRequest(http.MethodPost, baseURL, token, path, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				utils.Debug("Error closing response body: %v", err)
+			}
+		}()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			fmt.Fprintf(os.Stderr, "Error: server returned %s: %s\n", resp.Status, strings.TrimSpace(string(body)))
+			os.Exit(1)
+		}
+		fmt.Printf("Moved download %s %s\n", id[:8], describeMove(to))
+	},
+}
+
+// moveTarget turns the move flags into the API's "to" value
+func moveTarget(cmd *cobra.Command) (string, error) {
+	var targets []string
+	for _, flag := range []string{download.MoveTop, download.MoveBottom, download.MoveUp, download.MoveDown} {
+		if set, _ := cmd.Flags().GetBool(flag); set {
+			targets = append(targets, flag)
+		}
+	}
+	if pos, _ := cmd.Flags().GetInt("to"); pos != 0 {
+		if pos < 1 {
+			return "", fmt.Errorf("--to must be 1 or more")
+		}
+		targets = append(targets, strconv.Itoa(pos))
+	}
+
+	if len(targets) != 1 {
+		return "", fmt.Errorf("use exactly one of --top, --bottom, --up, --down or --to")
+	}
+	return targets[0], nil
+}
+
+func describeMove(to string) string {
+	switch to {
+	case download.MoveTop:
+		return "to the top of the queue"
+	case download.MoveBottom:
+		return "to the bottom of the queue"
+	case download.MoveUp, download.MoveDown:
+		return to
+	}
+	return "to position " + to
+}
+
+func init() {
+	rootCmd.AddCommand(moveCmd)
+	moveCmd.Flags().Bool(download.MoveTop, false, "Move to the top of the queue")
+	moveCmd.Flags().Bool(download.MoveBottom, false, "Move to the bottom of the queue")
+	moveCmd.Flags().Bool(download.MoveUp, false, "Move one place up")
+	moveCmd.Flags().Bool(download.MoveDown, false, "Move one place down")
+	moveCmd.Flags().Int("to", 0, "Move to a 1-based position in the queue")
+}
@@ -13,15 +13,16 @@ import (
 var pauseCmd = &cobra.Command{
 	Use:   "pause <ID>",
 	Short: "Pause a download",
-	Long:  `Pause a download by its ID. Use --all to pause all downloads.`,
+	Long:  `Pause a download by its ID. Use --batch to pause the downloads of a batch, or --all to pause all downloads.`,
 	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		initializeGlobalState()
 
 		all, _ := cmd.Flags().GetBool("all")
+		batch, _ := cmd.Flags().GetString("batch")
 
-		if !all && len(args) == 0 {
-			fmt.Fprintln(os.Stderr, "Error: provide a download ID or use --all")
+		if !all && batch == "" && len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: provide a download ID or use --all or --batch")
 			os.Exit(1)
 		}
 
@@ -31,6 +32,16 @@ var pauseCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		if batch != "" {
+			n, err := sendBatchAction(baseURL, token, batch, "pause", nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Paused %d downloads of batch %s\n", n, batch)
+			return
+		}
+
 		if all {
 			// TODO: Implement /pause-all endpoint or iterate
 			fmt.Println("Pausing all downloads is not yet implemented for running server.")
@@ -70,4 +81,5 @@ var pauseCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(pauseCmd)
 	pauseCmd.Flags().Bool("all", false, "Pause all downloads")
+	pauseCmd.Flags().String("batch", "", "Pause the downloads of a batch, e.g. one added by \"surge mirror\"")
 }
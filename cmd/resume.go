@@ -13,15 +13,16 @@ import (
 var resumeCmd = &cobra.Command{
 	Use:   "resume <ID>",
 	Short: "Resume a paused download",
-	Long:  `Resume a paused download by its ID. Use --all to resume all paused downloads.`,
+	Long:  `Resume a paused download by its ID. Use --batch to resume the downloads of a batch, or --all to resume all paused downloads.`,
 	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		initializeGlobalState()
 
 		all, _ := cmd.Flags().GetBool("all")
+		batch, _ := cmd.Flags().GetString("batch")
 
-		if !all && len(args) == 0 {
-			fmt.Fprintln(os.Stderr, "Error: provide a download ID or use --all")
+		if !all && batch == "" && len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: provide a download ID or use --all or --batch")
 			os.Exit(1)
 		}
 
@@ -31,6 +32,16 @@ var resumeCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		if batch != "" {
+			n, err := sendBatchAction(baseURL, token, batch, "resume", nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Resumed %d downloads of batch %s\n", n, batch)
+			return
+		}
+
 		if all {
 			fmt.Println("Resuming all downloads is not yet implemented for running server.")
 			return
@@ -69,4 +80,5 @@ var resumeCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(resumeCmd)
 	resumeCmd.Flags().Bool("all", false, "Resume all paused downloads")
+	resumeCmd.Flags().String("batch", "", "Resume the paused downloads of a batch")
 }
@@ -15,15 +15,16 @@ var rmCmd = &cobra.Command{
 	Use:     "rm <ID>",
 	Aliases: []string{"kill"},
 	Short:   "Remove a download",
-	Long:    `Remove a download by its ID. Use --clean to remove all completed downloads.`,
+	Long:    `Remove a download by its ID. Use --batch to remove every download of a batch, or --clean to remove all completed downloads.`,
 	Args:    cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		initializeGlobalState()
 
 		clean, _ := cmd.Flags().GetBool("clean")
+		batch, _ := cmd.Flags().GetString("batch")
 
-		if !clean && len(args) == 0 {
-			fmt.Fprintln(os.Stderr, "Error: provide a download ID or use --clean")
+		if !clean && batch == "" && len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: provide a download ID or use --batch or --clean")
 			os.Exit(1)
 		}
 
@@ -44,6 +45,16 @@ var rmCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		if batch != "" {
+			n, err := sendBatchAction(baseURL, token, batch, "delete", nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Removed %d downloads of batch %s\n", n, batch)
+			return
+		}
+
 		id := args[0]
 
 		// Resolve partial ID to full ID
@@ -77,4 +88,5 @@ var rmCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(rmCmd)
 	rmCmd.Flags().Bool("clean", false, "Remove all completed downloads")
+	rmCmd.Flags().String("batch", "", "Remove every download of a batch")
 }
@@ -4,12 +4,14 @@ import (
 	"context"
 	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"syscall"
@@ -18,8 +20,10 @@ import (
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/core"
 	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/checksum"
 	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/tui"
 	"github.com/surge-downloader/surge/internal/utils"
 
@@ -47,6 +51,7 @@ var (
 // Globals for Unified Backend
 var (
 	GlobalPool              *download.WorkerPool
+	GlobalScheduler         *download.Scheduler
 	GlobalProgressCh        chan any
 	GlobalService           core.DownloadService
 	serverProgram           *tea.Program
@@ -74,6 +79,7 @@ var rootCmd = &cobra.Command{
 			settings = config.DefaultSettings()
 		}
 		GlobalPool = download.NewWorkerPool(GlobalProgressCh, settings.Network.MaxConcurrentDownloads)
+		GlobalPool.SetGlobalRateLimit(settings.Network.GlobalRateLimit)
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		if hostTarget := resolveHostTarget(); hostTarget != "" {
@@ -109,12 +115,18 @@ var rootCmd = &cobra.Command{
 
 		// Initialize Service
 		GlobalService = core.NewLocalDownloadServiceWithInput(GlobalPool, GlobalProgressCh)
+		startGlobalScheduler()
 
 		portFlag, _ := cmd.Flags().GetInt("port")
 		batchFile, _ := cmd.Flags().GetString("batch")
 		outputDir, _ := cmd.Flags().GetString("output")
 		noResume, _ := cmd.Flags().GetBool("no-resume")
 		exitWhenDone, _ := cmd.Flags().GetBool("exit-when-done")
+		request, err := requestFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 
 		port, listener, err := bindServerListener(portFlag)
 		if err != nil {
@@ -144,7 +156,7 @@ var rootCmd = &cobra.Command{
 			}
 
 			if len(urls) > 0 {
-				processDownloads(urls, outputDir, 0) // 0 port = internal direct add
+				processDownloads(urls, outputDir, 0, request) // 0 port = internal direct add
 			}
 		}()
 
@@ -153,6 +165,23 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// startGlobalScheduler starts the bandwidth schedule from settings.json
+func startGlobalScheduler() {
+	if GlobalPool == nil || GlobalScheduler != nil {
+		return
+	}
+	settings, err := config.LoadSettings()
+	if err != nil {
+		settings = config.DefaultSettings()
+	}
+	GlobalScheduler = download.NewScheduler(GlobalPool, settings.Schedule)
+	GlobalScheduler.Start()
+	// Saving the settings applies schedule changes without a restart
+	if ls, ok := GlobalService.(*core.LocalDownloadService); ok {
+		ls.Scheduler = GlobalScheduler
+	}
+}
+
 func runStartupIntegrityCheck() string {
 	// Validate integrity of paused/queued downloads before auto-resume.
 	// This removes entries whose .surge files are missing/tampered and
@@ -180,6 +209,9 @@ func startTUI(port int, exitWhenDone bool, noResume bool) {
 		m.ServerHost = "127.0.0.1"
 	}
 	m.IsRemote = false
+	if GlobalScheduler != nil {
+		m.ScheduleProfile, m.SchedulePaused = GlobalScheduler.ActiveProfile()
+	}
 
 	p := tea.NewProgram(m, tea.WithAltScreen())
 	serverProgram = p // Save reference for HTTP handler
@@ -282,6 +314,31 @@ func StartHeadlessConsumer() {
 					id = id[:8]
 				}
 				fmt.Printf("Completed: %s [%s] (in %s)\n", m.Filename, id, m.Elapsed)
+			case events.DownloadSkippedMsg:
+				atomic.AddInt32(&activeDownloads, -1)
+				id := m.DownloadID
+				if len(id) > 8 {
+					id = id[:8]
+				}
+				fmt.Printf("Skipped: %s [%s] (already present)\n", m.Filename, id)
+			case events.DownloadVerifiedMsg:
+				id := m.DownloadID
+				if len(id) > 8 {
+					id = id[:8]
+				}
+				fmt.Printf("Verified: %s [%s] (%s)\n", m.Filename, id, m.Algorithm)
+			case events.ExtractCompleteMsg:
+				id := m.DownloadID
+				if len(id) > 8 {
+					id = id[:8]
+				}
+				fmt.Printf("Extracted: %s [%s] (%d files to %s)\n", m.Filename, id, m.Files, m.Dir)
+			case events.ExtractErrorMsg:
+				id := m.DownloadID
+				if len(id) > 8 {
+					id = id[:8]
+				}
+				fmt.Printf("Extract failed: %s [%s]: %s\n", m.Filename, id, m.Error)
 			case events.DownloadErrorMsg:
 				atomic.AddInt32(&activeDownloads, -1)
 				id := m.DownloadID
@@ -437,6 +494,18 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string, service
 					eventType = "started"
 				case events.DownloadCompleteMsg:
 					eventType = "complete"
+				case events.DownloadSkippedMsg:
+					eventType = "skipped"
+				case events.DownloadVerifiedMsg:
+					eventType = "verified"
+				case events.ExtractStartedMsg:
+					eventType = "extract_started"
+				case events.ExtractProgressMsg:
+					eventType = "extract_progress"
+				case events.ExtractCompleteMsg:
+					eventType = "extracted"
+				case events.ExtractErrorMsg:
+					eventType = "extract_error"
 				case events.DownloadErrorMsg:
 					eventType = "error"
 				case events.ProgressMsg:
@@ -453,6 +522,10 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string, service
 					eventType = "request"
 				case events.SystemLogMsg:
 					eventType = "system"
+				case events.ScheduleChangedMsg:
+					eventType = "schedule"
+				case events.QueueReorderedMsg:
+					eventType = "queue"
 				case events.BatchProgressMsg:
 					// Unroll batch and send individual progress events
 					for _, p := range msg {
@@ -481,11 +554,16 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string, service
 	})
 
 	// Pause endpoint (Protected)
+	// With batch instead of id it pauses every unfinished download of the batch.
 	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
+		if batch := r.URL.Query().Get("batch"); batch != "" {
+			handleBatchAction(w, service, batch, "pause")
+			return
+		}
 		id := r.URL.Query().Get("id")
 		if id == "" {
 			http.Error(w, "Missing id parameter", http.StatusBadRequest)
@@ -504,11 +582,16 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string, service
 	})
 
 	// Resume endpoint (Protected)
+	// With batch instead of id it resumes every paused download of the batch.
 	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
+		if batch := r.URL.Query().Get("batch"); batch != "" {
+			handleBatchAction(w, service, batch, "resume")
+			return
+		}
 		id := r.URL.Query().Get("id")
 		if id == "" {
 			http.Error(w, "Missing id parameter", http.StatusBadRequest)
@@ -549,6 +632,61 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string, service
 		}
 	})
 
+	// Verify endpoint (Protected)
+	mux.HandleFunc("/verify", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "Missing id parameter", http.StatusBadRequest)
+			return
+		}
+
+		result, err := service.Verify(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			utils.Debug("Failed to encode response: %v", err)
+		}
+	})
+
+	// Mirror endpoint (Protected)
+	mux.HandleFunc("/mirror", func(w http.ResponseWriter, r *http.Request) {
+		handleMirror(w, r, defaultOutputDir, service)
+	})
+
+	// Batch endpoints (Protected)
+	mux.HandleFunc("/batches", func(w http.ResponseWriter, r *http.Request) {
+		handleBatches(w, r, service)
+	})
+	mux.HandleFunc("/batches/", func(w http.ResponseWriter, r *http.Request) {
+		handleBatchRoute(w, r, service)
+	})
+
+	// Rate limit endpoint (Protected)
+	// With an id it changes that download's limit, without one it changes the global limit.
+	mux.HandleFunc("/ratelimit", func(w http.ResponseWriter, r *http.Request) {
+		handleRateLimit(w, r, service)
+	})
+
+	mux.HandleFunc("/concurrency", func(w http.ResponseWriter, r *http.Request) {
+		handleConcurrency(w, r, service)
+	})
+
+	// Queue endpoints (Protected)
+	mux.HandleFunc("/move", func(w http.ResponseWriter, r *http.Request) {
+		handleMove(w, r, service)
+	})
+	mux.HandleFunc("/priority", func(w http.ResponseWriter, r *http.Request) {
+		handlePriority(w, r, service)
+	})
+
 	// List endpoint (Protected)
 	mux.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -699,15 +837,191 @@ func writeTokenToFile(path string, token string) error {
 	return os.WriteFile(path, []byte(token), 0o600)
 }
 
+// handleRateLimit changes a per-download or global bandwidth limit.
+// limit is in bytes/sec; 0 removes the limit.
+func handleRateLimit(w http.ResponseWriter, r *http.Request, service core.DownloadService) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	limit, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+	if err != nil || limit < 0 {
+		http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		err = service.SetGlobalRateLimit(limit)
+	} else {
+		err = service.SetRateLimit(id, limit)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"status": "updated", "id": id, "rate_limit": limit}); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
+
+// handleConcurrency changes how many downloads may run at once.
+// Downloads already running above a lowered limit are allowed to finish.
+func handleConcurrency(w http.ResponseWriter, r *http.Request, service core.DownloadService) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	n, err := strconv.Atoi(r.URL.Query().Get("max"))
+	if err != nil || n < 1 {
+		http.Error(w, "Invalid max parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := service.SetMaxDownloads(n); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"status": "updated", "max_concurrent_downloads": n}); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
+
+// handleMove changes the place of a queued download.
+// to is "top", "bottom", "up", "down" or a 1-based position.
+func handleMove(w http.ResponseWriter, r *http.Request, service core.DownloadService) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	to := r.URL.Query().Get("to")
+	if id == "" || to == "" {
+		http.Error(w, "Missing id or to parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := service.Move(id, to); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, download.ErrNotQueued) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"status": "moved", "id": id, "to": to}); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
+
+// handlePriority changes the queue priority ("high", "normal" or "low") of a download.
+func handlePriority(w http.ResponseWriter, r *http.Request, service core.DownloadService) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing id parameter", http.StatusBadRequest)
+		return
+	}
+	priority, err := types.ParsePriority(r.URL.Query().Get("priority"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := service.SetPriority(id, priority); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"status": "updated", "id": id, "priority": priority.String()}); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
+
 // DownloadRequest represents a download request from the browser extension
 type DownloadRequest struct {
-	URL                  string            `json:"url"`
-	Filename             string            `json:"filename,omitempty"`
-	Path                 string            `json:"path,omitempty"`
-	RelativeToDefaultDir bool              `json:"relative_to_default_dir,omitempty"`
-	Mirrors              []string          `json:"mirrors,omitempty"`
-	SkipApproval         bool              `json:"skip_approval,omitempty"` // Extension validated request, skip TUI prompt
-	Headers              map[string]string `json:"headers,omitempty"`       // Custom HTTP headers from browser (cookies, auth, etc.)
+	URL                  string               `json:"url"`
+	Filename             string               `json:"filename,omitempty"`
+	Path                 string               `json:"path,omitempty"`
+	RelativeToDefaultDir bool                 `json:"relative_to_default_dir,omitempty"`
+	Mirrors              []string             `json:"mirrors,omitempty"`
+	SkipApproval         bool                 `json:"skip_approval,omitempty"`   // Extension validated request, skip TUI prompt
+	Headers              map[string]string    `json:"headers,omitempty"`         // Custom HTTP headers from browser (cookies, auth, etc.)
+	RateLimit            int64                `json:"rate_limit,omitempty"`      // Per-download bandwidth limit in bytes/sec (0 = settings default)
+	Checksum             string               `json:"checksum,omitempty"`        // Expected digest of the finished file, e.g. "sha256:abcd..."
+	Pieces               string               `json:"pieces,omitempty"`          // Piece hash manifest ("<algo> <piece length>" then one digest per line)
+	BatchID              string               `json:"batch_id,omitempty"`        // Adds the download to a batch paused and resumed together
+	BatchName            string               `json:"batch_name,omitempty"`      // Name of the batch when it is new
+	Category             string               `json:"category,omitempty"`        // Category to file the download under instead of matching one
+	ConflictPolicy       string               `json:"conflict_policy,omitempty"` // What to do if the file exists, instead of the configured policy
+	Hooks                *config.HookSettings `json:"hooks,omitempty"`           // Replace the configured completion and error hooks
+	UserAgent            string               `json:"user_agent,omitempty"`      // User-Agent header, instead of the configured one
+	Referer              string               `json:"referer,omitempty"`         // Referer header
+	Cookie               string               `json:"cookie,omitempty"`          // Cookie header, e.g. "session=abc; lang=en"
+	Proxy                string               `json:"proxy,omitempty"`           // Proxy for this download, instead of the configured one
+}
+
+// requestHeaders returns the headers to send, with the user agent, referer
+// and cookie fields replacing any header of the same name
+func (r DownloadRequest) requestHeaders() map[string]string {
+	if r.UserAgent == "" && r.Referer == "" && r.Cookie == "" {
+		return r.Headers
+	}
+	headers := make(map[string]string, len(r.Headers)+3)
+	for name, value := range r.Headers {
+		headers[name] = value
+	}
+	for _, f := range [][2]string{{"User-Agent", r.UserAgent}, {"Referer", r.Referer}, {"Cookie", r.Cookie}} {
+		if f[1] == "" {
+			continue
+		}
+		for name := range headers {
+			if strings.EqualFold(name, f[0]) {
+				delete(headers, name)
+			}
+		}
+		headers[f[0]] = f[1]
+	}
+	return headers
+}
+
+// isLoopbackRequest reports whether r came from this machine
+func isLoopbackRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return isLoopbackHost(host)
 }
 
 func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir string, service core.DownloadService) {
@@ -774,6 +1088,76 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 		http.Error(w, "Invalid filename", http.StatusBadRequest)
 		return
 	}
+	if req.RateLimit < 0 {
+		http.Error(w, "Invalid rate_limit", http.StatusBadRequest)
+		return
+	}
+	expectedChecksum, err := checksum.Normalize(req.Checksum)
+	if err != nil {
+		http.Error(w, "Invalid checksum: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Checksum = expectedChecksum
+	var opts *types.AddOptions
+	if req.Pieces != "" {
+		pieces, err := checksum.ParsePieces([]byte(req.Pieces))
+		if err != nil {
+			http.Error(w, "Invalid pieces: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts = &types.AddOptions{Pieces: pieces}
+	}
+	if req.BatchID != "" {
+		if opts == nil {
+			opts = &types.AddOptions{}
+		}
+		opts.BatchID = req.BatchID
+		opts.BatchName = req.BatchName
+	}
+	if req.Hooks != nil {
+		// Commands run as this user, so they are only taken from this machine
+		// unless the settings say otherwise
+		if req.Hooks.HasCommands() && !settings.Hooks.AllowRemoteCommands && !isLoopbackRequest(r) {
+			http.Error(w, "Hook commands are only accepted from this machine; set hooks.allow_remote_commands to accept them over the network", http.StatusForbidden)
+			return
+		}
+		req.Hooks.AllowRemoteCommands = false // Only the settings can allow them
+		if opts == nil {
+			opts = &types.AddOptions{}
+		}
+		opts.Hooks = req.Hooks
+	}
+	if req.Category != "" {
+		if config.FindCategory(settings.Categories, req.Category) == nil {
+			http.Error(w, "Unknown category: "+req.Category, http.StatusBadRequest)
+			return
+		}
+		if opts == nil {
+			opts = &types.AddOptions{}
+		}
+		opts.Category = req.Category
+	}
+	if req.ConflictPolicy != "" {
+		if !config.ValidConflictPolicy(req.ConflictPolicy) {
+			http.Error(w, "Unknown conflict policy: "+req.ConflictPolicy, http.StatusBadRequest)
+			return
+		}
+		if opts == nil {
+			opts = &types.AddOptions{}
+		}
+		opts.Conflict = req.ConflictPolicy
+	}
+	if req.Proxy != "" {
+		if err := types.ValidateProxyURL(req.Proxy); err != nil {
+			http.Error(w, "Invalid proxy: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if opts == nil {
+			opts = &types.AddOptions{}
+		}
+		opts.Proxy = req.Proxy
+	}
+	req.Headers = req.requestHeaders()
 
 	utils.Debug("Received download request: URL=%s, Path=%s", req.URL, req.Path)
 
@@ -875,6 +1259,8 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 					Path:     outPath, // Use the path we resolved (default or requested)
 					Mirrors:  mirrorsForAdd,
 					Headers:  req.Headers,
+					Checksum: req.Checksum,
+					Options:  opts,
 				}); err != nil {
 					http.Error(w, "Failed to notify TUI: "+err.Error(), http.StatusInternalServerError)
 					return
@@ -909,12 +1295,18 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 	}
 
 	// Add via service
-	newID, err := service.Add(urlForAdd, outPath, req.Filename, mirrorsForAdd, req.Headers)
+	newID, err := service.Add(urlForAdd, outPath, req.Filename, mirrorsForAdd, req.Headers, req.Checksum, opts)
 	if err != nil {
 		http.Error(w, "Failed to add download: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if req.RateLimit > 0 {
+		if err := service.SetRateLimit(newID, req.RateLimit); err != nil {
+			utils.Debug("Failed to apply rate limit to %s: %v", newID, err)
+		}
+	}
+
 	// Increment active downloads counter
 	atomic.AddInt32(&activeDownloads, 1)
 
@@ -928,9 +1320,10 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 	}
 }
 
-// processDownloads handles the logic of adding downloads either to local pool or remote server
+// processDownloads handles the logic of adding downloads either to local pool or remote server.
+// Every download is sent with the headers and proxy of request.
 // Returns the number of successfully added downloads
-func processDownloads(urls []string, outputDir string, port int) int {
+func processDownloads(urls []string, outputDir string, port int, request DownloadRequest) int {
 	successCount := 0
 
 	// If port > 0, we are sending to a remote server
@@ -942,7 +1335,9 @@ func processDownloads(urls []string, outputDir string, port int) int {
 			if url == "" {
 				continue
 			}
-			err := sendToServer(url, mirrors, outputDir, baseURL, token)
+			req := request
+			req.URL, req.Mirrors, req.Path = url, mirrors, outputDir
+			err := sendToServer(req, baseURL, token)
 			if err != nil {
 				fmt.Printf("Error adding %s: %v\n", url, err)
 			} else {
@@ -962,6 +1357,11 @@ func processDownloads(urls []string, outputDir string, port int) int {
 	if err != nil {
 		settings = config.DefaultSettings()
 	}
+	headers := request.requestHeaders()
+	var opts *types.AddOptions
+	if request.Proxy != "" {
+		opts = &types.AddOptions{Proxy: request.Proxy}
+	}
 
 	for _, arg := range urls {
 		// Validation
@@ -994,7 +1394,7 @@ func processDownloads(urls []string, outputDir string, port int) int {
 		// But processDownloads is called from QUEUE init routine, primarily for CLI args.
 		// If CLI args provided, user probably wants them added immediately.
 
-		_, err := GlobalService.Add(url, outPath, "", mirrors, nil)
+		_, err := GlobalService.Add(url, outPath, "", mirrors, headers, "", opts)
 		if err != nil {
 			fmt.Printf("Error adding %s: %v\n", url, err)
 			continue
@@ -1021,6 +1421,7 @@ func init() {
 	rootCmd.Flags().StringP("output", "o", "", "Default output directory")
 	rootCmd.Flags().Bool("no-resume", false, "Do not auto-resume paused downloads on startup")
 	rootCmd.Flags().Bool("exit-when-done", false, "Exit when all downloads complete")
+	addRequestFlags(rootCmd.Flags())
 	rootCmd.SetVersionTemplate("Surge v{{.Version}}\n")
 }
 
@@ -218,6 +218,7 @@ func startServerLogic(cmd *cobra.Command, args []string, portFlag int, batchFile
 
 	// Initialize Service
 	GlobalService = core.NewLocalDownloadServiceWithInput(GlobalPool, GlobalProgressCh)
+	startGlobalScheduler()
 
 	saveActivePort(port)
 	defer removeActivePort()
@@ -239,7 +240,7 @@ func startServerLogic(cmd *cobra.Command, args []string, portFlag int, batchFile
 		}
 
 		if len(urls) > 0 {
-			processDownloads(urls, outputDir, 0)
+			processDownloads(urls, outputDir, 0, DownloadRequest{})
 		}
 	}()
 
@@ -262,7 +263,8 @@ func startServerLogic(cmd *cobra.Command, args []string, portFlag int, batchFile
 			ticker := time.NewTicker(2 * time.Second)
 			defer ticker.Stop()
 			for range ticker.C {
-				if atomic.LoadInt32(&activeDownloads) == 0 {
+				// A metalink added once can finish as several downloads
+				if atomic.LoadInt32(&activeDownloads) <= 0 {
 					if GlobalPool != nil && GlobalPool.ActiveCount() == 0 {
 						select {
 						case exitWhenDoneCh <- struct{}{}:
@@ -14,6 +14,10 @@ var (
 )
 
 func defaultGlobalShutdown() error {
+	// Stop the schedule first so it can't resume downloads mid-shutdown
+	if GlobalScheduler != nil {
+		GlobalScheduler.Stop()
+	}
 	if GlobalService != nil {
 		return GlobalService.Shutdown()
 	}
@@ -13,7 +13,9 @@ import (
 	"strings"
 
 	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/metalink"
 	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/torrent"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
 )
@@ -82,6 +84,10 @@ func readURLsFromFile(filepath string) ([]string, error) {
 // ParseURLArg parses a command line argument that might contain comma-separated mirrors
 // Returns the primary URL and a list of all mirrors (including the primary)
 func ParseURLArg(arg string) (string, []string) {
+	// Magnet links have no mirrors, and their display names may hold commas
+	if trimmed := strings.TrimSpace(arg); torrent.IsMagnet(trimmed) {
+		return trimmed, []string{trimmed}
+	}
 	parts := strings.Split(arg, ",")
 	var urls []string
 	for _, p := range parts {
@@ -92,6 +98,11 @@ func ParseURLArg(arg string) (string, []string) {
 	if len(urls) == 0 {
 		return "", nil
 	}
+	// A local metalink or .torrent file is read when the download starts, maybe from another directory
+	isLocal := !strings.Contains(urls[0], "://")
+	if isLocal && (metalink.IsMetalink(urls[0], "") || torrent.IsTorrent(urls[0], "")) {
+		urls[0] = utils.EnsureAbsPath(urls[0])
+	}
 	return urls[0], urls
 }
 
@@ -154,12 +165,7 @@ func doAPIRequest(method string, baseURL string, token string, path string, body
 	return client.Do(req)
 }
 
-func sendToServer(url string, mirrors []string, outPath string, baseURL string, token string) error {
-	reqBody := DownloadRequest{
-		URL:     url,
-		Mirrors: mirrors,
-		Path:    outPath,
-	}
+func sendToServer(reqBody DownloadRequest, baseURL string, token string) error {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
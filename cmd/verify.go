@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify <ID>",
+	Short: "Re-hash a finished or paused download and repair bad pieces",
+	Long: `Hash the file of a finished or paused download against its piece hashes.
+Bad pieces of a finished file are downloaded again, bad pieces of a paused
+download are fetched when it resumes. Downloads without piece hashes are
+checked against their checksum.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		baseURL, token, err := resolveAPIConnection(true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		id, err := resolveDownloadID(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		path := fmt.Sprintf("/verify?id=%s", url.QueryEscape(id))
+		resp, err := doAPIRequest(http.MethodPost, baseURL, token, path, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				utils.Debug("Error closing response body: %v", err)
+			}
+		}()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			fmt.Fprintf(os.Stderr, "Error: %s\n", strings.TrimSpace(string(body)))
+			os.Exit(1)
+		}
+
+		var result types.VerifyResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid response: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(formatVerifyResult(&result))
+		if result.Status == checksum.StatusMismatch {
+			os.Exit(1)
+		}
+	},
+}
+
+// formatVerifyResult describes the outcome of a verify in one line
+func formatVerifyResult(r *types.VerifyResult) string {
+	short := r.ID
+	if len(short) > 8 {
+		short = short[:8]
+	}
+
+	if r.Pieces == 0 {
+		if r.Status == checksum.StatusVerified {
+			return fmt.Sprintf("Download %s matches its checksum", short)
+		}
+		return fmt.Sprintf("Download %s doesn't match its checksum", short)
+	}
+	switch r.Status {
+	case checksum.StatusVerified:
+		return fmt.Sprintf("Download %s: all %d pieces verified", short, r.Pieces)
+	case checksum.StatusRepaired:
+		return fmt.Sprintf("Download %s: repaired %d of %d pieces", short, r.Repaired, r.Pieces)
+	case checksum.StatusRequeued:
+		return fmt.Sprintf("Download %s: %d of %d pieces are bad and will be fetched again on resume", short, r.Failed, r.Pieces)
+	default:
+		return fmt.Sprintf("Download %s: %d of %d pieces are bad, %d could be repaired", short, r.Failed, r.Pieces, r.Repaired)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
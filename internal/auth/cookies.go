@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cookie is one line of a Netscape cookies.txt file
+type Cookie struct {
+	Domain            string
+	IncludeSubdomains bool
+	Path              string
+	Secure            bool
+	Expires           time.Time // Zero for session cookies
+	Name              string
+	Value             string
+}
+
+// ParseCookies reads a cookies.txt file as written by browsers' export
+// extensions, curl and yt-dlp: tab separated domain, subdomain flag, path,
+// secure flag, expiry, name and value. Lines starting with # are comments,
+// except for the #HttpOnly_ prefix curl puts before the domain.
+func ParseCookies(r io.Reader) ([]Cookie, error) {
+	var cookies []Cookie
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) == 6 {
+			fields = append(fields, "") // Cookie without a value
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("cookies line %d: expected 7 tab separated fields, got %d", n, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cookies line %d: invalid expiry %q", n, fields[4])
+		}
+
+		c := Cookie{
+			Domain:            strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			IncludeSubdomains: strings.EqualFold(fields[1], "TRUE"),
+			Path:              fields[2],
+			Secure:            strings.EqualFold(fields[3], "TRUE"),
+			Name:              fields[5],
+			Value:             fields[6],
+		}
+		if expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies, scanner.Err()
+}
+
+// Matches reports whether the cookie is sent with a request for u at now
+func (c Cookie) Matches(u *url.URL, now time.Time) bool {
+	if !c.Expires.IsZero() && c.Expires.Before(now) {
+		return false
+	}
+	if c.Secure && u.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if host != c.Domain && !(c.IncludeSubdomains && strings.HasSuffix(host, "."+c.Domain)) {
+		return false
+	}
+	return pathMatches(c.Path, u.EscapedPath())
+}
+
+// pathMatches implements the path matching of RFC 6265, section 5.1.4
+func pathMatches(cookiePath, reqPath string) bool {
+	if cookiePath == "" || cookiePath == "/" {
+		return true
+	}
+	if reqPath == "" {
+		reqPath = "/"
+	}
+	if !strings.HasPrefix(reqPath, cookiePath) {
+		return false
+	}
+	return len(reqPath) == len(cookiePath) || strings.HasSuffix(cookiePath, "/") || reqPath[len(cookiePath)] == '/'
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const cookiesTxt = "# Netscape HTTP Cookie File\n" +
+	"# This is a generated file! Do not edit.\n" +
+	"\n" +
+	".example.com\tTRUE\t/\tFALSE\t0\tsession\tabc123\n" +
+	"#HttpOnly_files.example.com\tFALSE\t/private\tTRUE\t4102444800\ttoken\txyz\r\n" +
+	"old.example.com\tFALSE\t/\tFALSE\t1\texpired\tgone\n" +
+	"example.org\tFALSE\t/\tFALSE\t0\tempty\n"
+
+func TestParseCookies(t *testing.T) {
+	cookies, err := ParseCookies(strings.NewReader(cookiesTxt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 4 {
+		t.Fatalf("got %d cookies, want 4: %+v", len(cookies), cookies)
+	}
+	c := cookies[0]
+	if c.Domain != "example.com" || !c.IncludeSubdomains || c.Name != "session" || c.Value != "abc123" || !c.Expires.IsZero() {
+		t.Errorf("session cookie = %+v", c)
+	}
+	c = cookies[1]
+	if c.Domain != "files.example.com" || c.IncludeSubdomains || !c.Secure || c.Path != "/private" || c.Value != "xyz" || c.Expires.Year() != 2100 {
+		t.Errorf("HttpOnly cookie = %+v", c)
+	}
+	if cookies[3].Name != "empty" || cookies[3].Value != "" {
+		t.Errorf("cookie without a value = %+v", cookies[3])
+	}
+
+	if _, err := ParseCookies(strings.NewReader("example.com TRUE / FALSE 0 a b\n")); err == nil {
+		t.Error("expected an error for a line that isn't tab separated")
+	}
+}
+
+func TestCookie_Matches(t *testing.T) {
+	cookies, err := ParseCookies(strings.NewReader(cookiesTxt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, token, expired := cookies[0], cookies[1], cookies[2]
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		cookie Cookie
+		url    string
+		want   bool
+	}{
+		{"domain", session, "http://example.com/a", true},
+		{"subdomain", session, "https://dl.example.com/a", true},
+		{"other domain", session, "https://notexample.com/a", false},
+		{"path", token, "https://files.example.com/private/a.zip", true},
+		{"path itself", token, "https://files.example.com/private", true},
+		{"path prefix only", token, "https://files.example.com/privateer", false},
+		{"secure over http", token, "http://files.example.com/private/a.zip", false},
+		{"no subdomains", token, "https://a.files.example.com/private/a.zip", false},
+		{"expired", expired, "http://old.example.com/", false},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := tt.cookie.Matches(u, now); got != tt.want {
+			t.Errorf("%s: Matches(%s) = %v, want %v", tt.name, tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package auth adds stored credentials to download requests: logins, tokens
+// and headers from Surge's encrypted credential store, cookies from a
+// Netscape cookies.txt file, and logins from a .netrc file.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keyring holds every credential known to Surge
+type Keyring struct {
+	Credentials []Credential
+	Cookies     []Cookie
+	Netrc       []NetrcEntry
+}
+
+// Apply adds what the keyring has for req's host. Headers the request already
+// carries, e.g. ones the browser extension forwarded, are left alone, and so
+// is a login given in the URL itself. A stored credential takes precedence
+// over .netrc.
+func (k *Keyring) Apply(req *http.Request) {
+	if k == nil || req.URL == nil {
+		return
+	}
+	u := req.URL
+	hasAuth := req.Header.Get("Authorization") != "" || u.User != nil
+
+	if c, ok := k.credentialFor(u); ok {
+		for name, value := range c.Headers {
+			if req.Header.Get(name) == "" {
+				req.Header.Set(name, value)
+			}
+		}
+		if !hasAuth {
+			switch {
+			case c.Token != "":
+				req.Header.Set("Authorization", "Bearer "+c.Token)
+				hasAuth = true
+			case c.Username != "":
+				req.SetBasicAuth(c.Username, c.Password)
+				hasAuth = true
+			}
+		}
+	}
+	if !hasAuth {
+		if e, ok := lookupNetrc(k.Netrc, u.Hostname()); ok && e.Login != "" {
+			req.SetBasicAuth(e.Login, e.Password)
+		}
+	}
+
+	if len(k.Cookies) > 0 {
+		sent := make(map[string]bool)
+		for _, c := range req.Cookies() {
+			sent[c.Name] = true
+		}
+		now := time.Now()
+		for _, c := range k.Cookies {
+			if !sent[c.Name] && c.Matches(u, now) {
+				req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+				sent[c.Name] = true
+			}
+		}
+	}
+}
+
+// credentialFor finds the credential for u: one for its host and port, then
+// one for its host name, then the most specific wildcard
+func (k *Keyring) credentialFor(u *url.URL) (Credential, bool) {
+	host := strings.ToLower(u.Host)
+	name := strings.ToLower(u.Hostname())
+	var best Credential
+	bestLen := -1
+	for _, c := range k.Credentials {
+		switch {
+		case c.Host == host:
+			return c, true
+		case c.Host == name:
+			best, bestLen = c, len(name)+1 // Longer than any wildcard matching name
+		case strings.HasPrefix(c.Host, "*.") && strings.HasSuffix(name, c.Host[1:]) && len(c.Host) > bestLen:
+			best, bestLen = c, len(c.Host)
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// Files says where a keyring is loaded from. Empty cookie and .netrc paths
+// are skipped.
+type Files struct {
+	Store   Store
+	Cookies string
+	Netrc   string
+}
+
+// Load reads a keyring from files. A file that can't be read doesn't keep
+// the others from being used: the keyring holds what could be read, and the
+// error says what couldn't.
+func Load(files Files) (*Keyring, error) {
+	ring := &Keyring{}
+	var errs []error
+
+	creds, err := files.Store.Load()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	ring.Credentials = creds
+
+	if files.Cookies != "" {
+		f, err := os.Open(ExpandHome(files.Cookies))
+		if err == nil {
+			ring.Cookies, err = ParseCookies(f)
+			_ = f.Close()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cookies file: %w", err))
+		}
+	}
+	if files.Netrc != "" {
+		f, err := os.Open(ExpandHome(files.Netrc))
+		if err == nil {
+			ring.Netrc, err = ParseNetrc(f)
+			_ = f.Close()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("netrc file: %w", err))
+		}
+	}
+	return ring, errors.Join(errs...)
+}
+
+// Cache keeps a loaded keyring until one of its files changes, so that
+// credentials added with `surge auth` apply to the next download without a
+// restart
+type Cache struct {
+	mu    sync.Mutex
+	files Files
+	stamp string
+	ring  *Keyring
+	err   error
+}
+
+// Get returns the keyring for files, loading it again if they changed
+func (c *Cache) Get(files Files) (*Keyring, error) {
+	stamp := fileStamp(files.Store.Path, files.Store.KeyPath, ExpandHome(files.Cookies), ExpandHome(files.Netrc))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ring == nil || c.files != files || c.stamp != stamp {
+		c.ring, c.err = Load(files)
+		c.files, c.stamp = files, stamp
+	}
+	return c.ring, c.err
+}
+
+func fileStamp(paths ...string) string {
+	var b strings.Builder
+	for _, path := range paths {
+		if info, err := os.Stat(path); path != "" && err == nil {
+			fmt.Fprintf(&b, "%d/%d;", info.ModTime().UnixNano(), info.Size())
+		} else {
+			b.WriteString("-;")
+		}
+	}
+	return b.String()
+}
+
+// ExpandHome replaces a leading ~ with the user's home directory
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyring_Apply(t *testing.T) {
+	cookies, err := ParseCookies(strings.NewReader(cookiesTxt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := &Keyring{
+		Credentials: []Credential{
+			{Host: "*.example.com", Token: "wild"},
+			{Host: "*.dl.example.com", Token: "wilder"},
+			{Host: "files.example.com", Username: "alice", Password: "s3cret"},
+			{Host: "files.example.com:8443", Headers: map[string]string{"X-Api-Key": "k"}},
+		},
+		Cookies: cookies,
+		Netrc:   []NetrcEntry{{Machine: "mirror.example.org", Login: "bob", Password: "pw"}},
+	}
+
+	apply := func(rawurl string, header http.Header) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, rawurl, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		ring.Apply(req)
+		return req
+	}
+
+	req := apply("https://files.example.com/private/a.zip", nil)
+	if user, pass, ok := req.BasicAuth(); !ok || user != "alice" || pass != "s3cret" {
+		t.Errorf("files.example.com: basic auth %q %q %v", user, pass, ok)
+	}
+	if got := req.Header.Get("Cookie"); got != "session=abc123; token=xyz" {
+		t.Errorf("files.example.com: Cookie = %q", got)
+	}
+
+	req = apply("https://files.example.com:8443/a.zip", nil)
+	if req.Header.Get("X-Api-Key") != "k" || req.Header.Get("Authorization") != "" {
+		t.Errorf("host and port: headers %v", req.Header)
+	}
+
+	if got := apply("https://a.dl.example.com/", nil).Header.Get("Authorization"); got != "Bearer wilder" {
+		t.Errorf("most specific wildcard: Authorization = %q", got)
+	}
+	if got := apply("https://example.com/", nil).Header.Get("Authorization"); got != "" {
+		t.Errorf("wildcard applied to the domain itself: Authorization = %q", got)
+	}
+
+	if user, _, ok := apply("http://mirror.example.org/a", nil).BasicAuth(); !ok || user != "bob" {
+		t.Errorf(".netrc login not used: %q %v", user, ok)
+	}
+
+	// What the browser sent wins
+	req = apply("https://files.example.com/private/a.zip", http.Header{
+		"Authorization": {"Bearer browser"},
+		"Cookie":        {"session=browser"},
+	})
+	if req.Header.Get("Authorization") != "Bearer browser" {
+		t.Errorf("Authorization replaced: %q", req.Header.Get("Authorization"))
+	}
+	if got := req.Header.Get("Cookie"); got != "session=browser; token=xyz" {
+		t.Errorf("Cookie = %q", got)
+	}
+
+	// So does a login in the URL
+	if user, _, _ := apply("https://carol:pw@files.example.com/a", nil).BasicAuth(); user != "" {
+		t.Errorf("URL login replaced by %q", user)
+	}
+}
+
+func TestCache_ReloadsChangedFiles(t *testing.T) {
+	s := testStore(t)
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(netrc, []byte("machine a.example.com login a password a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	files := Files{Store: s, Netrc: netrc, Cookies: filepath.Join(t.TempDir(), "missing.txt")}
+
+	var cache Cache
+	ring, err := cache.Get(files)
+	if err == nil {
+		t.Error("expected an error for the missing cookies file")
+	}
+	if ring == nil || len(ring.Netrc) != 1 || len(ring.Credentials) != 0 {
+		t.Fatalf("ring = %+v", ring)
+	}
+	if again, _ := cache.Get(files); again != ring {
+		t.Error("unchanged files were loaded again")
+	}
+
+	if err := s.Add(Credential{Host: "b.example.com", Token: "t"}); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the change is seen on file systems with coarse timestamps
+	later := time.Now().Add(time.Second)
+	_ = os.Chtimes(s.Path, later, later)
+
+	ring, _ = cache.Get(files)
+	if len(ring.Credentials) != 1 || len(ring.Netrc) != 1 {
+		t.Errorf("ring after adding a credential = %+v", ring)
+	}
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// NetrcEntry is a machine's login from a .netrc file
+type NetrcEntry struct {
+	Machine  string // Empty for the default entry
+	Login    string
+	Password string
+}
+
+// ParseNetrc reads a .netrc file. Tokens are separated by any whitespace, so
+// an entry can span lines or share one with others. macdef bodies, which run
+// until the next empty line, are skipped.
+func ParseNetrc(r io.Reader) ([]NetrcEntry, error) {
+	var entries []NetrcEntry
+	var current *NetrcEntry
+
+	scanner := bufio.NewScanner(r)
+	inMacro := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		tokens := strings.Fields(line)
+		for i := 0; i < len(tokens); i++ {
+			value := func() string {
+				if i+1 < len(tokens) {
+					i++
+					return unquote(tokens[i])
+				}
+				return ""
+			}
+			switch tokens[i] {
+			case "machine":
+				entries = append(entries, NetrcEntry{Machine: strings.ToLower(value())})
+				current = &entries[len(entries)-1]
+			case "default":
+				entries = append(entries, NetrcEntry{})
+				current = &entries[len(entries)-1]
+			case "login":
+				if login := value(); current != nil {
+					current.Login = login
+				}
+			case "password":
+				if password := value(); current != nil {
+					current.Password = password
+				}
+			case "account":
+				value()
+			case "macdef":
+				inMacro = true
+				i = len(tokens)
+			}
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// unquote strips the double quotes curl allows around values
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// lookupNetrc returns the entry for host. The default entry is never used:
+// it would send the same login to every server.
+func lookupNetrc(entries []NetrcEntry, host string) (NetrcEntry, bool) {
+	host = strings.ToLower(host)
+	for _, e := range entries {
+		if e.Machine != "" && e.Machine == host {
+			return e, true
+		}
+	}
+	return NetrcEntry{}, false
+}
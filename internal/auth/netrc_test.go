@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	netrc := `# comment
+machine files.example.com login alice password s3cret
+machine Mirror.Example.org
+	login bob
+	account ignored
+	password "hunter2"
+
+macdef init
+cd /pub
+login mallory password evil
+
+default login anonymous password guest
+`
+	entries, err := ParseNetrc(strings.NewReader(netrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3: %+v", len(entries), entries)
+	}
+
+	if e, ok := lookupNetrc(entries, "files.example.com"); !ok || e.Login != "alice" || e.Password != "s3cret" {
+		t.Errorf("files.example.com = %+v, %v", e, ok)
+	}
+	if e, ok := lookupNetrc(entries, "mirror.example.org"); !ok || e.Login != "bob" || e.Password != "hunter2" {
+		t.Errorf("mirror.example.org = %+v, %v", e, ok)
+	}
+	if e, ok := lookupNetrc(entries, "other.example.com"); ok {
+		t.Errorf("default entry used for another host: %+v", e)
+	}
+}
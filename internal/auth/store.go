@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/config"
+)
+
+// storeMagic starts every credential store, followed by the nonce and the
+// AES-256-GCM sealed JSON list of credentials
+var storeMagic = []byte("SURGECRED1")
+
+const keySize = 32
+
+// KeyFileName is the name of the key file in the state directory
+const KeyFileName = "credentials.key"
+
+// Credential is what is sent to one host: a login, a bearer token, extra
+// headers, or a login or token together with headers
+type Credential struct {
+	// Host is a host name, "host:port", or "*.example.com" for every
+	// subdomain of example.com
+	Host     string            `json:"host"`
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	Token    string            `json:"token,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+// Kind describes the credential for listings: "basic", "bearer" and/or
+// "headers"
+func (c Credential) Kind() string {
+	var kinds []string
+	switch {
+	case c.Token != "":
+		kinds = append(kinds, "bearer")
+	case c.Username != "":
+		kinds = append(kinds, "basic")
+	}
+	if len(c.Headers) > 0 {
+		kinds = append(kinds, "headers")
+	}
+	return strings.Join(kinds, "+")
+}
+
+// Validate checks that the credential names a host and has something to send
+func (c Credential) Validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("credential needs a host")
+	}
+	if c.Username != "" && c.Token != "" {
+		return fmt.Errorf("credential for %s has both a login and a token", c.Host)
+	}
+	if c.Username == "" && c.Token == "" && len(c.Headers) == 0 {
+		return fmt.Errorf("credential for %s needs a login, a token or headers", c.Host)
+	}
+	return nil
+}
+
+// NormalizeHost turns what a user typed for a host, possibly a whole URL,
+// into the form credentials are stored under
+func NormalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err == nil {
+			host = u.Host
+		}
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "/"))
+}
+
+// Store is the encrypted file credentials are kept in. The key is a random
+// one kept in a separate file that only the user can read; it protects the
+// credentials in backups and synced config directories, not from someone
+// who can read both files.
+type Store struct {
+	Path    string
+	KeyPath string
+}
+
+// DefaultStore keeps the credentials next to settings.json and the key with
+// the rest of Surge's state
+func DefaultStore() Store {
+	return Store{
+		Path:    filepath.Join(config.GetSurgeDir(), "credentials.enc"),
+		KeyPath: filepath.Join(config.GetStateDir(), KeyFileName),
+	}
+}
+
+// Load returns the stored credentials, none if nothing was stored yet
+func (s Store) Load() ([]Credential, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := os.ReadFile(s.KeyPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("key for %s is missing: %s", s.Path, s.KeyPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := open(key, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", s.Path, err)
+	}
+	var creds []Credential
+	if err := json.Unmarshal(plain, &creds); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.Path, err)
+	}
+	return creds, nil
+}
+
+// Save replaces the stored credentials, creating the key on first use
+func (s Store) Save(creds []Credential) error {
+	key, err := s.key()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	data, err := seal(key, plain)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, data)
+}
+
+// Add stores c, replacing a credential stored for the same host
+func (s Store) Add(c Credential) error {
+	c.Host = NormalizeHost(c.Host)
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	creds, err := s.Load()
+	if err != nil {
+		return err
+	}
+	kept := creds[:0]
+	for _, old := range creds {
+		if old.Host != c.Host {
+			kept = append(kept, old)
+		}
+	}
+	kept = append(kept, c)
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Host < kept[j].Host })
+	return s.Save(kept)
+}
+
+// Remove deletes the credential stored for host, reporting whether there was one
+func (s Store) Remove(host string) (bool, error) {
+	host = NormalizeHost(host)
+	creds, err := s.Load()
+	if err != nil {
+		return false, err
+	}
+	kept := creds[:0]
+	for _, c := range creds {
+		if c.Host != host {
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == len(creds) {
+		return false, nil
+	}
+	return true, s.Save(kept)
+}
+
+// Seal encrypts data with the store's key, for other secrets Surge keeps,
+// such as the headers downloads were added with
+func (s Store) Seal(plain []byte) ([]byte, error) {
+	key, err := s.key()
+	if err != nil {
+		return nil, err
+	}
+	return seal(key, plain)
+}
+
+// Open decrypts data encrypted with Seal
+func (s Store) Open(data []byte) ([]byte, error) {
+	key, err := os.ReadFile(s.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+	return open(key, data)
+}
+
+// key reads the store's key, creating it if neither key nor store exist yet.
+// A new key for an existing store would make it unreadable.
+func (s Store) key() ([]byte, error) {
+	key, err := os.ReadFile(s.KeyPath)
+	if err == nil {
+		if len(key) != keySize {
+			return nil, fmt.Errorf("key %s is damaged", s.KeyPath)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if _, err := os.Stat(s.Path); s.Path != "" && err == nil {
+		return nil, fmt.Errorf("key for %s is missing: %s", s.Path, s.KeyPath)
+	}
+
+	key = make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(s.KeyPath, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func seal(key, plain []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(append([]byte{}, storeMagic...), nonce...)
+	return gcm.Seal(out, nonce, plain, storeMagic), nil
+}
+
+func open(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, storeMagic) || len(data) < len(storeMagic)+gcm.NonceSize() {
+		return nil, fmt.Errorf("not a credential store")
+	}
+	data = data[len(storeMagic):]
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], storeMagic)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key has %d bytes, want %d", len(key), keySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeFileAtomic writes a file only the user can read, replacing the old
+// one only once the new one is complete
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
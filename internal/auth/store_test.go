@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testStore(t *testing.T) Store {
+	dir := t.TempDir()
+	return Store{Path: filepath.Join(dir, "config", "credentials.enc"), KeyPath: filepath.Join(dir, "state", "credentials.key")}
+}
+
+func TestStore_AddRemove(t *testing.T) {
+	s := testStore(t)
+	if creds, err := s.Load(); err != nil || creds != nil {
+		t.Fatalf("empty store: %v, %v", creds, err)
+	}
+
+	if err := s.Add(Credential{Host: "https://Files.Example.com/", Username: "alice", Password: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Credential{Host: "api.example.com", Token: "tok", Headers: map[string]string{"X-Api-Key": "k"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Credential{Host: "files.example.com", Token: "replaced"}); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(creds) != 2 || creds[0].Host != "api.example.com" || creds[1].Host != "files.example.com" || creds[1].Token != "replaced" {
+		t.Fatalf("creds = %+v", creds)
+	}
+	if creds[0].Kind() != "bearer+headers" || creds[1].Kind() != "bearer" {
+		t.Errorf("kinds = %s, %s", creds[0].Kind(), creds[1].Kind())
+	}
+
+	if removed, err := s.Remove("FILES.example.com"); err != nil || !removed {
+		t.Fatalf("Remove = %v, %v", removed, err)
+	}
+	if removed, err := s.Remove("files.example.com"); err != nil || removed {
+		t.Fatalf("second Remove = %v, %v", removed, err)
+	}
+	if creds, _ := s.Load(); len(creds) != 1 {
+		t.Errorf("creds after Remove = %+v", creds)
+	}
+}
+
+func TestStore_Encrypted(t *testing.T) {
+	s := testStore(t)
+	if err := s.Add(Credential{Host: "example.com", Username: "alice", Password: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("s3cret")) || bytes.Contains(data, []byte("alice")) {
+		t.Error("store holds the credential in plain text")
+	}
+	for _, path := range []string{s.Path, s.KeyPath} {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+			t.Errorf("%s: mode %v, %v", path, info.Mode().Perm(), err)
+		}
+	}
+
+	// A damaged store or a lost key is reported, not taken for an empty store
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(s.Path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load(); err == nil {
+		t.Error("expected an error for a damaged store")
+	}
+	if err := os.Remove(s.KeyPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Credential{Host: "example.org", Token: "t"}); err == nil {
+		t.Error("expected an error for a store without its key")
+	}
+}
+
+func TestStore_SealOpen(t *testing.T) {
+	s := testStore(t)
+	sealed, err := s.Seal([]byte("Cookie: session=abc"))
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("session")) {
+		t.Error("sealed data holds the plain text")
+	}
+	plain, err := s.Open(sealed)
+	if err != nil || string(plain) != "Cookie: session=abc" {
+		t.Fatalf("Open = %q, %v", plain, err)
+	}
+
+	// Sealing shares the key with the credentials
+	if err := s.Add(Credential{Host: "example.com", Token: "t"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Open(sealed); err != nil {
+		t.Errorf("Open after adding a credential: %v", err)
+	}
+}
+
+func TestCredential_Validate(t *testing.T) {
+	if err := (Credential{Host: "example.com"}).Validate(); err == nil {
+		t.Error("expected an error for a credential without anything to send")
+	}
+	if err := (Credential{Host: "example.com", Username: "a", Token: "t"}).Validate(); err == nil {
+		t.Error("expected an error for a login together with a token")
+	}
+	if err := (Credential{Username: "a"}).Validate(); err == nil {
+		t.Error("expected an error for a credential without a host")
+	}
+}
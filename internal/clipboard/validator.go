@@ -27,6 +27,14 @@ func (v *Validator) ExtractURL(text string) string {
 		return ""
 	}
 
+	// Magnet links name a torrent rather than a host
+	if strings.HasPrefix(strings.ToLower(text), "magnet:?") {
+		if strings.Contains(strings.ToLower(text), "xt=urn:btih:") {
+			return text
+		}
+		return ""
+	}
+
 	// Must start with http:// or https://
 	if !strings.HasPrefix(text, "http://") && !strings.HasPrefix(text, "https://") {
 		return ""
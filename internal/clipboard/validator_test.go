@@ -111,6 +111,17 @@ func TestValidator_ExtractURL(t *testing.T) {
 			expected: "",
 		},
 
+		{
+			name:     "Magnet link",
+			input:    "  magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=linux.iso ",
+			expected: "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=linux.iso",
+		},
+		{
+			name:     "Magnet without info hash",
+			input:    "magnet:?dn=linux.iso",
+			expected: "",
+		},
+
 		// Invalid cases - Schemes
 		{
 			name:     "FTP scheme",
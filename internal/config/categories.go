@@ -0,0 +1,190 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Category groups downloads that share a destination directory, connection
+// settings and hooks. A download is put in a category when it is added, or
+// when the first of the category's rules matches it.
+type Category struct {
+	Name           string         `json:"name"`
+	Dir            string         `json:"dir,omitempty"`             // Replaces the default download directory, "" = keep it
+	MaxConnections int            `json:"max_connections,omitempty"` // Replaces MaxConnectionsPerHost, 0 = keep it
+	RateLimit      int64          `json:"rate_limit,omitempty"`      // bytes/sec for each download, 0 = the configured default
+	PathTemplate   string         `json:"path_template,omitempty"`   // Replaces the configured path template, "" = keep it
+	Hooks          *HookSettings  `json:"hooks,omitempty"`           // Replace the configured hooks where set
+	Rules          []CategoryRule `json:"rules,omitempty"`
+}
+
+// CategoryRule matches a download when every condition it sets holds. A rule
+// that sets none matches nothing.
+//
+// Extensions are compared to the end of the file name without regard to case,
+// so "tar.gz" works as well as "zip". MIME is compared to the Content-Type
+// the server reports, where "video/*" covers every video type. Host matches
+// the URL's host and its subdomains, and Regex is matched against the whole
+// URL.
+type CategoryRule struct {
+	Extensions []string `json:"extensions,omitempty"`
+	MIME       string   `json:"mime,omitempty"`
+	Host       string   `json:"host,omitempty"`
+	Regex      string   `json:"regex,omitempty"`
+}
+
+// DefaultCategories returns the categories new settings start with. They
+// have no directory of their own, so downloads stay where they were going
+// until one is set.
+func DefaultCategories() []Category {
+	return []Category{
+		{
+			Name: "Video",
+			Rules: []CategoryRule{
+				{Extensions: []string{"mp4", "mkv", "webm", "avi", "mov", "m4v", "wmv", "flv", "mpg", "mpeg"}},
+				{MIME: "video/*"},
+			},
+		},
+		{
+			Name: "Archives",
+			Rules: []CategoryRule{
+				{Extensions: []string{"zip", "rar", "7z", "tar", "gz", "tgz", "bz2", "xz", "zst"}},
+				{MIME: "application/zip"},
+				{MIME: "application/vnd.rar"},
+				{MIME: "application/x-7z-compressed"},
+				{MIME: "application/x-tar"},
+				{MIME: "application/gzip"},
+			},
+		},
+		{
+			Name: "ISOs",
+			Rules: []CategoryRule{
+				{Extensions: []string{"iso", "img", "dmg"}},
+				{MIME: "application/x-iso9660-image"},
+			},
+		},
+		{
+			Name: "Docs",
+			Rules: []CategoryRule{
+				{Extensions: []string{"pdf", "epub", "doc", "docx", "odt", "xls", "xlsx", "ods", "ppt", "pptx", "odp", "txt", "md"}},
+				{MIME: "application/pdf"},
+				{MIME: "application/epub+zip"},
+			},
+		},
+	}
+}
+
+// Validate checks that the category is named and its rules can be used.
+func (c Category) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return fmt.Errorf("category without a name")
+	}
+	for _, r := range c.Rules {
+		if r.Regex != "" {
+			if _, err := regexp.Compile(r.Regex); err != nil {
+				return fmt.Errorf("category %s: invalid regex %q: %w", c.Name, r.Regex, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Destination returns the directory a download of the category goes to
+// when dir was asked for: the category's directory if dir is empty or the
+// default download directory, otherwise dir itself.
+func (c *Category) Destination(dir, defaultDir string) string {
+	if c == nil || c.Dir == "" {
+		return dir
+	}
+	if dir == "" || (defaultDir != "" && filepath.Clean(dir) == filepath.Clean(defaultDir)) {
+		return c.Dir
+	}
+	return dir
+}
+
+// FindCategory returns the category with the given name, ignoring case, or
+// nil if there is none.
+func FindCategory(categories []Category, name string) *Category {
+	for i := range categories {
+		if strings.EqualFold(categories[i].Name, name) {
+			return &categories[i]
+		}
+	}
+	return nil
+}
+
+// MatchCategory returns the first category with a rule matching a download,
+// or nil. The file name defaults to the last element of the URL's path, and
+// rules on the content type only match once it is known.
+func MatchCategory(categories []Category, rawURL, filename, contentType string) *Category {
+	var host string
+	if u, err := url.Parse(rawURL); err == nil {
+		host = strings.ToLower(u.Hostname())
+		if filename == "" {
+			filename = path.Base(u.Path)
+		}
+	}
+	filename = strings.ToLower(filename)
+	contentType, _, _ = strings.Cut(strings.ToLower(contentType), ";")
+	contentType = strings.TrimSpace(contentType)
+
+	for i := range categories {
+		for _, r := range categories[i].Rules {
+			if r.matches(rawURL, host, filename, contentType) {
+				return &categories[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (r CategoryRule) matches(rawURL, host, filename, contentType string) bool {
+	if len(r.Extensions) == 0 && r.MIME == "" && r.Host == "" && r.Regex == "" {
+		return false
+	}
+	if len(r.Extensions) > 0 && !hasExtension(filename, r.Extensions) {
+		return false
+	}
+	if r.MIME != "" && !matchMIME(r.MIME, contentType) {
+		return false
+	}
+	if r.Host != "" {
+		want := strings.ToLower(strings.TrimPrefix(r.Host, "."))
+		if host != want && !strings.HasSuffix(host, "."+want) {
+			return false
+		}
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil || !re.MatchString(rawURL) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasExtension(filename string, extensions []string) bool {
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+		if ext != "" && strings.HasSuffix(filename, "."+ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMIME compares a content type to a pattern like "video/mp4" or "video/*"
+func matchMIME(pattern, contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(contentType, prefix+"/")
+	}
+	return pattern == contentType
+}
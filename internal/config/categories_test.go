@@ -0,0 +1,114 @@
+package config
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchCategory(t *testing.T) {
+	categories := []Category{
+		{Name: "Work", Rules: []CategoryRule{
+			{Host: "files.example.com"},
+			{Regex: `/reports/.*\.xlsx$`},
+		}},
+		{Name: "Linux", Rules: []CategoryRule{
+			{Extensions: []string{"iso"}, Host: "releases.ubuntu.com"}, // Both have to match
+		}},
+		{Name: "Empty", Rules: []CategoryRule{{}}},
+	}
+	categories = append(categories, DefaultCategories()...)
+
+	tests := []struct {
+		url, filename, contentType string
+		want                       string
+	}{
+		{"https://cdn.example.org/movie.MKV", "", "", "Video"},
+		{"https://cdn.example.org/stream?id=1", "", "video/mp4; codecs=avc1", "Video"},
+		{"https://cdn.example.org/stream?id=1", "", "", ""},
+		{"https://cdn.example.org/get?id=7", "backup.tar.gz", "", "Archives"},
+		{"https://cdn.example.org/x", "", "application/x-7z-compressed", "Archives"},
+		{"https://releases.ubuntu.com/24.04/ubuntu.iso", "", "", "Linux"},
+		{"https://mirror.example.org/ubuntu.iso", "", "", "ISOs"},
+		{"https://cdn.example.org/paper.pdf", "", "", "Docs"},
+		{"https://eu.files.example.com/movie.mkv", "", "", "Work"}, // Subdomain, and Work comes first
+		{"https://notfiles.example.com/a.bin", "", "", ""},
+		{"https://intranet.local/reports/q3.xlsx", "", "", "Work"},
+		{"https://intranet.local/q3.xlsx", "", "", "Docs"},
+		{"https://cdn.example.org/tool.exe", "", "application/octet-stream", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if c := MatchCategory(categories, tt.url, tt.filename, tt.contentType); c != nil {
+			got = c.Name
+		}
+		if got != tt.want {
+			t.Errorf("MatchCategory(%q, %q, %q) = %q, want %q", tt.url, tt.filename, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestCategory_Destination(t *testing.T) {
+	defaultDir := filepath.Join("home", "me", "Downloads")
+	videos := &Category{Name: "Video", Dir: filepath.Join("home", "me", "Videos")}
+
+	if got := videos.Destination("", defaultDir); got != videos.Dir {
+		t.Errorf("no directory asked for: got %s", got)
+	}
+	if got := videos.Destination(defaultDir+string(filepath.Separator), defaultDir); got != videos.Dir {
+		t.Errorf("default directory: got %s", got)
+	}
+	if got := videos.Destination("elsewhere", defaultDir); got != "elsewhere" {
+		t.Errorf("chosen directory replaced: got %s", got)
+	}
+	if got := (&Category{Name: "Docs"}).Destination(defaultDir, defaultDir); got != defaultDir {
+		t.Errorf("category without a directory: got %s", got)
+	}
+	var none *Category
+	if got := none.Destination(defaultDir, defaultDir); got != defaultDir {
+		t.Errorf("nil category: got %s", got)
+	}
+}
+
+func TestFindCategory(t *testing.T) {
+	categories := DefaultCategories()
+	if c := FindCategory(categories, "video"); c == nil || c.Name != "Video" {
+		t.Errorf("FindCategory(video) = %v", c)
+	}
+	if c := FindCategory(categories, "Music"); c != nil {
+		t.Errorf("FindCategory(Music) = %v, want nil", c)
+	}
+}
+
+func TestCategory_Validate(t *testing.T) {
+	for _, c := range DefaultCategories() {
+		if err := c.Validate(); err != nil {
+			t.Errorf("default category %s: %v", c.Name, err)
+		}
+	}
+	if err := (Category{Name: " "}).Validate(); err == nil {
+		t.Error("expected an error for a category without a name")
+	}
+	if err := (Category{Name: "Bad", Rules: []CategoryRule{{Regex: "("}}}).Validate(); err == nil {
+		t.Error("expected an error for an invalid regex")
+	}
+}
+
+func TestSettings_CategoriesReplaceDefaults(t *testing.T) {
+	s := DefaultSettings()
+	data := `{"categories": [{"name": "Video", "dir": "/videos"}]}`
+	if err := json.Unmarshal([]byte(data), s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Categories) != 1 || s.Categories[0].Dir != "/videos" || len(s.Categories[0].Rules) != 0 {
+		t.Errorf("Categories = %+v, want only the one from the file, without default rules", s.Categories)
+	}
+
+	s = DefaultSettings()
+	if err := json.Unmarshal([]byte(`{"general": {"auto_resume": true}}`), s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Categories) != len(DefaultCategories()) {
+		t.Errorf("defaults lost without a categories key: %+v", s.Categories)
+	}
+}
@@ -0,0 +1,21 @@
+package config
+
+import "slices"
+
+// Conflict policies decide what happens when the file a download would be
+// saved as already exists
+const (
+	ConflictRename    = "rename"    // Save the download as "name(1).ext"
+	ConflictOverwrite = "overwrite" // Replace the file
+	ConflictSkip      = "skip"      // Keep the file and don't download
+	ConflictSameSize  = "same-size" // Keep the file if it has the remote file's size, otherwise rename
+	ConflictCompare   = "compare"   // Keep the file if it matches the checksum or ETag, otherwise replace it
+)
+
+// ConflictPolicies lists the conflict policies in the order they are offered
+var ConflictPolicies = []string{ConflictRename, ConflictOverwrite, ConflictSkip, ConflictSameSize, ConflictCompare}
+
+// ValidConflictPolicy reports whether p names a conflict policy
+func ValidConflictPolicy(p string) bool {
+	return slices.Contains(ConflictPolicies, p)
+}
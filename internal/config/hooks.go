@@ -0,0 +1,51 @@
+package config
+
+import "time"
+
+// DefaultHookTimeout limits a hook when no timeout is configured.
+const DefaultHookTimeout = 30 * time.Second
+
+// HookSettings configures what runs when a download completes or fails.
+// Commands run through the shell with the download described in SURGE_*
+// environment variables; the webhook receives the same fields as JSON.
+type HookSettings struct {
+	OnComplete string        `json:"on_complete,omitempty"` // Command run after a download completes
+	OnError    string        `json:"on_error,omitempty"`    // Command run after a download fails
+	WebhookURL string        `json:"webhook_url,omitempty"` // Receives a POST for both events
+	Timeout    time.Duration `json:"timeout,omitempty"`     // Limit for each command or request, 0 = DefaultHookTimeout
+
+	// AllowRemoteCommands lets downloads added over the network bring their
+	// own commands. Only read from the settings.
+	AllowRemoteCommands bool `json:"allow_remote_commands,omitempty"`
+}
+
+// Empty reports whether no command or webhook is set.
+func (h HookSettings) Empty() bool {
+	return h.OnComplete == "" && h.OnError == "" && h.WebhookURL == ""
+}
+
+// HasCommands reports whether a command is set, as opposed to only a webhook.
+func (h HookSettings) HasCommands() bool {
+	return h.OnComplete != "" || h.OnError != ""
+}
+
+// Override returns h with the fields set in o replacing its own. A nil o
+// leaves h as it is.
+func (h HookSettings) Override(o *HookSettings) HookSettings {
+	if o == nil {
+		return h
+	}
+	if o.OnComplete != "" {
+		h.OnComplete = o.OnComplete
+	}
+	if o.OnError != "" {
+		h.OnError = o.OnError
+	}
+	if o.WebhookURL != "" {
+		h.WebhookURL = o.WebhookURL
+	}
+	if o.Timeout > 0 {
+		h.Timeout = o.Timeout
+	}
+	return h
+}
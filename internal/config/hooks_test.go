@@ -0,0 +1,24 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHookSettings_Override(t *testing.T) {
+	global := HookSettings{OnComplete: "notify", OnError: "alert", Timeout: DefaultHookTimeout}
+
+	if got := global.Override(nil); got != global {
+		t.Errorf("Override(nil) = %+v, want %+v", got, global)
+	}
+
+	got := global.Override(&HookSettings{OnComplete: "unpack", WebhookURL: "https://hooks.example.com", Timeout: time.Minute})
+	want := HookSettings{OnComplete: "unpack", OnError: "alert", WebhookURL: "https://hooks.example.com", Timeout: time.Minute}
+	if got != want {
+		t.Errorf("Override = %+v, want %+v", got, want)
+	}
+
+	if !(HookSettings{Timeout: time.Minute}).Empty() || global.Empty() {
+		t.Error("Empty should only look at commands and the webhook")
+	}
+}
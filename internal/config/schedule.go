@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduleSettings holds the time-of-day bandwidth calendar.
+// Profiles are checked in order and the first one matching the current time wins.
+// When nothing matches, the regular Network settings apply.
+type ScheduleSettings struct {
+	Enabled  bool              `json:"enabled"`
+	Profiles []ScheduleProfile `json:"profiles"`
+}
+
+// ScheduleProfile is a single calendar entry.
+//
+// Days uses cron day-of-week syntax: "*", names ("mon", "sat,sun"), numbers
+// (0 = Sunday), and ranges ("mon-fri", "1-5"). Start and End are "HH:MM" in
+// local time; an empty Start/End covers the whole day and End before Start
+// wraps past midnight.
+type ScheduleProfile struct {
+	Name      string `json:"name"`
+	Days      string `json:"days"`
+	Start     string `json:"start,omitempty"`
+	End       string `json:"end,omitempty"`
+	RateLimit int64  `json:"rate_limit"`      // bytes/sec for all downloads, 0 = unlimited
+	Pause     bool   `json:"pause,omitempty"` // Pause downloads while this profile is active
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Matches reports whether t falls inside the profile's calendar window.
+// Returns an error if Days, Start or End cannot be parsed.
+func (p ScheduleProfile) Matches(t time.Time) (bool, error) {
+	days, err := parseDays(p.Days)
+	if err != nil {
+		return false, err
+	}
+	start, err := parseClock(p.Start, 0)
+	if err != nil {
+		return false, err
+	}
+	end, err := parseClock(p.End, 24*60)
+	if err != nil {
+		return false, err
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+
+	if start < end {
+		return days[day] && minute >= start && minute < end, nil
+	}
+	if start == end {
+		return days[day], nil
+	}
+
+	// Overnight window: the part after midnight belongs to the previous day's entry
+	if minute >= start {
+		return days[day], nil
+	}
+	if minute < end {
+		return days[(day+6)%7], nil
+	}
+	return false, nil
+}
+
+// Validate checks that the profile's calendar fields can be parsed.
+func (p ScheduleProfile) Validate() error {
+	_, err := p.Matches(time.Time{})
+	return err
+}
+
+// parseDays parses a cron day-of-week field into a weekday set.
+func parseDays(spec string) ([7]bool, error) {
+	var days [7]bool
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "" || spec == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		from, err := parseWeekday(lo)
+		if err != nil {
+			return days, err
+		}
+		to := from
+		if isRange {
+			if to, err = parseWeekday(hi); err != nil {
+				return days, err
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.TrimSpace(s)
+	if d, ok := weekdayNames[s]; ok {
+		return d, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 7 {
+		return 0, fmt.Errorf("invalid day %q", s)
+	}
+	// cron allows 7 as an alias for Sunday
+	return time.Weekday(n % 7), nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight. Empty returns def.
+func parseClock(s string, def int) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return def, nil
+	}
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
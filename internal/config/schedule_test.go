@@ -0,0 +1,68 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns a local time on the week of 2024-01-01 (a Monday)
+func at(day time.Weekday, hour, minute int) time.Time {
+	return time.Date(2024, 1, 1+int(day+6)%7, hour, minute, 0, 0, time.Local)
+}
+
+func TestScheduleProfile_Matches(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile ScheduleProfile
+		t       time.Time
+		want    bool
+	}{
+		{"any day whole day", ScheduleProfile{Days: "*"}, at(time.Wednesday, 3, 0), true},
+		{"empty days means every day", ScheduleProfile{}, at(time.Sunday, 23, 59), true},
+		{"weekday range inside", ScheduleProfile{Days: "mon-fri", Start: "09:00", End: "17:00"}, at(time.Tuesday, 12, 0), true},
+		{"weekday range weekend", ScheduleProfile{Days: "mon-fri", Start: "09:00", End: "17:00"}, at(time.Saturday, 12, 0), false},
+		{"end is exclusive", ScheduleProfile{Days: "mon-fri", Start: "09:00", End: "17:00"}, at(time.Tuesday, 17, 0), false},
+		{"start is inclusive", ScheduleProfile{Days: "mon-fri", Start: "09:00", End: "17:00"}, at(time.Tuesday, 9, 0), true},
+		{"day list", ScheduleProfile{Days: "sat,sun"}, at(time.Sunday, 8, 0), true},
+		{"numeric days", ScheduleProfile{Days: "1-5"}, at(time.Friday, 8, 0), true},
+		{"seven is sunday", ScheduleProfile{Days: "7"}, at(time.Sunday, 8, 0), true},
+		{"wrapping range", ScheduleProfile{Days: "fri-mon"}, at(time.Sunday, 8, 0), true},
+		{"wrapping range outside", ScheduleProfile{Days: "fri-mon"}, at(time.Wednesday, 8, 0), false},
+		{"overnight before midnight", ScheduleProfile{Days: "fri", Start: "22:00", End: "06:00"}, at(time.Friday, 23, 0), true},
+		{"overnight after midnight", ScheduleProfile{Days: "fri", Start: "22:00", End: "06:00"}, at(time.Saturday, 5, 0), true},
+		{"overnight belongs to previous day", ScheduleProfile{Days: "fri", Start: "22:00", End: "06:00"}, at(time.Friday, 5, 0), false},
+		{"overnight gap", ScheduleProfile{Days: "*", Start: "22:00", End: "06:00"}, at(time.Monday, 12, 0), false},
+		{"open end", ScheduleProfile{Days: "*", Start: "20:00"}, at(time.Monday, 23, 30), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.profile.Matches(tt.t)
+			if err != nil {
+				t.Fatalf("Matches returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Matches(%s) = %v, want %v", tt.t.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleProfile_Validate(t *testing.T) {
+	invalid := []ScheduleProfile{
+		{Days: "funday"},
+		{Days: "8"},
+		{Days: "mon-"},
+		{Days: "*", Start: "25:00"},
+		{Days: "*", End: "9am"},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", p)
+		}
+	}
+
+	if err := (ScheduleProfile{Days: "Mon-Fri", Start: "08:30", End: "24:00"}).Validate(); err != nil {
+		t.Errorf("Validate should accept valid profile: %v", err)
+	}
+}
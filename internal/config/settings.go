@@ -12,6 +12,10 @@ type Settings struct {
 	General     GeneralSettings     `json:"general"`
 	Network     NetworkSettings     `json:"network"`
 	Performance PerformanceSettings `json:"performance"`
+	Torrent     TorrentSettings     `json:"torrent"`
+	Schedule    ScheduleSettings    `json:"schedule"`
+	Hooks       HookSettings        `json:"hooks"`
+	Categories  []Category          `json:"categories"`
 }
 
 // GeneralSettings contains application behavior settings.
@@ -22,6 +26,12 @@ type GeneralSettings struct {
 	AutoResume         bool   `json:"auto_resume"`
 	SkipUpdateCheck    bool   `json:"skip_update_check"`
 	PreserveURLPath    bool   `json:"preserve_url_path"`
+	PathTemplate       string `json:"path_template"`   // e.g. "{host}/{date}/{filename}", "" = just the file name
+	ConflictPolicy     string `json:"conflict_policy"` // One of ConflictPolicies
+	DiscoverChecksums  bool   `json:"discover_checksums"`
+	StreamVariant      string `json:"stream_variant"` // "highest", "lowest" or a height like "720p"
+	AutoExtract        bool   `json:"auto_extract"`
+	DeleteAfterExtract bool   `json:"delete_after_extract"`
 
 	ClipboardMonitor  bool `json:"clipboard_monitor"`
 	Theme             int  `json:"theme"`
@@ -40,16 +50,32 @@ type NetworkSettings struct {
 	MaxConcurrentDownloads int    `json:"max_concurrent_downloads"`
 	UserAgent              string `json:"user_agent"`
 	ProxyURL               string `json:"proxy_url"`
+	CookiesFile            string `json:"cookies_file"` // Netscape cookies.txt sent along with requests
+	NetrcFile              string `json:"netrc_file"`   // .netrc with logins for hosts
 	SequentialDownload     bool   `json:"sequential_download"`
 	MinChunkSize           int64  `json:"min_chunk_size"`
 	WorkerBufferSize       int    `json:"worker_buffer_size"`
 	SkipTLSVerification    bool   `json:"skip_tls_verification"`
+	GlobalRateLimit        int64  `json:"global_rate_limit"`   // bytes/sec across all downloads, 0 = unlimited
+	DownloadRateLimit      int64  `json:"download_rate_limit"` // default bytes/sec for each new download, 0 = unlimited
+
+	// HostConnectionLimits overrides MaxConnectionsPerHost for specific hosts,
+	// keyed by "host" or "host:port". The limit is shared by all downloads.
+	HostConnectionLimits map[string]int `json:"host_connection_limits,omitempty"`
 }
 
 // UnmarshalJSON implements custom JSON unmarshalling for Settings.
 // This provides backward compatibility with the legacy "connections" + "chunks"
 // migrating them into the new unified "network" field.
 func (s *Settings) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	_ = json.Unmarshal(data, &raw) // Errors are reported by the full parse below
+
+	// Categories in the file replace the defaults instead of merging into them
+	if _, ok := raw["categories"]; ok {
+		s.Categories = nil
+	}
+
 	// Use an alias to avoid infinite recursion (alias has no methods)
 	type Alias Settings
 	if err := json.Unmarshal(data, (*Alias)(s)); err != nil {
@@ -57,10 +83,6 @@ func (s *Settings) UnmarshalJSON(data []byte) error {
 	}
 
 	// Check if the JSON had legacy keys instead of "network"
-	var raw map[string]json.RawMessage
-	if err := json.Unmarshal(data, &raw); err != nil {
-		return nil // Already parsed above, ignore raw parse errors
-	}
 
 	if _, hasNetwork := raw["network"]; !hasNetwork {
 		// Migrate legacy "connections" key (overlays onto Network)
@@ -85,6 +107,15 @@ type PerformanceSettings struct {
 	SpeedEmaAlpha         float64       `json:"speed_ema_alpha"`
 }
 
+// TorrentSettings contains BitTorrent parameters.
+type TorrentSettings struct {
+	EnableDHT  bool          `json:"enable_dht"`
+	ListenPort int           `json:"listen_port"` // 0 = any free port
+	MaxPeers   int           `json:"max_peers"`
+	SeedRatio  float64       `json:"seed_ratio"` // Seed until uploaded/size reaches this, 0 = no ratio limit
+	SeedTime   time.Duration `json:"seed_time"`  // Seed at most this long, 0 = no time limit
+}
+
 // SettingMeta provides metadata for a single setting (for UI rendering).
 type SettingMeta struct {
 	Key         string // JSON key name
@@ -103,6 +134,12 @@ func GetSettingsMetadata() map[string][]SettingMeta {
 			{Key: "auto_resume", Label: "Auto Resume", Description: "Automatically resume paused downloads on startup.", Type: "bool"},
 			{Key: "skip_update_check", Label: "Skip Update Check", Description: "Disable automatic check for new versions on startup.", Type: "bool"},
 			{Key: "preserve_url_path", Label: "Preserve URL Path", Description: "Preserve the URL path structure when saving files (e.g., example.com/a/b/file.zip → download_dir/example.com/a/b/file.zip).", Type: "bool"},
+			{Key: "path_template", Label: "Path Template", Description: "Where to put files below the download directory, e.g. {category}/{date}/{filename}. Variables: {host}, {path}, {filename}, {name}, {ext}, {date}, {date:2006-01}, {category}, {batch}. Overrides Preserve URL Path.", Type: "string"},
+			{Key: "conflict_policy", Label: "Conflict Policy", Description: "What to do when a file of the same name exists: rename (save as name(1).ext), overwrite, skip, same-size (skip if the sizes match, otherwise rename) or compare (skip if the checksum or ETag matches, otherwise overwrite).", Type: "string"},
+			{Key: "discover_checksums", Label: "Discover Checksums", Description: "Look for .sha256 sidecars and SHA256SUMS manifests next to downloads and verify files against them.", Type: "bool"},
+			{Key: "stream_variant", Label: "Stream Variant", Description: "Which variant of HLS/DASH streams to download: highest, lowest, or a maximum height such as 720p.", Type: "string"},
+			{Key: "auto_extract", Label: "Auto Extract", Description: "Unpack finished zip, tar(.gz/.bz2/.zst), rar and 7z archives into a folder next to them. Multi-part archives are unpacked once all parts are done.", Type: "bool"},
+			{Key: "delete_after_extract", Label: "Delete After Extract", Description: "Remove an archive (all its parts) once it was extracted successfully.", Type: "bool"},
 
 			{Key: "clipboard_monitor", Label: "Clipboard Monitor", Description: "Watch clipboard for URLs and prompt to download them.", Type: "bool"},
 			{Key: "theme", Label: "App Theme", Description: "UI Theme (System, Light, Dark).", Type: "int"},
@@ -110,13 +147,17 @@ func GetSettingsMetadata() map[string][]SettingMeta {
 		},
 		"Network": {
 			{Key: "max_connections_per_host", Label: "Max Connections/Host", Description: "Maximum concurrent connections per host (1-64).", Type: "int"},
-			{Key: "max_concurrent_downloads", Label: "Max Concurrent Downloads", Description: "Maximum number of downloads running at once (1-10). Requires restart.", Type: "int"},
+			{Key: "max_concurrent_downloads", Label: "Max Concurrent Downloads", Description: "Maximum number of downloads running at once (1-10).", Type: "int"},
 			{Key: "user_agent", Label: "User Agent", Description: "Custom User-Agent string for HTTP requests. Leave empty for default.", Type: "string"},
 			{Key: "proxy_url", Label: "Proxy URL", Description: "Proxy URL (http://host:port, https://host:port, or socks5://host:port for Tor). Leave empty to use system default.", Type: "string"},
+			{Key: "cookies_file", Label: "Cookies File", Description: "Netscape-format cookies.txt (as exported from a browser) whose cookies are sent to matching sites. Leave empty for none.", Type: "string"},
+			{Key: "netrc_file", Label: "Netrc File", Description: ".netrc file with logins for hosts, e.g. ~/.netrc. Leave empty for none.", Type: "string"},
 			{Key: "sequential_download", Label: "Sequential Download", Description: "Download pieces in order (Streaming Mode). May be slower.", Type: "bool"},
 			{Key: "min_chunk_size", Label: "Min Chunk Size", Description: "Minimum download chunk size in MB (e.g., 2).", Type: "int64"},
 			{Key: "worker_buffer_size", Label: "Worker Buffer Size", Description: "I/O buffer size per worker in KB (e.g., 512).", Type: "int"},
 			{Key: "skip_tls_verification", Label: "Skip TLS Verification", Description: "Skip TLS certificate verification (insecure, use only for trusted sources with certificate issues).", Type: "bool"},
+			{Key: "global_rate_limit", Label: "Global Speed Limit", Description: "Total bandwidth limit for all downloads in MB/s (0 = unlimited). Applies immediately.", Type: "int64"},
+			{Key: "download_rate_limit", Label: "Per-Download Limit", Description: "Default bandwidth limit for each new download in MB/s (0 = unlimited). Can be changed per download with 't'.", Type: "int64"},
 		},
 		"Performance": {
 			{Key: "max_task_retries", Label: "Max Task Retries", Description: "Number of times to retry a failed chunk before giving up.", Type: "int"},
@@ -125,12 +166,26 @@ func GetSettingsMetadata() map[string][]SettingMeta {
 			{Key: "stall_timeout", Label: "Stall Timeout", Description: "Restart workers with no data for this duration (e.g., 5s).", Type: "duration"},
 			{Key: "speed_ema_alpha", Label: "Speed EMA Alpha", Description: "Exponential moving average smoothing factor (0.0-1.0).", Type: "float64"},
 		},
+		"Torrent": {
+			{Key: "enable_dht", Label: "Enable DHT", Description: "Find peers through the distributed hash table as well as trackers. Needed for most magnet links; skipped for private torrents and behind a proxy.", Type: "bool"},
+			{Key: "listen_port", Label: "Listen Port", Description: "TCP port other peers connect to (0 = any free port). Another free port is used if this one is taken.", Type: "int"},
+			{Key: "max_peers", Label: "Max Peers", Description: "Maximum peers connected per torrent.", Type: "int"},
+			{Key: "seed_ratio", Label: "Seed Ratio", Description: "Keep seeding a finished torrent until it uploaded this many times its size (0 = no ratio limit).", Type: "float64"},
+			{Key: "seed_time", Label: "Seed Time", Description: "Stop seeding a finished torrent after this long (e.g., 30m; 0 = no time limit). With both limits at 0 nothing is seeded.", Type: "duration"},
+		},
+		"Hooks": {
+			{Key: "on_complete", Label: "On Complete", Description: "Shell command run when a download completes. SURGE_PATH, SURGE_URL, SURGE_SIZE, SURGE_ID, SURGE_HASH and more describe the file. Leave empty to run nothing.", Type: "string"},
+			{Key: "on_error", Label: "On Error", Description: "Shell command run when a download fails. SURGE_ERROR holds the error. Leave empty to run nothing.", Type: "string"},
+			{Key: "webhook_url", Label: "Webhook URL", Description: "URL that receives a JSON POST when a download completes or fails. Leave empty to disable.", Type: "string"},
+			{Key: "timeout", Label: "Hook Timeout", Description: "Stop a hook command or webhook request after this long (e.g., 30s).", Type: "duration"},
+			{Key: "allow_remote_commands", Label: "Allow Remote Commands", Description: "Accept hook commands with downloads added over the network API. Anyone with the API token can then run commands on this machine. Webhooks and the local CLI are always allowed.", Type: "bool"},
+		},
 	}
 }
 
 // CategoryOrder returns the order of categories for UI tabs.
 func CategoryOrder() []string {
-	return []string{"General", "Network", "Performance"}
+	return []string{"General", "Network", "Performance", "Torrent", "Hooks"}
 }
 
 const (
@@ -166,6 +221,12 @@ func DefaultSettings() *Settings {
 			ExtensionPrompt:    false,
 			AutoResume:         false,
 			PreserveURLPath:    false,
+			PathTemplate:       "",
+			ConflictPolicy:     ConflictRename,
+			DiscoverChecksums:  false,
+			StreamVariant:      "highest",
+			AutoExtract:        false,
+			DeleteAfterExtract: false,
 
 			ClipboardMonitor:  true,
 			Theme:             ThemeAdaptive,
@@ -179,6 +240,8 @@ func DefaultSettings() *Settings {
 			MinChunkSize:           2 * MB,
 			WorkerBufferSize:       512 * KB,
 			SkipTLSVerification:    false,
+			GlobalRateLimit:        0,
+			DownloadRateLimit:      0,
 		},
 		Performance: PerformanceSettings{
 			MaxTaskRetries:        3,
@@ -187,6 +250,17 @@ func DefaultSettings() *Settings {
 			StallTimeout:          3 * time.Second,
 			SpeedEmaAlpha:         0.3,
 		},
+		Torrent: TorrentSettings{
+			EnableDHT:  true,
+			ListenPort: 6881,
+			MaxPeers:   50,
+			SeedRatio:  1.0,
+			SeedTime:   30 * time.Minute,
+		},
+		Hooks: HookSettings{
+			Timeout: DefaultHookTimeout,
+		},
+		Categories: DefaultCategories(),
 	}
 }
 
@@ -245,6 +319,8 @@ type RuntimeConfig struct {
 	MaxConnectionsPerHost int
 	UserAgent             string
 	ProxyURL              string
+	CookiesFile           string
+	NetrcFile             string
 	SequentialDownload    bool
 	MinChunkSize          int64
 	WorkerBufferSize      int
@@ -255,6 +331,20 @@ type RuntimeConfig struct {
 	SpeedEmaAlpha         float64
 	SkipTLSVerification   bool
 	PreserveURLPath       bool
+	PathTemplate          string
+	ConflictPolicy        string
+	DiscoverChecksums     bool
+	StreamVariant         string
+	AutoExtract           bool
+	DeleteAfterExtract    bool
+	HostConnectionLimits  map[string]int
+	EnableDHT             bool
+	TorrentPort           int
+	MaxPeers              int
+	SeedRatio             float64
+	SeedTime              time.Duration
+	Categories            []Category
+	DefaultDownloadDir    string
 }
 
 // ToRuntimeConfig creates a RuntimeConfig from user Settings
@@ -263,6 +353,8 @@ func (s *Settings) ToRuntimeConfig() *RuntimeConfig {
 		MaxConnectionsPerHost: s.Network.MaxConnectionsPerHost,
 		UserAgent:             s.Network.UserAgent,
 		ProxyURL:              s.Network.ProxyURL,
+		CookiesFile:           s.Network.CookiesFile,
+		NetrcFile:             s.Network.NetrcFile,
 		SequentialDownload:    s.Network.SequentialDownload,
 		MinChunkSize:          s.Network.MinChunkSize,
 		WorkerBufferSize:      s.Network.WorkerBufferSize,
@@ -273,5 +365,19 @@ func (s *Settings) ToRuntimeConfig() *RuntimeConfig {
 		SpeedEmaAlpha:         s.Performance.SpeedEmaAlpha,
 		SkipTLSVerification:   s.Network.SkipTLSVerification,
 		PreserveURLPath:       s.General.PreserveURLPath,
+		PathTemplate:          s.General.PathTemplate,
+		ConflictPolicy:        s.General.ConflictPolicy,
+		DiscoverChecksums:     s.General.DiscoverChecksums,
+		StreamVariant:         s.General.StreamVariant,
+		AutoExtract:           s.General.AutoExtract,
+		DeleteAfterExtract:    s.General.DeleteAfterExtract,
+		HostConnectionLimits:  s.Network.HostConnectionLimits,
+		EnableDHT:             s.Torrent.EnableDHT,
+		TorrentPort:           s.Torrent.ListenPort,
+		MaxPeers:              s.Torrent.MaxPeers,
+		SeedRatio:             s.Torrent.SeedRatio,
+		SeedTime:              s.Torrent.SeedTime,
+		Categories:            s.Categories,
+		DefaultDownloadDir:    s.General.DefaultDownloadDir,
 	}
 }
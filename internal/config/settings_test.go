@@ -49,6 +49,12 @@ func TestDefaultSettings(t *testing.T) {
 		if settings.Network.SequentialDownload {
 			t.Error("SequentialDownload should be false by default")
 		}
+		if settings.Network.GlobalRateLimit != 0 {
+			t.Errorf("GlobalRateLimit should be unlimited by default, got: %d", settings.Network.GlobalRateLimit)
+		}
+		if settings.Network.DownloadRateLimit != 0 {
+			t.Errorf("DownloadRateLimit should be unlimited by default, got: %d", settings.Network.DownloadRateLimit)
+		}
 	})
 
 	// Verify Chunk settings
@@ -80,6 +86,19 @@ func TestDefaultSettings(t *testing.T) {
 			t.Errorf("SpeedEmaAlpha should be between 0 and 1, got: %f", settings.Performance.SpeedEmaAlpha)
 		}
 	})
+
+	// Verify Torrent settings
+	t.Run("TorrentSettings", func(t *testing.T) {
+		if !settings.Torrent.EnableDHT {
+			t.Error("EnableDHT should be on by default, magnet links rely on it")
+		}
+		if settings.Torrent.MaxPeers <= 0 {
+			t.Errorf("MaxPeers should be positive, got: %d", settings.Torrent.MaxPeers)
+		}
+		if settings.Torrent.SeedRatio <= 0 && settings.Torrent.SeedTime <= 0 {
+			t.Error("Finished torrents should be seeded by default")
+		}
+	})
 }
 
 func TestDefaultSettings_Consistency(t *testing.T) {
@@ -289,6 +308,9 @@ func TestToRuntimeConfig(t *testing.T) {
 	if runtime.WorkerBufferSize != settings.Network.WorkerBufferSize {
 		t.Error("WorkerBufferSize not correctly mapped")
 	}
+	if runtime.StreamVariant != settings.General.StreamVariant {
+		t.Error("StreamVariant not correctly mapped")
+	}
 	if runtime.MaxTaskRetries != settings.Performance.MaxTaskRetries {
 		t.Error("MaxTaskRetries not correctly mapped")
 	}
@@ -304,6 +326,12 @@ func TestToRuntimeConfig(t *testing.T) {
 	if runtime.SpeedEmaAlpha != settings.Performance.SpeedEmaAlpha {
 		t.Error("SpeedEmaAlpha not correctly mapped")
 	}
+	if runtime.EnableDHT != settings.Torrent.EnableDHT || runtime.TorrentPort != settings.Torrent.ListenPort || runtime.MaxPeers != settings.Torrent.MaxPeers {
+		t.Error("Torrent peer settings not correctly mapped")
+	}
+	if runtime.SeedRatio != settings.Torrent.SeedRatio || runtime.SeedTime != settings.Torrent.SeedTime {
+		t.Error("Torrent seeding limits not correctly mapped")
+	}
 }
 
 func TestGetSettingsMetadata(t *testing.T) {
@@ -357,7 +385,7 @@ func TestCategoryOrder(t *testing.T) {
 	}
 
 	// Should have all expected categories
-	expectedCount := 3 // General, Network, Performance
+	expectedCount := 5 // General, Network, Performance, Torrent, Hooks
 	if len(order) != expectedCount {
 		t.Errorf("Expected %d categories, got %d", expectedCount, len(order))
 	}
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// ErrBatchNotFound is returned for a batch without any downloads
+var ErrBatchNotFound = errors.New("batch not found")
+
+// SummarizeBatches groups downloads by batch and adds up their progress.
+// Batches are listed in the order their first download appears.
+func SummarizeBatches(statuses []types.DownloadStatus) []types.BatchStatus {
+	var batches []types.BatchStatus
+	index := make(map[string]int)
+	for _, s := range statuses {
+		if s.BatchID == "" {
+			continue
+		}
+		i, ok := index[s.BatchID]
+		if !ok {
+			i = len(batches)
+			index[s.BatchID] = i
+			batches = append(batches, types.BatchStatus{ID: s.BatchID, Name: s.BatchName})
+		}
+		b := &batches[i]
+		if b.Name == "" {
+			b.Name = s.BatchName
+		}
+		b.Count++
+		b.IDs = append(b.IDs, s.ID)
+		b.TotalSize += s.TotalSize
+		b.Downloaded += s.Downloaded
+		switch s.Status {
+		case "completed", "skipped":
+			b.Completed++
+		case "error":
+			b.Failed++
+		case "downloading":
+			b.Speed += s.Speed
+		}
+		b.Status = batchState(b.Status, downloadState(s))
+	}
+
+	for i := range batches {
+		b := &batches[i]
+		if b.TotalSize > 0 {
+			b.Progress = float64(b.Downloaded) * 100 / float64(b.TotalSize)
+		}
+		if remaining := b.TotalSize - b.Downloaded; remaining > 0 && b.Speed > 0 {
+			b.ETA = int64(float64(remaining) / (b.Speed * 1024 * 1024))
+		}
+	}
+	return batches
+}
+
+// downloadState maps a download status to the state it gives its batch. The
+// pool reports downloads waiting for a worker as downloading with a queue
+// position.
+func downloadState(s types.DownloadStatus) string {
+	switch s.Status {
+	case "downloading":
+		if s.QueuePosition > 0 {
+			return "queued"
+		}
+	case "pausing":
+		return "paused"
+	}
+	return s.Status
+}
+
+// batchStateRank orders download states by which one a batch shows: a batch
+// with anything running is downloading, one with only finished downloads is
+// completed.
+var batchStateRank = map[string]int{
+	"downloading": 5,
+	"queued":      4,
+	"paused":      3,
+	"error":       2,
+	"completed":   1,
+	"skipped":     1,
+}
+
+func batchState(current, next string) string {
+	if batchStateRank[next] > batchStateRank[current] {
+		return next
+	}
+	return current
+}
+
+// ListBatches returns the batches that still have downloads
+func ListBatches(s DownloadService) ([]types.BatchStatus, error) {
+	statuses, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	return SummarizeBatches(statuses), nil
+}
+
+// FindBatch returns the batch with the given ID
+func FindBatch(s DownloadService, id string) (*types.BatchStatus, error) {
+	statuses, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range SummarizeBatches(statuses) {
+		if b.ID == id {
+			return &b, nil
+		}
+	}
+	return nil, ErrBatchNotFound
+}
+
+// batchMembers returns the statuses of a batch's downloads
+func batchMembers(s DownloadService, id string) ([]types.DownloadStatus, error) {
+	statuses, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var members []types.DownloadStatus
+	for _, st := range statuses {
+		if st.BatchID == id {
+			members = append(members, st)
+		}
+	}
+	if len(members) == 0 {
+		return nil, ErrBatchNotFound
+	}
+	return members, nil
+}
+
+// BatchPause pauses every unfinished download of a batch, including the ones
+// still waiting in the queue. It returns how many it paused.
+func BatchPause(s DownloadService, id string) (int, error) {
+	members, err := batchMembers(s, id)
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	n := 0
+	for _, m := range members {
+		if m.Status != "downloading" && m.Status != "queued" {
+			continue
+		}
+		if err := s.Pause(m.ID); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.ID, err))
+			continue
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
+
+// BatchResume resumes every paused download of a batch and returns how many
+// it resumed
+func BatchResume(s DownloadService, id string) (int, error) {
+	members, err := batchMembers(s, id)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for _, m := range members {
+		if m.Status == "paused" || m.Status == "queued" {
+			ids = append(ids, m.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	var errs []error
+	n := 0
+	for i, err := range s.ResumeBatch(ids) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ids[i], err))
+			continue
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
+
+// BatchDelete cancels and removes every download of a batch
+func BatchDelete(s DownloadService, id string) (int, error) {
+	members, err := batchMembers(s, id)
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	n := 0
+	for _, m := range members {
+		if err := s.Delete(m.ID); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.ID, err))
+			continue
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
+
+// BatchSetPriority changes the queue priority of every unfinished download
+// of a batch
+func BatchSetPriority(s DownloadService, id string, priority types.Priority) (int, error) {
+	members, err := batchMembers(s, id)
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	n := 0
+	for _, m := range members {
+		if m.Status == "completed" || m.Status == "skipped" || m.Status == "error" {
+			continue
+		}
+		if err := s.SetPriority(m.ID, priority); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.ID, err))
+			continue
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// batchTestService records the calls the batch actions make. Methods the
+// actions don't use are left to the nil embedded interface.
+type batchTestService struct {
+	DownloadService
+	statuses []types.DownloadStatus
+	calls    []string
+}
+
+func (s *batchTestService) List() ([]types.DownloadStatus, error) { return s.statuses, nil }
+
+func (s *batchTestService) Pause(id string) error {
+	s.calls = append(s.calls, "pause "+id)
+	return nil
+}
+
+func (s *batchTestService) ResumeBatch(ids []string) []error {
+	errs := make([]error, len(ids))
+	for i, id := range ids {
+		s.calls = append(s.calls, "resume "+id)
+		if id == "broken" {
+			errs[i] = errors.New("cannot resume")
+		}
+	}
+	return errs
+}
+
+func (s *batchTestService) Delete(id string) error {
+	s.calls = append(s.calls, "delete "+id)
+	return nil
+}
+
+func (s *batchTestService) SetPriority(id string, priority types.Priority) error {
+	s.calls = append(s.calls, "priority "+id+" "+priority.String())
+	return nil
+}
+
+func TestSummarizeBatches(t *testing.T) {
+	batches := SummarizeBatches([]types.DownloadStatus{
+		{ID: "loose", Status: "downloading", TotalSize: 50},
+		{ID: "a1", BatchID: "a", BatchName: "isos", Status: "completed", TotalSize: 100, Downloaded: 100},
+		{ID: "b1", BatchID: "b", Status: "paused", TotalSize: 10, Downloaded: 5},
+		{ID: "a2", BatchID: "a", Status: "downloading", TotalSize: 300, Downloaded: 100, Speed: 2},
+		{ID: "a3", BatchID: "a", Status: "error"},
+		{ID: "b2", BatchID: "b", Status: "downloading", QueuePosition: 1, TotalSize: 10},
+	})
+	if len(batches) != 2 {
+		t.Fatalf("got %d batches, want 2: %+v", len(batches), batches)
+	}
+
+	a := batches[0]
+	if a.ID != "a" || a.Name != "isos" || a.Status != "downloading" || a.Count != 3 || a.Completed != 1 || a.Failed != 1 {
+		t.Errorf("batch a = %+v", a)
+	}
+	if a.TotalSize != 400 || a.Downloaded != 200 || a.Progress != 50 || a.Speed != 2 {
+		t.Errorf("batch a totals = %+v", a)
+	}
+	if want := int64(200 / (2 * 1024 * 1024)); a.ETA != want {
+		t.Errorf("batch a ETA = %d, want %d", a.ETA, want)
+	}
+	if !reflect.DeepEqual(a.IDs, []string{"a1", "a2", "a3"}) {
+		t.Errorf("batch a IDs = %v", a.IDs)
+	}
+
+	// A download waiting in the pool outranks a paused one
+	if b := batches[1]; b.ID != "b" || b.Status != "queued" || b.Count != 2 {
+		t.Errorf("batch b = %+v", b)
+	}
+}
+
+func TestBatchActions(t *testing.T) {
+	statuses := []types.DownloadStatus{
+		{ID: "running", BatchID: "x", Status: "downloading"},
+		{ID: "waiting", BatchID: "x", Status: "queued"},
+		{ID: "stopped", BatchID: "x", Status: "paused"},
+		{ID: "finished", BatchID: "x", Status: "completed"},
+		{ID: "other", BatchID: "y", Status: "downloading"},
+	}
+
+	svc := &batchTestService{statuses: statuses}
+	n, err := BatchPause(svc, "x")
+	if err != nil || n != 2 || !reflect.DeepEqual(svc.calls, []string{"pause running", "pause waiting"}) {
+		t.Errorf("BatchPause = %d, %v; calls %v", n, err, svc.calls)
+	}
+
+	svc = &batchTestService{statuses: statuses}
+	n, err = BatchResume(svc, "x")
+	if err != nil || n != 2 || !reflect.DeepEqual(svc.calls, []string{"resume waiting", "resume stopped"}) {
+		t.Errorf("BatchResume = %d, %v; calls %v", n, err, svc.calls)
+	}
+
+	svc = &batchTestService{statuses: statuses}
+	n, err = BatchSetPriority(svc, "x", types.PriorityHigh)
+	if err != nil || n != 3 || len(svc.calls) != 3 || svc.calls[2] != "priority stopped high" {
+		t.Errorf("BatchSetPriority = %d, %v; calls %v", n, err, svc.calls)
+	}
+
+	svc = &batchTestService{statuses: statuses}
+	n, err = BatchDelete(svc, "x")
+	if err != nil || n != 4 {
+		t.Errorf("BatchDelete = %d, %v; calls %v", n, err, svc.calls)
+	}
+
+	if _, err := BatchPause(svc, "missing"); !errors.Is(err, ErrBatchNotFound) {
+		t.Errorf("BatchPause of an unknown batch: err = %v, want ErrBatchNotFound", err)
+	}
+}
+
+func TestBatchResume_ReportsFailures(t *testing.T) {
+	svc := &batchTestService{statuses: []types.DownloadStatus{
+		{ID: "ok", BatchID: "x", Status: "paused"},
+		{ID: "broken", BatchID: "x", Status: "paused"},
+	}}
+	n, err := BatchResume(svc, "x")
+	if n != 1 || err == nil {
+		t.Errorf("BatchResume = %d, %v; want 1 and an error", n, err)
+	}
+}
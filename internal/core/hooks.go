@@ -0,0 +1,99 @@
+package core
+
+import (
+	"sync"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/hooks"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// hookOutputMu keeps hooks finishing together from writing their output to
+// the database at the same time
+var hookOutputMu sync.Mutex
+
+// hooksFor returns the hooks of a download: the configured ones, overridden
+// by those of its category and then by its own
+func (s *LocalDownloadService) hooksFor(id string) config.HookSettings {
+	entry, err := state.GetDownload(id)
+	if err != nil {
+		utils.Debug("Hooks: %v", err)
+	}
+
+	s.settingsMu.RLock()
+	h := s.settings.Hooks
+	if entry != nil && entry.Category != "" {
+		if c := config.FindCategory(s.settings.Categories, entry.Category); c != nil {
+			h = h.Override(c.Hooks)
+		}
+	}
+	s.settingsMu.RUnlock()
+
+	own, err := state.LoadDownloadHooks(id)
+	if err != nil {
+		utils.Debug("Hooks: %v", err)
+	}
+	return h.Override(own)
+}
+
+// runHooks runs the hooks for a completed or failed download and records
+// their output in its history entry
+func (s *LocalDownloadService) runHooks(msg interface{}) {
+	var ev hooks.Event
+	switch m := msg.(type) {
+	case events.DownloadCompleteMsg:
+		ev = hooks.Event{Type: hooks.EventComplete, ID: m.DownloadID, Filename: m.Filename, Size: m.Total}
+	case events.DownloadErrorMsg:
+		ev = hooks.Event{Type: hooks.EventError, ID: m.DownloadID, Filename: m.Filename}
+		if m.Err != nil {
+			ev.Error = m.Err.Error()
+		}
+	default:
+		return
+	}
+
+	if s.ctx.Err() != nil {
+		return // Shutting down
+	}
+	h := s.hooksFor(ev.ID)
+	if !hooks.Configured(h, ev.Type) {
+		return
+	}
+
+	// The engine persists the entry before it reports the download
+	entry, err := state.GetDownload(ev.ID)
+	if err != nil {
+		utils.Debug("Hooks: %v", err)
+	}
+	if entry != nil {
+		ev.URL = entry.URL
+		ev.Path = entry.DestPath
+		ev.Hash = entry.Checksum
+		ev.BatchID = entry.BatchID
+		if ev.Filename == "" {
+			ev.Filename = entry.Filename
+		}
+		if ev.Size == 0 {
+			ev.Size = entry.TotalSize
+		}
+	}
+
+	output, err := hooks.Run(s.ctx, h, ev)
+	if err != nil {
+		utils.Debug("Hooks for %s (%s) failed: %v", ev.ID, ev.Type, err)
+		if output != "" {
+			output += "\n"
+		}
+		output += "hook failed: " + err.Error()
+	}
+	if output == "" || entry == nil {
+		return
+	}
+	hookOutputMu.Lock()
+	defer hookOutputMu.Unlock()
+	if err := state.SetHookOutput(ev.ID, output); err != nil {
+		utils.Debug("Hooks: %v", err)
+	}
+}
@@ -16,8 +16,9 @@ type DownloadService interface {
 	// History returns completed downloads
 	History() ([]types.DownloadEntry, error)
 
-	// Add queues a new download.
-	Add(url string, path string, filename string, mirrors []string, headers map[string]string) (string, error)
+	// Add queues a new download. checksum is an optional expected digest
+	// ("sha256:abcd...") checked once the file is complete; opts may be nil.
+	Add(url string, path string, filename string, mirrors []string, headers map[string]string, checksum string, opts *types.AddOptions) (string, error)
 
 	// Pause pauses an active download.
 	Pause(id string) error
@@ -31,6 +32,28 @@ type DownloadService interface {
 	// Delete cancels and removes a download.
 	Delete(id string) error
 
+	// SetRateLimit changes the bandwidth limit (bytes/sec, 0 = unlimited) of a
+	// single download. Takes effect immediately for running downloads.
+	SetRateLimit(id string, bytesPerSec int64) error
+
+	// SetGlobalRateLimit changes the bandwidth limit shared by all downloads.
+	SetGlobalRateLimit(bytesPerSec int64) error
+
+	// SetMaxDownloads changes how many downloads may run at once. Running
+	// downloads above a lowered limit are allowed to finish.
+	SetMaxDownloads(n int) error
+
+	// Move changes the place of a queued download: "top", "bottom", "up",
+	// "down" or a 1-based position.
+	Move(id string, to string) error
+
+	// SetPriority changes the queue priority of a download that hasn't finished.
+	SetPriority(id string, priority types.Priority) error
+
+	// Verify re-hashes the file of a finished or paused download and repairs
+	// the pieces that don't match.
+	Verify(id string) (*types.VerifyResult, error)
+
 	// StreamEvents returns a channel that receives real-time download events.
 	// For local mode, this is a direct channel.
 	// For remote mode, this is sourced from SSE.
@@ -2,20 +2,44 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/checksum"
 	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/metalink"
 	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/torrent"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
+// keepsExistingFile reports whether a new download is skipped right away:
+// its conflict policy is to skip, and its file, named when it was added and
+// not moved by a path template, already exists.
+func keepsExistingFile(cfg types.DownloadConfig, category *config.Category) bool {
+	policy := cfg.Conflict
+	if policy == "" {
+		policy = cfg.Runtime.ConflictPolicy
+	}
+	if policy != config.ConflictSkip || cfg.Filename == "" || cfg.Runtime.PathTemplate != "" || cfg.Runtime.PreserveURLPath {
+		return false
+	}
+	if category != nil && category.PathTemplate != "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(cfg.OutputPath, cfg.Filename))
+	return err == nil
+}
+
 func completedSpeedMBps(entry types.DownloadEntry) float64 {
 	if entry.Status != "completed" {
 		return 0
@@ -38,6 +62,9 @@ func (s *LocalDownloadService) ReloadSettings() error {
 	s.settingsMu.Lock()
 	s.settings = settings
 	s.settingsMu.Unlock()
+	if s.Scheduler != nil {
+		s.Scheduler.SetSchedule(settings.Schedule)
+	}
 	return nil
 }
 
@@ -46,12 +73,20 @@ type LocalDownloadService struct {
 	Pool    *download.WorkerPool
 	InputCh chan interface{}
 
+	// Scheduler applies the bandwidth schedule, and the saved one when the
+	// settings are reloaded. Nil when no schedule runs.
+	Scheduler *download.Scheduler
+
 	// Broadcast fields
 	listeners  []chan interface{}
 	listenerMu sync.Mutex
 
 	reportTicker *time.Ticker
 
+	// Completion and error hooks still running, waited for by Shutdown
+	hooksWG       sync.WaitGroup
+	broadcastDone chan struct{}
+
 	// Lifecycle
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -81,9 +116,10 @@ func NewLocalDownloadServiceWithInput(pool *download.WorkerPool, inputCh chan in
 		inputCh = make(chan interface{}, 100)
 	}
 	s := &LocalDownloadService{
-		Pool:      pool,
-		InputCh:   inputCh,
-		listeners: make([]chan interface{}, 0),
+		Pool:          pool,
+		InputCh:       inputCh,
+		listeners:     make([]chan interface{}, 0),
+		broadcastDone: make(chan struct{}),
 	}
 
 	// Load initial settings
@@ -110,6 +146,15 @@ func NewLocalDownloadServiceWithInput(pool *download.WorkerPool, inputCh chan in
 
 func (s *LocalDownloadService) broadcastLoop() {
 	for msg := range s.InputCh {
+		switch msg.(type) {
+		case events.DownloadCompleteMsg, events.DownloadErrorMsg:
+			s.hooksWG.Add(1)
+			go func() {
+				defer s.hooksWG.Done()
+				s.runHooks(msg)
+			}()
+		}
+
 		s.listenerMu.Lock()
 		for _, ch := range s.listeners {
 			// Check message type
@@ -149,6 +194,7 @@ func (s *LocalDownloadService) broadcastLoop() {
 	if s.reportTicker != nil {
 		s.reportTicker.Stop()
 	}
+	close(s.broadcastDone)
 }
 
 func (s *LocalDownloadService) reportProgressLoop() {
@@ -199,6 +245,7 @@ func (s *LocalDownloadService) reportProgressLoop() {
 				Elapsed:           totalElapsed,
 				ActiveConnections: int(connections),
 			}
+			msg.TargetConnections, msg.ConnectionReason = cfg.State.GetConnectionTarget()
 
 			// Add Chunk Bitmap for visualization (if initialized)
 			bitmap, width, _, chunkSize, chunkProgress := cfg.State.GetBitmap()
@@ -305,6 +352,7 @@ func (s *LocalDownloadService) Shutdown() error {
 		if s.Pool != nil {
 			s.Pool.GracefulShutdown()
 		}
+		torrent.StopAll()
 
 		// Stop listeners and broadcaster
 		s.cancel()
@@ -312,6 +360,10 @@ func (s *LocalDownloadService) Shutdown() error {
 		// Close input channel to stop broadcaster
 		if s.InputCh != nil {
 			close(s.InputCh)
+			// Hooks were cancelled above; let them record that before the
+			// database closes
+			<-s.broadcastDone
+			s.hooksWG.Wait()
 		}
 	})
 	return s.shutdownErr
@@ -320,19 +372,32 @@ func (s *LocalDownloadService) Shutdown() error {
 // List returns the status of all active and completed downloads.
 func (s *LocalDownloadService) List() ([]types.DownloadStatus, error) {
 	var statuses []types.DownloadStatus
+	names := batchNames()
 
 	// 1. Get active downloads from pool
 	if s.Pool != nil {
+		positions := make(map[string]int)
+		for i, id := range s.Pool.Queue() {
+			positions[id] = i + 1
+		}
+
 		activeConfigs := s.Pool.GetAll()
 		for _, cfg := range activeConfigs {
 			status := types.DownloadStatus{
-				ID:       cfg.ID,
-				URL:      cfg.URL,
-				Filename: cfg.Filename,
-				Status:   "downloading",
+				ID:            cfg.ID,
+				URL:           cfg.URL,
+				Filename:      cfg.Filename,
+				Status:        "downloading",
+				Priority:      cfg.Priority.String(),
+				QueuePosition: positions[cfg.ID],
+				BatchID:       cfg.BatchID,
+				BatchName:     names[cfg.BatchID],
+				Category:      cfg.Category,
 			}
 
 			if cfg.State != nil {
+				status.Category = cfg.State.GetCategory() // Matched after probing if not when added
+
 				// Calculate progress and speed (thread-safe)
 				downloaded, totalSize, _, sessionElapsed, connections, sessionStart := cfg.State.GetProgress()
 
@@ -396,11 +461,11 @@ func (s *LocalDownloadService) List() ([]types.DownloadStatus, error) {
 			var progress float64
 			if d.TotalSize > 0 {
 				progress = float64(d.Downloaded) * 100 / float64(d.TotalSize)
-			} else if d.Status == "completed" {
+			} else if d.Status == "completed" || d.Status == "skipped" {
 				progress = 100.0
 			}
 
-			statuses = append(statuses, types.DownloadStatus{
+			status := types.DownloadStatus{
 				ID:          d.ID,
 				URL:         d.URL,
 				Filename:    d.Filename,
@@ -413,36 +478,148 @@ func (s *LocalDownloadService) List() ([]types.DownloadStatus, error) {
 				Connections: 0,
 				TimeTaken:   d.TimeTaken,
 				AvgSpeed:    d.AvgSpeed,
-			})
+				RateLimit:   d.RateLimit,
+
+				Checksum:       d.Checksum,
+				ChecksumStatus: d.ChecksumStatus,
+				BatchID:        d.BatchID,
+				BatchName:      names[d.BatchID],
+				Category:       d.Category,
+				HookOutput:     d.HookOutput,
+			}
+			if d.Status != "completed" && d.Status != "skipped" {
+				status.Priority = d.Priority.String()
+			}
+			statuses = append(statuses, status)
 		}
 	}
 
 	return statuses, nil
 }
 
-// Add queues a new download.
-func (s *LocalDownloadService) Add(url string, path string, filename string, mirrors []string, headers map[string]string) (string, error) {
+// Add queues a new download. A metalink listing several files queues one
+// download per file and returns the ID of the first.
+func (s *LocalDownloadService) Add(url string, path string, filename string, mirrors []string, headers map[string]string, expectedChecksum string, opts *types.AddOptions) (string, error) {
 	if s.Pool == nil {
 		return "", fmt.Errorf("worker pool not initialized")
 	}
 
+	// Reject bad checksums up front rather than after the whole file is downloaded
+	expectedChecksum, err := checksum.Normalize(expectedChecksum)
+	if err != nil {
+		return "", err
+	}
+
 	s.settingsMu.RLock()
 	settings := s.settings
 	s.settingsMu.RUnlock()
 
 	// Prepare output path
-	outPath := path
-	if outPath == "" {
-		if settings.General.DefaultDownloadDir != "" {
-			outPath = settings.General.DefaultDownloadDir
-		} else {
-			outPath = "."
+	defaultDir := "."
+	if settings.General.DefaultDownloadDir != "" {
+		defaultDir = settings.General.DefaultDownloadDir
+	}
+	defaultDir = utils.EnsureAbsPath(defaultDir)
+	outPath := defaultDir
+	if path != "" {
+		outPath = utils.EnsureAbsPath(path)
+	}
+	runtime := types.ConvertRuntimeConfig(settings.ToRuntimeConfig())
+	runtime.DefaultDownloadDir = defaultDir
+
+	var category *config.Category
+	if opts != nil && opts.Category != "" {
+		if category = config.FindCategory(settings.Categories, opts.Category); category == nil {
+			return "", fmt.Errorf("unknown category %q", opts.Category)
+		}
+	}
+	if opts != nil && opts.Conflict != "" && !config.ValidConflictPolicy(opts.Conflict) {
+		return "", fmt.Errorf("unknown conflict policy %q", opts.Conflict)
+	}
+	if opts != nil && opts.Proxy != "" {
+		if err := types.ValidateProxyURL(opts.Proxy); err != nil {
+			return "", err
+		}
+		runtime.ProxyURL = opts.Proxy
+	}
+
+	// Each file of a metalink becomes a download of its own
+	if source, name := metalink.SplitFile(url); name == "" && metalink.IsMetalink(source, "") {
+		m, err := metalink.Load(context.Background(), source, headers, runtime)
+		if err != nil {
+			return "", err
+		}
+		if len(m.Files) > 1 {
+			if filename != "" || expectedChecksum != "" || (opts != nil && opts.Pieces != nil) {
+				return "", fmt.Errorf("metalink lists %d files, a filename or checksum can't apply to all of them", len(m.Files))
+			}
+			// The files stay in the batch the metalink was added to and keep its
+			// hooks and category; without one each file is sorted on its own
+			var fileOpts *types.AddOptions
+			if opts != nil {
+				fileOpts = &types.AddOptions{BatchID: opts.BatchID, BatchName: opts.BatchName, Category: opts.Category, Conflict: opts.Conflict, Hooks: opts.Hooks, Proxy: opts.Proxy}
+			}
+			var firstID string
+			for _, f := range m.Files {
+				id, err := s.Add(metalink.FileURL(source, f.Name), path, "", nil, headers, "", fileOpts)
+				if err != nil {
+					return firstID, err
+				}
+				if firstID == "" {
+					firstID = id
+				}
+			}
+			return firstID, nil
+		}
+	}
+
+	// A category picks the directory, rate limit and connection limit. Those
+	// matching on the content type are tried again once it has been probed.
+	if category == nil {
+		category = config.MatchCategory(settings.Categories, url, filename, "")
+	}
+	rateLimit := settings.Network.DownloadRateLimit
+	if category != nil {
+		outPath = utils.EnsureAbsPath(category.Destination(outPath, defaultDir))
+		if category.RateLimit > 0 {
+			rateLimit = category.RateLimit
 		}
 	}
-	outPath = utils.EnsureAbsPath(outPath)
 
 	id := uuid.New().String()
 
+	if opts != nil && opts.BatchID != "" {
+		if err := state.SaveBatch(types.Batch{ID: opts.BatchID, Name: opts.BatchName}); err != nil {
+			utils.Debug("Failed to save batch %s: %v", opts.BatchID, err)
+		}
+	}
+
+	if opts != nil && opts.Hooks != nil && !opts.Hooks.Empty() {
+		if err := state.SaveDownloadHooks(id, *opts.Hooks); err != nil {
+			return "", err
+		}
+	}
+
+	// Resuming after a restart sends the same headers through the same proxy
+	// and keeps the conflict policy
+	request := types.RequestSettings{Headers: headers}
+	if opts != nil {
+		request.Proxy = opts.Proxy
+		request.Conflict = opts.Conflict
+	}
+	if len(request.Headers) > 0 || request.Proxy != "" || request.Conflict != "" {
+		if err := state.SaveRequestSettings(id, request); err != nil {
+			return "", err
+		}
+	}
+
+	// Piece hashes are kept for resumes and "surge verify"
+	if opts != nil && opts.Pieces != nil {
+		if err := state.SavePieceHashes(id, opts.Pieces); err != nil {
+			return "", err
+		}
+	}
+
 	// Create configuration
 	state := types.NewProgressState(id, 0)
 	state.DestPath = filepath.Join(outPath, filename) // Best guess until download starts
@@ -455,8 +632,24 @@ func (s *LocalDownloadService) Add(url string, path string, filename string, mir
 		Filename:   filename, // If empty, will be auto-detected
 		ProgressCh: s.InputCh,
 		State:      state,
-		Runtime:    types.ConvertRuntimeConfig(settings.ToRuntimeConfig()),
+		Runtime:    runtime,
 		Headers:    headers,
+		RateLimit:  rateLimit,
+		Checksum:   expectedChecksum,
+	}
+	if category != nil {
+		cfg.Category = category.Name
+	}
+	if opts != nil {
+		cfg.Pieces = opts.Pieces
+		cfg.BatchID = opts.BatchID
+		cfg.BatchName = opts.BatchName
+		cfg.Conflict = opts.Conflict
+	}
+
+	// With a known file name there is no need to wait for the server to skip it
+	if keepsExistingFile(cfg, category) {
+		return id, download.ReportSkipped(&cfg, state.DestPath, 0)
 	}
 
 	s.Pool.Add(cfg)
@@ -477,6 +670,12 @@ func (s *LocalDownloadService) Pause(id string) error {
 	// If not in pool, check if it's already paused/stopped in DB
 	entry, err := state.GetDownload(id)
 	if err == nil && entry != nil {
+		// Saved as queued at shutdown, it would start again on the next launch
+		if entry.Status == "queued" {
+			if err := state.UpdateStatus(id, "paused"); err != nil {
+				return err
+			}
+		}
 		// Emit paused event so UI clears "pausing" state
 		if s.InputCh != nil {
 			s.InputCh <- events.DownloadPausedMsg{
@@ -512,8 +711,8 @@ func (s *LocalDownloadService) Resume(id string) error {
 		return fmt.Errorf("download not found")
 	}
 
-	if entry.Status == "completed" {
-		return fmt.Errorf("download already completed")
+	if entry.Status == "completed" || entry.Status == "skipped" {
+		return fmt.Errorf("download already %s", entry.Status)
 	}
 
 	s.settingsMu.RLock()
@@ -531,6 +730,7 @@ func (s *LocalDownloadService) Resume(id string) error {
 
 	var mirrorURLs []string
 	var dmState *types.ProgressState
+	rateLimit := entry.RateLimit
 
 	if stateErr == nil && savedState != nil {
 		dmState = types.NewProgressState(id, savedState.TotalSize)
@@ -549,6 +749,7 @@ func (s *LocalDownloadService) Resume(id string) error {
 		}
 		dmState.DestPath = entry.DestPath
 		dmState.SyncSessionStart()
+		rateLimit = savedState.RateLimit
 	} else {
 		dmState = types.NewProgressState(id, entry.TotalSize)
 		dmState.Downloaded.Store(entry.Downloaded)
@@ -570,7 +771,14 @@ func (s *LocalDownloadService) Resume(id string) error {
 		SavedState: savedState, // Pass loaded state to avoid re-query
 		Runtime:    types.ConvertRuntimeConfig(settings.ToRuntimeConfig()),
 		Mirrors:    mirrorURLs,
+		RateLimit:  rateLimit,
+		Checksum:   entry.Checksum,
+		Priority:   entry.Priority,
+		QueueOrder: entry.QueueOrder,
+		BatchID:    entry.BatchID,
+		Category:   entry.Category,
 	}
+	restoreRequestSettings(&cfg)
 
 	s.Pool.Add(cfg)
 	if s.InputCh != nil {
@@ -637,6 +845,15 @@ func (s *LocalDownloadService) ResumeBatch(ids []string) []error {
 		return errs
 	}
 
+	// Queue them in their saved order so the first ones to start are the right ones
+	sort.SliceStable(toLoad, func(i, j int) bool {
+		a, b := states[toLoad[i]], states[toLoad[j]]
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return types.QueuedBefore(a.Priority, a.QueueOrder, b.Priority, b.QueueOrder)
+	})
+
 	// 3. Process loaded states
 	for _, id := range toLoad {
 		idx := idMap[id]
@@ -680,7 +897,14 @@ func (s *LocalDownloadService) ResumeBatch(ids []string) []error {
 			SavedState: savedState, // Pass loaded state to avoid re-query
 			Runtime:    types.ConvertRuntimeConfig(settings.ToRuntimeConfig()),
 			Mirrors:    mirrorURLs,
+			RateLimit:  savedState.RateLimit,
+			Checksum:   savedState.Checksum,
+			Priority:   savedState.Priority,
+			QueueOrder: savedState.QueueOrder,
+			BatchID:    savedState.BatchID,
+			Category:   savedState.Category,
 		}
+		restoreRequestSettings(&cfg)
 
 		s.Pool.Add(cfg)
 		errs[idx] = nil
@@ -709,12 +933,15 @@ func (s *LocalDownloadService) Delete(id string) error {
 	}
 
 	s.Pool.Cancel(id)
+	// A finished torrent may still be seeding
+	torrent.Stop(id)
 
 	// Cleanup persisted state and partials if available
 	if entry, err := state.GetDownload(id); err == nil && entry != nil {
 		removedFilename = entry.Filename
 		_ = state.DeleteState(entry.ID, entry.URL, entry.DestPath)
-		if entry.DestPath != "" && entry.Status != "completed" {
+		// A skipped download's path is the file it kept, so there is nothing to clean up
+		if entry.DestPath != "" && entry.Status != "completed" && entry.Status != "skipped" {
 			_ = state.RemoveIncompleteFile(entry.DestPath)
 		}
 	} else if removedDestPath != "" && !removedCompleted {
@@ -737,6 +964,122 @@ func (s *LocalDownloadService) Delete(id string) error {
 	return nil
 }
 
+// SetRateLimit changes the bandwidth limit of a single download.
+// Paused downloads keep the new limit for when they are resumed.
+func (s *LocalDownloadService) SetRateLimit(id string, bytesPerSec int64) error {
+	if id == "" {
+		return fmt.Errorf("missing id")
+	}
+	if bytesPerSec < 0 {
+		return fmt.Errorf("rate limit must not be negative")
+	}
+	if s.Pool == nil {
+		return fmt.Errorf("worker pool not initialized")
+	}
+
+	if s.Pool.SetRateLimit(id, bytesPerSec) {
+		return nil
+	}
+
+	// Not in the pool: persist on the stored entry so a cold resume picks it up
+	entry, err := state.GetDownload(id)
+	if err != nil || entry == nil {
+		return fmt.Errorf("download not found")
+	}
+	if entry.Status == "completed" || entry.Status == "skipped" {
+		return fmt.Errorf("download already %s", entry.Status)
+	}
+	return state.UpdateRateLimit(id, bytesPerSec)
+}
+
+// SetGlobalRateLimit changes the bandwidth limit shared by all downloads.
+func (s *LocalDownloadService) SetGlobalRateLimit(bytesPerSec int64) error {
+	if bytesPerSec < 0 {
+		return fmt.Errorf("rate limit must not be negative")
+	}
+	if s.Pool == nil {
+		return fmt.Errorf("worker pool not initialized")
+	}
+	s.Pool.SetGlobalRateLimit(bytesPerSec)
+	return nil
+}
+
+// SetMaxDownloads changes how many downloads may run at once.
+func (s *LocalDownloadService) SetMaxDownloads(n int) error {
+	if n < 1 {
+		return fmt.Errorf("max downloads must be at least 1")
+	}
+	if s.Pool == nil {
+		return fmt.Errorf("worker pool not initialized")
+	}
+	s.Pool.SetMaxDownloads(n)
+	return nil
+}
+
+// Move changes the place of a queued download.
+// Paused downloads keep the new place for when they are resumed.
+func (s *LocalDownloadService) Move(id string, to string) error {
+	if id == "" {
+		return fmt.Errorf("missing id")
+	}
+	if s.Pool == nil {
+		return fmt.Errorf("worker pool not initialized")
+	}
+
+	err := s.Pool.Move(id, to)
+	if !errors.Is(err, download.ErrNotQueued) {
+		return err
+	}
+	if entry, dbErr := state.GetDownload(id); dbErr != nil || entry == nil {
+		return err
+	}
+	return s.Pool.MoveSaved(id, to)
+}
+
+// SetPriority changes the queue priority of a download.
+// Paused downloads keep the new priority for when they are resumed.
+func (s *LocalDownloadService) SetPriority(id string, priority types.Priority) error {
+	if id == "" {
+		return fmt.Errorf("missing id")
+	}
+	if s.Pool == nil {
+		return fmt.Errorf("worker pool not initialized")
+	}
+
+	if s.Pool.SetPriority(id, priority) {
+		return nil
+	}
+
+	entry, err := state.GetDownload(id)
+	if err != nil || entry == nil {
+		return fmt.Errorf("download not found")
+	}
+	if entry.Status == "completed" || entry.Status == "skipped" {
+		return fmt.Errorf("download already %s", entry.Status)
+	}
+	// Goes to the end of its new priority when resumed
+	return state.UpdatePriority(id, priority, time.Now().UnixNano())
+}
+
+// Verify re-hashes the file of a download that isn't running.
+func (s *LocalDownloadService) Verify(id string) (*types.VerifyResult, error) {
+	if id == "" {
+		return nil, fmt.Errorf("missing id")
+	}
+	if s.Pool == nil {
+		return nil, fmt.Errorf("worker pool not initialized")
+	}
+	if st := s.Pool.GetStatus(id); st != nil && st.Status != "paused" && st.Status != "completed" {
+		return nil, fmt.Errorf("download is %s, pause it before verifying", st.Status)
+	}
+
+	s.settingsMu.RLock()
+	settings := s.settings
+	s.settingsMu.RUnlock()
+
+	return download.Verify(context.Background(), id, types.ConvertRuntimeConfig(settings.ToRuntimeConfig()))
+}
+
 // GetStatus returns a status for a single download by id.
 func (s *LocalDownloadService) GetStatus(id string) (*types.DownloadStatus, error) {
 	if id == "" {
@@ -747,6 +1090,7 @@ func (s *LocalDownloadService) GetStatus(id string) (*types.DownloadStatus, erro
 	if s.Pool != nil {
 		status := s.Pool.GetStatus(id)
 		if status != nil {
+			status.BatchName = batchNames()[status.BatchID]
 			return status, nil
 		}
 	}
@@ -757,7 +1101,7 @@ func (s *LocalDownloadService) GetStatus(id string) (*types.DownloadStatus, erro
 		var progress float64
 		if entry.TotalSize > 0 {
 			progress = float64(entry.Downloaded) * 100 / float64(entry.TotalSize)
-		} else if entry.Status == "completed" {
+		} else if entry.Status == "completed" || entry.Status == "skipped" {
 			progress = 100.0
 		}
 
@@ -772,6 +1116,14 @@ func (s *LocalDownloadService) GetStatus(id string) (*types.DownloadStatus, erro
 			Status:     entry.Status,
 			TimeTaken:  entry.TimeTaken,
 			AvgSpeed:   entry.AvgSpeed,
+			RateLimit:  entry.RateLimit,
+
+			Checksum:       entry.Checksum,
+			ChecksumStatus: entry.ChecksumStatus,
+			BatchID:        entry.BatchID,
+			BatchName:      batchNames()[entry.BatchID],
+			Category:       entry.Category,
+			HookOutput:     entry.HookOutput,
 		}
 		return &status, nil
 	}
@@ -779,8 +1131,40 @@ func (s *LocalDownloadService) GetStatus(id string) (*types.DownloadStatus, erro
 	return nil, fmt.Errorf("download not found")
 }
 
+// batchNames maps batch IDs to their names
+func batchNames() map[string]string {
+	names := make(map[string]string)
+	batches, err := state.ListBatches()
+	if err != nil {
+		utils.Debug("Failed to list batches: %v", err)
+		return names
+	}
+	for _, b := range batches {
+		names[b.ID] = b.Name
+	}
+	return names
+}
+
 // History returns completed downloads
 func (s *LocalDownloadService) History() ([]types.DownloadEntry, error) {
 	// For local service, we can directly access the state DB
 	return state.LoadCompletedDownloads()
 }
+
+// restoreRequestSettings gives a resumed download the headers, proxy and
+// conflict policy it was added with
+func restoreRequestSettings(cfg *types.DownloadConfig) {
+	request, err := state.LoadRequestSettings(cfg.ID)
+	if err != nil {
+		utils.Debug("Resume: %v", err)
+		return
+	}
+	if request == nil {
+		return
+	}
+	cfg.Headers = request.Headers
+	if request.Proxy != "" {
+		cfg.Runtime.ProxyURL = request.Proxy
+	}
+	cfg.Conflict = request.Conflict
+}
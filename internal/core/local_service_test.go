@@ -2,14 +2,22 @@ package core
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/checksum"
 	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
@@ -105,7 +113,7 @@ func TestLocalDownloadService_Delete_ActiveWithoutDB_RemovesPartialFile(t *testi
 
 	outputDir := t.TempDir()
 	const filename = "active-delete.bin"
-	id, err := svc.Add(server.URL(), outputDir, filename, nil, nil)
+	id, err := svc.Add(server.URL(), outputDir, filename, nil, nil, "", nil)
 	if err != nil {
 		t.Fatalf("failed to add download: %v", err)
 	}
@@ -185,7 +193,7 @@ func TestLocalDownloadService_Shutdown_PersistsPausedState(t *testing.T) {
 
 	outputDir := t.TempDir()
 	const filename = "persist.bin"
-	id, err := svc.Add(server.URL(), outputDir, filename, nil, nil)
+	id, err := svc.Add(server.URL(), outputDir, filename, nil, nil, "", nil)
 	if err != nil {
 		t.Fatalf("failed to add download: %v", err)
 	}
@@ -272,11 +280,11 @@ func TestLocalDownloadService_Shutdown_PersistsQueuedState(t *testing.T) {
 	defer server.Close()
 
 	outputDir := t.TempDir()
-	firstID, err := svc.Add(server.URL()+"?id=1", outputDir, "first.bin", nil, nil)
+	firstID, err := svc.Add(server.URL()+"?id=1", outputDir, "first.bin", nil, nil, "", nil)
 	if err != nil {
 		t.Fatalf("failed to add first download: %v", err)
 	}
-	secondID, err := svc.Add(server.URL()+"?id=2", outputDir, "second.bin", nil, nil)
+	secondID, err := svc.Add(server.URL()+"?id=2", outputDir, "second.bin", nil, nil, "", nil)
 	if err != nil {
 		t.Fatalf("failed to add second download: %v", err)
 	}
@@ -362,7 +370,7 @@ func TestLocalDownloadService_BatchProgress(t *testing.T) {
 	defer cleanup()
 
 	// Add download using test server URL
-	_, err = svc.Add(ts.URL, tempDir, "test-file", nil, nil)
+	_, err = svc.Add(ts.URL, tempDir, "test-file", nil, nil, "", nil)
 	if err != nil {
 		t.Fatalf("failed to add download: %v", err)
 	}
@@ -403,7 +411,7 @@ func TestLocalDownloadService_ResumeRejectedWhilePausing(t *testing.T) {
 	defer server.Close()
 
 	outputDir := t.TempDir()
-	id, err := svc.Add(server.URL(), outputDir, "resume-race.bin", nil, nil)
+	id, err := svc.Add(server.URL(), outputDir, "resume-race.bin", nil, nil, "", nil)
 	if err != nil {
 		t.Fatalf("failed to add download: %v", err)
 	}
@@ -432,3 +440,429 @@ func TestLocalDownloadService_ResumeRejectedWhilePausing(t *testing.T) {
 		t.Fatal("expected resume to fail while download is still pausing")
 	}
 }
+
+func TestLocalDownloadService_Add_InvalidChecksum(t *testing.T) {
+	pool := download.NewWorkerPool(nil, 1)
+	svc := NewLocalDownloadService(pool)
+	defer func() { _ = svc.Shutdown() }()
+
+	if _, err := svc.Add("https://example.com/file.bin", t.TempDir(), "file.bin", nil, nil, "sha256:nothex", nil); err == nil {
+		t.Fatal("expected Add to reject an invalid checksum")
+	}
+	if len(pool.GetAll()) != 0 {
+		t.Fatal("download should not be queued when the checksum is invalid")
+	}
+}
+
+func TestLocalDownloadService_Add_SavesPieces(t *testing.T) {
+	tempDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	pool := download.NewWorkerPool(nil, 1)
+	svc := NewLocalDownloadService(pool)
+	defer func() { _ = svc.Shutdown() }()
+
+	pieces := &types.PieceHashes{Algorithm: checksum.SHA256, Length: 1024, Hashes: []string{strings.Repeat("0", 64)}}
+	id, err := svc.Add("http://127.0.0.1:1/file.bin", tempDir, "file.bin", nil, nil, "", &types.AddOptions{Pieces: pieces})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	saved, err := state.LoadPieceHashes(id)
+	if err != nil || saved == nil || saved.Length != 1024 {
+		t.Fatalf("saved pieces = %+v, %v", saved, err)
+	}
+}
+
+func TestLocalDownloadService_Add_VerifiesChecksum(t *testing.T) {
+	const fileSize = 256 * 1024
+	sum := sha256.Sum256(make([]byte, fileSize)) // mock server serves zeros
+	good := "sha256:" + hex.EncodeToString(sum[:])
+	bad := "sha256:" + strings.Repeat("0", 64)
+
+	tests := []struct {
+		name       string
+		checksum   string
+		wantStatus string
+		wantResult string
+	}{
+		{"match", good, "completed", checksum.StatusVerified},
+		{"mismatch", bad, "error", checksum.StatusMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			state.CloseDB()
+			state.Configure(filepath.Join(tempDir, "surge.db"))
+			defer state.CloseDB()
+
+			ch := make(chan interface{}, 100)
+			pool := download.NewWorkerPool(ch, 1)
+			svc := NewLocalDownloadServiceWithInput(pool, ch)
+			defer func() { _ = svc.Shutdown() }()
+
+			streamCh, cleanup, err := svc.StreamEvents(context.Background())
+			if err != nil {
+				t.Fatalf("failed to stream events: %v", err)
+			}
+			defer cleanup()
+
+			server := testutil.NewMockServerT(t, testutil.WithFileSize(fileSize), testutil.WithRangeSupport(true))
+			defer server.Close()
+
+			id, err := svc.Add(server.URL(), tempDir, "verify.bin", nil, nil, tt.checksum, nil)
+			if err != nil {
+				t.Fatalf("failed to add download: %v", err)
+			}
+
+			var verified, failed bool
+			deadline := time.After(10 * time.Second)
+			for !verified && !failed {
+				select {
+				case msg := <-streamCh:
+					switch m := msg.(type) {
+					case events.DownloadVerifiedMsg:
+						if m.DownloadID == id {
+							verified = true
+							if m.Algorithm != checksum.SHA256 {
+								t.Errorf("Algorithm = %q, want sha256", m.Algorithm)
+							}
+						}
+					case events.DownloadErrorMsg:
+						if m.DownloadID == id {
+							failed = true
+							var mismatch *checksum.MismatchError
+							if !errors.As(m.Err, &mismatch) {
+								t.Errorf("expected checksum mismatch error, got %v", m.Err)
+							}
+						}
+					}
+				case <-deadline:
+					t.Fatal("timed out waiting for verification result")
+				}
+			}
+
+			if verified != (tt.wantResult == checksum.StatusVerified) {
+				t.Errorf("verified = %v, want %v", verified, tt.wantResult == checksum.StatusVerified)
+			}
+
+			entry, err := state.GetDownload(id)
+			if err != nil || entry == nil {
+				t.Fatalf("expected persisted entry, err: %v", err)
+			}
+			if entry.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q", entry.Status, tt.wantStatus)
+			}
+			if entry.Checksum != tt.checksum || entry.ChecksumStatus != tt.wantResult {
+				t.Errorf("Checksum = %q (%q), want %q (%q)", entry.Checksum, entry.ChecksumStatus, tt.checksum, tt.wantResult)
+			}
+		})
+	}
+}
+
+func TestLocalDownloadService_Add_ExpandsMetalink(t *testing.T) {
+	tempDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	// Mirrors that don't answer until the test ends keep both downloads in the pool
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+			http.Error(w, "gone", http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	meta := filepath.Join(tempDir, "set.meta4")
+	body := `<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="a.bin"><url>` + server.URL + `/a.bin</url></file>
+  <file name="docs/b.txt"><url>` + server.URL + `/b.txt</url></file>
+</metalink>`
+	if err := os.WriteFile(meta, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := download.NewWorkerPool(nil, 1)
+	svc := NewLocalDownloadService(pool)
+	defer func() {
+		// Fail the probes before the service's channels close
+		close(release)
+		_ = svc.Shutdown()
+	}()
+
+	if _, err := svc.Add(meta, tempDir, "", nil, nil, "sha256:"+strings.Repeat("0", 64), nil); err == nil {
+		t.Fatal("expected a checksum for several files to be rejected")
+	}
+	id, err := svc.Add(meta, tempDir, "", nil, nil, "", nil)
+	if err != nil {
+		t.Fatalf("failed to add metalink: %v", err)
+	}
+
+	urls := make(map[string]string)
+	for _, cfg := range pool.GetAll() {
+		urls[cfg.URL] = cfg.ID
+	}
+	if len(urls) != 2 {
+		t.Fatalf("queued %v, want one download per file", urls)
+	}
+	if urls[meta+"#a.bin"] != id {
+		t.Errorf("first download = %q, want ID %s", urls[meta+"#a.bin"], id)
+	}
+	if _, ok := urls[meta+"#docs%2Fb.txt"]; !ok {
+		t.Errorf("no download for docs/b.txt in %v", urls)
+	}
+}
+
+func TestLocalDownloadService_RunsHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands use a POSIX shell")
+	}
+	tempDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	svc := NewLocalDownloadServiceWithInput(nil, nil)
+	defer func() { _ = svc.Shutdown() }()
+	svc.settings = config.DefaultSettings()
+	svc.settings.Hooks.OnComplete = `echo "done $SURGE_PATH $SURGE_SIZE $SURGE_HASH"`
+	svc.settings.Hooks.OnError = `echo "failed: $SURGE_ERROR"`
+	svc.settings.Categories = []config.Category{{Name: "Video", Hooks: &config.HookSettings{OnComplete: `echo "video hook for $SURGE_FILENAME"`}}}
+
+	for _, id := range []string{"plain", "own", "broken", "video"} {
+		category := ""
+		if id == "video" {
+			category = "Video"
+		}
+		if err := state.AddToMasterList(types.DownloadEntry{
+			ID:       id,
+			URL:      "https://example.com/" + id,
+			DestPath: filepath.Join(tempDir, id+".bin"),
+			Filename: id + ".bin",
+			Status:   "completed",
+			Checksum: "sha256:abcd",
+			Category: category,
+		}); err != nil {
+			t.Fatalf("failed to seed %s: %v", id, err)
+		}
+	}
+	// A download's own hooks replace the configured ones
+	if err := state.SaveDownloadHooks("own", config.HookSettings{OnComplete: `echo "own hook for $SURGE_FILENAME"`}); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = svc.Publish(events.DownloadCompleteMsg{DownloadID: "plain", Filename: "plain.bin", Total: 42})
+	_ = svc.Publish(events.DownloadCompleteMsg{DownloadID: "own", Filename: "own.bin", Total: 1})
+	_ = svc.Publish(events.DownloadErrorMsg{DownloadID: "broken", Filename: "broken.bin", Err: errors.New("connection reset")})
+	_ = svc.Publish(events.DownloadCompleteMsg{DownloadID: "video", Filename: "video.bin", Total: 1})
+
+	want := map[string]string{
+		"plain":  "done " + filepath.Join(tempDir, "plain.bin") + " 42 sha256:abcd",
+		"own":    "own hook for own.bin",
+		"broken": "failed: connection reset",
+		"video":  "video hook for video.bin", // The category's hooks replace the configured ones
+	}
+	for id, output := range want {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			entry, err := state.GetDownload(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.HookOutput == output {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("hook output of %s = %q, want %q", id, entry.HookOutput, output)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+}
+
+func TestLocalDownloadService_Add_Categories(t *testing.T) {
+	tempDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	pool := download.NewWorkerPool(nil, 1)
+	pool.Hold() // Keep the downloads queued
+	svc := NewLocalDownloadService(pool)
+	defer func() { _ = svc.Shutdown() }()
+
+	defaultDir := filepath.Join(tempDir, "downloads")
+	videos := filepath.Join(tempDir, "videos")
+	docs := filepath.Join(tempDir, "docs")
+	svc.settings = config.DefaultSettings()
+	svc.settings.General.DefaultDownloadDir = defaultDir
+	svc.settings.Categories = []config.Category{
+		{Name: "Video", Dir: videos, RateLimit: 1000, Rules: []config.CategoryRule{{Extensions: []string{"mkv"}}}},
+		{Name: "Docs", Dir: docs, Rules: []config.CategoryRule{{Extensions: []string{"pdf"}}}},
+	}
+
+	tests := []struct {
+		name, url, path, category string
+		wantDir, wantCategory     string
+		wantRate                  int64
+	}{
+		{"matched by extension", "http://127.0.0.1:1/movie.mkv", "", "", videos, "Video", 1000},
+		{"default directory asked for", "http://127.0.0.1:1/movie.mkv", defaultDir, "", videos, "Video", 1000},
+		{"own directory kept", "http://127.0.0.1:1/paper.pdf", tempDir, "", tempDir, "Docs", 0},
+		{"chosen category", "http://127.0.0.1:1/movie.mkv", "", "docs", docs, "Docs", 0},
+		{"no match", "http://127.0.0.1:1/tool.exe", "", "", defaultDir, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts *types.AddOptions
+			if tt.category != "" {
+				opts = &types.AddOptions{Category: tt.category}
+			}
+			id, err := svc.Add(tt.url, tt.path, "", nil, nil, "", opts)
+			if err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+			for _, cfg := range pool.GetAll() {
+				if cfg.ID != id {
+					continue
+				}
+				if cfg.OutputPath != tt.wantDir || cfg.Category != tt.wantCategory || cfg.RateLimit != tt.wantRate {
+					t.Errorf("queued in %s as %q limited to %d, want %s as %q limited to %d",
+						cfg.OutputPath, cfg.Category, cfg.RateLimit, tt.wantDir, tt.wantCategory, tt.wantRate)
+				}
+				return
+			}
+			t.Fatal("download not queued")
+		})
+	}
+
+	if _, err := svc.Add("http://127.0.0.1:1/song.mp3", "", "", nil, nil, "", &types.AddOptions{Category: "Music"}); err == nil {
+		t.Error("expected an error for an unknown category")
+	}
+}
+
+func TestLocalDownloadService_Add_SkipsExistingFile(t *testing.T) {
+	tempDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	pool := download.NewWorkerPool(nil, 1)
+	pool.Hold()
+	svc := NewLocalDownloadService(pool)
+	defer func() { _ = svc.Shutdown() }()
+	svc.settings = config.DefaultSettings()
+
+	if err := os.WriteFile(filepath.Join(tempDir, "file.bin"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Renaming, the default, leaves it to the download
+	if _, err := svc.Add("http://127.0.0.1:1/file.bin", tempDir, "file.bin", nil, nil, "", nil); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if got := len(pool.GetAll()); got != 1 {
+		t.Fatalf("expected the download to be queued, got %d", got)
+	}
+
+	id, err := svc.Add("http://127.0.0.1:1/file.bin", tempDir, "file.bin", nil, nil, "", &types.AddOptions{Conflict: config.ConflictSkip})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if got := len(pool.GetAll()); got != 1 {
+		t.Errorf("skipped download was queued")
+	}
+	if status, err := svc.GetStatus(id); err != nil || status.Status != "skipped" {
+		t.Errorf("status = %+v, %v, want skipped", status, err)
+	}
+	if err := svc.Resume(id); err == nil {
+		t.Error("expected resuming a skipped download to fail")
+	}
+
+	if _, err := svc.Add("http://127.0.0.1:1/file.bin", tempDir, "", nil, nil, "", &types.AddOptions{Conflict: "ask"}); err == nil {
+		t.Error("expected an error for an unknown conflict policy")
+	}
+}
+
+func TestLocalDownloadService_ResumeKeepsRequestSettings(t *testing.T) {
+	tempDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	pool := download.NewWorkerPool(nil, 1)
+	pool.Hold()
+	svc := NewLocalDownloadService(pool)
+	svc.settings = config.DefaultSettings()
+
+	headers := map[string]string{"Referer": "https://example.com/", "User-Agent": "custom/1.0"}
+	proxy := "socks5://127.0.0.1:1080"
+	id, err := svc.Add("http://127.0.0.1:1/file.bin", tempDir, "file.bin", nil, headers, "", &types.AddOptions{Proxy: proxy, Conflict: config.ConflictOverwrite})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if cfgs := pool.GetAll(); len(cfgs) != 1 || cfgs[0].Runtime.ProxyURL != proxy {
+		t.Fatalf("queued %+v, want one download through %s", cfgs, proxy)
+	}
+	_ = svc.Shutdown()
+
+	// After a restart the download is only known from the database
+	if err := state.AddToMasterList(types.DownloadEntry{ID: id, URL: "http://127.0.0.1:1/file.bin", DestPath: filepath.Join(tempDir, "file.bin"), Filename: "file.bin", Status: "paused"}); err != nil {
+		t.Fatalf("AddToMasterList failed: %v", err)
+	}
+	pool = download.NewWorkerPool(nil, 1)
+	pool.Hold()
+	svc = NewLocalDownloadService(pool)
+	defer func() { _ = svc.Shutdown() }()
+	svc.settings = config.DefaultSettings()
+
+	if err := svc.Resume(id); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	cfgs := pool.GetAll()
+	if len(cfgs) != 1 {
+		t.Fatalf("expected the download to be queued, got %d", len(cfgs))
+	}
+	if !reflect.DeepEqual(cfgs[0].Headers, headers) || cfgs[0].Runtime.ProxyURL != proxy {
+		t.Errorf("resumed with headers %v through %q, want %v through %q", cfgs[0].Headers, cfgs[0].Runtime.ProxyURL, headers, proxy)
+	}
+	if cfgs[0].Conflict != config.ConflictOverwrite {
+		t.Errorf("resumed with conflict policy %q, want %q", cfgs[0].Conflict, config.ConflictOverwrite)
+	}
+
+	if _, err := svc.Add("http://127.0.0.1:1/other.bin", tempDir, "", nil, nil, "", &types.AddOptions{Proxy: "ftp://proxy"}); err == nil {
+		t.Error("expected an error for an invalid proxy")
+	}
+}
+
+func TestLocalDownloadService_ReloadSettingsAppliesSchedule(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	pool := download.NewWorkerPool(nil, 1)
+	svc := NewLocalDownloadService(pool)
+	defer func() { _ = svc.Shutdown() }()
+	svc.Scheduler = download.NewScheduler(pool, config.ScheduleSettings{})
+
+	settings := config.DefaultSettings()
+	settings.Schedule = config.ScheduleSettings{
+		Enabled:  true,
+		Profiles: []config.ScheduleProfile{{Name: "always", Days: "*", RateLimit: 1024}},
+	}
+	if err := config.SaveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ReloadSettings(); err != nil {
+		t.Fatalf("ReloadSettings failed: %v", err)
+	}
+	if name, _ := svc.Scheduler.ActiveProfile(); name != "always" {
+		t.Errorf("ActiveProfile = %q after reloading, want always", name)
+	}
+	if got := pool.GlobalRateLimit(); got != 1024 {
+		t.Errorf("GlobalRateLimit = %d, want the profile's 1024", got)
+	}
+}
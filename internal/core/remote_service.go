@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/engine/checksum"
 	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/types"
 )
@@ -40,6 +41,10 @@ func NewRemoteDownloadService(baseURL string, token string) *RemoteDownloadServi
 }
 
 func (s *RemoteDownloadService) doRequest(method, path string, body interface{}) (*http.Response, error) {
+	return s.doRequestWith(s.Client, method, path, body)
+}
+
+func (s *RemoteDownloadService) doRequestWith(client *http.Client, method, path string, body interface{}) (*http.Response, error) {
 	var bodyReader io.Reader
 	if body != nil {
 		jsonBody, err := json.Marshal(body)
@@ -59,7 +64,7 @@ func (s *RemoteDownloadService) doRequest(method, path string, body interface{})
 		req.Header.Set("Content-Type", "application/json")
 	}
 
-	resp, err := s.Client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -120,15 +125,37 @@ func (s *RemoteDownloadService) GetStatus(id string) (*types.DownloadStatus, err
 }
 
 // Add queues a new download.
-func (s *RemoteDownloadService) Add(url string, path string, filename string, mirrors []string, headers map[string]string) (string, error) {
+func (s *RemoteDownloadService) Add(url string, path string, filename string, mirrors []string, headers map[string]string, expectedChecksum string, opts *types.AddOptions) (string, error) {
 	req := map[string]interface{}{
 		"url":           url,
 		"path":          path,
 		"filename":      filename,
 		"mirrors":       mirrors,
 		"headers":       headers,
+		"checksum":      expectedChecksum,
 		"skip_approval": true,
 	}
+	if opts != nil && opts.Pieces != nil {
+		req["pieces"] = checksum.FormatPieces(opts.Pieces)
+	}
+	if opts != nil && opts.BatchID != "" {
+		req["batch_id"] = opts.BatchID
+		if opts.BatchName != "" {
+			req["batch_name"] = opts.BatchName
+		}
+	}
+	if opts != nil && opts.Category != "" {
+		req["category"] = opts.Category
+	}
+	if opts != nil && opts.Conflict != "" {
+		req["conflict_policy"] = opts.Conflict
+	}
+	if opts != nil && opts.Hooks != nil {
+		req["hooks"] = opts.Hooks
+	}
+	if opts != nil && opts.Proxy != "" {
+		req["proxy"] = opts.Proxy
+	}
 
 	resp, err := s.doRequest("POST", "/download", req)
 	if err != nil {
@@ -143,6 +170,22 @@ func (s *RemoteDownloadService) Add(url string, path string, filename string, mi
 	return result["id"], nil
 }
 
+// Verify re-hashes the file of a download that isn't running.
+func (s *RemoteDownloadService) Verify(id string) (*types.VerifyResult, error) {
+	// Hashing a large file easily outlasts the usual request timeout
+	resp, err := s.doRequestWith(s.SSEClient, "POST", "/verify?id="+url.QueryEscape(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var result types.VerifyResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // Pause pauses an active download.
 func (s *RemoteDownloadService) Pause(id string) error {
 	resp, err := s.doRequest("POST", "/pause?id="+url.QueryEscape(id), nil)
@@ -184,6 +227,56 @@ func (s *RemoteDownloadService) Delete(id string) error {
 	return nil
 }
 
+// SetRateLimit changes the bandwidth limit of a single download.
+func (s *RemoteDownloadService) SetRateLimit(id string, bytesPerSec int64) error {
+	resp, err := s.doRequest("POST", fmt.Sprintf("/ratelimit?id=%s&limit=%d", url.QueryEscape(id), bytesPerSec), nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return nil
+}
+
+// SetGlobalRateLimit changes the bandwidth limit shared by all downloads.
+func (s *RemoteDownloadService) SetGlobalRateLimit(bytesPerSec int64) error {
+	resp, err := s.doRequest("POST", fmt.Sprintf("/ratelimit?limit=%d", bytesPerSec), nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return nil
+}
+
+// SetMaxDownloads changes how many downloads may run at once.
+func (s *RemoteDownloadService) SetMaxDownloads(n int) error {
+	resp, err := s.doRequest("POST", fmt.Sprintf("/concurrency?max=%d", n), nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return nil
+}
+
+// Move changes the place of a queued download.
+func (s *RemoteDownloadService) Move(id string, to string) error {
+	resp, err := s.doRequest("POST", fmt.Sprintf("/move?id=%s&to=%s", url.QueryEscape(id), url.QueryEscape(to)), nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return nil
+}
+
+// SetPriority changes the queue priority of a download.
+func (s *RemoteDownloadService) SetPriority(id string, priority types.Priority) error {
+	resp, err := s.doRequest("POST", fmt.Sprintf("/priority?id=%s&priority=%s", url.QueryEscape(id), priority), nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return nil
+}
+
 // Shutdown stops the service.
 func (s *RemoteDownloadService) Shutdown() error {
 	s.cancel()
@@ -314,6 +407,42 @@ func (s *RemoteDownloadService) connectSSE(ctx context.Context, ch chan interfac
 				continue
 			}
 			msg = m
+		case "skipped":
+			var m events.DownloadSkippedMsg
+			if err := json.Unmarshal([]byte(jsonData), &m); err != nil {
+				continue
+			}
+			msg = m
+		case "verified":
+			var m events.DownloadVerifiedMsg
+			if err := json.Unmarshal([]byte(jsonData), &m); err != nil {
+				continue
+			}
+			msg = m
+		case "extract_started":
+			var m events.ExtractStartedMsg
+			if err := json.Unmarshal([]byte(jsonData), &m); err != nil {
+				continue
+			}
+			msg = m
+		case "extract_progress":
+			var m events.ExtractProgressMsg
+			if err := json.Unmarshal([]byte(jsonData), &m); err != nil {
+				continue
+			}
+			msg = m
+		case "extracted":
+			var m events.ExtractCompleteMsg
+			if err := json.Unmarshal([]byte(jsonData), &m); err != nil {
+				continue
+			}
+			msg = m
+		case "extract_error":
+			var m events.ExtractErrorMsg
+			if err := json.Unmarshal([]byte(jsonData), &m); err != nil {
+				continue
+			}
+			msg = m
 		case "error":
 			var m events.DownloadErrorMsg
 			if err := json.Unmarshal([]byte(jsonData), &m); err != nil {
@@ -356,6 +485,18 @@ func (s *RemoteDownloadService) connectSSE(ctx context.Context, ch chan interfac
 				continue
 			}
 			msg = m
+		case "schedule":
+			var m events.ScheduleChangedMsg
+			if err := json.Unmarshal([]byte(jsonData), &m); err != nil {
+				continue
+			}
+			msg = m
+		case "queue":
+			var m events.QueueReorderedMsg
+			if err := json.Unmarshal([]byte(jsonData), &m); err != nil {
+				continue
+			}
+			msg = m
 		default:
 			continue
 		}
@@ -0,0 +1,55 @@
+package download
+
+import (
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// fileCategory settles the category of a probed download and applies its
+// connection limit, returning the directory to download into. A download
+// added without a category is matched against the rules again now that its
+// file name and content type are known. If one matches, the download moves
+// to the category's directory when it was going to the default one, and
+// takes the category's rate limit unless it already has a limit.
+func fileCategory(cfg *types.DownloadConfig, source, filename, contentType, outputDir string) string {
+	if cfg.Runtime == nil || len(cfg.Runtime.Categories) == 0 {
+		return outputDir
+	}
+
+	var cat *config.Category
+	if cfg.Category != "" {
+		cat = config.FindCategory(cfg.Runtime.Categories, cfg.Category)
+	} else if !cfg.IsResume {
+		cat = config.MatchCategory(cfg.Runtime.Categories, source, filename, contentType)
+		if cat != nil {
+			utils.Debug("Download %s matched category %s", cfg.ID, cat.Name)
+			cfg.Category = cat.Name
+			outputDir = utils.EnsureAbsPath(cat.Destination(outputDir, cfg.Runtime.DefaultDownloadDir))
+			if cfg.State != nil {
+				cfg.State.SetCategory(cat.Name)
+				if cat.RateLimit > 0 && cfg.State.GetRateLimit() == 0 {
+					cfg.RateLimit = cat.RateLimit
+					cfg.State.SetRateLimit(cat.RateLimit)
+				}
+			}
+		}
+	}
+
+	if cat != nil && cat.MaxConnections > 0 {
+		cfg.Runtime.MaxConnectionsPerHost = cat.MaxConnections
+	}
+	return outputDir
+}
+
+// pathTemplate returns the path template for a download: its category's if
+// it has one, otherwise the configured one
+func pathTemplate(cfg *types.DownloadConfig) string {
+	if cfg.Runtime == nil {
+		return ""
+	}
+	if c := config.FindCategory(cfg.Runtime.Categories, cfg.Category); cfg.Category != "" && c != nil && c.PathTemplate != "" {
+		return c.PathTemplate
+	}
+	return cfg.Runtime.PathTemplate
+}
@@ -0,0 +1,96 @@
+package download_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestTUIDownload_MatchesCategoryAfterProbe(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	// Nothing in the URL gives the file away, only the content type does
+	body := strings.Repeat("frame ", 2000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+	}))
+	defer server.Close()
+
+	downloads := filepath.Join(tmpDir, "downloads")
+	videos := filepath.Join(tmpDir, "videos")
+	for _, dir := range []string{downloads, videos} {
+		_ = os.Mkdir(dir, 0o755)
+	}
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 2,
+		DefaultDownloadDir:    downloads,
+		Categories: []config.Category{
+			{Name: "Video", Dir: videos, Rules: []config.CategoryRule{{MIME: "video/*"}}},
+		},
+	}
+
+	msgs := runDownload(t, server.URL+"/stream", downloads, runtime)
+	var started *events.DownloadStartedMsg
+	for _, msg := range msgs {
+		if m, ok := msg.(events.DownloadStartedMsg); ok {
+			started = &m
+		}
+	}
+	if started == nil {
+		t.Fatal("no DownloadStartedMsg")
+	}
+	if started.Category != "Video" || filepath.Dir(started.DestPath) != videos {
+		t.Errorf("started in %s as %q, want %s as Video", started.DestPath, started.Category, videos)
+	}
+	if got, err := os.ReadFile(started.DestPath); err != nil || string(got) != body {
+		t.Errorf("downloaded file = %d bytes, %v", len(got), err)
+	}
+}
+
+func TestTUIDownload_PathTemplate(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	server := serveFiles(t, map[string][]byte{
+		"notes.txt": []byte(strings.Repeat("note ", 500)),
+		"clip.mp4":  []byte(strings.Repeat("clip ", 500)),
+	})
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 2,
+		PathTemplate:          "{host}/{filename}",
+		Categories: []config.Category{{
+			Name:         "Video",
+			PathTemplate: "{category}/{date:2006}/{name}.{ext}",
+			Rules:        []config.CategoryRule{{Extensions: []string{"mp4"}}},
+		}},
+	}
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"notes.txt", filepath.Join(tmpDir, "127.0.0.1", "notes.txt")},
+		{"clip.mp4", filepath.Join(tmpDir, "Video", time.Now().Format("2006"), "clip.mp4")},
+	}
+	for _, tt := range tests {
+		runDownload(t, server.URL+"/"+tt.file, tmpDir, runtime)
+		if _, err := os.Stat(tt.want); err != nil {
+			t.Errorf("%s not laid out by the template: %v", tt.file, err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine"
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// conflictPolicy returns the conflict policy of a download: its own, the
+// configured one, or renaming
+func conflictPolicy(cfg *types.DownloadConfig) string {
+	if cfg.Conflict != "" {
+		return cfg.Conflict
+	}
+	if cfg.Runtime != nil && cfg.Runtime.ConflictPolicy != "" {
+		return cfg.Runtime.ConflictPolicy
+	}
+	return config.ConflictRename
+}
+
+// resolveConflict picks the path a new download is saved to when a file is
+// already at destPath, or reports that the download is to be skipped.
+// Another download's incomplete file is always avoided by renaming.
+func resolveConflict(ctx context.Context, cfg *types.DownloadConfig, destPath string, probe *engine.ProbeResult) (string, bool, error) {
+	if _, err := os.Stat(destPath + types.IncompleteSuffix); err == nil {
+		path, err := uniqueFilePath(destPath)
+		return path, false, err
+	}
+	info, err := os.Stat(destPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return destPath, false, nil
+	}
+	if err != nil {
+		return destPath, false, err
+	}
+
+	switch policy := conflictPolicy(cfg); policy {
+	case config.ConflictOverwrite:
+		return destPath, false, nil
+	case config.ConflictSkip:
+		return destPath, true, nil
+	case config.ConflictSameSize:
+		if probe.FileSize > 0 && info.Size() == probe.FileSize {
+			return destPath, true, nil
+		}
+	case config.ConflictCompare:
+		return destPath, matchesRemote(ctx, cfg, destPath, info, probe), nil
+	}
+	path, err := uniqueFilePath(destPath)
+	return path, false, err
+}
+
+// matchesRemote reports whether the file at path is the one the server has.
+// The download's checksum decides if it has one, then an ETag that is an MD5
+// digest, as S3 and many static servers send. Without either the sizes are
+// compared.
+func matchesRemote(ctx context.Context, cfg *types.DownloadConfig, path string, info fs.FileInfo, probe *engine.ProbeResult) bool {
+	if cfg.Checksum != "" {
+		status, _ := verifyChecksum(ctx, cfg.Checksum, path)
+		return status == checksum.StatusVerified
+	}
+	if spec, ok := etagDigest(probe.ETag); ok {
+		return checksum.VerifyFile(ctx, path, spec) == nil
+	}
+	return probe.FileSize > 0 && info.Size() == probe.FileSize
+}
+
+// etagDigest reads an ETag that is a plain MD5 digest. Weak ETags are never
+// digests of the content.
+func etagDigest(etag string) (checksum.Spec, bool) {
+	if strings.HasPrefix(etag, "W/") {
+		return checksum.Spec{}, false
+	}
+	spec, err := checksum.Parse(strings.Trim(etag, `"`))
+	if err != nil || spec.Algorithm != checksum.MD5 {
+		return checksum.Spec{}, false
+	}
+	return spec, true
+}
+
+// maxRenameTries is how often settleConflict picks a new name when other
+// files keep taking the one it picked
+const maxRenameTries = 10
+
+// settleConflict finishes a download whose file showed up at destPath while
+// it ran, following its conflict policy. It returns where the download ended
+// up, or that it was dropped in favour of the file already there.
+func settleConflict(ctx context.Context, cfg *types.DownloadConfig, destPath string) (string, bool, error) {
+	workingPath := destPath + types.IncompleteSuffix
+	policy := conflictPolicy(cfg)
+	utils.Debug("File appeared at %s during the download, settling with %s", destPath, policy)
+
+	keep := false
+	switch policy {
+	case config.ConflictSkip:
+		keep = true
+	case config.ConflictSameSize:
+		keep = sameSize(destPath, workingPath)
+	case config.ConflictCompare:
+		same, err := sameContent(ctx, destPath, workingPath)
+		if err != nil {
+			return destPath, false, err
+		}
+		keep = same
+	}
+
+	var err error
+	switch {
+	case keep:
+		err = os.Remove(workingPath)
+	case policy == config.ConflictOverwrite || policy == config.ConflictCompare:
+		err = os.Rename(workingPath, destPath)
+	default:
+		// Another file can take the new name as well before the rename
+		for tries := 0; ; tries++ {
+			if destPath, err = uniqueFilePath(destPath); err != nil {
+				break
+			}
+			if err = utils.RenameNoReplace(workingPath, destPath); !errors.Is(err, fs.ErrExist) || tries == maxRenameTries {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return destPath, false, fmt.Errorf("failed to finalize file: %w", err)
+	}
+	_ = state.DeleteState(cfg.ID, "", "")
+	return destPath, keep, nil
+}
+
+func sameSize(a, b string) bool {
+	ia, errA := os.Stat(a)
+	ib, errB := os.Stat(b)
+	return errA == nil && errB == nil && ia.Size() == ib.Size()
+}
+
+// sameContent compares two files byte by byte
+func sameContent(ctx context.Context, a, b string) (bool, error) {
+	if !sameSize(a, b) {
+		return false, nil
+	}
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = fa.Close() }()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = fb.Close() }()
+
+	bufA, bufB := make([]byte, 64*1024), make([]byte, 64*1024)
+	for {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		n, errA := io.ReadFull(fa, bufA)
+		m, errB := io.ReadFull(fb, bufB)
+		if n != m || !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+// ReportSkipped ends a download that is skipped because its file is already
+// at destPath, recording it as skipped rather than completed
+func ReportSkipped(cfg *types.DownloadConfig, destPath string, total int64) error {
+	filename := filepath.Base(destPath)
+	utils.Debug("Skipping %s: already present at %s", cfg.URL, destPath)
+	if cfg.State != nil {
+		cfg.State.SetFilename(filename)
+		cfg.State.SetDestPath(destPath)
+	}
+
+	if err := state.AddToMasterList(types.DownloadEntry{
+		ID:          cfg.ID,
+		URL:         cfg.URL,
+		URLHash:     state.URLHash(cfg.URL),
+		DestPath:    destPath,
+		Filename:    filename,
+		Status:      "skipped",
+		TotalSize:   total,
+		CompletedAt: time.Now().Unix(),
+		RateLimit:   cfg.RateLimit,
+		Checksum:    cfg.Checksum,
+		BatchID:     cfg.BatchID,
+		Category:    cfg.Category,
+	}); err != nil {
+		utils.Debug("Failed to persist skipped download: %v", err)
+	}
+
+	if cfg.ProgressCh != nil {
+		cfg.ProgressCh <- events.DownloadSkippedMsg{
+			DownloadID: cfg.ID,
+			Filename:   filename,
+			DestPath:   destPath,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package download_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestTUIDownload_SkipsExistingFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	server := serveFiles(t, map[string][]byte{"file.bin": []byte(strings.Repeat("new ", 500))})
+	existing := filepath.Join(tmpDir, "file.bin")
+	if err := os.WriteFile(existing, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := runDownload(t, server.URL+"/file.bin", tmpDir, &types.RuntimeConfig{MaxConnectionsPerHost: 2, ConflictPolicy: config.ConflictSkip})
+	var skipped *events.DownloadSkippedMsg
+	for _, msg := range msgs {
+		switch m := msg.(type) {
+		case events.DownloadSkippedMsg:
+			skipped = &m
+		case events.DownloadStartedMsg, events.DownloadCompleteMsg:
+			t.Errorf("unexpected %T for a skipped download", msg)
+		}
+	}
+	if skipped == nil || skipped.DestPath != existing {
+		t.Fatalf("DownloadSkippedMsg = %+v", skipped)
+	}
+	if got, _ := os.ReadFile(existing); string(got) != "old" {
+		t.Errorf("existing file changed to %d bytes", len(got))
+	}
+	if entry, err := state.GetDownload(skipped.DownloadID); err != nil || entry == nil || entry.Status != "skipped" {
+		t.Errorf("persisted entry = %+v, %v", entry, err)
+	}
+}
+
+func TestTUIDownload_ConflictWhenFinishing(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	// The file shows up while the body is being sent
+	body := strings.Repeat("new ", 500)
+	dest := filepath.Join(tmpDir, "file.bin")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "" || r.Header.Get("Range") == "bytes=0-0" {
+			http.ServeContent(w, r, "file.bin", time.Time{}, strings.NewReader(body))
+			return
+		}
+		_ = os.WriteFile(dest, []byte("old"), 0o644)
+		http.ServeContent(w, r, "file.bin", time.Time{}, strings.NewReader(body))
+	}))
+	defer server.Close()
+
+	runDownload(t, server.URL+"/file.bin", tmpDir, &types.RuntimeConfig{MaxConnectionsPerHost: 1})
+	if got, _ := os.ReadFile(dest); string(got) != "old" {
+		t.Errorf("file that showed up was replaced: %d bytes", len(got))
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmpDir, "file(1).bin")); string(got) != body {
+		t.Errorf("download not renamed: %d bytes", len(got))
+	}
+}
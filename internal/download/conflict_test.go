@@ -0,0 +1,102 @@
+package download
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestResolveConflict(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "file.bin")
+	if err := os.WriteFile(existing, []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	renamed := filepath.Join(dir, "file(1).bin")
+
+	tests := []struct {
+		policy   string
+		probe    engine.ProbeResult
+		checksum string
+		wantPath string
+		wantSkip bool
+	}{
+		{config.ConflictRename, engine.ProbeResult{FileSize: 10}, "", renamed, false},
+		{"", engine.ProbeResult{FileSize: 10}, "", renamed, false},
+		{config.ConflictOverwrite, engine.ProbeResult{FileSize: 10}, "", existing, false},
+		{config.ConflictSkip, engine.ProbeResult{FileSize: 99}, "", existing, true},
+		{config.ConflictSameSize, engine.ProbeResult{FileSize: 10}, "", existing, true},
+		{config.ConflictSameSize, engine.ProbeResult{FileSize: 11}, "", renamed, false},
+		// md5("0123456789")
+		{config.ConflictCompare, engine.ProbeResult{FileSize: 10, ETag: `"781e5e245d69b566979b86e28d23f2c7"`}, "", existing, true},
+		{config.ConflictCompare, engine.ProbeResult{FileSize: 10, ETag: `"00000000000000000000000000000000"`}, "", existing, false},
+		{config.ConflictCompare, engine.ProbeResult{FileSize: 10, ETag: `W/"781e5e245d69b566979b86e28d23f2c7"`}, "", existing, true}, // Weak, so the sizes decide
+		{config.ConflictCompare, engine.ProbeResult{FileSize: 10}, "sha256:84d89877f0d4041efb6bf91a16f0248f2fd573e6af05c19f96bedb9f882f7882", existing, true},
+		{config.ConflictCompare, engine.ProbeResult{FileSize: 10}, "sha256:0000000000000000000000000000000000000000000000000000000000000000", existing, false},
+	}
+	for _, tt := range tests {
+		cfg := &types.DownloadConfig{Conflict: tt.policy, Checksum: tt.checksum, Runtime: &types.RuntimeConfig{}}
+		path, skip, err := resolveConflict(context.Background(), cfg, existing, &tt.probe)
+		if err != nil || path != tt.wantPath || skip != tt.wantSkip {
+			t.Errorf("%q with %+v: got %s, skip %v, %v; want %s, skip %v", tt.policy, tt.probe, path, skip, err, tt.wantPath, tt.wantSkip)
+		}
+	}
+
+	// Another download's incomplete file is never overwritten
+	if err := os.WriteFile(existing+types.IncompleteSuffix, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &types.DownloadConfig{Conflict: config.ConflictOverwrite}
+	if path, skip, err := resolveConflict(context.Background(), cfg, existing, &engine.ProbeResult{}); err != nil || path != renamed || skip {
+		t.Errorf("with an incomplete file: got %s, skip %v, %v", path, skip, err)
+	}
+}
+
+func TestSettleConflict(t *testing.T) {
+	tests := []struct {
+		policy     string
+		downloaded string
+		wantName   string
+		wantSkip   bool
+		wantData   string // Content of the file at wantName
+	}{
+		{config.ConflictRename, "new", "file(1).bin", false, "new"},
+		{config.ConflictOverwrite, "new", "file.bin", false, "new"},
+		{config.ConflictSkip, "new", "file.bin", true, "old"},
+		{config.ConflictSameSize, "new", "file.bin", true, "old"},
+		{config.ConflictSameSize, "newer", "file(1).bin", false, "newer"},
+		{config.ConflictCompare, "old", "file.bin", true, "old"},
+		{config.ConflictCompare, "new", "file.bin", false, "new"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		destPath := filepath.Join(dir, "file.bin")
+		if err := os.WriteFile(destPath, []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(destPath+types.IncompleteSuffix, []byte(tt.downloaded), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := &types.DownloadConfig{ID: "settle", Conflict: tt.policy}
+		path, skip, err := settleConflict(context.Background(), cfg, destPath)
+		if err != nil {
+			t.Errorf("%s: %v", tt.policy, err)
+			continue
+		}
+		if filepath.Base(path) != tt.wantName || skip != tt.wantSkip {
+			t.Errorf("%s with %q: got %s, skip %v; want %s, skip %v", tt.policy, tt.downloaded, filepath.Base(path), skip, tt.wantName, tt.wantSkip)
+		}
+		if got, _ := os.ReadFile(filepath.Join(dir, tt.wantName)); string(got) != tt.wantData {
+			t.Errorf("%s with %q: %s holds %q, want %q", tt.policy, tt.downloaded, tt.wantName, got, tt.wantData)
+		}
+		if _, err := os.Stat(destPath + types.IncompleteSuffix); !os.IsNotExist(err) {
+			t.Errorf("%s: incomplete file left behind", tt.policy)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package download
+
+import (
+	"github.com/surge-downloader/surge/internal/auth"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Credentials holds the stored credentials, cookies and .netrc logins of
+// every download, read again when one of their files changes
+var Credentials = &auth.Cache{}
+
+// AttachCredentials gives runtime the credentials from the store and the
+// cookies and .netrc files its settings name. Files that can't be read are
+// logged and left out.
+func AttachCredentials(runtime *types.RuntimeConfig) {
+	if runtime == nil {
+		return
+	}
+	ring, err := Credentials.Get(auth.Files{
+		Store:   auth.DefaultStore(),
+		Cookies: runtime.CookiesFile,
+		Netrc:   runtime.NetrcFile,
+	})
+	if err != nil {
+		utils.Debug("Failed to load credentials: %v", err)
+	}
+	if ring != nil {
+		runtime.Credentials = ring
+	}
+}
@@ -0,0 +1,62 @@
+package download_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/auth"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestTUIDownload_AppliesCredentials(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpDir, "config"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(tmpDir, "state"))
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	body := bytes.Repeat([]byte("0123456789abcdef"), 6*types.MB/16)
+	var requests, refused atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		user, pass, _ := r.BasicAuth()
+		session, err := r.Cookie("session")
+		if user != "alice" || pass != "s3cret" || err != nil || session.Value != "abc" {
+			refused.Add(1)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+	}))
+	defer server.Close()
+
+	if err := auth.DefaultStore().Add(auth.Credential{Host: server.URL, Username: "alice", Password: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+	cookies := filepath.Join(tmpDir, "cookies.txt")
+	if err := os.WriteFile(cookies, []byte("127.0.0.1\tFALSE\t/\tFALSE\t0\tsession\tabc\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, CookiesFile: cookies}
+	runDownload(t, server.URL+"/private.bin", tmpDir, runtime)
+
+	// The probe and every worker's range requests
+	if requests.Load() < 3 {
+		t.Errorf("only %d requests, expected the file to be fetched in ranges", requests.Load())
+	}
+	if refused.Load() != 0 {
+		t.Errorf("%d of %d requests came without the credentials", refused.Load(), requests.Load())
+	}
+	if got, err := os.ReadFile(filepath.Join(tmpDir, "private.bin")); err != nil || !bytes.Equal(got, body) {
+		t.Errorf("downloaded file = %d bytes, %v", len(got), err)
+	}
+}
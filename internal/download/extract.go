@@ -0,0 +1,127 @@
+package download
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/extract"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// extractProgressInterval limits how often extraction progress is reported
+const extractProgressInterval = 250 * time.Millisecond
+
+// extractArchive unpacks a finished download into a directory next to it
+// when auto-extract is on and the file is a supported archive. A part of a
+// multi-part archive waits until no other part is still downloading, so the
+// last one to finish unpacks the set. Failures are reported as events and
+// leave the download itself complete.
+func extractArchive(ctx context.Context, cfg *types.DownloadConfig, path string) {
+	if cfg.Runtime == nil || !cfg.Runtime.AutoExtract {
+		return
+	}
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return // Multi-file torrents finish as directories
+	}
+
+	archive, err := extract.Detect(path)
+	if archive == nil {
+		return
+	}
+	if pending := pendingPart(cfg.ID, archive, path); pending != "" {
+		utils.Debug("Not extracting %s yet: %s is still downloading", path, pending)
+		return
+	}
+
+	if err == nil {
+		err = unpack(ctx, cfg, archive, filepath.Base(path))
+	}
+	if err != nil && ctx.Err() == nil { // Not when removed or shutting down
+		utils.Debug("Extracting %s failed: %v", path, err)
+		sendEvent(cfg, events.ExtractErrorMsg{DownloadID: cfg.ID, Filename: filepath.Base(path), Error: err.Error()})
+	}
+}
+
+func unpack(ctx context.Context, cfg *types.DownloadConfig, archive *extract.Archive, filename string) error {
+	dest := archive.Destination()
+	sendEvent(cfg, events.ExtractStartedMsg{DownloadID: cfg.ID, Filename: filename, Dir: dest})
+
+	var last time.Time
+	res, err := archive.Extract(ctx, dest, func(done, total int64) {
+		if now := time.Now(); now.Sub(last) >= extractProgressInterval || done == total {
+			last = now
+			sendEvent(cfg, events.ExtractProgressMsg{DownloadID: cfg.ID, Done: done, Total: total})
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	deleted := cfg.Runtime.DeleteAfterExtract
+	if deleted {
+		for _, part := range archive.Parts {
+			if err := os.Remove(part); err != nil {
+				utils.Debug("Removing %s after extracting: %v", part, err)
+				deleted = false
+			}
+		}
+	}
+	sendEvent(cfg, events.ExtractCompleteMsg{
+		DownloadID:     cfg.ID,
+		Filename:       filename,
+		Dir:            dest,
+		Files:          res.Files,
+		Size:           res.Bytes,
+		ArchiveDeleted: deleted,
+	})
+	return nil
+}
+
+func sendEvent(cfg *types.DownloadConfig, msg any) {
+	if cfg.ProgressCh != nil {
+		cfg.ProgressCh <- msg
+	}
+}
+
+// pendingPart returns the name of another part of a multi-part archive that
+// is still downloading, or "" if there is none. Parts are looked for as
+// incomplete files next to path and as unfinished downloads into the same
+// directory.
+func pendingPart(id string, archive *extract.Archive, path string) string {
+	if !archive.MultiPart() {
+		return ""
+	}
+
+	dir := filepath.Dir(path)
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, e := range entries {
+			if name, ok := strings.CutSuffix(e.Name(), types.IncompleteSuffix); ok && archive.Member(name) {
+				return name
+			}
+		}
+	}
+
+	downloads, err := state.ListAllDownloads()
+	if err != nil {
+		return ""
+	}
+	for _, d := range downloads {
+		if d.ID == id || d.Status == "completed" || d.Status == "error" {
+			continue
+		}
+		name := d.Filename
+		if name == "" {
+			name = filepath.Base(d.DestPath)
+		}
+		if filepath.Dir(d.DestPath) == dir && archive.Member(name) {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+package download_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func testZip(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("docs/readme.txt")
+	_, _ = w.Write([]byte(strings.Repeat("surge ", 1000)))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// serveFiles serves each body at "/<name>"
+func serveFiles(t *testing.T, files map[string][]byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func runDownload(t *testing.T, url, dir string, runtime *types.RuntimeConfig) []any {
+	t.Helper()
+	progState := types.NewProgressState("extract-"+filepath.Base(url), 0)
+	progressCh := make(chan any, 1000)
+	cfg := types.DownloadConfig{
+		URL:        url,
+		OutputPath: dir,
+		ID:         progState.ID,
+		ProgressCh: progressCh,
+		State:      progState,
+		Runtime:    runtime,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download.TUIDownload(ctx, &cfg); err != nil {
+		t.Fatalf("TUIDownload failed: %v", err)
+	}
+	close(progressCh)
+
+	var msgs []any
+	for msg := range progressCh {
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func extractEvents(msgs []any) (started *events.ExtractStartedMsg, done *events.ExtractCompleteMsg, failed *events.ExtractErrorMsg) {
+	for _, msg := range msgs {
+		switch m := msg.(type) {
+		case events.ExtractStartedMsg:
+			started = &m
+		case events.ExtractCompleteMsg:
+			done = &m
+		case events.ExtractErrorMsg:
+			failed = &m
+		}
+	}
+	return started, done, failed
+}
+
+func TestTUIDownload_Extract(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	data := testZip(t)
+	server := serveFiles(t, map[string][]byte{"bundle.zip": data})
+
+	// Off by default
+	plain := filepath.Join(tmpDir, "plain")
+	_ = os.Mkdir(plain, 0o755)
+	msgs := runDownload(t, server.URL+"/bundle.zip", plain, &types.RuntimeConfig{MaxConnectionsPerHost: 2})
+	if started, _, _ := extractEvents(msgs); started != nil {
+		t.Error("extracted without auto-extract")
+	}
+	if _, err := os.Stat(filepath.Join(plain, "bundle")); !os.IsNotExist(err) {
+		t.Error("extraction directory created without auto-extract")
+	}
+
+	out := filepath.Join(tmpDir, "out")
+	_ = os.Mkdir(out, 0o755)
+	msgs = runDownload(t, server.URL+"/bundle.zip", out, &types.RuntimeConfig{MaxConnectionsPerHost: 2, AutoExtract: true, DeleteAfterExtract: true})
+	started, done, failed := extractEvents(msgs)
+	if failed != nil {
+		t.Fatalf("extraction failed: %s", failed.Error)
+	}
+	if started == nil || done == nil {
+		t.Fatalf("missing extraction events in %d messages", len(msgs))
+	}
+	if done.Dir != filepath.Join(out, "bundle") || done.Files != 1 || !done.ArchiveDeleted {
+		t.Errorf("ExtractCompleteMsg = %+v", done)
+	}
+	got, err := os.ReadFile(filepath.Join(out, "bundle", "docs", "readme.txt"))
+	if err != nil || string(got) != strings.Repeat("surge ", 1000) {
+		t.Errorf("extracted file = %d bytes, %v", len(got), err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "bundle.zip")); !os.IsNotExist(err) {
+		t.Error("archive kept despite DeleteAfterExtract")
+	}
+}
+
+func TestTUIDownload_ExtractWaitsForParts(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	data := testZip(t)
+	half := len(data) / 2
+	server := serveFiles(t, map[string][]byte{
+		"bundle.zip.001": data[:half],
+		"bundle.zip.002": data[half:],
+	})
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 2, AutoExtract: true}
+
+	// The second part is still downloading when the first one finishes
+	incomplete := filepath.Join(tmpDir, "bundle.zip.002"+types.IncompleteSuffix)
+	if err := os.WriteFile(incomplete, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	msgs := runDownload(t, server.URL+"/bundle.zip.001", tmpDir, runtime)
+	if started, _, failed := extractEvents(msgs); started != nil || failed != nil {
+		t.Fatal("extraction started before all parts were done")
+	}
+	_ = os.Remove(incomplete)
+
+	msgs = runDownload(t, server.URL+"/bundle.zip.002", tmpDir, runtime)
+	_, done, failed := extractEvents(msgs)
+	if failed != nil {
+		t.Fatalf("extraction failed: %s", failed.Error)
+	}
+	if done == nil || done.Files != 1 || done.ArchiveDeleted {
+		t.Fatalf("ExtractCompleteMsg = %+v", done)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "bundle", "docs", "readme.txt")); err != nil {
+		t.Errorf("joined archive not extracted: %v", err)
+	}
+}
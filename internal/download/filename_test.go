@@ -17,7 +17,7 @@ func TestUniqueFilePath_Preservation(t *testing.T) {
 	// Scenario 1: "file (1).txt" comes in, and DOES NOT exist.
 	// Expected: Return "file (1).txt" as is.
 	inputFile := filepath.Join(tmpDir, "file (1).txt")
-	got := uniqueFilePath(inputFile)
+	got := mustUniqueFilePath(t, inputFile)
 	if got != inputFile {
 		t.Errorf("Scenario 1 Failed: Expected '%s', got '%s'. Should preserve unique filename.", inputFile, got)
 	}
@@ -29,7 +29,7 @@ func TestUniqueFilePath_Preservation(t *testing.T) {
 	}
 
 	expectedFile2 := filepath.Join(tmpDir, "file (2).txt")
-	got2 := uniqueFilePath(inputFile)
+	got2 := mustUniqueFilePath(t, inputFile)
 	if got2 != expectedFile2 {
 		t.Errorf("Scenario 2 Failed: Expected '%s', got '%s'. Should increment existing counter.", expectedFile2, got2)
 	}
@@ -41,7 +41,7 @@ func TestUniqueFilePath_Preservation(t *testing.T) {
 	}
 
 	expectedFile3 := filepath.Join(tmpDir, "file (3).txt")
-	got3 := uniqueFilePath(inputFile) // Input is still "file (1).txt"
+	got3 := mustUniqueFilePath(t, inputFile) // Input is still "file (1).txt"
 	if got3 != expectedFile3 {
 		t.Errorf("Scenario 3 Failed: Expected '%s', got '%s'. Should skip to next available.", expectedFile3, got3)
 	}
@@ -69,9 +69,9 @@ func TestUniqueFilePath_WhitespaceParsing(t *testing.T) {
 	}
 
 	// Logic should parse "file (1) " -> clean "file (1)" -> base "file ", counter 2 -> "file (2).txt"
-	// So uniqueFilePath(".../file (1) .txt") -> ".../file (2).txt"
+	// So mustUniqueFilePath(t, ".../file (1) .txt") -> ".../file (2).txt"
 
-	got := uniqueFilePath(spaceFile)
+	got := mustUniqueFilePath(t, spaceFile)
 	expected := filepath.Join(tmpDir, "file (2).txt")
 
 	// Note: "file (2).txt" does NOT exist yet.
@@ -0,0 +1,66 @@
+package download_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func TestTUIDownload_FTP(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	data := bytes.Repeat([]byte("surge over ftp "), 200*1024)
+	server := testutil.NewFTPServerT(t)
+	server.AddFile("pub/release.tar", data, "")
+
+	progressCh := make(chan any, 100)
+	progState := types.NewProgressState("ftp-dl", 0)
+	cfg := types.DownloadConfig{
+		URL:        server.URL("pub/release.tar"),
+		OutputPath: tmpDir,
+		ID:         progState.ID,
+		ProgressCh: progressCh,
+		State:      progState,
+		Runtime:    &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 256 * types.KB},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download.TUIDownload(ctx, &cfg); err != nil {
+		t.Fatalf("TUIDownload failed: %v", err)
+	}
+
+	// The filename comes from the URL path
+	got, err := os.ReadFile(filepath.Join(tmpDir, "release.tar"))
+	if err != nil {
+		t.Fatalf("reading result: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("downloaded %d bytes, want %d matching bytes", len(got), len(data))
+	}
+	if server.PeakConns.Load() < 2 {
+		t.Errorf("expected a segmented download, peak connections = %d", server.PeakConns.Load())
+	}
+
+	var completed bool
+	for len(progressCh) > 0 {
+		if _, ok := (<-progressCh).(events.DownloadCompleteMsg); ok {
+			completed = true
+		}
+	}
+	if !completed {
+		t.Error("expected a DownloadCompleteMsg")
+	}
+}
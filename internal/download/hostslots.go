@@ -0,0 +1,66 @@
+package download
+
+import (
+	"context"
+	"sync"
+)
+
+// HostSemaphore limits open connections per "host:port" across every
+// download in the process, so several downloads from one server share
+// MaxConnectionsPerHost instead of each using it in full.
+type HostSemaphore struct {
+	mu      sync.Mutex
+	used    map[string]int
+	changed chan struct{}
+}
+
+// HostSlots is the process-wide budget used by every probe and downloader
+var HostSlots = NewHostSemaphore()
+
+// NewHostSemaphore creates an empty semaphore
+func NewHostSemaphore() *HostSemaphore {
+	return &HostSemaphore{
+		used:    make(map[string]int),
+		changed: make(chan struct{}),
+	}
+}
+
+// Acquire blocks until fewer than limit slots for host are in use, then takes
+// one. The limit is passed per call so settings changes apply to new requests.
+// A limit of zero or less never blocks.
+func (s *HostSemaphore) Acquire(ctx context.Context, host string, limit int) error {
+	s.mu.Lock()
+	for limit > 0 && s.used[host] >= limit {
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+		s.mu.Lock()
+	}
+	s.used[host]++
+	s.mu.Unlock()
+	return nil
+}
+
+// Release returns a slot taken with Acquire
+func (s *HostSemaphore) Release(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used[host] <= 1 {
+		delete(s.used, host)
+	} else {
+		s.used[host]--
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// InUse returns how many slots for host are currently taken
+func (s *HostSemaphore) InUse(host string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used[host]
+}
@@ -0,0 +1,160 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/backoff"
+	"github.com/surge-downloader/surge/internal/engine/concurrent"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func TestHostSemaphore_BlocksAtLimit(t *testing.T) {
+	s := NewHostSemaphore()
+	ctx := context.Background()
+	const host = "example.com:443"
+
+	for i := 0; i < 2; i++ {
+		if err := s.Acquire(ctx, host, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := s.Acquire(short, host, 2); err == nil {
+		t.Fatal("Acquire exceeded the limit")
+	}
+
+	// Another host has its own budget
+	if err := s.Acquire(short, "other.org:443", 2); err != nil {
+		t.Fatalf("unrelated host blocked: %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- s.Acquire(ctx, host, 2) }()
+
+	select {
+	case <-acquired:
+		t.Fatal("waiter got a slot before any was released")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	s.Release(host)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Release did not wake the waiter")
+	}
+
+	if got := s.InUse(host); got != 2 {
+		t.Errorf("InUse = %d, want 2", got)
+	}
+}
+
+func TestHostSemaphore_LimitChangesApply(t *testing.T) {
+	s := NewHostSemaphore()
+	ctx := context.Background()
+	const host = "example.com:80"
+
+	for i := 0; i < 3; i++ {
+		_ = s.Acquire(ctx, host, 4)
+	}
+
+	// A lower limit from new settings holds back new connections
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := s.Acquire(short, host, 2); err == nil {
+		t.Fatal("Acquire ignored the lowered limit")
+	}
+
+	// No limit never blocks
+	if err := s.Acquire(short, host, 0); err != nil {
+		t.Fatalf("unlimited Acquire blocked: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		s.Release(host)
+	}
+	if got := s.InUse(host); got != 0 {
+		t.Errorf("InUse after releasing everything = %d, want 0", got)
+	}
+}
+
+func TestHostSemaphore_SharedAcrossDownloads(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	fileSize := int64(4 * types.MB)
+
+	// Anything past two connections at once is rejected with a 429
+	server := testutil.NewMockServerT(t,
+		testutil.WithFileSize(fileSize),
+		testutil.WithRangeSupport(true),
+		testutil.WithLatency(20*time.Millisecond),
+		testutil.WithMaxConcurrentRequests(2),
+	)
+	defer server.Close()
+
+	slots := NewHostSemaphore()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			runtime := &types.RuntimeConfig{
+				MaxConnectionsPerHost: 2,
+				MinChunkSize:          64 * types.KB,
+				HostSlots:             slots,
+			}
+			id := fmt.Sprintf("shared-%d", i)
+			d := concurrent.NewConcurrentDownloader(id, nil, types.NewProgressState(id, fileSize), runtime)
+			d.Backoff = backoff.New()
+			destPath := filepath.Join(tmpDir, id+".bin")
+			if err := d.Download(ctx, server.URL(), nil, nil, destPath, fileSize); err != nil {
+				errs <- err
+				return
+			}
+			errs <- testutil.VerifyFileSize(destPath, fileSize)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if failed := server.Stats().FailedRequests; failed != 0 {
+		t.Errorf("server rejected %d requests; downloads exceeded the shared budget", failed)
+	}
+	if got := slots.InUse(types.HostKey(mustParseURL(t, server.URL()))); got != 0 {
+		t.Errorf("%d slots still held after both downloads finished", got)
+	}
+}
+
+func mustParseURL(t *testing.T, rawurl string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -4,17 +4,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/engine"
+	"github.com/surge-downloader/surge/internal/engine/checksum"
 	"github.com/surge-downloader/surge/internal/engine/concurrent"
 	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/ftp"
+	"github.com/surge-downloader/surge/internal/engine/metalink"
+	"github.com/surge-downloader/surge/internal/engine/sftp"
+	"github.com/surge-downloader/surge/internal/engine/stream"
 	"github.com/surge-downloader/surge/internal/engine/single"
 	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/torrent"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
 )
@@ -29,13 +38,18 @@ type ProbeResult struct {
 
 // probeServer has been moved to internal/engine/probe.go
 
+// maxUniqueTries is how many numbered names uniqueFilePath tries
+const maxUniqueTries = 1000
+
+// checksumDiscoveryWait is how long a finished download waits for checksum
+// discovery before completing without a published checksum
+var checksumDiscoveryWait = 10 * time.Second
+
 // uniqueFilePath returns a unique file path by appending (1), (2), etc. if the file exists
-func uniqueFilePath(path string) string {
+func uniqueFilePath(path string) (string, error) {
 	// Check if file exists (both final and incomplete)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		if _, err := os.Stat(path + types.IncompleteSuffix); os.IsNotExist(err) {
-			return path // Neither exists, use original
-		}
+	if free, err := pathFree(path); err != nil || free {
+		return path, err // Neither exists, use original
 	}
 
 	// File exists, generate unique name
@@ -64,31 +78,131 @@ func uniqueFilePath(path string) string {
 		}
 	}
 
-	for i := 0; i < 100; i++ { // Try next 100 numbers
+	for i := 0; i < maxUniqueTries; i++ {
 		candidate := filepath.Join(dir, fmt.Sprintf("%s(%d)%s", base, counter+i, ext))
-		if _, err := os.Stat(candidate); os.IsNotExist(err) {
-			if _, err := os.Stat(candidate + types.IncompleteSuffix); os.IsNotExist(err) {
-				return candidate
-			}
+		free, err := pathFree(candidate)
+		if err != nil {
+			return path, err
+		}
+		if free {
+			return candidate, nil
 		}
 	}
+	return path, fmt.Errorf("no free file name for %s after %d tries", path, maxUniqueTries)
+}
+
+// pathFree reports whether neither a file nor an incomplete download is at
+// path. Errors other than the file not existing, such as a name that is too
+// long or a directory that can't be read, are returned.
+func pathFree(path string) (bool, error) {
+	for _, p := range []string{path, path + types.IncompleteSuffix} {
+		_, err := os.Stat(p)
+		if err == nil {
+			return false, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+	}
+	return true, nil
+}
 
-	// Fallback: just append a large random number or give up (original behavior essentially gave up or made ugly names)
-	// Here we fallback to original behavior of appending if the clean one failed 100 times
-	return path
+// probeSource probes what cfg.URL points at. A metalink is resolved to the
+// file it describes and its mirrors are tried in order of priority; the first
+// to answer becomes the source.
+func probeSource(ctx context.Context, cfg *types.DownloadConfig) (*engine.ProbeResult, *metalink.File, string, error) {
+	if !metalink.IsMetalink(cfg.URL, "") {
+		probe, err := engine.ProbeServer(ctx, cfg.URL, cfg.Filename, cfg.Headers, cfg.Runtime)
+		// Some servers hand out metalinks from URLs that don't look like one
+		if err != nil || !metalink.IsMetalink("", probe.ContentType) {
+			return probe, nil, cfg.URL, err
+		}
+	}
+
+	meta, err := metalink.Resolve(ctx, cfg.URL, cfg.Headers, cfg.Runtime)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	hint := cfg.Filename
+	if hint == "" {
+		hint = path.Base(meta.Name)
+	}
+
+	var probeErr error
+	for _, source := range meta.Sources() {
+		probe, err := engine.ProbeServer(ctx, source, hint, cfg.Headers, cfg.Runtime)
+		if err != nil {
+			utils.Debug("Metalink mirror %s failed: %v", source, err)
+			probeErr = err
+			continue
+		}
+		if meta.Size > 0 && probe.FileSize > 0 && probe.FileSize != meta.Size {
+			probeErr = fmt.Errorf("%s serves %d bytes but the metalink lists %d", source, probe.FileSize, meta.Size)
+			utils.Debug("%v", probeErr)
+			continue
+		}
+		return probe, meta, source, nil
+	}
+	return nil, nil, "", fmt.Errorf("no mirror of %s is reachable: %w", meta.Name, probeErr)
 }
 
 // TUIDownload is the main entry point for TUI downloads
 func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
+	// Share the per-host connection budget with every other download
+	if cfg.Runtime != nil {
+		cfg.Runtime.HostSlots = HostSlots
+	}
+	AttachCredentials(cfg.Runtime)
+
 	// Probe server once to get all metadata
 	utils.Debug("TUIDownload: Probing server... %s", cfg.URL)
-	probe, err := engine.ProbeServer(ctx, cfg.URL, cfg.Filename, cfg.Headers, cfg.Runtime)
+	probe, meta, source, err := probeSource(ctx, cfg)
 	if err != nil {
 		utils.Debug("TUIDownload: Probe failed: %v\n", err)
 		return err
 	}
 	utils.Debug("TUIDownload: Probe success %d", probe.FileSize)
 
+	// A metalink file may sit in a subdirectory and brings its own hash
+	outputDir := cfg.OutputPath
+	if meta != nil {
+		if dir := path.Dir(meta.Name); dir != "." {
+			outputDir = filepath.Join(outputDir, filepath.FromSlash(dir))
+		}
+		if cfg.Checksum == "" && meta.Hash.Algorithm != "" {
+			cfg.Checksum = meta.Hash.String()
+			if cfg.State != nil {
+				cfg.State.SetChecksum(cfg.Checksum)
+			}
+		}
+	}
+
+	// Piece hashes come from the metalink, a manifest given when adding, or
+	// an earlier run of this download
+	pieces := cfg.Pieces
+	if meta != nil && meta.Pieces != nil {
+		pieces = meta.Pieces
+	}
+	if pieces != nil {
+		if err := state.SavePieceHashes(cfg.ID, pieces); err != nil {
+			utils.Debug("Failed to save piece hashes: %v", err)
+		}
+	} else if pieces, err = state.LoadPieceHashes(cfg.ID); err != nil {
+		utils.Debug("Failed to load piece hashes: %v", err)
+	}
+	if pieces != nil && probe.FileSize > 0 && pieces.Count(probe.FileSize) != len(pieces.Hashes) {
+		return fmt.Errorf("%d piece hashes of %d bytes don't fit the %d byte file", len(pieces.Hashes), pieces.Length, probe.FileSize)
+	}
+
+	// Use cfg.Filename if TUI provided one, otherwise use probe.Filename
+	filename := probe.Filename
+	if cfg.Filename != "" {
+		filename = cfg.Filename
+	}
+
+	// The category can pick another directory and connection limit
+	outputDir = fileCategory(cfg, source, filename, probe.ContentType, outputDir)
+
 	// Start download timer (exclude probing time)
 	start := time.Now()
 	defer func() {
@@ -96,45 +210,72 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 	}()
 
 	// Construct proper output path
-	destPath := cfg.OutputPath
+	destPath := outputDir
 
 	// Auto-create output directory if it doesn't exist
-	if _, err := os.Stat(cfg.OutputPath); os.IsNotExist(err) {
-		if mkErr := os.MkdirAll(cfg.OutputPath, 0o755); mkErr != nil {
+	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
+		if mkErr := os.MkdirAll(outputDir, 0o755); mkErr != nil {
 			utils.Debug("Failed to create output directory: %v", mkErr)
 		}
 	}
 
-	if info, err := os.Stat(cfg.OutputPath); err == nil && info.IsDir() {
-		// Use cfg.Filename if TUI provided one, otherwise use probe.Filename
-		filename := probe.Filename
-		if cfg.Filename != "" {
-			filename = cfg.Filename
-		}
-		
-		// If PreserveURLPath is enabled, create subdirectories based on URL path
-		if cfg.Runtime != nil && cfg.Runtime.PreserveURLPath {
-			if urlPath, err := utils.ExtractURLPath(cfg.URL); err == nil && urlPath != "" {
+	if info, err := os.Stat(outputDir); err == nil && info.IsDir() {
+		// A path template decides the layout below the output directory
+		if tmpl := pathTemplate(cfg); tmpl != "" {
+			destPath = filepath.Join(outputDir, filename)
+			vars := utils.PathVars{URL: source, Filename: filename, Category: cfg.Category, Batch: cfg.BatchName, Time: start}
+			if rel, err := utils.RenderPathTemplate(tmpl, vars); err != nil {
+				utils.Debug("Ignoring path template: %v", err)
+			} else if mkErr := os.MkdirAll(filepath.Dir(filepath.Join(outputDir, rel)), 0o755); mkErr != nil {
+				utils.Debug("Failed to create path template directory: %v", mkErr)
+			} else {
+				destPath = filepath.Join(outputDir, rel)
+			}
+		} else if cfg.Runtime != nil && cfg.Runtime.PreserveURLPath {
+			// If PreserveURLPath is enabled, create subdirectories based on URL path
+			if urlPath, err := utils.ExtractURLPath(source); err == nil && urlPath != "" {
 				// Create the full path including URL structure
-				destPath = filepath.Join(cfg.OutputPath, urlPath, filename)
+				destPath = filepath.Join(outputDir, urlPath, filename)
 				// Ensure the directory exists
 				if mkErr := os.MkdirAll(filepath.Dir(destPath), 0o755); mkErr != nil {
 					utils.Debug("Failed to create URL path directory: %v", mkErr)
 					// Fallback to simple path if directory creation fails
-					destPath = filepath.Join(cfg.OutputPath, filename)
+					destPath = filepath.Join(outputDir, filename)
 				}
 			} else {
 				// Fallback to simple path if URL parsing fails
-				destPath = filepath.Join(cfg.OutputPath, filename)
+				destPath = filepath.Join(outputDir, filename)
 			}
 		} else {
-			destPath = filepath.Join(cfg.OutputPath, filename)
+			destPath = filepath.Join(outputDir, filename)
 		}
 	}
 
+	// Look for a published checksum while the download runs
+	var discovered chan string
+	// (checksum files are fetched over HTTP, so FTP and SFTP downloads skip this;
+	// merged streams never match a published file, and torrents carry their own hashes)
+	isStream := stream.IsManifest(source, probe.ContentType)
+	isTorrent := torrent.IsTorrent(source, probe.ContentType)
+	if cfg.Checksum == "" && cfg.Runtime != nil && cfg.Runtime.DiscoverChecksums && !ftp.IsURL(source) && !sftp.IsURL(source) && !isStream && !isTorrent {
+		discoverCtx, cancelDiscover := context.WithCancel(ctx)
+		defer cancelDiscover()
+		discovered = make(chan string, 1)
+		go func() {
+			discovered <- engine.DiscoverChecksum(discoverCtx, source, probe.Filename, cfg.Headers, cfg.Runtime)
+		}()
+	}
+
 	// Local mirrors slice to avoid modifying config (race condition)
 	mirrors := make([]string, len(cfg.Mirrors))
 	copy(mirrors, cfg.Mirrors)
+	if meta != nil {
+		for _, m := range meta.Sources() {
+			if m != source && !slices.Contains(mirrors, m) {
+				mirrors = append(mirrors, m)
+			}
+		}
+	}
 
 	// Check if this is a resume (explicitly marked by TUI)
 	var savedState *types.DownloadState
@@ -172,8 +313,13 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 		destPath = savedState.DestPath
 		utils.Debug("Resuming download, using saved destPath: %s", destPath)
 	} else {
-		// Fresh download without TUI-provided filename: generate unique filename if file already exists
-		destPath = uniqueFilePath(destPath)
+		// Fresh download: the conflict policy decides what happens to a file already there
+		var skip bool
+		if destPath, skip, err = resolveConflict(ctx, cfg, destPath, probe); err != nil {
+			return err
+		} else if skip {
+			return ReportSkipped(cfg, destPath, probe.FileSize)
+		}
 	}
 	finalFilename := filepath.Base(destPath)
 	utils.Debug("Destination path: %s", destPath)
@@ -195,6 +341,7 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 			Filename:   finalFilename,
 			Total:      probe.FileSize,
 			DestPath:   destPath,
+			Category:   cfg.Category,
 			State:      cfg.State,
 		}
 	}
@@ -206,7 +353,38 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 
 	// Choose downloader based on probe results
 	var downloadErr error
-	if probe.SupportsRange && probe.FileSize > 0 {
+	piecesChecked := false // The engine verified every piece as it arrived
+	if ftp.IsURL(source) {
+		// FTP segments over several control connections; mirrors are HTTP only
+		utils.Debug("Using FTP downloader")
+		d := ftp.NewDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+		d.ModTime, d.CanResume = probe.LastModified, probe.SupportsRange
+		downloadErr = d.Download(ctx, source, destPath, probe.FileSize)
+	} else if sftp.IsURL(source) {
+		utils.Debug("Using SFTP downloader")
+		d := sftp.NewDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+		d.ModTime = probe.LastModified
+		downloadErr = d.Download(ctx, source, destPath, probe.FileSize)
+	} else if isStream {
+		// Segments of HLS/DASH streams are fetched in parallel and merged
+		utils.Debug("Using stream downloader")
+		d := stream.NewDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+		d.Headers = cfg.Headers
+		if downloadErr = d.Download(ctx, source, destPath); downloadErr == nil {
+			// The probe only had an estimate
+			probe.FileSize = d.Size
+		}
+	} else if isTorrent {
+		// Pieces come from peers and web seeds and are checked against the torrent's hashes
+		utils.Debug("Using torrent downloader")
+		d := torrent.NewDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+		d.Headers = cfg.Headers
+		if downloadErr = d.Download(ctx, source, destPath); downloadErr == nil {
+			// A magnet link's size is only known once peers sent the info
+			probe.FileSize = d.Size
+		}
+		piecesChecked = true
+	} else if probe.SupportsRange && probe.FileSize > 0 {
 		utils.Debug("Using concurrent downloader")
 
 		// We probe all candidate mirrors (mirrors) to filter out invalid ones
@@ -214,7 +392,7 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 		if len(mirrors) > 0 {
 			utils.Debug("Probing %d mirrors", len(mirrors))
 			// Always check primary + mirrors to ensure we are using the best set
-			allToCheck := append([]string{cfg.URL}, mirrors...)
+			allToCheck := append([]string{source}, mirrors...)
 			valid, errs := engine.ProbeMirrors(ctx, allToCheck, cfg.Runtime)
 
 			// Log errors
@@ -224,7 +402,7 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 
 			// Filter valid mirrors (excluding primary as it is handled separately)
 			for _, v := range valid {
-				if v != cfg.URL {
+				if v != source {
 					activeMirrors = append(activeMirrors, v)
 				}
 			}
@@ -233,14 +411,36 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 
 		d := concurrent.NewConcurrentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
 		d.Headers = cfg.Headers // Forward custom headers from browser extension
+		d.ETag, d.LastModified = probe.ETag, probe.LastModified
+		if meta != nil {
+			// Resume state stays under the metalink, whichever mirror leads
+			d.StateKey = cfg.URL
+		}
+		d.Pieces = pieces
+		piecesChecked = true
 		utils.Debug("Calling Download with mirrors: %v", mirrors)
-		downloadErr = d.Download(ctx, cfg.URL, mirrors, activeMirrors, destPath, probe.FileSize)
+		downloadErr = d.Download(ctx, source, mirrors, activeMirrors, destPath, probe.FileSize)
 	} else {
 		// Fallback to single-threaded downloader
 		utils.Debug("Using single-threaded downloader")
 		d := single.NewSingleDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
 		d.Headers = cfg.Headers // Forward custom headers from browser extension
-		downloadErr = d.Download(ctx, cfg.URL, destPath, probe.FileSize, probe.Filename)
+		downloadErr = d.Download(ctx, source, destPath, probe.FileSize, probe.Filename)
+	}
+
+	// A file that showed up at destPath meanwhile is left to the conflict policy
+	if errors.Is(downloadErr, fs.ErrExist) && !(cfg.State != nil && cfg.State.IsPaused()) {
+		var skip bool
+		if destPath, skip, downloadErr = settleConflict(ctx, cfg, destPath); downloadErr == nil {
+			if skip {
+				return ReportSkipped(cfg, destPath, probe.FileSize)
+			}
+			finalFilename = filepath.Base(destPath)
+			if cfg.State != nil {
+				cfg.State.SetFilename(finalFilename)
+				cfg.State.SetDestPath(destPath)
+			}
+		}
 	}
 
 	// Only send completion if NO error AND not paused
@@ -251,6 +451,33 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 	}
 
 	isPaused := cfg.State != nil && cfg.State.IsPaused()
+
+	// Verify the renamed file before reporting completion
+	var checksumStatus string
+	if downloadErr == nil && !isPaused && discovered != nil {
+		// Completion waits a little for a slow lookup, then goes without
+		wait := time.NewTimer(checksumDiscoveryWait)
+		select {
+		case spec := <-discovered:
+			if spec != "" {
+				cfg.Checksum = spec
+				if cfg.State != nil {
+					cfg.State.SetChecksum(spec)
+				}
+			}
+		case <-wait.C:
+			utils.Debug("TUIDownload: no checksum found within %v", checksumDiscoveryWait)
+		case <-ctx.Done():
+		}
+		wait.Stop()
+	}
+	if downloadErr == nil && !isPaused && pieces != nil && !piecesChecked {
+		downloadErr = verifyPieces(ctx, cfg.ID, destPath, pieces)
+	}
+	if downloadErr == nil && !isPaused && cfg.Checksum != "" {
+		checksumStatus, downloadErr = verifyChecksum(ctx, cfg.Checksum, destPath)
+	}
+
 	if downloadErr == nil && !isPaused {
 		var elapsed time.Duration
 		if cfg.State != nil {
@@ -267,17 +494,22 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 		}
 
 		if err := state.AddToMasterList(types.DownloadEntry{
-			ID:          cfg.ID,
-			URL:         cfg.URL,
-			URLHash:     state.URLHash(cfg.URL),
-			DestPath:    destPath,
-			Filename:    finalFilename,
-			Status:      "completed",
-			TotalSize:   probe.FileSize,
-			Downloaded:  probe.FileSize,
-			CompletedAt: time.Now().Unix(),
-			TimeTaken:   elapsed.Milliseconds(),
-			AvgSpeed:    avgSpeed,
+			ID:             cfg.ID,
+			URL:            cfg.URL,
+			URLHash:        state.URLHash(cfg.URL),
+			DestPath:       destPath,
+			Filename:       finalFilename,
+			Status:         "completed",
+			TotalSize:      probe.FileSize,
+			Downloaded:     probe.FileSize,
+			CompletedAt:    time.Now().Unix(),
+			TimeTaken:      elapsed.Milliseconds(),
+			AvgSpeed:       avgSpeed,
+			RateLimit:      cfg.RateLimit,
+			Checksum:       cfg.Checksum,
+			ChecksumStatus: checksumStatus,
+			BatchID:        cfg.BatchID,
+			Category:       cfg.Category,
 		}); err != nil {
 			utils.Debug("Failed to persist completed download: %v", err)
 		}
@@ -290,7 +522,18 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 				Total:      probe.FileSize,
 				AvgSpeed:   avgSpeed,
 			}
+			if checksumStatus == checksum.StatusVerified {
+				algo, digest, _ := strings.Cut(cfg.Checksum, ":")
+				cfg.ProgressCh <- events.DownloadVerifiedMsg{
+					DownloadID: cfg.ID,
+					Filename:   finalFilename,
+					Algorithm:  algo,
+					Digest:     digest,
+				}
+			}
 		}
+
+		extractArchive(ctx, cfg, destPath)
 	} else if downloadErr != nil && !isPaused {
 		// Verify it's not a cancellation error
 		if errors.Is(downloadErr, context.Canceled) {
@@ -300,14 +543,19 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 
 		// Persist error state
 		if err := state.AddToMasterList(types.DownloadEntry{
-			ID:         cfg.ID,
-			URL:        cfg.URL,
-			URLHash:    state.URLHash(cfg.URL),
-			DestPath:   destPath,
-			Filename:   finalFilename,
-			Status:     "error",
-			TotalSize:  probe.FileSize,
-			Downloaded: cfg.State.Downloaded.Load(),
+			ID:             cfg.ID,
+			URL:            cfg.URL,
+			URLHash:        state.URLHash(cfg.URL),
+			DestPath:       destPath,
+			Filename:       finalFilename,
+			Status:         "error",
+			TotalSize:      probe.FileSize,
+			Downloaded:     cfg.State.Downloaded.Load(),
+			RateLimit:      cfg.RateLimit,
+			Checksum:       cfg.Checksum,
+			ChecksumStatus: checksumStatus,
+			BatchID:        cfg.BatchID,
+			Category:       cfg.Category,
 		}); err != nil {
 			utils.Debug("Failed to persist error state: %v", err)
 		}
@@ -316,6 +564,44 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 	return downloadErr
 }
 
+// verifyChecksum hashes the finished file and compares it with the expected
+// "algo:hex" digest. A mismatch returns checksum.StatusMismatch and an error.
+func verifyChecksum(ctx context.Context, expected string, path string) (string, error) {
+	spec, err := checksum.Parse(expected)
+	if err != nil {
+		return "", fmt.Errorf("invalid checksum: %w", err)
+	}
+
+	utils.Debug("Verifying %s checksum of %s", spec.Algorithm, path)
+	if err := checksum.VerifyFile(ctx, path, spec); err != nil {
+		var mismatch *checksum.MismatchError
+		if errors.As(err, &mismatch) {
+			return checksum.StatusMismatch, fmt.Errorf("verification failed: %w", err)
+		}
+		return "", err
+	}
+	return checksum.StatusVerified, nil
+}
+
+// verifyPieces checks a file downloaded by an engine that doesn't verify
+// pieces itself. Bad pieces are left for "surge verify" to repair.
+func verifyPieces(ctx context.Context, id string, path string, pieces *types.PieceHashes) error {
+	// The probe may not have known the size
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	utils.Debug("Verifying %d pieces of %s", len(pieces.Hashes), path)
+	bad, checked, err := checksum.VerifyPieces(ctx, path, pieces, info.Size(), nil)
+	if err != nil {
+		return err
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("%w: %d of %d pieces don't match, run \"surge verify %s\" to repair them", types.ErrCorruptPiece, len(bad), checked, id)
+	}
+	return nil
+}
+
 // Download is the CLI entry point (non-TUI) - convenience wrapper
 func Download(ctx context.Context, url string, outPath string, progressCh chan<- any, id string) error {
 	cfg := types.DownloadConfig{
@@ -1,19 +1,55 @@
 package download
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/engine"
+	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/testutil"
 )
 
+// mustUniqueFilePath is uniqueFilePath for paths it can't fail on
+func mustUniqueFilePath(t *testing.T, path string) string {
+	t.Helper()
+	got, err := uniqueFilePath(path)
+	if err != nil {
+		t.Fatalf("uniqueFilePath(%s) failed: %v", path, err)
+	}
+	return got
+}
+
+func TestUniqueFilePath_NameTooLong(t *testing.T) {
+	tmpDir := t.TempDir()
+	// The numbered name is one character longer than the longest allowed
+	existing := filepath.Join(tmpDir, strings.Repeat("a", 252)+".x")
+	if err := os.WriteFile(existing, nil, 0o644); err != nil {
+		t.Skipf("file system doesn't allow the name: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := uniqueFilePath(existing)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected an error for a name that can't be numbered")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("uniqueFilePath didn't return")
+	}
+}
+
 func TestUniqueFilePath(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "surge-test-*")
 	if err != nil {
@@ -87,7 +123,7 @@ func TestUniqueFilePath(t *testing.T) {
 				}
 			}()
 
-			got := uniqueFilePath(tt.input)
+			got := mustUniqueFilePath(t, tt.input)
 			if got != tt.want {
 				t.Errorf("uniqueFilePath() = %v, want %v", got, tt.want)
 			}
@@ -108,7 +144,7 @@ func TestUniqueFilePath_NoExtension(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result := uniqueFilePath(existingFile)
+	result := mustUniqueFilePath(t, existingFile)
 	expected := filepath.Join(tmpDir, "README(1)")
 
 	if result != expected {
@@ -129,7 +165,7 @@ func TestUniqueFilePath_MultipleExtensions(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result := uniqueFilePath(existingFile)
+	result := mustUniqueFilePath(t, existingFile)
 	// Should only consider .gz as extension
 	expected := filepath.Join(tmpDir, "archive.tar(1).gz")
 
@@ -153,7 +189,7 @@ func TestUniqueFilePath_IncompleteFileConflict(t *testing.T) {
 
 	// Request the original filename - should conflict with incomplete
 	inputPath := filepath.Join(tmpDir, "download.bin")
-	result := uniqueFilePath(inputPath)
+	result := mustUniqueFilePath(t, inputPath)
 	expected := filepath.Join(tmpDir, "download(1).bin")
 
 	if result != expected {
@@ -179,7 +215,7 @@ func TestUniqueFilePath_BothFileAndIncompleteExist(t *testing.T) {
 	}
 
 	// Request original - should skip both
-	result := uniqueFilePath(originalFile)
+	result := mustUniqueFilePath(t, originalFile)
 	expected := filepath.Join(tmpDir, "video(2).mp4")
 
 	if result != expected {
@@ -202,7 +238,7 @@ func TestUniqueFilePath_HiddenFile(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result := uniqueFilePath(existingFile)
+	result := mustUniqueFilePath(t, existingFile)
 	// Since ".gitignore" has no base name (ext is the full name), result is "(1).gitignore"
 	expected := filepath.Join(tmpDir, "(1).gitignore")
 
@@ -231,7 +267,7 @@ func TestUniqueFilePath_ManyConflicts(t *testing.T) {
 		}
 	}
 
-	result := uniqueFilePath(filepath.Join(tmpDir, "doc.pdf"))
+	result := mustUniqueFilePath(t, filepath.Join(tmpDir, "doc.pdf"))
 	expected := filepath.Join(tmpDir, "doc(11).pdf")
 
 	if result != expected {
@@ -252,7 +288,7 @@ func TestUniqueFilePath_SpecialCharactersInName(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result := uniqueFilePath(existingFile)
+	result := mustUniqueFilePath(t, existingFile)
 	expected := filepath.Join(tmpDir, "file [2024](1).txt")
 
 	if result != expected {
@@ -502,6 +538,144 @@ func TestProbeServer_LargeFile(t *testing.T) {
 	}
 }
 
+func TestDiscoverChecksum_Manifest(t *testing.T) {
+	const digest = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	server := testutil.NewHTTPServerT(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases/SHA256SUMS":
+			_, _ = fmt.Fprintf(w, "%s  other.iso\n%s *image.iso\n", strings.Repeat("0", 64), digest)
+		case "/releases/image.iso.sha256":
+			// Some servers answer missing files with an HTML page
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html>not found</html>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	got := engine.DiscoverChecksum(ctx, server.URL+"/releases/image.iso?token=abc", "", nil, nil)
+	if got != "sha256:"+digest {
+		t.Errorf("DiscoverChecksum = %q, want sha256:%s", got, digest)
+	}
+}
+
+func TestDiscoverChecksum_Sidecar(t *testing.T) {
+	const digest = "d41d8cd98f00b204e9800998ecf8427e"
+	server := testutil.NewHTTPServerT(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file.zip.md5" {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = fmt.Fprintln(w, digest)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	headers := map[string]string{"Authorization": "Bearer secret"}
+	got := engine.DiscoverChecksum(ctx, server.URL+"/file.zip", "", headers, nil)
+	if got != "md5:"+digest {
+		t.Errorf("DiscoverChecksum = %q, want md5:%s", got, digest)
+	}
+}
+
+func TestDiscoverChecksum_NotFound(t *testing.T) {
+	server := testutil.NewHTTPServerT(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/SHA256SUMS" {
+			_, _ = fmt.Fprintf(w, "%s  unrelated.bin\n", strings.Repeat("a", 64))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if got := engine.DiscoverChecksum(ctx, server.URL+"/file.bin", "", nil, nil); got != "" {
+		t.Errorf("DiscoverChecksum = %q, want empty", got)
+	}
+}
+
+func TestDiscoverChecksum_FetchesInParallel(t *testing.T) {
+	const digest = "d41d8cd98f00b204e9800998ecf8427e"
+	server := testutil.NewHTTPServerT(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		if r.URL.Path == "/MD5SUMS" {
+			_, _ = fmt.Fprintf(w, "%s  file.bin\n", digest)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// One after another the candidates would take over 3 seconds
+	start := time.Now()
+	got := engine.DiscoverChecksum(ctx, server.URL+"/file.bin", "", nil, nil)
+	if got != "md5:"+digest {
+		t.Errorf("DiscoverChecksum = %q, want md5:%s", got, digest)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("DiscoverChecksum took %v", elapsed)
+	}
+}
+
+func TestTUIDownload_ChecksumDiscoveryTimesOut(t *testing.T) {
+	state.CloseDB()
+	state.Configure(filepath.Join(t.TempDir(), "surge.db"))
+	defer state.CloseDB()
+
+	defer func(d time.Duration) { checksumDiscoveryWait = d }(checksumDiscoveryWait)
+	checksumDiscoveryWait = 100 * time.Millisecond
+
+	body := []byte(strings.Repeat("surge ", 1000))
+	server := testutil.NewHTTPServerT(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file.bin" {
+			http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(body))
+			return
+		}
+		// Checksum candidates never answer
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	progState := types.NewProgressState("discover-timeout", 0)
+	cfg := types.DownloadConfig{
+		URL:        server.URL + "/file.bin",
+		OutputPath: t.TempDir(),
+		ID:         progState.ID,
+		ProgressCh: make(chan any, 100),
+		State:      progState,
+		Runtime:    &types.RuntimeConfig{MaxConnectionsPerHost: 2, DiscoverChecksums: true},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if err := TUIDownload(ctx, &cfg); err != nil {
+		t.Fatalf("TUIDownload failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("TUIDownload took %v waiting for checksum discovery", elapsed)
+	}
+	if cfg.Checksum != "" {
+		t.Errorf("Checksum = %q, want none", cfg.Checksum)
+	}
+}
+
 func TestProbeResult_Fields(t *testing.T) {
 	pr := &ProbeResult{
 		FileSize:      123456789,
@@ -569,7 +743,7 @@ func TestUniqueFilePath_EmptyFilename(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result := uniqueFilePath(existingFile)
+	result := mustUniqueFilePath(t, existingFile)
 	// Should handle gracefully - behavior depends on implementation
 	if result == "" {
 		t.Error("uniqueFilePath returned empty string")
@@ -595,7 +769,7 @@ func TestUniqueFilePath_LongFilename(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result := uniqueFilePath(existingFile)
+	result := mustUniqueFilePath(t, existingFile)
 	if result == existingFile {
 		t.Error("uniqueFilePath should generate different name for existing file")
 	}
@@ -614,7 +788,7 @@ func TestUniqueFilePath_ParenInMiddle(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result := uniqueFilePath(existingFile)
+	result := mustUniqueFilePath(t, existingFile)
 	// Should add (1) after the name but before extension
 	expected := filepath.Join(tmpDir, "file (copy)(1).txt")
 	if result != expected {
@@ -640,7 +814,7 @@ func TestUniqueFilePath_DeepNestedDirectory(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result := uniqueFilePath(existingFile)
+	result := mustUniqueFilePath(t, existingFile)
 	expected := filepath.Join(deepPath, "file(1).txt")
 	if result != expected {
 		t.Errorf("uniqueFilePath() = %v, want %v", result, expected)
@@ -658,7 +832,7 @@ func BenchmarkUniqueFilePath_NoConflict(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		uniqueFilePath(path)
+		_, _ = uniqueFilePath(path)
 	}
 }
 
@@ -683,6 +857,6 @@ func BenchmarkUniqueFilePath_WithConflict(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		uniqueFilePath(path)
+		_, _ = uniqueFilePath(path)
 	}
 }
@@ -0,0 +1,104 @@
+package download_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func TestTUIDownload_Metalink(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	const pieceLen = 256 * 1024
+	data := make([]byte, 2*1024*1024+1000)
+	for i := range data {
+		data[i] = byte(i % 253)
+	}
+
+	var goodHits atomic.Int64
+	good := testutil.NewHTTPServerT(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		goodHits.Add(1)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer good.Close()
+	down := testutil.NewHTTPServerT(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	var pieces strings.Builder
+	for start := 0; start < len(data); start += pieceLen {
+		sum := sha1.Sum(data[start:min(start+pieceLen, len(data))])
+		fmt.Fprintf(&pieces, "<hash>%x</hash>", sum)
+	}
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="iso/app.bin">
+    <size>%d</size>
+    <hash type="sha-256">%s</hash>
+    <pieces length="%d" type="sha-1">%s</pieces>
+    <url priority="1">%s/app.bin</url>
+    <url priority="2">%s/app.bin</url>
+  </file>
+</metalink>`, len(data), digest, pieceLen, pieces.String(), down.URL, good.URL)
+	meta := filepath.Join(tmpDir, "app.meta4")
+	if err := os.WriteFile(meta, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	progState := types.NewProgressState("metalink-dl", 0)
+	cfg := types.DownloadConfig{
+		URL:        meta,
+		OutputPath: tmpDir,
+		ID:         progState.ID,
+		ProgressCh: make(chan any, 100),
+		State:      progState,
+		Runtime:    &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 512 * 1024},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download.TUIDownload(ctx, &cfg); err != nil {
+		t.Fatalf("TUIDownload failed: %v", err)
+	}
+
+	// The unreachable first mirror is skipped and the name's directory kept
+	got, err := os.ReadFile(filepath.Join(tmpDir, "iso", "app.bin"))
+	if err != nil {
+		t.Fatalf("reading result: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("downloaded %d bytes, want %d matching bytes", len(got), len(data))
+	}
+	if goodHits.Load() == 0 {
+		t.Error("the working mirror was never used")
+	}
+
+	entry, err := state.GetDownload(cfg.ID)
+	if err != nil || entry == nil {
+		t.Fatalf("expected persisted entry, err: %v", err)
+	}
+	if entry.URL != meta || entry.Checksum != "sha256:"+digest || entry.ChecksumStatus != "verified" {
+		t.Errorf("entry = %s %s (%s), want the metalink verified against its hash", entry.URL, entry.Checksum, entry.ChecksumStatus)
+	}
+}
@@ -2,11 +2,17 @@ package download
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
@@ -18,14 +24,35 @@ type activeDownload struct {
 	cancel context.CancelFunc
 }
 
+// Queue moves accepted by WorkerPool.Move besides a 1-based position
+const (
+	MoveTop    = "top"
+	MoveBottom = "bottom"
+	MoveUp     = "up"
+	MoveDown   = "down"
+)
+
+// ErrNotQueued is returned when reordering a download that isn't waiting in the queue
+var ErrNotQueued = errors.New("download is not queued")
+
 type WorkerPool struct {
-	taskChan     chan types.DownloadConfig
 	progressCh   chan<- any
 	downloads    map[string]*activeDownload      // Track active downloads for pause/resume
 	queued       map[string]types.DownloadConfig // Track queued downloads
+	queue        []string                        // Queued download IDs in start order
+	queueChanged chan struct{}                   // Closed and replaced when the queue or hold state changes
 	mu           sync.RWMutex
-	wg           sync.WaitGroup // We use this to wait for all active downloads to pause before exiting the program
-	maxDownloads int
+	persistMu    sync.Mutex         // Serializes writes of the queue order to the state DB
+	wg           sync.WaitGroup     // We use this to wait for all active downloads to pause before exiting the program
+	maxDownloads int                // Downloads allowed to run at once
+	workers      int                // Worker goroutines alive; above maxDownloads while surplus workers finish
+	limiter      *ratelimit.Limiter // Global bandwidth limit shared by every download
+
+	// Bandwidth schedule overrides (see Scheduler)
+	baseRate      int64         // Global limit from settings/API
+	scheduledRate int64         // Limit of the active schedule profile
+	scheduled     bool          // Whether scheduledRate overrides baseRate
+	released      chan struct{} // Closed while workers may start downloads; open while held
 }
 
 func NewWorkerPool(progressCh chan<- any, maxDownloads int) *WorkerPool {
@@ -33,32 +60,330 @@ func NewWorkerPool(progressCh chan<- any, maxDownloads int) *WorkerPool {
 		maxDownloads = 3 // Default to 3 if invalid
 	}
 	pool := &WorkerPool{
-		taskChan:     make(chan types.DownloadConfig, 100), // We make it buffered to avoid blocking add
 		progressCh:   progressCh,
 		downloads:    make(map[string]*activeDownload),
 		queued:       make(map[string]types.DownloadConfig),
+		queueChanged: make(chan struct{}),
 		maxDownloads: maxDownloads,
+		workers:      maxDownloads,
+		limiter:      ratelimit.New(0),
+		released:     make(chan struct{}),
 	}
+	close(pool.released)
 	for i := 0; i < maxDownloads; i++ {
 		go pool.worker()
 	}
 	return pool
 }
 
-// Add adds a new download task to the pool
+// Add queues a download. It is placed after every queued download of the
+// same or higher priority, unless cfg.QueueOrder restores an earlier place.
 func (p *WorkerPool) Add(cfg types.DownloadConfig) {
+	if cfg.QueueOrder == 0 {
+		cfg.QueueOrder = time.Now().UnixNano()
+	}
+	if cfg.State != nil {
+		cfg.State.SetGlobalLimiter(p.limiter)
+		cfg.State.SetRateLimit(cfg.RateLimit)
+		cfg.State.SetChecksum(cfg.Checksum)
+		cfg.State.SetPriority(cfg.Priority, cfg.QueueOrder)
+		cfg.State.SetBatchID(cfg.BatchID)
+		cfg.State.SetCategory(cfg.Category)
+	}
+
 	p.mu.Lock()
 	p.queued[cfg.ID] = cfg
+	p.insertLocked(cfg)
+	p.notifyLocked()
 	p.mu.Unlock()
 
 	if p.progressCh != nil && !cfg.IsResume {
 		p.progressCh <- events.DownloadQueuedMsg{
 			DownloadID: cfg.ID,
 			Filename:   cfg.Filename,
+			BatchID:    cfg.BatchID,
+			BatchName:  cfg.BatchName,
+			Category:   cfg.Category,
+		}
+	}
+}
+
+// insertLocked puts id at its place in the queue by priority and queue order.
+// Caller holds mu and has stored cfg in p.queued.
+func (p *WorkerPool) insertLocked(cfg types.DownloadConfig) {
+	p.removeFromQueueLocked(cfg.ID)
+	i := sort.Search(len(p.queue), func(i int) bool {
+		other := p.queued[p.queue[i]]
+		return types.QueuedBefore(cfg.Priority, cfg.QueueOrder, other.Priority, other.QueueOrder)
+	})
+	p.queue = slices.Insert(p.queue, i, cfg.ID)
+}
+
+// removeFromQueueLocked drops id from the queue order. Caller holds mu.
+func (p *WorkerPool) removeFromQueueLocked(id string) {
+	if i := slices.Index(p.queue, id); i >= 0 {
+		p.queue = slices.Delete(p.queue, i, i+1)
+	}
+}
+
+// notifyLocked wakes workers waiting for the queue. Caller holds mu.
+func (p *WorkerPool) notifyLocked() {
+	if p.queueChanged != nil {
+		close(p.queueChanged)
+	}
+	p.queueChanged = make(chan struct{})
+}
+
+// Queue returns the IDs of queued downloads in the order they will start
+func (p *WorkerPool) Queue() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Clone(p.queue)
+}
+
+// Move changes the place of a queued download. to is MoveTop, MoveBottom,
+// MoveUp, MoveDown or a 1-based position. A download moved past others of a
+// different priority takes on their priority, so higher priorities still
+// start first.
+func (p *WorkerPool) Move(id string, to string) error {
+	p.mu.Lock()
+	cur := slices.Index(p.queue, id)
+	if cur < 0 {
+		p.mu.Unlock()
+		return ErrNotQueued
+	}
+	target, err := queueTarget(cur, len(p.queue), to)
+	if err != nil {
+		p.mu.Unlock()
+		return err
+	}
+
+	p.queue = slices.Delete(p.queue, cur, cur+1)
+	p.queue = slices.Insert(p.queue, target, id)
+
+	cfg := p.queued[id]
+	if target > 0 {
+		cfg.Priority = min(cfg.Priority, p.queued[p.queue[target-1]].Priority)
+	}
+	if target < len(p.queue)-1 {
+		cfg.Priority = max(cfg.Priority, p.queued[p.queue[target+1]].Priority)
+	}
+	p.queued[id] = cfg
+	p.renumberLocked()
+	msg := p.queueMsgLocked()
+	p.notifyLocked()
+	p.mu.Unlock()
+
+	p.persistQueueOrder()
+	if p.progressCh != nil {
+		p.progressCh <- msg
+	}
+	return nil
+}
+
+// MoveSaved changes the place of a paused download among the paused and
+// queued downloads saved in the state DB, which rejoin the queue in that
+// order when resumed. It takes the same destinations as Move.
+func (p *WorkerPool) MoveSaved(id string, to string) error {
+	entries, err := state.ListAllDownloads()
+	if err != nil {
+		return err
+	}
+	var saved []types.DownloadEntry
+	for _, e := range entries {
+		if e.Status == "paused" || e.Status == "queued" {
+			saved = append(saved, e)
+		}
+	}
+	sort.SliceStable(saved, func(i, j int) bool {
+		return types.QueuedBefore(saved[i].Priority, saved[i].QueueOrder, saved[j].Priority, saved[j].QueueOrder)
+	})
+
+	cur := slices.IndexFunc(saved, func(e types.DownloadEntry) bool { return e.ID == id })
+	if cur < 0 {
+		return ErrNotQueued
+	}
+	target, err := queueTarget(cur, len(saved), to)
+	if err != nil {
+		return err
+	}
+
+	entry := saved[cur]
+	saved = slices.Delete(saved, cur, cur+1)
+	saved = slices.Insert(saved, target, entry)
+	if target > 0 {
+		entry.Priority = min(entry.Priority, saved[target-1].Priority)
+	}
+	if target < len(saved)-1 {
+		entry.Priority = max(entry.Priority, saved[target+1].Priority)
+	}
+	saved[target] = entry
+
+	base := saved[0].QueueOrder
+	for _, e := range saved {
+		base = min(base, e.QueueOrder)
+	}
+	for i := range saved {
+		saved[i].QueueOrder = base + int64(i)
+		if err := state.UpdatePriority(saved[i].ID, saved[i].Priority, saved[i].QueueOrder); err != nil {
+			return err
+		}
+	}
+
+	// Paused downloads still held by the pool are queued again from their config
+	p.mu.Lock()
+	for _, e := range saved {
+		if ad, ok := p.downloads[e.ID]; ok && ad != nil {
+			ad.config.Priority = e.Priority
+			ad.config.QueueOrder = e.QueueOrder
+			if ad.config.State != nil {
+				ad.config.State.SetPriority(e.Priority, e.QueueOrder)
+			}
 		}
 	}
+	p.mu.Unlock()
+	return nil
+}
 
-	p.taskChan <- cfg
+// queueTarget resolves a Move destination to a 0-based index
+func queueTarget(cur, n int, to string) (int, error) {
+	var target int
+	switch to {
+	case MoveTop:
+		target = 0
+	case MoveBottom:
+		target = n - 1
+	case MoveUp:
+		target = cur - 1
+	case MoveDown:
+		target = cur + 1
+	default:
+		pos, err := strconv.Atoi(to)
+		if err != nil || pos < 1 {
+			return 0, fmt.Errorf("invalid queue position %q", to)
+		}
+		target = pos - 1
+	}
+	return max(0, min(target, n-1)), nil
+}
+
+// renumberLocked rewrites queue orders to match the current queue. New
+// downloads still sort after every renumbered one since their order is taken
+// from the clock. Caller holds mu and calls persistQueueOrder after releasing
+// it.
+func (p *WorkerPool) renumberLocked() {
+	if len(p.queue) == 0 {
+		return
+	}
+	base := p.queued[p.queue[0]].QueueOrder
+	for _, id := range p.queue {
+		base = min(base, p.queued[id].QueueOrder)
+	}
+	for i, id := range p.queue {
+		cfg := p.queued[id]
+		cfg.QueueOrder = base + int64(i)
+		if cfg.State != nil {
+			cfg.State.SetPriority(cfg.Priority, cfg.QueueOrder)
+		}
+		p.queued[id] = cfg
+	}
+}
+
+// persistQueueOrder writes the priority and queue order of every queued
+// download to the state DB so the order survives a crash. The queue is read
+// after taking persistMu, so the last write always holds the latest order.
+// Downloads that were never saved are skipped; they are written with their
+// order on pause or shutdown.
+func (p *WorkerPool) persistQueueOrder() {
+	p.persistMu.Lock()
+	defer p.persistMu.Unlock()
+
+	p.mu.RLock()
+	queued := make([]types.DownloadConfig, 0, len(p.queue))
+	for _, id := range p.queue {
+		queued = append(queued, p.queued[id])
+	}
+	p.mu.RUnlock()
+
+	for _, cfg := range queued {
+		if err := state.UpdatePriority(cfg.ID, cfg.Priority, cfg.QueueOrder); err != nil {
+			utils.Debug("Queue: failed to persist order of %s: %v", cfg.ID, err)
+		}
+	}
+}
+
+// queueMsgLocked describes the current queue for clients. Caller holds mu.
+func (p *WorkerPool) queueMsgLocked() events.QueueReorderedMsg {
+	msg := events.QueueReorderedMsg{
+		Order:      slices.Clone(p.queue),
+		Priorities: make(map[string]string, len(p.queue)),
+	}
+	for _, id := range p.queue {
+		msg.Priorities[id] = p.queued[id].Priority.String()
+	}
+	return msg
+}
+
+// SetPriority changes the priority of an active or queued download. A queued
+// download moves to the end of its new priority. Returns false if the
+// download is not tracked by the pool.
+func (p *WorkerPool) SetPriority(downloadID string, priority types.Priority) bool {
+	p.mu.Lock()
+	if cfg, ok := p.queued[downloadID]; ok {
+		cfg.Priority = priority
+		cfg.QueueOrder = time.Now().UnixNano()
+		p.queued[downloadID] = cfg
+		p.insertLocked(cfg)
+		p.renumberLocked()
+		msg := p.queueMsgLocked()
+		p.notifyLocked()
+		p.mu.Unlock()
+
+		p.persistQueueOrder()
+		if p.progressCh != nil {
+			p.progressCh <- msg
+		}
+		return true
+	}
+
+	ad, ok := p.downloads[downloadID]
+	if !ok || ad == nil {
+		p.mu.Unlock()
+		return false
+	}
+	ad.config.Priority = priority
+	st, order := ad.config.State, ad.config.QueueOrder
+	p.mu.Unlock()
+
+	// Kept for when the download is paused and queued again
+	if st != nil {
+		st.SetPriority(priority, order)
+	}
+	return true
+}
+
+// SetMaxDownloads changes how many downloads may run at once. Growing starts
+// queued downloads right away. Shrinking lets running downloads finish; their
+// workers exit instead of picking up the next queued download.
+func (p *WorkerPool) SetMaxDownloads(n int) {
+	if n < 1 {
+		n = 1
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxDownloads = n
+	for ; p.workers < n; p.workers++ {
+		go p.worker()
+	}
+	// Idle surplus workers notice the lower limit and exit
+	p.notifyLocked()
+}
+
+// MaxDownloads returns how many downloads may run at once
+func (p *WorkerPool) MaxDownloads() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.maxDownloads
 }
 
 // HasDownload checks if a download with the given URL already exists
@@ -125,17 +450,37 @@ func (p *WorkerPool) GetAll() []types.DownloadConfig {
 		}
 		configs = append(configs, cfg)
 	}
-	for _, cfg := range p.queued {
-		configs = append(configs, cfg)
+	for _, id := range p.queue {
+		configs = append(configs, p.queued[id])
 	}
 	return configs
 }
 
 // Pause pauses a specific download by ID. Returns true if found and pause initiated (or already paused), false otherwise.
+// A download still waiting in the queue leaves the pool and is saved as paused.
 func (p *WorkerPool) Pause(downloadID string) bool {
-	p.mu.RLock()
+	p.mu.Lock()
+	if cfg, queued := p.queued[downloadID]; queued {
+		delete(p.queued, downloadID)
+		p.removeFromQueueLocked(downloadID)
+		p.mu.Unlock()
+
+		if cfg.State != nil {
+			cfg.State.Pause()
+		}
+		if err := state.AddToMasterList(queuedEntry(cfg, "paused")); err != nil {
+			utils.Debug("Pause: failed to persist queued download %s: %v", downloadID, err)
+		}
+		if p.progressCh != nil {
+			p.progressCh <- events.DownloadPausedMsg{
+				DownloadID: downloadID,
+				Filename:   cfg.Filename,
+			}
+		}
+		return true
+	}
 	ad, exists := p.downloads[downloadID]
-	p.mu.RUnlock()
+	p.mu.Unlock()
 
 	if !exists || ad == nil {
 		return false
@@ -166,8 +511,9 @@ func (p *WorkerPool) Pause(downloadID string) bool {
 	return true
 }
 
-// PauseAll pauses all active downloads (for graceful shutdown)
-func (p *WorkerPool) PauseAll() {
+// PauseAll pauses all active downloads (for graceful shutdown).
+// Returns the IDs of the downloads it paused.
+func (p *WorkerPool) PauseAll() []string {
 	p.mu.RLock()
 	ids := make([]string, 0, len(p.downloads)) // This stores the uuids of the downloads to be paused
 	for id, ad := range p.downloads {
@@ -181,11 +527,30 @@ func (p *WorkerPool) PauseAll() {
 	for _, id := range ids {
 		p.Pause(id)
 	}
+	return ids
 }
 
 // Cancel cancels and removes a download by ID
 func (p *WorkerPool) Cancel(downloadID string) {
 	p.mu.Lock()
+	if cfg, queued := p.queued[downloadID]; queued {
+		// Not started yet: just take it out of the queue
+		delete(p.queued, downloadID)
+		p.removeFromQueueLocked(downloadID)
+		p.mu.Unlock()
+
+		if cfg.State != nil {
+			cfg.State.Done.Store(true)
+		}
+		dropSettings(downloadID)
+		if p.progressCh != nil {
+			p.progressCh <- events.DownloadRemovedMsg{
+				DownloadID: downloadID,
+				Filename:   cfg.Filename,
+			}
+		}
+		return
+	}
 	ad, exists := p.downloads[downloadID]
 	if exists {
 		delete(p.downloads, downloadID)
@@ -205,6 +570,7 @@ func (p *WorkerPool) Cancel(downloadID string) {
 	if ad.config.State != nil {
 		ad.config.State.Done.Store(true)
 	}
+	dropSettings(downloadID)
 
 	// Send removal message
 	if p.progressCh != nil {
@@ -215,6 +581,14 @@ func (p *WorkerPool) Cancel(downloadID string) {
 	}
 }
 
+// dropSettings deletes what a cancelled download was added with. Its request
+// settings can hold cookies and logins, which aren't kept for nothing.
+func dropSettings(downloadID string) {
+	if err := state.DeleteDownloadSettings(downloadID); err != nil {
+		utils.Debug("Cancel: failed to delete settings of %s: %v", downloadID, err)
+	}
+}
+
 // Resume resumes a paused download by ID. Returns true if found and resumed (or already running), false otherwise.
 func (p *WorkerPool) Resume(downloadID string) bool {
 	p.mu.RLock()
@@ -266,21 +640,174 @@ func (p *WorkerPool) Resume(downloadID string) bool {
 	return true
 }
 
-func (p *WorkerPool) worker() {
-	for cfg := range p.taskChan {
-		p.wg.Add(1)
-		// Create cancellable context
-		ctx, cancel := context.WithCancel(context.Background())
+// SetGlobalRateLimit changes the bandwidth limit shared by all downloads (bytes/sec, 0 = unlimited).
+// Running downloads pick up the new limit immediately. While a schedule
+// profile is active its limit takes precedence.
+func (p *WorkerPool) SetGlobalRateLimit(bytesPerSec int64) {
+	p.mu.Lock()
+	p.baseRate = bytesPerSec
+	p.applyRateLocked()
+	p.mu.Unlock()
+}
+
+// SetScheduledRateLimit overrides the global limit while a schedule profile
+// is active. Passing active=false restores the limit from SetGlobalRateLimit.
+func (p *WorkerPool) SetScheduledRateLimit(bytesPerSec int64, active bool) {
+	p.mu.Lock()
+	p.scheduledRate = bytesPerSec
+	p.scheduled = active
+	p.applyRateLocked()
+	p.mu.Unlock()
+}
+
+// applyRateLocked pushes the effective global rate to the limiter. Caller holds mu.
+func (p *WorkerPool) applyRateLocked() {
+	if p.scheduled {
+		p.limiter.SetRate(p.scheduledRate)
+		return
+	}
+	p.limiter.SetRate(p.baseRate)
+}
+
+// Hold stops workers from starting queued downloads until Release is called.
+// Downloads that are already running are not affected.
+func (p *WorkerPool) Hold() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.released:
+		p.released = make(chan struct{})
+	default:
+		// Already held
+	}
+}
+
+// Release lets workers start queued downloads again after Hold.
+func (p *WorkerPool) Release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.released:
+		// Not held
+	default:
+		close(p.released)
+		p.notifyLocked()
+	}
+}
+
+// IsHeld reports whether queued downloads are currently held back
+func (p *WorkerPool) IsHeld() bool {
+	p.mu.RLock()
+	ch := p.released
+	p.mu.RUnlock()
+	select {
+	case <-ch:
+		return false
+	default:
+		return true
+	}
+}
+
+// waitReleased blocks until the pool is not held
+func (p *WorkerPool) waitReleased() {
+	for {
+		p.mu.RLock()
+		ch := p.released
+		p.mu.RUnlock()
+		<-ch
 
-		// Register active download
-		ad := &activeDownload{
-			config: cfg,
-			cancel: cancel,
+		// Re-check in case Hold was called between the read and the wake-up
+		if !p.IsHeld() {
+			return
 		}
+	}
+}
+
+// GlobalRateLimit returns the pool-wide bandwidth limit in bytes/sec (0 = unlimited)
+func (p *WorkerPool) GlobalRateLimit() int64 {
+	return p.limiter.Rate()
+}
+
+// SetRateLimit changes the bandwidth limit of a single active or queued download.
+// Returns false if the download is not tracked by the pool.
+func (p *WorkerPool) SetRateLimit(downloadID string, bytesPerSec int64) bool {
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+
+	p.mu.Lock()
+	var st *types.ProgressState
+	if ad, ok := p.downloads[downloadID]; ok && ad != nil {
+		ad.config.RateLimit = bytesPerSec
+		st = ad.config.State
+	} else if cfg, ok := p.queued[downloadID]; ok {
+		cfg.RateLimit = bytesPerSec
+		p.queued[downloadID] = cfg
+		st = cfg.State
+	} else {
+		p.mu.Unlock()
+		return false
+	}
+	p.mu.Unlock()
+
+	// The queued config shares this State, so the limit also
+	// applies once the download is picked up by a worker.
+	if st != nil {
+		st.SetRateLimit(bytesPerSec)
+	}
+	return true
+}
+
+// next blocks until the pool is released and a download is queued, then
+// registers the head of the queue as active and returns it. Returns nil when
+// the calling worker should exit because SetMaxDownloads lowered the limit.
+func (p *WorkerPool) next() (*activeDownload, context.Context) {
+	for {
+		// Queued downloads wait here while a schedule holds the pool
+		p.waitReleased()
+
 		p.mu.Lock()
-		delete(p.queued, cfg.ID)
-		p.downloads[cfg.ID] = ad
+		if p.workers > p.maxDownloads {
+			p.workers--
+			p.mu.Unlock()
+			return nil, nil
+		}
+		held := false
+		select {
+		case <-p.released:
+		default:
+			held = true
+		}
+		if !held && len(p.queue) > 0 {
+			id := p.queue[0]
+			p.queue = p.queue[1:]
+			cfg := p.queued[id]
+			delete(p.queued, id)
+
+			// Create cancellable context
+			ctx, cancel := context.WithCancel(context.Background())
+			ad := &activeDownload{
+				config: cfg,
+				cancel: cancel,
+			}
+			p.downloads[id] = ad
+			p.wg.Add(1)
+			p.mu.Unlock()
+			return ad, ctx
+		}
+		changed := p.queueChanged
 		p.mu.Unlock()
+		<-changed
+	}
+}
+
+func (p *WorkerPool) worker() {
+	for {
+		ad, ctx := p.next()
+		if ad == nil {
+			return
+		}
+		cfg := ad.config
 
 		err := TUIDownload(ctx, &ad.config)
 
@@ -336,6 +863,7 @@ func (p *WorkerPool) GetStatus(id string) *types.DownloadStatus {
 	p.mu.RLock()
 	ad, exists := p.downloads[id]
 	qCfg, qExists := p.queued[id]
+	position := slices.Index(p.queue, id) + 1
 	p.mu.RUnlock()
 
 	if !exists && !qExists {
@@ -355,6 +883,13 @@ func (p *WorkerPool) GetStatus(id string) *types.DownloadStatus {
 			Status:     "queued",
 			Downloaded: 0,
 			TotalSize:  0, // Metadata not yet fetched
+			RateLimit:  qCfg.RateLimit,
+			Checksum:   qCfg.Checksum,
+
+			Priority:      qCfg.Priority.String(),
+			QueuePosition: position,
+			BatchID:       qCfg.BatchID,
+			Category:      qCfg.Category,
 		}
 	}
 
@@ -379,6 +914,11 @@ func (p *WorkerPool) GetStatus(id string) *types.DownloadStatus {
 		TotalSize:  totalSize,
 		Downloaded: downloaded,
 		Status:     "downloading",
+		RateLimit:  state.GetRateLimit(),
+		Checksum:   state.GetChecksum(),
+		Priority:   ad.config.Priority.String(),
+		BatchID:    ad.config.BatchID,
+		Category:   state.GetCategory(),
 	}
 	if dp := state.GetDestPath(); dp != "" {
 		status.DestPath = dp
@@ -461,9 +1001,9 @@ func (p *WorkerPool) GracefulShutdown() {
 
 func (p *WorkerPool) persistQueuedForShutdown() {
 	p.mu.RLock()
-	queued := make([]types.DownloadConfig, 0, len(p.queued))
-	for _, cfg := range p.queued {
-		queued = append(queued, cfg)
+	queued := make([]types.DownloadConfig, 0, len(p.queue))
+	for _, id := range p.queue {
+		queued = append(queued, p.queued[id])
 	}
 	p.mu.RUnlock()
 
@@ -471,33 +1011,43 @@ func (p *WorkerPool) persistQueuedForShutdown() {
 		if cfg.ID == "" || cfg.URL == "" {
 			continue
 		}
+		if err := state.AddToMasterList(queuedEntry(cfg, "queued")); err != nil {
+			utils.Debug("GracefulShutdown: failed to persist queued download %s: %v", cfg.ID, err)
+		}
+	}
+}
 
-		filename := cfg.Filename
-		destPath := cfg.DestPath
-		if cfg.State != nil {
-			if fn := cfg.State.GetFilename(); fn != "" {
-				filename = fn
-			}
-			if dp := cfg.State.GetDestPath(); dp != "" {
-				destPath = dp
-			}
+// queuedEntry builds the master list entry of a download that never started
+func queuedEntry(cfg types.DownloadConfig, status string) types.DownloadEntry {
+	filename := cfg.Filename
+	destPath := cfg.DestPath
+	if cfg.State != nil {
+		if fn := cfg.State.GetFilename(); fn != "" {
+			filename = fn
 		}
-		if destPath == "" && cfg.OutputPath != "" && filename != "" {
-			destPath = filepath.Join(cfg.OutputPath, filename)
+		if dp := cfg.State.GetDestPath(); dp != "" {
+			destPath = dp
 		}
+	}
+	if destPath == "" && cfg.OutputPath != "" && filename != "" {
+		destPath = filepath.Join(cfg.OutputPath, filename)
+	}
 
-		if err := state.AddToMasterList(types.DownloadEntry{
-			ID:         cfg.ID,
-			URL:        cfg.URL,
-			URLHash:    state.URLHash(cfg.URL),
-			DestPath:   destPath,
-			Filename:   filename,
-			Status:     "queued",
-			TotalSize:  0,
-			Downloaded: 0,
-			Mirrors:    cfg.Mirrors,
-		}); err != nil {
-			utils.Debug("GracefulShutdown: failed to persist queued download %s: %v", cfg.ID, err)
-		}
+	return types.DownloadEntry{
+		ID:         cfg.ID,
+		URL:        cfg.URL,
+		URLHash:    state.URLHash(cfg.URL),
+		DestPath:   destPath,
+		Filename:   filename,
+		Status:     status,
+		TotalSize:  0,
+		Downloaded: 0,
+		Mirrors:    cfg.Mirrors,
+		RateLimit:  cfg.RateLimit,
+		Checksum:   cfg.Checksum,
+		Priority:   cfg.Priority,
+		QueueOrder: cfg.QueueOrder,
+		BatchID:    cfg.BatchID,
+		Category:   cfg.Category,
 	}
 }
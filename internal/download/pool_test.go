@@ -2,13 +2,17 @@ package download
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
+	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
 )
 
@@ -20,8 +24,8 @@ func TestNewWorkerPool(t *testing.T) {
 		t.Fatal("Expected non-nil WorkerPool")
 	}
 
-	if pool.taskChan == nil {
-		t.Error("Expected taskChan to be initialized")
+	if pool.queued == nil || pool.queueChanged == nil {
+		t.Error("Expected queue to be initialized")
 	}
 
 	if pool.progressCh != ch {
@@ -556,7 +560,6 @@ func TestWorkerPool_Resume_ClearsPausedFlag(t *testing.T) {
 func TestWorkerPool_Resume_UsesResolvedStatePathAndFilename(t *testing.T) {
 	ch := make(chan any, 10)
 	pool := &WorkerPool{
-		taskChan:   make(chan types.DownloadConfig, 10),
 		progressCh: ch,
 		downloads:  make(map[string]*activeDownload),
 		queued:     make(map[string]types.DownloadConfig),
@@ -597,17 +600,18 @@ func TestWorkerPool_Resume_UsesResolvedStatePathAndFilename(t *testing.T) {
 		t.Fatalf("Filename not propagated from state: got=%q", ad.config.Filename)
 	}
 
-	select {
-	case queued := <-pool.taskChan:
-		if queued.DestPath != "/tmp/final-name.bin" {
-			t.Fatalf("queued DestPath mismatch: got=%q", queued.DestPath)
-		}
-		if queued.Filename != "final-name.bin" {
-			t.Fatalf("queued Filename mismatch: got=%q", queued.Filename)
-		}
-	default:
+	pool.mu.RLock()
+	queued, ok := pool.queued["test-id"]
+	pool.mu.RUnlock()
+	if !ok {
 		t.Fatal("expected resumed config to be queued")
 	}
+	if queued.DestPath != "/tmp/final-name.bin" {
+		t.Fatalf("queued DestPath mismatch: got=%q", queued.DestPath)
+	}
+	if queued.Filename != "final-name.bin" {
+		t.Fatalf("queued Filename mismatch: got=%q", queued.Filename)
+	}
 }
 
 func TestWorkerPool_Resume_SendsResumedMessage(t *testing.T) {
@@ -628,7 +632,7 @@ func TestWorkerPool_Resume_SendsResumedMessage(t *testing.T) {
 
 	pool.Resume("test-id")
 
-	// We can't reliably read from pool.taskChan because worker goroutines may consume the config before us. Just verify the resumed message was sent.
+	// We can't reliably inspect pool.queued because worker goroutines may consume the config before us. Just verify the resumed message was sent.
 	// Check for resumed message
 	select {
 	case msg := <-ch:
@@ -666,7 +670,7 @@ func TestWorkerPool_Resume_RequeuesDownload(t *testing.T) {
 
 	pool.Resume("test-id")
 
-	// Note: We can't reliably read from pool.taskChan because worker goroutines
+	// Note: We can't reliably inspect pool.queued because worker goroutines
 	// may consume the config before us. Instead, verify Resume cleared the paused
 	// flag and sent the resumed message.
 
@@ -900,3 +904,493 @@ func TestWorkerPool_GetStatus_IncludesDestPath(t *testing.T) {
 		t.Fatalf("dest_path = %q, want %q", got.DestPath, destPath)
 	}
 }
+
+func TestWorkerPool_SetGlobalRateLimit(t *testing.T) {
+	pool := NewWorkerPool(nil, 1)
+
+	if got := pool.GlobalRateLimit(); got != 0 {
+		t.Errorf("default GlobalRateLimit = %d, want 0", got)
+	}
+
+	pool.SetGlobalRateLimit(2 * 1024 * 1024)
+	if got := pool.GlobalRateLimit(); got != 2*1024*1024 {
+		t.Errorf("GlobalRateLimit = %d, want %d", got, 2*1024*1024)
+	}
+
+	// Downloads attached to the pool see the global limit
+	state := types.NewProgressState("global-limit", 1000)
+	state.SetGlobalLimiter(pool.limiter)
+	if !state.IsThrottled() {
+		t.Error("expected state to be throttled by the global limit")
+	}
+
+	pool.SetGlobalRateLimit(0)
+	if state.IsThrottled() {
+		t.Error("expected state to be unthrottled after clearing the global limit")
+	}
+}
+
+func TestWorkerPool_SetRateLimit_ActiveDownload(t *testing.T) {
+	pool := NewWorkerPool(nil, 1)
+
+	state := types.NewProgressState("limit-id", 1000)
+	pool.mu.Lock()
+	pool.downloads["limit-id"] = &activeDownload{
+		config: types.DownloadConfig{ID: "limit-id", State: state},
+	}
+	pool.mu.Unlock()
+
+	if !pool.SetRateLimit("limit-id", 512*1024) {
+		t.Fatal("SetRateLimit returned false for active download")
+	}
+	if got := state.GetRateLimit(); got != 512*1024 {
+		t.Errorf("state rate limit = %d, want %d", got, 512*1024)
+	}
+
+	pool.mu.RLock()
+	cfgLimit := pool.downloads["limit-id"].config.RateLimit
+	pool.mu.RUnlock()
+	if cfgLimit != 512*1024 {
+		t.Errorf("config RateLimit = %d, want %d", cfgLimit, 512*1024)
+	}
+
+	if status := pool.GetStatus("limit-id"); status == nil || status.RateLimit != 512*1024 {
+		t.Errorf("GetStatus RateLimit mismatch: %+v", status)
+	}
+}
+
+func TestWorkerPool_SetRateLimit_Unknown(t *testing.T) {
+	pool := NewWorkerPool(nil, 1)
+	if pool.SetRateLimit("missing", 1024) {
+		t.Error("SetRateLimit should return false for unknown download")
+	}
+}
+
+func TestWorkerPool_Add_AppliesRateLimit(t *testing.T) {
+	// Build the pool without workers so the download stays queued
+	pool := &WorkerPool{
+		downloads: make(map[string]*activeDownload),
+		queued:    make(map[string]types.DownloadConfig),
+		limiter:   ratelimit.New(0),
+	}
+	state := types.NewProgressState("queued-limit", 0)
+
+	pool.Add(types.DownloadConfig{ID: "queued-limit", URL: "http://example.com/a", State: state, RateLimit: 256 * 1024})
+
+	if got := state.GetRateLimit(); got != 256*1024 {
+		t.Errorf("state rate limit = %d, want %d", got, 256*1024)
+	}
+	if status := pool.GetStatus("queued-limit"); status == nil || status.RateLimit != 256*1024 {
+		t.Errorf("queued GetStatus RateLimit mismatch: %+v", status)
+	}
+}
+
+// newQueueOnlyPool builds a pool without workers so downloads stay queued
+func newQueueOnlyPool() *WorkerPool {
+	pool := &WorkerPool{
+		downloads: make(map[string]*activeDownload),
+		queued:    make(map[string]types.DownloadConfig),
+		limiter:   ratelimit.New(0),
+		released:  make(chan struct{}),
+	}
+	close(pool.released)
+	return pool
+}
+
+func TestWorkerPool_Queue_OrdersByPriority(t *testing.T) {
+	pool := newQueueOnlyPool()
+	pool.Add(types.DownloadConfig{ID: "n1", URL: "http://example.com/1"})
+	pool.Add(types.DownloadConfig{ID: "l1", URL: "http://example.com/2", Priority: types.PriorityLow})
+	pool.Add(types.DownloadConfig{ID: "h1", URL: "http://example.com/3", Priority: types.PriorityHigh})
+	pool.Add(types.DownloadConfig{ID: "n2", URL: "http://example.com/4"})
+
+	want := []string{"h1", "n1", "n2", "l1"}
+	if got := pool.Queue(); !slices.Equal(got, want) {
+		t.Fatalf("Queue() = %v, want %v", got, want)
+	}
+
+	// GetAll reports queued downloads in start order
+	var ids []string
+	for _, cfg := range pool.GetAll() {
+		ids = append(ids, cfg.ID)
+	}
+	if !slices.Equal(ids, want) {
+		t.Errorf("GetAll() order = %v, want %v", ids, want)
+	}
+
+	if status := pool.GetStatus("n2"); status == nil || status.QueuePosition != 3 || status.Priority != "normal" {
+		t.Errorf("GetStatus(n2) = %+v, want position 3, normal", status)
+	}
+}
+
+func TestWorkerPool_Queue_RestoresQueueOrder(t *testing.T) {
+	pool := newQueueOnlyPool()
+	pool.Add(types.DownloadConfig{ID: "new", URL: "http://example.com/new"})
+	pool.Add(types.DownloadConfig{ID: "restored", URL: "http://example.com/old", QueueOrder: 1})
+
+	if got := pool.Queue(); got[0] != "restored" {
+		t.Errorf("Queue() = %v, want restored download first", got)
+	}
+}
+
+func TestWorkerPool_Move(t *testing.T) {
+	ch := make(chan any, 10)
+	pool := newQueueOnlyPool()
+	for _, id := range []string{"a", "b", "c", "d"} {
+		pool.Add(types.DownloadConfig{ID: id, URL: "http://example.com/" + id, IsResume: true})
+	}
+	pool.progressCh = ch
+
+	steps := []struct {
+		id, to string
+		want   []string
+	}{
+		{"d", MoveTop, []string{"d", "a", "b", "c"}},
+		{"d", MoveDown, []string{"a", "d", "b", "c"}},
+		{"b", MoveUp, []string{"a", "b", "d", "c"}},
+		{"a", MoveBottom, []string{"b", "d", "c", "a"}},
+		{"c", "1", []string{"c", "b", "d", "a"}},
+		{"b", "99", []string{"c", "d", "a", "b"}},
+		{"c", MoveUp, []string{"c", "d", "a", "b"}},
+	}
+	for _, s := range steps {
+		if err := pool.Move(s.id, s.to); err != nil {
+			t.Fatalf("Move(%s, %s): %v", s.id, s.to, err)
+		}
+		if got := pool.Queue(); !slices.Equal(got, s.want) {
+			t.Fatalf("after Move(%s, %s) queue = %v, want %v", s.id, s.to, got, s.want)
+		}
+	}
+
+	// Queue orders follow the new order, so it survives a re-sort
+	cfgs := pool.GetAll()
+	for i := 1; i < len(cfgs); i++ {
+		if cfgs[i].QueueOrder <= cfgs[i-1].QueueOrder {
+			t.Errorf("queue order not increasing at %d: %d <= %d", i, cfgs[i].QueueOrder, cfgs[i-1].QueueOrder)
+		}
+	}
+
+	select {
+	case msg := <-ch:
+		if _, ok := msg.(events.QueueReorderedMsg); !ok {
+			t.Errorf("expected QueueReorderedMsg, got %T", msg)
+		}
+	default:
+		t.Error("Move did not report the new order")
+	}
+}
+
+func TestWorkerPool_Move_Errors(t *testing.T) {
+	pool := newQueueOnlyPool()
+	pool.Add(types.DownloadConfig{ID: "a", URL: "http://example.com/a"})
+	pool.downloads["active"] = &activeDownload{config: types.DownloadConfig{ID: "active"}}
+
+	if err := pool.Move("missing", MoveTop); !errors.Is(err, ErrNotQueued) {
+		t.Errorf("Move(missing) = %v, want ErrNotQueued", err)
+	}
+	if err := pool.Move("active", MoveTop); !errors.Is(err, ErrNotQueued) {
+		t.Errorf("Move(active) = %v, want ErrNotQueued", err)
+	}
+	for _, to := range []string{"", "0", "sideways"} {
+		if err := pool.Move("a", to); err == nil {
+			t.Errorf("Move(a, %q) should fail", to)
+		}
+	}
+}
+
+func TestWorkerPool_Move_AdoptsNeighbourPriority(t *testing.T) {
+	pool := newQueueOnlyPool()
+	state := types.NewProgressState("low", 0)
+	pool.Add(types.DownloadConfig{ID: "high", URL: "http://example.com/h", Priority: types.PriorityHigh})
+	pool.Add(types.DownloadConfig{ID: "normal", URL: "http://example.com/n"})
+	pool.Add(types.DownloadConfig{ID: "low", URL: "http://example.com/l", Priority: types.PriorityLow, State: state})
+
+	if err := pool.Move("low", MoveTop); err != nil {
+		t.Fatal(err)
+	}
+	if got := pool.GetStatus("low"); got.Priority != "high" {
+		t.Errorf("priority after moving to the top = %q, want high", got.Priority)
+	}
+	if p, _ := state.GetPriority(); p != types.PriorityHigh {
+		t.Errorf("state priority = %v, want high", p)
+	}
+
+	if err := pool.Move("low", MoveBottom); err != nil {
+		t.Fatal(err)
+	}
+	if got := pool.GetStatus("low"); got.Priority != "normal" {
+		t.Errorf("priority after moving to the bottom = %q, want normal", got.Priority)
+	}
+}
+
+func TestWorkerPool_Move_PersistsOrder(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "surge.db")
+	state.CloseDB()
+	state.Configure(dbPath)
+	defer state.CloseDB()
+
+	// Downloads restored from the DB after a restart
+	pool := newQueueOnlyPool()
+	for i, id := range []string{"a", "b", "c"} {
+		cfg := types.DownloadConfig{ID: id, URL: "http://example.com/" + id, QueueOrder: int64(i + 1), IsResume: true}
+		if err := state.AddToMasterList(queuedEntry(cfg, "queued")); err != nil {
+			t.Fatal(err)
+		}
+		pool.Add(cfg)
+	}
+
+	if err := pool.Move("c", MoveTop); err != nil {
+		t.Fatal(err)
+	}
+	if !pool.SetPriority("b", types.PriorityHigh) {
+		t.Fatal("SetPriority failed for a queued download")
+	}
+
+	// Reopen without a graceful shutdown
+	state.CloseDB()
+	state.Configure(dbPath)
+
+	if got, want := savedOrder(t), []string{"b", "c", "a"}; !slices.Equal(got, want) {
+		t.Errorf("saved order after reopening = %v, want %v", got, want)
+	}
+}
+
+func TestWorkerPool_MoveSaved(t *testing.T) {
+	state.CloseDB()
+	state.Configure(filepath.Join(t.TempDir(), "surge.db"))
+	defer state.CloseDB()
+
+	for i, id := range []string{"a", "b", "c"} {
+		cfg := types.DownloadConfig{ID: id, URL: "http://example.com/" + id, QueueOrder: int64(i + 1)}
+		if id == "a" {
+			cfg.Priority = types.PriorityHigh
+		}
+		if err := state.AddToMasterList(queuedEntry(cfg, "paused")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := types.DownloadEntry{ID: "done", URL: "http://example.com/done", Status: "completed"}
+	if err := state.AddToMasterList(done); err != nil {
+		t.Fatal(err)
+	}
+
+	// A paused download the pool still holds picks up its new place too
+	progress := types.NewProgressState("c", 0)
+	pool := newQueueOnlyPool()
+	pool.downloads["c"] = &activeDownload{config: types.DownloadConfig{ID: "c", State: progress}}
+
+	if err := pool.MoveSaved("c", MoveTop); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := savedOrder(t), []string{"c", "a", "b"}; !slices.Equal(got, want) {
+		t.Errorf("saved order = %v, want %v", got, want)
+	}
+	if p, _ := progress.GetPriority(); p != types.PriorityHigh {
+		t.Errorf("pool state priority = %v, want high", p)
+	}
+
+	if err := pool.MoveSaved("done", MoveTop); !errors.Is(err, ErrNotQueued) {
+		t.Errorf("MoveSaved(done) = %v, want ErrNotQueued", err)
+	}
+}
+
+// savedOrder returns the IDs of paused and queued downloads in the state DB
+// in the order they rejoin the queue
+func savedOrder(t *testing.T) []string {
+	t.Helper()
+	entries, err := state.ListAllDownloads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortStableFunc(entries, func(a, b types.DownloadEntry) int {
+		if types.QueuedBefore(a.Priority, a.QueueOrder, b.Priority, b.QueueOrder) {
+			return -1
+		}
+		if types.QueuedBefore(b.Priority, b.QueueOrder, a.Priority, a.QueueOrder) {
+			return 1
+		}
+		return 0
+	})
+	var ids []string
+	for _, e := range entries {
+		if e.Status == "paused" || e.Status == "queued" {
+			ids = append(ids, e.ID)
+		}
+	}
+	return ids
+}
+
+func TestWorkerPool_SetPriority(t *testing.T) {
+	pool := newQueueOnlyPool()
+	pool.Add(types.DownloadConfig{ID: "a", URL: "http://example.com/a"})
+	pool.Add(types.DownloadConfig{ID: "b", URL: "http://example.com/b"})
+	pool.Add(types.DownloadConfig{ID: "c", URL: "http://example.com/c", Priority: types.PriorityHigh})
+
+	if !pool.SetPriority("b", types.PriorityHigh) {
+		t.Fatal("SetPriority failed for a queued download")
+	}
+	// Goes to the end of its new priority
+	want := []string{"c", "b", "a"}
+	if got := pool.Queue(); !slices.Equal(got, want) {
+		t.Errorf("Queue() = %v, want %v", got, want)
+	}
+
+	state := types.NewProgressState("active", 0)
+	pool.downloads["active"] = &activeDownload{config: types.DownloadConfig{ID: "active", State: state}}
+	if !pool.SetPriority("active", types.PriorityLow) {
+		t.Fatal("SetPriority failed for an active download")
+	}
+	if p, _ := state.GetPriority(); p != types.PriorityLow {
+		t.Errorf("active state priority = %v, want low", p)
+	}
+
+	if pool.SetPriority("missing", types.PriorityHigh) {
+		t.Error("SetPriority should return false for unknown download")
+	}
+}
+
+func TestWorkerPool_Cancel_RemovesQueued(t *testing.T) {
+	pool := newQueueOnlyPool()
+	pool.Add(types.DownloadConfig{ID: "a", URL: "http://example.com/a"})
+	pool.Add(types.DownloadConfig{ID: "b", URL: "http://example.com/b"})
+
+	pool.Cancel("a")
+
+	if got := pool.Queue(); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("Queue() after cancel = %v, want [b]", got)
+	}
+	if pool.GetStatus("a") != nil {
+		t.Error("cancelled download still reported")
+	}
+}
+
+func TestWorkerPool_Cancel_DeletesSettings(t *testing.T) {
+	state.CloseDB()
+	state.Configure(filepath.Join(t.TempDir(), "surge.db"))
+	defer state.CloseDB()
+
+	pool := newQueueOnlyPool()
+	pool.Add(types.DownloadConfig{ID: "a", URL: "http://example.com/a", Headers: map[string]string{"Cookie": "session=abc"}})
+	if err := state.SaveRequestSettings("a", types.RequestSettings{Headers: map[string]string{"Cookie": "session=abc"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	pool.Cancel("a")
+
+	if s, err := state.LoadRequestSettings("a"); err != nil || s != nil {
+		t.Errorf("request settings after cancel = %+v, %v; want none", s, err)
+	}
+}
+
+func TestWorkerPool_Pause_Queued(t *testing.T) {
+	state.CloseDB()
+	state.Configure(filepath.Join(t.TempDir(), "surge.db"))
+	defer state.CloseDB()
+
+	pool := newQueueOnlyPool()
+	pool.Add(types.DownloadConfig{ID: "a", URL: "http://example.com/a", OutputPath: "/tmp", Filename: "a.bin", BatchID: "batch"})
+	pool.Add(types.DownloadConfig{ID: "b", URL: "http://example.com/b"})
+
+	if !pool.Pause("a") {
+		t.Fatal("Pause should find a queued download")
+	}
+	if got := pool.Queue(); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("Queue() after pause = %v, want [b]", got)
+	}
+	entry, err := state.GetDownload("a")
+	if err != nil || entry == nil {
+		t.Fatalf("paused download not saved: %v", err)
+	}
+	if entry.Status != "paused" || entry.BatchID != "batch" || entry.DestPath != filepath.Join("/tmp", "a.bin") {
+		t.Errorf("saved entry = %+v", entry)
+	}
+}
+
+func TestWorkerPool_Next_StartsHighestPriority(t *testing.T) {
+	pool := newQueueOnlyPool()
+	pool.Add(types.DownloadConfig{ID: "normal", URL: "http://example.com/n"})
+	pool.Add(types.DownloadConfig{ID: "high", URL: "http://example.com/h", Priority: types.PriorityHigh})
+
+	ad, _ := pool.next()
+	if ad.config.ID != "high" {
+		t.Fatalf("next() = %s, want high", ad.config.ID)
+	}
+	if _, ok := pool.downloads["high"]; !ok {
+		t.Error("started download not tracked as active")
+	}
+	pool.wg.Done()
+
+	// A worker waiting on an empty queue wakes up for the next Add
+	pool.next()
+	pool.wg.Done()
+	done := make(chan string)
+	go func() {
+		ad, _ := pool.next()
+		done <- ad.config.ID
+	}()
+	time.Sleep(20 * time.Millisecond)
+	pool.Add(types.DownloadConfig{ID: "late", URL: "http://example.com/late"})
+
+	select {
+	case id := <-done:
+		if id != "late" {
+			t.Errorf("next() = %s, want late", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiting worker was not woken by Add")
+	}
+}
+
+func TestWorkerPool_SetMaxDownloads(t *testing.T) {
+	pool := NewWorkerPool(nil, 3)
+
+	workers := func() int {
+		pool.mu.RLock()
+		defer pool.mu.RUnlock()
+		return pool.workers
+	}
+	waitWorkers := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for workers() != want && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if got := workers(); got != want {
+			t.Fatalf("workers = %d, want %d", got, want)
+		}
+	}
+
+	// Idle workers above the new limit exit
+	pool.SetMaxDownloads(1)
+	waitWorkers(1)
+
+	pool.SetMaxDownloads(4)
+	waitWorkers(4)
+	if pool.MaxDownloads() != 4 {
+		t.Errorf("MaxDownloads() = %d, want 4", pool.MaxDownloads())
+	}
+
+	pool.SetMaxDownloads(0)
+	if pool.MaxDownloads() != 1 {
+		t.Errorf("MaxDownloads() = %d, want 1 for invalid values", pool.MaxDownloads())
+	}
+}
+
+func TestWorkerPool_SetMaxDownloads_SurplusWorkerSkipsQueue(t *testing.T) {
+	// Two workers were busy when the limit dropped to one
+	pool := newQueueOnlyPool()
+	pool.maxDownloads = 1
+	pool.workers = 2
+	pool.Add(types.DownloadConfig{ID: "a", URL: "http://example.com/a"})
+
+	if ad, _ := pool.next(); ad != nil {
+		t.Fatalf("surplus worker started %s", ad.config.ID)
+	}
+	if ad, _ := pool.next(); ad == nil || ad.config.ID != "a" {
+		t.Fatalf("remaining worker did not start the queued download")
+	}
+	pool.wg.Done()
+	if pool.workers != 1 {
+		t.Errorf("workers = %d, want 1", pool.workers)
+	}
+}
@@ -0,0 +1,173 @@
+package download
+
+import (
+	"sync"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// DefaultProfileName is reported when no schedule profile matches
+const DefaultProfileName = "default"
+
+// scheduleInterval is how often the scheduler re-evaluates the calendar
+const scheduleInterval = 15 * time.Second
+
+// Scheduler switches the pool's bandwidth profile on a calendar.
+// A profile either overrides the global rate limit or pauses all downloads
+// (holding queued ones) until the window ends.
+type Scheduler struct {
+	pool     *WorkerPool
+	mu       sync.Mutex
+	schedule config.ScheduleSettings
+	now      func() time.Time
+
+	active string              // Name of the active profile
+	paused map[string]struct{} // Downloads paused by the scheduler, resumed when the window ends
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewScheduler creates a scheduler for the pool. Call Start to begin applying it.
+func NewScheduler(pool *WorkerPool, schedule config.ScheduleSettings) *Scheduler {
+	return &Scheduler{
+		pool:     pool,
+		schedule: schedule,
+		now:      time.Now,
+		paused:   make(map[string]struct{}),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start applies the current profile and re-evaluates it periodically until Stop.
+func (s *Scheduler) Start() {
+	s.Tick()
+	go func() {
+		ticker := time.NewTicker(scheduleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.Tick()
+			}
+		}
+	}()
+}
+
+// Stop ends periodic evaluation. The last applied profile stays in effect.
+func (s *Scheduler) Stop() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// SetSchedule replaces the calendar and applies it immediately.
+func (s *Scheduler) SetSchedule(schedule config.ScheduleSettings) {
+	s.mu.Lock()
+	s.schedule = schedule
+	s.mu.Unlock()
+	s.Tick()
+}
+
+// ActiveProfile returns the name of the profile currently in effect
+// and whether it pauses downloads. Returns "" when scheduling is disabled.
+func (s *Scheduler) ActiveProfile() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.schedule.Enabled {
+		return "", false
+	}
+	return s.active, s.pool.IsHeld()
+}
+
+// match returns the first profile matching t, or nil. Caller holds mu.
+func (s *Scheduler) match(t time.Time) *config.ScheduleProfile {
+	for i := range s.schedule.Profiles {
+		p := &s.schedule.Profiles[i]
+		ok, err := p.Matches(t)
+		if err != nil {
+			utils.Debug("Scheduler: skipping profile %q: %v", p.Name, err)
+			continue
+		}
+		if ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// Tick evaluates the calendar once and applies the matching profile.
+func (s *Scheduler) Tick() {
+	// Sent without holding mu, so a slow consumer doesn't block the scheduler
+	if msg, changed := s.apply(); changed && s.pool.progressCh != nil {
+		s.pool.progressCh <- msg
+	}
+}
+
+// apply applies the profile matching the current time, returning the event
+// to report if the active profile changed
+func (s *Scheduler) apply() (events.ScheduleChangedMsg, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var profile *config.ScheduleProfile
+	if s.schedule.Enabled {
+		profile = s.match(s.now())
+	}
+
+	name := DefaultProfileName
+	if profile != nil {
+		name = profile.Name
+		if name == "" {
+			name = "unnamed"
+		}
+	}
+	if !s.schedule.Enabled {
+		name = ""
+	}
+	pause := profile != nil && profile.Pause
+
+	// Rate limit
+	if profile != nil && !profile.Pause {
+		s.pool.SetScheduledRateLimit(profile.RateLimit, true)
+	} else {
+		s.pool.SetScheduledRateLimit(0, false)
+	}
+
+	// Pause / resume
+	if pause {
+		s.pool.Hold()
+		// Run every tick so downloads the user resumes mid-window are paused again
+		for _, id := range s.pool.PauseAll() {
+			s.paused[id] = struct{}{}
+		}
+	} else {
+		s.pool.Release()
+		s.resumePausedLocked()
+	}
+
+	if name == s.active {
+		return events.ScheduleChangedMsg{}, false
+	}
+	utils.Debug("Scheduler: switching profile %q -> %q", s.active, name)
+	s.active = name
+	return events.ScheduleChangedMsg{
+		Profile:   name,
+		Paused:    pause,
+		RateLimit: s.pool.GlobalRateLimit(),
+	}, true
+}
+
+// resumePausedLocked resumes downloads paused by the scheduler. Downloads
+// still flushing their pause state are retried on the next tick; ones that
+// were cancelled meanwhile are forgotten. Caller holds mu.
+func (s *Scheduler) resumePausedLocked() {
+	for id := range s.paused {
+		if s.pool.Resume(id) || s.pool.GetStatus(id) == nil {
+			delete(s.paused, id)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package download
+
+import (
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func newTestScheduler(pool *WorkerPool, now *time.Time) *Scheduler {
+	s := NewScheduler(pool, config.ScheduleSettings{
+		Enabled: true,
+		Profiles: []config.ScheduleProfile{
+			{Name: "night", Days: "*", Start: "00:00", End: "06:00", RateLimit: 0},
+			{Name: "work", Days: "*", Start: "09:00", End: "17:00", RateLimit: 100 * 1024},
+			{Name: "off", Days: "*", Start: "20:00", End: "22:00", Pause: true},
+		},
+	})
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func lastScheduleMsg(ch chan any) (events.ScheduleChangedMsg, bool) {
+	var last events.ScheduleChangedMsg
+	found := false
+	for {
+		select {
+		case msg := <-ch:
+			if m, ok := msg.(events.ScheduleChangedMsg); ok {
+				last, found = m, true
+			}
+		default:
+			return last, found
+		}
+	}
+}
+
+func TestScheduler_RateProfileOverridesGlobalLimit(t *testing.T) {
+	ch := make(chan any, 10)
+	pool := NewWorkerPool(ch, 3)
+	pool.SetGlobalRateLimit(1024 * 1024)
+
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	s := newTestScheduler(pool, &now)
+	s.Tick()
+
+	if got := pool.GlobalRateLimit(); got != 100*1024 {
+		t.Errorf("GlobalRateLimit = %d, want scheduled %d", got, 100*1024)
+	}
+	msg, ok := lastScheduleMsg(ch)
+	if !ok || msg.Profile != "work" || msg.RateLimit != 100*1024 || msg.Paused {
+		t.Errorf("unexpected schedule message: %+v (found=%v)", msg, ok)
+	}
+
+	// Changing the base limit while scheduled must not override the profile
+	pool.SetGlobalRateLimit(2 * 1024 * 1024)
+	if got := pool.GlobalRateLimit(); got != 100*1024 {
+		t.Errorf("GlobalRateLimit = %d after base change, want %d", got, 100*1024)
+	}
+
+	// Outside every profile the base limit applies again
+	now = time.Date(2024, 1, 1, 18, 0, 0, 0, time.Local)
+	s.Tick()
+	if got := pool.GlobalRateLimit(); got != 2*1024*1024 {
+		t.Errorf("GlobalRateLimit = %d, want base %d", got, 2*1024*1024)
+	}
+	if name, _ := s.ActiveProfile(); name != DefaultProfileName {
+		t.Errorf("ActiveProfile = %q, want %q", name, DefaultProfileName)
+	}
+}
+
+func TestScheduler_UnlimitedProfile(t *testing.T) {
+	ch := make(chan any, 10)
+	pool := NewWorkerPool(ch, 3)
+	pool.SetGlobalRateLimit(1024)
+
+	now := time.Date(2024, 1, 1, 2, 0, 0, 0, time.Local)
+	s := newTestScheduler(pool, &now)
+	s.Tick()
+
+	if got := pool.GlobalRateLimit(); got != 0 {
+		t.Errorf("GlobalRateLimit = %d, want 0 during unlimited profile", got)
+	}
+}
+
+func TestScheduler_NoEventWithoutChange(t *testing.T) {
+	ch := make(chan any, 10)
+	pool := NewWorkerPool(ch, 3)
+
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	s := newTestScheduler(pool, &now)
+	s.Tick()
+	lastScheduleMsg(ch)
+
+	now = now.Add(time.Hour)
+	s.Tick()
+	if msg, ok := lastScheduleMsg(ch); ok {
+		t.Errorf("unexpected schedule message for unchanged profile: %+v", msg)
+	}
+}
+
+func TestScheduler_PauseProfile(t *testing.T) {
+	ch := make(chan any, 20)
+	pool := NewWorkerPool(ch, 3)
+
+	state := types.NewProgressState("dl-1", 1000)
+	pool.mu.Lock()
+	pool.downloads["dl-1"] = &activeDownload{
+		config: types.DownloadConfig{ID: "dl-1", State: state},
+	}
+	pool.mu.Unlock()
+
+	now := time.Date(2024, 1, 1, 21, 0, 0, 0, time.Local)
+	s := newTestScheduler(pool, &now)
+	s.Tick()
+
+	if !state.IsPaused() {
+		t.Error("download should be paused during pause profile")
+	}
+	if !pool.IsHeld() {
+		t.Error("pool should hold queued downloads during pause profile")
+	}
+	if name, paused := s.ActiveProfile(); name != "off" || !paused {
+		t.Errorf("ActiveProfile = (%q, %v), want (off, true)", name, paused)
+	}
+	msg, ok := lastScheduleMsg(ch)
+	if !ok || !msg.Paused || msg.Profile != "off" {
+		t.Errorf("unexpected schedule message: %+v (found=%v)", msg, ok)
+	}
+
+	// Pause completes (normally done by the worker)
+	state.SetPausing(false)
+
+	now = time.Date(2024, 1, 1, 23, 0, 0, 0, time.Local)
+	s.Tick()
+
+	if pool.IsHeld() {
+		t.Error("pool should be released after pause profile ends")
+	}
+	if state.IsPaused() {
+		t.Error("download paused by the schedule should be resumed")
+	}
+	if len(s.paused) != 0 {
+		t.Errorf("expected no tracked downloads, got %d", len(s.paused))
+	}
+}
+
+func TestScheduler_Disabled(t *testing.T) {
+	ch := make(chan any, 10)
+	pool := NewWorkerPool(ch, 3)
+	pool.SetGlobalRateLimit(4096)
+
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	s := newTestScheduler(pool, &now)
+	s.schedule.Enabled = false
+	s.Tick()
+
+	if got := pool.GlobalRateLimit(); got != 4096 {
+		t.Errorf("GlobalRateLimit = %d, want 4096 with schedule disabled", got)
+	}
+	if name, paused := s.ActiveProfile(); name != "" || paused {
+		t.Errorf("ActiveProfile = (%q, %v), want empty", name, paused)
+	}
+}
+
+func TestScheduler_EventSentWithoutLock(t *testing.T) {
+	ch := make(chan any) // Nobody reads it yet
+	pool := NewWorkerPool(ch, 3)
+
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	s := newTestScheduler(pool, &now)
+	done := make(chan struct{})
+	go func() {
+		s.Tick()
+		close(done)
+	}()
+
+	// The profile is applied while the event still waits for a reader
+	applied := make(chan struct{})
+	go func() {
+		for name, _ := s.ActiveProfile(); name != "work"; name, _ = s.ActiveProfile() {
+			time.Sleep(time.Millisecond)
+		}
+		close(applied)
+	}()
+	select {
+	case <-applied:
+	case <-time.After(2 * time.Second):
+		t.Fatal("ActiveProfile blocked while the event was waiting to be sent")
+	}
+
+	<-ch
+	<-done
+}
+
+func TestWorkerPool_HoldRelease(t *testing.T) {
+	pool := NewWorkerPool(nil, 1)
+	if pool.IsHeld() {
+		t.Fatal("new pool should not be held")
+	}
+
+	pool.Hold()
+	pool.Hold() // idempotent
+	if !pool.IsHeld() {
+		t.Fatal("pool should be held")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		pool.waitReleased()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("waitReleased returned while held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	pool.Release()
+	pool.Release() // idempotent
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("waitReleased did not return after Release")
+	}
+}
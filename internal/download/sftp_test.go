@@ -0,0 +1,54 @@
+package download_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func TestTUIDownload_SFTP(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	data := bytes.Repeat([]byte("artifact "), 300*1024)
+	server := testutil.NewSFTPServerT(t)
+	server.SetupClientT(t)
+	server.AddFile("/srv/artifacts/app.tar", data, time.Now())
+
+	progState := types.NewProgressState("sftp-dl", 0)
+	cfg := types.DownloadConfig{
+		URL:        server.URL("/srv/artifacts/app.tar"),
+		OutputPath: tmpDir,
+		ID:         progState.ID,
+		ProgressCh: make(chan any, 100),
+		State:      progState,
+		Runtime:    &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 256 * types.KB},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download.TUIDownload(ctx, &cfg); err != nil {
+		t.Fatalf("TUIDownload failed: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(tmpDir, "app.tar"))
+	if err != nil {
+		t.Fatalf("reading result: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("downloaded %d bytes, want %d matching bytes", len(got), len(data))
+	}
+	if server.PeakHandles.Load() < 2 {
+		t.Errorf("expected parallel ranges, peak open handles = %d", server.PeakHandles.Load())
+	}
+}
@@ -0,0 +1,51 @@
+package download_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func TestTUIDownload_HLS(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	server := testutil.NewStreamServerT(t, testutil.WithStreamEncryption())
+
+	progState := types.NewProgressState("hls-dl", 0)
+	progressCh := make(chan any, 100)
+	cfg := types.DownloadConfig{
+		URL:        server.URL + "/master.m3u8",
+		OutputPath: tmpDir,
+		ID:         progState.ID,
+		ProgressCh: progressCh,
+		State:      progState,
+		Runtime:    &types.RuntimeConfig{MaxConnectionsPerHost: 4, StreamVariant: "720p"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download.TUIDownload(ctx, &cfg); err != nil {
+		t.Fatalf("TUIDownload failed: %v", err)
+	}
+
+	// The merged file is named after the manifest with the segments' extension
+	got, err := os.ReadFile(filepath.Join(tmpDir, "master.ts"))
+	if err != nil {
+		t.Fatalf("reading result: %v", err)
+	}
+	want := server.Expected("720p")
+	if !bytes.Equal(got, want) {
+		t.Fatalf("downloaded %d bytes, want %d matching bytes", len(got), len(want))
+	}
+}
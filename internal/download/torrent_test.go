@@ -0,0 +1,91 @@
+package download_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// bencodeString encodes s as a bencoded byte string
+func bencodeString(s string) string {
+	return fmt.Sprintf("%d:%s", len(s), s)
+}
+
+func TestTUIDownload_TorrentWithWebSeed(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	data := make([]byte, 200*1024+17)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	const pieceLength = 32 * 1024
+	var pieces []byte
+	for off := 0; off < len(data); off += pieceLength {
+		sum := sha1.Sum(data[off:min(off+pieceLength, len(data))])
+		pieces = append(pieces, sum[:]...)
+	}
+
+	var torrentFile []byte
+	mux := http.NewServeMux()
+	mux.HandleFunc("/files/image.iso", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "image.iso", time.Time{}, bytes.NewReader(data))
+	})
+	// The .torrent file is only recognisable by its content type
+	mux.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-bittorrent")
+		_, _ = w.Write(torrentFile)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	torrentFile = []byte("d" +
+		bencodeString("info") + "d" +
+		bencodeString("length") + fmt.Sprintf("i%de", len(data)) +
+		bencodeString("name") + bencodeString("image.iso") +
+		bencodeString("piece length") + fmt.Sprintf("i%de", pieceLength) +
+		bencodeString("pieces") + bencodeString(string(pieces)) + "e" +
+		bencodeString("url-list") + bencodeString(server.URL+"/files/image.iso") + "e")
+
+	progState := types.NewProgressState("torrent-dl", 0)
+	cfg := types.DownloadConfig{
+		URL:        server.URL + "/get?id=7",
+		OutputPath: tmpDir,
+		ID:         progState.ID,
+		ProgressCh: make(chan any, 100),
+		State:      progState,
+		Runtime:    &types.RuntimeConfig{MaxConnectionsPerHost: 4},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download.TUIDownload(ctx, &cfg); err != nil {
+		t.Fatalf("TUIDownload failed: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(tmpDir, "image.iso"))
+	if err != nil {
+		t.Fatalf("reading result: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("downloaded %d bytes, want %d matching bytes", len(got), len(data))
+	}
+	_, _, _, chunkSize, _ := progState.GetBitmap()
+	if chunkSize != pieceLength {
+		t.Errorf("chunk map granularity = %d, want the piece length %d", chunkSize, pieceLength)
+	}
+}
@@ -0,0 +1,218 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/concurrent"
+	"github.com/surge-downloader/surge/internal/engine/metalink"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Verify re-hashes the file of a download that isn't running. With piece
+// hashes, bad pieces of a finished file are fetched again over HTTP and bad
+// pieces of a paused one are queued to be fetched on resume. Without them the
+// whole file is checked against its checksum, which can't be repaired.
+func Verify(ctx context.Context, id string, runtime *types.RuntimeConfig) (*types.VerifyResult, error) {
+	entry, err := state.GetDownload(id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("download not found: %s", id)
+	}
+	pieces, err := state.LoadPieceHashes(id)
+	if err != nil {
+		return nil, err
+	}
+	AttachCredentials(runtime)
+
+	if _, err := os.Stat(entry.DestPath + types.IncompleteSuffix); err == nil && entry.Status != "completed" {
+		if pieces == nil {
+			return nil, fmt.Errorf("paused downloads can only be verified against piece hashes")
+		}
+		return requeuePieces(ctx, id, pieces)
+	}
+
+	info, err := os.Stat(entry.DestPath)
+	if err != nil {
+		return nil, fmt.Errorf("nothing to verify: %w", err)
+	}
+	result := &types.VerifyResult{ID: id}
+	if pieces == nil {
+		if entry.Checksum == "" {
+			return nil, fmt.Errorf("download has no piece hashes or checksum to verify against")
+		}
+		status, err := verifyChecksum(ctx, entry.Checksum, entry.DestPath)
+		if status == "" {
+			return nil, err
+		}
+		result.Status = status
+		entry.ChecksumStatus = status
+		return result, state.AddToMasterList(*entry)
+	}
+
+	bad, checked, err := checksum.VerifyPieces(ctx, entry.DestPath, pieces, info.Size(), nil)
+	if err != nil {
+		return nil, err
+	}
+	result.Pieces, result.Failed = checked, len(bad)
+	if len(bad) > 0 {
+		result.Repaired = repairPieces(ctx, entry, pieces, bad, runtime)
+	}
+
+	switch {
+	case len(bad) == 0:
+		result.Status = checksum.StatusVerified
+	case result.Repaired == len(bad):
+		result.Status = checksum.StatusRepaired
+	default:
+		result.Status = checksum.StatusMismatch
+	}
+
+	if result.Status != checksum.StatusMismatch {
+		// A download given up on over bad pieces is finished now
+		if entry.Status == "error" {
+			entry.Status = "completed"
+			entry.TotalSize = info.Size()
+			entry.Downloaded = entry.TotalSize
+			entry.CompletedAt = time.Now().Unix()
+		}
+		if entry.Checksum != "" {
+			if entry.ChecksumStatus, err = verifyChecksum(ctx, entry.Checksum, entry.DestPath); entry.ChecksumStatus == "" {
+				return nil, err
+			}
+		}
+	}
+	if err := state.AddToMasterList(*entry); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// requeuePieces hashes what a paused download has written so far and adds
+// the pieces that don't match back to its remaining tasks
+func requeuePieces(ctx context.Context, id string, pieces *types.PieceHashes) (*types.VerifyResult, error) {
+	states, err := state.LoadStates([]string{id})
+	if err != nil {
+		return nil, err
+	}
+	st := states[id]
+	if st == nil {
+		return nil, fmt.Errorf("no saved state for download %s", id)
+	}
+
+	bad, checked, err := checksum.VerifyPieces(ctx, st.DestPath+types.IncompleteSuffix, pieces, st.TotalSize, st.Tasks)
+	if err != nil {
+		return nil, err
+	}
+	result := &types.VerifyResult{ID: id, Status: checksum.StatusVerified, Pieces: checked, Failed: len(bad)}
+	if len(bad) == 0 {
+		return result, nil
+	}
+
+	// Show the pieces as failed until the resumed download fetches them
+	progress := types.NewProgressState(id, st.TotalSize)
+	progress.RestoreBitmap(st.ChunkBitmap, st.ActualChunkSize)
+	progress.RecalculateProgress(st.Tasks)
+	for _, task := range bad {
+		progress.UpdateChunkStatus(task.Offset, task.Length, types.ChunkFailed)
+		st.Downloaded = max(st.Downloaded-task.Length, 0)
+	}
+	if bitmap, _, _, _, _ := progress.GetBitmap(); bitmap != nil {
+		st.ChunkBitmap = bitmap
+	}
+	st.Tasks = append(st.Tasks, bad...)
+
+	if err := state.SaveState(st.URL, st.DestPath, st); err != nil {
+		return nil, err
+	}
+	result.Status = checksum.StatusRequeued
+	return result, nil
+}
+
+// repairPieces fetches bad pieces of a finished file from its HTTP sources,
+// writing each only once its hash matches. Returns how many were repaired.
+func repairPieces(ctx context.Context, entry *types.DownloadEntry, pieces *types.PieceHashes, bad []types.Task, runtime *types.RuntimeConfig) int {
+	var sources []string
+	if metalink.IsMetalink(entry.URL, "") {
+		if f, err := metalink.Resolve(ctx, entry.URL, nil, runtime); err == nil {
+			sources = f.Sources()
+		} else {
+			utils.Debug("Verify: reading metalink: %v", err)
+		}
+	} else {
+		sources = append([]string{entry.URL}, entry.Mirrors...)
+	}
+
+	f, err := os.OpenFile(entry.DestPath, os.O_WRONLY, 0)
+	if err != nil {
+		utils.Debug("Verify: %v", err)
+		return 0
+	}
+	defer func() { _ = f.Close() }()
+
+	client := concurrent.NewHTTPClient(runtime, 1)
+	repaired := 0
+	for _, task := range bad {
+		i := int(task.Offset / pieces.Length)
+		for _, source := range sources {
+			data, err := fetchRange(ctx, client, source, task, runtime)
+			if err == nil {
+				var ok bool
+				if ok, err = checksum.MatchesPiece(pieces, i, bytes.NewReader(data)); err == nil && !ok {
+					err = errors.New("piece hash doesn't match")
+				}
+			}
+			if err != nil {
+				utils.Debug("Verify: piece %d from %s: %v", i, source, err)
+				continue
+			}
+			if _, err := f.WriteAt(data, task.Offset); err != nil {
+				utils.Debug("Verify: writing piece %d: %v", i, err)
+				return repaired
+			}
+			repaired++
+			break
+		}
+	}
+	return repaired
+}
+
+// fetchRange downloads the bytes of task from an HTTP source
+func fetchRange(ctx context.Context, client *http.Client, source string, task types.Task, runtime *types.RuntimeConfig) ([]byte, error) {
+	if u, err := url.Parse(source); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("pieces can only be repaired over HTTP")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", task.Offset, task.Offset+task.Length-1))
+	req.Header.Set("User-Agent", runtime.GetUserAgent())
+	runtime.ApplyCredentials(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("expected 206 Partial Content, got %s", resp.Status)
+	}
+	data := make([]byte, task.Length)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
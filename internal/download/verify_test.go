@@ -0,0 +1,226 @@
+package download_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+const verifyPieceLen = 1000
+
+func verifyData() ([]byte, *types.PieceHashes) {
+	data := make([]byte, 4500)
+	for i := range data {
+		data[i] = byte(i % 241)
+	}
+	pieces := &types.PieceHashes{Algorithm: "sha256", Length: verifyPieceLen}
+	for start := 0; start < len(data); start += verifyPieceLen {
+		sum := sha256.Sum256(data[start:min(start+verifyPieceLen, len(data))])
+		pieces.Hashes = append(pieces.Hashes, hex.EncodeToString(sum[:]))
+	}
+	return data, pieces
+}
+
+func TestVerify_RepairsCompletedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	data, pieces := verifyData()
+	var (
+		mu     sync.Mutex
+		ranges []string
+	)
+	server := testutil.NewHTTPServerT(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	// Pieces 1 and 4 (the short last one) rotted on disk
+	corrupt := bytes.Clone(data)
+	corrupt[1500] ^= 0xff
+	corrupt[4499] ^= 0xff
+	destPath := filepath.Join(tmpDir, "big.bin")
+	if err := os.WriteFile(destPath, corrupt, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if err := state.AddToMasterList(types.DownloadEntry{
+		ID: "verify-done", URL: server.URL + "/big.bin", DestPath: destPath, Filename: "big.bin",
+		Status: "completed", TotalSize: int64(len(data)), Downloaded: int64(len(data)),
+		Checksum: "sha256:" + hex.EncodeToString(sum[:]), ChecksumStatus: "mismatch",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SavePieceHashes("verify-done", pieces); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := download.Verify(context.Background(), "verify-done", nil)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if result.Status != "repaired" || result.Pieces != 5 || result.Failed != 2 || result.Repaired != 2 {
+		t.Errorf("result = %+v, want 2 of 5 pieces repaired", result)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ranges) != 2 || ranges[0] != "bytes=1000-1999" || ranges[1] != "bytes=4000-4499" {
+		t.Errorf("requested %v, want only the two bad pieces", ranges)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("file still differs from the source")
+	}
+	entry, err := state.GetDownload("verify-done")
+	if err != nil || entry == nil {
+		t.Fatalf("GetDownload failed: %v", err)
+	}
+	if entry.ChecksumStatus != "verified" {
+		t.Errorf("checksum status = %q, want verified after the repair", entry.ChecksumStatus)
+	}
+
+	// A second run finds nothing to do
+	result, err = download.Verify(context.Background(), "verify-done", nil)
+	if err != nil || result.Status != "verified" || result.Failed != 0 {
+		t.Errorf("second Verify = %+v, %v", result, err)
+	}
+}
+
+func TestVerify_RequeuesPausedPieces(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	data, pieces := verifyData()
+	url := "https://example.com/big.bin"
+	destPath := filepath.Join(tmpDir, "big.bin")
+
+	// The first 3000 bytes were written before the pause, piece 0 badly
+	partial := bytes.Clone(data)
+	partial[10] ^= 0xff
+	if err := os.WriteFile(destPath+types.IncompleteSuffix, partial, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SaveState(url, destPath, &types.DownloadState{
+		ID: "verify-paused", URL: url, DestPath: destPath, Filename: "big.bin",
+		TotalSize: int64(len(data)), Downloaded: 3000,
+		Tasks: []types.Task{{Offset: 3000, Length: 1500}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SavePieceHashes("verify-paused", pieces); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := download.Verify(context.Background(), "verify-paused", nil)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if result.Status != "requeued" || result.Pieces != 3 || result.Failed != 1 {
+		t.Errorf("result = %+v, want piece 0 of 3 requeued", result)
+	}
+
+	saved, err := state.LoadState(url, destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Downloaded != 2000 || len(saved.Tasks) != 2 || saved.Tasks[1] != (types.Task{Offset: 0, Length: 1000}) {
+		t.Errorf("saved state = %d bytes, tasks %v; want piece 0 back in the tasks", saved.Downloaded, saved.Tasks)
+	}
+}
+
+func TestVerify_ChecksumOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	destPath := filepath.Join(tmpDir, "small.bin")
+	if err := os.WriteFile(destPath, []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entry := types.DownloadEntry{ID: "verify-sum", URL: "https://example.com/small.bin", DestPath: destPath, Status: "completed", TotalSize: 3}
+	if err := state.AddToMasterList(entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := download.Verify(context.Background(), "verify-sum", nil); err == nil {
+		t.Error("expected an error without piece hashes or checksum")
+	}
+
+	entry.Checksum = "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if err := state.AddToMasterList(entry); err != nil {
+		t.Fatal(err)
+	}
+	result, err := download.Verify(context.Background(), "verify-sum", nil)
+	if err != nil || result.Status != "verified" || result.Pieces != 0 {
+		t.Errorf("Verify = %+v, %v; want the checksum verified", result, err)
+	}
+}
+
+func TestTUIDownload_ChecksPiecesOfSingleStream(t *testing.T) {
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	defer state.CloseDB()
+
+	data, pieces := verifyData()
+	served := bytes.Clone(data)
+	served[2500] ^= 0xff
+	server := testutil.NewHTTPServerT(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// No range support, so the single connection engine takes it
+		_, _ = w.Write(served)
+	}))
+	defer server.Close()
+
+	progState := types.NewProgressState("single-pieces", 0)
+	cfg := types.DownloadConfig{
+		URL:        server.URL + "/big.bin",
+		OutputPath: tmpDir,
+		ID:         progState.ID,
+		ProgressCh: make(chan any, 100),
+		State:      progState,
+		Pieces:     pieces,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := download.TUIDownload(ctx, &cfg)
+	if !errors.Is(err, types.ErrCorruptPiece) {
+		t.Fatalf("expected ErrCorruptPiece, got %v", err)
+	}
+
+	// The server can't serve ranges, so the bad piece stays bad
+	entry, err := state.GetDownload(cfg.ID)
+	if err != nil || entry == nil || entry.Status != "error" {
+		t.Fatalf("entry = %+v, %v; want the download failed", entry, err)
+	}
+	result, err := download.Verify(ctx, cfg.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != "mismatch" || result.Failed != 1 || result.Repaired != 0 {
+		t.Errorf("Verify = %+v, want one unrepaired piece", result)
+	}
+}
@@ -0,0 +1,232 @@
+package backoff
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// BaseDelay is the first backoff applied when a server throttles without Retry-After
+	BaseDelay = 1 * time.Second
+
+	// MaxDelay caps both computed backoffs and server supplied Retry-After values
+	MaxDelay = 5 * time.Minute
+
+	// RampInterval is how often a recovering host gets one more connection back
+	RampInterval = 2 * time.Second
+
+	// maxPoll bounds a single wait so waiters notice ramp steps and cancellation
+	maxPoll = 250 * time.Millisecond
+)
+
+// Controller tracks hosts that asked us to slow down (429/503).
+// A throttled host accepts no new connections until its backoff expires,
+// then gets a reduced connection budget that grows by one every RampInterval
+// until it is back to where it was when the server complained.
+type Controller struct {
+	mu      sync.Mutex
+	hosts   map[string]*host
+	changed chan struct{}
+	now     func() time.Time
+}
+
+type host struct {
+	until   time.Time // No new connections before this
+	limit   int       // Connections allowed once the backoff expires
+	ceiling int       // Connections in use when throttled; reaching it lifts the restriction
+	active  int       // Connections currently open
+	strikes int       // Consecutive backoffs without recovering, for exponential delays
+}
+
+// Default is shared by every download in the process
+var Default = New()
+
+// New creates an empty controller
+func New() *Controller {
+	return &Controller{
+		hosts:   make(map[string]*host),
+		changed: make(chan struct{}),
+		now:     time.Now,
+	}
+}
+
+// notifyLocked wakes every waiter. Caller holds mu.
+func (c *Controller) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// allowedLocked returns how many connections the host may have open right now,
+// 0 while its backoff lasts and -1 when unrestricted. Hosts that have fully
+// recovered are forgotten. Caller holds mu.
+func (c *Controller) allowedLocked(key string, now time.Time) int {
+	h := c.hosts[key]
+	if h == nil {
+		return -1
+	}
+	if now.Before(h.until) {
+		return 0
+	}
+	allowed := h.limit + int(now.Sub(h.until)/RampInterval)
+	if allowed >= h.ceiling {
+		if h.active == 0 {
+			delete(c.hosts, key)
+		} else {
+			// Keep the entry for its connection count, without restriction
+			h.limit, h.ceiling, h.strikes = 0, 0, 0
+			h.until = time.Time{}
+		}
+		return -1
+	}
+	return allowed
+}
+
+// Acquire blocks until a new connection to host (host:port) may be opened or
+// ctx is done. Every successful Acquire must be paired with Release.
+func (c *Controller) Acquire(ctx context.Context, key string) error {
+	c.mu.Lock()
+	for {
+		now := c.now()
+		allowed := c.allowedLocked(key, now)
+		if allowed < 0 || c.activeLocked(key) < allowed {
+			c.trackLocked(key).active++
+			c.mu.Unlock()
+			return nil
+		}
+
+		wait := maxPoll
+		if h := c.hosts[key]; h != nil && now.Before(h.until) && h.until.Sub(now) < wait {
+			wait = h.until.Sub(now)
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+		c.mu.Lock()
+	}
+}
+
+// Release returns a connection taken with Acquire
+func (c *Controller) Release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if h := c.hosts[key]; h != nil && h.active > 0 {
+		h.active--
+		if h.active == 0 && h.ceiling == 0 {
+			delete(c.hosts, key)
+		}
+	}
+	c.notifyLocked()
+}
+
+// activeLocked returns the open connection count for host. Caller holds mu.
+func (c *Controller) activeLocked(key string) int {
+	if h := c.hosts[key]; h != nil {
+		return h.active
+	}
+	return 0
+}
+
+// trackLocked returns the host entry, creating it if needed. Caller holds mu.
+func (c *Controller) trackLocked(key string) *host {
+	h := c.hosts[key]
+	if h == nil {
+		h = &host{}
+		c.hosts[key] = h
+	}
+	return h
+}
+
+// Throttle puts host into backoff after a 429 or 503. retryAfter is the
+// server's Retry-After (0 if absent), otherwise the delay doubles with every
+// consecutive throttle. The host's connection budget is halved.
+// Returns the delay applied.
+func (c *Controller) Throttle(key string, retryAfter time.Duration) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	h := c.trackLocked(key)
+
+	delay := retryAfter
+	if delay <= 0 {
+		delay = BaseDelay << min(h.strikes, 8)
+	}
+	if delay > MaxDelay {
+		delay = MaxDelay
+	}
+
+	// Several workers usually hit the same throttle at once: only the first
+	// one shrinks the budget, the rest may only extend the wait.
+	if now.Before(h.until) {
+		if until := now.Add(delay); until.After(h.until) {
+			h.until = until
+		}
+		return delay
+	}
+
+	inUse := h.active
+	if h.ceiling > 0 {
+		// Throttled again while ramping up: shrink from the current budget
+		inUse = h.limit + int(now.Sub(h.until)/RampInterval)
+	} else {
+		h.ceiling = max(inUse, 2)
+	}
+	h.limit = max(inUse/2, 1)
+	h.until = now.Add(delay)
+	h.strikes++
+	c.notifyLocked()
+	return delay
+}
+
+// Status reports whether host is backing off, how long until new connections
+// are allowed, and how many it may open afterwards (-1 = unrestricted).
+func (c *Controller) Status(key string) (wait time.Duration, allowed int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	h := c.hosts[key]
+	if h == nil || h.ceiling == 0 {
+		return 0, -1
+	}
+	if now.Before(h.until) {
+		return h.until.Sub(now), h.limit
+	}
+	return 0, c.allowedLocked(key, now)
+}
+
+// ParseRetryAfter parses a Retry-After header given either as delay seconds
+// or as an HTTP date. Returns 0 when the header is absent or invalid.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		if secs > int64(MaxDelay/time.Second) {
+			return MaxDelay
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return min(d, MaxDelay)
+		}
+	}
+	return 0
+}
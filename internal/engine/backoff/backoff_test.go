@@ -0,0 +1,157 @@
+package backoff
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"empty", "", 0},
+		{"seconds", "120", 2 * time.Minute},
+		{"seconds with spaces", " 5 ", 5 * time.Second},
+		{"zero", "0", 0},
+		{"negative", "-3", 0},
+		{"capped", "86400", MaxDelay},
+		{"http date", "Fri, 01 Mar 2024 12:00:30 GMT", 30 * time.Second},
+		{"rfc850 date", "Friday, 01-Mar-24 12:01:00 GMT", time.Minute},
+		{"date in the past", "Fri, 01 Mar 2024 11:00:00 GMT", 0},
+		{"garbage", "soon", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseRetryAfter(tt.value, now); got != tt.want {
+				t.Errorf("ParseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeClock lets tests move time forward without sleeping
+type fakeClock struct{ t time.Time }
+
+func (f *fakeClock) now() time.Time { return f.t }
+
+func newTestController() (*Controller, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	c := New()
+	c.now = clock.now
+	return c, clock
+}
+
+func TestController_ThrottleAndRamp(t *testing.T) {
+	c, clock := newTestController()
+	ctx := context.Background()
+	const key = "example.com:443"
+
+	// Eight connections open when the server complains
+	for i := 0; i < 8; i++ {
+		if err := c.Acquire(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if delay := c.Throttle(key, 10*time.Second); delay != 10*time.Second {
+		t.Fatalf("Throttle delay = %v, want Retry-After", delay)
+	}
+
+	// A second worker hitting the same throttle doesn't halve the budget again
+	c.Throttle(key, 5*time.Second)
+
+	wait, allowed := c.Status(key)
+	if wait != 10*time.Second || allowed != 4 {
+		t.Fatalf("Status during backoff = (%v, %d), want (10s, 4)", wait, allowed)
+	}
+
+	// No new connections until the backoff lifts
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := c.Acquire(short, key); err == nil {
+		t.Fatal("Acquire succeeded during backoff")
+	}
+
+	for i := 0; i < 8; i++ {
+		c.Release(key)
+	}
+
+	clock.t = clock.t.Add(10 * time.Second)
+	if _, allowed := c.Status(key); allowed != 4 {
+		t.Errorf("allowed right after backoff = %d, want 4", allowed)
+	}
+
+	// One more connection every RampInterval
+	clock.t = clock.t.Add(2 * RampInterval)
+	if _, allowed := c.Status(key); allowed != 6 {
+		t.Errorf("allowed after two ramp steps = %d, want 6", allowed)
+	}
+
+	// Back at the original count: restriction lifted
+	clock.t = clock.t.Add(2 * RampInterval)
+	if wait, allowed := c.Status(key); wait != 0 || allowed != -1 {
+		t.Errorf("Status after recovery = (%v, %d), want unrestricted", wait, allowed)
+	}
+}
+
+func TestController_BudgetLimitsAcquire(t *testing.T) {
+	c, clock := newTestController()
+	ctx := context.Background()
+	const key = "example.com:80"
+
+	for i := 0; i < 4; i++ {
+		_ = c.Acquire(ctx, key)
+	}
+	c.Throttle(key, time.Second)
+	for i := 0; i < 4; i++ {
+		c.Release(key)
+	}
+	clock.t = clock.t.Add(time.Second)
+
+	// Budget is 2 while ramping
+	for i := 0; i < 2; i++ {
+		if err := c.Acquire(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := c.Acquire(short, key); err == nil {
+		t.Fatal("Acquire exceeded the reduced budget")
+	}
+
+	// Releasing one lets a waiter in
+	c.Release(key)
+	if err := c.Acquire(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestController_ExponentialDelay(t *testing.T) {
+	c, clock := newTestController()
+	const key = "example.com:443"
+
+	first := c.Throttle(key, 0)
+	clock.t = clock.t.Add(first)
+	second := c.Throttle(key, 0)
+
+	if first != BaseDelay || second != 2*BaseDelay {
+		t.Errorf("delays = %v, %v; want %v, %v", first, second, BaseDelay, 2*BaseDelay)
+	}
+}
+
+func TestController_OtherHostsUnaffected(t *testing.T) {
+	c, _ := newTestController()
+	c.Throttle("a.example.com:443", time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Acquire(ctx, "b.example.com:443"); err != nil {
+		t.Fatalf("unrelated host blocked: %v", err)
+	}
+}
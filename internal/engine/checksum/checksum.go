@@ -0,0 +1,203 @@
+package checksum
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Supported algorithm names as used in "algo:hexdigest" specs
+const (
+	MD5        = "md5"
+	SHA1       = "sha1"
+	SHA256     = "sha256"
+	SHA512     = "sha512"
+	BLAKE2b256 = "blake2b-256"
+	BLAKE2b512 = "blake2b-512"
+)
+
+// Verification results stored with a download
+const (
+	StatusVerified = "verified"
+	StatusMismatch = "mismatch"
+)
+
+var algorithms = map[string]func() hash.Hash{
+	MD5:        md5.New,
+	SHA1:       sha1.New,
+	SHA256:     sha256.New,
+	SHA512:     sha512.New,
+	BLAKE2b256: func() hash.Hash { return newBlake2b(32) },
+	BLAKE2b512: func() hash.Hash { return newBlake2b(64) },
+}
+
+// newBlake2b returns an unkeyed BLAKE2b hash with a digest of size bytes
+func newBlake2b(size int) hash.Hash {
+	h, err := blake2b.New(size, nil)
+	if err != nil {
+		panic(err) // Only sizes outside 1-64 fail
+	}
+	return h
+}
+
+// aliases maps alternative spellings to canonical algorithm names
+var aliases = map[string]string{
+	"sha-1":   SHA1,
+	"sha-256": SHA256,
+	"sha-512": SHA512,
+	"blake2b": BLAKE2b512,
+	"b2":      BLAKE2b512,
+}
+
+// Spec is an expected digest for a file
+type Spec struct {
+	Algorithm string
+	Digest    string // Lowercase hex
+}
+
+// String returns the spec in "algo:hexdigest" form
+func (s Spec) String() string {
+	if s.Algorithm == "" {
+		return ""
+	}
+	return s.Algorithm + ":" + s.Digest
+}
+
+// MismatchError is returned when a file's digest differs from the expected one
+type MismatchError struct {
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch: expected %s, got %s", e.Algorithm, e.Expected, e.Actual)
+}
+
+// Parse parses an "algo:hexdigest" checksum such as "sha256:abcd...".
+// A bare hex digest is accepted when its length identifies the algorithm
+// (MD5, SHA-1, SHA-256 or SHA-512).
+func Parse(s string) (Spec, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Spec{}, fmt.Errorf("empty checksum")
+	}
+
+	algo, digest, hasAlgo := strings.Cut(s, ":")
+	if !hasAlgo {
+		digest = algo
+		switch len(digest) {
+		case md5.Size * 2:
+			algo = MD5
+		case sha1.Size * 2:
+			algo = SHA1
+		case sha256.Size * 2:
+			algo = SHA256
+		case sha512.Size * 2:
+			algo = SHA512
+		default:
+			return Spec{}, fmt.Errorf("cannot infer algorithm from checksum %q; use algo:digest", s)
+		}
+	}
+
+	algo = strings.ToLower(strings.TrimSpace(algo))
+	if canonical, ok := aliases[algo]; ok {
+		algo = canonical
+	}
+	newHash, ok := algorithms[algo]
+	if !ok {
+		return Spec{}, fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	raw, err := hex.DecodeString(digest)
+	if err != nil {
+		return Spec{}, fmt.Errorf("invalid %s digest: not hex", algo)
+	}
+	if want := newHash().Size(); len(raw) != want {
+		return Spec{}, fmt.Errorf("invalid %s digest: expected %d hex characters, got %d", algo, want*2, len(digest))
+	}
+
+	return Spec{Algorithm: algo, Digest: digest}, nil
+}
+
+// Normalize parses s and returns its canonical "algo:hexdigest" form.
+// An empty string is returned unchanged.
+func Normalize(s string) (string, error) {
+	if strings.TrimSpace(s) == "" {
+		return "", nil
+	}
+	spec, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return spec.String(), nil
+}
+
+// Algorithm returns the canonical name of a supported algorithm, accepting
+// the same spellings as Parse (e.g. the IANA "sha-256")
+func Algorithm(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if canonical, ok := aliases[name]; ok {
+		name = canonical
+	}
+	_, ok := algorithms[name]
+	return name, ok
+}
+
+// New returns a hash for a canonical algorithm name
+func New(algorithm string) (hash.Hash, error) {
+	newHash, ok := algorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+	return newHash(), nil
+}
+
+// VerifyFile hashes the file at path and compares it with spec.
+// Returns a *MismatchError if the digests differ.
+func VerifyFile(ctx context.Context, path string, spec Spec) error {
+	h, err := New(spec.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := io.Copy(h, &ctxReader{ctx: ctx, r: f}); err != nil {
+		return fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	actual := hex.EncodeToString(h.Sum(nil))
+	if actual != spec.Digest {
+		return &MismatchError{Algorithm: spec.Algorithm, Expected: spec.Digest, Actual: actual}
+	}
+	return nil
+}
+
+// ctxReader stops a long hash run when the download is cancelled
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,142 @@
+package checksum
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBlake2b_KnownVectors(t *testing.T) {
+	// Reference digests from Python's hashlib.blake2b
+	block := make([]byte, 256*5)
+	for i := range block {
+		block[i] = byte(i)
+	}
+
+	tests := []struct {
+		size  int
+		input []byte
+		want  string
+	}{
+		{64, nil, "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce"},
+		{64, []byte("abc"), "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+		{64, []byte(strings.Repeat("a", 128)), "fc6c71f688f43ea7d60817478808f3cac753e61571865c95adbc2d9122c943a76b92c2cb1047ef3fe7bf6e436ec1d0a99a9e5b216780bf7fed9d7ca91d3a8f3b"},
+		{64, []byte(strings.Repeat("a", 129)), "55e6e0eb418149a8af92fd9ddc99254781b2f522a131b4f4d984404b71a00e1167b8124d5dcddd4c6977b299392335d6edd303da6d344d74bbef2d38101b232b"},
+		{64, block, "a86b784c748f990b998e6d30d71e20cc95228d2b08dd85e29f63e4de8d8839bdf935f4291537af5014fe44c0b578a073e4c9217c7b05542d0c450784c30bac8a"},
+		{32, nil, "0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8"},
+		{32, []byte("abc"), "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"},
+		{32, block, "82628cbfc9689e234b0923a531f4578fe2e7138a03e2f81ed6cde97517336650"},
+	}
+
+	for _, tt := range tests {
+		h := newBlake2b(tt.size)
+		// Uneven writes exercise the block buffering
+		for data := tt.input; len(data) > 0; {
+			n := 7
+			if n > len(data) {
+				n = len(data)
+			}
+			_, _ = h.Write(data[:n])
+			data = data[n:]
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != tt.want {
+			t.Errorf("blake2b-%d(%d bytes) = %s, want %s", tt.size*8, len(tt.input), got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	sha256Empty := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	tests := []struct {
+		in       string
+		wantAlgo string
+		wantErr  bool
+	}{
+		{"sha256:" + sha256Empty, SHA256, false},
+		{"SHA-256:" + strings.ToUpper(sha256Empty), SHA256, false},
+		{sha256Empty, SHA256, false},
+		{"md5:d41d8cd98f00b204e9800998ecf8427e", MD5, false},
+		{"da39a3ee5e6b4b0d3255bfef95601890afd80709", SHA1, false},
+		{"blake2b:786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce", BLAKE2b512, false},
+		{"blake2b-256:0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8", BLAKE2b256, false},
+		{"", "", true},
+		{"crc32:deadbeef", "", true},
+		{"sha256:abcd", "", true},
+		{"sha256:" + strings.Repeat("z", 64), "", true},
+		{"abc123", "", true},
+	}
+
+	for _, tt := range tests {
+		spec, err := Parse(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) should fail, got %+v", tt.in, spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", tt.in, err)
+			continue
+		}
+		if spec.Algorithm != tt.wantAlgo {
+			t.Errorf("Parse(%q).Algorithm = %q, want %q", tt.in, spec.Algorithm, tt.wantAlgo)
+		}
+		if spec.Digest != strings.ToLower(spec.Digest) {
+			t.Errorf("Parse(%q).Digest should be lowercase", tt.in)
+		}
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	good := []string{
+		"md5:900150983cd24fb0d6963f7d28e17f72",
+		"sha1:a9993e364706816aba3e25717850c26c9cd0d89d",
+		"sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		"blake2b-256:bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319",
+	}
+	for _, s := range good {
+		spec, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", s, err)
+		}
+		if err := VerifyFile(context.Background(), path, spec); err != nil {
+			t.Errorf("VerifyFile(%s) = %v, want nil", spec.Algorithm, err)
+		}
+	}
+
+	spec, _ := Parse("sha256:" + strings.Repeat("0", 64))
+	err := VerifyFile(context.Background(), path, spec)
+	var mismatch *MismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected MismatchError, got %v", err)
+	}
+	if mismatch.Actual != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("Actual = %s", mismatch.Actual)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := VerifyFile(ctx, path, spec); !errors.Is(err, context.Canceled) {
+		t.Errorf("VerifyFile with cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got, err := Normalize("  "); err != nil || got != "" {
+		t.Errorf("Normalize(blank) = %q, %v", got, err)
+	}
+	got, err := Normalize("SHA1:A9993E364706816ABA3E25717850C26C9CD0D89D")
+	if err != nil || got != "sha1:a9993e364706816aba3e25717850c26c9cd0d89d" {
+		t.Errorf("Normalize = %q, %v", got, err)
+	}
+}
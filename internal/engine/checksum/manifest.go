@@ -0,0 +1,105 @@
+package checksum
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"strings"
+)
+
+// Entry is one line of a checksum manifest
+type Entry struct {
+	Name string // File name as written in the manifest (may be empty in single-hash sidecars)
+	Spec Spec
+}
+
+// ParseManifest parses checksum files in GNU coreutils format
+// ("<hex>  name" or "<hex> *name", as written by sha256sum) and BSD/tagged
+// format ("SHA256 (name) = <hex>"). algoHint names the algorithm of GNU-style
+// lines (usually derived from the manifest file name); when empty it is
+// inferred from the digest length. Lines that cannot be parsed are skipped.
+func ParseManifest(data []byte, algoHint string) []Entry {
+	var entries []Entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if e, ok := parseBSDLine(line); ok {
+			entries = append(entries, e)
+			continue
+		}
+		if e, ok := parseGNULine(line, algoHint); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// parseBSDLine parses "ALGO (name) = digest"
+func parseBSDLine(line string) (Entry, bool) {
+	open := strings.Index(line, " (")
+	closeIdx := strings.LastIndex(line, ") = ")
+	if open <= 0 || closeIdx < open {
+		return Entry{}, false
+	}
+	algo := line[:open]
+	name := line[open+2 : closeIdx]
+	digest := line[closeIdx+4:]
+
+	spec, err := Parse(algo + ":" + digest)
+	if err != nil {
+		return Entry{}, false
+	}
+	return Entry{Name: name, Spec: spec}, true
+}
+
+// parseGNULine parses "digest  name", "digest *name" or a bare "digest"
+func parseGNULine(line string, algoHint string) (Entry, bool) {
+	// A leading backslash marks an escaped file name
+	line = strings.TrimPrefix(line, "\\")
+
+	digest, name, _ := strings.Cut(line, " ")
+	name = strings.TrimLeft(name, " ")
+	name = strings.TrimPrefix(name, "*") // binary mode marker
+
+	s := digest
+	if algoHint != "" {
+		s = algoHint + ":" + digest
+	}
+	spec, err := Parse(s)
+	if err != nil {
+		return Entry{}, false
+	}
+	return Entry{Name: name, Spec: spec}, true
+}
+
+// Lookup returns the entry for any of the given file names. Names in the
+// manifest are compared by base name, so "./dist/file.iso" matches "file.iso".
+func Lookup(entries []Entry, names ...string) (Spec, bool) {
+	for _, e := range entries {
+		base := path.Base(strings.ReplaceAll(e.Name, "\\", "/"))
+		for _, n := range names {
+			if n != "" && (e.Name == n || base == n) {
+				return e.Spec, true
+			}
+		}
+	}
+	return Spec{}, false
+}
+
+// AlgorithmFromName guesses the algorithm of a checksum file from its name,
+// e.g. "file.iso.sha256", "SHA512SUMS" or "CHECKSUM.MD5". Returns "" if unknown.
+func AlgorithmFromName(name string) string {
+	lower := strings.ToLower(path.Base(name))
+	for _, algo := range []string{BLAKE2b256, BLAKE2b512, SHA512, SHA256, SHA1, MD5} {
+		if strings.Contains(lower, algo) {
+			return algo
+		}
+	}
+	if strings.Contains(lower, "b2sum") || strings.Contains(lower, "blake2") {
+		return BLAKE2b512
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package checksum
+
+import "testing"
+
+const (
+	abcSHA256 = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	abcMD5    = "900150983cd24fb0d6963f7d28e17f72"
+)
+
+func TestParseManifest_GNU(t *testing.T) {
+	data := []byte("# comment\n" +
+		"0000000000000000000000000000000000000000000000000000000000000000  other.iso\n" +
+		abcSHA256 + " *ubuntu.iso\n" +
+		"garbage line\n")
+
+	entries := ParseManifest(data, SHA256)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d: %+v", len(entries), entries)
+	}
+
+	spec, ok := Lookup(entries, "ubuntu.iso")
+	if !ok {
+		t.Fatal("ubuntu.iso not found")
+	}
+	if spec.Algorithm != SHA256 || spec.Digest != abcSHA256 {
+		t.Errorf("unexpected spec: %+v", spec)
+	}
+
+	if _, ok := Lookup(entries, "missing.iso"); ok {
+		t.Error("missing.iso should not match")
+	}
+}
+
+func TestParseManifest_BSD(t *testing.T) {
+	data := []byte("SHA256 (./dist/file.tar.gz) = " + abcSHA256 + "\n" +
+		"MD5 (file.zip) = " + abcMD5 + "\n" +
+		"SHA384 (file.tar.gz) = unsupported\n")
+
+	entries := ParseManifest(data, "")
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d: %+v", len(entries), entries)
+	}
+
+	spec, ok := Lookup(entries, "file.tar.gz")
+	if !ok || spec.Algorithm != SHA256 {
+		t.Errorf("file.tar.gz lookup = %+v, %v", spec, ok)
+	}
+	spec, ok = Lookup(entries, "file.zip")
+	if !ok || spec.Algorithm != MD5 {
+		t.Errorf("file.zip lookup = %+v, %v", spec, ok)
+	}
+}
+
+func TestParseManifest_BareSidecar(t *testing.T) {
+	entries := ParseManifest([]byte(abcSHA256+"\n"), "")
+	if len(entries) != 1 || entries[0].Name != "" || entries[0].Spec.Algorithm != SHA256 {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestParseManifest_HTMLIgnored(t *testing.T) {
+	html := []byte("<!DOCTYPE html>\n<html><body>Not Found</body></html>\n")
+	if entries := ParseManifest(html, SHA256); len(entries) != 0 {
+		t.Fatalf("expected no entries from HTML, got %+v", entries)
+	}
+}
+
+func TestAlgorithmFromName(t *testing.T) {
+	tests := map[string]string{
+		"file.iso.sha256":  SHA256,
+		"SHA512SUMS":       SHA512,
+		"MD5SUMS":          MD5,
+		"CHECKSUM.SHA1":    SHA1,
+		"B2SUMS":           BLAKE2b512,
+		"file.blake2b-256": BLAKE2b256,
+		"CHECKSUMS":        "",
+	}
+	for name, want := range tests {
+		if got := AlgorithmFromName(name); got != want {
+			t.Errorf("AlgorithmFromName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
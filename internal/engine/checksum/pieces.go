@@ -0,0 +1,142 @@
+package checksum
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// Results of "surge verify" beyond verified and mismatch
+const (
+	StatusRepaired = "repaired" // Bad pieces of a finished file were fetched again
+	StatusRequeued = "requeued" // Bad pieces of a paused file will be fetched on resume
+)
+
+// ParsePieces reads a piece hash manifest: a "<algo> <piece-length>" line
+// followed by the hex digest of every piece, one per line. Blank lines and
+// lines starting with # are ignored.
+//
+//	# ubuntu.iso, 4 MiB pieces
+//	sha256 4194304
+//	9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//	...
+func ParsePieces(data []byte) (*types.PieceHashes, error) {
+	var p *types.PieceHashes
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if p == nil {
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: expected \"<algorithm> <piece length>\"", n)
+			}
+			algo, ok := Algorithm(fields[0])
+			if !ok {
+				return nil, fmt.Errorf("line %d: unsupported checksum algorithm %q", n, fields[0])
+			}
+			length, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil || length <= 0 {
+				return nil, fmt.Errorf("line %d: invalid piece length %q", n, fields[1])
+			}
+			p = &types.PieceHashes{Algorithm: algo, Length: length}
+			continue
+		}
+
+		digest := strings.ToLower(line)
+		if _, err := Parse(p.Algorithm + ":" + digest); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		p.Hashes = append(p.Hashes, digest)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if p == nil || len(p.Hashes) == 0 {
+		return nil, fmt.Errorf("no piece hashes found")
+	}
+	return p, nil
+}
+
+// FormatPieces writes p in the format ParsePieces reads
+func FormatPieces(p *types.PieceHashes) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %d\n", p.Algorithm, p.Length)
+	for _, h := range p.Hashes {
+		b.WriteString(h)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// VerifyPieces hashes every piece of the size byte file at path. Pieces that
+// overlap one of the missing ranges (not downloaded yet) are skipped. It
+// returns the byte ranges of the pieces that don't match and how many pieces
+// were checked.
+func VerifyPieces(ctx context.Context, path string, pieces *types.PieceHashes, size int64, missing []types.Task) ([]types.Task, int, error) {
+	count := pieces.Count(size)
+	if count == 0 || count != len(pieces.Hashes) {
+		return nil, 0, fmt.Errorf("%d piece hashes of %d bytes don't fit a file of %d bytes", len(pieces.Hashes), pieces.Length, size)
+	}
+	if _, err := New(pieces.Algorithm); err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var bad []types.Task
+	checked := 0
+	for i := range count {
+		start := int64(i) * pieces.Length
+		end := min(start+pieces.Length, size)
+		if overlaps(missing, start, end) {
+			continue
+		}
+
+		ok, err := MatchesPiece(pieces, i, &ctxReader{ctx: ctx, r: io.NewSectionReader(f, start, end-start)})
+		if err != nil {
+			return nil, checked, fmt.Errorf("failed to hash piece %d: %w", i, err)
+		}
+		checked++
+		if !ok {
+			bad = append(bad, types.Task{Offset: start, Length: end - start})
+		}
+	}
+	return bad, checked, nil
+}
+
+// MatchesPiece reports whether r holds exactly piece i
+func MatchesPiece(pieces *types.PieceHashes, i int, r io.Reader) (bool, error) {
+	h, err := New(pieces.Algorithm)
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return false, err
+	}
+	return i >= 0 && i < len(pieces.Hashes) && hex.EncodeToString(h.Sum(nil)) == pieces.Hashes[i], nil
+}
+
+func overlaps(tasks []types.Task, start, end int64) bool {
+	for _, t := range tasks {
+		if t.Offset < end && t.Offset+t.Length > start {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package checksum
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestParsePieces_RoundTrip(t *testing.T) {
+	data := []byte("# two pieces\n\nSHA-256 4\n" + abcSHA256 + "\n" + "  " + abcSHA256 + "  \n")
+	p, err := ParsePieces(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Algorithm != SHA256 || p.Length != 4 || len(p.Hashes) != 2 {
+		t.Fatalf("pieces = %+v", p)
+	}
+
+	again, err := ParsePieces([]byte(FormatPieces(p)))
+	if err != nil || again.Algorithm != p.Algorithm || again.Length != p.Length || len(again.Hashes) != 2 {
+		t.Fatalf("round trip = %+v, %v", again, err)
+	}
+}
+
+func TestParsePieces_Rejects(t *testing.T) {
+	tests := map[string]string{
+		"empty":          "# nothing\n",
+		"no hashes":      "sha256 1024\n",
+		"no length":      "sha256\n" + abcSHA256,
+		"bad length":     "sha256 -5\n" + abcSHA256,
+		"unknown algo":   "crc32 1024\n00000000",
+		"wrong size":     "sha256 1024\n" + abcMD5,
+		"not hex":        "md5 1024\nzz0150983cd24fb0d6963f7d28e17f72",
+		"missing header": abcSHA256 + "\n" + abcSHA256,
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParsePieces([]byte(body)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestVerifyPieces(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	pieces := &types.PieceHashes{Algorithm: SHA256, Length: 300}
+	for start := 0; start < len(data); start += 300 {
+		sum := sha256.Sum256(data[start:min(start+300, len(data))])
+		pieces.Hashes = append(pieces.Hashes, hex.EncodeToString(sum[:]))
+	}
+
+	// Corrupt pieces 1 and 3
+	data[310] ^= 1
+	data[999] ^= 1
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bad, checked, err := VerifyPieces(context.Background(), path, pieces, 1000, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.Task{{Offset: 300, Length: 300}, {Offset: 900, Length: 100}}
+	if checked != 4 || len(bad) != 2 || bad[0] != want[0] || bad[1] != want[1] {
+		t.Fatalf("VerifyPieces = %v (%d checked), want %v", bad, checked, want)
+	}
+
+	// Pieces still being downloaded aren't judged
+	bad, checked, err = VerifyPieces(context.Background(), path, pieces, 1000, []types.Task{{Offset: 850, Length: 150}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != 2 || len(bad) != 1 || bad[0] != want[0] {
+		t.Fatalf("VerifyPieces with missing = %v (%d checked)", bad, checked)
+	}
+
+	if _, _, err := VerifyPieces(context.Background(), path, pieces, 5000, nil); err == nil {
+		t.Error("expected an error for a size the pieces don't cover")
+	}
+}
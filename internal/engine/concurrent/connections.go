@@ -0,0 +1,217 @@
+package concurrent
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+const (
+	// tuneInterval is how often throughput is sampled to adjust the worker count
+	tuneInterval = 3 * time.Second
+
+	// tuneMinGain is the relative throughput increase an extra worker must bring
+	tuneMinGain = 0.05
+
+	// tuneHold is how many samples to wait after backing off before probing again
+	tuneHold = 4
+)
+
+// workerSet starts and retires download workers while a download runs
+type workerSet struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	running  int
+	started  int
+	retiring int
+	run      func(id int)
+}
+
+// Add starts one more worker. Returns false once every worker has exited,
+// since the download is finishing and nobody would pick up work.
+func (w *workerSet) Add() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started > 0 && w.running == 0 {
+		return false
+	}
+	id := w.started
+	w.started++
+	w.running++
+	w.wg.Add(1)
+	go func() {
+		defer w.exit()
+		w.run(id)
+	}()
+	return true
+}
+
+func (w *workerSet) exit() {
+	w.mu.Lock()
+	w.running--
+	w.mu.Unlock()
+	w.wg.Done()
+}
+
+// Retire asks one worker to exit after its current task. The last worker is never retired.
+func (w *workerSet) Retire() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running-w.retiring <= 1 {
+		return false
+	}
+	w.retiring++
+	return true
+}
+
+// shouldExit is called by workers between tasks and claims a pending retirement
+func (w *workerSet) shouldExit() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.retiring > 0 {
+		w.retiring--
+		return true
+	}
+	return false
+}
+
+// Running returns the number of worker goroutines still alive
+func (w *workerSet) Running() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.running
+}
+
+// Target returns the number of workers once pending retirements complete
+func (w *workerSet) Target() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.running - w.retiring
+}
+
+// Wait blocks until every worker has exited
+func (w *workerSet) Wait() {
+	w.wg.Wait()
+}
+
+// connectionTuner decides from throughput samples whether another connection
+// pays for itself. It probes upwards one worker at a time, keeps going while
+// throughput rises, and steps back when it stops rising or errors show up.
+type connectionTuner struct {
+	min, max   int
+	prevRate   float64
+	prevErrors int64
+	lastAdded  bool
+	hold       int
+}
+
+// step records a throughput sample (bytes/sec) and the running error count and
+// returns +1, -1 or 0 workers together with the reason for the change.
+// canGrow is false when adding workers can't help (bandwidth limit, host
+// backoff, little work left).
+func (t *connectionTuner) step(current int, rate float64, errors int64, canGrow bool) (int, string) {
+	newErrors := errors - t.prevErrors
+	t.prevErrors = errors
+	if t.hold > 0 {
+		t.hold--
+	}
+
+	prevRate := t.prevRate
+	added := t.lastAdded
+	t.prevRate = rate
+	t.lastAdded = false
+
+	switch {
+	case newErrors > 0 && current > t.min:
+		t.hold = tuneHold
+		return -1, fmt.Sprintf("%d errors, backing off", newErrors)
+
+	case added && rate < prevRate*(1+tuneMinGain) && current > t.min:
+		// The last worker didn't bring enough to justify its connection
+		t.hold = tuneHold
+		return -1, "diminishing returns"
+
+	case added && canGrow && current < t.max:
+		t.lastAdded = true
+		return 1, "throughput rising"
+
+	case !added && t.hold == 0 && canGrow && current < t.max && rate > 0:
+		t.lastAdded = true
+		return 1, "probing for more throughput"
+	}
+	return 0, ""
+}
+
+// tuneConnections samples throughput every tuneInterval and grows or shrinks
+// the worker set within the host's connection limit until ctx is done.
+func (d *ConcurrentDownloader) tuneConnections(ctx context.Context, workers *workerSet, rawurl string, fileSize int64) {
+	if d.State == nil {
+		return
+	}
+
+	tuner := &connectionTuner{min: 1, max: d.maxConnections()}
+	host := ""
+	if u, err := url.Parse(rawurl); err == nil {
+		host = types.HostKey(u)
+	}
+
+	ticker := time.NewTicker(tuneInterval)
+	defer ticker.Stop()
+
+	lastBytes := d.State.Downloaded.Load()
+	lastTime := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			downloaded := d.State.Downloaded.Load()
+			rate := float64(downloaded-lastBytes) / now.Sub(lastTime).Seconds()
+			lastBytes, lastTime = downloaded, now
+
+			canGrow := !d.State.IsThrottled() && fileSize-downloaded > 2*d.Runtime.GetMinChunkSize()
+			if wait, allowed := d.Backoff.Status(host); wait > 0 || allowed >= 0 {
+				canGrow = false
+			}
+
+			current := workers.Target()
+			delta, reason := tuner.step(current, rate, d.taskErrors.Load(), canGrow)
+			switch {
+			case delta > 0 && workers.Add():
+				utils.Debug("Connections: %d -> %d (%s)", current, current+1, reason)
+				d.State.SetConnectionTarget(current+1, reason)
+			case delta < 0 && workers.Retire():
+				utils.Debug("Connections: %d -> %d (%s)", current, current-1, reason)
+				d.State.SetConnectionTarget(current-1, reason)
+				d.cancelSlowestTask()
+			}
+		}
+	}
+}
+
+// cancelSlowestTask interrupts the slowest active task so a retiring worker
+// exits promptly. Its remaining bytes are requeued like a health cancellation.
+func (d *ConcurrentDownloader) cancelSlowestTask() {
+	d.activeMu.Lock()
+	defer d.activeMu.Unlock()
+
+	var slowest *ActiveTask
+	slowestSpeed := 0.0
+	for _, active := range d.activeTasks {
+		if atomic.LoadInt32(&active.HostWait) == 1 {
+			continue
+		}
+		if speed := active.GetSpeed(); slowest == nil || speed < slowestSpeed {
+			slowest, slowestSpeed = active, speed
+		}
+	}
+	if slowest != nil && slowest.Cancel != nil {
+		slowest.Cancel()
+	}
+}
@@ -0,0 +1,124 @@
+package concurrent
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConnectionTuner_GrowsWhileThroughputRises(t *testing.T) {
+	tuner := &connectionTuner{min: 1, max: 4}
+
+	delta, reason := tuner.step(2, 10e6, 0, true)
+	if delta != 1 || reason != "probing for more throughput" {
+		t.Fatalf("first sample = (%d, %q), want probe", delta, reason)
+	}
+
+	// 20% better with the extra worker: keep going
+	delta, reason = tuner.step(3, 12e6, 0, true)
+	if delta != 1 || reason != "throughput rising" {
+		t.Fatalf("rising sample = (%d, %q), want +1", delta, reason)
+	}
+
+	// Barely better: the last worker isn't worth it
+	delta, reason = tuner.step(4, 12.1e6, 0, true)
+	if delta != -1 || reason != "diminishing returns" {
+		t.Fatalf("flat sample = (%d, %q), want -1", delta, reason)
+	}
+
+	// Holds off probing for a while after stepping back
+	for i := 0; i < tuneHold-1; i++ {
+		if delta, _ := tuner.step(3, 12e6, 0, true); delta != 0 {
+			t.Fatalf("sample %d during hold changed workers by %d", i, delta)
+		}
+	}
+	if delta, _ := tuner.step(3, 12e6, 0, true); delta != 1 {
+		t.Errorf("expected a new probe after the hold, got %d", delta)
+	}
+}
+
+func TestConnectionTuner_ShrinksOnErrors(t *testing.T) {
+	tuner := &connectionTuner{min: 1, max: 8}
+
+	tuner.step(4, 10e6, 0, false)
+	delta, reason := tuner.step(4, 10e6, 3, false)
+	if delta != -1 || reason != "3 errors, backing off" {
+		t.Fatalf("error sample = (%d, %q), want -1", delta, reason)
+	}
+
+	// Same error count again: no new errors, nothing to do
+	if delta, _ := tuner.step(3, 10e6, 3, false); delta != 0 {
+		t.Errorf("no new errors changed workers by %d", delta)
+	}
+
+	// Never below min
+	if delta, _ := tuner.step(1, 10e6, 10, false); delta != 0 {
+		t.Errorf("shrunk below min: %d", delta)
+	}
+}
+
+func TestConnectionTuner_RespectsBounds(t *testing.T) {
+	tuner := &connectionTuner{min: 1, max: 2}
+
+	if delta, _ := tuner.step(2, 10e6, 0, true); delta != 0 {
+		t.Errorf("grew past max: %d", delta)
+	}
+	if delta, _ := tuner.step(1, 10e6, 0, false); delta != 0 {
+		t.Errorf("grew while growth is blocked: %d", delta)
+	}
+	if delta, _ := tuner.step(1, 0, 0, true); delta != 0 {
+		t.Errorf("grew without any throughput: %d", delta)
+	}
+}
+
+func TestWorkerSet_AddAndRetire(t *testing.T) {
+	stop := make(chan struct{})
+	var exited atomic.Int32
+	var w *workerSet
+	w = &workerSet{run: func(id int) {
+		defer exited.Add(1)
+		for {
+			if w.shouldExit() {
+				return
+			}
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}}
+
+	for i := 0; i < 3; i++ {
+		if !w.Add() {
+			t.Fatal("Add failed while workers are running")
+		}
+	}
+	if w.Target() != 3 {
+		t.Fatalf("Target = %d, want 3", w.Target())
+	}
+
+	if !w.Retire() || !w.Retire() {
+		t.Fatal("Retire failed")
+	}
+	if w.Retire() {
+		t.Error("the last worker must not be retired")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for w.Running() != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if w.Running() != 1 {
+		t.Fatalf("Running = %d after retiring two of three", w.Running())
+	}
+
+	close(stop)
+	w.Wait()
+	if exited.Load() != 3 {
+		t.Errorf("exited = %d, want 3", exited.Load())
+	}
+	if w.Add() {
+		t.Error("Add should refuse once every worker has exited")
+	}
+}
@@ -3,6 +3,7 @@ package concurrent
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"math"
 	"net"
@@ -12,10 +13,12 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/proxy"
 
+	"github.com/surge-downloader/surge/internal/engine/backoff"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
@@ -33,6 +36,15 @@ type ConcurrentDownloader struct {
 	Runtime      *types.RuntimeConfig
 	bufPool      sync.Pool
 	Headers      map[string]string // Custom HTTP headers from browser (cookies, auth, etc.)
+	ETag         string            // Validators from the probe, sent as If-Range and checked on resume
+	LastModified string
+	Backoff      *backoff.Controller // Per-host throttling state shared with other downloads
+	Pieces       *types.PieceHashes  // Hashes to check every piece against as it completes, nil to skip
+	StateKey     string              // URL the download was added as, if it fetches another one (metalinks)
+	taskErrors   atomic.Int64        // Failed task attempts, watched by the connection tuner
+	workers      *workerSet
+	pieces       *pieceVerifier
+	queue        *TaskQueue
 }
 
 // NewConcurrentDownloader creates a new concurrent downloader with all required parameters
@@ -51,6 +63,7 @@ func NewConcurrentDownloader(id string, progressCh chan<- any, progState *types.
 		State:        progState,
 		activeTasks:  make(map[int]*ActiveTask),
 		Runtime:      runtime,
+		Backoff:      backoff.Default,
 		bufPool: sync.Pool{
 			New: func() any {
 				// Use configured buffer size
@@ -62,9 +75,19 @@ func NewConcurrentDownloader(id string, progressCh chan<- any, progState *types.
 	}
 }
 
+// maxConnections returns the connection limit for the download's host,
+// honouring per-host overrides
+func (d *ConcurrentDownloader) maxConnections() int {
+	u, err := url.Parse(d.URL)
+	if err != nil {
+		return d.Runtime.GetMaxConnectionsPerHost()
+	}
+	return d.Runtime.GetHostConnectionLimit(types.HostKey(u))
+}
+
 // getInitialConnections returns the starting number of connections based on file size
 func (d *ConcurrentDownloader) getInitialConnections(fileSize int64) int {
-	maxConns := d.Runtime.GetMaxConnectionsPerHost()
+	maxConns := d.maxConnections()
 	minChunkSize := d.Runtime.GetMinChunkSize() // e.g., 1MB or 5MB
 
 	if fileSize <= 0 {
@@ -187,8 +210,14 @@ func createTasks(fileSize, chunkSize int64) []types.Task {
 
 // newConcurrentClient creates an http.Client tuned for concurrent downloads
 func (d *ConcurrentDownloader) newConcurrentClient(numConns int) *http.Client {
+	return NewHTTPClient(d.Runtime, numConns)
+}
+
+// NewHTTPClient creates an http.Client for numConns parallel connections that
+// honours the proxy and TLS settings in runtime
+func NewHTTPClient(runtime *types.RuntimeConfig, numConns int) *http.Client {
 	// Ensure we have enough connections per host
-	maxConns := d.Runtime.GetMaxConnectionsPerHost()
+	maxConns := runtime.GetMaxConnectionsPerHost()
 	if numConns > maxConns {
 		maxConns = numConns
 	}
@@ -219,15 +248,15 @@ func (d *ConcurrentDownloader) newConcurrentClient(numConns int) *http.Client {
 	}
 
 	// Configure proxy (HTTP/HTTPS or SOCKS5)
-	if d.Runtime.ProxyURL != "" {
-		parsedURL, err := url.Parse(d.Runtime.ProxyURL)
+	if runtime != nil && runtime.ProxyURL != "" {
+		parsedURL, err := url.Parse(runtime.ProxyURL)
 		if err != nil {
-			utils.Debug("Invalid proxy URL %s: %v", d.Runtime.ProxyURL, err)
+			utils.Debug("Invalid proxy URL %s: %v", runtime.ProxyURL, err)
 			transport.Proxy = http.ProxyFromEnvironment
 		} else {
 			// Check if it's a SOCKS5 proxy
 			if strings.HasPrefix(parsedURL.Scheme, "socks5") {
-				utils.Debug("Using SOCKS5 proxy: %s", d.Runtime.ProxyURL)
+				utils.Debug("Using SOCKS5 proxy: %s", runtime.ProxyURL)
 				// Create SOCKS5 dialer
 				dialer, err := proxy.SOCKS5("tcp", parsedURL.Host, nil, proxy.Direct)
 				if err != nil {
@@ -249,7 +278,7 @@ func (d *ConcurrentDownloader) newConcurrentClient(numConns int) *http.Client {
 	}
 
 	// Configure TLS settings
-	if d.Runtime != nil && d.Runtime.SkipTLSVerification {
+	if runtime != nil && runtime.SkipTLSVerification {
 		transport.TLSClientConfig = &tls.Config{
 			InsecureSkipVerify: true,
 		}
@@ -261,20 +290,14 @@ func (d *ConcurrentDownloader) newConcurrentClient(numConns int) *http.Client {
 		// Preserve headers on redirects for authenticated downloads
 		// By default, Go strips sensitive headers (Cookie, Authorization) on cross-domain redirects.
 		// Since these headers were explicitly provided by the browser for this download, we forward them.
+		// Stored credentials only go to the host they are stored for.
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			if len(via) >= 10 {
 				return fmt.Errorf("stopped after 10 redirects")
 			}
-			// Copy headers from original request to redirect request
-			if len(via) > 0 {
-				for key, vals := range via[0].Header {
-					// Skip Range header - we set our own for parallel downloads
-					if key == "Range" {
-						continue
-					}
-					req.Header[key] = vals
-				}
-			}
+			// Copy headers from original request to redirect request,
+			// except stored credentials meant for another host
+			runtime.CopyRedirectHeaders(req, via)
 			return nil
 		},
 	}
@@ -288,6 +311,10 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 	// Store URL and path for pause/resume (final path without .surge)
 	d.URL = rawurl
 	d.DestPath = destPath
+	stateURL := rawurl
+	if d.StateKey != "" {
+		stateURL = d.StateKey
+	}
 
 	// Initialize mirror status in state
 	if d.State != nil {
@@ -358,9 +385,17 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 	tasks := createTasks(fileSize, chunkSize)
 
 	// Check for saved state BEFORE truncating (resume case)
-	savedState, err := state.LoadState(rawurl, destPath)
+	savedState, err := state.LoadState(stateURL, destPath)
 	isResume := err == nil && savedState != nil && len(savedState.Tasks) > 0
 
+	if isResume {
+		// The saved bytes belong to the old file if the server replaced it
+		if err := savedState.ValidateRemote(fileSize, d.ETag, d.LastModified); err != nil {
+			utils.Debug("Discarding saved state and restarting: %v", err)
+			isResume = false
+		}
+	}
+
 	if isResume {
 		// Resume: use saved tasks and restore downloaded counter
 		tasks = savedState.Tasks
@@ -394,11 +429,23 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		// Robustness: ensure state counter starts at 0 for fresh download
 		if d.State != nil {
 			d.State.Downloaded.Store(0)
+			d.State.VerifiedProgress.Store(0)
 			d.State.SyncSessionStart()
 		}
 	}
 	queue := NewTaskQueue()
 	queue.PushMultiple(tasks)
+	d.queue = queue
+
+	if d.Pieces != nil {
+		remaining := tasks
+		if !isResume {
+			remaining = []types.Task{{Offset: 0, Length: fileSize}}
+		}
+		if d.pieces, err = newPieceVerifier(d.Pieces, outFile, fileSize, remaining); err != nil {
+			utils.Debug("Not verifying pieces: %v", err)
+		}
+	}
 
 	// Start balancer goroutine for dynamic chunk splitting
 	balancerCtx, cancelBalancer := context.WithCancel(downloadCtx)
@@ -443,6 +490,10 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		}
 	}()
 
+	// Workers are started below; the completion monitor needs their count
+	workers := &workerSet{}
+	d.workers = workers
+
 	// Monitor for completion
 	wgHelpers.Add(1)
 	go func() {
@@ -461,7 +512,7 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 			case <-ticker.C:
 				// Ensure queue is empty (no pending retries) before considering byte count.
 				// This protects against cutting off active retries even if byte count seems high (due to overlaps etc).
-				if queue.Len() == 0 && (int(queue.IdleWorkers()) == numConns || d.State.Downloaded.Load() >= fileSize) {
+				if queue.Len() == 0 && (int(queue.IdleWorkers()) == workers.Running() || d.State.Downloaded.Load() >= fileSize) {
 					queue.Close()
 					return
 				}
@@ -487,8 +538,7 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 	}()
 
 	// Start workers
-	var wg sync.WaitGroup
-	workerErrors := make(chan error, numConns)
+	workerErrors := make(chan error, d.maxConnections())
 
 	// Combine primary + secondary for workers
 	// We want to ensure the primary is included if it was valid (it should be, otherwise TUIDownload would have failed)
@@ -511,20 +561,34 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		workerMirrors = []string{rawurl}
 	}
 
-	for i := 0; i < numConns; i++ {
-		wg.Add(1)
-		go func(workerID int) {
-			defer wg.Done()
-			err := d.worker(downloadCtx, workerID, workerMirrors, outFile, queue, fileSize, client)
-			if err != nil && err != context.Canceled {
-				workerErrors <- err
+	workers.run = func(workerID int) {
+		err := d.worker(downloadCtx, workerID, workerMirrors, outFile, queue, fileSize, client)
+		if err != nil && err != context.Canceled {
+			workerErrors <- err
+			// Bytes from the new file can't be mixed with what we have, and a
+			// piece no mirror gets right won't get better: stop everyone
+			if errors.Is(err, types.ErrRemoteChanged) || errors.Is(err, types.ErrCorruptPiece) {
+				cancel()
 			}
-		}(i)
+		}
+	}
+	for i := 0; i < numConns; i++ {
+		workers.Add()
+	}
+	if d.State != nil {
+		d.State.SetConnectionTarget(numConns, "initial estimate")
 	}
 
+	// Grow or shrink the worker count as throughput allows
+	wgHelpers.Add(1)
+	go func() {
+		defer wgHelpers.Done()
+		d.tuneConnections(balancerCtx, workers, rawurl, fileSize)
+	}()
+
 	// Wait for all workers to complete
 	go func() {
-		wg.Wait()
+		workers.Wait()
 		close(workerErrors)
 		queue.Close()
 	}()
@@ -570,9 +634,11 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		chunkBitmap = bitmap
 		actualChunkSize = chunkSize
 
+		priority, queueOrder := d.State.GetPriority()
+
 		// Save state for resume (use computed value for consistency)
 		s := &types.DownloadState{
-			URL:             d.URL,
+			URL:             stateURL,
 			ID:              d.ID,
 			DestPath:        destPath,
 			TotalSize:       fileSize,
@@ -583,8 +649,16 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 			Mirrors:         candidateMirrors,
 			ChunkBitmap:     chunkBitmap,
 			ActualChunkSize: actualChunkSize,
+			RateLimit:       d.State.GetRateLimit(),
+			Checksum:        d.State.GetChecksum(),
+			ETag:            d.ETag,
+			LastModified:    d.LastModified,
+			Priority:        priority,
+			QueueOrder:      queueOrder,
+			BatchID:         d.State.GetBatchID(),
+			Category:        d.State.GetCategory(),
 		}
-		if err := state.SaveState(d.URL, destPath, s); err != nil {
+		if err := state.SaveState(stateURL, destPath, s); err != nil {
 			utils.Debug("Failed to save pause state: %v", err)
 		}
 
@@ -593,6 +667,10 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		return types.ErrPaused // Signal valid pause to caller
 	}
 
+	if errors.Is(downloadErr, types.ErrRemoteChanged) || errors.Is(downloadErr, types.ErrCorruptPiece) {
+		return downloadErr
+	}
+
 	// Handle cancel: context was cancelled but not via Pause()
 	// Propagate cancellation so callers don't treat this as a successful completion.
 	if downloadCtx.Err() == context.Canceled {
@@ -611,14 +689,14 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 	// Close file before renaming
 	_ = outFile.Close()
 
-	// Rename from .surge to final destination
-	if err := os.Rename(workingPath, destPath); err != nil {
+	// Rename from .surge to final destination, leaving a file that showed up there meanwhile to the caller
+	if err := utils.RenameNoReplace(workingPath, destPath); err != nil {
 		// Check for race condition: did someone else already rename it?
 		if os.IsNotExist(err) {
 			if info, statErr := os.Stat(destPath); statErr == nil && info.Size() == fileSize {
 				utils.Debug("Race condition detected: File already exists and has correct size. Treating as success.")
 				// Clean up state just in case, though usually done by caller
-				_ = state.DeleteState(d.ID, d.URL, destPath)
+				_ = state.DeleteState(d.ID, stateURL, destPath)
 				return nil
 			}
 		}
@@ -626,7 +704,7 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 	}
 
 	// Delete state file on successful completion
-	_ = state.DeleteState(d.ID, d.URL, destPath)
+	_ = state.DeleteState(d.ID, stateURL, destPath)
 
 	// Note: Download completion notifications are handled by the TUI via DownloadCompleteMsg
 
@@ -4,24 +4,38 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
+// throttledStallTimeout is the minimum stall timeout used while a bandwidth limit applies
+const throttledStallTimeout = 30 * time.Second
+
 // checkWorkerHealth detects slow workers and cancels them
 func (d *ConcurrentDownloader) checkWorkerHealth() {
 	d.activeMu.Lock()
 	defer d.activeMu.Unlock()
+	CheckWorkerHealth(d.activeTasks, d.State, d.Runtime)
+}
 
-	if len(d.activeTasks) == 0 {
+// CheckWorkerHealth cancels the tasks in activeTasks that stalled or run far
+// below the mean speed, so their workers can requeue them. progress may be
+// nil. The caller must hold the lock that guards activeTasks.
+func CheckWorkerHealth(activeTasks map[int]*ActiveTask, progress *types.ProgressState, runtime *types.RuntimeConfig) {
+	if len(activeTasks) == 0 {
 		return
 	}
 
+	// While a bandwidth limit applies, worker speeds are dictated by the
+	// limiter and workers may legitimately sit in a wait for a while.
+	throttled := progress != nil && progress.IsThrottled()
+
 	now := time.Now()
 
 	// First pass: calculate mean speed
 	var totalSpeed float64
 	var speedCount int
-	for _, active := range d.activeTasks {
+	for _, active := range activeTasks {
 		if speed := active.GetSpeed(); speed > 0 {
 			totalSpeed += speed
 			speedCount++
@@ -33,8 +47,8 @@ func (d *ConcurrentDownloader) checkWorkerHealth() {
 		// If we have very few workers (e.g. 1), meanSpeed is just that worker's speed,
 		// so "workerSpeed < mean * threshold" will never trigger.
 		// Fallback to GLOBAL session speed in this case.
-		if speedCount < 2 && d.State != nil {
-			downloaded, _, _, sessionElapsed, _, sessionStartBytes := d.State.GetProgress()
+		if speedCount < 2 && progress != nil {
+			downloaded, _, _, sessionElapsed, _, sessionStartBytes := progress.GetProgress()
 			elapsedSeconds := sessionElapsed.Seconds()
 			if elapsedSeconds > 5.0 { // Ensure we have some history
 				globalSpeed := float64(downloaded-sessionStartBytes) / elapsedSeconds
@@ -53,14 +67,22 @@ func (d *ConcurrentDownloader) checkWorkerHealth() {
 	}
 
 	// Second pass: check for slow and stalled workers
-	stallTimeout := d.Runtime.GetStallTimeout()
-	for workerID, active := range d.activeTasks {
+	stallTimeout := runtime.GetStallTimeout()
+	if throttled && stallTimeout < throttledStallTimeout {
+		stallTimeout = throttledStallTimeout
+	}
+	for workerID, active := range activeTasks {
+
+		// Workers waiting out a host backoff aren't stalled
+		if atomic.LoadInt32(&active.HostWait) == 1 {
+			continue
+		}
 
 		// timeSinceActivity := now.Sub(lastTime)
 		taskDuration := now.Sub(active.StartTime)
 
 		// Skip workers that are still in their grace period
-		gracePeriod := d.Runtime.GetSlowWorkerGracePeriod()
+		gracePeriod := runtime.GetSlowWorkerGracePeriod()
 		if taskDuration < gracePeriod {
 			continue
 		}
@@ -82,9 +104,9 @@ func (d *ConcurrentDownloader) checkWorkerHealth() {
 
 		// Check for slow worker (relative speed)
 		// Only cancel if: below threshold
-		if meanSpeed > 0 {
+		if meanSpeed > 0 && !throttled {
 			workerSpeed := active.GetSpeed()
-			threshold := d.Runtime.GetSlowWorkerThreshold()
+			threshold := runtime.GetSlowWorkerThreshold()
 			isBelowThreshold := workerSpeed > 0 && workerSpeed < threshold*meanSpeed
 
 			if isBelowThreshold {
@@ -0,0 +1,182 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+// versionedServer serves data with the given ETag and honours If-Range the way
+// real servers do: a stale validator gets the whole file with 200.
+type versionedServer struct {
+	mu       sync.Mutex
+	data     []byte
+	etag     string
+	ifRanges []string
+	ranges   []string
+}
+
+func (v *versionedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	v.ifRanges = append(v.ifRanges, r.Header.Get("If-Range"))
+	v.ranges = append(v.ranges, r.Header.Get("Range"))
+	data, etag := v.data, v.etag
+	v.mu.Unlock()
+
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+func patternData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestConcurrentDownloader_SendsIfRange(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(4 * types.MB)
+	srv := &versionedServer{data: patternData(int(fileSize)), etag: `"v1"`}
+	server := testutil.NewHTTPServerT(t, srv)
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "if_range.bin")
+	progState := types.NewProgressState("if-range", fileSize)
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 1 * types.MB}
+
+	d := NewConcurrentDownloader("if-range", nil, progState, runtime)
+	d.ETag = `"v1"`
+	d.LastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := d.Download(ctx, server.URL, nil, nil, destPath, fileSize); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.ifRanges) == 0 {
+		t.Fatal("no requests received")
+	}
+	for i, v := range srv.ifRanges {
+		if v != `"v1"` {
+			t.Errorf("request %d: If-Range = %q, want strong ETag", i, v)
+		}
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, srv.data) {
+		t.Error("downloaded content does not match")
+	}
+}
+
+func TestConcurrentDownloader_RemoteChangedMidDownload(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(4 * types.MB)
+	srv := &versionedServer{data: patternData(int(fileSize)), etag: `"v2"`}
+	server := testutil.NewHTTPServerT(t, srv)
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "changed.bin")
+	progState := types.NewProgressState("changed", fileSize)
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 1 * types.MB}
+
+	d := NewConcurrentDownloader("changed", nil, progState, runtime)
+	d.ETag = `"v1"` // What the probe saw before the file was replaced
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := d.Download(ctx, server.URL, nil, nil, destPath, fileSize)
+	if !errors.Is(err, types.ErrRemoteChanged) {
+		t.Fatalf("Download error = %v, want ErrRemoteChanged", err)
+	}
+	if _, statErr := os.Stat(destPath); statErr == nil {
+		t.Error("changed download should not be renamed to its final path")
+	}
+}
+
+func TestConcurrentDownloader_ResumeRestartsWhenRemoteChanged(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(4 * types.MB)
+	srv := &versionedServer{data: patternData(int(fileSize)), etag: `"v2"`}
+	server := testutil.NewHTTPServerT(t, srv)
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "resume_changed.bin")
+
+	// Paused halfway through the old version: only the second half remains
+	half := fileSize / 2
+	if err := os.WriteFile(destPath+types.IncompleteSuffix, make([]byte, fileSize), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SaveState(server.URL, destPath, &types.DownloadState{
+		ID:         "resume-changed",
+		URL:        server.URL,
+		DestPath:   destPath,
+		TotalSize:  fileSize,
+		Downloaded: half,
+		Tasks:      []types.Task{{Offset: half, Length: fileSize - half}},
+		Filename:   filepath.Base(destPath),
+		ETag:       `"v1"`,
+	}); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	progState := types.NewProgressState("resume-changed", fileSize)
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 1 * types.MB}
+
+	d := NewConcurrentDownloader("resume-changed", nil, progState, runtime)
+	d.ETag = `"v2"` // Fresh probe sees the new version
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := d.Download(ctx, server.URL, nil, nil, destPath, fileSize); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, srv.data) {
+		t.Error("restarted download should contain only the new version")
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	fromStart := false
+	for _, r := range srv.ranges {
+		if strings.HasPrefix(r, "bytes=0-") {
+			fromStart = true
+		}
+	}
+	if !fromStart {
+		t.Errorf("expected the download to restart from offset 0, got ranges %v", srv.ranges)
+	}
+}
@@ -0,0 +1,192 @@
+package concurrent
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// maxPieceFailures is how often one piece may fail its hash before the
+// download gives up on it
+const maxPieceFailures = 5
+
+// span is a received byte range [start, end)
+type span struct {
+	start, end int64
+}
+
+// pieceVerifier hashes every piece of the file once all of its bytes have
+// been written. Byte ranges arrive in any order and may overlap (stolen and
+// hedged tasks), so each piece keeps the set of ranges it has received.
+type pieceVerifier struct {
+	hashes *types.PieceHashes
+	file   *os.File
+	size   int64
+
+	mu       sync.Mutex
+	have     [][]span // Received ranges of each piece still being filled
+	done     []bool   // Piece is verified or being hashed
+	failures []int
+}
+
+// newPieceVerifier prepares verification of a file of size bytes. remaining
+// lists what hasn't been downloaded yet; pieces entirely outside of it were
+// verified before the download was paused.
+func newPieceVerifier(hashes *types.PieceHashes, file *os.File, size int64, remaining []types.Task) (*pieceVerifier, error) {
+	if _, err := checksum.New(hashes.Algorithm); err != nil {
+		return nil, err
+	}
+	count := hashes.Count(size)
+	if count == 0 || count != len(hashes.Hashes) {
+		return nil, fmt.Errorf("%d piece hashes of %d bytes don't fit a file of %d bytes", len(hashes.Hashes), hashes.Length, size)
+	}
+
+	v := &pieceVerifier{
+		hashes:   hashes,
+		file:     file,
+		size:     size,
+		have:     make([][]span, count),
+		done:     make([]bool, count),
+		failures: make([]int, count),
+	}
+	for i := range v.have {
+		start, end := v.bounds(i)
+		v.have[i] = []span{{start, end}}
+	}
+	for _, task := range remaining {
+		v.remove(task.Offset, task.Offset+task.Length)
+	}
+	for i := range v.have {
+		start, end := v.bounds(i)
+		v.done[i] = covered(v.have[i], start, end)
+	}
+	return v, nil
+}
+
+// bounds returns the byte range of piece i
+func (v *pieceVerifier) bounds(i int) (int64, int64) {
+	start := int64(i) * v.hashes.Length
+	return start, min(start+v.hashes.Length, v.size)
+}
+
+// remove takes [start, end) out of the received ranges
+func (v *pieceVerifier) remove(start, end int64) {
+	for i := range v.have {
+		pStart, pEnd := v.bounds(i)
+		if pEnd <= start || pStart >= end {
+			continue
+		}
+		var kept []span
+		for _, s := range v.have[i] {
+			if s.end <= start || s.start >= end {
+				kept = append(kept, s)
+				continue
+			}
+			if s.start < start {
+				kept = append(kept, span{s.start, start})
+			}
+			if s.end > end {
+				kept = append(kept, span{end, s.end})
+			}
+		}
+		v.have[i] = kept
+	}
+}
+
+// add records that [offset, offset+length) has been written and hashes the
+// pieces it completes. It returns the pieces that failed as tasks to fetch
+// again, with ErrCorruptPiece once one of them has failed too often.
+func (v *pieceVerifier) add(offset, length int64) ([]types.Task, error) {
+	end := offset + length
+	first := int(offset / v.hashes.Length)
+	last := int((end - 1) / v.hashes.Length)
+
+	var complete []int
+	v.mu.Lock()
+	for i := max(first, 0); i <= last && i < len(v.have); i++ {
+		if v.done[i] {
+			continue
+		}
+		pStart, pEnd := v.bounds(i)
+		v.have[i] = merge(v.have[i], span{max(offset, pStart), min(end, pEnd)})
+		if covered(v.have[i], pStart, pEnd) {
+			v.done[i] = true
+			complete = append(complete, i)
+		}
+	}
+	v.mu.Unlock()
+
+	var (
+		failed []types.Task
+		err    error
+	)
+	for _, i := range complete {
+		ok, hashErr := v.verify(i)
+		if hashErr != nil {
+			utils.Debug("Hashing piece %d: %v", i, hashErr)
+		}
+		if ok {
+			continue
+		}
+
+		start, end := v.bounds(i)
+		v.mu.Lock()
+		v.done[i] = false
+		v.have[i] = nil
+		v.failures[i]++
+		failures := v.failures[i]
+		v.mu.Unlock()
+
+		failed = append(failed, types.Task{Offset: start, Length: end - start})
+		if failures >= maxPieceFailures {
+			err = fmt.Errorf("%w: piece %d (bytes %d-%d) failed %d times", types.ErrCorruptPiece, i, start, end-1, failures)
+			continue
+		}
+		utils.Debug("Piece %d (bytes %d-%d) failed verification, fetching it again", i, start, end-1)
+	}
+	return failed, err
+}
+
+// verify hashes piece i from the file
+func (v *pieceVerifier) verify(i int) (bool, error) {
+	h, err := checksum.New(v.hashes.Algorithm)
+	if err != nil {
+		return false, err
+	}
+	start, end := v.bounds(i)
+	if _, err := io.Copy(h, io.NewSectionReader(v.file, start, end-start)); err != nil {
+		return false, err
+	}
+	return hex.EncodeToString(h.Sum(nil)) == v.hashes.Hashes[i], nil
+}
+
+// merge adds s to a set of ranges, joining the ones that touch
+func merge(spans []span, s span) []span {
+	if s.end <= s.start {
+		return spans
+	}
+	spans = append(spans, s)
+	sort.Slice(spans, func(a, b int) bool { return spans[a].start < spans[b].start })
+	merged := spans[:1]
+	for _, next := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if next.start <= last.end {
+			last.end = max(last.end, next.end)
+		} else {
+			merged = append(merged, next)
+		}
+	}
+	return merged
+}
+
+// covered reports whether spans cover [start, end)
+func covered(spans []span, start, end int64) bool {
+	return len(spans) == 1 && spans[0].start <= start && spans[0].end >= end
+}
@@ -0,0 +1,256 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func pieceHashes(data []byte, length int64) *types.PieceHashes {
+	p := &types.PieceHashes{Algorithm: "sha256", Length: length}
+	for start := int64(0); start < int64(len(data)); start += length {
+		sum := sha256.Sum256(data[start:min(start+length, int64(len(data)))])
+		p.Hashes = append(p.Hashes, hex.EncodeToString(sum[:]))
+	}
+	return p
+}
+
+// corruptingServer serves data but flips a byte of one piece in the first
+// `bad` responses that include it
+type corruptingServer struct {
+	data       []byte
+	pieceStart int64
+	bad        atomic.Int32
+	served     atomic.Int64
+
+	mu        sync.Mutex
+	requested []string
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func (c *corruptingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var start, end int64
+	_, _ = fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+	c.mu.Lock()
+	c.requested = append(c.requested, r.Header.Get("Range"))
+	c.mu.Unlock()
+
+	data := c.data
+	if start <= c.pieceStart && end >= c.pieceStart && c.bad.Add(-1) >= 0 {
+		data = bytes.Clone(c.data)
+		data[c.pieceStart] ^= 0xff
+	}
+	http.ServeContent(countingWriter{w, &c.served}, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+func TestPieceVerifier_OutOfOrderRanges(t *testing.T) {
+	data := patternData(1000)
+	f, err := os.CreateTemp(t.TempDir(), "pieces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := newPieceVerifier(pieceHashes(data, 300), f, 1000, []types.Task{{Offset: 0, Length: 1000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Overlapping ranges in any order complete pieces 1 and 0
+	for _, r := range [][2]int64{{450, 200}, {300, 200}, {0, 350}} {
+		if failed, err := v.add(r[0], r[1]); err != nil || len(failed) != 0 {
+			t.Fatalf("add(%d, %d) = %v, %v", r[0], r[1], failed, err)
+		}
+	}
+	if !v.done[0] || !v.done[1] || v.done[2] || v.done[3] {
+		t.Fatalf("done = %v, want pieces 0 and 1", v.done)
+	}
+
+	// A bad byte in the short last piece fails it alone
+	if _, err := f.WriteAt([]byte{data[950] ^ 1}, 950); err != nil {
+		t.Fatal(err)
+	}
+	failed, err := v.add(650, 350)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.Task{{Offset: 900, Length: 100}}
+	if len(failed) != 1 || failed[0] != want[0] {
+		t.Fatalf("failed = %v, want %v", failed, want)
+	}
+	if !v.done[2] || v.done[3] || v.have[3] != nil {
+		t.Fatalf("piece 3 should be reset, done = %v", v.done)
+	}
+}
+
+func TestPieceVerifier_ResumeSkipsFinishedPieces(t *testing.T) {
+	data := patternData(1000)
+	f, err := os.CreateTemp(t.TempDir(), "pieces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	// Bytes 0-449 were downloaded before a pause
+	v, err := newPieceVerifier(pieceHashes(data, 300), f, 1000, []types.Task{{Offset: 450, Length: 550}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.done[0] || v.done[1] {
+		t.Fatalf("done = %v, want only piece 0", v.done)
+	}
+	if got := v.have[1]; len(got) != 1 || got[0] != (span{300, 450}) {
+		t.Fatalf("piece 1 has %v, want [300, 450)", got)
+	}
+}
+
+func TestPieceVerifier_RejectsMismatchedHashes(t *testing.T) {
+	hashes := pieceHashes(patternData(1000), 300)
+	if _, err := newPieceVerifier(hashes, nil, 2000, nil); err == nil {
+		t.Error("expected an error for too few piece hashes")
+	}
+	hashes.Algorithm = "crc32"
+	if _, err := newPieceVerifier(hashes, nil, 1000, nil); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+}
+
+func TestConcurrentDownloader_RefetchesCorruptPiece(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(4 * types.MB)
+	pieceLen := int64(256 * types.KB)
+	data := patternData(int(fileSize))
+	srv := &corruptingServer{data: data, pieceStart: 5*pieceLen + 17}
+	srv.bad.Store(1)
+	server := testutil.NewHTTPServerT(t, srv)
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "pieces.bin")
+	progState := types.NewProgressState("pieces", fileSize)
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 1 * types.MB}
+	d := NewConcurrentDownloader("pieces", nil, progState, runtime)
+	d.Pieces = pieceHashes(data, pieceLen)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, server.URL, nil, nil, destPath, fileSize); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("downloaded file differs from the source")
+	}
+
+	// Only the bad piece came twice
+	refetch := fmt.Sprintf("bytes=%d-%d", 5*pieceLen, 6*pieceLen-1)
+	srv.mu.Lock()
+	requested := srv.requested
+	srv.mu.Unlock()
+	found := false
+	for _, r := range requested {
+		found = found || r == refetch
+	}
+	if !found {
+		t.Errorf("no request for %s in %v", refetch, requested)
+	}
+	if served := srv.served.Load(); served > fileSize+pieceLen {
+		t.Errorf("served %d bytes, want at most %d", served, fileSize+pieceLen)
+	}
+	if progState.Downloaded.Load() != fileSize {
+		t.Errorf("Downloaded = %d, want %d", progState.Downloaded.Load(), fileSize)
+	}
+}
+
+func TestConcurrentDownloader_RefetchesFromAnotherMirror(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(2 * types.MB)
+	pieceLen := int64(256 * types.KB)
+	data := patternData(int(fileSize))
+	bad := &corruptingServer{data: data, pieceStart: 3 * pieceLen}
+	bad.bad.Store(1000) // never gets it right
+	good := &corruptingServer{data: data, pieceStart: -1}
+	badServer := testutil.NewHTTPServerT(t, bad)
+	defer badServer.Close()
+	goodServer := testutil.NewHTTPServerT(t, good)
+	defer goodServer.Close()
+
+	destPath := filepath.Join(tmpDir, "mirrored.bin")
+	progState := types.NewProgressState("mirrored", fileSize)
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 512 * types.KB}
+	d := NewConcurrentDownloader("mirrored", nil, progState, runtime)
+	d.Pieces = pieceHashes(data, pieceLen)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	mirrors := []string{badServer.URL, goodServer.URL}
+	if err := d.Download(ctx, badServer.URL, mirrors, mirrors, destPath, fileSize); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("downloaded file differs from the source")
+	}
+}
+
+func TestConcurrentDownloader_GivesUpOnCorruptPiece(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(1 * types.MB)
+	pieceLen := int64(256 * types.KB)
+	data := patternData(int(fileSize))
+	srv := &corruptingServer{data: data, pieceStart: pieceLen}
+	srv.bad.Store(1000)
+	server := testutil.NewHTTPServerT(t, srv)
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "corrupt.bin")
+	progState := types.NewProgressState("corrupt", fileSize)
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 2, MinChunkSize: 512 * types.KB}
+	d := NewConcurrentDownloader("corrupt", nil, progState, runtime)
+	d.Pieces = pieceHashes(data, pieceLen)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := d.Download(ctx, server.URL, nil, nil, destPath, fileSize)
+	if !errors.Is(err, types.ErrCorruptPiece) {
+		t.Fatalf("expected ErrCorruptPiece, got %v", err)
+	}
+}
@@ -1,12 +1,16 @@
 package concurrent
 
 import (
+	"bytes"
 	"context"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/engine/backoff"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/testutil"
 )
@@ -129,3 +133,67 @@ func TestConcurrentDownloader_BackoffOnSingleMirror(t *testing.T) {
 		t.Errorf("Download took %v, but expected backoff wait (should be > 200ms)", elapsed)
 	}
 }
+
+func TestConcurrentDownloader_HonorsRetryAfter(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(256 * types.KB)
+	data := patternData(int(fileSize))
+
+	// Server: 503 with Retry-After on the first request, then serves normally
+	var requests atomic.Int32
+	server := testutil.NewHTTPServerT(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "retry_after_test.bin")
+	state := types.NewProgressState("retry-after-test", fileSize)
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 1,
+		MaxTaskRetries:        5,
+		MinChunkSize:          64 * types.KB,
+	}
+
+	downloader := NewConcurrentDownloader("retry-after-id", nil, state, runtime)
+	downloader.Backoff = backoff.New()
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := downloader.Download(ctx, server.URL, nil, nil, destPath, fileSize); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if err := testutil.VerifyFileSize(destPath, fileSize); err != nil {
+		t.Error(err)
+	}
+	if elapsed < 900*time.Millisecond {
+		t.Errorf("Download took %v, expected to wait out Retry-After (1s)", elapsed)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("Download took %v, backoff should have lifted after Retry-After", elapsed)
+	}
+}
+
+func TestNextMirror_BackoffKeyedLikeHostSlots(t *testing.T) {
+	d := NewConcurrentDownloader("key-id", nil, types.NewProgressState("key-test", 0), &types.RuntimeConfig{})
+	d.Backoff = backoff.New()
+
+	// Throttled under the key host slots use; the URL leaves the port out
+	primary, _ := url.Parse("https://example.com/a")
+	d.Backoff.Throttle(types.HostKey(primary), time.Minute)
+
+	mirrors := []string{"https://example.com/a", "https://mirror.example.org/a"}
+	if got := d.nextMirror(mirrors, 1); got != 1 {
+		t.Errorf("nextMirror = %d, want the mirror whose host isn't throttled", got)
+	}
+}
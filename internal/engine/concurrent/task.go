@@ -28,6 +28,8 @@ type ActiveTask struct {
 
 	// Hedged request tracking
 	Hedged int32 // Atomic: 1 if an idle worker is already racing this task
+
+	HostWait int32 // Atomic: 1 while waiting for the host to accept connections again
 }
 
 // RemainingBytes returns the number of bytes left for this task
@@ -75,6 +77,30 @@ func (at *ActiveTask) GetSpeed() float64 {
 	return speed
 }
 
+// RecordBytes notes n bytes received at now for the health monitor and folds
+// them into the EMA speed once per 2 second window
+func (at *ActiveTask) RecordBytes(n int64, now time.Time, alpha float64) {
+	atomic.AddInt64(&at.WindowBytes, n)
+	atomic.StoreInt64(&at.LastActivity, now.UnixNano())
+
+	windowElapsed := now.Sub(at.WindowStart).Seconds()
+	if windowElapsed < 2.0 {
+		return
+	}
+	windowBytes := atomic.SwapInt64(&at.WindowBytes, 0)
+	recentSpeed := float64(windowBytes) / windowElapsed
+
+	at.SpeedMu.Lock()
+	if at.Speed == 0 {
+		at.Speed = recentSpeed
+	} else {
+		at.Speed = (1-alpha)*at.Speed + alpha*recentSpeed
+	}
+	at.SpeedMu.Unlock()
+
+	at.WindowStart = now // Reset window
+}
+
 // alignedSplitSize calculates a split size that is half of remaining, aligned to AlignSize
 // Returns 0 if the split would be smaller than MinChunk
 func alignedSplitSize(remaining int64) int64 {
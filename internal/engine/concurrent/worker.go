@@ -2,17 +2,23 @@ package concurrent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"sync/atomic"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/engine/backoff"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
+// errThrottled is returned when a server answers 429 or 503
+var errThrottled = errors.New("server throttled")
+
 // worker downloads tasks from the queue
 func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []string, file *os.File, queue *TaskQueue, totalSize int64, client *http.Client) error {
 	// Get pooled buffer
@@ -27,6 +33,12 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 	currentMirrorIdx := id % len(mirrors)
 
 	for {
+		// The connection tuner may have asked for one worker fewer
+		if d.workers != nil && d.workers.shouldExit() {
+			utils.Debug("Worker %d retired", id)
+			return nil
+		}
+
 		// Get next task
 		task, ok := queue.Pop()
 
@@ -34,6 +46,12 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 			return nil // Queue closed, no more work
 		}
 
+		// A piece that failed verification is fetched from another mirror
+		if task.Avoid != "" && len(mirrors) > 1 && mirrors[currentMirrorIdx] == task.Avoid {
+			currentMirrorIdx = d.nextMirror(mirrors, currentMirrorIdx)
+			utils.Debug("Worker %d: refetching %d-%d from %s", id, task.Offset, task.Offset+task.Length-1, mirrors[currentMirrorIdx])
+		}
+
 		// Update active workers
 		if d.State != nil {
 			d.State.ActiveWorkers.Add(1)
@@ -44,7 +62,8 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 		for attempt := 0; attempt < maxRetries; attempt++ {
 			if attempt > 0 {
 
-				if len(mirrors) == 1 {
+				// Throttled hosts are waited out in downloadTask, no need to sleep here too
+				if len(mirrors) == 1 && !errors.Is(lastErr, errThrottled) {
 					time.Sleep(time.Duration(1<<attempt) * types.RetryBaseDelay) // Exponential backoff incase of failure
 				}
 
@@ -52,7 +71,7 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 				// Report error for the previous mirror
 				d.ReportMirrorError(mirrors[currentMirrorIdx])
 
-				currentMirrorIdx = (currentMirrorIdx + 1) % len(mirrors)
+				currentMirrorIdx = d.nextMirror(mirrors, currentMirrorIdx)
 				utils.Debug("Worker %d: switching to mirror %s (attempt %d)", id, mirrors[currentMirrorIdx], attempt+1)
 			}
 
@@ -138,6 +157,14 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 			delete(d.activeTasks, id)
 			d.activeMu.Unlock()
 
+			// Retrying or switching mirrors can't fix a replaced file
+			if errors.Is(lastErr, types.ErrRemoteChanged) || errors.Is(lastErr, types.ErrCorruptPiece) {
+				if d.State != nil {
+					d.State.ActiveWorkers.Add(-1)
+				}
+				return lastErr
+			}
+
 			if lastErr == nil {
 				// Check if we stopped early due to stealing
 				stopAt := atomic.LoadInt64(&activeTask.StopAt)
@@ -150,6 +177,8 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 				break
 			}
 
+			d.taskErrors.Add(1)
+
 			// Resume-on-retry: update task to reflect remaining work
 			// This prevents double-counting bytes on retry
 			current := atomic.LoadInt64(&activeTask.CurrentOffset)
@@ -174,7 +203,7 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 }
 
 // downloadTask downloads a single byte range and writes to file at offset
-func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string, file *os.File, activeTask *ActiveTask, buf []byte, client *http.Client, totalSize int64) error {
+func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string, file *os.File, activeTask *ActiveTask, buf []byte, client *http.Client, totalSize int64) (err error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
 	if err != nil {
 		return err
@@ -190,12 +219,44 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 		}
 	}
 
+	d.Runtime.ApplyCredentials(req)
+
 	// Set User-Agent from config only if not provided in custom headers
 	if req.Header.Get("User-Agent") == "" {
 		req.Header.Set("User-Agent", d.Runtime.GetUserAgent())
 	}
 	// Range header is always set for partial downloads (overrides any browser Range header)
 	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", task.Offset, task.Offset+task.Length-1))
+	// If-Range makes the server send the whole (new) file instead of a range of it
+	// when it changed. Only the primary URL shares the probed validators.
+	var ifRange string
+	if rawurl == d.URL {
+		ifRange = types.IfRange(d.ETag, d.LastModified)
+	}
+	if ifRange != "" {
+		req.Header.Set("If-Range", ifRange)
+	}
+
+	// Take a slot from the connection budget shared with other downloads
+	host := types.HostKey(req.URL)
+	atomic.StoreInt32(&activeTask.HostWait, 1)
+	releaseSlot, err := d.Runtime.AcquireHostSlot(ctx, host)
+	atomic.StoreInt32(&activeTask.HostWait, 0)
+	if err != nil {
+		return err
+	}
+	defer releaseSlot()
+
+	// Wait until the host accepts connections again if it throttled us. The
+	// slot is taken first so the backoff only counts connections that can run.
+	atomic.StoreInt32(&activeTask.HostWait, 1)
+	err = d.Backoff.Acquire(ctx, host)
+	atomic.StoreInt32(&activeTask.HostWait, 0)
+	if err != nil {
+		return err
+	}
+	defer d.Backoff.Release(host)
+	atomic.StoreInt64(&activeTask.LastActivity, time.Now().UnixNano())
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -207,9 +268,11 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 		}
 	}()
 
-	// Handle rate limiting explicitly
-	if resp.StatusCode == http.StatusTooManyRequests {
-		return fmt.Errorf("rate limited (429)")
+	// Handle rate limiting explicitly: back off the whole host, not just this worker
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		delay := d.Backoff.Throttle(host, backoff.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()))
+		utils.Debug("Host %s throttled us (%d), backing off for %v", host, resp.StatusCode, delay)
+		return fmt.Errorf("%w (%d)", errThrottled, resp.StatusCode)
 	}
 
 	// Validate status code
@@ -217,6 +280,9 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 		// Valid only if we requested the full file
 		// If we wanted a partial range but got the whole file (200), that's an error because we can't handle the full stream at a non-zero offset
 		if task.Offset != 0 || task.Length != totalSize {
+			if ifRange != "" && remoteChanged(resp, d.ETag, d.LastModified) {
+				return fmt.Errorf("%w: server sent a new version of the file", types.ErrRemoteChanged)
+			}
 			return fmt.Errorf("server indicated success (200) but ignored range request (expected 206)")
 		}
 	} else if resp.StatusCode != http.StatusPartialContent {
@@ -231,13 +297,23 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 	batchTimeThreshold := types.WorkerBatchInterval
 
 	// Helper to flush pending updates to global state
+	var pieceErr error
 	flushUpdates := func() {
 		if pendingBytes > 0 && d.State != nil {
 			// Update Chunk Map (Global Lock)
 			d.State.UpdateChunkStatus(pendingStart, pendingBytes, types.ChunkCompleted)
 
+			// Pieces completed by these bytes are hashed before they count,
+			// so the download can't look finished while one is still bad
+			counted := pendingBytes
+			if d.pieces != nil {
+				var failed []types.Task
+				failed, pieceErr = d.pieces.add(pendingStart, pendingBytes)
+				counted -= d.refetchPieces(failed, rawurl)
+			}
+
 			// Update Downloaded Counter (Atomic)
-			d.State.Downloaded.Add(pendingBytes)
+			d.State.Downloaded.Add(counted)
 
 			pendingBytes = 0
 			pendingStart = -1
@@ -245,7 +321,12 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 		}
 	}
 	// Ensure we flush whatever we have on exit
-	defer flushUpdates()
+	defer func() {
+		flushUpdates()
+		if err == nil {
+			err = pieceErr
+		}
+	}()
 
 	// Read and write at offset
 	offset := task.Offset
@@ -267,6 +348,10 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 		}
 
 		readSize := int64(len(buf))
+		if d.State != nil {
+			// Smaller reads keep throttled transfers smooth
+			readSize = int64(d.State.BandwidthChunk(len(buf)))
+		}
 		if readSize > remaining {
 			readSize = remaining
 		}
@@ -310,8 +395,7 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 			rangeStart := offset // Start of this write
 			offset += int64(readSoFar)
 			atomic.StoreInt64(&activeTask.CurrentOffset, offset)
-			atomic.AddInt64(&activeTask.WindowBytes, int64(readSoFar))
-			atomic.StoreInt64(&activeTask.LastActivity, now.UnixNano())
+			activeTask.RecordBytes(int64(readSoFar), now, d.Runtime.GetSpeedEmaAlpha())
 
 			// Calculate effective contribution (clamping to StopAt is done above via readSoFar truncation)
 			// So readSoFar is exactly what we wrote and what we "own"
@@ -324,25 +408,19 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 			// Check thresholds
 			if pendingBytes >= batchSizeThreshold || now.Sub(lastUpdate) >= batchTimeThreshold {
 				flushUpdates()
+				if pieceErr != nil {
+					return pieceErr
+				}
 			}
 
-			// Update EMA speed using sliding window (2 second window)
-			// This relies on WindowBytes which is updated atomically above, so independent of batching
-			windowElapsed := now.Sub(activeTask.WindowStart).Seconds()
-			if windowElapsed >= 2.0 {
-				windowBytes := atomic.SwapInt64(&activeTask.WindowBytes, 0)
-				recentSpeed := float64(windowBytes) / windowElapsed
-
-				activeTask.SpeedMu.Lock()
-				alpha := d.Runtime.GetSpeedEmaAlpha()
-				if activeTask.Speed == 0 {
-					activeTask.Speed = recentSpeed
-				} else {
-					activeTask.Speed = (1-alpha)*activeTask.Speed + alpha*recentSpeed
+			// Bandwidth limiting: block until the bytes just read fit the budget.
+			// Time spent waiting counts as activity so the health monitor doesn't
+			// mistake a throttled worker for a stalled one.
+			if d.State != nil {
+				if err := d.State.WaitBandwidth(ctx, readSoFar); err != nil {
+					return err
 				}
-				activeTask.SpeedMu.Unlock()
-
-				activeTask.WindowStart = now // Reset window
+				atomic.StoreInt64(&activeTask.LastActivity, time.Now().UnixNano())
 			}
 		}
 
@@ -357,6 +435,53 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 	return nil
 }
 
+// refetchPieces puts pieces that failed verification back on the queue,
+// away from the mirror that sent them, and marks them failed on the chunk
+// map. It returns how many bytes were dropped.
+func (d *ConcurrentDownloader) refetchPieces(failed []types.Task, mirror string) int64 {
+	var dropped int64
+	for _, task := range failed {
+		task.Avoid = mirror
+		// Queue first: the completion monitor must not see an empty queue
+		// once the bytes are taken off
+		d.queue.Push(task)
+		if d.State != nil {
+			d.State.UpdateChunkStatus(task.Offset, task.Length, types.ChunkFailed)
+		}
+		d.ReportMirrorError(mirror)
+		dropped += task.Length
+	}
+	return dropped
+}
+
+// nextMirror picks the mirror to retry on, skipping ones whose host is
+// currently backing off as long as another mirror is available
+func (d *ConcurrentDownloader) nextMirror(mirrors []string, current int) int {
+	for i := 1; i <= len(mirrors); i++ {
+		idx := (current + i) % len(mirrors)
+		u, err := url.Parse(mirrors[idx])
+		if err != nil {
+			continue
+		}
+		if wait, _ := d.Backoff.Status(types.HostKey(u)); wait == 0 {
+			return idx
+		}
+	}
+	return (current + 1) % len(mirrors)
+}
+
+// remoteChanged reports whether a response carries validators that differ from
+// the probed ones. Missing validators are not treated as a change.
+func remoteChanged(resp *http.Response, etag, lastModified string) bool {
+	if got := resp.Header.Get("ETag"); etag != "" && got != "" {
+		return got != etag
+	}
+	if got := resp.Header.Get("Last-Modified"); lastModified != "" && got != "" {
+		return got != lastModified
+	}
+	return false
+}
+
 // StealWork tries to split an active task from a busy worker
 // It greedily targets the worker with the MOST remaining work.
 func (d *ConcurrentDownloader) StealWork(queue *TaskQueue) bool {
@@ -0,0 +1,309 @@
+// Package crawl lists the files below a directory index page, the HTML that
+// Apache's mod_autoindex, nginx's autoindex and most other servers generate
+// for a directory without an index file.
+//
+// Links ending in a slash are subdirectories and are crawled while they stay
+// below the starting directory on the same host; all other links are files.
+// Sorting links, parent directory links and links to other schemes are
+// ignored.
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/concurrent"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+	"golang.org/x/net/html"
+)
+
+// DefaultMaxDepth is how many levels of subdirectories are crawled by default
+const DefaultMaxDepth = 5
+
+// maxPageSize bounds how much of an index page is read
+const maxPageSize = 8 * types.MB
+
+// maxFiles stops a crawl that finds more files than anyone means to mirror
+const maxFiles = 10000
+
+// Options limit what a crawl follows
+type Options struct {
+	MaxDepth int      // Levels of subdirectories to descend, 0 for the starting directory only, < 0 for no limit
+	Include  []string // Globs a file must match one of to be listed, none to list all
+	Exclude  []string // Globs of files and directories to skip
+	SameHost bool     // Skip file links to other hosts
+	Headers  map[string]string
+}
+
+// File is a file found by a crawl
+type File struct {
+	URL  string
+	Path string // Slash separated path below the starting directory, e.g. "iso/disk1.iso"
+}
+
+// Dir returns the directory of the file below the starting directory, "" at the top
+func (f File) Dir() string {
+	if dir := path.Dir(f.Path); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// Name returns the file's name
+func (f File) Name() string {
+	return path.Base(f.Path)
+}
+
+// ErrNotIndex is returned when the starting URL is not an HTML page
+var ErrNotIndex = errors.New("not a directory index")
+
+// RootName names the directory a crawl of rawurl is saved into: the last
+// directory of its path, or the host for a crawl of the whole server
+func RootName(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	if name := path.Base(strings.TrimSuffix(u.Path, "/")); name != "." && name != "/" && name != "" {
+		return name
+	}
+	return u.Hostname()
+}
+
+// Crawl lists the files below the directory index at rawurl
+func Crawl(ctx context.Context, rawurl string, opts Options, runtime *types.RuntimeConfig) ([]File, error) {
+	root, err := url.Parse(rawurl)
+	if err != nil || (root.Scheme != "http" && root.Scheme != "https") || root.Host == "" {
+		return nil, fmt.Errorf("crawl: %q is not an HTTP URL", rawurl)
+	}
+	root.Fragment, root.RawQuery = "", ""
+	if !strings.HasSuffix(root.Path, "/") {
+		root.Path += "/"
+	}
+	for _, pattern := range append(append([]string(nil), opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("crawl: bad pattern %q", pattern)
+		}
+	}
+
+	c := &crawler{
+		client:  concurrent.NewHTTPClient(runtime, 1),
+		runtime: runtime,
+		opts:    opts,
+		root:    root,
+		seen:    map[string]bool{root.String(): true},
+	}
+
+	type dir struct {
+		u     *url.URL
+		depth int
+	}
+	queue := []dir{{root, 0}}
+	var files []File
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+
+		links, base, err := c.page(ctx, d.u)
+		if err != nil {
+			if d.u == root {
+				return nil, err
+			}
+			// A subdirectory that fails only loses its own files
+			utils.Debug("Crawl: skipping %s: %v", d.u, err)
+			continue
+		}
+		if d.u == root && base.Host == root.Host && strings.HasPrefix(base.Path, root.Path) {
+			// Follow the directory the server redirected to
+			root.Path = base.Path
+		}
+
+		for _, href := range links {
+			u, rel, ok := c.resolve(base, href)
+			if !ok || c.seen[u.String()] {
+				continue
+			}
+			c.seen[u.String()] = true
+
+			if strings.HasSuffix(u.Path, "/") {
+				if rel != "" && (opts.MaxDepth < 0 || d.depth < opts.MaxDepth) && !c.excluded(strings.TrimSuffix(rel, "/")) {
+					queue = append(queue, dir{u, d.depth + 1})
+				}
+				continue
+			}
+			if rel == "" {
+				// A file on another host, kept next to the page linking it
+				rel = strings.TrimPrefix(base.Path, root.Path) + path.Base(u.Path)
+			}
+			if !c.included(rel) {
+				continue
+			}
+			files = append(files, File{URL: u.String(), Path: rel})
+			if len(files) > maxFiles {
+				return nil, fmt.Errorf("crawl: more than %d files below %s", maxFiles, rawurl)
+			}
+		}
+	}
+	return files, nil
+}
+
+type crawler struct {
+	client  *http.Client
+	runtime *types.RuntimeConfig
+	opts    Options
+	root    *url.URL
+	seen    map[string]bool
+}
+
+// page fetches an index page and returns its links and the URL they are
+// relative to
+func (c *crawler) page(ctx context.Context, u *url.URL) ([]string, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, val := range c.opts.Headers {
+		if key != "Range" {
+			req.Header.Set(key, val)
+		}
+	}
+	c.runtime.ApplyCredentials(req)
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.runtime.GetUserAgent())
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("crawl: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("crawl: %s returned %s", u, resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, nil, fmt.Errorf("crawl: %s: %w", u, ErrNotIndex)
+	}
+
+	links, base := parseLinks(io.LimitReader(resp.Body, maxPageSize))
+	pageURL := resp.Request.URL
+	if base != "" {
+		if b, err := pageURL.Parse(base); err == nil {
+			pageURL = b
+		}
+	}
+	return links, pageURL, nil
+}
+
+// parseLinks returns the href of every anchor in an HTML page, and the
+// page's <base href> if it has one
+func parseLinks(r io.Reader) (links []string, base string) {
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return links, base
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			if !hasAttr || (tag != "a" && tag != "base") {
+				continue
+			}
+			for {
+				key, val, more := z.TagAttr()
+				if string(key) == "href" {
+					if tag == "a" {
+						links = append(links, strings.TrimSpace(string(val)))
+					} else if base == "" {
+						base = strings.TrimSpace(string(val))
+					}
+				}
+				if !more {
+					break
+				}
+			}
+		}
+	}
+}
+
+// resolve turns a link into an absolute URL. rel is its path below the
+// starting directory, or "" for the starting directory itself and for
+// files on other hosts; ok is false for links that aren't followed.
+func (c *crawler) resolve(base *url.URL, href string) (u *url.URL, rel string, ok bool) {
+	// Sorting links ("?C=M;O=A") and anchors within the page
+	if href == "" || strings.HasPrefix(href, "?") || strings.HasPrefix(href, "#") {
+		return nil, "", false
+	}
+	u, err := base.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, "", false
+	}
+	u.Fragment = ""
+
+	if u.Host != c.root.Host || u.Scheme != c.root.Scheme {
+		if c.opts.SameHost || strings.HasSuffix(u.Path, "/") || u.RawQuery != "" {
+			return nil, "", false
+		}
+		return u, "", validPath(path.Base(u.Path))
+	}
+	if u.RawQuery != "" || !strings.HasPrefix(u.Path, c.root.Path) {
+		return nil, "", false
+	}
+	rel = strings.TrimPrefix(u.Path, c.root.Path)
+	if rel != "" && !validPath(strings.TrimSuffix(rel, "/")) {
+		return nil, "", false
+	}
+	return u, rel, true
+}
+
+// validPath reports whether p is a relative path that is safe to recreate
+// below the output directory
+func validPath(p string) bool {
+	if p == "" {
+		return false
+	}
+	for _, part := range strings.Split(p, "/") {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, "\\\x00") {
+			return false
+		}
+	}
+	return true
+}
+
+// included reports whether the file at rel passes the include and exclude globs
+func (c *crawler) included(rel string) bool {
+	if c.excluded(rel) {
+		return false
+	}
+	if len(c.opts.Include) == 0 {
+		return true
+	}
+	return matchAny(c.opts.Include, rel)
+}
+
+func (c *crawler) excluded(rel string) bool {
+	return matchAny(c.opts.Exclude, rel)
+}
+
+// matchAny matches a glob with a slash against the whole relative path and
+// one without against the last element, so "*.iso" finds ISO files at any
+// depth
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		target := rel
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// serveTree serves a directory tree with Go's file server, whose listings
+// look like a minimal autoindex
+func serveTree(t *testing.T, files ...string) *httptest.Server {
+	t.Helper()
+	root := t.TempDir()
+	for _, f := range files {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(f), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(root)))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func paths(files []File) []string {
+	var out []string
+	for _, f := range files {
+		out = append(out, f.Path)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestCrawl_Recursive(t *testing.T) {
+	server := serveTree(t,
+		"pub/readme.txt",
+		"pub/iso/disk 1.iso",
+		"pub/iso/old/disk0.iso",
+		"pub/iso/old/deeper/x.iso",
+		"other/secret.txt",
+	)
+
+	// The trailing slash of the directory is optional
+	files, err := Crawl(context.Background(), server.URL+"/pub", Options{MaxDepth: -1, SameHost: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"iso/disk 1.iso", "iso/old/deeper/x.iso", "iso/old/disk0.iso", "readme.txt"}
+	if got := paths(files); !reflect.DeepEqual(got, want) {
+		t.Fatalf("paths = %v, want %v", got, want)
+	}
+	for _, f := range files {
+		if f.Path == "iso/disk 1.iso" {
+			if f.URL != server.URL+"/pub/iso/disk%201.iso" || f.Dir() != "iso" || f.Name() != "disk 1.iso" {
+				t.Errorf("file = %+v, dir %q, name %q", f, f.Dir(), f.Name())
+			}
+		}
+	}
+
+	files, err = Crawl(context.Background(), server.URL+"/pub/", Options{MaxDepth: 1, SameHost: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(files), []string{"iso/disk 1.iso", "readme.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("depth 1: paths = %v, want %v", got, want)
+	}
+}
+
+func TestCrawl_IncludeExclude(t *testing.T) {
+	server := serveTree(t, "a.iso", "a.txt", "sub/b.iso", "sub/b.sig", "skip/c.iso")
+
+	files, err := Crawl(context.Background(), server.URL+"/", Options{
+		MaxDepth: DefaultMaxDepth,
+		Include:  []string{"*.iso", "sub/*.sig"},
+		Exclude:  []string{"skip"},
+		SameHost: true,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(files), []string{"a.iso", "sub/b.iso", "sub/b.sig"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("paths = %v, want %v", got, want)
+	}
+
+	if _, err := Crawl(context.Background(), server.URL+"/", Options{Include: []string{"[bad"}}, nil); err == nil {
+		t.Error("a malformed glob should be rejected")
+	}
+}
+
+func TestCrawl_AutoindexLinks(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/dist/":
+			// Apache style: sorting links, a parent link, absolute and relative links
+			_, _ = w.Write([]byte(`<html><body><table>
+<tr><th><a href="?C=N;O=D">Name</a></th><th><a href="?C=M;O=A">Last modified</a></th></tr>
+<tr><td><a href="/">Parent Directory</a></td></tr>
+<tr><td><a href="../">..</a></td></tr>
+<tr><td><a href="app-1.0.tar.gz">app-1.0.tar.gz</a></td></tr>
+<tr><td><a href="/dist/app-1.0.tar.gz">duplicate</a></td></tr>
+<tr><td><a href="` + server.URL + `/dist/nested/">nested/</a></td></tr>
+<tr><td><a href="/elsewhere/file.bin">outside</a></td></tr>
+<tr><td><a href="` + other.URL + `/cdn/app-1.0.zip">on a CDN</a></td></tr>
+<tr><td><a href="mailto:admin@example.com">mail</a></td></tr>
+<tr><td><a href="#top">top</a></td></tr>
+</table></body></html>`))
+		case "/dist/nested/":
+			_, _ = w.Write([]byte(`<a href="../">../</a><a href="notes.txt">notes.txt</a>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	files, err := Crawl(context.Background(), server.URL+"/dist/", Options{MaxDepth: 2, SameHost: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(files), []string{"app-1.0.tar.gz", "nested/notes.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("paths = %v, want %v", got, want)
+	}
+
+	files, err = Crawl(context.Background(), server.URL+"/dist/", Options{MaxDepth: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(files), []string{"app-1.0.tar.gz", "app-1.0.zip", "nested/notes.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("other hosts allowed: paths = %v, want %v", got, want)
+	}
+}
+
+func TestCrawl_NotAnIndex(t *testing.T) {
+	server := serveTree(t, "file.bin")
+	_, err := Crawl(context.Background(), server.URL+"/file.bin", Options{}, nil)
+	if !errors.Is(err, ErrNotIndex) {
+		t.Errorf("err = %v, want ErrNotIndex", err)
+	}
+	if _, err := Crawl(context.Background(), "ftp://example.com/", Options{}, nil); err == nil || !strings.Contains(err.Error(), "not an HTTP URL") {
+		t.Errorf("err = %v, want an unsupported scheme error", err)
+	}
+}
+
+func TestRootName(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/pub/releases/": "releases",
+		"https://example.com/pub/releases":  "releases",
+		"https://example.com/":              "example.com",
+		"https://example.com:8080":          "example.com",
+		"https://example.com/a%20b/":        "a b",
+	}
+	for in, want := range tests {
+		if got := RootName(in); got != want {
+			t.Errorf("RootName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -16,6 +16,8 @@ type ProgressMsg struct {
 	Speed             float64 // bytes per second
 	Elapsed           time.Duration
 	ActiveConnections int
+	TargetConnections int    // Worker count chosen by the connection tuner
+	ConnectionReason  string // Why the tuner last changed it
 	ChunkBitmap       []byte
 	BitmapWidth       int
 	ActualChunkSize   int64
@@ -31,6 +33,54 @@ type DownloadCompleteMsg struct {
 	AvgSpeed   float64 // Average download speed in bytes/sec
 }
 
+// DownloadSkippedMsg signals that a download was not made because its file
+// is already present. It ends the download like DownloadCompleteMsg does.
+type DownloadSkippedMsg struct {
+	DownloadID string
+	Filename   string
+	DestPath   string // The file that was kept
+}
+
+// DownloadVerifiedMsg signals that a finished file matched its expected checksum
+type DownloadVerifiedMsg struct {
+	DownloadID string
+	Filename   string
+	Algorithm  string
+	Digest     string
+}
+
+// ExtractStartedMsg is sent when a finished archive starts being unpacked
+type ExtractStartedMsg struct {
+	DownloadID string
+	Filename   string
+	Dir        string // Directory the archive is unpacked into
+}
+
+// ExtractProgressMsg reports how far unpacking got. Total is 0 when unknown.
+type ExtractProgressMsg struct {
+	DownloadID string
+	Done       int64
+	Total      int64
+}
+
+// ExtractCompleteMsg signals that an archive was unpacked
+type ExtractCompleteMsg struct {
+	DownloadID     string
+	Filename       string
+	Dir            string
+	Files          int
+	Size           int64 // Bytes unpacked
+	ArchiveDeleted bool  // The archive was removed afterwards
+}
+
+// ExtractErrorMsg signals that unpacking failed. The download itself stays
+// complete.
+type ExtractErrorMsg struct {
+	DownloadID string
+	Filename   string
+	Error      string
+}
+
 // DownloadErrorMsg signals that an error occurred
 type DownloadErrorMsg struct {
 	DownloadID string
@@ -98,6 +148,7 @@ type DownloadStartedMsg struct {
 	Filename   string
 	Total      int64
 	DestPath   string               // Full path to the destination file
+	Category   string               // Category the download is filed under, if any
 	State      *types.ProgressState `json:"-"`
 }
 
@@ -115,6 +166,9 @@ type DownloadResumedMsg struct {
 type DownloadQueuedMsg struct {
 	DownloadID string
 	Filename   string
+	BatchID    string // Batch the download was added to, if any
+	BatchName  string
+	Category   string
 }
 
 type DownloadRemovedMsg struct {
@@ -122,11 +176,26 @@ type DownloadRemovedMsg struct {
 	Filename   string
 }
 
+// QueueReorderedMsg is sent when queued downloads are moved or change priority.
+// Order lists the queued download IDs in the order they will start.
+type QueueReorderedMsg struct {
+	Order      []string
+	Priorities map[string]string // Download ID -> "high", "normal" or "low"
+}
+
 // SystemLogMsg carries informational system-level log messages for clients/UI.
 type SystemLogMsg struct {
 	Message string
 }
 
+// ScheduleChangedMsg is sent when the bandwidth schedule switches profile.
+// Profile is empty when scheduling is disabled.
+type ScheduleChangedMsg struct {
+	Profile   string
+	Paused    bool  // Downloads are paused by the profile
+	RateLimit int64 // Effective global limit in bytes/sec (0 = unlimited)
+}
+
 // BatchProgressMsg represents a batch of progress updates to reduce TUI render calls
 type BatchProgressMsg []ProgressMsg
 
@@ -139,4 +208,6 @@ type DownloadRequestMsg struct {
 	Path     string
 	Mirrors  []string
 	Headers  map[string]string
+	Checksum string
+	Options  *types.AddOptions
 }
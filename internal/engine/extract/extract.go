@@ -0,0 +1,320 @@
+// Package extract unpacks finished downloads that are archives: zip, tar
+// (plain or gzip, bzip2 or zstd compressed), rar and 7z, including archives
+// split over several files.
+package extract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Format is the kind of an archive
+type Format string
+
+const (
+	Zip      Format = "zip"
+	Tar      Format = "tar"
+	TarGz    Format = "tar.gz"
+	TarBz2   Format = "tar.bz2"
+	TarZst   Format = "tar.zst"
+	Rar      Format = "rar"
+	SevenZip Format = "7z"
+)
+
+var (
+	// ErrUnsafePath is returned for entries that would be written outside
+	// the extraction directory
+	ErrUnsafePath = errors.New("path leaves the extraction directory")
+	// ErrUnsupported is returned for formats that can't be extracted here
+	ErrUnsupported = errors.New("unsupported archive")
+)
+
+// extensions maps file name suffixes to formats. Longer suffixes come first
+// so that "a.tar.gz" isn't taken for a plain tar.
+var extensions = []struct {
+	ext    string
+	format Format
+}{
+	{".tar.gz", TarGz},
+	{".tar.bz2", TarBz2},
+	{".tar.zst", TarZst},
+	{".tgz", TarGz},
+	{".tbz2", TarBz2},
+	{".tbz", TarBz2},
+	{".tzst", TarZst},
+	{".tar", Tar},
+	{".zip", Zip},
+	{".rar", Rar},
+	{".7z", SevenZip},
+}
+
+// formatOf returns the format of a file name and the name without its
+// archive extension, or "" if the name isn't an archive's
+func formatOf(name string) (Format, string) {
+	lower := strings.ToLower(name)
+	for _, e := range extensions {
+		if strings.HasSuffix(lower, e.ext) && len(name) > len(e.ext) {
+			return e.format, name[:len(name)-len(e.ext)]
+		}
+	}
+	return "", ""
+}
+
+// Progress receives how far an extraction got: done of total bytes, with
+// total 0 when it isn't known
+type Progress func(done, total int64)
+
+// Result describes what an extraction wrote
+type Result struct {
+	Files int   // Regular files written
+	Bytes int64 // Their total size
+}
+
+// Extract unpacks the archive into dest, which must not exist yet. Entries
+// with absolute paths, ".." components or links leading out of dest are
+// refused, and dest is removed again if anything fails.
+func (a *Archive) Extract(ctx context.Context, dest string, progress Progress) (res Result, err error) {
+	if err := os.Mkdir(dest, 0o755); err != nil {
+		return res, err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(dest)
+		}
+	}()
+
+	root, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return res, err
+	}
+	if progress == nil {
+		progress = func(int64, int64) {}
+	}
+	e := &extractor{ctx: ctx, root: root, progress: progress}
+
+	switch a.Format {
+	case Zip:
+		err = e.zip(a)
+	case Tar, TarGz, TarBz2, TarZst:
+		err = e.tar(a)
+	case Rar:
+		err = e.rar(a)
+	case SevenZip:
+		err = e.sevenZip(a)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnsupported, a.Format)
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return e.res, err
+}
+
+// extractor writes the entries of one archive below root
+type extractor struct {
+	ctx      context.Context
+	root     string // Extraction directory with links resolved
+	progress Progress
+	done     int64
+	total    int64
+	res      Result
+
+	countWrites bool // Progress follows the bytes written, not the bytes read
+}
+
+func (e *extractor) report(n int64) {
+	e.done += n
+	done := e.done
+	if e.total > 0 && done > e.total {
+		done = e.total // Unpacked bytes of RAR volumes can outgrow the parts
+	}
+	e.progress(done, e.total)
+}
+
+// within reports whether path is root or below it
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && !filepath.IsAbs(rel) && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// path returns where an entry goes, refusing names that leave the root.
+// Backslashes count as separators so that archives made on Windows can't
+// slip "..\" past the check.
+func (e *extractor) path(name string) (string, error) {
+	clean := filepath.FromSlash(strings.ReplaceAll(name, `\`, "/"))
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || strings.HasPrefix(clean, string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	p := filepath.Join(e.root, clean)
+	if !within(e.root, p) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	return p, nil
+}
+
+// mkdirAll creates dir below the root and returns it with links resolved.
+// Links met on the way have to stay inside the root.
+func (e *extractor) mkdirAll(dir string) (string, error) {
+	rel, err := filepath.Rel(e.root, dir)
+	if err != nil {
+		return "", err
+	}
+	cur := e.root
+	if rel == "." {
+		return cur, nil
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, part)
+		info, err := os.Lstat(cur)
+		switch {
+		case os.IsNotExist(err):
+			if err := os.Mkdir(cur, 0o755); err != nil {
+				return "", err
+			}
+		case err != nil:
+			return "", err
+		case info.Mode()&os.ModeSymlink != 0:
+			resolved, err := filepath.EvalSymlinks(cur)
+			if err != nil {
+				return "", err
+			}
+			if !within(e.root, resolved) {
+				return "", fmt.Errorf("%w: %s", ErrUnsafePath, cur)
+			}
+			cur = resolved
+		case !info.IsDir():
+			return "", fmt.Errorf("%s is not a directory", cur)
+		}
+	}
+	return cur, nil
+}
+
+// target resolves the directory of an entry and returns the path to write
+// it at, with anything an earlier entry left there removed
+func (e *extractor) target(name string) (string, error) {
+	p, err := e.path(name)
+	if err != nil {
+		return "", err
+	}
+	if p == e.root {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	dir, err := e.mkdirAll(filepath.Dir(p))
+	if err != nil {
+		return "", err
+	}
+	p = filepath.Join(dir, filepath.Base(p))
+	if info, err := os.Lstat(p); err == nil {
+		if info.IsDir() {
+			return "", fmt.Errorf("%s is a directory", name)
+		}
+		if err := os.Remove(p); err != nil {
+			return "", err
+		}
+	}
+	return p, nil
+}
+
+func (e *extractor) dir(name string) error {
+	p, err := e.path(name)
+	if err != nil {
+		return err
+	}
+	_, err = e.mkdirAll(p)
+	return err
+}
+
+func (e *extractor) file(name string, mode os.FileMode, modTime time.Time, r io.Reader) error {
+	if err := e.ctx.Err(); err != nil {
+		return err
+	}
+	p, err := e.target(name)
+	if err != nil {
+		return err
+	}
+	perm := mode.Perm()
+	if perm == 0 {
+		perm = 0o644
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm|0o200)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, &ctxReader{ctx: e.ctx, r: r, onRead: e.onWrite})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if !modTime.IsZero() {
+		_ = os.Chtimes(p, modTime, modTime)
+	}
+	e.res.Files++
+	e.res.Bytes += n
+	return nil
+}
+
+func (e *extractor) onWrite(n int64) {
+	if e.countWrites {
+		e.report(n)
+	}
+}
+
+// symlink creates a link whose target has to stay inside the root. The
+// target is cleaned first so that only leading ".." elements remain, which
+// resolve the same way on disk as they do here.
+func (e *extractor) symlink(name, linkTarget string) error {
+	p, err := e.target(name)
+	if err != nil {
+		return err
+	}
+	t := filepath.Clean(filepath.FromSlash(linkTarget))
+	if filepath.IsAbs(t) || filepath.VolumeName(t) != "" || !within(e.root, filepath.Join(filepath.Dir(p), t)) {
+		return fmt.Errorf("%w: %s -> %s", ErrUnsafePath, name, linkTarget)
+	}
+	return os.Symlink(t, p)
+}
+
+// link creates a hard link to an entry extracted before
+func (e *extractor) link(name, linkTarget string) error {
+	src, err := e.path(linkTarget)
+	if err != nil {
+		return err
+	}
+	if src, err = filepath.EvalSymlinks(src); err != nil {
+		return err
+	}
+	if !within(e.root, src) {
+		return fmt.Errorf("%w: %s -> %s", ErrUnsafePath, name, linkTarget)
+	}
+	p, err := e.target(name)
+	if err != nil {
+		return err
+	}
+	return os.Link(src, p)
+}
+
+// ctxReader stops a copy when its context is done and counts what passes
+type ctxReader struct {
+	ctx    context.Context
+	r      io.Reader
+	onRead func(int64)
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(p)
+	if n > 0 && c.onRead != nil {
+		c.onRead(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,365 @@
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type entry struct {
+	name, body string
+	link       string // Symlink target, for tar entries
+}
+
+func zipArchive(t *testing.T, entries []entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(e.body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T, entries []entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.link != "" {
+			hdr = &tar.Header{Name: e.name, Linkname: e.link, Mode: 0o777, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = tw.Write([]byte(e.body))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func extract(t *testing.T, path string) (string, Result, error) {
+	t.Helper()
+	a, err := Detect(path)
+	if err != nil || a == nil {
+		t.Fatalf("Detect(%s) = %v, %v", path, a, err)
+	}
+	dest := a.Destination()
+	res, err := a.Extract(context.Background(), dest, nil)
+	return dest, res, err
+}
+
+func assertFile(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	if string(got) != want {
+		t.Errorf("%s = %q, want %q", path, got, want)
+	}
+}
+
+var sample = []entry{
+	{name: "readme.txt", body: "hello"},
+	{name: "sub/dir/data.bin", body: "0123456789"},
+}
+
+func TestExtract_Formats(t *testing.T) {
+	tarData := tarArchive(t, sample)
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, _ = gw.Write(tarData)
+	_ = gw.Close()
+
+	var zst bytes.Buffer
+	zw, _ := zstd.NewWriter(&zst)
+	_, _ = zw.Write(tarData)
+	_ = zw.Close()
+
+	tests := map[string][]byte{
+		"bundle.zip":     zipArchive(t, sample),
+		"bundle.tar":     tarData,
+		"bundle.tar.gz":  gz.Bytes(),
+		"bundle.tgz":     gz.Bytes(),
+		"bundle.tar.zst": zst.Bytes(),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, name)
+			writeFile(t, path, data)
+
+			var last, total int64
+			a, _ := Detect(path)
+			dest := a.Destination()
+			res, err := a.Extract(context.Background(), dest, func(done, tot int64) { last, total = done, tot })
+			if err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			if dest != filepath.Join(dir, "bundle") {
+				t.Errorf("extracted to %s", dest)
+			}
+			assertFile(t, filepath.Join(dest, "readme.txt"), "hello")
+			assertFile(t, filepath.Join(dest, "sub", "dir", "data.bin"), "0123456789")
+			if res.Files != 2 || res.Bytes != 15 {
+				t.Errorf("result = %+v, want 2 files of 15 bytes", res)
+			}
+			if total == 0 || last != total {
+				t.Errorf("progress ended at %d/%d", last, total)
+			}
+		})
+	}
+}
+
+func TestExtract_SplitZip(t *testing.T) {
+	dir := t.TempDir()
+	data := zipArchive(t, sample)
+	third := len(data) / 3
+	writeFile(t, filepath.Join(dir, "bundle.zip.001"), data[:third])
+	writeFile(t, filepath.Join(dir, "bundle.zip.002"), data[third:2*third])
+	writeFile(t, filepath.Join(dir, "bundle.zip.003"), data[2*third:])
+
+	// Finishing any part finds the whole set
+	a, err := Detect(filepath.Join(dir, "bundle.zip.003"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Format != Zip || !a.Split || len(a.Parts) != 3 || a.Name != "bundle" {
+		t.Fatalf("Detect = %+v", a)
+	}
+	dest, _, err := extract(t, filepath.Join(dir, "bundle.zip.001"))
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	assertFile(t, filepath.Join(dest, "sub", "dir", "data.bin"), "0123456789")
+}
+
+func TestDetect(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"movie.part1.rar", "movie.part2.rar", "disk.7z.002", "notes.txt"} {
+		writeFile(t, filepath.Join(dir, name), nil)
+	}
+
+	a, err := Detect(filepath.Join(dir, "movie.part2.rar"))
+	if err != nil || a.Format != Rar || a.Split || len(a.Parts) != 2 {
+		t.Fatalf("Detect(rar volume) = %+v, %v", a, err)
+	}
+	if !a.Member("movie.part3.rar") || a.Member("movie.part10.rar") || a.Member("other.part1.rar") {
+		t.Error("Member doesn't follow the volume naming")
+	}
+
+	// The first part of the split 7z is missing
+	if _, err := Detect(filepath.Join(dir, "disk.7z.002")); err == nil {
+		t.Error("expected an error for a set without its first part")
+	}
+
+	for _, name := range []string{"notes.txt", "video.mkv.001", ".zip"} {
+		if a, err := Detect(filepath.Join(dir, name)); a != nil || err != nil {
+			t.Errorf("Detect(%s) = %+v, %v; want no archive", name, a, err)
+		}
+	}
+
+	// An existing directory of the same name is left alone
+	if err := os.Mkdir(filepath.Join(dir, "movie"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.Destination(); got != filepath.Join(dir, "movie(1)") {
+		t.Errorf("Destination = %s", got)
+	}
+}
+
+func TestExtract_RefusesEscapes(t *testing.T) {
+	tests := map[string][]byte{
+		"dotdot.zip":   zipArchive(t, []entry{{name: "../evil.txt", body: "x"}}),
+		"absolute.tar": tarArchive(t, []entry{{name: "/tmp/evil.txt", body: "x"}}),
+		"backslash.zip": zipArchive(t, []entry{
+			{name: `a\..\..\evil.txt`, body: "x"},
+		}),
+		"link.tar": tarArchive(t, []entry{{name: "out", link: "../.."}}),
+		// Refused before anything can be written through it
+		"abslink.tar": tarArchive(t, []entry{{name: "out", link: os.TempDir()}, {name: "out/evil.txt", body: "x"}}),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "dl")
+			if err := os.Mkdir(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, name)
+			writeFile(t, path, data)
+
+			dest, _, err := extract(t, path)
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Fatalf("err = %v, want ErrUnsafePath", err)
+			}
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Error("the extraction directory was left behind")
+			}
+			for _, p := range []string{filepath.Join(parent, "evil.txt"), filepath.Join(dir, "evil.txt"), filepath.Join(os.TempDir(), "evil.txt")} {
+				if _, err := os.Stat(p); err == nil {
+					t.Errorf("%s was written", p)
+				}
+			}
+		})
+	}
+}
+
+func TestExtract_InsideLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "links.tar")
+	writeFile(t, path, tarArchive(t, []entry{
+		{name: "lib/real.txt", body: "data"},
+		{name: "bin/alias.txt", link: "../lib/real.txt"},
+	}))
+
+	dest, _, err := extract(t, path)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	assertFile(t, filepath.Join(dest, "bin", "alias.txt"), "data")
+}
+
+func TestExtract_Cancelled(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bundle.zip")
+	writeFile(t, path, zipArchive(t, sample))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a, _ := Detect(path)
+	dest := a.Destination()
+	if _, err := a.Extract(ctx, dest, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("the extraction directory was left behind")
+	}
+}
+
+// fakeSevenZip puts a 7z on PATH that prints listing for "l" and for "x"
+// writes readme.txt into the output directory. It returns the file that
+// shows whether "x" ran.
+func fakeSevenZip(t *testing.T, listing string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake 7z is a shell script")
+	}
+	bin := t.TempDir()
+	ran := filepath.Join(bin, "extracted")
+	writeFile(t, filepath.Join(bin, "listing"), []byte(listing))
+	script := "#!/bin/sh\n" +
+		"case \"$1\" in\n" +
+		"l) cat '" + filepath.Join(bin, "listing") + "' ;;\n" +
+		"x) for a; do case \"$a\" in -o*) echo hello > \"${a#-o}/readme.txt\" ;; esac; done; touch '" + ran + "' ;;\n" +
+		"esac\n"
+	if err := os.WriteFile(filepath.Join(bin, "7z"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return ran
+}
+
+const sevenZipHeader = `7-Zip [64] 16.02 : Copyright (c) 1999-2016 Igor Pavlov : 2016-05-21
+
+Listing archive: bundle.7z
+
+--
+Path = bundle.7z
+Type = 7z
+Physical Size = 230
+
+----------
+`
+
+func TestExtract_SevenZip(t *testing.T) {
+	ran := fakeSevenZip(t, sevenZipHeader+`Path = docs
+Folder = +
+Attributes = D_ drwxr-xr-x
+
+Path = docs/readme.txt
+Size = 6
+Attributes = A_ -rw-r--r--
+`)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bundle.7z")
+	writeFile(t, path, []byte("7z"))
+
+	dest, res, err := extract(t, path)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if _, err := os.Stat(ran); err != nil {
+		t.Fatal("7z x did not run")
+	}
+	assertFile(t, filepath.Join(dest, "readme.txt"), "hello\n")
+	if res.Files != 1 {
+		t.Errorf("Files = %d, want 1", res.Files)
+	}
+}
+
+func TestExtract_SevenZipRefusedBeforeExtracting(t *testing.T) {
+	tests := map[string]string{
+		// Older 7-Zip builds would write d/authorized_keys through the link
+		"symlink": `Path = d
+Attributes = A_ lrwxrwxrwx
+
+Path = d/authorized_keys
+Attributes = A_ -rw-r--r--
+`,
+		"reparse":  "Path = d\nAttributes = AL\n",
+		"linkpath": "Path = d\nSymbolic Link = /home\n",
+		"device":   "Path = tty\nAttributes = A_ crw-rw-rw-\n",
+		"dotdot":   "Path = ../evil.txt\nAttributes = A_ -rw-r--r--\n",
+		"absolute": "Path = /tmp/evil.txt\n",
+	}
+	for name, entries := range tests {
+		t.Run(name, func(t *testing.T) {
+			ran := fakeSevenZip(t, sevenZipHeader+entries)
+			path := filepath.Join(t.TempDir(), "bundle.7z")
+			writeFile(t, path, []byte("7z"))
+
+			dest, _, err := extract(t, path)
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Fatalf("err = %v, want ErrUnsafePath", err)
+			}
+			if _, err := os.Stat(ran); err == nil {
+				t.Error("7z x ran for a refused archive")
+			}
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Error("the extraction directory was left behind")
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nwaples/rardecode"
+)
+
+func (e *extractor) zip(a *Archive) error {
+	j, err := openJoined(a.Parts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = j.Close() }()
+
+	zr, err := zip.NewReader(j, j.size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		e.total += int64(f.UncompressedSize64)
+	}
+	e.countWrites = true
+
+	for _, f := range zr.File {
+		if err := e.ctx.Err(); err != nil {
+			return err
+		}
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = e.dir(f.Name)
+		case mode&os.ModeSymlink != 0:
+			err = e.zipSymlink(f)
+		case mode.IsRegular():
+			err = e.zipFile(f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *extractor) zipFile(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+	return e.file(f.Name, f.Mode(), f.Modified, rc)
+}
+
+func (e *extractor) zipSymlink(f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+	target, err := io.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return err
+	}
+	return e.symlink(f.Name, string(target))
+}
+
+// tar reads the archive through its decompressor, so progress follows the
+// compressed bytes consumed
+func (e *extractor) tar(a *Archive) error {
+	j, err := openJoined(a.Parts)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = j.Close() }()
+	e.total = j.size
+
+	var r io.Reader = bufio.NewReaderSize(&ctxReader{ctx: e.ctx, r: io.NewSectionReader(j, 0, j.size), onRead: e.report}, 256*1024)
+	switch a.Format {
+	case TarGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	case TarBz2:
+		r = bzip2.NewReader(r)
+	case TarZst:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = e.dir(hdr.Name)
+		case tar.TypeReg:
+			err = e.file(hdr.Name, hdr.FileInfo().Mode(), hdr.ModTime, tr)
+		case tar.TypeSymlink:
+			err = e.symlink(hdr.Name, hdr.Linkname)
+		case tar.TypeLink:
+			err = e.link(hdr.Name, hdr.Linkname)
+		}
+		// Devices, fifos and the like are skipped
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// rar reads a single or split archive from the joined parts and lets the
+// decoder open RAR volumes itself, one after the other
+func (e *extractor) rar(a *Archive) error {
+	var rr *rardecode.Reader
+	if a.Split || len(a.Parts) == 1 {
+		j, err := openJoined(a.Parts)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = j.Close() }()
+		e.total = j.size
+		r := bufio.NewReaderSize(&ctxReader{ctx: e.ctx, r: io.NewSectionReader(j, 0, j.size), onRead: e.report}, 256*1024)
+		if rr, err = rardecode.NewReader(r, ""); err != nil {
+			return err
+		}
+	} else {
+		rc, err := rardecode.OpenReader(a.Parts[0], "")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = rc.Close() }()
+		// Volumes are read by the decoder, so count what it unpacks
+		// against what the parts hold
+		e.total = a.Size()
+		e.countWrites = true
+		rr = &rc.Reader
+	}
+
+	for {
+		hdr, err := rr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		mode := hdr.Mode()
+		switch {
+		case hdr.IsDir:
+			err = e.dir(hdr.Name)
+		case mode&os.ModeSymlink != 0:
+			var target []byte
+			if target, err = io.ReadAll(io.LimitReader(rr, 4096)); err == nil {
+				err = e.symlink(hdr.Name, string(target))
+			}
+		default:
+			err = e.file(hdr.Name, mode, hdr.ModificationTime, rr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sevenZipPrograms are the 7-Zip builds looked for on PATH, full ones first
+var sevenZipPrograms = []string{"7z", "7zz", "7za", "7zr"}
+
+// sevenZip runs an installed 7-Zip, which reads split .7z.001 archives by
+// itself. The entries are listed first and the archive is refused if any of
+// them is a link, a special file or has a name leaving the root: older 7-Zip
+// builds write later entries through links extracted before them.
+func (e *extractor) sevenZip(a *Archive) error {
+	var program string
+	for _, p := range sevenZipPrograms {
+		if path, err := exec.LookPath(p); err == nil {
+			program = path
+			break
+		}
+	}
+	if program == "" {
+		return fmt.Errorf("%w: 7z needs 7-Zip (7z, 7zz or 7za) installed", ErrUnsupported)
+	}
+
+	var stderr bytes.Buffer
+	list := exec.CommandContext(e.ctx, program, "l", "-slt", "-bd", a.Parts[0])
+	list.Stderr = &stderr
+	out, err := list.Output()
+	if err != nil {
+		if e.ctx.Err() != nil {
+			return e.ctx.Err()
+		}
+		return fmt.Errorf("%s: %w: %s", filepath.Base(program), err, lastLine(append(out, stderr.Bytes()...)))
+	}
+	if err := e.checkSevenZipList(out); err != nil {
+		return err
+	}
+
+	e.total = a.Size()
+	cmd := exec.CommandContext(e.ctx, program, "x", "-y", "-bd", "-o"+e.root, a.Parts[0])
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if e.ctx.Err() != nil {
+			return e.ctx.Err()
+		}
+		return fmt.Errorf("%s: %w: %s", filepath.Base(program), err, lastLine(out))
+	}
+
+	err = filepath.Walk(e.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			// Listed as something else; don't keep what 7-Zip made of it
+			return os.Remove(path)
+		case info.Mode().IsRegular():
+			e.res.Files++
+			e.res.Bytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	e.report(e.total)
+	return nil
+}
+
+// checkSevenZipList goes through the technical listing (7z l -slt) of an
+// archive. Entries follow a "----------" line as blocks of "Key = value"
+// lines, each starting with its Path.
+func (e *extractor) checkSevenZipList(out []byte) error {
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
+	listed := false
+	fields := map[string]string{}
+	flush := func() error {
+		if len(fields) == 0 {
+			return nil
+		}
+		err := e.checkSevenZipEntry(fields)
+		fields = map[string]string{}
+		return err
+	}
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if !listed {
+			listed = line == "----------"
+			continue
+		}
+		key, val, ok := strings.Cut(line, " = ")
+		if line == "" || (ok && key == "Path") {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if ok {
+			fields[key] = val
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if !listed {
+		return fmt.Errorf("7z: no entries listed")
+	}
+	return flush()
+}
+
+// checkSevenZipEntry refuses an entry that is a link or special file, or
+// whose name leaves the root. Attributes hold Windows attribute letters,
+// where L marks a reparse point, and a Unix mode like "lrwxrwxrwx" when the
+// archive has one.
+func (e *extractor) checkSevenZipEntry(fields map[string]string) error {
+	name := fields["Path"]
+	if _, err := e.path(name); err != nil {
+		return err
+	}
+	if fields["Symbolic Link"] != "" || fields["Hard Link"] != "" {
+		return fmt.Errorf("%w: %s is a link", ErrUnsafePath, name)
+	}
+	for _, attr := range strings.Fields(fields["Attributes"]) {
+		switch {
+		case !isUnixMode(attr):
+			if strings.ContainsRune(attr, 'L') {
+				return fmt.Errorf("%w: %s is a link", ErrUnsafePath, name)
+			}
+		case attr[0] == 'l':
+			return fmt.Errorf("%w: %s is a link", ErrUnsafePath, name)
+		case attr[0] != '-' && attr[0] != 'd':
+			return fmt.Errorf("%w: %s is not a regular file or directory", ErrUnsafePath, name)
+		}
+	}
+	return nil
+}
+
+// isUnixMode reports whether s looks like "-rw-r--r--"
+func isUnixMode(s string) bool {
+	if len(s) != 10 {
+		return false
+	}
+	for _, c := range s[1:] {
+		if !strings.ContainsRune("rwxsStT-", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func lastLine(out []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return line
+		}
+	}
+	return "no output"
+}
@@ -0,0 +1,210 @@
+package extract
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Archive is an archive on disk, possibly in several parts
+type Archive struct {
+	Format Format
+	Name   string   // File name without the archive extension and part number
+	Parts  []string // Paths of the parts in order; one for an archive that isn't split
+
+	// Split archives are one file cut into pieces (.zip.001, .zip.002, ...)
+	// that are read back to back. Otherwise several parts are RAR volumes
+	// (.part1.rar, .part2.rar, ...).
+	Split bool
+
+	volumes bool           // Named as RAR volumes, however many exist yet
+	member  *regexp.Regexp // Matches the file names of all parts
+}
+
+var (
+	splitPattern  = regexp.MustCompile(`^(.+)\.(\d{3,})$`)
+	volumePattern = regexp.MustCompile(`(?i)^(.+)\.part(\d+)\.rar$`)
+)
+
+// Detect returns the archive a file is, or is a part of. It returns nil for
+// files that aren't archives. For a part of a multi-part archive, Parts
+// lists the parts found next to it counting up from the first; if that run
+// doesn't reach path the archive is returned along with an error.
+func Detect(path string) (*Archive, error) {
+	dir, name := filepath.Split(path)
+
+	if m := volumePattern.FindStringSubmatch(name); m != nil {
+		width := len(m[2])
+		a := &Archive{
+			Format:  Rar,
+			Name:    m[1],
+			volumes: true,
+			member:  regexp.MustCompile(`(?i)^` + regexp.QuoteMeta(m[1]) + `\.part\d{` + fmt.Sprint(width) + `}\.rar$`),
+		}
+		ext := name[len(name)-len(".rar"):]
+		a.Parts = findParts(func(i int) string {
+			return filepath.Join(dir, fmt.Sprintf("%s.part%0*d%s", m[1], width, i, ext))
+		})
+		return a, checkParts(a, path)
+	}
+
+	if m := splitPattern.FindStringSubmatch(name); m != nil {
+		format, base := formatOf(m[1])
+		if format == "" {
+			return nil, nil
+		}
+		width := len(m[2])
+		a := &Archive{
+			Format: format,
+			Name:   base,
+			Split:  true,
+			member: regexp.MustCompile(`^` + regexp.QuoteMeta(m[1]) + `\.\d{` + fmt.Sprint(width) + `}$`),
+		}
+		a.Parts = findParts(func(i int) string {
+			return filepath.Join(dir, fmt.Sprintf("%s.%0*d", m[1], width, i))
+		})
+		return a, checkParts(a, path)
+	}
+
+	format, base := formatOf(name)
+	if format == "" {
+		return nil, nil
+	}
+	return &Archive{
+		Format: format,
+		Name:   base,
+		Parts:  []string{path},
+		member: regexp.MustCompile(`^` + regexp.QuoteMeta(name) + `$`),
+	}, nil
+}
+
+// findParts collects the parts that exist, starting with part 1
+func findParts(partPath func(int) string) []string {
+	var parts []string
+	for i := 1; ; i++ {
+		p := partPath(i)
+		if info, err := os.Stat(p); err != nil || info.IsDir() {
+			return parts
+		}
+		parts = append(parts, p)
+	}
+}
+
+func checkParts(a *Archive, path string) error {
+	for _, p := range a.Parts {
+		if p == path {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: earlier parts of %s are missing", filepath.Base(path), a.Name)
+}
+
+// MultiPart reports whether the archive is named as one of several parts
+func (a *Archive) MultiPart() bool {
+	return a.Split || a.volumes
+}
+
+// Member reports whether a file name is that of one of the archive's
+// parts, whether it exists yet or not
+func (a *Archive) Member(name string) bool {
+	return a.member.MatchString(name)
+}
+
+// Destination returns a directory next to the archive, named after it,
+// that doesn't exist yet
+func (a *Archive) Destination() string {
+	dir := filepath.Dir(a.Parts[0])
+	name := strings.TrimSpace(a.Name)
+	if name == "" || name == "." || name == ".." {
+		name = "extracted"
+	}
+	dest := filepath.Join(dir, name)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(dest); os.IsNotExist(err) {
+			return dest
+		}
+		dest = filepath.Join(dir, fmt.Sprintf("%s(%d)", name, i))
+	}
+}
+
+// Size returns the combined size of the parts
+func (a *Archive) Size() int64 {
+	var total int64
+	for _, p := range a.Parts {
+		if info, err := os.Stat(p); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// joined reads the parts of a split archive as one file
+type joined struct {
+	files   []*os.File
+	offsets []int64 // Where each part starts
+	size    int64
+}
+
+func openJoined(paths []string) (*joined, error) {
+	j := &joined{}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			_ = j.Close()
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			_ = j.Close()
+			return nil, err
+		}
+		j.files = append(j.files, f)
+		j.offsets = append(j.offsets, j.size)
+		j.size += info.Size()
+	}
+	return j, nil
+}
+
+func (j *joined) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	if off >= j.size {
+		return 0, io.EOF
+	}
+	// Last part starting at or before off
+	i := sort.Search(len(j.offsets), func(i int) bool { return j.offsets[i] > off }) - 1
+
+	total := 0
+	for total < len(p) && i < len(j.files) {
+		n, err := j.files[i].ReadAt(p[total:], off-j.offsets[i])
+		total += n
+		off += int64(n)
+		if err == io.EOF {
+			i++
+			continue
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+	if total < len(p) {
+		return total, io.EOF
+	}
+	return total, nil
+}
+
+func (j *joined) Close() error {
+	var first error
+	for _, f := range j.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
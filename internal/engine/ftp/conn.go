@@ -0,0 +1,429 @@
+// Package ftp downloads files from FTP and FTPS servers.
+//
+// ftp:// is plain FTP, ftps:// is implicit TLS (port 990) and ftpes:// is
+// explicit TLS negotiated with AUTH TLS on the normal control port. Transfers
+// always use passive mode (EPSV, falling back to PASV).
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+const (
+	// replyTimeout bounds how long a single command waits for the server's reply
+	replyTimeout = 30 * time.Second
+
+	// abortTimeout bounds the wait for the reply to a transfer we cut short
+	abortTimeout = 5 * time.Second
+)
+
+// IsURL reports whether rawurl uses one of the FTP schemes
+func IsURL(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "ftp", "ftps", "ftpes":
+		return true
+	}
+	return false
+}
+
+// Error is a negative reply from the server
+type Error struct {
+	Code int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ftp: %d %s", e.Code, e.Msg)
+}
+
+// Permanent reports whether retrying the command can't help (5xx replies)
+func (e *Error) Permanent() bool {
+	return e.Code >= 500
+}
+
+// isBusy reports whether err is the server refusing more connections
+func isBusy(err error) bool {
+	var ftpErr *Error
+	return errors.As(err, &ftpErr) && ftpErr.Code == 421
+}
+
+// Conn is a logged-in control connection
+type Conn struct {
+	conn    net.Conn
+	text    *textproto.Conn
+	addr    string      // host:port of the control connection
+	dataTLS *tls.Config // Non-nil when data connections are encrypted
+	dialer  proxy.ContextDialer
+	noEPSV  bool
+	broken  bool        // A reply was lost; the connection can't be used for more commands
+	stop    func() bool // Stops closing the connection when the dial context ends
+}
+
+// Dial connects to the server in u, negotiates TLS for ftps/ftpes URLs, logs
+// in with the URL's credentials (anonymous by default) and switches to binary
+// mode. Cancelling ctx closes the connection.
+func Dial(ctx context.Context, u *url.URL, runtime *types.RuntimeConfig) (*Conn, error) {
+	scheme := strings.ToLower(u.Scheme)
+	addr := types.HostKey(u)
+
+	dialer := newDialer(runtime)
+	dialCtx, cancel := context.WithTimeout(ctx, types.DialTimeout)
+	defer cancel()
+	raw, err := dialer.DialContext(dialCtx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	nc := raw
+
+	var tlsConfig *tls.Config
+	if scheme == "ftps" || scheme == "ftpes" {
+		tlsConfig = &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: runtime != nil && runtime.SkipTLSVerification,
+			// Many servers require data connections to resume the control session
+			ClientSessionCache: tls.NewLRUClientSessionCache(4),
+		}
+	}
+	if scheme == "ftps" {
+		nc = tls.Client(nc, tlsConfig)
+	}
+
+	c := &Conn{
+		conn:   nc,
+		text:   textproto.NewConn(nc),
+		addr:   addr,
+		dialer: dialer,
+	}
+	c.stop = context.AfterFunc(ctx, func() { _ = raw.Close() })
+
+	if err := c.login(u, tlsConfig, scheme == "ftpes"); err != nil {
+		_ = c.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Conn) login(u *url.URL, tlsConfig *tls.Config, explicitTLS bool) error {
+	if _, _, err := c.read(2, replyTimeout); err != nil {
+		return err
+	}
+
+	if explicitTLS {
+		if _, _, err := c.cmd(2, "AUTH TLS"); err != nil {
+			return err
+		}
+		c.conn = tls.Client(c.conn, tlsConfig)
+		c.text = textproto.NewConn(c.conn)
+	}
+
+	user, pass := "anonymous", "anonymous@"
+	if u.User != nil {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	}
+	code, msg, err := c.cmd(0, "USER %s", user)
+	if err != nil {
+		return err
+	}
+	switch {
+	case code == 331:
+		if _, _, err := c.cmd(2, "PASS %s", pass); err != nil {
+			return err
+		}
+	case code/100 != 2:
+		return &Error{Code: code, Msg: msg}
+	}
+
+	if tlsConfig != nil {
+		if _, _, err := c.cmd(2, "PBSZ 0"); err != nil {
+			return err
+		}
+		if _, _, err := c.cmd(2, "PROT P"); err != nil {
+			return err
+		}
+		c.dataTLS = tlsConfig
+	}
+
+	_, _, err = c.cmd(2, "TYPE I")
+	return err
+}
+
+// cmd sends a command and reads its reply. expect is a reply code or a
+// single leading digit (2 accepts any 2xx); 0 accepts anything.
+func (c *Conn) cmd(expect int, format string, args ...any) (int, string, error) {
+	_ = c.conn.SetDeadline(time.Now().Add(replyTimeout))
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		c.broken = true
+		return 0, "", err
+	}
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+	return c.readReply(expect)
+}
+
+// read reads a reply without sending a command
+func (c *Conn) read(expect int, timeout time.Duration) (int, string, error) {
+	_ = c.conn.SetDeadline(time.Now().Add(timeout))
+	return c.readReply(expect)
+}
+
+func (c *Conn) readReply(expect int) (int, string, error) {
+	code, msg, err := c.text.ReadResponse(0)
+	if err != nil {
+		c.broken = true
+		return code, msg, err
+	}
+	if !replyMatches(code, expect) {
+		return code, msg, &Error{Code: code, Msg: msg}
+	}
+	return code, msg, nil
+}
+
+func replyMatches(code, expect int) bool {
+	switch {
+	case expect <= 0:
+		return true
+	case expect < 10:
+		return code/100 == expect
+	default:
+		return code == expect
+	}
+}
+
+// Size returns the size of the file at path in bytes
+func (c *Conn) Size(path string) (int64, error) {
+	_, msg, err := c.cmd(213, "SIZE %s", path)
+	if err != nil {
+		return 0, err
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ftp: invalid SIZE reply %q", msg)
+	}
+	return size, nil
+}
+
+// ModTime returns the MDTM timestamp of path as sent by the server
+// (YYYYMMDDhhmmss in UTC). It is only compared, never parsed.
+func (c *Conn) ModTime(path string) (string, error) {
+	_, msg, err := c.cmd(213, "MDTM %s", path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(msg), nil
+}
+
+// CanResume reports whether the server accepts REST for stream transfers
+func (c *Conn) CanResume() bool {
+	_, _, err := c.cmd(350, "REST 0")
+	return err == nil
+}
+
+// Retr starts downloading path from offset. The returned reader must be
+// closed before the next command is sent on c.
+func (c *Conn) Retr(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	data, err := c.openData(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > 0 {
+		if _, _, err := c.cmd(350, "REST %d", offset); err != nil {
+			_ = data.Close()
+			return nil, err
+		}
+	}
+	if _, _, err := c.cmd(1, "RETR %s", path); err != nil {
+		_ = data.Close()
+		return nil, err
+	}
+
+	// Transfers can take much longer than a command reply
+	_ = c.conn.SetDeadline(time.Time{})
+
+	if c.dataTLS != nil {
+		tlsData := tls.Client(data, c.dataTLS)
+		if err := tlsData.HandshakeContext(ctx); err != nil {
+			_ = data.Close()
+			_, _, _ = c.read(0, abortTimeout)
+			return nil, err
+		}
+		data = tlsData
+	}
+	stop := context.AfterFunc(ctx, func() { _ = data.Close() })
+	return &dataReader{Conn: data, c: c, stop: stop}, nil
+}
+
+// openData opens a passive mode data connection
+func (c *Conn) openData(ctx context.Context) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(c.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var port int
+	if !c.noEPSV {
+		var msg string
+		_, msg, err = c.cmd(229, "EPSV")
+		if err == nil {
+			port, err = parseEPSV(msg)
+		} else if isNotImplemented(err) {
+			c.noEPSV = true
+		}
+	}
+	if c.noEPSV {
+		var msg string
+		if _, msg, err = c.cmd(227, "PASV"); err == nil {
+			// Use the control connection's host: the address in the reply is
+			// often a private one behind NAT
+			port, err = parsePASV(msg)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, types.DialTimeout)
+	defer cancel()
+	return c.dialer.DialContext(dialCtx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+func isNotImplemented(err error) bool {
+	var ftpErr *Error
+	return errors.As(err, &ftpErr) && ftpErr.Code >= 500 && ftpErr.Code <= 504
+}
+
+// parseEPSV extracts the port from "Entering Extended Passive Mode (|||6446|)"
+func parseEPSV(msg string) (int, error) {
+	start := strings.Index(msg, "(")
+	end := strings.LastIndex(msg, ")")
+	if start < 0 || end < start+1 {
+		return 0, fmt.Errorf("ftp: invalid EPSV reply %q", msg)
+	}
+	fields := strings.Split(msg[start+1:end], msg[start+1:start+2])
+	if len(fields) != 5 {
+		return 0, fmt.Errorf("ftp: invalid EPSV reply %q", msg)
+	}
+	port, err := strconv.Atoi(fields[3])
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("ftp: invalid EPSV reply %q", msg)
+	}
+	return port, nil
+}
+
+// parsePASV extracts the port from "Entering Passive Mode (h1,h2,h3,h4,p1,p2)"
+func parsePASV(msg string) (int, error) {
+	start := strings.Index(msg, "(")
+	end := strings.LastIndex(msg, ")")
+	if start < 0 || end < start {
+		return 0, fmt.Errorf("ftp: invalid PASV reply %q", msg)
+	}
+	fields := strings.Split(msg[start+1:end], ",")
+	if len(fields) != 6 {
+		return 0, fmt.Errorf("ftp: invalid PASV reply %q", msg)
+	}
+	p1, err1 := strconv.Atoi(strings.TrimSpace(fields[4]))
+	p2, err2 := strconv.Atoi(strings.TrimSpace(fields[5]))
+	if err1 != nil || err2 != nil || p1 < 0 || p1 > 255 || p2 < 0 || p2 > 255 {
+		return 0, fmt.Errorf("ftp: invalid PASV reply %q", msg)
+	}
+	return p1<<8 | p2, nil
+}
+
+// Broken reports whether the connection lost track of the server's replies
+// and should be replaced
+func (c *Conn) Broken() bool {
+	return c.broken
+}
+
+// Close sends QUIT and closes the control connection
+func (c *Conn) Close() error {
+	if c.stop != nil {
+		c.stop()
+	}
+	_ = c.conn.SetDeadline(time.Now().Add(time.Second))
+	_, _ = c.text.Cmd("QUIT")
+	return c.text.Close()
+}
+
+// dataReader is a transfer in progress. Closing it early aborts the transfer
+// while keeping the control connection usable for the next one.
+type dataReader struct {
+	net.Conn
+	c    *Conn
+	stop func() bool
+	done bool
+}
+
+func (r *dataReader) Read(p []byte) (int, error) {
+	n, err := r.Conn.Read(p)
+	if err == io.EOF {
+		r.done = true
+	}
+	return n, err
+}
+
+// Close closes the data connection and reads the transfer's final reply.
+// A transfer cut short is answered with 426 or 451, which is expected.
+func (r *dataReader) Close() error {
+	r.stop()
+	_ = r.Conn.Close()
+	timeout := replyTimeout
+	if !r.done {
+		timeout = abortTimeout
+	}
+	code, msg, err := r.c.read(0, timeout)
+	if err != nil {
+		return err
+	}
+	if r.done && code/100 != 2 {
+		return &Error{Code: code, Msg: msg}
+	}
+	return nil
+}
+
+// newDialer returns a dialer honouring a SOCKS5 proxy from the settings.
+// HTTP proxies can't carry FTP and are ignored.
+func newDialer(runtime *types.RuntimeConfig) proxy.ContextDialer {
+	direct := &net.Dialer{Timeout: types.DialTimeout, KeepAlive: types.KeepAliveDuration}
+	if runtime == nil || runtime.ProxyURL == "" {
+		return direct
+	}
+	parsed, err := url.Parse(runtime.ProxyURL)
+	if err != nil || !strings.HasPrefix(parsed.Scheme, "socks5") {
+		utils.Debug("FTP: proxy %s is not a SOCKS5 proxy, connecting directly", runtime.ProxyURL)
+		return direct
+	}
+	dialer, err := proxy.SOCKS5("tcp", parsed.Host, nil, direct)
+	if err != nil {
+		utils.Debug("FTP: Failed to create SOCKS5 dialer: %v", err)
+		return direct
+	}
+	if cd, ok := dialer.(proxy.ContextDialer); ok {
+		return cd
+	}
+	return direct
+}
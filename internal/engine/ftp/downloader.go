@@ -0,0 +1,559 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Downloader fetches a file over several control connections at once, each
+// transferring its own segment with REST. A paused download saves the
+// remaining segments to the state DB and continues from them on resume.
+type Downloader struct {
+	ProgressChan chan<- any           // Channel for events (start/complete/error)
+	ID           string               // Download ID
+	State        *types.ProgressState // Shared state for TUI polling
+	Runtime      *types.RuntimeConfig
+	ModTime      string // MDTM from the probe; a different value on resume restarts the file
+	CanResume    bool   // Server accepts REST; without it the file is fetched in one piece
+
+	mu       sync.Mutex
+	queue    []types.Task
+	active   map[int]*segment
+	running  int
+	fatalErr error
+}
+
+// segment is a task being transferred by a worker
+type segment struct {
+	offset atomic.Int64 // Next byte to write
+	end    int64
+}
+
+// NewDownloader creates an FTP downloader
+func NewDownloader(id string, progressCh chan<- any, progState *types.ProgressState, runtime *types.RuntimeConfig) *Downloader {
+	if runtime == nil {
+		runtime = &types.RuntimeConfig{
+			MaxConnectionsPerHost: types.PerHostMax,
+			MinChunkSize:          types.MinChunk,
+			WorkerBufferSize:      types.WorkerBuffer,
+		}
+	}
+	return &Downloader{
+		ID:           id,
+		ProgressChan: progressCh,
+		State:        progState,
+		Runtime:      runtime,
+		active:       make(map[int]*segment),
+	}
+}
+
+// connections returns how many control connections to open for fileSize,
+// using the same square root heuristic as the HTTP engine
+func (d *Downloader) connections(u *url.URL, fileSize int64) int {
+	n := int(math.Round(math.Sqrt(float64(fileSize) / types.Megabyte)))
+	if minChunk := d.Runtime.GetMinChunkSize(); minChunk > 0 {
+		n = min(n, int(fileSize/minChunk))
+	}
+	return max(1, min(n, d.Runtime.GetHostConnectionLimit(types.HostKey(u))))
+}
+
+// splitTasks divides fileSize into n segments aligned to AlignSize
+func splitTasks(fileSize int64, n int) ([]types.Task, int64) {
+	chunkSize := (fileSize / int64(n) / types.AlignSize) * types.AlignSize
+	if chunkSize == 0 {
+		chunkSize = types.AlignSize
+	}
+	var tasks []types.Task
+	for offset := int64(0); offset < fileSize; offset += chunkSize {
+		tasks = append(tasks, types.Task{Offset: offset, Length: min(chunkSize, fileSize-offset)})
+	}
+	// A short tail becomes part of the last full segment
+	if len(tasks) > n {
+		last := tasks[len(tasks)-1]
+		tasks = tasks[:len(tasks)-1]
+		tasks[len(tasks)-1].Length += last.Length
+	}
+	return tasks, chunkSize
+}
+
+// Download fetches rawurl into destPath. fileSize is the size from Stat; 0
+// means unknown, in which case the file is streamed over one connection.
+func (d *Downloader) Download(ctx context.Context, rawurl string, destPath string, fileSize int64) error {
+	utils.Debug("FTP Download: %s -> %s (size: %d, rest: %v)", rawurl, destPath, fileSize, d.CanResume)
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	path, err := remotePath(u)
+	if err != nil {
+		return err
+	}
+
+	downloadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if d.State != nil {
+		d.State.SetCancelFunc(cancel)
+	}
+
+	if fileSize <= 0 || !d.CanResume {
+		return d.stream(downloadCtx, u, path, destPath)
+	}
+
+	workingPath := destPath + types.IncompleteSuffix
+	outFile, err := os.OpenFile(workingPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() { _ = outFile.Close() }()
+
+	numConns := d.connections(u, fileSize)
+	tasks, chunkSize := splitTasks(fileSize, numConns)
+	if d.State != nil {
+		d.State.InitBitmap(fileSize, chunkSize)
+	}
+
+	savedState, err := state.LoadState(rawurl, destPath)
+	isResume := err == nil && savedState != nil && len(savedState.Tasks) > 0
+	if isResume {
+		if err := savedState.ValidateRemote(fileSize, "", d.ModTime); err != nil {
+			utils.Debug("Discarding saved state and restarting: %v", err)
+			isResume = false
+		}
+	}
+
+	if isResume {
+		tasks = savedState.Tasks
+		if d.State != nil {
+			d.State.Downloaded.Store(savedState.Downloaded)
+			d.State.VerifiedProgress.Store(savedState.Downloaded)
+			d.State.SetSavedElapsed(time.Duration(savedState.Elapsed))
+			if len(savedState.ChunkBitmap) > 0 && savedState.ActualChunkSize > 0 {
+				d.State.RestoreBitmap(savedState.ChunkBitmap, savedState.ActualChunkSize)
+				d.State.RecalculateProgress(savedState.Tasks)
+				d.State.Downloaded.Store(d.State.VerifiedProgress.Load())
+			}
+			d.State.SyncSessionStart()
+		}
+		numConns = min(numConns, len(tasks))
+		utils.Debug("Resuming from saved state: %d tasks, %d bytes downloaded", len(tasks), savedState.Downloaded)
+	} else {
+		if err := outFile.Truncate(fileSize); err != nil {
+			return fmt.Errorf("failed to preallocate file: %w", err)
+		}
+		if d.State != nil {
+			d.State.Downloaded.Store(0)
+			d.State.VerifiedProgress.Store(0)
+			d.State.SyncSessionStart()
+		}
+	}
+
+	d.mu.Lock()
+	d.queue = tasks
+	d.mu.Unlock()
+	if d.State != nil {
+		d.State.SetConnectionTarget(numConns, "initial estimate")
+	}
+
+	// Workers that gave up their connection to a busy server may leave
+	// segments behind once the others are done; another round picks them up
+	for round := 0; ; round++ {
+		d.runWorkers(downloadCtx, cancel, min(numConns, len(d.remaining())), u, path, outFile)
+		if d.fatalErr != nil || downloadCtx.Err() != nil || len(d.remaining()) == 0 || round >= d.Runtime.GetMaxTaskRetries() {
+			break
+		}
+		utils.Debug("FTP: %d segments left, starting another round", len(d.remaining()))
+	}
+
+	if d.State != nil && d.State.IsPaused() {
+		d.savePausedState(rawurl, destPath, fileSize)
+		return types.ErrPaused
+	}
+	if d.fatalErr != nil {
+		return d.fatalErr
+	}
+	if downloadCtx.Err() != nil {
+		return context.Canceled
+	}
+	if len(d.remaining()) > 0 {
+		return fmt.Errorf("ftp: download stopped with segments left")
+	}
+
+	if err := outFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	_ = outFile.Close()
+	if err := utils.RenameNoReplace(workingPath, destPath); err != nil {
+		return fmt.Errorf("failed to rename completed file: %w", err)
+	}
+	_ = state.DeleteState(d.ID, rawurl, destPath)
+	return nil
+}
+
+// runWorkers runs n workers until the queue is empty or one of them fails
+func (d *Downloader) runWorkers(ctx context.Context, cancel context.CancelFunc, n int, u *url.URL, path string, file *os.File) {
+	d.mu.Lock()
+	d.running = n
+	d.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			err := d.worker(ctx, id, u, path, file)
+			d.mu.Lock()
+			d.running--
+			if err != nil && !errors.Is(err, context.Canceled) && d.fatalErr == nil {
+				d.fatalErr = err
+				cancel()
+			}
+			d.mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+}
+
+// next hands worker id its next segment, or false when none are left
+func (d *Downloader) next(id int) (*segment, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.queue) == 0 {
+		return nil, false
+	}
+	task := d.queue[0]
+	d.queue = d.queue[1:]
+	seg := &segment{end: task.Offset + task.Length}
+	seg.offset.Store(task.Offset)
+	d.active[id] = seg
+	return seg, true
+}
+
+// finish drops worker id's segment, putting back whatever is left of it
+func (d *Downloader) finish(id int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if seg := d.active[id]; seg != nil {
+		if offset := seg.offset.Load(); offset < seg.end {
+			d.queue = append(d.queue, types.Task{Offset: offset, Length: seg.end - offset})
+		}
+	}
+	delete(d.active, id)
+}
+
+// remaining returns every byte range not written yet
+func (d *Downloader) remaining() []types.Task {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tasks := append([]types.Task(nil), d.queue...)
+	for _, seg := range d.active {
+		if offset := seg.offset.Load(); offset < seg.end {
+			tasks = append(tasks, types.Task{Offset: offset, Length: seg.end - offset})
+		}
+	}
+	return tasks
+}
+
+// worker transfers segments over its own control connection until none are
+// left. A server refusing the extra connection (421) ends the worker quietly
+// as long as another one is still running.
+func (d *Downloader) worker(ctx context.Context, id int, u *url.URL, path string, file *os.File) error {
+	var conn *Conn
+	release := func() {}
+	drop := func() {
+		if conn != nil {
+			_ = conn.Close()
+			conn = nil
+		}
+		release()
+		release = func() {}
+	}
+	defer drop()
+
+	buf := make([]byte, d.Runtime.GetWorkerBufferSize())
+	maxRetries := d.Runtime.GetMaxTaskRetries()
+
+	for {
+		seg, ok := d.next(id)
+		if !ok {
+			return nil
+		}
+		if d.State != nil {
+			d.State.ActiveWorkers.Add(1)
+			d.State.UpdateChunkStatus(seg.offset.Load(), seg.end-seg.offset.Load(), types.ChunkDownloading)
+		}
+
+		var err error
+		for attempt := 0; attempt < maxRetries; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Duration(1<<attempt) * types.RetryBaseDelay):
+				}
+			}
+			if ctx.Err() != nil {
+				break
+			}
+
+			if conn == nil {
+				var releaseSlot func()
+				conn, releaseSlot, err = d.connect(ctx, u)
+				if err != nil {
+					if isBusy(err) && d.othersRunning() {
+						utils.Debug("FTP worker %d: server refused another connection, leaving the work to the others", id)
+						d.finish(id)
+						if d.State != nil {
+							d.State.ActiveWorkers.Add(-1)
+						}
+						return nil
+					}
+					if isPermanent(err) {
+						break
+					}
+					continue
+				}
+				release = releaseSlot
+			}
+
+			err = d.transfer(ctx, conn, path, file, seg, buf)
+			if conn.Broken() || err != nil {
+				drop()
+			}
+			if err == nil || isPermanent(err) {
+				break
+			}
+			utils.Debug("FTP worker %d: transfer at %d failed: %v", id, seg.offset.Load(), err)
+		}
+
+		if d.State != nil {
+			d.State.ActiveWorkers.Add(-1)
+		}
+		if ctx.Err() != nil {
+			// Keep the segment registered so a pause saves what is left of it
+			return ctx.Err()
+		}
+		d.finish(id)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *Downloader) othersRunning() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.running > 1
+}
+
+// isPermanent reports whether err is a 5xx reply retrying won't fix
+func isPermanent(err error) bool {
+	var ftpErr *Error
+	return errors.As(err, &ftpErr) && ftpErr.Permanent()
+}
+
+// connect takes a slot from the host budget and logs in
+func (d *Downloader) connect(ctx context.Context, u *url.URL) (*Conn, func(), error) {
+	releaseSlot, err := d.Runtime.AcquireHostSlot(ctx, types.HostKey(u))
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := Dial(ctx, u, d.Runtime)
+	if err != nil {
+		releaseSlot()
+		return nil, nil, err
+	}
+	return conn, releaseSlot, nil
+}
+
+// transfer downloads the rest of seg with REST + RETR and writes it in place
+func (d *Downloader) transfer(ctx context.Context, conn *Conn, path string, file *os.File, seg *segment, buf []byte) error {
+	offset := seg.offset.Load()
+	r, err := conn.Retr(ctx, path, offset)
+	if err != nil {
+		return err
+	}
+
+	var readErr error
+	for offset < seg.end && readErr == nil {
+		size := int64(len(buf))
+		if d.State != nil {
+			size = int64(d.State.BandwidthChunk(len(buf)))
+		}
+		size = min(size, seg.end-offset)
+
+		var n int
+		n, readErr = io.ReadFull(r, buf[:size])
+		if n > 0 {
+			if _, err := file.WriteAt(buf[:n], offset); err != nil {
+				_ = r.Close()
+				return fmt.Errorf("write error: %w", err)
+			}
+			if d.State != nil {
+				d.State.UpdateChunkStatus(offset, int64(n), types.ChunkCompleted)
+				d.State.Downloaded.Add(int64(n))
+			}
+			offset += int64(n)
+			seg.offset.Store(offset)
+
+			if d.State != nil {
+				if err := d.State.WaitBandwidth(ctx, n); err != nil {
+					_ = r.Close()
+					return err
+				}
+			}
+		}
+	}
+
+	closeErr := r.Close()
+	if offset < seg.end {
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			if closeErr != nil {
+				return closeErr
+			}
+			return fmt.Errorf("ftp: transfer ended at byte %d of %d", offset, seg.end)
+		}
+		return readErr
+	}
+	// The segment is complete; a failed abort only costs the connection
+	return nil
+}
+
+// savePausedState stores the remaining segments for resume
+func (d *Downloader) savePausedState(rawurl, destPath string, fileSize int64) {
+	remaining := d.remaining()
+	var remainingBytes int64
+	for _, t := range remaining {
+		remainingBytes += t.Length
+	}
+	downloaded := fileSize - remainingBytes
+
+	elapsed := d.State.FinalizePauseSession(downloaded)
+	bitmap, _, _, chunkSize, _ := d.State.GetBitmap()
+	priority, queueOrder := d.State.GetPriority()
+
+	s := &types.DownloadState{
+		URL:             rawurl,
+		ID:              d.ID,
+		DestPath:        destPath,
+		TotalSize:       fileSize,
+		Downloaded:      downloaded,
+		Tasks:           remaining,
+		Filename:        filepath.Base(destPath),
+		Elapsed:         elapsed.Nanoseconds(),
+		ChunkBitmap:     bitmap,
+		ActualChunkSize: chunkSize,
+		RateLimit:       d.State.GetRateLimit(),
+		Checksum:        d.State.GetChecksum(),
+		LastModified:    d.ModTime,
+		Priority:        priority,
+		QueueOrder:      queueOrder,
+		BatchID:         d.State.GetBatchID(),
+		Category:        d.State.GetCategory(),
+	}
+	if err := state.SaveState(rawurl, destPath, s); err != nil {
+		utils.Debug("Failed to save pause state: %v", err)
+	}
+	utils.Debug("FTP download paused, state saved (Downloaded=%d, RemainingTasks=%d)", downloaded, len(remaining))
+}
+
+// stream downloads the whole file over one connection. Used when the server
+// can't resume transfers or report the size; an interrupted stream restarts.
+func (d *Downloader) stream(ctx context.Context, u *url.URL, path string, destPath string) error {
+	conn, release, err := d.connect(ctx, u)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer func() { _ = conn.Close() }()
+
+	r, err := conn.Retr(ctx, path, 0)
+	if err != nil {
+		return err
+	}
+
+	workingPath := destPath + types.IncompleteSuffix
+	outFile, err := os.Create(workingPath)
+	if err != nil {
+		_ = r.Close()
+		return err
+	}
+	success := false
+	defer func() {
+		_ = outFile.Close()
+		if !success {
+			_ = os.Remove(workingPath)
+		}
+	}()
+
+	if d.State != nil {
+		d.State.ActiveWorkers.Add(1)
+		defer d.State.ActiveWorkers.Add(-1)
+	}
+
+	var written int64
+	buf := make([]byte, d.Runtime.GetWorkerBufferSize())
+	for {
+		readBuf := buf
+		if d.State != nil {
+			readBuf = buf[:d.State.BandwidthChunk(len(buf))]
+		}
+		n, readErr := r.Read(readBuf)
+		if n > 0 {
+			if _, err := outFile.Write(readBuf[:n]); err != nil {
+				_ = r.Close()
+				return fmt.Errorf("write error: %w", err)
+			}
+			written += int64(n)
+			if d.State != nil {
+				d.State.Downloaded.Store(written)
+				d.State.VerifiedProgress.Store(written)
+				if err := d.State.WaitBandwidth(ctx, n); err != nil {
+					_ = r.Close()
+					return err
+				}
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			_ = r.Close()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("read error: %w", readErr)
+		}
+	}
+	if err := r.Close(); err != nil {
+		return err
+	}
+
+	if err := outFile.Sync(); err != nil {
+		return fmt.Errorf("sync error: %w", err)
+	}
+	if err := outFile.Close(); err != nil {
+		return fmt.Errorf("close error: %w", err)
+	}
+	if err := utils.RenameNoReplace(workingPath, destPath); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			success = true // Kept for the caller to settle the conflict
+		}
+		return fmt.Errorf("failed to rename completed file: %w", err)
+	}
+	success = true
+	return nil
+}
@@ -0,0 +1,309 @@
+package ftp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func initTestState(t *testing.T) string {
+	state.CloseDB()
+	tmpDir := t.TempDir()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	t.Cleanup(state.CloseDB)
+	return tmpDir
+}
+
+func randomData(t *testing.T, size int) []byte {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// download stats rawurl and downloads it into dir like TUIDownload does
+func download(t *testing.T, ctx context.Context, rawurl, destPath string, progress *types.ProgressState, runtime *types.RuntimeConfig) error {
+	t.Helper()
+	info, err := Stat(ctx, rawurl, runtime)
+	if err != nil {
+		return err
+	}
+	d := NewDownloader("ftp-test", nil, progress, runtime)
+	d.ModTime, d.CanResume = info.ModTime, info.CanResume
+	return d.Download(ctx, rawurl, destPath, info.Size)
+}
+
+func assertFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading result: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("downloaded %d bytes do not match the served %d bytes", len(got), len(want))
+	}
+	if testutil.FileExists(path + types.IncompleteSuffix) {
+		t.Error(".surge file should be removed after completion")
+	}
+}
+
+func TestStat(t *testing.T) {
+	server := testutil.NewFTPServerT(t)
+	server.AddFile("pub/file.iso", make([]byte, 12345), "20230102030405")
+
+	info, err := Stat(context.Background(), server.URL("pub/file.iso"), nil)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size != 12345 || info.ModTime != "20230102030405" || !info.CanResume {
+		t.Errorf("Stat = %+v", info)
+	}
+
+	if _, err := Stat(context.Background(), server.URL("missing.iso"), nil); err == nil {
+		t.Error("Stat should fail for a missing file")
+	}
+}
+
+func TestStat_Login(t *testing.T) {
+	server := testutil.NewFTPServerT(t, testutil.WithFTPCredentials("alice", "secret"))
+	server.AddFile("file.bin", []byte("hello"), "")
+
+	if _, err := Stat(context.Background(), server.URL("file.bin"), nil); err != nil {
+		t.Fatalf("Stat with credentials failed: %v", err)
+	}
+
+	// Same user, wrong password
+	wrongURL := strings.Replace(server.URL("file.bin"), ":secret@", ":guess@", 1)
+	var ftpErr *Error
+	_, err := Stat(context.Background(), wrongURL, nil)
+	if !errors.As(err, &ftpErr) || ftpErr.Code != 530 {
+		t.Errorf("expected 530 for a wrong password, got %v", err)
+	}
+}
+
+func TestDownloader_Segmented(t *testing.T) {
+	tmpDir := initTestState(t)
+	data := randomData(t, 4*types.MB+123)
+	server := testutil.NewFTPServerT(t, testutil.WithFTPLatency(time.Millisecond))
+	server.AddFile("big.bin", data, "")
+
+	destPath := filepath.Join(tmpDir, "big.bin")
+	progress := types.NewProgressState("ftp-test", int64(len(data)))
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 256 * types.KB}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download(t, ctx, server.URL("big.bin"), destPath, progress, runtime); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	assertFile(t, destPath, data)
+	if server.PeakConns.Load() < 2 {
+		t.Errorf("peak connections = %d, want parallel segments", server.PeakConns.Load())
+	}
+	if server.RestCommands.Load() < 2 {
+		t.Errorf("REST commands = %d, want one per segment", server.RestCommands.Load())
+	}
+	if got := progress.Downloaded.Load(); got != int64(len(data)) {
+		t.Errorf("Downloaded = %d, want %d", got, len(data))
+	}
+}
+
+func TestDownloader_TLS(t *testing.T) {
+	for _, mode := range []testutil.FTPTLSMode{testutil.FTPExplicit, testutil.FTPImplicit} {
+		tmpDir := initTestState(t)
+		data := randomData(t, 1*types.MB)
+		server := testutil.NewFTPServerT(t, testutil.WithFTPTLS(mode))
+		server.AddFile("secure.bin", data, "")
+
+		destPath := filepath.Join(tmpDir, "secure.bin")
+		runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 2, MinChunkSize: 256 * types.KB, SkipTLSVerification: true}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := download(t, ctx, server.URL("secure.bin"), destPath, nil, runtime); err != nil {
+			t.Fatalf("%s download failed: %v", server.URL("secure.bin"), err)
+		}
+		cancel()
+		assertFile(t, destPath, data)
+
+		// The self-signed certificate is rejected unless verification is off
+		if _, err := Stat(context.Background(), server.URL("secure.bin"), nil); err == nil {
+			t.Errorf("%s: expected a certificate error", server.URL("secure.bin"))
+		}
+	}
+}
+
+func TestDownloader_PASVFallback(t *testing.T) {
+	tmpDir := initTestState(t)
+	data := randomData(t, 512*types.KB)
+	server := testutil.NewFTPServerT(t, testutil.WithFTPEPSV(false))
+	server.AddFile("file.bin", data, "")
+
+	destPath := filepath.Join(tmpDir, "file.bin")
+	if err := download(t, context.Background(), server.URL("file.bin"), destPath, nil, nil); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, data)
+}
+
+func TestDownloader_WithoutRest(t *testing.T) {
+	tmpDir := initTestState(t)
+	data := randomData(t, 2*types.MB)
+	server := testutil.NewFTPServerT(t, testutil.WithFTPRest(false))
+	server.AddFile("file.bin", data, "")
+
+	destPath := filepath.Join(tmpDir, "file.bin")
+	progress := types.NewProgressState("ftp-test", int64(len(data)))
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 256 * types.KB}
+	if err := download(t, context.Background(), server.URL("file.bin"), destPath, progress, runtime); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, data)
+	if server.Retrievals.Load() != 1 {
+		t.Errorf("retrievals = %d, want a single stream", server.Retrievals.Load())
+	}
+}
+
+func TestDownloader_ServerConnectionLimit(t *testing.T) {
+	tmpDir := initTestState(t)
+	data := randomData(t, 4*types.MB)
+	server := testutil.NewFTPServerT(t, testutil.WithFTPMaxConnections(1))
+	server.AddFile("file.bin", data, "")
+
+	destPath := filepath.Join(tmpDir, "file.bin")
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 256 * types.KB}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download(t, ctx, server.URL("file.bin"), destPath, nil, runtime); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, data)
+	if server.Rejected.Load() == 0 {
+		t.Error("expected the server to refuse extra connections")
+	}
+}
+
+func TestDownloader_PauseAndResume(t *testing.T) {
+	tmpDir := initTestState(t)
+	data := randomData(t, 2*types.MB)
+	server := testutil.NewFTPServerT(t, testutil.WithFTPLatency(5*time.Millisecond))
+	server.AddFile("file.bin", data, "")
+	rawurl := server.URL("file.bin")
+
+	destPath := filepath.Join(tmpDir, "file.bin")
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 2, MinChunkSize: 256 * types.KB}
+	progress := types.NewProgressState("ftp-test", int64(len(data)))
+
+	go func() {
+		for progress.Downloaded.Load() < 256*types.KB {
+			time.Sleep(5 * time.Millisecond)
+		}
+		progress.Pause()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download(t, ctx, rawurl, destPath, progress, runtime); !errors.Is(err, types.ErrPaused) {
+		t.Fatalf("expected ErrPaused, got %v", err)
+	}
+
+	saved, err := state.LoadState(rawurl, destPath)
+	if err != nil {
+		t.Fatalf("no state saved on pause: %v", err)
+	}
+	if saved.Downloaded <= 0 || saved.Downloaded >= int64(len(data)) || len(saved.Tasks) == 0 {
+		t.Fatalf("unexpected saved state: downloaded=%d tasks=%d", saved.Downloaded, len(saved.Tasks))
+	}
+	if saved.LastModified == "" {
+		t.Error("MDTM should be saved to detect a replaced file")
+	}
+
+	served := server.BytesServed.Load()
+	resumed := types.NewProgressState("ftp-test", int64(len(data)))
+	if err := download(t, ctx, rawurl, destPath, resumed, runtime); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	assertFile(t, destPath, data)
+
+	// The second run only fetched what was missing (plus what was in flight)
+	if again := server.BytesServed.Load() - served; again >= int64(len(data)) {
+		t.Errorf("resume transferred %d bytes, expected less than the whole file", again)
+	}
+}
+
+func TestDownloader_ResumeRestartsWhenRemoteChanged(t *testing.T) {
+	tmpDir := initTestState(t)
+	data := randomData(t, 512*types.KB)
+	server := testutil.NewFTPServerT(t)
+	server.AddFile("file.bin", data, "20240501000000")
+	rawurl := server.URL("file.bin")
+	destPath := filepath.Join(tmpDir, "file.bin")
+
+	// Stale progress from an older version of the file
+	if err := os.WriteFile(destPath+types.IncompleteSuffix, make([]byte, len(data)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	half := int64(len(data) / 2)
+	if err := state.SaveState(rawurl, destPath, &types.DownloadState{
+		ID:           "ftp-test",
+		URL:          rawurl,
+		DestPath:     destPath,
+		TotalSize:    int64(len(data)),
+		Downloaded:   half,
+		Tasks:        []types.Task{{Offset: half, Length: int64(len(data)) - half}},
+		LastModified: "20240101000000",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := download(t, context.Background(), rawurl, destPath, nil, nil); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, data)
+}
+
+func TestParsePassiveReplies(t *testing.T) {
+	if port, err := parseEPSV("Entering Extended Passive Mode (|||6446|)"); err != nil || port != 6446 {
+		t.Errorf("parseEPSV = %d, %v", port, err)
+	}
+	if port, err := parsePASV("Entering Passive Mode (192,168,1,2,19,137)"); err != nil || port != 19*256+137 {
+		t.Errorf("parsePASV = %d, %v", port, err)
+	}
+	for _, bad := range []string{"", "Entering Passive Mode", "(1,2,3)", "(|||abc|)"} {
+		if _, err := parseEPSV(bad); err == nil {
+			t.Errorf("parseEPSV(%q) should fail", bad)
+		}
+		if _, err := parsePASV(bad); err == nil {
+			t.Errorf("parsePASV(%q) should fail", bad)
+		}
+	}
+}
+
+func TestSplitTasks(t *testing.T) {
+	tasks, chunk := splitTasks(10*types.MB+5, 3)
+	if len(tasks) != 3 {
+		t.Fatalf("got %d tasks, want 3", len(tasks))
+	}
+	var total int64
+	for i, task := range tasks {
+		if task.Offset != int64(i)*chunk {
+			t.Errorf("task %d offset = %d", i, task.Offset)
+		}
+		total += task.Length
+	}
+	if total != 10*types.MB+5 {
+		t.Errorf("tasks cover %d bytes", total)
+	}
+}
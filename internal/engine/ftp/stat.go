@@ -0,0 +1,70 @@
+package ftp
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Info describes a remote file
+type Info struct {
+	Size      int64  // 0 when the server doesn't support SIZE
+	ModTime   string // MDTM timestamp, used to detect a replaced file on resume
+	CanResume bool   // Server accepts REST, so segments and resume are possible
+}
+
+// Stat logs in and reads the size, modification time and REST support of
+// the file at rawurl
+func Stat(ctx context.Context, rawurl string, runtime *types.RuntimeConfig) (*Info, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	path, err := remotePath(u)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseSlot, err := runtime.AcquireHostSlot(ctx, types.HostKey(u))
+	if err != nil {
+		return nil, err
+	}
+	defer releaseSlot()
+
+	c, err := Dial(ctx, u, runtime)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = c.Close() }()
+
+	info := &Info{}
+	info.Size, err = c.Size(path)
+	if err != nil {
+		if !isNotImplemented(err) {
+			return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		utils.Debug("FTP: SIZE not supported by %s", u.Host)
+		info.Size = 0
+	}
+	if modTime, err := c.ModTime(path); err == nil {
+		info.ModTime = modTime
+	}
+	info.CanResume = c.CanResume()
+
+	utils.Debug("FTP stat %s: size=%d mdtm=%s rest=%v", rawurl, info.Size, info.ModTime, info.CanResume)
+	return info, nil
+}
+
+// remotePath returns the path to request for u. Like other clients it is
+// taken relative to the login directory, which is "/" on public mirrors.
+func remotePath(u *url.URL) (string, error) {
+	p := strings.TrimPrefix(u.Path, "/")
+	if p == "" || strings.HasSuffix(p, "/") {
+		return "", fmt.Errorf("ftp: %s does not name a file", u.Redacted())
+	}
+	return p, nil
+}
@@ -0,0 +1,370 @@
+// Package metalink reads Metalink documents (RFC 5854 .meta4 files and the
+// older Metalink 3 .metalink format): the mirrors, size, hashes and piece
+// hashes of one or more files.
+//
+// A download added from a metalink keeps the metalink as its URL, with the
+// file's name as fragment when the metalink lists several files, and the
+// metalink is read again whenever the download starts or resumes.
+package metalink
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/concurrent"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// maxSize bounds how much of a metalink is read
+const maxSize = 16 * types.MB
+
+// lowestPriority is what RFC 5854 assumes for URLs without a priority
+const lowestPriority = 999999
+
+// Metalink is a parsed metalink document
+type Metalink struct {
+	Files []File
+}
+
+// File is one file described by a metalink
+type File struct {
+	Name   string             // Relative path, may contain directories
+	Size   int64              // 0 when not given
+	Hash   checksum.Spec      // Strongest supported whole-file hash, zero if none
+	Pieces *types.PieceHashes // Strongest supported piece hashes, nil if none
+	URLs   []URL              // Mirrors in priority order
+}
+
+// URL is one mirror of a file
+type URL struct {
+	URL      string
+	Priority int    // 1 is the most preferred
+	Location string // ISO 3166-1 country code, if given
+}
+
+// Sources returns the URLs to fetch the file from, most preferred first.
+// HTTP mirrors are combined by the concurrent engine, so if there are any
+// only those are returned; otherwise it is the single best other URL.
+func (f *File) Sources() []string {
+	var web []string
+	for _, u := range f.URLs {
+		if isHTTP(u.URL) {
+			web = append(web, u.URL)
+		}
+	}
+	if len(web) > 0 || len(f.URLs) == 0 {
+		return web
+	}
+	return []string{f.URLs[0].URL}
+}
+
+// The subset of both metalink versions that is used. Elements are matched
+// by local name, so either namespace works.
+type document struct {
+	Files  []xmlFile `xml:"file"`       // Metalink 4
+	Files3 []xmlFile `xml:"files>file"` // Metalink 3
+}
+
+type xmlFile struct {
+	Name   string      `xml:"name,attr"`
+	Size   int64       `xml:"size"`
+	Hashes []xmlHash   `xml:"hash"`
+	Pieces []xmlPieces `xml:"pieces"`
+	URLs   []xmlURL    `xml:"url"`
+
+	// Metalink 3 nests these
+	Verification struct {
+		Hashes []xmlHash   `xml:"hash"`
+		Pieces []xmlPieces `xml:"pieces"`
+	} `xml:"verification"`
+	Resources []xmlURL `xml:"resources>url"`
+}
+
+type xmlHash struct {
+	Type  string `xml:"type,attr"`
+	Piece *int   `xml:"piece,attr"` // Metalink 3 numbers pieces
+	Value string `xml:",chardata"`
+}
+
+type xmlPieces struct {
+	Type   string    `xml:"type,attr"`
+	Length int64     `xml:"length,attr"`
+	Hashes []xmlHash `xml:"hash"`
+}
+
+type xmlURL struct {
+	Priority   *int   `xml:"priority,attr"`   // Metalink 4: 1 is best
+	Preference *int   `xml:"preference,attr"` // Metalink 3: 100 is best
+	Type       string `xml:"type,attr"`       // Metalink 3: protocol, or e.g. "bittorrent" for a .torrent
+	Location   string `xml:"location,attr"`
+	Value      string `xml:",chardata"`
+}
+
+// hashPreference ranks supported algorithms, strongest first
+var hashPreference = []string{
+	checksum.SHA512, checksum.BLAKE2b512, checksum.SHA256, checksum.BLAKE2b256, checksum.SHA1, checksum.MD5,
+}
+
+// Parse reads a metalink document
+func Parse(data []byte) (*Metalink, error) {
+	var doc document
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("metalink: invalid document: %w", err)
+	}
+
+	m := &Metalink{}
+	for _, xf := range append(doc.Files, doc.Files3...) {
+		f, err := parseFile(xf)
+		if err != nil {
+			return nil, err
+		}
+		m.Files = append(m.Files, *f)
+	}
+	if len(m.Files) == 0 {
+		return nil, fmt.Errorf("metalink: no files listed")
+	}
+	return m, nil
+}
+
+func parseFile(xf xmlFile) (*File, error) {
+	name, err := cleanName(xf.Name)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{Name: name, Size: max(xf.Size, 0)}
+
+	hashes := make(map[string]string)
+	for _, h := range append(xf.Hashes, xf.Verification.Hashes...) {
+		if algo, ok := checksum.Algorithm(h.Type); ok {
+			hashes[algo] = strings.TrimSpace(h.Value)
+		}
+	}
+	for _, algo := range hashPreference {
+		if digest, ok := hashes[algo]; ok {
+			spec, err := checksum.Parse(algo + ":" + digest)
+			if err != nil {
+				return nil, fmt.Errorf("metalink: %s: %w", name, err)
+			}
+			f.Hash = spec
+			break
+		}
+	}
+
+	if f.Pieces, err = parsePieces(append(xf.Pieces, xf.Verification.Pieces...)); err != nil {
+		return nil, fmt.Errorf("metalink: %s: %w", name, err)
+	}
+
+	for _, u := range append(xf.URLs, xf.Resources...) {
+		raw := strings.TrimSpace(u.Value)
+		if !supported(raw) || (u.Type != "" && !schemes[strings.ToLower(u.Type)]) {
+			continue
+		}
+		priority := lowestPriority
+		switch {
+		case u.Priority != nil && *u.Priority > 0:
+			priority = *u.Priority
+		case u.Preference != nil:
+			priority = max(101-*u.Preference, 1)
+		}
+		f.URLs = append(f.URLs, URL{URL: raw, Priority: priority, Location: strings.ToLower(u.Location)})
+	}
+	sort.SliceStable(f.URLs, func(i, j int) bool { return f.URLs[i].Priority < f.URLs[j].Priority })
+	if len(f.URLs) == 0 {
+		return nil, fmt.Errorf("metalink: %s has no URL surge can download from", name)
+	}
+	return f, nil
+}
+
+// parsePieces picks the strongest set of piece hashes
+func parsePieces(sets []xmlPieces) (*types.PieceHashes, error) {
+	best := -1
+	var chosen *types.PieceHashes
+	for _, set := range sets {
+		algo, ok := checksum.Algorithm(set.Type)
+		if !ok || set.Length <= 0 || len(set.Hashes) == 0 {
+			continue
+		}
+		rank := len(hashPreference)
+		for i, a := range hashPreference {
+			if a == algo {
+				rank = i
+			}
+		}
+		if best >= 0 && rank >= best {
+			continue
+		}
+
+		hashes := append([]xmlHash(nil), set.Hashes...)
+		sort.SliceStable(hashes, func(i, j int) bool {
+			return hashes[i].Piece != nil && hashes[j].Piece != nil && *hashes[i].Piece < *hashes[j].Piece
+		})
+		pieces := &types.PieceHashes{Algorithm: algo, Length: set.Length}
+		for _, h := range hashes {
+			digest := strings.ToLower(strings.TrimSpace(h.Value))
+			if _, err := hex.DecodeString(digest); err != nil {
+				return nil, fmt.Errorf("invalid %s piece hash %q", algo, h.Value)
+			}
+			pieces.Hashes = append(pieces.Hashes, digest)
+		}
+		best, chosen = rank, pieces
+	}
+	return chosen, nil
+}
+
+// cleanName checks that a file name stays inside the download directory
+func cleanName(name string) (string, error) {
+	clean := path.Clean(strings.TrimSpace(name))
+	if name == "" || clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") ||
+		strings.ContainsAny(clean, "\\\x00") {
+		return "", fmt.Errorf("metalink: unsafe file name %q", name)
+	}
+	return clean, nil
+}
+
+// schemes surge has an engine for
+var schemes = map[string]bool{"http": true, "https": true, "ftp": true, "ftps": true, "ftpes": true, "sftp": true}
+
+// supported reports whether rawurl can be downloaded
+func supported(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && u.Host != "" && schemes[strings.ToLower(u.Scheme)]
+}
+
+func isHTTP(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// IsMetalink reports whether source, a URL or local path, is a metalink,
+// judged by its extension or by contentType when one is known
+func IsMetalink(source, contentType string) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch strings.ToLower(mediaType) {
+		case "application/metalink4+xml", "application/metalink+xml":
+			return true
+		}
+	}
+	source, _ = SplitFile(source)
+	p := source
+	// A one letter scheme is a Windows drive
+	if u, err := url.Parse(source); err == nil && len(u.Scheme) > 1 {
+		switch strings.ToLower(u.Scheme) {
+		case "http", "https", "file":
+			p = u.Path
+		default:
+			return false
+		}
+	}
+	switch strings.ToLower(path.Ext(strings.ReplaceAll(p, "\\", "/"))) {
+	case ".meta4", ".metalink":
+		return true
+	}
+	return false
+}
+
+// FileURL names one file of the metalink at source
+func FileURL(source, name string) string {
+	return source + "#" + url.PathEscape(name)
+}
+
+// SplitFile splits what FileURL joined. name is empty if source names the
+// metalink as a whole.
+func SplitFile(s string) (source, name string) {
+	i := strings.LastIndex(s, "#")
+	if i < 0 {
+		return s, ""
+	}
+	name, err := url.PathUnescape(s[i+1:])
+	if err != nil {
+		name = s[i+1:]
+	}
+	return s[:i], name
+}
+
+// Load reads the metalink at source: an http(s) or file URL, or a local path
+func Load(ctx context.Context, source string, headers map[string]string, runtime *types.RuntimeConfig) (*Metalink, error) {
+	source, _ = SplitFile(source)
+
+	var data []byte
+	u, err := url.Parse(source)
+	switch {
+	case err == nil && (u.Scheme == "http" || u.Scheme == "https"):
+		data, err = fetch(ctx, source, headers, runtime)
+	case err == nil && u.Scheme == "file":
+		data, err = readFile(u.Path)
+	default:
+		data, err = readFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Resolve loads the metalink at source and returns the file it names: the
+// one in the fragment, or the only one
+func Resolve(ctx context.Context, source string, headers map[string]string, runtime *types.RuntimeConfig) (*File, error) {
+	m, err := Load(ctx, source, headers, runtime)
+	if err != nil {
+		return nil, err
+	}
+	_, name := SplitFile(source)
+	if name == "" {
+		if len(m.Files) > 1 {
+			return nil, fmt.Errorf("metalink: %d files listed, add the metalink to download them all", len(m.Files))
+		}
+		return &m.Files[0], nil
+	}
+	for i := range m.Files {
+		if m.Files[i].Name == name {
+			return &m.Files[i], nil
+		}
+	}
+	return nil, fmt.Errorf("metalink: no file named %q", name)
+}
+
+func readFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("metalink: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	return io.ReadAll(io.LimitReader(f, maxSize))
+}
+
+func fetch(ctx context.Context, rawurl string, headers map[string]string, runtime *types.RuntimeConfig) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, val := range headers {
+		if key != "Range" {
+			req.Header.Set(key, val)
+		}
+	}
+	runtime.ApplyCredentials(req)
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", runtime.GetUserAgent())
+	}
+
+	resp, err := concurrent.NewHTTPClient(runtime, 1).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("metalink: failed to fetch %s: %w", rawurl, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metalink: %s returned %d", rawurl, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxSize))
+}
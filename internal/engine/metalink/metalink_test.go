@@ -0,0 +1,238 @@
+package metalink
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	md5Hex    = strings.Repeat("a", 32)
+	sha1Hex   = strings.Repeat("b", 40)
+	sha256Hex = strings.Repeat("c", 64)
+)
+
+const meta4 = `<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="dist/app.iso">
+    <size>1048576</size>
+    <hash type="md5">` + "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA" + `</hash>
+    <hash type="sha-256">` + "cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc" + `</hash>
+    <pieces length="524288" type="sha-1">
+      <hash>` + "1111111111111111111111111111111111111111" + `</hash>
+      <hash>` + "2222222222222222222222222222222222222222" + `</hash>
+    </pieces>
+    <url location="de" priority="2">https://de.example.com/app.iso</url>
+    <url priority="1">https://us.example.com/app.iso</url>
+    <url>ftp://ftp.example.com/app.iso</url>
+    <url priority="1">rsync://example.com/app.iso</url>
+    <metaurl mediatype="torrent">https://example.com/app.torrent</metaurl>
+  </file>
+  <file name="README">
+    <url>https://example.com/README</url>
+  </file>
+</metalink>`
+
+const metalink3 = `<?xml version="1.0" encoding="UTF-8"?>
+<metalink version="3.0" xmlns="http://www.metalinker.org/">
+  <files>
+    <file name="tool.tar.gz">
+      <size>300</size>
+      <verification>
+        <hash type="sha1">` + "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb" + `</hash>
+        <pieces length="100" type="sha1">
+          <hash piece="2">` + "3333333333333333333333333333333333333333" + `</hash>
+          <hash piece="0">` + "1111111111111111111111111111111111111111" + `</hash>
+          <hash piece="1">` + "2222222222222222222222222222222222222222" + `</hash>
+        </pieces>
+      </verification>
+      <resources>
+        <url type="bittorrent" preference="100">https://example.com/tool.torrent</url>
+        <url type="http" location="fr" preference="40">http://fr.example.com/tool.tar.gz</url>
+        <url type="http" preference="90">http://example.com/tool.tar.gz</url>
+      </resources>
+    </file>
+  </files>
+</metalink>`
+
+func TestParse_Metalink4(t *testing.T) {
+	m, err := Parse([]byte(meta4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 2 {
+		t.Fatalf("got %d files, want 2", len(m.Files))
+	}
+
+	f := m.Files[0]
+	if f.Name != "dist/app.iso" || f.Size != 1048576 {
+		t.Errorf("file = %q (%d bytes)", f.Name, f.Size)
+	}
+	if f.Hash.String() != "sha256:"+sha256Hex {
+		t.Errorf("hash = %s, want the sha256 one", f.Hash)
+	}
+	if f.Pieces == nil || f.Pieces.Algorithm != "sha1" || f.Pieces.Length != 524288 || len(f.Pieces.Hashes) != 2 {
+		t.Fatalf("pieces = %+v", f.Pieces)
+	}
+
+	want := []URL{
+		{URL: "https://us.example.com/app.iso", Priority: 1},
+		{URL: "https://de.example.com/app.iso", Priority: 2, Location: "de"},
+		{URL: "ftp://ftp.example.com/app.iso", Priority: lowestPriority},
+	}
+	if len(f.URLs) != len(want) {
+		t.Fatalf("URLs = %+v, want %+v", f.URLs, want)
+	}
+	for i := range want {
+		if f.URLs[i] != want[i] {
+			t.Errorf("URL %d = %+v, want %+v", i, f.URLs[i], want[i])
+		}
+	}
+	if got := f.Sources(); len(got) != 2 || got[0] != want[0].URL || got[1] != want[1].URL {
+		t.Errorf("Sources() = %v, want the two HTTPS mirrors", got)
+	}
+}
+
+func TestParse_Metalink3(t *testing.T) {
+	m, err := Parse([]byte(metalink3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := m.Files[0]
+	if f.Size != 300 || f.Hash.String() != "sha1:"+sha1Hex {
+		t.Errorf("size %d, hash %s", f.Size, f.Hash)
+	}
+	if f.Pieces == nil || len(f.Pieces.Hashes) != 3 {
+		t.Fatalf("pieces = %+v", f.Pieces)
+	}
+	for i, h := range f.Pieces.Hashes {
+		if want := strings.Repeat(string(rune('1'+i)), 40); h != want {
+			t.Errorf("piece %d = %s, want %s", i, h, want)
+		}
+	}
+	if len(f.URLs) != 2 || f.URLs[0].URL != "http://example.com/tool.tar.gz" || f.URLs[0].Priority != 11 ||
+		f.URLs[1].Location != "fr" {
+		t.Errorf("URLs = %+v", f.URLs)
+	}
+}
+
+func TestParse_Rejects(t *testing.T) {
+	tests := map[string]string{
+		"not xml":   `{"file": 1}`,
+		"no files":  `<metalink xmlns="urn:ietf:params:xml:ns:metalink"></metalink>`,
+		"traversal": `<metalink><file name="../etc/passwd"><url>https://e.com/x</url></file></metalink>`,
+		"absolute":  `<metalink><file name="/etc/passwd"><url>https://e.com/x</url></file></metalink>`,
+		"backslash": `<metalink><file name="..\evil.exe"><url>https://e.com/x</url></file></metalink>`,
+		"no urls":   `<metalink><file name="x"><url>magnet:?xt=urn:btih:abc</url></file></metalink>`,
+		"bad hash":  `<metalink><file name="x"><hash type="sha-256">abc</hash><url>https://e.com/x</url></file></metalink>`,
+		"bad piece": `<metalink><file name="x"><pieces type="sha-1" length="10"><hash>zz</hash></pieces><url>https://e.com/x</url></file></metalink>`,
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(body)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParse_PrefersStrongerPieces(t *testing.T) {
+	body := `<metalink><file name="x">
+  <pieces type="md5" length="10"><hash>` + md5Hex + `</hash></pieces>
+  <pieces type="sha-256" length="20"><hash>` + sha256Hex + `</hash></pieces>
+  <pieces type="whirlpool" length="30"><hash>00</hash></pieces>
+  <url>https://e.com/x</url></file></metalink>`
+	m, err := Parse([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := m.Files[0].Pieces; p.Algorithm != "sha256" || p.Length != 20 {
+		t.Errorf("pieces = %+v, want the sha256 set", p)
+	}
+}
+
+func TestIsMetalink(t *testing.T) {
+	tests := []struct {
+		source, contentType string
+		want                bool
+	}{
+		{"https://example.com/app.meta4", "", true},
+		{"https://example.com/app.metalink?mirror=eu", "", true},
+		{"https://example.com/get?id=3", "application/metalink4+xml; charset=utf-8", true},
+		{"https://example.com/app.iso", "application/octet-stream", false},
+		{"/home/me/Downloads/set.META4", "", true},
+		{"/home/me/Downloads/set.meta4#dist%2Fapp.iso", "", true},
+		{`C:\Users\me\set.metalink`, "", true},
+		{"file:///tmp/set.meta4", "", true},
+		{"ftp://example.com/set.meta4", "", false},
+		{"https://example.com/meta4", "", false},
+	}
+	for _, tt := range tests {
+		if got := IsMetalink(tt.source, tt.contentType); got != tt.want {
+			t.Errorf("IsMetalink(%q, %q) = %v, want %v", tt.source, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestFileURL_RoundTrip(t *testing.T) {
+	u := FileURL("https://example.com/set.meta4", "dist/my app#1.iso")
+	source, name := SplitFile(u)
+	if source != "https://example.com/set.meta4" || name != "dist/my app#1.iso" {
+		t.Errorf("SplitFile(%q) = %q, %q", u, source, name)
+	}
+	if source, name := SplitFile("/tmp/set.meta4"); source != "/tmp/set.meta4" || name != "" {
+		t.Errorf("SplitFile without fragment = %q, %q", source, name)
+	}
+}
+
+func TestResolve_LocalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "set.meta4")
+	if err := os.WriteFile(path, []byte(meta4), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err := Resolve(ctx, path, nil, nil); err == nil {
+		t.Error("expected an error choosing from several files")
+	}
+	f, err := Resolve(ctx, FileURL(path, "README"), nil, nil)
+	if err != nil || f.Name != "README" {
+		t.Fatalf("Resolve README = %+v, %v", f, err)
+	}
+	if _, err := Resolve(ctx, FileURL(path, "missing"), nil, nil); err == nil {
+		t.Error("expected an error for a file not in the metalink")
+	}
+}
+
+func TestLoad_HTTP(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tool.metalink" {
+			http.NotFound(w, r)
+			return
+		}
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/metalink+xml")
+		_, _ = w.Write([]byte(metalink3))
+	}))
+	defer srv.Close()
+
+	m, err := Load(context.Background(), srv.URL+"/tool.metalink", map[string]string{"Authorization": "Bearer x"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 1 || m.Files[0].Name != "tool.tar.gz" {
+		t.Errorf("files = %+v", m.Files)
+	}
+	if gotAuth != "Bearer x" {
+		t.Errorf("Authorization = %q, headers weren't forwarded", gotAuth)
+	}
+
+	if _, err := Load(context.Background(), srv.URL+"/missing.meta4", nil, nil); err == nil {
+		t.Error("expected an error for a 404")
+	}
+}
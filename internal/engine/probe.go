@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"path"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,6 +16,11 @@ import (
 
 	"golang.org/x/net/proxy"
 
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/ftp"
+	"github.com/surge-downloader/surge/internal/engine/sftp"
+	"github.com/surge-downloader/surge/internal/engine/stream"
+	"github.com/surge-downloader/surge/internal/engine/torrent"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
 )
@@ -29,6 +35,8 @@ type ProbeResult struct {
 	SupportsRange bool
 	Filename      string
 	ContentType   string
+	ETag          string // Validators used to detect a changed file on resume
+	LastModified  string
 }
 
 // ProbeServer sends GET with Range: bytes=0-0 to determine server capabilities
@@ -37,66 +45,31 @@ type ProbeResult struct {
 func ProbeServer(ctx context.Context, rawurl string, filenameHint string, headers map[string]string, runtime *types.RuntimeConfig) (*ProbeResult, error) {
 	utils.Debug("Probing server: %s", rawurl)
 
+	if ftp.IsURL(rawurl) {
+		return probeFTP(ctx, rawurl, filenameHint, runtime)
+	}
+	if sftp.IsURL(rawurl) {
+		return probeSFTP(ctx, rawurl, filenameHint, runtime)
+	}
+	if stream.IsManifest(rawurl, "") {
+		return probeStream(ctx, rawurl, filenameHint, headers, runtime)
+	}
+	if torrent.IsTorrent(rawurl, "") {
+		return probeTorrent(ctx, rawurl, filenameHint, headers, runtime)
+	}
+
 	var resp *http.Response
 	var err error
 
-	// Create a client that preserves headers on redirects (for authenticated downloads)
-	transport := &http.Transport{}
-	
-	// Configure proxy if runtime config is provided
-	if runtime != nil && runtime.ProxyURL != "" {
-		parsedURL, parseErr := url.Parse(runtime.ProxyURL)
-		if parseErr != nil {
-			utils.Debug("Probe: Invalid proxy URL %s: %v", runtime.ProxyURL, parseErr)
-			transport.Proxy = http.ProxyFromEnvironment
-		} else if strings.HasPrefix(parsedURL.Scheme, "socks5") {
-			utils.Debug("Probe: Using SOCKS5 proxy: %s", runtime.ProxyURL)
-			dialer, dialErr := proxy.SOCKS5("tcp", parsedURL.Host, nil, proxy.Direct)
-			if dialErr != nil {
-				utils.Debug("Probe: Failed to create SOCKS5 dialer: %v", dialErr)
-				transport.Proxy = http.ProxyFromEnvironment
-			} else {
-				transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-					return dialer.Dial(network, addr)
-				}
-			}
-		} else {
-			transport.Proxy = http.ProxyURL(parsedURL)
-		}
-	} else {
-		transport.Proxy = http.ProxyFromEnvironment
-	}
-	
-	client := &http.Client{
-		Timeout:   types.ProbeTimeout,
-		Transport: transport,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 10 {
-				return fmt.Errorf("stopped after 10 redirects")
-			}
-			// Copy headers from original request to redirect request
-			if len(via) > 0 {
-				for key, vals := range via[0].Header {
-					if key == "Range" {
-						continue
-					}
-					req.Header[key] = vals
-				}
-			}
-			return nil
-		},
-	}
+	client := newProbeClient(runtime)
 
-	// Configure TLS if runtime config is provided
-	if runtime != nil && runtime.SkipTLSVerification {
-		utils.Debug("Probe: TLS verification disabled")
-		if transport.TLSClientConfig == nil {
-			transport.TLSClientConfig = &tls.Config{
-				InsecureSkipVerify: true,
-			}
-		} else {
-			transport.TLSClientConfig.InsecureSkipVerify = true
+	// Probes count against the host's connection budget like downloads do
+	if u, parseErr := url.Parse(rawurl); parseErr == nil {
+		releaseSlot, slotErr := runtime.AcquireHostSlot(ctx, types.HostKey(u))
+		if slotErr != nil {
+			return nil, slotErr
 		}
+		defer releaseSlot()
 	}
 
 	// Retry logic for probe request
@@ -122,6 +95,8 @@ func ProbeServer(ctx context.Context, rawurl string, filenameHint string, header
 			}
 		}
 
+		runtime.ApplyCredentials(req)
+
 		req.Header.Set("Range", "bytes=0-0")
 		// Set User-Agent only if not provided in custom headers
 		if req.Header.Get("User-Agent") == "" {
@@ -145,6 +120,7 @@ func ProbeServer(ctx context.Context, rawurl string, filenameHint string, header
 					reqNoRange.Header.Set(key, val)
 				}
 			}
+			runtime.ApplyCredentials(reqNoRange)
 			if reqNoRange.Header.Get("User-Agent") == "" {
 				reqNoRange.Header.Set("User-Agent", ua)
 			}
@@ -214,6 +190,17 @@ func ProbeServer(ctx context.Context, rawurl string, filenameHint string, header
 	}
 
 	result.ContentType = resp.Header.Get("Content-Type")
+	result.ETag = resp.Header.Get("ETag")
+	result.LastModified = resp.Header.Get("Last-Modified")
+
+	// A manifest served without a telling extension
+	if stream.IsManifest(rawurl, result.ContentType) {
+		return probeStream(ctx, rawurl, filenameHint, headers, runtime)
+	}
+	// Likewise a .torrent file behind a download link
+	if torrent.IsTorrent(rawurl, result.ContentType) {
+		return probeTorrent(ctx, rawurl, filenameHint, headers, runtime)
+	}
 
 	utils.Debug("Probe complete - filename: %s, size: %d, range: %v",
 		result.Filename, result.FileSize, result.SupportsRange)
@@ -221,6 +208,315 @@ func ProbeServer(ctx context.Context, rawurl string, filenameHint string, header
 	return result, nil
 }
 
+// probeFTP reads the file's metadata over an FTP control connection. REST
+// support plays the part of range support.
+func probeFTP(ctx context.Context, rawurl string, filenameHint string, runtime *types.RuntimeConfig) (*ProbeResult, error) {
+	probeCtx, cancel := context.WithTimeout(ctx, types.ProbeTimeout)
+	defer cancel()
+
+	info, err := ftp.Stat(probeCtx, rawurl, runtime)
+	if err != nil {
+		return nil, fmt.Errorf("probe request failed: %w", err)
+	}
+
+	result := &ProbeResult{
+		FileSize:      info.Size,
+		SupportsRange: info.CanResume,
+		Filename:      filenameHint,
+		LastModified:  info.ModTime,
+	}
+	if result.Filename == "" {
+		// No headers or body to go by, so only the URL path names the file
+		noResponse := &http.Response{Header: http.Header{}, Body: http.NoBody}
+		if result.Filename, _, err = utils.DetermineFilename(rawurl, noResponse, false); err != nil {
+			result.Filename = "download.bin"
+		}
+	}
+
+	utils.Debug("Probe complete - filename: %s, size: %d, rest: %v",
+		result.Filename, result.FileSize, result.SupportsRange)
+	return result, nil
+}
+
+// probeSFTP stats the file over SSH. SFTP reads any range, so resume is
+// always possible.
+func probeSFTP(ctx context.Context, rawurl string, filenameHint string, runtime *types.RuntimeConfig) (*ProbeResult, error) {
+	probeCtx, cancel := context.WithTimeout(ctx, types.ProbeTimeout)
+	defer cancel()
+
+	info, err := sftp.Stat(probeCtx, rawurl, runtime)
+	if err != nil {
+		return nil, fmt.Errorf("probe request failed: %w", err)
+	}
+
+	result := &ProbeResult{
+		FileSize:      info.Size,
+		SupportsRange: true,
+		Filename:      filenameHint,
+		LastModified:  info.ModTime,
+	}
+	if result.Filename == "" {
+		noResponse := &http.Response{Header: http.Header{}, Body: http.NoBody}
+		if result.Filename, _, err = utils.DetermineFilename(rawurl, noResponse, false); err != nil {
+			result.Filename = "download.bin"
+		}
+	}
+
+	utils.Debug("Probe complete - filename: %s, size: %d", result.Filename, result.FileSize)
+	return result, nil
+}
+
+// probeStream resolves an HLS or DASH manifest. The size is the estimate the
+// stream downloader reports progress against; the segments can always be
+// fetched again, so resume is supported.
+func probeStream(ctx context.Context, rawurl string, filenameHint string, headers map[string]string, runtime *types.RuntimeConfig) (*ProbeResult, error) {
+	probeCtx, cancel := context.WithTimeout(ctx, types.ProbeTimeout)
+	defer cancel()
+
+	plan, err := stream.Resolve(probeCtx, newProbeClient(runtime), rawurl, headers, runtime)
+	if err != nil {
+		return nil, fmt.Errorf("probe request failed: %w", err)
+	}
+
+	result := &ProbeResult{
+		FileSize:      plan.TotalSize(),
+		SupportsRange: true,
+		Filename:      filenameHint,
+		ContentType:   plan.Kind.ContentType(),
+	}
+	if result.Filename == "" {
+		// Name the merged media after the manifest
+		noResponse := &http.Response{Header: http.Header{}, Body: http.NoBody}
+		name, _, err := utils.DetermineFilename(rawurl, noResponse, false)
+		if err != nil {
+			name = "stream"
+		}
+		result.Filename = plan.Filename(name)
+	}
+
+	utils.Debug("Probe complete - filename: %s, %d segments, estimated size: %d",
+		result.Filename, len(plan.Segments), result.FileSize)
+	return result, nil
+}
+
+// probeTorrent reads a .torrent file or magnet link. A magnet link carries
+// no info dictionary, so its size stays unknown until peers hand it over.
+// Pieces can be fetched in any order, so resume is supported.
+func probeTorrent(ctx context.Context, rawurl string, filenameHint string, headers map[string]string, runtime *types.RuntimeConfig) (*ProbeResult, error) {
+	probeCtx, cancel := context.WithTimeout(ctx, types.ProbeTimeout)
+	defer cancel()
+
+	meta, err := torrent.Resolve(probeCtx, rawurl, headers, runtime)
+	if err != nil {
+		return nil, fmt.Errorf("probe request failed: %w", err)
+	}
+
+	result := &ProbeResult{
+		SupportsRange: true,
+		Filename:      filenameHint,
+		ContentType:   torrent.ContentType,
+	}
+	if meta.Info != nil {
+		result.FileSize = meta.Info.TotalLength()
+	}
+	if result.Filename == "" {
+		result.Filename = meta.DisplayName()
+	}
+
+	utils.Debug("Probe complete - torrent: %s, size: %d", result.Filename, result.FileSize)
+	return result, nil
+}
+
+// newProbeClient creates a client for metadata requests that honours the
+// proxy and TLS settings and preserves headers on redirects (for authenticated downloads)
+func newProbeClient(runtime *types.RuntimeConfig) *http.Client {
+	transport := &http.Transport{}
+	
+	// Configure proxy if runtime config is provided
+	if runtime != nil && runtime.ProxyURL != "" {
+		parsedURL, parseErr := url.Parse(runtime.ProxyURL)
+		if parseErr != nil {
+			utils.Debug("Probe: Invalid proxy URL %s: %v", runtime.ProxyURL, parseErr)
+			transport.Proxy = http.ProxyFromEnvironment
+		} else if strings.HasPrefix(parsedURL.Scheme, "socks5") {
+			utils.Debug("Probe: Using SOCKS5 proxy: %s", runtime.ProxyURL)
+			dialer, dialErr := proxy.SOCKS5("tcp", parsedURL.Host, nil, proxy.Direct)
+			if dialErr != nil {
+				utils.Debug("Probe: Failed to create SOCKS5 dialer: %v", dialErr)
+				transport.Proxy = http.ProxyFromEnvironment
+			} else {
+				transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+					return dialer.Dial(network, addr)
+				}
+			}
+		} else {
+			transport.Proxy = http.ProxyURL(parsedURL)
+		}
+	} else {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	
+	client := &http.Client{
+		Timeout:   types.ProbeTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			// Copy headers from original request to redirect request,
+			// except stored credentials meant for another host
+			runtime.CopyRedirectHeaders(req, via)
+			return nil
+		},
+	}
+
+	// Configure TLS if runtime config is provided
+	if runtime != nil && runtime.SkipTLSVerification {
+		utils.Debug("Probe: TLS verification disabled")
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{
+				InsecureSkipVerify: true,
+			}
+		} else {
+			transport.TLSClientConfig.InsecureSkipVerify = true
+		}
+	}
+
+	return client
+}
+
+// Checksum files commonly published next to downloads, strongest first.
+// Sidecars are named after the file; manifests cover the whole directory.
+var (
+	checksumSidecars  = []string{".sha512", ".sha256", ".sha1", ".md5", ".sha512sum", ".sha256sum"}
+	checksumManifests = []string{"SHA512SUMS", "SHA256SUMS", "SHA1SUMS", "MD5SUMS", "CHECKSUM.SHA512", "CHECKSUM.SHA256"}
+)
+
+// maxChecksumFileSize caps how much of a sidecar or manifest is read
+const maxChecksumFileSize = 1 << 20
+
+// DiscoverChecksum looks for a published checksum of rawurl in sidecar files
+// (file.iso.sha256) and checksum manifests (SHA256SUMS) in the same directory.
+// filename is also looked up in manifests when the URL name differs.
+// Returns the digest as "algo:hex", or "" if none was found.
+func DiscoverChecksum(ctx context.Context, rawurl string, filename string, headers map[string]string, runtime *types.RuntimeConfig) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		return ""
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.RawPath = ""
+
+	names := []string{path.Base(u.Path)}
+	if filename != "" {
+		names = append(names, filename)
+	}
+
+	client := newProbeClient(runtime)
+
+	candidates := make([]string, 0, len(checksumSidecars)+len(checksumManifests))
+	for _, ext := range checksumSidecars {
+		candidates = append(candidates, u.Path+ext)
+	}
+	for _, name := range checksumManifests {
+		candidates = append(candidates, path.Join(path.Dir(u.Path), name))
+	}
+
+	// Candidates are fetched at once so slow or silent servers don't add up,
+	// but the first one in the list that holds a digest wins
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		index int
+		spec  string
+	}
+	results := make(chan result, len(candidates))
+	for i, candidate := range candidates {
+		go func() {
+			target := *u
+			target.Path = candidate
+			results <- result{i, checksumFromFile(ctx, client, &target, i < len(checksumSidecars), names, headers, runtime)}
+		}()
+	}
+
+	specs := make([]string, len(candidates))
+	done := make([]bool, len(candidates))
+	next := 0
+	for range candidates {
+		r := <-results
+		specs[r.index], done[r.index] = r.spec, true
+		for ; next < len(candidates) && done[next]; next++ {
+			if specs[next] != "" {
+				return specs[next]
+			}
+		}
+	}
+
+	return ""
+}
+
+// checksumFromFile fetches one checksum candidate and returns the digest it
+// holds for names, or "" if it has none.
+func checksumFromFile(ctx context.Context, client *http.Client, target *url.URL, sidecar bool, names []string, headers map[string]string, runtime *types.RuntimeConfig) string {
+	data := fetchChecksumFile(ctx, client, target, headers, runtime)
+	if len(data) == 0 {
+		return ""
+	}
+	entries := checksum.ParseManifest(data, checksum.AlgorithmFromName(target.Path))
+	if spec, ok := checksum.Lookup(entries, names...); ok {
+		utils.Debug("Checksum discovered in %s", target.String())
+		return spec.String()
+	}
+	// A sidecar holding a single bare digest describes the file it is named after
+	if sidecar && len(entries) == 1 && entries[0].Name == "" {
+		utils.Debug("Checksum discovered in %s", target.String())
+		return entries[0].Spec.String()
+	}
+	return ""
+}
+
+// fetchChecksumFile downloads a small checksum file, returning nil unless the
+// server answers 200 with something that isn't an HTML page.
+func fetchChecksumFile(ctx context.Context, client *http.Client, u *url.URL, headers map[string]string, runtime *types.RuntimeConfig) []byte {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil
+	}
+	for key, val := range headers {
+		if key != "Range" {
+			req.Header.Set(key, val)
+		}
+	}
+	runtime.ApplyCredentials(req)
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", ua)
+	}
+
+	releaseSlot, err := runtime.AcquireHostSlot(ctx, types.HostKey(u))
+	if err != nil {
+		return nil
+	}
+	defer releaseSlot()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK || strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxChecksumFileSize+1))
+	if err != nil || len(data) > maxChecksumFileSize {
+		return nil
+	}
+	return data
+}
+
 // ProbeMirrors concurrently checks a list of mirrors and returns valid ones and errors
 func ProbeMirrors(ctx context.Context, mirrors []string, runtime *types.RuntimeConfig) (valid []string, errors map[string]error) {
 	// Deduplicate
@@ -0,0 +1,201 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// MinChunk is the smallest read size recommended while a limit is active
+	MinChunk = 4 * 1024
+
+	// maxSleep bounds a single wait so long reservations still notice cancellation promptly
+	maxSleep = 250 * time.Millisecond
+)
+
+// Limiter is a token bucket measured in bytes per second.
+// A rate of zero (or less) means unlimited. The rate can be changed at any
+// time and goroutines currently waiting pick up the new rate immediately.
+// A nil *Limiter is valid and never blocks.
+type Limiter struct {
+	mu      sync.Mutex
+	rate    int64     // bytes per second, <= 0 means unlimited
+	tokens  float64   // available tokens, may go negative (debt)
+	last    time.Time // last refill time
+	changed chan struct{}
+}
+
+// New creates a limiter with the given rate in bytes per second (0 = unlimited)
+func New(rate int64) *Limiter {
+	l := &Limiter{
+		last:    time.Now(),
+		changed: make(chan struct{}),
+	}
+	l.SetRate(rate)
+	l.tokens = l.burst()
+	return l
+}
+
+// burst returns the bucket capacity: one second worth of tokens
+func (l *Limiter) burst() float64 {
+	if l.rate < MinChunk {
+		return MinChunk
+	}
+	return float64(l.rate)
+}
+
+// refill adds tokens for the time elapsed since the last refill. Caller holds mu.
+func (l *Limiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if b := l.burst(); l.tokens > b {
+			l.tokens = b
+		}
+	}
+	l.last = now
+}
+
+// SetRate changes the limit in bytes per second (0 = unlimited).
+func (l *Limiter) SetRate(rate int64) {
+	if l == nil {
+		return
+	}
+	if rate < 0 {
+		rate = 0
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.refill(now)
+	l.rate = rate
+	if rate > 0 {
+		// Keep outstanding debt bounded so lowering the limit doesn't
+		// stall everyone for minutes paying off reads made at the old rate.
+		b := l.burst()
+		if l.tokens < -b {
+			l.tokens = -b
+		}
+		if l.tokens > b {
+			l.tokens = b
+		}
+	} else {
+		l.tokens = 0
+	}
+	// Wake waiters so they re-evaluate against the new rate
+	if l.changed != nil {
+		close(l.changed)
+	}
+	l.changed = make(chan struct{})
+	l.mu.Unlock()
+}
+
+// Rate returns the current limit in bytes per second (0 = unlimited)
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Limited reports whether the limiter currently enforces a rate
+func (l *Limiter) Limited() bool {
+	return l.Rate() > 0
+}
+
+// WaitN blocks until n bytes may be consumed or ctx is done.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+
+	for {
+		if l.rate <= 0 || l.tokens >= 0 {
+			l.mu.Unlock()
+			return nil
+		}
+
+		wait := time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+		if wait > maxSleep {
+			wait = maxSleep
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			// Give back what we reserved so other waiters aren't penalised
+			l.mu.Lock()
+			if l.rate > 0 {
+				l.tokens += float64(n)
+			}
+			l.mu.Unlock()
+			return ctx.Err()
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		l.mu.Lock()
+		l.refill(time.Now())
+	}
+}
+
+// ChunkSize returns how many bytes a reader should request at once so that
+// a limited transfer trickles smoothly instead of arriving in large bursts.
+// max is returned unchanged when the limiter is unlimited.
+func (l *Limiter) ChunkSize(max int) int {
+	rate := l.Rate()
+	if rate <= 0 {
+		return max
+	}
+	// Aim for roughly ten reads per second
+	chunk := int(rate / 10)
+	if chunk < MinChunk {
+		chunk = MinChunk
+	}
+	if chunk > max {
+		chunk = max
+	}
+	return chunk
+}
+
+// Wait blocks until n bytes may be consumed from every non-nil limiter.
+func Wait(ctx context.Context, n int, limiters ...*Limiter) error {
+	for _, l := range limiters {
+		if err := l.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChunkSize returns the smallest recommended read size across limiters.
+func ChunkSize(max int, limiters ...*Limiter) int {
+	for _, l := range limiters {
+		max = l.ChunkSize(max)
+	}
+	return max
+}
+
+// AnyLimited reports whether any of the limiters enforces a rate.
+func AnyLimited(limiters ...*Limiter) bool {
+	for _, l := range limiters {
+		if l.Limited() {
+			return true
+		}
+	}
+	return false
+}
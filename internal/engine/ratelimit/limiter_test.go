@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiter_UnlimitedNeverBlocks(t *testing.T) {
+	l := New(0)
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := l.WaitN(context.Background(), 1<<20); err != nil {
+			t.Fatalf("WaitN returned error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("unlimited limiter blocked for %v", elapsed)
+	}
+}
+
+func TestLimiter_NilIsUnlimited(t *testing.T) {
+	var l *Limiter
+	if err := l.WaitN(context.Background(), 1<<20); err != nil {
+		t.Fatalf("nil limiter WaitN returned error: %v", err)
+	}
+	if l.Limited() {
+		t.Error("nil limiter should not be limited")
+	}
+	if got := l.ChunkSize(1024); got != 1024 {
+		t.Errorf("nil limiter ChunkSize = %d, want 1024", got)
+	}
+	l.SetRate(100) // must not panic
+}
+
+func TestLimiter_EnforcesRate(t *testing.T) {
+	const rate = 64 * 1024
+	l := New(rate)
+
+	// The first second worth of tokens is available as burst, so consume
+	// two seconds worth and expect roughly one second of waiting.
+	start := time.Now()
+	for sent := 0; sent < 2*rate; sent += 8 * 1024 {
+		if err := l.WaitN(context.Background(), 8*1024); err != nil {
+			t.Fatalf("WaitN returned error: %v", err)
+		}
+	}
+	elapsed := time.Since(start)
+	if elapsed < 800*time.Millisecond {
+		t.Errorf("limiter too permissive: 2s worth of data took %v", elapsed)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("limiter too strict: 2s worth of data took %v", elapsed)
+	}
+}
+
+func TestLimiter_ContextCancel(t *testing.T) {
+	l := New(MinChunk)
+	_ = l.WaitN(context.Background(), MinChunk) // drain burst
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := l.WaitN(ctx, 100*MinChunk)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestLimiter_SetRateWakesWaiters(t *testing.T) {
+	l := New(MinChunk)
+	_ = l.WaitN(context.Background(), MinChunk) // drain burst
+
+	done := make(chan error, 1)
+	go func() {
+		// At MinChunk/s this would take ~100s without the rate change
+		done <- l.WaitN(context.Background(), 100*MinChunk)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	l.SetRate(0)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("WaitN returned error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter was not released after removing the limit")
+	}
+}
+
+func TestLimiter_ChunkSize(t *testing.T) {
+	tests := []struct {
+		name string
+		rate int64
+		max  int
+		want int
+	}{
+		{"unlimited returns max", 0, 32 * 1024, 32 * 1024},
+		{"tenth of rate", 100 * 1024, 32 * 1024, 10 * 1024},
+		{"clamped to min", 1024, 32 * 1024, MinChunk},
+		{"clamped to max", 10 * 1024 * 1024, 32 * 1024, 32 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(tt.rate).ChunkSize(tt.max); got != tt.want {
+				t.Errorf("ChunkSize(%d) = %d, want %d", tt.max, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHelpers_CombineLimiters(t *testing.T) {
+	unlimited := New(0)
+	limited := New(100 * 1024)
+
+	if AnyLimited(unlimited, nil) {
+		t.Error("AnyLimited should be false when no limiter has a rate")
+	}
+	if !AnyLimited(unlimited, limited) {
+		t.Error("AnyLimited should be true when one limiter has a rate")
+	}
+	if got := ChunkSize(32*1024, unlimited, limited); got != 10*1024 {
+		t.Errorf("ChunkSize = %d, want %d", got, 10*1024)
+	}
+}
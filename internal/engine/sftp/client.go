@@ -0,0 +1,287 @@
+// Package sftp downloads files from SSH hosts over SFTP.
+//
+// URLs look like sftp://user@host/path. Paths are absolute; sftp://host/~/path
+// is relative to the remote home directory. Authentication uses the SSH agent
+// and the default keys in ~/.ssh, and the host must already be listed in
+// ~/.ssh/known_hosts.
+package sftp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	pkgsftp "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/net/proxy"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// defaultKeyFiles are the private keys tried from ~/.ssh, in the order ssh(1) uses
+var defaultKeyFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// IsURL reports whether rawurl uses the sftp scheme
+func IsURL(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && strings.EqualFold(u.Scheme, "sftp")
+}
+
+// LoginError is a failure to verify the host or authenticate, which
+// reconnecting won't fix
+type LoginError struct {
+	Err error
+}
+
+func (e *LoginError) Error() string {
+	return "sftp: " + e.Err.Error()
+}
+
+func (e *LoginError) Unwrap() error {
+	return e.Err
+}
+
+// Client is an SFTP session over its own SSH connection
+type Client struct {
+	*pkgsftp.Client
+	conn *ssh.Client
+	done chan struct{} // Closed when the SSH connection ends
+}
+
+// Dial connects to the host in u, verifies its key against known_hosts,
+// authenticates and starts the SFTP subsystem. ctx only bounds the
+// connection setup; use Close to end the session.
+func Dial(ctx context.Context, u *url.URL, runtime *types.RuntimeConfig) (*Client, error) {
+	addr := types.HostKey(u)
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("sftp: can't locate ~/.ssh: %w", err)
+	}
+	sshDir := filepath.Join(home, ".ssh")
+
+	hostKeyCallback, hostKeyAlgorithms, err := knownHostsCallback(filepath.Join(sshDir, "known_hosts"), addr)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, closeAgent := authMethods(u, sshDir)
+	defer closeAgent()
+	if len(auth) == 0 {
+		return nil, &LoginError{Err: fmt.Errorf("no SSH agent, keys in %s or password to log in to %s with", sshDir, u.Hostname())}
+	}
+
+	config := &ssh.ClientConfig{
+		User:              username(u),
+		Auth:              auth,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+		Timeout:           types.DialTimeout,
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, types.DialTimeout)
+	defer cancel()
+	raw, err := newDialer(runtime).DialContext(dialCtx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The handshake itself doesn't take a context
+	stop := context.AfterFunc(ctx, func() { _ = raw.Close() })
+	sshConn, chans, reqs, err := ssh.NewClientConn(raw, addr, config)
+	stop()
+	if err != nil {
+		_ = raw.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &LoginError{Err: err}
+	}
+
+	conn := ssh.NewClient(sshConn, chans, reqs)
+	sc, err := pkgsftp.NewClient(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("sftp: failed to start the SFTP subsystem: %w", err)
+	}
+
+	c := &Client{Client: sc, conn: conn, done: make(chan struct{})}
+	go func() {
+		_ = conn.Wait()
+		close(c.done)
+	}()
+	return c, nil
+}
+
+// Alive reports whether the SSH connection is still up
+func (c *Client) Alive() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Close ends the SFTP session and the SSH connection
+func (c *Client) Close() error {
+	_ = c.Client.Close()
+	return c.conn.Close()
+}
+
+// username returns the user from u, or the local user like ssh(1) does
+func username(u *url.URL) string {
+	if u.User != nil && u.User.Username() != "" {
+		return u.User.Username()
+	}
+	if current, err := user.Current(); err == nil {
+		// Windows reports DOMAIN\user
+		name := current.Username
+		if i := strings.LastIndex(name, `\`); i >= 0 {
+			name = name[i+1:]
+		}
+		return name
+	}
+	return os.Getenv("USER")
+}
+
+// authMethods offers the agent's keys and the default key files, then the
+// URL's password if it has one. The returned func closes the agent
+// connection and must be called once the handshake is done.
+func authMethods(u *url.URL, sshDir string) ([]ssh.AuthMethod, func()) {
+	closeAgent := func() {}
+	var signers []ssh.Signer
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if agentConn, err := net.Dial("unix", sock); err == nil {
+			closeAgent = func() { _ = agentConn.Close() }
+			if agentSigners, err := agent.NewClient(agentConn).Signers(); err == nil {
+				signers = append(signers, agentSigners...)
+			} else {
+				utils.Debug("SFTP: Failed to list agent keys: %v", err)
+			}
+		} else {
+			utils.Debug("SFTP: Failed to reach SSH agent: %v", err)
+		}
+	}
+
+	for _, name := range defaultKeyFiles {
+		pemBytes, err := os.ReadFile(filepath.Join(sshDir, name))
+		if err != nil {
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(pemBytes)
+		if err != nil {
+			// Passphrase protected keys need the agent
+			var missing *ssh.PassphraseMissingError
+			if errors.As(err, &missing) {
+				utils.Debug("SFTP: Skipping %s, it is encrypted (add it to ssh-agent)", name)
+			} else {
+				utils.Debug("SFTP: Failed to parse %s: %v", name, err)
+			}
+			continue
+		}
+		signers = append(signers, signer)
+	}
+
+	// The SSH client tries each method type once, so every key goes in one
+	// publickey method
+	var methods []ssh.AuthMethod
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			methods = append(methods, ssh.Password(pass))
+		}
+	}
+	return methods, closeAgent
+}
+
+// knownHostsCallback verifies host keys against path. It also returns the
+// key algorithms known for addr so the server is asked for a key we can check.
+func knownHostsCallback(path, addr string) (ssh.HostKeyCallback, []string, error) {
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = fmt.Errorf("%s not found; connect with ssh once to trust %s", path, addr)
+		}
+		return nil, nil, &LoginError{Err: err}
+	}
+
+	checked := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) == 0 {
+				return fmt.Errorf("host %s is not in %s; connect with ssh once to trust it", hostname, path)
+			}
+			return fmt.Errorf("host key for %s does not match %s:%d, refusing to connect",
+				hostname, keyErr.Want[0].Filename, keyErr.Want[0].Line)
+		}
+		return err
+	}
+
+	return checked, knownAlgorithms(callback, addr), nil
+}
+
+// placeholderKey is a key no server has, used to read the known keys for an address
+var placeholderKey, _ = ssh.NewPublicKey(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)).Public())
+
+func knownAlgorithms(callback ssh.HostKeyCallback, addr string) []string {
+	var keyErr *knownhosts.KeyError
+	if err := callback(addr, &net.TCPAddr{}, placeholderKey); !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	seen := make(map[string]bool)
+	for _, known := range keyErr.Want {
+		keyType := known.Key.Type()
+		// RSA keys sign with SHA-2 in current servers
+		candidates := []string{keyType}
+		if keyType == ssh.KeyAlgoRSA {
+			candidates = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+		for _, algo := range candidates {
+			if !seen[algo] {
+				seen[algo] = true
+				algorithms = append(algorithms, algo)
+			}
+		}
+	}
+	return algorithms
+}
+
+// newDialer returns a SOCKS5 dialer when one is configured; SSH can't go
+// through an HTTP proxy
+func newDialer(runtime *types.RuntimeConfig) proxy.ContextDialer {
+	direct := &net.Dialer{Timeout: types.DialTimeout, KeepAlive: types.KeepAliveDuration}
+	if runtime == nil || runtime.ProxyURL == "" {
+		return direct
+	}
+	parsed, err := url.Parse(runtime.ProxyURL)
+	if err != nil || !strings.HasPrefix(parsed.Scheme, "socks5") {
+		utils.Debug("SFTP: ignoring non-SOCKS5 proxy %s", runtime.ProxyURL)
+		return direct
+	}
+	dialer, err := proxy.SOCKS5("tcp", parsed.Host, nil, direct)
+	if err != nil {
+		utils.Debug("SFTP: Failed to create SOCKS5 dialer: %v", err)
+		return direct
+	}
+	if cd, ok := dialer.(proxy.ContextDialer); ok {
+		return cd
+	}
+	return direct
+}
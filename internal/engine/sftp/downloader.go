@@ -0,0 +1,484 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pkgsftp "github.com/pkg/sftp"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Downloader reads several ranges of a file in parallel over a single SSH
+// connection, each worker through its own file handle. A paused download
+// saves the remaining ranges to the state DB and continues from them on resume.
+type Downloader struct {
+	ProgressChan chan<- any           // Channel for events (start/complete/error)
+	ID           string               // Download ID
+	State        *types.ProgressState // Shared state for TUI polling
+	Runtime      *types.RuntimeConfig
+	ModTime      string // From Stat; a different value on resume restarts the file
+
+	mu          sync.Mutex
+	queue       []types.Task
+	active      map[int]*segment
+	client      *Client
+	releaseSlot func()
+	closed      bool // Set once the download ends so no worker reconnects
+}
+
+// segment is a task being read by a worker
+type segment struct {
+	offset atomic.Int64 // Next byte to write
+	end    int64
+}
+
+// NewDownloader creates an SFTP downloader
+func NewDownloader(id string, progressCh chan<- any, progState *types.ProgressState, runtime *types.RuntimeConfig) *Downloader {
+	if runtime == nil {
+		runtime = &types.RuntimeConfig{
+			MaxConnectionsPerHost: types.PerHostMax,
+			MinChunkSize:          types.MinChunk,
+			WorkerBufferSize:      types.WorkerBuffer,
+		}
+	}
+	return &Downloader{
+		ID:           id,
+		ProgressChan: progressCh,
+		State:        progState,
+		Runtime:      runtime,
+		active:       make(map[int]*segment),
+	}
+}
+
+// workers returns how many ranges to read at once. They share one
+// connection, so the per-host connection setting caps parallel reads instead.
+func (d *Downloader) workers(fileSize int64) int {
+	n := int(math.Round(math.Sqrt(float64(fileSize) / types.Megabyte)))
+	if minChunk := d.Runtime.GetMinChunkSize(); minChunk > 0 {
+		n = min(n, int(fileSize/minChunk))
+	}
+	return max(1, min(n, d.Runtime.GetMaxConnectionsPerHost()))
+}
+
+// splitTasks divides fileSize into n ranges aligned to AlignSize
+func splitTasks(fileSize int64, n int) ([]types.Task, int64) {
+	chunkSize := (fileSize / int64(n) / types.AlignSize) * types.AlignSize
+	if chunkSize == 0 {
+		chunkSize = types.AlignSize
+	}
+	var tasks []types.Task
+	for offset := int64(0); offset < fileSize; offset += chunkSize {
+		tasks = append(tasks, types.Task{Offset: offset, Length: min(chunkSize, fileSize-offset)})
+	}
+	// Fold a short tail into the last range
+	if len(tasks) > n {
+		last := tasks[len(tasks)-1]
+		tasks = tasks[:len(tasks)-1]
+		tasks[len(tasks)-1].Length += last.Length
+	}
+	return tasks, chunkSize
+}
+
+// Download fetches rawurl into destPath. fileSize is the size from Stat.
+func (d *Downloader) Download(ctx context.Context, rawurl string, destPath string, fileSize int64) error {
+	utils.Debug("SFTP Download: %s -> %s (size: %d)", rawurl, destPath, fileSize)
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	path, err := remotePath(u)
+	if err != nil {
+		return err
+	}
+
+	downloadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if d.State != nil {
+		d.State.SetCancelFunc(cancel)
+	}
+
+	// Reads don't take a context; closing the session interrupts them
+	stop := context.AfterFunc(downloadCtx, d.shutdown)
+	defer stop()
+	defer d.shutdown()
+
+	workingPath := destPath + types.IncompleteSuffix
+	outFile, err := os.OpenFile(workingPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() { _ = outFile.Close() }()
+
+	var tasks []types.Task
+	numWorkers := 0
+	if fileSize > 0 {
+		numWorkers = d.workers(fileSize)
+		var chunkSize int64
+		tasks, chunkSize = splitTasks(fileSize, numWorkers)
+		if d.State != nil {
+			d.State.InitBitmap(fileSize, chunkSize)
+		}
+	}
+
+	savedState, err := state.LoadState(rawurl, destPath)
+	isResume := err == nil && savedState != nil && len(savedState.Tasks) > 0
+	if isResume {
+		if err := savedState.ValidateRemote(fileSize, "", d.ModTime); err != nil {
+			utils.Debug("Discarding saved state and restarting: %v", err)
+			isResume = false
+		}
+	}
+
+	if isResume {
+		tasks = savedState.Tasks
+		if d.State != nil {
+			d.State.Downloaded.Store(savedState.Downloaded)
+			d.State.VerifiedProgress.Store(savedState.Downloaded)
+			d.State.SetSavedElapsed(time.Duration(savedState.Elapsed))
+			if len(savedState.ChunkBitmap) > 0 && savedState.ActualChunkSize > 0 {
+				d.State.RestoreBitmap(savedState.ChunkBitmap, savedState.ActualChunkSize)
+				d.State.RecalculateProgress(savedState.Tasks)
+				d.State.Downloaded.Store(d.State.VerifiedProgress.Load())
+			}
+			d.State.SyncSessionStart()
+		}
+		numWorkers = min(numWorkers, len(tasks))
+		utils.Debug("Resuming from saved state: %d tasks, %d bytes downloaded", len(tasks), savedState.Downloaded)
+	} else {
+		if err := outFile.Truncate(fileSize); err != nil {
+			return fmt.Errorf("failed to preallocate file: %w", err)
+		}
+		if d.State != nil {
+			d.State.Downloaded.Store(0)
+			d.State.VerifiedProgress.Store(0)
+			d.State.SyncSessionStart()
+		}
+	}
+
+	d.mu.Lock()
+	d.queue = tasks
+	d.mu.Unlock()
+	if d.State != nil {
+		d.State.SetConnectionTarget(numWorkers, "initial estimate")
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		fatalErr error
+	)
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if err := d.worker(downloadCtx, id, u, path, outFile); err != nil && downloadCtx.Err() == nil {
+				errOnce.Do(func() {
+					fatalErr = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if d.State != nil && d.State.IsPaused() {
+		d.savePausedState(rawurl, destPath, fileSize)
+		return types.ErrPaused
+	}
+	if fatalErr != nil {
+		return fatalErr
+	}
+	if downloadCtx.Err() != nil {
+		return context.Canceled
+	}
+	if len(d.remaining()) > 0 {
+		return fmt.Errorf("sftp: download stopped with ranges left")
+	}
+
+	if err := outFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	_ = outFile.Close()
+	if err := utils.RenameNoReplace(workingPath, destPath); err != nil {
+		return fmt.Errorf("failed to rename completed file: %w", err)
+	}
+	_ = state.DeleteState(d.ID, rawurl, destPath)
+	return nil
+}
+
+// next hands worker id its next range, or false when none are left
+func (d *Downloader) next(id int) (*segment, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.queue) == 0 {
+		return nil, false
+	}
+	task := d.queue[0]
+	d.queue = d.queue[1:]
+	seg := &segment{end: task.Offset + task.Length}
+	seg.offset.Store(task.Offset)
+	d.active[id] = seg
+	return seg, true
+}
+
+// finish drops worker id's range, putting back whatever is left of it
+func (d *Downloader) finish(id int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if seg := d.active[id]; seg != nil {
+		if offset := seg.offset.Load(); offset < seg.end {
+			d.queue = append(d.queue, types.Task{Offset: offset, Length: seg.end - offset})
+		}
+	}
+	delete(d.active, id)
+}
+
+// remaining returns every byte range not written yet
+func (d *Downloader) remaining() []types.Task {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tasks := append([]types.Task(nil), d.queue...)
+	for _, seg := range d.active {
+		if offset := seg.offset.Load(); offset < seg.end {
+			tasks = append(tasks, types.Task{Offset: offset, Length: seg.end - offset})
+		}
+	}
+	return tasks
+}
+
+// session returns the shared SFTP session, connecting if there is none.
+// Workers wait for each other here so only one of them dials.
+func (d *Downloader) session(ctx context.Context, u *url.URL) (*Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil, context.Canceled
+	}
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	releaseSlot, err := d.Runtime.AcquireHostSlot(ctx, types.HostKey(u))
+	if err != nil {
+		return nil, err
+	}
+	client, err := Dial(ctx, u, d.Runtime)
+	if err != nil {
+		releaseSlot()
+		return nil, err
+	}
+	d.client, d.releaseSlot = client, releaseSlot
+	return client, nil
+}
+
+// reset discards client if it is still the shared session, so the next
+// worker to need one reconnects
+func (d *Downloader) reset(client *Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client == client {
+		d.closeSessionLocked()
+	}
+}
+
+// shutdown closes the session for good, interrupting any reads in flight
+func (d *Downloader) shutdown() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	d.closeSessionLocked()
+}
+
+func (d *Downloader) closeSessionLocked() {
+	if d.client == nil {
+		return
+	}
+	_ = d.client.Close()
+	d.releaseSlot()
+	d.client, d.releaseSlot = nil, nil
+}
+
+// worker reads ranges until none are left. A dropped connection is redialed
+// and the range continues from its last written byte.
+func (d *Downloader) worker(ctx context.Context, id int, u *url.URL, path string, file *os.File) error {
+	var (
+		handle     *pkgsftp.File
+		handleFrom *Client // Session the handle belongs to
+	)
+	defer func() {
+		if handle != nil {
+			_ = handle.Close()
+		}
+	}()
+
+	buf := make([]byte, d.Runtime.GetWorkerBufferSize())
+	maxRetries := d.Runtime.GetMaxTaskRetries()
+
+	for {
+		seg, ok := d.next(id)
+		if !ok {
+			return nil
+		}
+		if d.State != nil {
+			d.State.ActiveWorkers.Add(1)
+			d.State.UpdateChunkStatus(seg.offset.Load(), seg.end-seg.offset.Load(), types.ChunkDownloading)
+		}
+
+		var err error
+		for attempt := 0; attempt < maxRetries; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Duration(1<<attempt) * types.RetryBaseDelay):
+				}
+			}
+			if ctx.Err() != nil {
+				break
+			}
+
+			var client *Client
+			client, err = d.session(ctx, u)
+			if err != nil {
+				if isPermanent(err) {
+					break
+				}
+				continue
+			}
+			if handleFrom != client {
+				if handle != nil {
+					_ = handle.Close()
+				}
+				handle, handleFrom = nil, nil
+				if handle, err = client.Open(path); err != nil {
+					handle = nil
+					if !client.Alive() {
+						d.reset(client)
+						continue
+					}
+					break
+				}
+				handleFrom = client
+			}
+
+			err = d.transfer(ctx, handle, file, seg, buf)
+			if err == nil || isPermanent(err) {
+				break
+			}
+			if !client.Alive() {
+				d.reset(client)
+			}
+			utils.Debug("SFTP worker %d: read at %d failed: %v", id, seg.offset.Load(), err)
+		}
+
+		if d.State != nil {
+			d.State.ActiveWorkers.Add(-1)
+		}
+		if ctx.Err() != nil {
+			// Keep the range registered so a pause saves what is left of it
+			return ctx.Err()
+		}
+		d.finish(id)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// isPermanent reports whether err can't be fixed by reconnecting
+func isPermanent(err error) bool {
+	var loginErr *LoginError
+	return errors.As(err, &loginErr) || errors.Is(err, os.ErrNotExist) ||
+		errors.Is(err, os.ErrPermission) || errors.Is(err, errFileChanged)
+}
+
+// errFileChanged means the remote file shrank during the download
+var errFileChanged = errors.New("sftp: remote file is shorter than when the download started")
+
+// transfer reads the rest of seg and writes it in place
+func (d *Downloader) transfer(ctx context.Context, handle *pkgsftp.File, file *os.File, seg *segment, buf []byte) error {
+	offset := seg.offset.Load()
+	for offset < seg.end {
+		size := int64(len(buf))
+		if d.State != nil {
+			size = int64(d.State.BandwidthChunk(len(buf)))
+		}
+		size = min(size, seg.end-offset)
+
+		n, readErr := handle.ReadAt(buf[:size], offset)
+		if n > 0 {
+			if _, err := file.WriteAt(buf[:n], offset); err != nil {
+				return fmt.Errorf("write error: %w", err)
+			}
+			if d.State != nil {
+				d.State.UpdateChunkStatus(offset, int64(n), types.ChunkCompleted)
+				d.State.Downloaded.Add(int64(n))
+			}
+			offset += int64(n)
+			seg.offset.Store(offset)
+
+			if d.State != nil {
+				if err := d.State.WaitBandwidth(ctx, n); err != nil {
+					return err
+				}
+			}
+		}
+		if readErr == io.EOF && offset < seg.end {
+			return errFileChanged
+		}
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+	}
+	return nil
+}
+
+// savePausedState stores the remaining ranges for resume
+func (d *Downloader) savePausedState(rawurl, destPath string, fileSize int64) {
+	remaining := d.remaining()
+	var remainingBytes int64
+	for _, t := range remaining {
+		remainingBytes += t.Length
+	}
+	downloaded := fileSize - remainingBytes
+
+	elapsed := d.State.FinalizePauseSession(downloaded)
+	bitmap, _, _, chunkSize, _ := d.State.GetBitmap()
+	priority, queueOrder := d.State.GetPriority()
+
+	s := &types.DownloadState{
+		URL:             rawurl,
+		ID:              d.ID,
+		DestPath:        destPath,
+		TotalSize:       fileSize,
+		Downloaded:      downloaded,
+		Tasks:           remaining,
+		Filename:        filepath.Base(destPath),
+		Elapsed:         elapsed.Nanoseconds(),
+		ChunkBitmap:     bitmap,
+		ActualChunkSize: chunkSize,
+		RateLimit:       d.State.GetRateLimit(),
+		Checksum:        d.State.GetChecksum(),
+		LastModified:    d.ModTime,
+		Priority:        priority,
+		QueueOrder:      queueOrder,
+		BatchID:         d.State.GetBatchID(),
+		Category:        d.State.GetCategory(),
+	}
+	if err := state.SaveState(rawurl, destPath, s); err != nil {
+		utils.Debug("Failed to save pause state: %v", err)
+	}
+	utils.Debug("SFTP download paused, state saved (Downloaded=%d, RemainingTasks=%d)", downloaded, len(remaining))
+}
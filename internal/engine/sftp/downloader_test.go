@@ -0,0 +1,314 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+var testModTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func initTestState(t *testing.T) string {
+	state.CloseDB()
+	tmpDir := t.TempDir()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	t.Cleanup(state.CloseDB)
+	return tmpDir
+}
+
+func randomData(t *testing.T, size int) []byte {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// download stats rawurl and downloads it like TUIDownload does
+func download(t *testing.T, ctx context.Context, rawurl, destPath string, progress *types.ProgressState, runtime *types.RuntimeConfig) error {
+	t.Helper()
+	info, err := Stat(ctx, rawurl, runtime)
+	if err != nil {
+		return err
+	}
+	d := NewDownloader("sftp-test", nil, progress, runtime)
+	d.ModTime = info.ModTime
+	return d.Download(ctx, rawurl, destPath, info.Size)
+}
+
+func assertFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading result: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("downloaded %d bytes do not match the served %d bytes", len(got), len(want))
+	}
+	if testutil.FileExists(path + types.IncompleteSuffix) {
+		t.Error(".surge file should be removed after completion")
+	}
+}
+
+func TestStat(t *testing.T) {
+	server := testutil.NewSFTPServerT(t)
+	server.SetupClientT(t)
+	server.AddFile("/srv/builds/app.tar", make([]byte, 12345), testModTime)
+
+	info, err := Stat(context.Background(), server.URL("/srv/builds/app.tar"), nil)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size != 12345 || info.ModTime != "Fri, 01 Mar 2024 12:00:00 GMT" {
+		t.Errorf("Stat = %+v", info)
+	}
+
+	if _, err := Stat(context.Background(), server.URL("/srv/missing.tar"), nil); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected ErrNotExist for a missing file, got %v", err)
+	}
+}
+
+func TestDial_HostVerification(t *testing.T) {
+	server := testutil.NewSFTPServerT(t)
+	sshDir := server.SetupClientT(t)
+	server.AddFile("/file.bin", []byte("hello"), testModTime)
+	rawurl := server.URL("/file.bin")
+
+	// A host key that doesn't match known_hosts is refused
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, err := ssh.NewPublicKey(otherKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := knownhosts.Line([]string{u.Host}, otherPub)
+	if err := os.WriteFile(filepath.Join(sshDir, "known_hosts"), []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var loginErr *LoginError
+	if _, err := Stat(context.Background(), rawurl, nil); !errors.As(err, &loginErr) || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("expected a host key mismatch, got %v", err)
+	}
+
+	// An unknown host is refused too
+	if err := os.WriteFile(filepath.Join(sshDir, "known_hosts"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Stat(context.Background(), rawurl, nil); !errors.As(err, &loginErr) || !strings.Contains(err.Error(), "not in") {
+		t.Errorf("expected an unknown host error, got %v", err)
+	}
+}
+
+func TestDial_PasswordAuth(t *testing.T) {
+	server := testutil.NewSFTPServerT(t, testutil.WithSFTPPassword("hunter2"))
+	sshDir := server.SetupClientT(t)
+	server.AddFile("/file.bin", []byte("hello"), testModTime)
+
+	// Without the key only the password can log in
+	if err := os.Remove(filepath.Join(sshDir, "id_ed25519")); err != nil {
+		t.Fatal(err)
+	}
+	withPassword := strings.Replace(server.URL("/file.bin"), "surge@", "surge:hunter2@", 1)
+	if _, err := Stat(context.Background(), withPassword, nil); err != nil {
+		t.Fatalf("password login failed: %v", err)
+	}
+
+	var loginErr *LoginError
+	if _, err := Stat(context.Background(), server.URL("/file.bin"), nil); !errors.As(err, &loginErr) {
+		t.Errorf("expected a LoginError without credentials, got %v", err)
+	}
+}
+
+func TestDownloader_ParallelRanges(t *testing.T) {
+	tmpDir := initTestState(t)
+	data := randomData(t, 4*types.MB+321)
+	server := testutil.NewSFTPServerT(t, testutil.WithSFTPLatency(time.Millisecond))
+	server.SetupClientT(t)
+	server.AddFile("/artifacts/build.bin", data, testModTime)
+
+	destPath := filepath.Join(tmpDir, "build.bin")
+	progress := types.NewProgressState("sftp-test", int64(len(data)))
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 256 * types.KB}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download(t, ctx, server.URL("/artifacts/build.bin"), destPath, progress, runtime); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	assertFile(t, destPath, data)
+	if server.PeakHandles.Load() < 2 {
+		t.Errorf("peak open handles = %d, want ranges read in parallel", server.PeakHandles.Load())
+	}
+	// Stat and the download each use one connection
+	if server.Connections.Load() != 2 {
+		t.Errorf("connections = %d, want the ranges to share one", server.Connections.Load())
+	}
+	if got := progress.Downloaded.Load(); got != int64(len(data)) {
+		t.Errorf("Downloaded = %d, want %d", got, len(data))
+	}
+}
+
+func TestDownloader_Reconnects(t *testing.T) {
+	tmpDir := initTestState(t)
+	data := randomData(t, 2*types.MB)
+	server := testutil.NewSFTPServerT(t, testutil.WithSFTPDropAfter(512*types.KB))
+	server.SetupClientT(t)
+	server.AddFile("/file.bin", data, testModTime)
+
+	destPath := filepath.Join(tmpDir, "file.bin")
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 2, MinChunkSize: 256 * types.KB}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download(t, ctx, server.URL("/file.bin"), destPath, nil, runtime); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, data)
+	if server.Disconnected.Load() == 0 {
+		t.Error("expected the server to drop the connection")
+	}
+}
+
+func TestDownloader_PauseAndResume(t *testing.T) {
+	tmpDir := initTestState(t)
+	data := randomData(t, 2*types.MB)
+	server := testutil.NewSFTPServerT(t, testutil.WithSFTPLatency(5*time.Millisecond))
+	server.SetupClientT(t)
+	server.AddFile("/file.bin", data, testModTime)
+	rawurl := server.URL("/file.bin")
+
+	destPath := filepath.Join(tmpDir, "file.bin")
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 2, MinChunkSize: 256 * types.KB}
+	progress := types.NewProgressState("sftp-test", int64(len(data)))
+
+	go func() {
+		for progress.Downloaded.Load() < 256*types.KB {
+			time.Sleep(5 * time.Millisecond)
+		}
+		progress.Pause()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download(t, ctx, rawurl, destPath, progress, runtime); !errors.Is(err, types.ErrPaused) {
+		t.Fatalf("expected ErrPaused, got %v", err)
+	}
+
+	saved, err := state.LoadState(rawurl, destPath)
+	if err != nil {
+		t.Fatalf("no state saved on pause: %v", err)
+	}
+	if saved.Downloaded <= 0 || saved.Downloaded >= int64(len(data)) || len(saved.Tasks) == 0 {
+		t.Fatalf("unexpected saved state: downloaded=%d tasks=%d", saved.Downloaded, len(saved.Tasks))
+	}
+
+	served := server.BytesServed.Load()
+	resumed := types.NewProgressState("sftp-test", int64(len(data)))
+	if err := download(t, ctx, rawurl, destPath, resumed, runtime); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	assertFile(t, destPath, data)
+
+	if again := server.BytesServed.Load() - served; again >= int64(len(data)) {
+		t.Errorf("resume read %d bytes, expected less than the whole file", again)
+	}
+}
+
+func TestDownloader_ResumeRestartsWhenRemoteChanged(t *testing.T) {
+	tmpDir := initTestState(t)
+	data := randomData(t, 512*types.KB)
+	server := testutil.NewSFTPServerT(t)
+	server.SetupClientT(t)
+	server.AddFile("/file.bin", data, testModTime)
+	rawurl := server.URL("/file.bin")
+	destPath := filepath.Join(tmpDir, "file.bin")
+
+	// Progress saved against an older copy of the file
+	if err := os.WriteFile(destPath+types.IncompleteSuffix, make([]byte, len(data)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	half := int64(len(data) / 2)
+	if err := state.SaveState(rawurl, destPath, &types.DownloadState{
+		ID:           "sftp-test",
+		URL:          rawurl,
+		DestPath:     destPath,
+		TotalSize:    int64(len(data)),
+		Downloaded:   half,
+		Tasks:        []types.Task{{Offset: half, Length: int64(len(data)) - half}},
+		LastModified: testModTime.Add(-time.Hour).Format(time.RFC1123),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := download(t, context.Background(), rawurl, destPath, nil, nil); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, data)
+}
+
+func TestDownloader_EmptyFile(t *testing.T) {
+	tmpDir := initTestState(t)
+	server := testutil.NewSFTPServerT(t)
+	server.SetupClientT(t)
+	server.AddFile("/empty", nil, testModTime)
+
+	destPath := filepath.Join(tmpDir, "empty")
+	if err := download(t, context.Background(), server.URL("/empty"), destPath, nil, nil); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, nil)
+}
+
+func TestRemotePath(t *testing.T) {
+	tests := []struct {
+		rawurl  string
+		want    string
+		wantErr bool
+	}{
+		{"sftp://host/srv/file.tar", "/srv/file.tar", false},
+		{"sftp://user@host/~/builds/app.tar", "builds/app.tar", false},
+		{"sftp://host/", "", true},
+		{"sftp://host/srv/", "", true},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.rawurl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := remotePath(u)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("remotePath(%q) = %q, %v", tt.rawurl, got, err)
+		}
+	}
+}
+
+func TestIsURL(t *testing.T) {
+	if !IsURL("sftp://user@host/file") || !IsURL("SFTP://host/file") {
+		t.Error("sftp URLs not recognised")
+	}
+	if IsURL("ftp://host/file") || IsURL("https://host/file") {
+		t.Error("other schemes recognised as sftp")
+	}
+}
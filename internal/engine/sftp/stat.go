@@ -0,0 +1,67 @@
+package sftp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Info describes a remote file
+type Info struct {
+	Size    int64
+	ModTime string // In HTTP date format, like Last-Modified
+}
+
+// Stat reads the size and modification time of the file at rawurl
+func Stat(ctx context.Context, rawurl string, runtime *types.RuntimeConfig) (*Info, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	path, err := remotePath(u)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseSlot, err := runtime.AcquireHostSlot(ctx, types.HostKey(u))
+	if err != nil {
+		return nil, err
+	}
+	defer releaseSlot()
+
+	c, err := Dial(ctx, u, runtime)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = c.Close() }()
+
+	fi, err := c.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("sftp: %s is not a regular file", path)
+	}
+
+	info := &Info{Size: fi.Size(), ModTime: fi.ModTime().UTC().Format(http.TimeFormat)}
+	utils.Debug("SFTP stat %s: size=%d mtime=%s", u.Redacted(), info.Size, info.ModTime)
+	return info, nil
+}
+
+// remotePath returns the path to open for u. A leading /~/ makes it
+// relative to the home directory, which is where the session starts.
+func remotePath(u *url.URL) (string, error) {
+	p := u.Path
+	if rest, ok := strings.CutPrefix(p, "/~/"); ok {
+		p = rest
+	}
+	if p == "" || p == "/" || strings.HasSuffix(p, "/") {
+		return "", fmt.Errorf("sftp: %s does not name a file", u.Redacted())
+	}
+	return p, nil
+}
@@ -3,8 +3,10 @@ package single
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"net/http"
 	"net/url"
@@ -96,7 +98,18 @@ func (d *SingleDownloader) Download(ctx context.Context, rawurl, destPath string
 	for key, val := range d.Headers {
 		req.Header.Set(key, val)
 	}
-	req.Header.Set("User-Agent", d.Runtime.GetUserAgent())
+	d.Runtime.ApplyCredentials(req)
+	// Set User-Agent from config only if not provided in custom headers
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", d.Runtime.GetUserAgent())
+	}
+
+	// The connection stays open for the whole download
+	releaseSlot, err := d.Runtime.AcquireHostSlot(ctx, types.HostKey(req.URL))
+	if err != nil {
+		return err
+	}
+	defer releaseSlot()
 
 	resp, err := d.Client.Do(req)
 	if err != nil {
@@ -143,7 +156,12 @@ func (d *SingleDownloader) Download(ctx context.Context, rawurl, destPath string
 		default:
 		}
 
-		nr, readErr := resp.Body.Read(buf)
+		readBuf := buf
+		if d.State != nil {
+			readBuf = buf[:d.State.BandwidthChunk(len(buf))]
+		}
+
+		nr, readErr := resp.Body.Read(readBuf)
 		if nr > 0 {
 			nw, writeErr := outFile.Write(buf[0:nr])
 			if nw > 0 {
@@ -159,6 +177,11 @@ func (d *SingleDownloader) Download(ctx context.Context, rawurl, destPath string
 			if nr != nw {
 				return io.ErrShortWrite
 			}
+			if d.State != nil {
+				if err := d.State.WaitBandwidth(ctx, nr); err != nil {
+					return err
+				}
+			}
 		}
 		if readErr != nil {
 			if readErr == io.EOF {
@@ -176,7 +199,11 @@ func (d *SingleDownloader) Download(ctx context.Context, rawurl, destPath string
 	}
 
 	// Rename .surge file to final destination
-	if err := os.Rename(workingPath, destPath); err != nil {
+	if err := utils.RenameNoReplace(workingPath, destPath); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			success = true // Kept for the caller to settle the conflict
+			return fmt.Errorf("failed to finalize file: %w", err)
+		}
 		// Fallback: copy if rename fails (cross-device)
 		if copyErr := copyFile(workingPath, destPath); copyErr != nil {
 			return fmt.Errorf("failed to finalize file: %w", copyErr)
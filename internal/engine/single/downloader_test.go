@@ -2,6 +2,8 @@ package single
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -494,3 +496,23 @@ func TestSingleDownloader_Download_ContentIntegrity(t *testing.T) {
 		t.Error("Content should not be all zeros with random data")
 	}
 }
+
+func TestSingleDownloader_Download_KeepsHeaderUserAgent(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(t.TempDir(), "ua.bin")
+	downloader := NewSingleDownloader("ua-id", nil, types.NewProgressState("ua-test", 4), &types.RuntimeConfig{UserAgent: "configured/1.0"})
+	downloader.Headers = map[string]string{"User-Agent": "custom/2.0"}
+
+	if err := downloader.Download(context.Background(), server.URL, destPath, 4, "ua.bin"); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if got != "custom/2.0" {
+		t.Errorf("User-Agent = %q, want the one from the headers", got)
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"path/filepath"
 	"sync"
 
+	"github.com/surge-downloader/surge/internal/auth"
 	_ "modernc.org/sqlite"
 )
 
@@ -24,6 +26,14 @@ func Configure(path string) {
 	configured = true
 }
 
+// secrets returns the store whose key seals secrets kept in the database:
+// the credential store's key, which is kept next to it
+func secrets() auth.Store {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+	return auth.Store{KeyPath: filepath.Join(filepath.Dir(dbPath), auth.KeyFileName)}
+}
+
 // InitDB initializes the SQLite database connection using the configured path
 func initDB() error {
 	dbMu.Lock()
@@ -39,9 +49,10 @@ func initDB() error {
 
 	// Ensure directory exists - caller should perhaps do this, but safe to do here if path is provided
 
-	// Open database
+	// Open database. Queries from concurrent goroutines wait for each other
+	// instead of failing with SQLITE_BUSY.
 	var err error
-	db, err = sql.Open("sqlite", dbPath)
+	db, err = sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -70,6 +81,32 @@ func initDB() error {
 		length INTEGER,
 		FOREIGN KEY(download_id) REFERENCES downloads(id) ON DELETE CASCADE
 	);
+
+	CREATE TABLE IF NOT EXISTS piece_hashes (
+		download_id TEXT PRIMARY KEY,
+		algorithm TEXT NOT NULL,
+		piece_length INTEGER NOT NULL,
+		hashes TEXT NOT NULL,
+		FOREIGN KEY(download_id) REFERENCES downloads(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS batches (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		created_at INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS download_hooks (
+		download_id TEXT PRIMARY KEY,
+		hooks TEXT NOT NULL,
+		FOREIGN KEY(download_id) REFERENCES downloads(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS download_requests (
+		download_id TEXT PRIMARY KEY,
+		settings TEXT NOT NULL,
+		FOREIGN KEY(download_id) REFERENCES downloads(id) ON DELETE CASCADE
+	);
 	`
 
 	if _, err := db.Exec(query); err != nil {
@@ -89,6 +126,34 @@ func initDB() error {
 	// Migration: Add file_hash for integrity verification of paused downloads
 	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN file_hash TEXT")
 
+	// Migration: Add per-download bandwidth limit (bytes/sec, 0 = unlimited)
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN rate_limit INTEGER")
+
+	// Migration: Add expected checksum and its verification result
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN checksum TEXT")
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN checksum_status TEXT")
+
+	// Migration: Add remote validators used to detect a changed file on resume
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN etag TEXT")
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN last_modified TEXT")
+
+	// Migration: Add queue priority and order so the queue survives restarts
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN priority INTEGER")
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN queue_order INTEGER")
+
+	// Migration: Add the batch a download was added in, e.g. by a mirror crawl
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN batch_id TEXT")
+
+	// Migration: Add the category a download is filed under
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN category TEXT")
+
+	// Migration: Add the output of the hooks run when the download finished
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN hook_output TEXT")
+
+	// Nothing is queued in memory yet, so a batch without downloads in the
+	// table has had all of them removed
+	_, _ = db.Exec("DELETE FROM batches WHERE id NOT IN (SELECT batch_id FROM downloads WHERE batch_id IS NOT NULL)")
+
 	return nil
 }
 
@@ -3,15 +3,19 @@ package state
 import (
 	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
 )
@@ -48,8 +52,8 @@ func SaveState(url string, destPath string, state *types.DownloadState) error {
 		// 1. Upsert into downloads table
 		_, err := tx.Exec(`
 			INSERT INTO downloads (
-				id, url, dest_path, filename, status, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size, file_hash
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				id, url, dest_path, filename, status, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size, file_hash, rate_limit, checksum, etag, last_modified, priority, queue_order, batch_id, category
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 			ON CONFLICT(id) DO UPDATE SET
 				url=excluded.url,
 				dest_path=excluded.dest_path,
@@ -63,8 +67,16 @@ func SaveState(url string, destPath string, state *types.DownloadState) error {
 				mirrors=excluded.mirrors,
 				chunk_bitmap=excluded.chunk_bitmap,
 				actual_chunk_size=excluded.actual_chunk_size,
-				file_hash=excluded.file_hash
-		`, state.ID, state.URL, state.DestPath, state.Filename, "paused", state.TotalSize, state.Downloaded, state.URLHash, state.CreatedAt, state.PausedAt, state.Elapsed/1e6, strings.Join(state.Mirrors, ","), state.ChunkBitmap, state.ActualChunkSize, state.FileHash)
+				file_hash=excluded.file_hash,
+				rate_limit=excluded.rate_limit,
+				checksum=excluded.checksum,
+				etag=excluded.etag,
+				last_modified=excluded.last_modified,
+				priority=excluded.priority,
+				queue_order=excluded.queue_order,
+				batch_id=excluded.batch_id,
+				category=excluded.category
+		`, state.ID, state.URL, state.DestPath, state.Filename, "paused", state.TotalSize, state.Downloaded, state.URLHash, state.CreatedAt, state.PausedAt, state.Elapsed/1e6, strings.Join(state.Mirrors, ","), state.ChunkBitmap, state.ActualChunkSize, state.FileHash, state.RateLimit, state.Checksum, state.ETag, state.LastModified, state.Priority, state.QueueOrder, state.BatchID, state.Category)
 		if err != nil {
 			return fmt.Errorf("failed to upsert download: %w", err)
 		}
@@ -141,21 +153,24 @@ func LoadState(url string, destPath string) (*types.DownloadState, error) {
 	}
 
 	var state types.DownloadState
-	var timeTaken, createdAt, pausedAt, actualChunkSize sql.NullInt64 // handle null
-	var mirrors, fileHash sql.NullString                              // handle null mirrors/hash
+	var timeTaken, createdAt, pausedAt, actualChunkSize, rateLimit sql.NullInt64 // handle null
+	var mirrors, fileHash, checksum sql.NullString                               // handle null mirrors/hash
+	var etag, lastModified, batchID, category sql.NullString
+	var priority, queueOrder sql.NullInt64
 	var chunkBitmap []byte
 
 	row := db.QueryRow(`
-		SELECT id, url, dest_path, filename, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size, file_hash
+		SELECT id, url, dest_path, filename, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size, file_hash, rate_limit, checksum, etag, last_modified, priority, queue_order, batch_id, category
 		FROM downloads 
-		WHERE url = ? AND dest_path = ? AND status != 'completed'
+		WHERE url = ? AND dest_path = ? AND status NOT IN ('completed', 'skipped')
 		ORDER BY paused_at DESC LIMIT 1
 	`, url, destPath)
 
 	err := row.Scan(
 		&state.ID, &state.URL, &state.DestPath, &state.Filename,
 		&state.TotalSize, &state.Downloaded, &state.URLHash,
-		&createdAt, &pausedAt, &timeTaken, &mirrors, &chunkBitmap, &actualChunkSize, &fileHash,
+		&createdAt, &pausedAt, &timeTaken, &mirrors, &chunkBitmap, &actualChunkSize, &fileHash, &rateLimit, &checksum, &etag, &lastModified,
+		&priority, &queueOrder, &batchID, &category,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -184,6 +199,18 @@ func LoadState(url string, destPath string) (*types.DownloadState, error) {
 	if fileHash.Valid {
 		state.FileHash = fileHash.String
 	}
+	if rateLimit.Valid {
+		state.RateLimit = rateLimit.Int64
+	}
+	if checksum.Valid {
+		state.Checksum = checksum.String
+	}
+	state.ETag = etag.String
+	state.LastModified = lastModified.String
+	state.Priority = types.Priority(priority.Int64)
+	state.QueueOrder = queueOrder.Int64
+	state.BatchID = batchID.String
+	state.Category = category.String
 
 	// Load tasks
 	rows, err := db.Query("SELECT offset, length FROM tasks WHERE download_id = ?", state.ID)
@@ -256,7 +283,7 @@ func LoadMasterList() (*types.MasterList, error) {
 	}
 
 	rows, err := db.Query(`
-		SELECT id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, avg_speed 
+		SELECT id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, avg_speed, rate_limit, checksum, checksum_status, priority, queue_order, batch_id, category, hook_output
 		FROM downloads
 	`)
 	if err != nil {
@@ -271,13 +298,16 @@ func LoadMasterList() (*types.MasterList, error) {
 	var list types.MasterList
 	for rows.Next() {
 		var e types.DownloadEntry
-		var completedAt, timeTaken sql.NullInt64      // handle nulls
-		var filename, urlHash, mirrors sql.NullString // handle nulls
-		var avgSpeed sql.NullFloat64                  // handle null avg_speed
+		var completedAt, timeTaken, rateLimit sql.NullInt64 // handle nulls
+		var filename, urlHash, mirrors sql.NullString       // handle nulls
+		var avgSpeed sql.NullFloat64                        // handle null avg_speed
+		var checksum, checksumStatus, batchID, category, hookOutput sql.NullString
+		var priority, queueOrder sql.NullInt64
 
 		if err := rows.Scan(
 			&e.ID, &e.URL, &e.DestPath, &filename, &e.Status, &e.TotalSize, &e.Downloaded,
-			&completedAt, &timeTaken, &urlHash, &mirrors, &avgSpeed,
+			&completedAt, &timeTaken, &urlHash, &mirrors, &avgSpeed, &rateLimit, &checksum, &checksumStatus,
+			&priority, &queueOrder, &batchID, &category, &hookOutput,
 		); err != nil {
 			return nil, err
 		}
@@ -300,6 +330,16 @@ func LoadMasterList() (*types.MasterList, error) {
 		if avgSpeed.Valid {
 			e.AvgSpeed = avgSpeed.Float64
 		}
+		if rateLimit.Valid {
+			e.RateLimit = rateLimit.Int64
+		}
+		e.Checksum = checksum.String
+		e.ChecksumStatus = checksumStatus.String
+		e.Priority = types.Priority(priority.Int64)
+		e.QueueOrder = queueOrder.Int64
+		e.BatchID = batchID.String
+		e.Category = category.String
+		e.HookOutput = hookOutput.String
 
 		list.Downloads = append(list.Downloads, e)
 	}
@@ -322,8 +362,8 @@ func AddToMasterList(entry types.DownloadEntry) error {
 	return withTx(func(tx *sql.Tx) error {
 		_, err := tx.Exec(`
 			INSERT INTO downloads (
-				id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, avg_speed
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, avg_speed, rate_limit, checksum, checksum_status, priority, queue_order, batch_id, category
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 			ON CONFLICT(id) DO UPDATE SET
 				url=excluded.url,
 				dest_path=excluded.dest_path,
@@ -335,10 +375,18 @@ func AddToMasterList(entry types.DownloadEntry) error {
 				time_taken=excluded.time_taken,
 				url_hash=excluded.url_hash,
 				mirrors=excluded.mirrors,
-				avg_speed=excluded.avg_speed
+				avg_speed=excluded.avg_speed,
+				rate_limit=excluded.rate_limit,
+				checksum=excluded.checksum,
+				checksum_status=excluded.checksum_status,
+				priority=excluded.priority,
+				queue_order=excluded.queue_order,
+				batch_id=excluded.batch_id,
+				category=excluded.category
 		`,
 			entry.ID, entry.URL, entry.DestPath, entry.Filename, entry.Status, entry.TotalSize, entry.Downloaded,
-			entry.CompletedAt, entry.TimeTaken, entry.URLHash, strings.Join(entry.Mirrors, ","), entry.AvgSpeed)
+			entry.CompletedAt, entry.TimeTaken, entry.URLHash, strings.Join(entry.Mirrors, ","), entry.AvgSpeed, entry.RateLimit,
+			entry.Checksum, entry.ChecksumStatus, entry.Priority, entry.QueueOrder, entry.BatchID, entry.Category)
 
 		return err
 	})
@@ -351,10 +399,31 @@ func RemoveFromMasterList(id string) error {
 		return fmt.Errorf("database not initialized")
 	}
 
+	if err := DeleteDownloadSettings(id); err != nil {
+		return err
+	}
 	_, err := db.Exec("DELETE FROM downloads WHERE id = ?", id)
 	return err
 }
 
+// settingsTables hold what a download was added with, apart from its entry
+var settingsTables = []string{"piece_hashes", "download_hooks", "download_requests"}
+
+// DeleteDownloadSettings deletes what was stored for a download when it was
+// added: its piece hashes, hooks and request settings
+func DeleteDownloadSettings(id string) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	for _, table := range settingsTables {
+		if _, err := db.Exec("DELETE FROM "+table+" WHERE download_id = ?", id); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
 // GetDownload returns a single download by ID
 func GetDownload(id string) (*types.DownloadEntry, error) {
 	db := getDBHelper()
@@ -363,19 +432,21 @@ func GetDownload(id string) (*types.DownloadEntry, error) {
 	}
 
 	var e types.DownloadEntry
-	var completedAt, timeTaken sql.NullInt64
-	var urlHash, filename, mirrors sql.NullString
+	var completedAt, timeTaken, rateLimit sql.NullInt64
+	var urlHash, filename, mirrors, checksum, checksumStatus, batchID, category, hookOutput sql.NullString
 	var avgSpeed sql.NullFloat64
+	var priority, queueOrder sql.NullInt64
 
 	row := db.QueryRow(`
-		SELECT id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, avg_speed 
+		SELECT id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, avg_speed, rate_limit, checksum, checksum_status, priority, queue_order, batch_id, category, hook_output
 		FROM downloads
 		WHERE id = ?
 	`, id)
 
 	if err := row.Scan(
 		&e.ID, &e.URL, &e.DestPath, &filename, &e.Status, &e.TotalSize, &e.Downloaded,
-		&completedAt, &timeTaken, &urlHash, &mirrors, &avgSpeed,
+		&completedAt, &timeTaken, &urlHash, &mirrors, &avgSpeed, &rateLimit, &checksum, &checksumStatus,
+		&priority, &queueOrder, &batchID, &category, &hookOutput,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // Not found
@@ -401,11 +472,21 @@ func GetDownload(id string) (*types.DownloadEntry, error) {
 	if avgSpeed.Valid {
 		e.AvgSpeed = avgSpeed.Float64
 	}
+	if rateLimit.Valid {
+		e.RateLimit = rateLimit.Int64
+	}
+	e.Checksum = checksum.String
+	e.ChecksumStatus = checksumStatus.String
+	e.Priority = types.Priority(priority.Int64)
+	e.QueueOrder = queueOrder.Int64
+	e.BatchID = batchID.String
+	e.Category = category.String
+	e.HookOutput = hookOutput.String
 
 	return &e, nil
 }
 
-// LoadPausedDownloads returns all paused downloads
+// LoadPausedDownloads returns all paused and queued downloads in queue order
 func LoadPausedDownloads() ([]types.DownloadEntry, error) {
 	// Reuse LoadMasterList logic or optimize with WHERE
 	list, err := LoadMasterList()
@@ -419,6 +500,9 @@ func LoadPausedDownloads() ([]types.DownloadEntry, error) {
 			paused = append(paused, e)
 		}
 	}
+	sort.SliceStable(paused, func(i, j int) bool {
+		return types.QueuedBefore(paused[i].Priority, paused[i].QueueOrder, paused[j].Priority, paused[j].QueueOrder)
+	})
 	return paused, nil
 }
 
@@ -475,14 +559,138 @@ func UpdateStatus(id string, status string) error {
 	return nil
 }
 
-// PauseAllDownloads pauses all non-completed downloads
+// UpdateRateLimit updates the stored per-download bandwidth limit (bytes/sec)
+func UpdateRateLimit(id string, bytesPerSec int64) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	result, err := db.Exec("UPDATE downloads SET rate_limit = ? WHERE id = ?", bytesPerSec, id)
+	if err != nil {
+		return fmt.Errorf("failed to update rate limit: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("download not found: %s", id)
+	}
+
+	return nil
+}
+
+// UpdatePriority updates the stored queue priority and order of a download
+func UpdatePriority(id string, priority types.Priority, queueOrder int64) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	result, err := db.Exec("UPDATE downloads SET priority = ?, queue_order = ? WHERE id = ?", priority, queueOrder, id)
+	if err != nil {
+		return fmt.Errorf("failed to update priority: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("download not found: %s", id)
+	}
+
+	return nil
+}
+
+// SavePieceHashes stores the piece hashes a download is verified against
+func SavePieceHashes(id string, pieces *types.PieceHashes) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	_, err := db.Exec("INSERT OR REPLACE INTO piece_hashes (download_id, algorithm, piece_length, hashes) VALUES (?, ?, ?, ?)",
+		id, pieces.Algorithm, pieces.Length, strings.Join(pieces.Hashes, "\n"))
+	if err != nil {
+		return fmt.Errorf("failed to save piece hashes: %w", err)
+	}
+	return nil
+}
+
+// LoadPieceHashes returns the piece hashes stored for a download, or nil if
+// it has none
+func LoadPieceHashes(id string) (*types.PieceHashes, error) {
+	db := getDBHelper()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	var (
+		pieces types.PieceHashes
+		hashes string
+	)
+	err := db.QueryRow("SELECT algorithm, piece_length, hashes FROM piece_hashes WHERE download_id = ?", id).
+		Scan(&pieces.Algorithm, &pieces.Length, &hashes)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load piece hashes: %w", err)
+	}
+	pieces.Hashes = strings.Split(hashes, "\n")
+	return &pieces, nil
+}
+
+// SaveBatch records a batch, keeping the name of one that already exists
+func SaveBatch(batch types.Batch) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	if batch.CreatedAt == 0 {
+		batch.CreatedAt = time.Now().Unix()
+	}
+	_, err := db.Exec("INSERT OR IGNORE INTO batches (id, name, created_at) VALUES (?, ?, ?)", batch.ID, batch.Name, batch.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save batch: %w", err)
+	}
+	return nil
+}
+
+// ListBatches returns every batch, oldest first
+func ListBatches() ([]types.Batch, error) {
+	db := getDBHelper()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := db.Query("SELECT id, name, created_at FROM batches ORDER BY created_at, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list batches: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var batches []types.Batch
+	for rows.Next() {
+		var (
+			b         types.Batch
+			createdAt sql.NullInt64
+		)
+		if err := rows.Scan(&b.ID, &b.Name, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan batch: %w", err)
+		}
+		b.CreatedAt = createdAt.Int64
+		batches = append(batches, b)
+	}
+	return batches, rows.Err()
+}
+
+// PauseAllDownloads pauses all unfinished downloads
 func PauseAllDownloads() error {
 	db := getDBHelper()
 	if db == nil {
 		return fmt.Errorf("database not initialized")
 	}
 
-	_, err := db.Exec("UPDATE downloads SET status = 'paused' WHERE status != 'completed'")
+	_, err := db.Exec("UPDATE downloads SET status = 'paused' WHERE status NOT IN ('completed', 'skipped')")
 	return err
 }
 
@@ -506,19 +714,22 @@ func ListAllDownloads() ([]types.DownloadEntry, error) {
 	return list.Downloads, nil
 }
 
-// RemoveCompletedDownloads removes all completed downloads and returns count
+// RemoveCompletedDownloads removes all completed and skipped downloads and returns count
 func RemoveCompletedDownloads() (int64, error) {
 	db := getDBHelper()
 	if db == nil {
 		return 0, fmt.Errorf("database not initialized")
 	}
 
-	result, err := db.Exec("DELETE FROM downloads WHERE status = 'completed'")
+	// Request settings can hold cookies, so they don't outlive their download
+	_, _ = db.Exec("DELETE FROM download_requests WHERE download_id IN (SELECT id FROM downloads WHERE status IN ('completed', 'skipped'))")
+	result, err := db.Exec("DELETE FROM downloads WHERE status IN ('completed', 'skipped')")
 	if err != nil {
 		return 0, fmt.Errorf("failed to remove completed downloads: %w", err)
 	}
 
 	count, _ := result.RowsAffected()
+	_, _ = db.Exec("DELETE FROM piece_hashes WHERE download_id NOT IN (SELECT id FROM downloads)")
 	return count, nil
 }
 
@@ -544,9 +755,9 @@ func LoadStates(ids []string) (map[string]*types.DownloadState, error) {
 
 	// 1. Load Downloads
 	query := fmt.Sprintf(`
-		SELECT id, url, dest_path, filename, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size
+		SELECT id, url, dest_path, filename, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size, rate_limit, checksum, etag, last_modified, priority, queue_order, batch_id, category
 		FROM downloads
-		WHERE id IN (%s) AND status != 'completed'
+		WHERE id IN (%s) AND status NOT IN ('completed', 'skipped')
 	`, inClause)
 
 	rows, err := db.Query(query, args...)
@@ -564,14 +775,15 @@ func LoadStates(ids []string) (map[string]*types.DownloadState, error) {
 
 	for rows.Next() {
 		var state types.DownloadState
-		var timeTaken, createdAt, pausedAt, actualChunkSize sql.NullInt64
-		var mirrors sql.NullString
+		var timeTaken, createdAt, pausedAt, actualChunkSize, rateLimit, priority, queueOrder sql.NullInt64
+		var mirrors, checksum, etag, lastModified, batchID, category sql.NullString
 		var chunkBitmap []byte
 
 		if err := rows.Scan(
 			&state.ID, &state.URL, &state.DestPath, &state.Filename,
 			&state.TotalSize, &state.Downloaded, &state.URLHash,
-			&createdAt, &pausedAt, &timeTaken, &mirrors, &chunkBitmap, &actualChunkSize,
+			&createdAt, &pausedAt, &timeTaken, &mirrors, &chunkBitmap, &actualChunkSize, &rateLimit, &checksum, &etag, &lastModified,
+			&priority, &queueOrder, &batchID, &category,
 		); err != nil {
 			return nil, err
 		}
@@ -592,6 +804,16 @@ func LoadStates(ids []string) (map[string]*types.DownloadState, error) {
 			state.ActualChunkSize = actualChunkSize.Int64
 		}
 		state.ChunkBitmap = chunkBitmap
+		if rateLimit.Valid {
+			state.RateLimit = rateLimit.Int64
+		}
+		state.Checksum = checksum.String
+		state.ETag = etag.String
+		state.LastModified = lastModified.String
+		state.Priority = types.Priority(priority.Int64)
+		state.QueueOrder = queueOrder.Int64
+		state.BatchID = batchID.String
+		state.Category = category.String
 
 		states[state.ID] = &state
 	}
@@ -642,7 +864,16 @@ func removeIncompleteFilePath(surgePath string) error {
 	if surgePath == "" {
 		return nil
 	}
-	if err := os.Remove(surgePath); err != nil && !os.IsNotExist(err) {
+	// A multi file torrent downloads into a .surge directory
+	remove := os.Remove
+	if info, err := os.Stat(surgePath); err == nil && info.IsDir() {
+		remove = os.RemoveAll
+	}
+	if err := remove(surgePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// Stream downloads keep their finished segments next to the .surge file
+	if err := os.RemoveAll(surgePath + types.PartsSuffix); err != nil {
 		return err
 	}
 	return nil
@@ -661,6 +892,11 @@ func removeDownloadAndTasks(id string) error {
 		if _, err := tx.Exec("DELETE FROM tasks WHERE download_id = ?", id); err != nil {
 			return fmt.Errorf("failed to delete tasks: %w", err)
 		}
+		for _, table := range settingsTables {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE download_id = ?", id); err != nil {
+				return fmt.Errorf("failed to delete from %s: %w", table, err)
+			}
+		}
 		if _, err := tx.Exec("DELETE FROM downloads WHERE id = ?", id); err != nil {
 			return fmt.Errorf("failed to delete download: %w", err)
 		}
@@ -677,6 +913,14 @@ func ValidateIntegrity() (int, error) {
 		return 0, fmt.Errorf("database not initialized")
 	}
 
+	// Nothing is queued yet, so settings without an entry belong to downloads
+	// that were added and then lost, e.g. to a crash
+	for _, table := range settingsTables {
+		if _, err := db.Exec("DELETE FROM " + table + " WHERE download_id NOT IN (SELECT id FROM downloads)"); err != nil {
+			return 0, fmt.Errorf("failed to clean %s: %w", table, err)
+		}
+	}
+
 	// Load all paused/queued downloads
 	rows, err := db.Query(`
 		SELECT id, dest_path, file_hash, status, downloaded
@@ -748,7 +992,7 @@ func ValidateIntegrity() (int, error) {
 			return 0, fmt.Errorf("failed to scan download path: %w", err)
 		}
 		candidateDirs[filepath.Dir(dest)] = struct{}{}
-		if status != "completed" {
+		if status != "completed" && status != "skipped" {
 			expectedSurgePaths[dest+types.IncompleteSuffix] = struct{}{}
 		}
 	}
@@ -830,3 +1074,123 @@ func ValidateIntegrity() (int, error) {
 
 	return removed, nil
 }
+
+// SaveDownloadHooks stores the hooks that replace the configured ones for a
+// single download
+func SaveDownloadHooks(id string, hooks config.HookSettings) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	data, err := json.Marshal(hooks)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO download_hooks (download_id, hooks) VALUES (?, ?)
+		ON CONFLICT(download_id) DO UPDATE SET hooks=excluded.hooks
+	`, id, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to save hooks: %w", err)
+	}
+	return nil
+}
+
+// LoadDownloadHooks returns the hooks of a download, or nil if it uses the
+// configured ones
+func LoadDownloadHooks(id string) (*config.HookSettings, error) {
+	db := getDBHelper()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	var data string
+	err := db.QueryRow("SELECT hooks FROM download_hooks WHERE download_id = ?", id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hooks: %w", err)
+	}
+	var hooks config.HookSettings
+	if err := json.Unmarshal([]byte(data), &hooks); err != nil {
+		return nil, fmt.Errorf("invalid hooks of %s: %w", id, err)
+	}
+	return &hooks, nil
+}
+
+// SaveRequestSettings stores the headers and proxy a download was added
+// with. They can hold cookies and logins, so they are encrypted with the
+// credential store's key.
+func SaveRequestSettings(id string, settings types.RequestSettings) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	sealed, err := secrets().Seal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt request settings: %w", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO download_requests (download_id, settings) VALUES (?, ?)
+		ON CONFLICT(download_id) DO UPDATE SET settings=excluded.settings
+	`, id, base64.StdEncoding.EncodeToString(sealed))
+	if err != nil {
+		return fmt.Errorf("failed to save request settings: %w", err)
+	}
+	return nil
+}
+
+// LoadRequestSettings returns the headers and proxy of a download, or nil if
+// it was added without any
+func LoadRequestSettings(id string) (*types.RequestSettings, error) {
+	db := getDBHelper()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	var data string
+	err := db.QueryRow("SELECT settings FROM download_requests WHERE download_id = ?", id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load request settings: %w", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request settings of %s: %w", id, err)
+	}
+	plain, err := secrets().Open(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt request settings of %s: %w", id, err)
+	}
+	var settings types.RequestSettings
+	if err := json.Unmarshal(plain, &settings); err != nil {
+		return nil, fmt.Errorf("invalid request settings of %s: %w", id, err)
+	}
+	return &settings, nil
+}
+
+// SetHookOutput records what the hooks of a finished download printed
+func SetHookOutput(id string, output string) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	result, err := db.Exec("UPDATE downloads SET hook_output = ? WHERE id = ?", output, id)
+	if err != nil {
+		return fmt.Errorf("failed to save hook output: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("download not found: %s", id)
+	}
+	return nil
+}
@@ -4,10 +4,13 @@ import (
 	"database/sql"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/engine/types"
 )
 
@@ -376,6 +379,7 @@ func TestPauseAllDownloads(t *testing.T) {
 		{ID: "dl-1", URL: "https://a.com/1", DestPath: "/tmp/1", Status: "downloading"},
 		{ID: "dl-2", URL: "https://a.com/2", DestPath: "/tmp/2", Status: "queued"},
 		{ID: "dl-3", URL: "https://a.com/3", DestPath: "/tmp/3", Status: "completed"},
+		{ID: "dl-4", URL: "https://a.com/4", DestPath: "/tmp/4", Status: "skipped"},
 	}
 
 	for _, e := range entries {
@@ -403,6 +407,9 @@ func TestPauseAllDownloads(t *testing.T) {
 	if dl3.Status != "completed" {
 		t.Errorf("dl-3 status = %s, want 'completed' (should not change)", dl3.Status)
 	}
+	if dl4, _ := GetDownload("dl-4"); dl4.Status != "skipped" {
+		t.Errorf("dl-4 status = %s, want 'skipped' (should not change)", dl4.Status)
+	}
 }
 
 // =============================================================================
@@ -976,3 +983,431 @@ func TestAvgSpeedPersistence(t *testing.T) {
 		t.Error("Entry not found in master list")
 	}
 }
+
+func TestRateLimitPersistence(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	testURL := "https://example.com/limited.zip"
+	destPath := filepath.Join(tmpDir, "limited.zip")
+
+	s := &types.DownloadState{
+		ID:        "limit-test",
+		URL:       testURL,
+		DestPath:  destPath,
+		Filename:  "limited.zip",
+		TotalSize: 1000,
+		RateLimit: 512 * 1024,
+	}
+	if err := SaveState(testURL, destPath, s); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	loaded, err := LoadState(testURL, destPath)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if loaded.RateLimit != s.RateLimit {
+		t.Errorf("LoadState RateLimit = %d, want %d", loaded.RateLimit, s.RateLimit)
+	}
+
+	states, err := LoadStates([]string{"limit-test"})
+	if err != nil {
+		t.Fatalf("LoadStates failed: %v", err)
+	}
+	if got := states["limit-test"]; got == nil || got.RateLimit != s.RateLimit {
+		t.Errorf("LoadStates RateLimit mismatch: %+v", got)
+	}
+
+	if err := UpdateRateLimit("limit-test", 0); err != nil {
+		t.Fatalf("UpdateRateLimit failed: %v", err)
+	}
+	entry, err := GetDownload("limit-test")
+	if err != nil || entry == nil {
+		t.Fatalf("GetDownload failed: %v", err)
+	}
+	if entry.RateLimit != 0 {
+		t.Errorf("RateLimit after update = %d, want 0", entry.RateLimit)
+	}
+
+	if err := UpdateRateLimit("missing", 1024); err == nil {
+		t.Error("expected error updating rate limit of missing download")
+	}
+}
+
+func TestChecksumPersistence(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	testURL := "https://example.com/verified.iso"
+	destPath := filepath.Join(tmpDir, "verified.iso")
+	expected := "sha256:" + strings.Repeat("ab", 32)
+
+	s := &types.DownloadState{
+		ID:        "checksum-test",
+		URL:       testURL,
+		DestPath:  destPath,
+		Filename:  "verified.iso",
+		TotalSize: 1000,
+		Checksum:  expected,
+	}
+	if err := SaveState(testURL, destPath, s); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	loaded, err := LoadState(testURL, destPath)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if loaded.Checksum != expected {
+		t.Errorf("LoadState Checksum = %q, want %q", loaded.Checksum, expected)
+	}
+
+	states, err := LoadStates([]string{"checksum-test"})
+	if err != nil {
+		t.Fatalf("LoadStates failed: %v", err)
+	}
+	if got := states["checksum-test"]; got == nil || got.Checksum != expected {
+		t.Errorf("LoadStates Checksum mismatch: %+v", got)
+	}
+
+	// Completion records the verification result
+	if err := AddToMasterList(types.DownloadEntry{
+		ID:             "checksum-test",
+		URL:            testURL,
+		DestPath:       destPath,
+		Filename:       "verified.iso",
+		Status:         "completed",
+		Checksum:       expected,
+		ChecksumStatus: "verified",
+	}); err != nil {
+		t.Fatalf("AddToMasterList failed: %v", err)
+	}
+
+	entry, err := GetDownload("checksum-test")
+	if err != nil || entry == nil {
+		t.Fatalf("GetDownload failed: %v", err)
+	}
+	if entry.Checksum != expected || entry.ChecksumStatus != "verified" {
+		t.Errorf("GetDownload checksum = %q (%q)", entry.Checksum, entry.ChecksumStatus)
+	}
+
+	list, err := LoadMasterList()
+	if err != nil {
+		t.Fatalf("LoadMasterList failed: %v", err)
+	}
+	if len(list.Downloads) != 1 || list.Downloads[0].ChecksumStatus != "verified" {
+		t.Errorf("LoadMasterList checksum status mismatch: %+v", list.Downloads)
+	}
+}
+
+func TestValidatorPersistence(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	testURL := "https://example.com/release.tar.gz"
+	destPath := filepath.Join(tmpDir, "release.tar.gz")
+
+	s := &types.DownloadState{
+		ID:           "validator-test",
+		URL:          testURL,
+		DestPath:     destPath,
+		Filename:     "release.tar.gz",
+		TotalSize:    1000,
+		ETag:         `"5f1c-abc"`,
+		LastModified: "Mon, 02 Jan 2006 15:04:05 GMT",
+	}
+	if err := SaveState(testURL, destPath, s); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	loaded, err := LoadState(testURL, destPath)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if loaded.ETag != s.ETag || loaded.LastModified != s.LastModified {
+		t.Errorf("LoadState validators = (%q, %q), want (%q, %q)", loaded.ETag, loaded.LastModified, s.ETag, s.LastModified)
+	}
+
+	states, err := LoadStates([]string{"validator-test"})
+	if err != nil {
+		t.Fatalf("LoadStates failed: %v", err)
+	}
+	if got := states["validator-test"]; got == nil || got.ETag != s.ETag || got.LastModified != s.LastModified {
+		t.Errorf("LoadStates validators mismatch: %+v", got)
+	}
+}
+
+func TestPriorityPersistence(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	testURL := "https://example.com/big.iso"
+	destPath := filepath.Join(tmpDir, "big.iso")
+
+	s := &types.DownloadState{
+		ID:         "priority-test",
+		URL:        testURL,
+		DestPath:   destPath,
+		Filename:   "big.iso",
+		TotalSize:  1000,
+		Priority:   types.PriorityHigh,
+		QueueOrder: 42,
+	}
+	if err := SaveState(testURL, destPath, s); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	loaded, err := LoadState(testURL, destPath)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if loaded.Priority != types.PriorityHigh || loaded.QueueOrder != 42 {
+		t.Errorf("LoadState priority = (%v, %d), want (high, 42)", loaded.Priority, loaded.QueueOrder)
+	}
+
+	states, err := LoadStates([]string{"priority-test"})
+	if err != nil {
+		t.Fatalf("LoadStates failed: %v", err)
+	}
+	if got := states["priority-test"]; got == nil || got.Priority != types.PriorityHigh || got.QueueOrder != 42 {
+		t.Errorf("LoadStates priority mismatch: %+v", got)
+	}
+
+	if err := UpdatePriority("priority-test", types.PriorityLow, 7); err != nil {
+		t.Fatalf("UpdatePriority failed: %v", err)
+	}
+	entry, err := GetDownload("priority-test")
+	if err != nil || entry == nil {
+		t.Fatalf("GetDownload failed: %v", err)
+	}
+	if entry.Priority != types.PriorityLow || entry.QueueOrder != 7 {
+		t.Errorf("GetDownload priority = (%v, %d), want (low, 7)", entry.Priority, entry.QueueOrder)
+	}
+}
+
+func TestLoadPausedDownloads_QueueOrder(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	entries := []types.DownloadEntry{
+		{ID: "normal-late", URL: "https://example.com/1", Status: "paused", QueueOrder: 20},
+		{ID: "low", URL: "https://example.com/2", Status: "paused", Priority: types.PriorityLow, QueueOrder: 1},
+		{ID: "normal-early", URL: "https://example.com/3", Status: "queued", QueueOrder: 10},
+		{ID: "high", URL: "https://example.com/4", Status: "paused", Priority: types.PriorityHigh, QueueOrder: 30},
+	}
+	for _, e := range entries {
+		if err := AddToMasterList(e); err != nil {
+			t.Fatalf("AddToMasterList(%s) failed: %v", e.ID, err)
+		}
+	}
+
+	paused, err := LoadPausedDownloads()
+	if err != nil {
+		t.Fatalf("LoadPausedDownloads failed: %v", err)
+	}
+	var got []string
+	for _, e := range paused {
+		got = append(got, e.ID)
+	}
+	want := []string{"high", "normal-early", "normal-late", "low"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("LoadPausedDownloads order = %v, want %v", got, want)
+	}
+}
+
+func TestPieceHashesPersistence(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	if p, err := LoadPieceHashes("pieces-test"); err != nil || p != nil {
+		t.Fatalf("LoadPieceHashes without hashes = %+v, %v", p, err)
+	}
+
+	if err := AddToMasterList(types.DownloadEntry{ID: "pieces-test", URL: "https://example.com/a", Status: "completed"}); err != nil {
+		t.Fatal(err)
+	}
+	pieces := &types.PieceHashes{Algorithm: "sha1", Length: 1024, Hashes: []string{"aa", "bb", "cc"}}
+	if err := SavePieceHashes("pieces-test", pieces); err != nil {
+		t.Fatalf("SavePieceHashes failed: %v", err)
+	}
+	loaded, err := LoadPieceHashes("pieces-test")
+	if err != nil || loaded == nil {
+		t.Fatalf("LoadPieceHashes failed: %v", err)
+	}
+	if loaded.Algorithm != "sha1" || loaded.Length != 1024 || strings.Join(loaded.Hashes, ",") != "aa,bb,cc" {
+		t.Errorf("LoadPieceHashes = %+v", loaded)
+	}
+
+	// Clearing completed downloads takes their hashes along
+	if _, err := RemoveCompletedDownloads(); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := LoadPieceHashes("pieces-test"); err != nil || p != nil {
+		t.Errorf("hashes survived their download: %+v, %v", p, err)
+	}
+}
+
+func TestBatches(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	if err := SaveBatch(types.Batch{ID: "batch-b", Name: "second", CreatedAt: 200}); err != nil {
+		t.Fatalf("SaveBatch failed: %v", err)
+	}
+	if err := SaveBatch(types.Batch{ID: "batch-a", Name: "first", CreatedAt: 100}); err != nil {
+		t.Fatalf("SaveBatch failed: %v", err)
+	}
+	// Saving an existing batch again keeps its name
+	if err := SaveBatch(types.Batch{ID: "batch-a", Name: "renamed"}); err != nil {
+		t.Fatalf("SaveBatch failed: %v", err)
+	}
+
+	batches, err := ListBatches()
+	if err != nil {
+		t.Fatalf("ListBatches failed: %v", err)
+	}
+	if len(batches) != 2 || batches[0].ID != "batch-a" || batches[0].Name != "first" || batches[1].ID != "batch-b" {
+		t.Fatalf("ListBatches = %+v, want batch-a (first) then batch-b", batches)
+	}
+
+	if err := AddToMasterList(types.DownloadEntry{
+		ID:       "batched",
+		URL:      "https://example.com/a.bin",
+		DestPath: filepath.Join(tmpDir, "a.bin"),
+		Filename: "a.bin",
+		Status:   "paused",
+		BatchID:  "batch-a",
+	}); err != nil {
+		t.Fatalf("AddToMasterList failed: %v", err)
+	}
+	entry, err := GetDownload("batched")
+	if err != nil || entry == nil || entry.BatchID != "batch-a" {
+		t.Fatalf("GetDownload = %+v, %v; want batch-a", entry, err)
+	}
+
+	// Reopening the database drops batches whose downloads are all gone
+	CloseDB()
+	if err := initDB(); err != nil {
+		t.Fatalf("initDB failed: %v", err)
+	}
+	batches, err = ListBatches()
+	if err != nil {
+		t.Fatalf("ListBatches failed: %v", err)
+	}
+	if len(batches) != 1 || batches[0].ID != "batch-a" {
+		t.Errorf("ListBatches after reopen = %+v, want only batch-a", batches)
+	}
+}
+
+func TestDownloadHooks(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	if h, err := LoadDownloadHooks("hooked"); err != nil || h != nil {
+		t.Fatalf("LoadDownloadHooks without hooks = %+v, %v; want nil", h, err)
+	}
+
+	want := config.HookSettings{OnComplete: "notify-send done", Timeout: time.Minute}
+	if err := SaveDownloadHooks("hooked", want); err != nil {
+		t.Fatalf("SaveDownloadHooks failed: %v", err)
+	}
+	got, err := LoadDownloadHooks("hooked")
+	if err != nil || got == nil || *got != want {
+		t.Fatalf("LoadDownloadHooks = %+v, %v; want %+v", got, err, want)
+	}
+
+	if err := SetHookOutput("hooked", "done"); err == nil {
+		t.Error("SetHookOutput should fail for a download without an entry")
+	}
+	if err := AddToMasterList(types.DownloadEntry{ID: "hooked", URL: "https://example.com/a", DestPath: filepath.Join(tmpDir, "a"), Status: "completed"}); err != nil {
+		t.Fatalf("AddToMasterList failed: %v", err)
+	}
+	if err := SetHookOutput("hooked", "done"); err != nil {
+		t.Fatalf("SetHookOutput failed: %v", err)
+	}
+	// Updating the entry keeps the output
+	if err := AddToMasterList(types.DownloadEntry{ID: "hooked", URL: "https://example.com/a", DestPath: filepath.Join(tmpDir, "a"), Status: "completed", TotalSize: 1}); err != nil {
+		t.Fatalf("AddToMasterList failed: %v", err)
+	}
+	entry, err := GetDownload("hooked")
+	if err != nil || entry == nil || entry.HookOutput != "done" {
+		t.Fatalf("GetDownload = %+v, %v; want the hook output", entry, err)
+	}
+
+	if err := RemoveFromMasterList("hooked"); err != nil {
+		t.Fatalf("RemoveFromMasterList failed: %v", err)
+	}
+	if h, err := LoadDownloadHooks("hooked"); err != nil || h != nil {
+		t.Errorf("LoadDownloadHooks after removal = %+v, %v; want nil", h, err)
+	}
+}
+
+func TestRequestSettings(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	if s, err := LoadRequestSettings("req"); err != nil || s != nil {
+		t.Fatalf("LoadRequestSettings without settings = %+v, %v; want nil", s, err)
+	}
+
+	want := types.RequestSettings{
+		Headers: map[string]string{"Referer": "https://example.com/", "Cookie": "session=abc"},
+		Proxy:   "socks5://127.0.0.1:1080",
+	}
+	if err := SaveRequestSettings("req", want); err != nil {
+		t.Fatalf("SaveRequestSettings failed: %v", err)
+	}
+	got, err := LoadRequestSettings("req")
+	if err != nil || got == nil || !reflect.DeepEqual(*got, want) {
+		t.Fatalf("LoadRequestSettings = %+v, %v; want %+v", got, err, want)
+	}
+	var stored string
+	if err := getDBHelper().QueryRow("SELECT settings FROM download_requests WHERE download_id = ?", "req").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored, "session") || strings.Contains(stored, "127.0.0.1") {
+		t.Errorf("request settings stored in plaintext: %s", stored)
+	}
+
+	// Clearing completed downloads drops their settings
+	if err := AddToMasterList(types.DownloadEntry{ID: "req", URL: "https://example.com/a", DestPath: filepath.Join(tmpDir, "a"), Status: "completed"}); err != nil {
+		t.Fatalf("AddToMasterList failed: %v", err)
+	}
+	if _, err := RemoveCompletedDownloads(); err != nil {
+		t.Fatalf("RemoveCompletedDownloads failed: %v", err)
+	}
+	if s, err := LoadRequestSettings("req"); err != nil || s != nil {
+		t.Errorf("LoadRequestSettings after clearing = %+v, %v; want nil", s, err)
+	}
+
+	if err := SaveRequestSettings("other", want); err != nil {
+		t.Fatalf("SaveRequestSettings failed: %v", err)
+	}
+	if err := RemoveFromMasterList("other"); err != nil {
+		t.Fatalf("RemoveFromMasterList failed: %v", err)
+	}
+	if s, err := LoadRequestSettings("other"); err != nil || s != nil {
+		t.Errorf("LoadRequestSettings after removal = %+v, %v; want nil", s, err)
+	}
+
+	// Settings of downloads that were never entered are cleaned up at startup
+	if err := SaveRequestSettings("lost", want); err != nil {
+		t.Fatalf("SaveRequestSettings failed: %v", err)
+	}
+	if _, err := ValidateIntegrity(); err != nil {
+		t.Fatalf("ValidateIntegrity failed: %v", err)
+	}
+	if s, err := LoadRequestSettings("lost"); err != nil || s != nil {
+		t.Errorf("LoadRequestSettings of a lost download = %+v, %v; want nil", s, err)
+	}
+}
@@ -0,0 +1,451 @@
+package stream
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The subset of the MPD schema needed to list segments. Elements are matched
+// by local name, so the DASH namespace doesn't need spelling out.
+type mpd struct {
+	Type     string      `xml:"type,attr"`
+	Duration string      `xml:"mediaPresentationDuration,attr"`
+	BaseURL  string      `xml:"BaseURL"`
+	Periods  []mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	Duration        string           `xml:"duration,attr"`
+	BaseURL         string           `xml:"BaseURL"`
+	SegmentTemplate *segmentTemplate `xml:"SegmentTemplate"`
+	AdaptationSets  []adaptationSet  `xml:"AdaptationSet"`
+}
+
+type adaptationSet struct {
+	MimeType        string           `xml:"mimeType,attr"`
+	ContentType     string           `xml:"contentType,attr"`
+	BaseURL         string           `xml:"BaseURL"`
+	SegmentTemplate *segmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *segmentList     `xml:"SegmentList"`
+	Representations []representation `xml:"Representation"`
+}
+
+type representation struct {
+	ID              string           `xml:"id,attr"`
+	Bandwidth       int64            `xml:"bandwidth,attr"`
+	Width           int              `xml:"width,attr"`
+	Height          int              `xml:"height,attr"`
+	MimeType        string           `xml:"mimeType,attr"`
+	BaseURL         string           `xml:"BaseURL"`
+	SegmentTemplate *segmentTemplate `xml:"SegmentTemplate"`
+	SegmentList     *segmentList     `xml:"SegmentList"`
+}
+
+type segmentTemplate struct {
+	Media          string           `xml:"media,attr"`
+	Initialization string           `xml:"initialization,attr"`
+	StartNumber    *int64           `xml:"startNumber,attr"`
+	Timescale      int64            `xml:"timescale,attr"`
+	Duration       int64            `xml:"duration,attr"`
+	Timeline       *segmentTimeline `xml:"SegmentTimeline"`
+}
+
+type segmentTimeline struct {
+	S []struct {
+		T *int64 `xml:"t,attr"`
+		D int64  `xml:"d,attr"`
+		R int64  `xml:"r,attr"`
+	} `xml:"S"`
+}
+
+type segmentList struct {
+	Timescale      int64    `xml:"timescale,attr"`
+	Duration       int64    `xml:"duration,attr"`
+	Initialization *urlType `xml:"Initialization"`
+	SegmentURLs    []struct {
+		Media      string `xml:"media,attr"`
+		MediaRange string `xml:"mediaRange,attr"`
+	} `xml:"SegmentURL"`
+}
+
+type urlType struct {
+	SourceURL string `xml:"sourceURL,attr"`
+	Range     string `xml:"range,attr"`
+}
+
+// resolveDASH picks a representation of the video adaptation set in every
+// period and lists their segments
+func resolveDASH(body []byte, base *url.URL, choice string) (*Plan, error) {
+	var m mpd
+	if err := xml.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("stream: invalid MPD: %w", err)
+	}
+	if m.Type == "dynamic" {
+		return nil, errLive
+	}
+	if len(m.Periods) == 0 {
+		return nil, fmt.Errorf("stream: the MPD has no periods")
+	}
+
+	mpdBase, err := joinBase(base, m.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	for i, period := range m.Periods {
+		periodBase, err := joinBase(mpdBase, period.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		// A lone period lasts as long as the presentation
+		durationAttr := period.Duration
+		if durationAttr == "" && len(m.Periods) == 1 {
+			durationAttr = m.Duration
+		}
+		var periodDuration float64
+		if durationAttr != "" {
+			if periodDuration, err = parseISODuration(durationAttr); err != nil {
+				return nil, err
+			}
+		}
+
+		set := pickAdaptationSet(period.AdaptationSets)
+		if set == nil {
+			return nil, fmt.Errorf("stream: period %d has no adaptation sets", i+1)
+		}
+		variants := make([]Variant, len(set.Representations))
+		for j, rep := range set.Representations {
+			variants[j] = Variant{
+				ID:        rep.ID,
+				Bandwidth: rep.Bandwidth,
+				Width:     rep.Width,
+				Height:    rep.Height,
+				MimeType:  firstNonEmpty(rep.MimeType, set.MimeType),
+			}
+		}
+		variant, err := selectVariant(variants, choice)
+		if err != nil {
+			return nil, err
+		}
+		var rep *representation
+		for j := range variants {
+			if variants[j] == variant {
+				rep = &set.Representations[j]
+				break
+			}
+		}
+
+		setBase, err := joinBase(periodBase, set.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		repBase, err := joinBase(setBase, rep.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+
+		var segments []Segment
+		switch {
+		case rep.SegmentList != nil || set.SegmentList != nil:
+			list := rep.SegmentList
+			if list == nil {
+				list = set.SegmentList
+			}
+			segments, err = listSegments(list, repBase)
+		default:
+			template := mergeTemplates(period.SegmentTemplate, set.SegmentTemplate, rep.SegmentTemplate)
+			if template != nil {
+				segments, err = templateSegments(template, rep, repBase, periodDuration)
+			} else {
+				// The representation is a single file
+				segments = []Segment{{URL: repBase.String(), Duration: periodDuration}}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		plan.Segments = append(plan.Segments, segments...)
+		if i == 0 {
+			plan.Variant = variant
+		}
+	}
+
+	plan.Ext = dashExt(plan.Variant.MimeType)
+	return plan, nil
+}
+
+// pickAdaptationSet prefers video, then whatever comes first
+func pickAdaptationSet(sets []adaptationSet) *adaptationSet {
+	for i, set := range sets {
+		if set.ContentType == "video" || strings.HasPrefix(set.MimeType, "video/") {
+			return &sets[i]
+		}
+		for _, rep := range set.Representations {
+			if strings.HasPrefix(rep.MimeType, "video/") {
+				return &sets[i]
+			}
+		}
+	}
+	for i, set := range sets {
+		if len(set.Representations) > 0 {
+			return &sets[i]
+		}
+	}
+	return nil
+}
+
+func dashExt(mimeType string) string {
+	switch mimeType {
+	case "audio/mp4":
+		return ".m4a"
+	case "video/webm":
+		return ".webm"
+	case "audio/webm":
+		return ".weba"
+	}
+	return ".mp4"
+}
+
+// mergeTemplates overlays the more specific templates onto the outer ones
+func mergeTemplates(templates ...*segmentTemplate) *segmentTemplate {
+	var merged *segmentTemplate
+	for _, t := range templates {
+		if t == nil {
+			continue
+		}
+		if merged == nil {
+			merged = &segmentTemplate{}
+		}
+		if t.Media != "" {
+			merged.Media = t.Media
+		}
+		if t.Initialization != "" {
+			merged.Initialization = t.Initialization
+		}
+		if t.StartNumber != nil {
+			merged.StartNumber = t.StartNumber
+		}
+		if t.Timescale > 0 {
+			merged.Timescale = t.Timescale
+		}
+		if t.Duration > 0 {
+			merged.Duration = t.Duration
+		}
+		if t.Timeline != nil {
+			merged.Timeline = t.Timeline
+		}
+	}
+	return merged
+}
+
+// templateSegments expands a SegmentTemplate, either from its
+// SegmentTimeline or from a fixed segment duration
+func templateSegments(t *segmentTemplate, rep *representation, base *url.URL, periodDuration float64) ([]Segment, error) {
+	if t.Media == "" {
+		return nil, fmt.Errorf("stream: SegmentTemplate without media")
+	}
+	timescale := t.Timescale
+	if timescale <= 0 {
+		timescale = 1
+	}
+	number := int64(1)
+	if t.StartNumber != nil {
+		number = *t.StartNumber
+	}
+
+	var segments []Segment
+	if t.Initialization != "" {
+		uri, err := resolveURI(base, expandTemplate(t.Initialization, rep, 0, 0))
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, Segment{URL: uri})
+	}
+
+	add := func(time, duration int64) error {
+		uri, err := resolveURI(base, expandTemplate(t.Media, rep, number, time))
+		if err != nil {
+			return err
+		}
+		segments = append(segments, Segment{URL: uri, Duration: float64(duration) / float64(timescale)})
+		number++
+		return nil
+	}
+
+	switch {
+	case t.Timeline != nil:
+		var time int64
+		for _, s := range t.Timeline.S {
+			if s.T != nil {
+				time = *s.T
+			}
+			if s.D <= 0 {
+				return nil, fmt.Errorf("stream: SegmentTimeline entry without duration")
+			}
+			// A negative repeat count runs to the end of the period
+			repeat := s.R
+			if repeat < 0 {
+				if periodDuration <= 0 {
+					return nil, fmt.Errorf("stream: open-ended SegmentTimeline needs a period duration")
+				}
+				end := int64(periodDuration * float64(timescale))
+				repeat = (end-time+s.D-1)/s.D - 1
+			}
+			for i := int64(0); i <= repeat; i++ {
+				if err := add(time, s.D); err != nil {
+					return nil, err
+				}
+				time += s.D
+			}
+		}
+	case t.Duration > 0:
+		if periodDuration <= 0 {
+			return nil, fmt.Errorf("stream: the MPD doesn't say how long the period is")
+		}
+		segDuration := float64(t.Duration) / float64(timescale)
+		count := int64(math.Ceil(periodDuration/segDuration - 1e-9))
+		for i := int64(0); i < count; i++ {
+			duration := t.Duration
+			if i == count-1 {
+				// The last segment only runs to the end of the period
+				duration = int64(periodDuration*float64(timescale)) - i*t.Duration
+			}
+			if err := add(i*t.Duration, duration); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("stream: SegmentTemplate has neither a duration nor a SegmentTimeline")
+	}
+	return segments, nil
+}
+
+// listSegments reads an explicit SegmentList
+func listSegments(list *segmentList, base *url.URL) ([]Segment, error) {
+	var segments []Segment
+	if list.Initialization != nil {
+		seg, err := urlSegment(base, list.Initialization.SourceURL, list.Initialization.Range)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+	var duration float64
+	if list.Duration > 0 {
+		timescale := max(list.Timescale, 1)
+		duration = float64(list.Duration) / float64(timescale)
+	}
+	for _, su := range list.SegmentURLs {
+		seg, err := urlSegment(base, su.Media, su.MediaRange)
+		if err != nil {
+			return nil, err
+		}
+		seg.Duration = duration
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+// urlSegment builds a segment from a URL that may be empty (the base URL
+// itself) and an optional "first-last" byte range
+func urlSegment(base *url.URL, ref, byteRange string) (Segment, error) {
+	seg := Segment{URL: base.String()}
+	if ref != "" {
+		uri, err := resolveURI(base, ref)
+		if err != nil {
+			return Segment{}, err
+		}
+		seg.URL = uri
+	}
+	if byteRange != "" {
+		first, last, ok := strings.Cut(byteRange, "-")
+		start, err1 := strconv.ParseInt(first, 10, 64)
+		end, err2 := strconv.ParseInt(last, 10, 64)
+		if !ok || err1 != nil || err2 != nil || end < start {
+			return Segment{}, fmt.Errorf("stream: invalid byte range %q", byteRange)
+		}
+		seg.Offset, seg.Length = start, end-start+1
+	}
+	return seg, nil
+}
+
+// joinBase resolves a BaseURL element against the enclosing base
+func joinBase(base *url.URL, ref string) (*url.URL, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return base, nil
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("stream: bad BaseURL %q: %w", ref, err)
+	}
+	return u, nil
+}
+
+var templateIdentifier = regexp.MustCompile(`\$(RepresentationID|Number|Time|Bandwidth)(%0(\d+)d)?\$`)
+
+// expandTemplate fills in $RepresentationID$, $Number$, $Time$ and
+// $Bandwidth$, with optional %0Nd widths, and unescapes $$
+func expandTemplate(template string, rep *representation, number, time int64) string {
+	parts := strings.Split(template, "$$")
+	for i, part := range parts {
+		parts[i] = templateIdentifier.ReplaceAllStringFunc(part, func(m string) string {
+			sub := templateIdentifier.FindStringSubmatch(m)
+			var value int64
+			switch sub[1] {
+			case "RepresentationID":
+				return rep.ID
+			case "Number":
+				value = number
+			case "Time":
+				value = time
+			case "Bandwidth":
+				value = rep.Bandwidth
+			}
+			if sub[3] != "" {
+				width, _ := strconv.Atoi(sub[3])
+				return fmt.Sprintf("%0*d", width, value)
+			}
+			return strconv.FormatInt(value, 10)
+		})
+	}
+	return strings.Join(parts, "$")
+}
+
+var isoDuration = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration parses durations like PT1H2M3.5S into seconds
+func parseISODuration(s string) (float64, error) {
+	m := isoDuration.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("stream: unsupported duration %q", s)
+	}
+	var seconds float64
+	for i, unit := range []float64{86400, 3600, 60, 1} {
+		if m[i+1] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("stream: unsupported duration %q", s)
+		}
+		seconds += v * unit
+	}
+	return seconds, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
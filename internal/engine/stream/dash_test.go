@@ -0,0 +1,211 @@
+package stream
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func segmentURLs(plan *Plan) []string {
+	urls := make([]string, len(plan.Segments))
+	for i, seg := range plan.Segments {
+		urls[i] = seg.URL
+	}
+	return urls
+}
+
+func assertURLs(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d segments %v, want %d %v", len(got), got, len(want), want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("segment %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestResolveDASH_NumberTemplate(t *testing.T) {
+	body := `<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT9.5S">
+  <BaseURL>media/</BaseURL>
+  <Period>
+    <AdaptationSet mimeType="audio/mp4">
+      <Representation id="a" bandwidth="64000"/>
+    </AdaptationSet>
+    <AdaptationSet mimeType="video/mp4">
+      <SegmentTemplate media="$RepresentationID$/$Number%04d$.m4s" initialization="$RepresentationID$/init-$Bandwidth$.mp4" timescale="90000" duration="360000"/>
+      <Representation id="v1" bandwidth="500000" height="480"/>
+      <Representation id="v2" bandwidth="1500000" height="1080"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+	plan, err := resolveDASH([]byte(body), mustParseURL(t, "https://example.com/show/manifest.mpd"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Variant.ID != "v2" || plan.Ext != ".mp4" {
+		t.Errorf("variant %s, ext %s; want v2 and .mp4", plan.Variant.ID, plan.Ext)
+	}
+	assertURLs(t, segmentURLs(plan), []string{
+		"https://example.com/show/media/v2/init-1500000.mp4",
+		"https://example.com/show/media/v2/0001.m4s",
+		"https://example.com/show/media/v2/0002.m4s",
+		"https://example.com/show/media/v2/0003.m4s",
+	})
+	// Two full segments and what is left of the period
+	if d := plan.Segments[3].Duration; d != 1.5 {
+		t.Errorf("last segment lasts %v, want 1.5", d)
+	}
+
+	plan, err = resolveDASH([]byte(body), mustParseURL(t, "https://example.com/show/manifest.mpd"), "480p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Variant.ID != "v1" {
+		t.Errorf("480p picked %s, want v1", plan.Variant.ID)
+	}
+}
+
+func TestResolveDASH_Timeline(t *testing.T) {
+	body := `<MPD type="static" mediaPresentationDuration="PT200S">
+  <Period>
+    <AdaptationSet contentType="video">
+      <SegmentTemplate media="v-$Time$.mp4" timescale="10" startNumber="5">
+        <SegmentTimeline>
+          <S t="100" d="40" r="1"/>
+          <S d="30"/>
+          <S t="300" d="50" r="-1"/>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation id="v" bandwidth="1000"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+	plan, err := resolveDASH([]byte(body), mustParseURL(t, "https://example.com/manifest.mpd"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The open-ended repeat runs from 300 to the end of the period at 200
+	// seconds (2000 in the timescale)
+	want := []string{
+		"https://example.com/v-100.mp4",
+		"https://example.com/v-140.mp4",
+		"https://example.com/v-180.mp4",
+	}
+	for time := 300; time < 2000; time += 50 {
+		want = append(want, "https://example.com/v-"+strconv.Itoa(time)+".mp4")
+	}
+	assertURLs(t, segmentURLs(plan), want)
+	if d := plan.Segments[2].Duration; d != 3 {
+		t.Errorf("segment 2 lasts %v, want 3", d)
+	}
+}
+
+func TestResolveDASH_SegmentList(t *testing.T) {
+	body := `<MPD type="static" mediaPresentationDuration="PT8S">
+  <Period>
+    <AdaptationSet mimeType="video/webm">
+      <Representation id="only" bandwidth="800000">
+        <BaseURL>https://cdn.example.com/file.webm</BaseURL>
+        <SegmentList timescale="1000" duration="4000">
+          <Initialization range="0-99"/>
+          <SegmentURL mediaRange="100-1099"/>
+          <SegmentURL mediaRange="1100-1599"/>
+        </SegmentList>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+	plan, err := resolveDASH([]byte(body), mustParseURL(t, "https://example.com/manifest.mpd"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Ext != ".webm" {
+		t.Errorf("ext = %s, want .webm", plan.Ext)
+	}
+	want := []Segment{
+		{URL: "https://cdn.example.com/file.webm", Offset: 0, Length: 100},
+		{URL: "https://cdn.example.com/file.webm", Offset: 100, Length: 1000, Duration: 4},
+		{URL: "https://cdn.example.com/file.webm", Offset: 1100, Length: 500, Duration: 4},
+	}
+	if len(plan.Segments) != len(want) {
+		t.Fatalf("got %d segments, want %d", len(plan.Segments), len(want))
+	}
+	for i := range want {
+		if plan.Segments[i].URL != want[i].URL || plan.Segments[i].Offset != want[i].Offset ||
+			plan.Segments[i].Length != want[i].Length || plan.Segments[i].Duration != want[i].Duration {
+			t.Errorf("segment %d = %+v, want %+v", i, plan.Segments[i], want[i])
+		}
+	}
+}
+
+func TestResolveDASH_SingleFilePerPeriod(t *testing.T) {
+	body := `<MPD type="static">
+  <Period duration="PT1M"><AdaptationSet mimeType="video/mp4"><Representation id="p1" bandwidth="1"><BaseURL>one.mp4</BaseURL></Representation></AdaptationSet></Period>
+  <Period duration="PT30S"><AdaptationSet mimeType="video/mp4"><Representation id="p2" bandwidth="1"><BaseURL>two.mp4</BaseURL></Representation></AdaptationSet></Period>
+</MPD>`
+
+	plan, err := resolveDASH([]byte(body), mustParseURL(t, "https://example.com/x/manifest.mpd"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertURLs(t, segmentURLs(plan), []string{"https://example.com/x/one.mp4", "https://example.com/x/two.mp4"})
+	if plan.Segments[0].Duration != 60 || plan.Segments[1].Duration != 30 {
+		t.Errorf("durations %v and %v, want 60 and 30", plan.Segments[0].Duration, plan.Segments[1].Duration)
+	}
+}
+
+func TestResolveDASH_Dynamic(t *testing.T) {
+	body := `<MPD type="dynamic"><Period><AdaptationSet><Representation id="v"/></AdaptationSet></Period></MPD>`
+	if _, err := resolveDASH([]byte(body), mustParseURL(t, "https://example.com/live.mpd"), ""); !errors.Is(err, errLive) {
+		t.Errorf("expected errLive, got %v", err)
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	rep := &representation{ID: "video=1", Bandwidth: 250}
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"$RepresentationID$/$Number$.m4s", "video=1/42.m4s"},
+		{"seg-$Number%05d$.m4s", "seg-00042.m4s"},
+		{"t$Time$-b$Bandwidth$", "t9000-b250"},
+		{"cost$$5-$Number$", "cost$5-42"},
+		{"$Unknown$", "$Unknown$"},
+	}
+	for _, tt := range tests {
+		if got := expandTemplate(tt.template, rep, 42, 9000); got != tt.want {
+			t.Errorf("expandTemplate(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"PT10S", 10},
+		{"PT1H2M3.5S", 3723.5},
+		{"PT0.25S", 0.25},
+		{"P1DT1S", 86401},
+		{"PT90M", 5400},
+	}
+	for _, tt := range tests {
+		got, err := parseISODuration(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseISODuration(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "PT", "10S", "P1Y"} {
+		if _, err := parseISODuration(bad); err == nil {
+			t.Errorf("parseISODuration(%q) should fail", bad)
+		}
+	}
+}
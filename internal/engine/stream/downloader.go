@@ -0,0 +1,644 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/backoff"
+	"github.com/surge-downloader/surge/internal/engine/concurrent"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Downloader fetches the segments of a Plan in parallel, one segment per
+// task on the concurrent engine's task queue, under the same health monitor.
+// Each segment is written to its own part file; once all are there they are
+// concatenated into the destination.
+//
+// Progress is laid out with Plan.SegmentSize bytes per segment, so every
+// segment is one chunk of the chunk map whatever its real size.
+type Downloader struct {
+	ProgressChan chan<- any           // Channel for events (start/complete/error)
+	ID           string               // Download ID
+	State        *types.ProgressState // Shared state for TUI polling
+	Runtime      *types.RuntimeConfig
+	Headers      map[string]string   // Custom HTTP headers, sent with every segment and key request
+	Backoff      *backoff.Controller // Per-host throttling state shared with other downloads
+
+	// Size is the size of the merged file once Download succeeds
+	Size int64
+
+	plan        *Plan
+	client      *http.Client
+	partsDir    string
+	activeTasks map[int]*concurrent.ActiveTask
+	activeMu    sync.Mutex
+	reported    []atomic.Int64 // Progress bytes reported per segment
+	pending     atomic.Int64   // Segments not finished yet
+
+	keysMu sync.Mutex
+	keys   map[string][]byte
+}
+
+// NewDownloader creates a stream downloader
+func NewDownloader(id string, progressCh chan<- any, progState *types.ProgressState, runtime *types.RuntimeConfig) *Downloader {
+	if runtime == nil {
+		runtime = &types.RuntimeConfig{
+			MaxConnectionsPerHost: types.PerHostMax,
+			MinChunkSize:          types.MinChunk,
+			WorkerBufferSize:      types.WorkerBuffer,
+		}
+	}
+	return &Downloader{
+		ID:           id,
+		ProgressChan: progressCh,
+		State:        progState,
+		Runtime:      runtime,
+		Backoff:      backoff.Default,
+		activeTasks:  make(map[int]*concurrent.ActiveTask),
+		keys:         make(map[string][]byte),
+	}
+}
+
+// statusError is an unexpected HTTP status for a segment or key
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status: %d", e.code)
+}
+
+// errThrottled is returned when a server answers 429 or 503
+var errThrottled = errors.New("server throttled")
+
+// isPermanent reports whether retrying a segment can't help
+func isPermanent(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 400 && se.code < 500 && se.code != http.StatusRequestTimeout
+	}
+	return false
+}
+
+// workers returns how many segments to fetch at once, limited by the
+// connection setting of the host serving them
+func (d *Downloader) workers(tasks int) int {
+	limit := d.Runtime.GetMaxConnectionsPerHost()
+	if u, err := url.Parse(d.plan.Segments[len(d.plan.Segments)-1].URL); err == nil {
+		limit = d.Runtime.GetHostConnectionLimit(types.HostKey(u))
+	}
+	return max(1, min(limit, tasks))
+}
+
+// Download resolves the manifest at rawurl and fetches the chosen variant
+// into destPath
+func (d *Downloader) Download(ctx context.Context, rawurl string, destPath string) error {
+	utils.Debug("Stream Download: %s -> %s", rawurl, destPath)
+
+	downloadCtx, cancel := context.WithCancel(ctx)
+	var wgHelpers sync.WaitGroup
+	defer wgHelpers.Wait()
+	defer cancel()
+	if d.State != nil {
+		d.State.SetCancelFunc(cancel)
+	}
+
+	d.client = concurrent.NewHTTPClient(d.Runtime, d.Runtime.GetMaxConnectionsPerHost())
+	plan, err := Resolve(downloadCtx, d.client, rawurl, d.Headers, d.Runtime)
+	if err != nil {
+		return err
+	}
+	d.plan = plan
+	totalSize := plan.TotalSize()
+
+	workingPath := destPath + types.IncompleteSuffix
+	d.partsDir = workingPath + types.PartsSuffix
+
+	// The .surge file only receives the merged segments at the end, but it
+	// marks the download as incomplete like for every other engine
+	outFile, err := os.OpenFile(workingPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() { _ = outFile.Close() }()
+
+	if d.State != nil {
+		d.State.SetTotalSize(totalSize)
+		d.State.InitBitmap(totalSize, plan.SegmentSize)
+	}
+
+	savedState, err := state.LoadState(rawurl, destPath)
+	isResume := err == nil && savedState != nil
+	if isResume {
+		// A different variant or segment list means the parts don't fit
+		if err := savedState.ValidateRemote(totalSize, "", ""); err != nil {
+			utils.Debug("Discarding saved state and restarting: %v", err)
+			isResume = false
+		}
+	}
+	if !isResume {
+		if err := os.RemoveAll(d.partsDir); err != nil {
+			return fmt.Errorf("failed to clear segments: %w", err)
+		}
+	}
+	if err := os.MkdirAll(d.partsDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create segment directory: %w", err)
+	}
+
+	// Finished segments are the ones with a part file
+	tasks := d.remaining()
+	d.reported = make([]atomic.Int64, len(plan.Segments))
+	d.pending.Store(int64(len(tasks)))
+	if d.State != nil {
+		if isResume {
+			d.State.SetSavedElapsed(time.Duration(savedState.Elapsed))
+		}
+		d.State.RecalculateProgress(tasks)
+		d.State.Downloaded.Store(d.State.VerifiedProgress.Load())
+		d.State.SyncSessionStart()
+	}
+	if isResume {
+		utils.Debug("Resuming stream: %d of %d segments left", len(tasks), len(plan.Segments))
+	}
+
+	if len(tasks) > 0 {
+		if err := d.fetchAll(downloadCtx, cancel, tasks, &wgHelpers); err != nil {
+			return err
+		}
+	}
+
+	if d.State != nil && d.State.IsPaused() {
+		d.savePausedState(rawurl, destPath)
+		return types.ErrPaused
+	}
+	if downloadCtx.Err() != nil {
+		return context.Canceled
+	}
+	if left := d.remaining(); len(left) > 0 {
+		return fmt.Errorf("stream: download stopped with %d segments left", len(left))
+	}
+
+	if err := d.merge(outFile); err != nil {
+		return err
+	}
+	_ = outFile.Close()
+	if err := utils.RenameNoReplace(workingPath, destPath); err != nil {
+		return fmt.Errorf("failed to rename completed file: %w", err)
+	}
+	_ = os.RemoveAll(d.partsDir)
+	_ = state.DeleteState(d.ID, rawurl, destPath)
+	return nil
+}
+
+// fetchAll runs the workers until every task is done, one fails for good
+// or ctx ends
+func (d *Downloader) fetchAll(ctx context.Context, cancel context.CancelFunc, tasks []types.Task, wgHelpers *sync.WaitGroup) error {
+	queue := concurrent.NewTaskQueue()
+	queue.PushMultiple(tasks)
+
+	// Health monitor: requeue stalled and slow segments
+	wgHelpers.Add(1)
+	go func() {
+		defer wgHelpers.Done()
+		ticker := time.NewTicker(types.HealthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				queue.Close()
+				return
+			case <-ticker.C:
+				d.activeMu.Lock()
+				concurrent.CheckWorkerHealth(d.activeTasks, d.State, d.Runtime)
+				d.activeMu.Unlock()
+			}
+		}
+	}()
+
+	numWorkers := d.workers(len(tasks))
+	if d.State != nil {
+		d.State.SetConnectionTarget(numWorkers, "initial estimate")
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		fatalErr error
+	)
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			if err := d.worker(ctx, id, queue); err != nil && ctx.Err() == nil {
+				errOnce.Do(func() {
+					fatalErr = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	return fatalErr
+}
+
+// worker fetches segments from the queue until it is closed
+func (d *Downloader) worker(ctx context.Context, id int, queue *concurrent.TaskQueue) error {
+	buf := make([]byte, d.Runtime.GetWorkerBufferSize())
+	maxRetries := d.Runtime.GetMaxTaskRetries()
+
+	for {
+		task, ok := queue.Pop()
+		if !ok {
+			return nil
+		}
+		index := int(task.Offset / d.plan.SegmentSize)
+
+		if d.State != nil {
+			d.State.ActiveWorkers.Add(1)
+			d.State.UpdateChunkStatus(task.Offset, task.Length, types.ChunkDownloading)
+		}
+
+		var lastErr error
+		requeued := false
+		for attempt := 0; attempt < maxRetries; attempt++ {
+			if attempt > 0 && !errors.Is(lastErr, errThrottled) {
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Duration(1<<attempt) * types.RetryBaseDelay):
+				}
+			}
+			if ctx.Err() != nil {
+				break
+			}
+
+			taskCtx, taskCancel := context.WithCancel(ctx)
+			now := time.Now()
+			active := &concurrent.ActiveTask{
+				Task:          task,
+				CurrentOffset: task.Offset,
+				StopAt:        task.Offset + task.Length,
+				LastActivity:  now.UnixNano(),
+				StartTime:     now,
+				Cancel:        taskCancel,
+				WindowStart:   now,
+			}
+			d.activeMu.Lock()
+			d.activeTasks[id] = active
+			d.activeMu.Unlock()
+
+			lastErr = d.fetchSegment(taskCtx, index, active, buf)
+			healthCancelled := taskCtx.Err() != nil && ctx.Err() == nil
+			taskCancel()
+
+			d.activeMu.Lock()
+			delete(d.activeTasks, id)
+			d.activeMu.Unlock()
+
+			if lastErr == nil || ctx.Err() != nil {
+				break
+			}
+			if healthCancelled {
+				// Let another worker pick it up on a fresh connection; the
+				// part fetched so far is kept and continued from
+				utils.Debug("Stream worker %d: segment %d cancelled by health check, requeueing", id, index)
+				queue.Push(task)
+				requeued = true
+				lastErr = nil
+				break
+			}
+			utils.Debug("Stream worker %d: segment %d failed (attempt %d): %v", id, index, attempt+1, lastErr)
+			if isPermanent(lastErr) {
+				break
+			}
+		}
+
+		if d.State != nil {
+			d.State.ActiveWorkers.Add(-1)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if lastErr != nil {
+			return fmt.Errorf("segment %d: %w", index, lastErr)
+		}
+		if !requeued && d.pending.Add(-1) == 0 {
+			queue.Close()
+		}
+	}
+}
+
+// partPath is where segment index is kept once finished
+func (d *Downloader) partPath(index int) string {
+	return filepath.Join(d.partsDir, fmt.Sprintf("%06d.seg", index))
+}
+
+// fetchSegment downloads segment index to its part file. Bytes fetched by
+// an earlier attempt are kept and the rest is requested with a Range.
+func (d *Downloader) fetchSegment(ctx context.Context, index int, active *concurrent.ActiveTask, buf []byte) error {
+	seg := d.plan.Segments[index]
+	partial := d.partPath(index) + ".partial"
+
+	file, err := os.OpenFile(partial, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	have, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if seg.Length > 0 && have > seg.Length {
+		have = 0
+	}
+
+	req, err := newRequest(ctx, http.MethodGet, seg.URL, d.Headers, d.Runtime)
+	if err != nil {
+		return err
+	}
+	switch {
+	case seg.Length > 0:
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", seg.Offset+have, seg.Offset+seg.Length-1))
+	case have > 0:
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", have))
+	}
+
+	// Take a slot from the connection budget shared with other downloads
+	host := types.HostKey(req.URL)
+	atomic.StoreInt32(&active.HostWait, 1)
+	releaseSlot, err := d.Runtime.AcquireHostSlot(ctx, host)
+	atomic.StoreInt32(&active.HostWait, 0)
+	if err != nil {
+		return err
+	}
+	defer releaseSlot()
+
+	// Wait until the host accepts connections again if it throttled us. The
+	// slot is taken first so the backoff only counts connections that can run.
+	atomic.StoreInt32(&active.HostWait, 1)
+	err = d.Backoff.Acquire(ctx, host)
+	atomic.StoreInt32(&active.HostWait, 0)
+	if err != nil {
+		return err
+	}
+	defer d.Backoff.Release(host)
+	atomic.StoreInt64(&active.LastActivity, time.Now().UnixNano())
+
+	var resp *http.Response
+	if seg.Length > 0 && have == seg.Length {
+		// Everything arrived last time; only the decryption is left
+		resp = &http.Response{StatusCode: http.StatusPartialContent, Body: http.NoBody, ContentLength: 0}
+	} else if resp, err = d.client.Do(req); err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		delay := d.Backoff.Throttle(host, backoff.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()))
+		utils.Debug("Host %s throttled us (%d), backing off for %v", host, resp.StatusCode, delay)
+		return fmt.Errorf("%w (%d)", errThrottled, resp.StatusCode)
+	case http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The last attempt already got all of it
+		if have == 0 || seg.Length > 0 {
+			return &statusError{code: resp.StatusCode}
+		}
+		resp.Body = http.NoBody
+		resp.ContentLength = 0
+	case http.StatusOK:
+		if seg.Length > 0 {
+			return fmt.Errorf("server ignored the byte range of %s", seg.URL)
+		}
+		// The whole resource again: start the part over
+		have = 0
+	default:
+		return &statusError{code: resp.StatusCode}
+	}
+	if err := file.Truncate(have); err != nil {
+		return err
+	}
+	if _, err := file.Seek(have, io.SeekStart); err != nil {
+		return err
+	}
+
+	// The expected size scales the bytes received to the segment's share of
+	// the progress; without it progress is only reported once it is done
+	expected := seg.Length
+	if expected <= 0 && resp.ContentLength > 0 {
+		expected = have + resp.ContentLength
+	}
+
+	received := have
+	for {
+		size := len(buf)
+		if d.State != nil {
+			size = d.State.BandwidthChunk(len(buf))
+		}
+		n, readErr := resp.Body.Read(buf[:size])
+		if n > 0 {
+			if _, err := file.Write(buf[:n]); err != nil {
+				return fmt.Errorf("write error: %w", err)
+			}
+			received += int64(n)
+			now := time.Now()
+			active.RecordBytes(int64(n), now, d.Runtime.GetSpeedEmaAlpha())
+			if expected > 0 {
+				d.report(index, received*d.plan.SegmentSize/expected)
+			}
+			if d.State != nil {
+				if err := d.State.WaitBandwidth(ctx, n); err != nil {
+					return err
+				}
+				atomic.StoreInt64(&active.LastActivity, time.Now().UnixNano())
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("read error: %w", readErr)
+		}
+	}
+	if expected > 0 && received != expected {
+		return fmt.Errorf("segment ended after %d of %d bytes", received, expected)
+	}
+
+	if err := d.finishSegment(ctx, index, file, partial); err != nil {
+		return err
+	}
+	d.report(index, d.plan.SegmentSize)
+	return nil
+}
+
+// finishSegment decrypts the fetched segment if needed and moves it to its
+// part path, which marks it done
+func (d *Downloader) finishSegment(ctx context.Context, index int, file *os.File, partial string) error {
+	seg := d.plan.Segments[index]
+	final := d.partPath(index)
+
+	if seg.Key == nil {
+		if err := file.Sync(); err != nil {
+			return err
+		}
+		_ = file.Close()
+		return os.Rename(partial, final)
+	}
+
+	key, err := d.key(ctx, seg.Key.URI)
+	if err != nil {
+		return err
+	}
+	_ = file.Close()
+	data, err := os.ReadFile(partial)
+	if err != nil {
+		return err
+	}
+	plain, err := decryptAES128(data, key, seg.Key.IV)
+	if err != nil {
+		// Garbage in the part won't decrypt next time either
+		_ = os.Remove(partial)
+		return fmt.Errorf("segment %d: %w", index, err)
+	}
+	if err := os.WriteFile(final+".tmp", plain, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(final+".tmp", final); err != nil {
+		return err
+	}
+	return os.Remove(partial)
+}
+
+// key fetches the AES key at uri once per download
+func (d *Downloader) key(ctx context.Context, uri string) ([]byte, error) {
+	d.keysMu.Lock()
+	defer d.keysMu.Unlock()
+	if key, ok := d.keys[uri]; ok {
+		return key, nil
+	}
+
+	req, err := newRequest(ctx, http.MethodGet, uri, d.Headers, d.Runtime)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch key: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("key request: %w", &statusError{code: resp.StatusCode})
+	}
+	key, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	if len(key) != 16 {
+		return nil, fmt.Errorf("stream: key %s is %d bytes, want 16", uri, len(key))
+	}
+	d.keys[uri] = key
+	return key, nil
+}
+
+// report raises segment index's progress to upTo bytes of its share
+func (d *Downloader) report(index int, upTo int64) {
+	upTo = min(upTo, d.plan.SegmentSize)
+	for {
+		prev := d.reported[index].Load()
+		if upTo <= prev {
+			return
+		}
+		if d.reported[index].CompareAndSwap(prev, upTo) {
+			if d.State != nil {
+				offset := int64(index) * d.plan.SegmentSize
+				d.State.UpdateChunkStatus(offset+prev, upTo-prev, types.ChunkCompleted)
+				d.State.Downloaded.Add(upTo - prev)
+			}
+			return
+		}
+	}
+}
+
+// remaining returns the progress range of every segment without a part file
+func (d *Downloader) remaining() []types.Task {
+	var tasks []types.Task
+	for i := range d.plan.Segments {
+		if _, err := os.Stat(d.partPath(i)); err != nil {
+			tasks = append(tasks, types.Task{Offset: int64(i) * d.plan.SegmentSize, Length: d.plan.SegmentSize})
+		}
+	}
+	return tasks
+}
+
+// merge concatenates the parts in order into out
+func (d *Downloader) merge(out *os.File) error {
+	if err := out.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var size int64
+	for i := range d.plan.Segments {
+		part, err := os.Open(d.partPath(i))
+		if err != nil {
+			return fmt.Errorf("failed to open segment %d: %w", i, err)
+		}
+		n, err := io.Copy(out, part)
+		_ = part.Close()
+		if err != nil {
+			return fmt.Errorf("failed to merge segment %d: %w", i, err)
+		}
+		size += n
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	d.Size = size
+	utils.Debug("Merged %d segments into %d bytes", len(d.plan.Segments), size)
+	return nil
+}
+
+// savePausedState stores the unfinished segments for resume
+func (d *Downloader) savePausedState(rawurl, destPath string) {
+	remaining := d.remaining()
+	totalSize := d.plan.TotalSize()
+	downloaded := totalSize - int64(len(remaining))*d.plan.SegmentSize
+
+	elapsed := d.State.FinalizePauseSession(downloaded)
+	bitmap, _, _, chunkSize, _ := d.State.GetBitmap()
+	priority, queueOrder := d.State.GetPriority()
+
+	s := &types.DownloadState{
+		URL:             rawurl,
+		ID:              d.ID,
+		DestPath:        destPath,
+		TotalSize:       totalSize,
+		Downloaded:      downloaded,
+		Tasks:           remaining,
+		Filename:        filepath.Base(destPath),
+		Elapsed:         elapsed.Nanoseconds(),
+		ChunkBitmap:     bitmap,
+		ActualChunkSize: chunkSize,
+		RateLimit:       d.State.GetRateLimit(),
+		Checksum:        d.State.GetChecksum(),
+		Priority:        priority,
+		QueueOrder:      queueOrder,
+		BatchID:         d.State.GetBatchID(),
+		Category:        d.State.GetCategory(),
+	}
+	if err := state.SaveState(rawurl, destPath, s); err != nil {
+		utils.Debug("Failed to save pause state: %v", err)
+	}
+	utils.Debug("Stream download paused, state saved (%d of %d segments left)", len(remaining), len(d.plan.Segments))
+}
@@ -0,0 +1,252 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func initTestState(t *testing.T) string {
+	state.CloseDB()
+	tmpDir := t.TempDir()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	t.Cleanup(state.CloseDB)
+	return tmpDir
+}
+
+func download(t *testing.T, ctx context.Context, rawurl, destPath string, progress *types.ProgressState, runtime *types.RuntimeConfig) error {
+	t.Helper()
+	d := NewDownloader("stream-test", nil, progress, runtime)
+	return d.Download(ctx, rawurl, destPath)
+}
+
+func assertFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading result: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("merged %d bytes do not match the expected %d bytes", len(got), len(want))
+	}
+	if testutil.FileExists(path + types.IncompleteSuffix) {
+		t.Error(".surge file should be removed after completion")
+	}
+	if testutil.FileExists(path + types.IncompleteSuffix + types.PartsSuffix) {
+		t.Error("segment directory should be removed after completion")
+	}
+}
+
+func TestDownloader_HLS(t *testing.T) {
+	tmpDir := initTestState(t)
+	server := testutil.NewStreamServerT(t, testutil.WithStreamLatency(20*time.Millisecond))
+	destPath := filepath.Join(tmpDir, "master.ts")
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4}
+	progress := types.NewProgressState("stream-test", 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download(t, ctx, server.URL+"/master.m3u8", destPath, progress, runtime); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, server.Expected("1080p"))
+
+	if peak := server.PeakInFlight.Load(); peak < 2 || peak > 4 {
+		t.Errorf("peak of %d segments in flight, want 2 to 4", peak)
+	}
+	if got := server.SegmentRequests.Load(); got != int64(server.SegmentCount) {
+		t.Errorf("%d segment requests, want %d", got, server.SegmentCount)
+	}
+}
+
+func TestDownloader_ProgressPerSegment(t *testing.T) {
+	tmpDir := initTestState(t)
+	server := testutil.NewStreamServerT(t)
+	destPath := filepath.Join(tmpDir, "master.ts")
+	progress := types.NewProgressState("stream-test", 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download(t, ctx, server.URL+"/master.m3u8", destPath, progress, nil); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	// The chunk map has one chunk per segment, all of them complete
+	_, width, total, chunkSize, _ := progress.GetBitmap()
+	if width != server.SegmentCount {
+		t.Fatalf("chunk map has %d chunks, want one per segment (%d)", width, server.SegmentCount)
+	}
+	if total != chunkSize*int64(server.SegmentCount) {
+		t.Errorf("total %d is not %d segments of %d", total, server.SegmentCount, chunkSize)
+	}
+	for i := 0; i < width; i++ {
+		if status := progress.GetChunkState(i); status != types.ChunkCompleted {
+			t.Errorf("chunk %d has status %v, want completed", i, status)
+		}
+	}
+	if downloaded, _, _, _, _, _ := progress.GetProgress(); downloaded != total {
+		t.Errorf("progress %d of %d after completion", downloaded, total)
+	}
+}
+
+func TestDownloader_AES128(t *testing.T) {
+	tmpDir := initTestState(t)
+	server := testutil.NewStreamServerT(t, testutil.WithStreamEncryption())
+	destPath := filepath.Join(tmpDir, "master.ts")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download(t, ctx, server.URL+"/master.m3u8", destPath, nil, nil); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, server.Expected("1080p"))
+	if got := server.KeyRequests.Load(); got != 1 {
+		t.Errorf("key fetched %d times, want once", got)
+	}
+}
+
+func TestDownloader_VariantChoice(t *testing.T) {
+	tests := []struct {
+		choice string
+		want   string
+	}{
+		{"lowest", "360p"},
+		{"720p", "720p"},
+		{"", "1080p"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			tmpDir := initTestState(t)
+			server := testutil.NewStreamServerT(t, testutil.WithStreamSegments(3, 4096))
+			destPath := filepath.Join(tmpDir, "master.ts")
+			runtime := &types.RuntimeConfig{StreamVariant: tt.choice}
+
+			if err := download(t, context.Background(), server.URL+"/master.m3u8", destPath, nil, runtime); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+			assertFile(t, destPath, server.Expected(tt.want))
+			if server.Hits("/"+tt.want+"/index.m3u8") != 1 {
+				t.Errorf("media playlist of %s was not fetched", tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloader_DASH(t *testing.T) {
+	tmpDir := initTestState(t)
+	server := testutil.NewStreamServerT(t)
+	destPath := filepath.Join(tmpDir, "manifest.mp4")
+	runtime := &types.RuntimeConfig{StreamVariant: "720p"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download(t, ctx, server.URL+"/manifest.mpd", destPath, nil, runtime); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, server.ExpectedDASH("720p"))
+	if server.Hits("/audio/init.mp4") != 0 {
+		t.Error("the audio adaptation set should not be fetched")
+	}
+}
+
+func TestDownloader_PauseAndResume(t *testing.T) {
+	tmpDir := initTestState(t)
+	server := testutil.NewStreamServerT(t, testutil.WithStreamEncryption(), testutil.WithStreamLatency(30*time.Millisecond))
+	rawurl := server.URL + "/master.m3u8"
+	destPath := filepath.Join(tmpDir, "master.ts")
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 2}
+	progress := types.NewProgressState("stream-test", 0)
+
+	go func() {
+		for server.SegmentRequests.Load() < 4 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		progress.Pause()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download(t, ctx, rawurl, destPath, progress, runtime); !errors.Is(err, types.ErrPaused) {
+		t.Fatalf("expected ErrPaused, got %v", err)
+	}
+
+	saved, err := state.LoadState(rawurl, destPath)
+	if err != nil {
+		t.Fatalf("no state saved on pause: %v", err)
+	}
+	if len(saved.Tasks) == 0 || len(saved.Tasks) >= server.SegmentCount {
+		t.Fatalf("saved %d unfinished segments, want some but not all %d", len(saved.Tasks), server.SegmentCount)
+	}
+
+	requested := server.SegmentRequests.Load()
+	resumed := types.NewProgressState("stream-test", 0)
+	if err := download(t, ctx, rawurl, destPath, resumed, runtime); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	assertFile(t, destPath, server.Expected("1080p"))
+
+	if again := server.SegmentRequests.Load() - requested; again >= int64(server.SegmentCount) {
+		t.Errorf("resume requested %d segments, expected only the unfinished ones", again)
+	}
+}
+
+func TestDownloader_ResumeDiscardsPartsOfOtherVariant(t *testing.T) {
+	tmpDir := initTestState(t)
+	server := testutil.NewStreamServerT(t, testutil.WithStreamLatency(30*time.Millisecond))
+	rawurl := server.URL + "/master.m3u8"
+	destPath := filepath.Join(tmpDir, "master.ts")
+	progress := types.NewProgressState("stream-test", 0)
+
+	go func() {
+		for server.SegmentRequests.Load() < 4 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		progress.Pause()
+	}()
+	err := download(t, context.Background(), rawurl, destPath, progress, &types.RuntimeConfig{MaxConnectionsPerHost: 2, StreamVariant: "lowest"})
+	if !errors.Is(err, types.ErrPaused) {
+		t.Fatalf("expected ErrPaused, got %v", err)
+	}
+
+	// The estimated size differs with the variant, so the parts are dropped
+	if err := download(t, context.Background(), rawurl, destPath, nil, &types.RuntimeConfig{StreamVariant: "highest"}); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, server.Expected("1080p"))
+}
+
+func TestDownloader_MissingSegment(t *testing.T) {
+	tmpDir := initTestState(t)
+	server := testutil.NewStreamServerT(t, testutil.WithStreamSegments(4, 1024))
+	server.Remove("/720p/seg2.ts")
+
+	destPath := filepath.Join(tmpDir, "master.ts")
+	if err := download(t, context.Background(), server.URL+"/720p/index.m3u8", destPath, nil, nil); err == nil {
+		t.Fatal("expected the download to fail")
+	}
+	if testutil.FileExists(destPath) {
+		t.Error("no file should be produced when a segment is missing")
+	}
+}
+
+func TestPlanFilename(t *testing.T) {
+	plan := &Plan{Ext: ".ts"}
+	tests := map[string]string{
+		"master.m3u8": "master.ts",
+		"movie":       "movie.ts",
+		".m3u8":       "stream.ts",
+	}
+	for in, want := range tests {
+		if got := plan.Filename(in); got != want {
+			t.Errorf("Filename(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// hlsPlaylist is a parsed master or media playlist
+type hlsPlaylist struct {
+	variants []Variant // Set for master playlists
+	segments []Segment // Set for media playlists
+	hasMap   bool      // Segments follow an EXT-X-MAP initialization section (fMP4)
+	ended    bool      // EXT-X-ENDLIST seen
+}
+
+// resolveHLS picks a variant from a master playlist, fetching its media
+// playlist, or takes a media playlist as it is
+func resolveHLS(ctx context.Context, client *http.Client, body []byte, base *url.URL, headers map[string]string, runtime *types.RuntimeConfig, choice string) (*Plan, error) {
+	playlist, err := parseHLS(body, base)
+	if err != nil {
+		return nil, err
+	}
+
+	variant := Variant{URL: base.String()}
+	if len(playlist.variants) > 0 {
+		if variant, err = selectVariant(playlist.variants, choice); err != nil {
+			return nil, err
+		}
+		body, _, mediaBase, err := fetchManifest(ctx, client, variant.URL, headers, runtime)
+		if err != nil {
+			return nil, err
+		}
+		if playlist, err = parseHLS(body, mediaBase); err != nil {
+			return nil, err
+		}
+		if len(playlist.variants) > 0 {
+			return nil, fmt.Errorf("stream: variant %s is another master playlist", variant.URL)
+		}
+	}
+	if !playlist.ended {
+		return nil, errLive
+	}
+
+	return &Plan{Variant: variant, Segments: playlist.segments, Ext: hlsExt(playlist)}, nil
+}
+
+// hlsExt picks the merged file's extension from the segment format
+func hlsExt(playlist *hlsPlaylist) string {
+	if playlist.hasMap {
+		return ".mp4"
+	}
+	if len(playlist.segments) > 0 {
+		if u, err := url.Parse(playlist.segments[0].URL); err == nil {
+			switch ext := strings.ToLower(path.Ext(u.Path)); ext {
+			case ".aac", ".mp3", ".ac3", ".ec3":
+				return ext
+			}
+		}
+	}
+	return ".ts"
+}
+
+// parseHLS parses an M3U8 playlist, resolving URIs against base
+func parseHLS(body []byte, base *url.URL) (*hlsPlaylist, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*types.KB), maxManifestSize)
+
+	if !scanner.Scan() || strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "\ufeff") != "#EXTM3U" {
+		return nil, fmt.Errorf("stream: not an M3U8 playlist")
+	}
+
+	var (
+		p          = &hlsPlaylist{}
+		sequence   int64
+		duration   float64
+		pendingVar *Variant
+		key        *Key
+		keyHasIV   bool
+		rangeLen   int64 = -1
+		rangeOff   int64
+		lastURI    string
+		lastEnd    int64 // End of the previous byte range of lastURI
+	)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		tag, value, _ := strings.Cut(line, ":")
+
+		switch {
+		case tag == "#EXT-X-STREAM-INF":
+			attrs := parseAttributes(value)
+			v := &Variant{}
+			v.Bandwidth, _ = strconv.ParseInt(attrs["BANDWIDTH"], 10, 64)
+			v.Average, _ = strconv.ParseInt(attrs["AVERAGE-BANDWIDTH"], 10, 64)
+			if w, h, ok := strings.Cut(attrs["RESOLUTION"], "x"); ok {
+				v.Width, _ = strconv.Atoi(w)
+				v.Height, _ = strconv.Atoi(h)
+			}
+			pendingVar = v
+
+		case tag == "#EXT-X-MEDIA-SEQUENCE":
+			sequence, _ = strconv.ParseInt(value, 10, 64)
+
+		case tag == "#EXTINF":
+			d, _, _ := strings.Cut(value, ",")
+			duration, _ = strconv.ParseFloat(strings.TrimSpace(d), 64)
+
+		case tag == "#EXT-X-BYTERANGE":
+			n, o, hasOffset := strings.Cut(value, "@")
+			rangeLen, _ = strconv.ParseInt(n, 10, 64)
+			rangeOff = -1
+			if hasOffset {
+				rangeOff, _ = strconv.ParseInt(o, 10, 64)
+			}
+
+		case tag == "#EXT-X-KEY":
+			attrs := parseAttributes(value)
+			switch method := attrs["METHOD"]; method {
+			case "NONE":
+				key = nil
+			case "AES-128":
+				uri, err := resolveURI(base, attrs["URI"])
+				if err != nil {
+					return nil, err
+				}
+				key, keyHasIV = &Key{URI: uri}, false
+				if iv := attrs["IV"]; iv != "" {
+					if key.IV, err = parseIV(iv); err != nil {
+						return nil, err
+					}
+					keyHasIV = true
+				}
+			default:
+				return nil, fmt.Errorf("stream: %s encryption is not supported", method)
+			}
+
+		case tag == "#EXT-X-MAP":
+			attrs := parseAttributes(value)
+			uri, err := resolveURI(base, attrs["URI"])
+			if err != nil {
+				return nil, err
+			}
+			seg := Segment{URL: uri}
+			if br := attrs["BYTERANGE"]; br != "" {
+				n, o, _ := strings.Cut(br, "@")
+				seg.Length, _ = strconv.ParseInt(n, 10, 64)
+				seg.Offset, _ = strconv.ParseInt(o, 10, 64)
+			}
+			seg.Key = segmentKey(key, keyHasIV, sequence)
+			p.segments = append(p.segments, seg)
+			p.hasMap = true
+
+		case tag == "#EXT-X-ENDLIST":
+			p.ended = true
+
+		case strings.HasPrefix(line, "#"):
+			// Comments and tags that don't affect what we fetch
+
+		default:
+			uri, err := resolveURI(base, line)
+			if err != nil {
+				return nil, err
+			}
+			if pendingVar != nil {
+				pendingVar.URL = uri
+				p.variants = append(p.variants, *pendingVar)
+				pendingVar = nil
+				continue
+			}
+
+			seg := Segment{URL: uri, Duration: duration, Key: segmentKey(key, keyHasIV, sequence)}
+			if rangeLen >= 0 {
+				seg.Length = rangeLen
+				seg.Offset = rangeOff
+				if rangeOff < 0 {
+					// Without an offset the range follows the previous one
+					if uri != lastURI {
+						return nil, fmt.Errorf("stream: byte range without offset for %s", uri)
+					}
+					seg.Offset = lastEnd
+				}
+				lastEnd = seg.Offset + seg.Length
+			}
+			lastURI = uri
+			p.segments = append(p.segments, seg)
+
+			sequence++
+			duration = 0
+			rangeLen = -1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("stream: failed to read playlist: %w", err)
+	}
+	// Master playlists never end; only media playlists need ENDLIST
+	if len(p.variants) > 0 {
+		p.ended = true
+	}
+	return p, nil
+}
+
+// segmentKey returns the key for the segment with media sequence number
+// sequence. Without an explicit IV the sequence number is the IV.
+func segmentKey(key *Key, hasIV bool, sequence int64) *Key {
+	if key == nil {
+		return nil
+	}
+	if hasIV {
+		return key
+	}
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint64(iv[8:], uint64(sequence))
+	return &Key{URI: key.URI, IV: iv}
+}
+
+// parseIV decodes a 0x-prefixed 128-bit hexadecimal IV
+func parseIV(s string) ([]byte, error) {
+	hexIV := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	iv, err := hex.DecodeString(hexIV)
+	if err != nil || len(iv) != 16 {
+		return nil, fmt.Errorf("stream: invalid IV %q", s)
+	}
+	return iv, nil
+}
+
+// parseAttributes parses an attribute list like BANDWIDTH=1280000,CODECS="a,b"
+func parseAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[strings.TrimSpace(name)] = value
+		s = strings.TrimSpace(rest)
+	}
+	return attrs
+}
@@ -0,0 +1,239 @@
+package stream
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+)
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestParseHLS_Master(t *testing.T) {
+	body := "\ufeff#EXTM3U\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=800000,AVERAGE-BANDWIDTH=600000,RESOLUTION=1280x720,CODECS=\"avc1.4d401f,mp4a.40.2\"\n" +
+		"hi/index.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=200000,RESOLUTION=640x360\n" +
+		"https://cdn.example.com/lo.m3u8\n"
+
+	p, err := parseHLS([]byte(body), mustParseURL(t, "https://example.com/video/master.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.ended || len(p.segments) != 0 {
+		t.Fatalf("master playlist parsed as media: ended=%v segments=%d", p.ended, len(p.segments))
+	}
+	want := []Variant{
+		{URL: "https://example.com/video/hi/index.m3u8", Bandwidth: 800000, Average: 600000, Width: 1280, Height: 720},
+		{URL: "https://cdn.example.com/lo.m3u8", Bandwidth: 200000, Width: 640, Height: 360},
+	}
+	if len(p.variants) != len(want) {
+		t.Fatalf("got %d variants, want %d", len(p.variants), len(want))
+	}
+	for i := range want {
+		if p.variants[i] != want[i] {
+			t.Errorf("variant %d = %+v, want %+v", i, p.variants[i], want[i])
+		}
+	}
+}
+
+func TestParseHLS_Media(t *testing.T) {
+	body := `#EXTM3U
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:10
+#EXT-X-MAP:URI="init.mp4",BYTERANGE="720@0"
+#EXTINF:6.0,
+#EXT-X-BYTERANGE:1000@720
+media.mp4
+#EXTINF:5.5,
+#EXT-X-BYTERANGE:2000
+media.mp4
+#EXT-X-KEY:METHOD=AES-128,URI="../keys/k1",IV=0x000102030405060708090a0b0c0d0e0f
+#EXTINF:6.0,
+seg3.m4s
+#EXT-X-KEY:METHOD=AES-128,URI="k2"
+#EXTINF:6.0,
+seg4.m4s
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:2.0,
+seg5.m4s
+#EXT-X-ENDLIST
+`
+	p, err := parseHLS([]byte(body), mustParseURL(t, "https://example.com/a/b/index.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.ended || !p.hasMap {
+		t.Fatalf("ended=%v hasMap=%v, want both", p.ended, p.hasMap)
+	}
+	if ext := hlsExt(p); ext != ".mp4" {
+		t.Errorf("hlsExt = %q, want .mp4", ext)
+	}
+	if len(p.segments) != 6 {
+		t.Fatalf("got %d segments, want 6", len(p.segments))
+	}
+
+	s := p.segments
+	if s[0].URL != "https://example.com/a/b/init.mp4" || s[0].Offset != 0 || s[0].Length != 720 || s[0].Duration != 0 {
+		t.Errorf("init segment = %+v", s[0])
+	}
+	if s[1].Offset != 720 || s[1].Length != 1000 || s[1].Duration != 6 {
+		t.Errorf("segment 1 = %+v", s[1])
+	}
+	if s[2].Offset != 1720 || s[2].Length != 2000 {
+		t.Errorf("byte range without offset should follow the previous one, got %+v", s[2])
+	}
+
+	if s[3].Key == nil || s[3].Key.URI != "https://example.com/a/keys/k1" {
+		t.Fatalf("segment 3 key = %+v", s[3].Key)
+	}
+	wantIV := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	if !bytes.Equal(s[3].Key.IV, wantIV) {
+		t.Errorf("explicit IV = %x, want %x", s[3].Key.IV, wantIV)
+	}
+
+	// Without an IV the media sequence number is used: 10 + 3
+	wantIV = make([]byte, 16)
+	wantIV[15] = 13
+	if s[4].Key == nil || !bytes.Equal(s[4].Key.IV, wantIV) {
+		t.Errorf("segment 4 key = %+v, want IV %x", s[4].Key, wantIV)
+	}
+	if s[5].Key != nil {
+		t.Errorf("METHOD=NONE should clear the key, got %+v", s[5].Key)
+	}
+}
+
+func TestParseHLS_Rejects(t *testing.T) {
+	base := mustParseURL(t, "https://example.com/index.m3u8")
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not a playlist", "<html></html>"},
+		{"sample aes", "#EXTM3U\n#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"k\"\n#EXTINF:4,\na.ts\n#EXT-X-ENDLIST\n"},
+		{"bad iv", "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=0x1234\n#EXTINF:4,\na.ts\n"},
+		{"orphan byte range", "#EXTM3U\n#EXTINF:4,\n#EXT-X-BYTERANGE:100\na.ts\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseHLS([]byte(tt.body), base); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseHLS_Live(t *testing.T) {
+	body := "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\na.ts\n#EXTINF:4,\nb.ts\n"
+	p, err := parseHLS([]byte(body), mustParseURL(t, "https://example.com/live.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ended {
+		t.Error("a playlist without EXT-X-ENDLIST should not count as ended")
+	}
+}
+
+func TestHLSExt(t *testing.T) {
+	tests := []struct {
+		segment string
+		want    string
+	}{
+		{"https://example.com/a.ts", ".ts"},
+		{"https://example.com/a.AAC?token=1", ".aac"},
+		{"https://example.com/a.mp3", ".mp3"},
+		{"https://example.com/segment", ".ts"},
+	}
+	for _, tt := range tests {
+		p := &hlsPlaylist{segments: []Segment{{URL: tt.segment}}}
+		if got := hlsExt(p); got != tt.want {
+			t.Errorf("hlsExt(%s) = %q, want %q", tt.segment, got, tt.want)
+		}
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	attrs := parseAttributes(`BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2", RESOLUTION=1280x720,NAME="x=y"`)
+	want := map[string]string{
+		"BANDWIDTH":  "1280000",
+		"CODECS":     "avc1.4d401f,mp4a.40.2",
+		"RESOLUTION": "1280x720",
+		"NAME":       "x=y",
+	}
+	if len(attrs) != len(want) {
+		t.Fatalf("got %v, want %v", attrs, want)
+	}
+	for k, v := range want {
+		if attrs[k] != v {
+			t.Errorf("%s = %q, want %q", k, attrs[k], v)
+		}
+	}
+}
+
+func TestSelectVariant(t *testing.T) {
+	variants := []Variant{
+		{ID: "720", Bandwidth: 1_200_000, Height: 720},
+		{ID: "360", Bandwidth: 400_000, Height: 360},
+		{ID: "1080", Bandwidth: 2_400_000, Height: 1080},
+		{ID: "audio", Bandwidth: 64_000},
+	}
+	tests := []struct {
+		choice string
+		want   string
+	}{
+		{"", "1080"},
+		{"highest", "1080"},
+		{"Best", "1080"},
+		{"lowest", "audio"},
+		{"720p", "720"},
+		{"1000", "720"},
+		{"480p", "360"},
+		{"144p", "audio"}, // Nothing that small: fall back to the lowest
+	}
+	for _, tt := range tests {
+		got, err := selectVariant(variants, tt.choice)
+		if err != nil {
+			t.Errorf("selectVariant(%q): %v", tt.choice, err)
+			continue
+		}
+		if got.ID != tt.want {
+			t.Errorf("selectVariant(%q) = %s, want %s", tt.choice, got.ID, tt.want)
+		}
+	}
+
+	if _, err := selectVariant(variants, "fastest"); err == nil {
+		t.Error("expected an error for an unknown choice")
+	}
+	if _, err := selectVariant(nil, ""); err == nil {
+		t.Error("expected an error without variants")
+	}
+}
+
+func TestIsManifest(t *testing.T) {
+	tests := []struct {
+		url         string
+		contentType string
+		want        bool
+	}{
+		{"https://example.com/video/master.m3u8", "", true},
+		{"https://example.com/video/master.M3U8?token=abc", "", true},
+		{"http://example.com/manifest.mpd", "", true},
+		{"https://example.com/play?id=1", "application/vnd.apple.mpegurl", true},
+		{"https://example.com/play?id=1", "application/x-mpegURL; charset=utf-8", true},
+		{"https://example.com/play?id=1", "application/dash+xml", true},
+		{"https://example.com/video.mp4", "video/mp4", false},
+		{"https://example.com/list.m3u8.zip", "", false},
+		{"ftp://example.com/master.m3u8", "", false},
+	}
+	for _, tt := range tests {
+		if got := IsManifest(tt.url, tt.contentType); got != tt.want {
+			t.Errorf("IsManifest(%q, %q) = %v, want %v", tt.url, tt.contentType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+// Package stream downloads HLS (.m3u8) and DASH (.mpd) presentations.
+//
+// The manifest is resolved to one variant, whose media segments are fetched
+// in parallel and concatenated into a single file. AES-128 encrypted HLS
+// segments are decrypted on the way; SAMPLE-AES and DRM protected streams are
+// not supported. Live presentations can't be downloaded as they have no end.
+// For DASH only the video adaptation set is fetched (or the first one if
+// there is no video); separate audio tracks are not muxed in.
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Kind is the manifest format
+type Kind int
+
+const (
+	HLS Kind = iota
+	DASH
+)
+
+// ContentType returns the media type of the manifest format
+func (k Kind) ContentType() string {
+	if k == DASH {
+		return "application/dash+xml"
+	}
+	return "application/vnd.apple.mpegurl"
+}
+
+// maxManifestSize bounds how much of a manifest is read
+const maxManifestSize = 16 * types.MB
+
+// defaultSegmentEstimate sizes segments when neither the manifest nor the
+// server tells us how big they are
+const defaultSegmentEstimate = types.MB
+
+// errLive is returned for presentations that are still being recorded
+var errLive = errors.New("stream: live streams can't be downloaded, the playlist has no end")
+
+// IsManifest reports whether rawurl names an HLS or DASH manifest, judged by
+// its extension or by contentType when the server sent one
+func IsManifest(rawurl, contentType string) bool {
+	_, ok := detectKind(rawurl, contentType)
+	return ok
+}
+
+func detectKind(rawurl, contentType string) (Kind, bool) {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch strings.ToLower(mediaType) {
+		case "application/vnd.apple.mpegurl", "application/x-mpegurl", "audio/mpegurl", "audio/x-mpegurl":
+			return HLS, true
+		case "application/dash+xml":
+			return DASH, true
+		}
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return 0, false
+	}
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".m3u8", ".m3u":
+		return HLS, true
+	case ".mpd":
+		return DASH, true
+	}
+	return 0, false
+}
+
+// Variant is one rendition of the presentation: an HLS variant stream or a
+// DASH representation
+type Variant struct {
+	URL       string // Media playlist (HLS); empty for DASH
+	ID        string // Representation id (DASH)
+	Bandwidth int64  // Peak bits per second
+	Average   int64  // Average bits per second when known
+	Width     int
+	Height    int
+	MimeType  string
+}
+
+// Key decrypts an AES-128 encrypted segment
+type Key struct {
+	URI string
+	IV  []byte
+}
+
+// Segment is one piece of media to fetch
+type Segment struct {
+	URL      string
+	Offset   int64   // Start of a byte range within URL
+	Length   int64   // Size of the byte range, 0 for the whole resource
+	Duration float64 // Seconds, 0 for initialization segments
+	Key      *Key    // nil if the segment is not encrypted
+}
+
+// Plan is a resolved presentation: the chosen variant and its segments in
+// playback order, initialization segments included
+type Plan struct {
+	Kind     Kind
+	Variant  Variant
+	Segments []Segment
+	Ext      string // Extension of the merged file, e.g. ".ts"
+
+	// SegmentSize is the share of the estimated total each segment gets in
+	// progress reporting, so the chunk map shows one chunk per segment
+	SegmentSize int64
+}
+
+// TotalSize returns the estimated size of the merged file as laid out for
+// progress reporting
+func (p *Plan) TotalSize() int64 {
+	return int64(len(p.Segments)) * p.SegmentSize
+}
+
+// Filename derives the merged file's name from the manifest's name
+func (p *Plan) Filename(manifestName string) string {
+	base := strings.TrimSuffix(manifestName, path.Ext(manifestName))
+	if base == "" {
+		base = "stream"
+	}
+	return base + p.Ext
+}
+
+// Resolve fetches the manifest at rawurl, picks the variant named by the
+// stream_variant setting and lists its segments
+func Resolve(ctx context.Context, client *http.Client, rawurl string, headers map[string]string, runtime *types.RuntimeConfig) (*Plan, error) {
+	body, contentType, finalURL, err := fetchManifest(ctx, client, rawurl, headers, runtime)
+	if err != nil {
+		return nil, err
+	}
+	kind, ok := detectKind(rawurl, contentType)
+	if !ok {
+		return nil, fmt.Errorf("stream: %s is not an HLS or DASH manifest", rawurl)
+	}
+
+	var choice string
+	if runtime != nil {
+		choice = runtime.StreamVariant
+	}
+
+	var plan *Plan
+	switch kind {
+	case HLS:
+		plan, err = resolveHLS(ctx, client, body, finalURL, headers, runtime, choice)
+	case DASH:
+		plan, err = resolveDASH(body, finalURL, choice)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(plan.Segments) == 0 {
+		return nil, fmt.Errorf("stream: the manifest lists no segments")
+	}
+	plan.Kind = kind
+	plan.SegmentSize = estimateSegmentSize(ctx, client, plan, headers, runtime)
+
+	utils.Debug("Stream %s: variant %dx%d @ %d bps, %d segments, ~%d bytes",
+		rawurl, plan.Variant.Width, plan.Variant.Height, plan.Variant.Bandwidth, len(plan.Segments), plan.TotalSize())
+	return plan, nil
+}
+
+// selectVariant picks the variant named by choice: "highest" (the default),
+// "lowest", or a height such as "720p" for the best variant no taller than
+// that, falling back to the lowest one
+func selectVariant(variants []Variant, choice string) (Variant, error) {
+	if len(variants) == 0 {
+		return Variant{}, fmt.Errorf("stream: the manifest lists no variants")
+	}
+	sorted := append([]Variant(nil), variants...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Bandwidth != sorted[j].Bandwidth {
+			return sorted[i].Bandwidth < sorted[j].Bandwidth
+		}
+		return sorted[i].Height < sorted[j].Height
+	})
+
+	choice = strings.ToLower(strings.TrimSpace(choice))
+	switch choice {
+	case "", "highest", "best":
+		return sorted[len(sorted)-1], nil
+	case "lowest", "worst":
+		return sorted[0], nil
+	}
+
+	height, err := strconv.Atoi(strings.TrimSuffix(choice, "p"))
+	if err != nil || height <= 0 {
+		return Variant{}, fmt.Errorf("stream: invalid variant %q (use highest, lowest or a height like 720p)", choice)
+	}
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if sorted[i].Height > 0 && sorted[i].Height <= height {
+			return sorted[i], nil
+		}
+	}
+	return sorted[0], nil
+}
+
+// estimateSegmentSize spreads the variant's bitrate over its segments. If the
+// manifest has no bitrate the first media segment's size stands in for all.
+func estimateSegmentSize(ctx context.Context, client *http.Client, plan *Plan, headers map[string]string, runtime *types.RuntimeConfig) int64 {
+	n := int64(len(plan.Segments))
+
+	var ranged int64
+	var duration float64
+	for _, seg := range plan.Segments {
+		if seg.Length <= 0 {
+			ranged = -1
+		} else if ranged >= 0 {
+			ranged += seg.Length
+		}
+		duration += seg.Duration
+	}
+
+	var total int64
+	bandwidth := plan.Variant.Average
+	if bandwidth <= 0 {
+		bandwidth = plan.Variant.Bandwidth
+	}
+	switch {
+	case ranged > 0:
+		total = ranged
+	case bandwidth > 0 && duration > 0:
+		total = int64(float64(bandwidth) / 8 * duration)
+	default:
+		first := plan.Segments[0]
+		for _, seg := range plan.Segments {
+			if seg.Duration > 0 {
+				first = seg
+				break
+			}
+		}
+		if size := headSize(ctx, client, first, headers, runtime); size > 0 {
+			return size
+		}
+		return defaultSegmentEstimate
+	}
+	return max(1, int64(math.Ceil(float64(total)/float64(n))))
+}
+
+// headSize asks the server for the size of seg, or returns 0
+func headSize(ctx context.Context, client *http.Client, seg Segment, headers map[string]string, runtime *types.RuntimeConfig) int64 {
+	if seg.Length > 0 {
+		return seg.Length
+	}
+	req, err := newRequest(ctx, http.MethodHead, seg.URL, headers, runtime)
+	if err != nil {
+		return 0
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0
+	}
+	return resp.ContentLength
+}
+
+// newRequest builds a request carrying the download's headers and user agent
+func newRequest(ctx context.Context, method, rawurl string, headers map[string]string, runtime *types.RuntimeConfig) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, val := range headers {
+		// Skip Range - segments set their own
+		if key != "Range" {
+			req.Header.Set(key, val)
+		}
+	}
+	runtime.ApplyCredentials(req)
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", runtime.GetUserAgent())
+	}
+	return req, nil
+}
+
+// fetchManifest downloads a playlist or MPD. It returns the body, the
+// Content-Type and the URL after redirects, which relative URIs resolve against.
+func fetchManifest(ctx context.Context, client *http.Client, rawurl string, headers map[string]string, runtime *types.RuntimeConfig) ([]byte, string, *url.URL, error) {
+	req, err := newRequest(ctx, http.MethodGet, rawurl, headers, runtime)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("stream: failed to fetch manifest: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", nil, fmt.Errorf("stream: manifest request returned %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("stream: failed to read manifest: %w", err)
+	}
+	return body, resp.Header.Get("Content-Type"), resp.Request.URL, nil
+}
+
+// resolveURI resolves ref against base
+func resolveURI(base *url.URL, ref string) (string, error) {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", fmt.Errorf("stream: bad URI %q: %w", ref, err)
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,236 @@
+package torrent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Bencoded values decode to int64, string (holding the raw bytes), []any and
+// map[string]any.
+
+var errUnexpectedEnd = errors.New("bencode: unexpected end of data")
+
+// maxDepth bounds how deeply lists and dictionaries may nest
+const maxDepth = 64
+
+type decoder struct {
+	data  []byte
+	pos   int
+	depth int
+	// spans records where the values of the top level dictionary start and
+	// end, so the info dictionary can be hashed exactly as it was sent
+	spans map[string][2]int
+}
+
+// decode parses a whole bencoded document
+func decode(data []byte) (any, error) {
+	v, n, err := decodePrefix(data)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(data) {
+		return nil, errors.New("bencode: trailing data")
+	}
+	return v, nil
+}
+
+// decodePrefix parses the value at the start of data and returns how many
+// bytes it took. ut_metadata messages carry raw data after their dictionary.
+func decodePrefix(data []byte) (any, int, error) {
+	d := &decoder{data: data}
+	v, err := d.value()
+	return v, d.pos, err
+}
+
+// decodeDict parses a document that must be a dictionary, along with the
+// spans of its values
+func decodeDict(data []byte) (map[string]any, map[string][2]int, error) {
+	d := &decoder{data: data, spans: make(map[string][2]int)}
+	v, err := d.value()
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.pos != len(data) {
+		return nil, nil, errors.New("bencode: trailing data")
+	}
+	dict, ok := v.(map[string]any)
+	if !ok {
+		return nil, nil, errors.New("bencode: expected a dictionary")
+	}
+	return dict, d.spans, nil
+}
+
+func (d *decoder) value() (any, error) {
+	if d.pos >= len(d.data) {
+		return nil, errUnexpectedEnd
+	}
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		end := bytes.IndexByte(d.data[d.pos:], 'e')
+		if end < 0 {
+			return nil, errUnexpectedEnd
+		}
+		s := string(d.data[d.pos+1 : d.pos+end])
+		n, err := strconv.ParseInt(s, 10, 64)
+		// Each integer has exactly one spelling: no leading zeros, no -0
+		if err != nil || strconv.FormatInt(n, 10) != s {
+			return nil, fmt.Errorf("bencode: invalid integer %q", s)
+		}
+		d.pos += end + 1
+		return n, nil
+
+	case c >= '0' && c <= '9':
+		return d.str()
+
+	case c == 'l':
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		list := []any{}
+		for {
+			if d.pos >= len(d.data) {
+				return nil, errUnexpectedEnd
+			}
+			if d.data[d.pos] == 'e' {
+				d.pos++
+				d.depth--
+				return list, nil
+			}
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+
+	case c == 'd':
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		dict := make(map[string]any)
+		for {
+			if d.pos >= len(d.data) {
+				return nil, errUnexpectedEnd
+			}
+			if d.data[d.pos] == 'e' {
+				d.pos++
+				d.depth--
+				return dict, nil
+			}
+			key, err := d.str()
+			if err != nil {
+				return nil, err
+			}
+			start := d.pos
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			if d.depth == 1 && d.spans != nil {
+				d.spans[key] = [2]int{start, d.pos}
+			}
+			dict[key] = v
+		}
+	}
+	return nil, fmt.Errorf("bencode: unexpected %q at byte %d", d.data[d.pos], d.pos)
+}
+
+func (d *decoder) enter() error {
+	d.depth++
+	if d.depth > maxDepth {
+		return errors.New("bencode: nested too deeply")
+	}
+	d.pos++
+	return nil
+}
+
+func (d *decoder) str() (string, error) {
+	colon := bytes.IndexByte(d.data[d.pos:], ':')
+	if colon < 0 {
+		return "", errUnexpectedEnd
+	}
+	n, err := strconv.Atoi(string(d.data[d.pos : d.pos+colon]))
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("bencode: invalid string length at byte %d", d.pos)
+	}
+	start := d.pos + colon + 1
+	if n > len(d.data)-start {
+		return "", errUnexpectedEnd
+	}
+	d.pos = start + n
+	return string(d.data[start:d.pos]), nil
+}
+
+// encode bencodes v, which may be built from integers, strings, byte
+// slices, lists and string keyed maps
+func encode(v any) []byte {
+	var b bytes.Buffer
+	encodeTo(&b, v)
+	return b.Bytes()
+}
+
+func encodeTo(b *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case int:
+		fmt.Fprintf(b, "i%de", v)
+	case int64:
+		fmt.Fprintf(b, "i%de", v)
+	case string:
+		fmt.Fprintf(b, "%d:%s", len(v), v)
+	case []byte:
+		fmt.Fprintf(b, "%d:", len(v))
+		b.Write(v)
+	case []string:
+		b.WriteByte('l')
+		for _, s := range v {
+			encodeTo(b, s)
+		}
+		b.WriteByte('e')
+	case []any:
+		b.WriteByte('l')
+		for _, item := range v {
+			encodeTo(b, item)
+		}
+		b.WriteByte('e')
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteByte('d')
+		for _, k := range keys {
+			encodeTo(b, k)
+			encodeTo(b, v[k])
+		}
+		b.WriteByte('e')
+	default:
+		panic(fmt.Sprintf("bencode: can't encode %T", v))
+	}
+}
+
+// Accessors for decoded dictionaries; a missing key or a value of the wrong
+// type reads as the zero value
+
+func dictString(d map[string]any, key string) string {
+	s, _ := d[key].(string)
+	return s
+}
+
+func dictInt(d map[string]any, key string) int64 {
+	n, _ := d[key].(int64)
+	return n
+}
+
+func dictList(d map[string]any, key string) []any {
+	l, _ := d[key].([]any)
+	return l
+}
+
+func dictDict(d map[string]any, key string) map[string]any {
+	m, _ := d[key].(map[string]any)
+	return m
+}
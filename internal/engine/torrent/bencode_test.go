@@ -0,0 +1,97 @@
+package torrent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want any
+	}{
+		{"i42e", int64(42)},
+		{"i-7e", int64(-7)},
+		{"4:spam", "spam"},
+		{"0:", ""},
+		{"l4:spami3ee", []any{"spam", int64(3)}},
+		{"d3:cow3:moo4:spaml1:a1:bee", map[string]any{"cow": "moo", "spam": []any{"a", "b"}}},
+	}
+	for _, tt := range tests {
+		got, err := decode([]byte(tt.in))
+		if err != nil {
+			t.Errorf("decode(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decode(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"i42",
+		"ie",
+		"i-0e",
+		"i03e",
+		"5:spam",
+		"l4:spam",
+		"d3:cowe",
+		"di1e3:mooe", // Keys must be strings
+		"i1ei2e",     // Trailing data
+		"x",
+		strings.Repeat("l", maxDepth+1) + strings.Repeat("e", maxDepth+1),
+	} {
+		if _, err := decode([]byte(in)); err == nil {
+			t.Errorf("decode(%q) should fail", in)
+		}
+	}
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	v := map[string]any{
+		"b":    "bytes\x00\xff",
+		"a":    int64(-12),
+		"list": []any{int64(1), "two", map[string]any{"z": "", "y": []any{}}},
+	}
+	data := encode(v)
+	if want := "d1:ai-12e1:b7:bytes\x00\xff4:listli1e3:twod1:yle1:z0:eee"; string(data) != want {
+		t.Errorf("encode = %q, want %q (keys sorted)", data, want)
+	}
+	got, err := decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("round trip = %#v, want %#v", got, v)
+	}
+}
+
+func TestDecodeDict_Spans(t *testing.T) {
+	data := []byte("d8:announce3:url4:infod4:name1:xee")
+	dict, spans, err := decodeDict(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dictString(dict, "announce") != "url" {
+		t.Errorf("announce = %q", dictString(dict, "announce"))
+	}
+	span := spans["info"]
+	if got := string(data[span[0]:span[1]]); got != "d4:name1:xe" {
+		t.Errorf("info span = %q, want the raw info dictionary", got)
+	}
+}
+
+func TestDecodePrefix(t *testing.T) {
+	data := []byte("d8:msg_typei1e5:piecei0eeRAW")
+	v, n, err := decodePrefix(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dictInt(v.(map[string]any), "msg_type") != 1 || string(data[n:]) != "RAW" {
+		t.Errorf("decodePrefix = %v, rest %q", v, data[n:])
+	}
+}
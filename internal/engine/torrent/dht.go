@@ -0,0 +1,268 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// dhtBootstrap are the well known routers a lookup starts from
+var dhtBootstrap = []string{
+	"router.bittorrent.com:6881",
+	"dht.transmissionbt.com:6881",
+	"router.utorrent.com:6881",
+	"dht.libtorrent.org:25401",
+}
+
+const (
+	dhtAlpha        = 8                      // Queries in flight per round
+	dhtClosest      = 16                     // A lookup ends when these are all queried
+	dhtMaxRounds    = 20                     // and gives up after this many rounds
+	dhtQueryTimeout = 2 * time.Second        // How long a node gets to answer
+	dhtInterval     = 5 * time.Minute        // Time between lookups for a torrent
+	dhtTokenSecret  = "surge-announce-token" // Token handed to nodes that ask us for peers
+)
+
+// dht is a minimal mainline DHT (BEP 5) client. It looks up peers for an
+// info hash, announces itself to the closest nodes and answers the queries
+// other nodes send back, but keeps no routing table between lookups.
+type dht struct {
+	conn net.PacketConn
+	id   [20]byte
+
+	mu      sync.Mutex
+	pending map[string]chan map[string]any
+	nextTID uint16
+}
+
+func newDHT() (*dht, error) {
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	d := &dht{conn: conn, pending: make(map[string]chan map[string]any)}
+	_, _ = rand.Read(d.id[:])
+	go d.readLoop()
+	return d, nil
+}
+
+func (d *dht) close() {
+	_ = d.conn.Close()
+}
+
+func (d *dht) readLoop() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		v, err := decode(buf[:n])
+		msg, ok := v.(map[string]any)
+		if err != nil || !ok {
+			continue
+		}
+		switch dictString(msg, "y") {
+		case "r", "e":
+			d.mu.Lock()
+			ch := d.pending[dictString(msg, "t")]
+			delete(d.pending, dictString(msg, "t"))
+			d.mu.Unlock()
+			if ch != nil {
+				ch <- msg
+			}
+		case "q":
+			d.answer(msg, addr)
+		}
+	}
+}
+
+// answer replies to a query with an empty result, which is enough for
+// nodes to keep us in their tables while we look something up
+func (d *dht) answer(q map[string]any, addr net.Addr) {
+	r := map[string]any{"id": string(d.id[:])}
+	switch dictString(q, "q") {
+	case "get_peers":
+		r["token"] = dhtTokenSecret
+		r["nodes"] = ""
+	case "find_node":
+		r["nodes"] = ""
+	}
+	reply := map[string]any{"t": dictString(q, "t"), "y": "r", "r": r}
+	_, _ = d.conn.WriteTo(encode(reply), addr)
+}
+
+// query sends a KRPC query to addr and waits for its response
+func (d *dht) query(ctx context.Context, addr *net.UDPAddr, method string, args map[string]any) (map[string]any, error) {
+	d.mu.Lock()
+	d.nextTID++
+	tid := string(binary.BigEndian.AppendUint16(nil, d.nextTID))
+	ch := make(chan map[string]any, 1)
+	d.pending[tid] = ch
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, tid)
+		d.mu.Unlock()
+	}()
+
+	args["id"] = string(d.id[:])
+	msg := map[string]any{"t": tid, "y": "q", "q": method, "a": args}
+	if _, err := d.conn.WriteTo(encode(msg), addr); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(dhtQueryTimeout)
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		if dictString(resp, "y") == "e" {
+			return nil, errors.New("dht: error response")
+		}
+		return dictDict(resp, "r"), nil
+	case <-timer.C:
+		return nil, errors.New("dht: timeout")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dhtCandidate is a node met during a lookup
+type dhtCandidate struct {
+	addr      *net.UDPAddr
+	dist      [20]byte
+	queried   bool
+	responded bool
+	token     string
+}
+
+// getPeers walks the DHT towards infoHash, passing every peer address it
+// learns to found. With port > 0 it then announces that it is downloading
+// the torrent on that port to the closest nodes that answered.
+func (d *dht) getPeers(ctx context.Context, infoHash [20]byte, port int, found func([]string)) {
+	seen := make(map[string]bool)
+	var cands []*dhtCandidate
+	add := func(addr *net.UDPAddr, id []byte) {
+		key := addr.String()
+		if seen[key] || addr.Port == 0 {
+			return
+		}
+		seen[key] = true
+		c := &dhtCandidate{addr: addr}
+		if len(id) == 20 {
+			for i := range c.dist {
+				c.dist[i] = id[i] ^ infoHash[i]
+			}
+		} else {
+			// Routers have no known ID; they sort last but are asked first
+			for i := range c.dist {
+				c.dist[i] = 0xff
+			}
+		}
+		cands = append(cands, c)
+	}
+	for _, host := range dhtBootstrap {
+		if addr, err := net.ResolveUDPAddr("udp4", host); err == nil {
+			add(addr, nil)
+		}
+	}
+
+	for round := 0; round < dhtMaxRounds && ctx.Err() == nil; round++ {
+		sort.Slice(cands, func(i, j int) bool { return bytes.Compare(cands[i].dist[:], cands[j].dist[:]) < 0 })
+
+		var batch []*dhtCandidate
+		for _, c := range cands {
+			if !c.queried {
+				batch = append(batch, c)
+				if len(batch) == dhtAlpha {
+					break
+				}
+			}
+		}
+		if len(batch) == 0 || (round > 0 && closestDone(cands)) {
+			break
+		}
+
+		type result struct {
+			c *dhtCandidate
+			r map[string]any
+		}
+		results := make(chan result, len(batch))
+		for _, c := range batch {
+			c.queried = true
+			go func(c *dhtCandidate) {
+				r, err := d.query(ctx, c.addr, "get_peers", map[string]any{"info_hash": string(infoHash[:])})
+				if err != nil {
+					r = nil
+				}
+				results <- result{c, r}
+			}(c)
+		}
+		for range batch {
+			res := <-results
+			if res.r == nil {
+				continue
+			}
+			res.c.responded = true
+			res.c.token = dictString(res.r, "token")
+			var peers []string
+			for _, v := range dictList(res.r, "values") {
+				if s, ok := v.(string); ok {
+					switch len(s) {
+					case net.IPv4len + 2:
+						peers = append(peers, parseCompactPeers([]byte(s), net.IPv4len)...)
+					case net.IPv6len + 2:
+						peers = append(peers, parseCompactPeers([]byte(s), net.IPv6len)...)
+					}
+				}
+			}
+			if len(peers) > 0 {
+				found(peers)
+			}
+			nodes := dictString(res.r, "nodes")
+			for i := 0; i+26 <= len(nodes); i += 26 {
+				ip := net.IP([]byte(nodes[i+20 : i+24]))
+				nodePort := binary.BigEndian.Uint16([]byte(nodes[i+24 : i+26]))
+				add(&net.UDPAddr{IP: ip, Port: int(nodePort)}, []byte(nodes[i:i+20]))
+			}
+		}
+	}
+
+	if port <= 0 || ctx.Err() != nil {
+		return
+	}
+	announced := 0
+	for _, c := range cands {
+		if !c.responded || c.token == "" {
+			continue
+		}
+		args := map[string]any{"info_hash": string(infoHash[:]), "port": port, "token": c.token}
+		go func(addr *net.UDPAddr) { _, _ = d.query(ctx, addr, "announce_peer", args) }(c.addr)
+		if announced++; announced == dhtAlpha {
+			break
+		}
+	}
+}
+
+// closestDone reports whether the closest candidates that answered have all
+// been asked, so the lookup can't get any closer
+func closestDone(cands []*dhtCandidate) bool {
+	checked := 0
+	for _, c := range cands {
+		if !c.queried {
+			return false
+		}
+		if c.responded {
+			if checked++; checked == dhtClosest {
+				return true
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package torrent
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDHTNode answers get_peers with peers and announce_peer by recording it
+func fakeDHTNode(t *testing.T, peers []string) (addr string, announces <-chan map[string]any) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	ch := make(chan map[string]any, 1)
+
+	var values []any
+	for _, p := range peers {
+		host, port, _ := net.SplitHostPort(p)
+		n, _ := strconv.Atoi(port)
+		values = append(values, string(append(net.ParseIP(host).To4(), byte(n>>8), byte(n))))
+	}
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			v, err := decode(buf[:n])
+			msg, _ := v.(map[string]any)
+			if err != nil || dictString(msg, "y") != "q" {
+				continue
+			}
+			r := map[string]any{"id": "fake-node-id-1234567"}
+			switch dictString(msg, "q") {
+			case "get_peers":
+				r["token"] = "tok"
+				r["values"] = values
+			case "announce_peer":
+				ch <- dictDict(msg, "a")
+			}
+			_, _ = conn.WriteTo(encode(map[string]any{"t": dictString(msg, "t"), "y": "r", "r": r}), from)
+		}
+	}()
+	return conn.LocalAddr().String(), ch
+}
+
+func TestDHT_GetPeersAndAnnounce(t *testing.T) {
+	node, announces := fakeDHTNode(t, []string{"10.1.2.3:6881", "10.1.2.4:51413"})
+	saved := dhtBootstrap
+	dhtBootstrap = []string{node}
+	t.Cleanup(func() { dhtBootstrap = saved })
+
+	d, err := newDHT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.close()
+
+	var infoHash [20]byte
+	copy(infoHash[:], "abcdefghijabcdefghij")
+	var mu sync.Mutex
+	var found []string
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	d.getPeers(ctx, infoHash, 7000, func(peers []string) {
+		mu.Lock()
+		found = append(found, peers...)
+		mu.Unlock()
+	})
+
+	mu.Lock()
+	if want := []string{"10.1.2.3:6881", "10.1.2.4:51413"}; !reflect.DeepEqual(found, want) {
+		t.Errorf("found = %v, want %v", found, want)
+	}
+	mu.Unlock()
+
+	select {
+	case a := <-announces:
+		if dictString(a, "info_hash") != string(infoHash[:]) || dictInt(a, "port") != 7000 || dictString(a, "token") != "tok" {
+			t.Errorf("announce_peer args = %v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no announce_peer after the lookup")
+	}
+}
+
+func TestDHT_AnswersQueries(t *testing.T) {
+	d, err := newDHT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.close()
+
+	client, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	port := d.conn.LocalAddr().(*net.UDPAddr).Port
+	q := map[string]any{"t": "aa", "y": "q", "q": "ping", "a": map[string]any{"id": "01234567890123456789"}}
+	if _, err := client.WriteTo(encode(q), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	n, _, err := client.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := decode(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := v.(map[string]any)
+	if dictString(resp, "t") != "aa" || dictString(resp, "y") != "r" || dictString(dictDict(resp, "r"), "id") != string(d.id[:]) {
+		t.Errorf("response = %v", resp)
+	}
+}
@@ -0,0 +1,193 @@
+package torrent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Downloader fetches a torrent from a .torrent file or magnet link. Pieces
+// are verified against their hashes as they arrive, so a paused download
+// saves the byte ranges of the pieces still missing and continues from them
+// on resume. A multi file torrent is downloaded into a directory named
+// after destPath.
+type Downloader struct {
+	ProgressChan chan<- any           // Channel for events (start/complete/error)
+	ID           string               // Download ID
+	State        *types.ProgressState // Shared state for TUI polling
+	Runtime      *types.RuntimeConfig
+	Headers      map[string]string // Custom HTTP headers, sent when fetching the .torrent file
+
+	// Size is the size of the torrent's data once Download succeeds
+	Size int64
+}
+
+// NewDownloader creates a torrent downloader
+func NewDownloader(id string, progressCh chan<- any, progState *types.ProgressState, runtime *types.RuntimeConfig) *Downloader {
+	if runtime == nil {
+		runtime = &types.RuntimeConfig{
+			MaxConnectionsPerHost: types.PerHostMax,
+			MinChunkSize:          types.MinChunk,
+			WorkerBufferSize:      types.WorkerBuffer,
+			EnableDHT:             true,
+		}
+	}
+	if progState == nil {
+		progState = types.NewProgressState(id, 0)
+	}
+	return &Downloader{
+		ID:           id,
+		ProgressChan: progressCh,
+		State:        progState,
+		Runtime:      runtime,
+	}
+}
+
+// Download fetches the torrent source names into destPath, then keeps
+// seeding it in the background within the configured limits
+func (d *Downloader) Download(ctx context.Context, source string, destPath string) error {
+	utils.Debug("Torrent Download: %s -> %s", source, destPath)
+
+	meta, err := Resolve(ctx, source, d.Headers, d.Runtime)
+	if err != nil {
+		return err
+	}
+
+	downloadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	d.State.SetCancelFunc(cancel)
+
+	s, err := newSession(d.ID, meta, d.Runtime, d.State)
+	if err != nil {
+		return err
+	}
+	seeding := false
+	defer func() {
+		if !seeding {
+			s.stop()
+		}
+	}()
+	s.start()
+
+	// A magnet link's info comes from the first peer that has it
+	select {
+	case <-s.gotInfo:
+	case <-downloadCtx.Done():
+		if d.State.IsPaused() {
+			d.savePausedState(source, destPath, nil)
+			return types.ErrPaused
+		}
+		return context.Canceled
+	}
+
+	s.mu.Lock()
+	info := s.info
+	s.mu.Unlock()
+	size := info.TotalLength()
+	d.State.SetTotalSize(size)
+	d.State.InitBitmap(size, info.PieceLength)
+
+	workingPath := destPath + types.IncompleteSuffix
+	_, statErr := os.Stat(workingPath)
+	store, err := openStorage(workingPath, info, true)
+	if err != nil {
+		return err
+	}
+
+	done := make([]bool, info.NumPieces())
+	savedState, err := state.LoadState(source, destPath)
+	if err == nil && statErr == nil && savedState != nil && savedState.TotalSize == size && len(savedState.Tasks) > 0 {
+		// Pieces outside the saved ranges were verified before the pause
+		for i := range done {
+			done[i] = true
+		}
+		for _, t := range savedState.Tasks {
+			for i := t.Offset / info.PieceLength; i*info.PieceLength < t.Offset+t.Length && int(i) < len(done); i++ {
+				done[i] = false
+			}
+		}
+		for i, ok := range done {
+			if ok {
+				d.State.UpdateChunkStatus(int64(i)*info.PieceLength, info.PieceSize(i), types.ChunkCompleted)
+			}
+		}
+		d.State.Downloaded.Store(d.State.VerifiedProgress.Load())
+		d.State.SetSavedElapsed(time.Duration(savedState.Elapsed))
+		utils.Debug("Resuming torrent: %d of %d pieces missing", len(savedState.Tasks), info.NumPieces())
+	} else {
+		d.State.Downloaded.Store(0)
+		d.State.VerifiedProgress.Store(0)
+	}
+	d.State.SyncSessionStart()
+	s.begin(store, done)
+
+	select {
+	case <-s.complete:
+	case err := <-s.errc:
+		return err
+	case <-downloadCtx.Done():
+		if d.State.IsPaused() {
+			d.savePausedState(source, destPath, s)
+			return types.ErrPaused
+		}
+		return context.Canceled
+	}
+
+	if err := s.moveTo(workingPath, destPath); err != nil {
+		return err
+	}
+	_ = state.DeleteState(d.ID, source, destPath)
+	d.Size = size
+
+	seeding = true
+	s.seed()
+	return nil
+}
+
+// savePausedState records the pieces still missing. Without the info (a
+// magnet link no peer answered yet) there is nothing to record but the time.
+func (d *Downloader) savePausedState(source, destPath string, s *session) {
+	var tasks []types.Task
+	var size int64
+	if s != nil {
+		tasks = s.missing()
+		size = s.info.TotalLength()
+	}
+	var left int64
+	for _, t := range tasks {
+		left += t.Length
+	}
+	downloaded := size - left
+
+	elapsed := d.State.FinalizePauseSession(downloaded)
+	bitmap, _, _, chunkSize, _ := d.State.GetBitmap()
+	priority, queueOrder := d.State.GetPriority()
+
+	saved := &types.DownloadState{
+		URL:             source,
+		ID:              d.ID,
+		DestPath:        destPath,
+		TotalSize:       size,
+		Downloaded:      downloaded,
+		Tasks:           tasks,
+		Filename:        filepath.Base(destPath),
+		Elapsed:         elapsed.Nanoseconds(),
+		ChunkBitmap:     bitmap,
+		ActualChunkSize: chunkSize,
+		RateLimit:       d.State.GetRateLimit(),
+		Checksum:        d.State.GetChecksum(),
+		Priority:        priority,
+		QueueOrder:      queueOrder,
+		BatchID:         d.State.GetBatchID(),
+		Category:        d.State.GetCategory(),
+	}
+	if err := state.SaveState(source, destPath, saved); err != nil {
+		utils.Debug("Failed to save pause state: %v", err)
+	}
+	utils.Debug("Torrent download paused, state saved (Downloaded=%d, MissingRanges=%d)", downloaded, len(tasks))
+}
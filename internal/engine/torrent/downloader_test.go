@@ -0,0 +1,284 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func initTestState(t *testing.T) string {
+	state.CloseDB()
+	tmpDir := t.TempDir()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	t.Cleanup(state.CloseDB)
+	return tmpDir
+}
+
+// startSeeder serves the torrent in raw from the files under root on its own
+// listener, outside the session registry so a download in the same process
+// can connect to it
+func startSeeder(t *testing.T, raw []byte, root string) (addr string, seeder *session) {
+	t.Helper()
+	meta, err := ParseTorrent(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := makeSession("seeder", meta, &types.RuntimeConfig{}, nil)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go acceptLoop(ln, func([20]byte) *session { return s })
+	t.Cleanup(func() {
+		_ = ln.Close()
+		s.stop()
+	})
+
+	store, err := openStorage(root, meta.Info, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make([]bool, meta.Info.NumPieces())
+	for i := range done {
+		done[i] = true
+	}
+	s.begin(store, done)
+	return ln.Addr().String(), s
+}
+
+// fakeHTTPTracker hands out peers to every announce
+func fakeHTTPTracker(t *testing.T, peers ...string) (string, *atomic.Int32) {
+	t.Helper()
+	var announces atomic.Int32
+	var compact []byte
+	for _, p := range peers {
+		host, port, _ := net.SplitHostPort(p)
+		n, _ := strconv.Atoi(port)
+		compact = append(compact, net.ParseIP(host).To4()...)
+		compact = append(compact, byte(n>>8), byte(n))
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		announces.Add(1)
+		_, _ = w.Write(encode(map[string]any{"interval": 60, "peers": string(compact)}))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/announce", &announces
+}
+
+func testRuntime() *types.RuntimeConfig {
+	return &types.RuntimeConfig{MaxConnectionsPerHost: 4}
+}
+
+func assertFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading result: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("downloaded %d bytes do not match the seeded %d bytes", len(got), len(want))
+	}
+}
+
+func TestDownloader_FromPeers(t *testing.T) {
+	tmpDir := initTestState(t)
+	data := randomBytes(t, 600*1024+123)
+	files := []testFile{{data: data}}
+
+	seedDir := t.TempDir()
+	writeFiles(t, filepath.Join(seedDir, "file.bin"), files)
+	raw := makeTorrent(t, "file.bin", 64*1024, files, nil)
+	seederAddr, seeder := startSeeder(t, raw, filepath.Join(seedDir, "file.bin"))
+
+	tracker, announces := fakeHTTPTracker(t, seederAddr)
+	raw = makeTorrent(t, "file.bin", 64*1024, files, map[string]any{"announce": tracker})
+	torrentPath := filepath.Join(tmpDir, "file.torrent")
+	if err := os.WriteFile(torrentPath, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	destPath := filepath.Join(tmpDir, "out", "file.bin")
+	_ = os.MkdirAll(filepath.Dir(destPath), 0o755)
+	progress := types.NewProgressState("torrent-test", 0)
+	d := NewDownloader("torrent-test", nil, progress, testRuntime())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, torrentPath, destPath); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	assertFile(t, destPath, data)
+	if testutil.FileExists(destPath + types.IncompleteSuffix) {
+		t.Error(".surge file should be removed after completion")
+	}
+	if d.Size != int64(len(data)) || progress.Downloaded.Load() != int64(len(data)) {
+		t.Errorf("Size = %d, Downloaded = %d, want %d", d.Size, progress.Downloaded.Load(), len(data))
+	}
+	if announces.Load() == 0 {
+		t.Error("tracker was never asked for peers")
+	}
+	if seeder.uploaded.Load() != int64(len(data)) {
+		t.Errorf("seeder uploaded %d bytes, want %d", seeder.uploaded.Load(), len(data))
+	}
+	// No seeding limits are configured, so the session is gone
+	if lookupSession(seeder.meta.InfoHash) != nil {
+		t.Error("session should end when there is nothing to seed")
+	}
+}
+
+func TestDownloader_MagnetMetadataFromPeer(t *testing.T) {
+	tmpDir := initTestState(t)
+	files := []testFile{
+		{path: "readme.txt", data: []byte("hello torrent")},
+		{path: "data/blob.bin", data: randomBytes(t, 300*1024)},
+	}
+	seedDir := t.TempDir()
+	writeFiles(t, filepath.Join(seedDir, "album"), files)
+	raw := makeTorrent(t, "album", 32*1024, files, nil)
+	seederAddr, seeder := startSeeder(t, raw, filepath.Join(seedDir, "album"))
+
+	magnet := "magnet:?xt=urn:btih:" + hex.EncodeToString(seeder.meta.InfoHash[:]) + "&dn=album&x.pe=" + seederAddr
+	destPath := filepath.Join(tmpDir, "album")
+	d := NewDownloader("magnet-test", nil, types.NewProgressState("magnet-test", 0), testRuntime())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, magnet, destPath); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, filepath.Join(destPath, "readme.txt"), files[0].data)
+	assertFile(t, filepath.Join(destPath, "data", "blob.bin"), files[1].data)
+}
+
+func TestDownloader_WebSeed(t *testing.T) {
+	tmpDir := initTestState(t)
+	files := []testFile{
+		{path: "a b.bin", data: randomBytes(t, 70*1024)},
+		{path: "sub/c.bin", data: randomBytes(t, 90*1024)},
+	}
+	webRoot := t.TempDir()
+	writeFiles(t, filepath.Join(webRoot, "pack"), files)
+	var requests atomic.Int32
+	fileServer := http.FileServer(http.Dir(webRoot))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Range") == "" {
+			t.Errorf("web seed request without a range: %s", r.URL)
+		}
+		fileServer.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	raw := makeTorrent(t, "pack", 32*1024, files, map[string]any{"url-list": []any{server.URL + "/"}})
+	torrentPath := filepath.Join(tmpDir, "pack.torrent")
+	if err := os.WriteFile(torrentPath, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	destPath := filepath.Join(tmpDir, "out")
+	d := NewDownloader("webseed-test", nil, types.NewProgressState("webseed-test", 0), testRuntime())
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.Download(ctx, torrentPath, destPath); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, filepath.Join(destPath, "a b.bin"), files[0].data)
+	assertFile(t, filepath.Join(destPath, "sub", "c.bin"), files[1].data)
+	// Pieces spanning both files take two requests
+	if requests.Load() <= 5 {
+		t.Errorf("web seed requests = %d, want one per piece and file", requests.Load())
+	}
+}
+
+func TestDownloader_PauseAndResume(t *testing.T) {
+	tmpDir := initTestState(t)
+	data := randomBytes(t, 1024*1024)
+	files := []testFile{{data: data}}
+	webRoot := t.TempDir()
+	writeFiles(t, filepath.Join(webRoot, "file.bin"), files)
+
+	var served atomic.Int64
+	fileServer := http.FileServer(http.Dir(webRoot))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		served.Add(32 * 1024)
+		fileServer.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	raw := makeTorrent(t, "file.bin", 32*1024, files, map[string]any{"url-list": server.URL + "/file.bin"})
+	torrentPath := filepath.Join(tmpDir, "file.torrent")
+	if err := os.WriteFile(torrentPath, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	destPath := filepath.Join(tmpDir, "file.bin")
+
+	progress := types.NewProgressState("pause-test", 0)
+	go func() {
+		for progress.Downloaded.Load() < 256*1024 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		progress.Pause()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	d := NewDownloader("pause-test", nil, progress, testRuntime())
+	if err := d.Download(ctx, torrentPath, destPath); !errors.Is(err, types.ErrPaused) {
+		t.Fatalf("expected ErrPaused, got %v", err)
+	}
+
+	saved, err := state.LoadState(torrentPath, destPath)
+	if err != nil {
+		t.Fatalf("no state saved on pause: %v", err)
+	}
+	if saved.TotalSize != int64(len(data)) || saved.Downloaded <= 0 || len(saved.Tasks) == 0 {
+		t.Fatalf("unexpected saved state: size=%d downloaded=%d tasks=%d", saved.TotalSize, saved.Downloaded, len(saved.Tasks))
+	}
+
+	before := served.Load()
+	resumed := types.NewProgressState("pause-test", 0)
+	d = NewDownloader("pause-test", nil, resumed, testRuntime())
+	if err := d.Download(ctx, torrentPath, destPath); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	assertFile(t, destPath, data)
+	if again := served.Load() - before; again >= int64(len(data)) {
+		t.Errorf("resume fetched %d bytes, expected only the missing pieces", again)
+	}
+}
+
+func TestDownloader_SameTorrentTwice(t *testing.T) {
+	initTestState(t)
+	m, err := ParseMagnet("magnet:?xt=urn:btih:" + hex.EncodeToString(bytes.Repeat([]byte{7}, 20)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newSession("first", m, testRuntime(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.stop()
+	if _, err := newSession("second", m, testRuntime(), nil); err == nil {
+		t.Error("a torrent can only be downloaded once at a time")
+	}
+
+	Stop("first")
+	if lookupSession(m.InfoHash) != nil {
+		t.Error("Stop should end the session")
+	}
+}
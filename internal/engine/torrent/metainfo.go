@@ -0,0 +1,288 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// maxTorrentSize bounds the data a torrent may describe (1 PiB)
+const maxTorrentSize = 1 << 50
+
+// Info is the info dictionary of a torrent: the files it holds and the hash
+// of every piece
+type Info struct {
+	Name        string
+	PieceLength int64
+	Pieces      [][20]byte
+	Files       []File
+	Private     bool
+
+	multiFile bool
+}
+
+// File is one file of a torrent. Pieces run across the files in order, as
+// if they were one stream.
+type File struct {
+	Path   string // Relative to the torrent's directory, slash separated; empty for single file torrents
+	Length int64
+	Offset int64 // Where the file starts in the torrent's data
+}
+
+// MultiFile reports whether the torrent is a directory of files
+func (i *Info) MultiFile() bool {
+	return i.multiFile
+}
+
+// TotalLength returns the size of all files together
+func (i *Info) TotalLength() int64 {
+	if len(i.Files) == 0 {
+		return 0
+	}
+	last := i.Files[len(i.Files)-1]
+	return last.Offset + last.Length
+}
+
+// NumPieces returns how many pieces the torrent has
+func (i *Info) NumPieces() int {
+	return len(i.Pieces)
+}
+
+// PieceSize returns the length of piece idx; the last one may be short
+func (i *Info) PieceSize(idx int) int64 {
+	start := int64(idx) * i.PieceLength
+	return min(i.PieceLength, i.TotalLength()-start)
+}
+
+// MetaInfo is what a .torrent file or a magnet link tells about a torrent
+type MetaInfo struct {
+	InfoHash [20]byte
+	Info     *Info  // nil for a magnet link until a peer sends it
+	Name     string // Display name
+	Trackers []string
+	WebSeeds []string // BEP 19 HTTP sources
+	Peers    []string // Peer addresses from a magnet link's x.pe
+
+	infoBytes []byte // The info dictionary as sent, served to peers asking for metadata
+}
+
+// ParseTorrent reads a .torrent file
+func ParseTorrent(data []byte) (*MetaInfo, error) {
+	dict, spans, err := decodeDict(data)
+	if err != nil {
+		return nil, fmt.Errorf("torrent: %w", err)
+	}
+	span, ok := spans["info"]
+	if !ok {
+		return nil, errors.New("torrent: no info dictionary")
+	}
+	raw := data[span[0]:span[1]]
+	info, err := parseInfo(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MetaInfo{InfoHash: sha1.Sum(raw), Info: info, Name: info.Name, infoBytes: raw}
+	// announce-list tiers are flattened; every tracker is asked anyway
+	for _, tier := range dictList(dict, "announce-list") {
+		tier, _ := tier.([]any)
+		for _, tracker := range tier {
+			if s, ok := tracker.(string); ok {
+				m.Trackers = appendUnique(m.Trackers, s)
+			}
+		}
+	}
+	if s := dictString(dict, "announce"); s != "" {
+		m.Trackers = appendUnique(m.Trackers, s)
+	}
+	// url-list is a list, or a single string in older torrents
+	switch v := dict["url-list"].(type) {
+	case string:
+		m.WebSeeds = appendUnique(m.WebSeeds, v)
+	case []any:
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				m.WebSeeds = appendUnique(m.WebSeeds, s)
+			}
+		}
+	}
+	return m, nil
+}
+
+// parseInfo reads a bencoded info dictionary
+func parseInfo(raw []byte) (*Info, error) {
+	v, err := decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("torrent: %w", err)
+	}
+	dict, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.New("torrent: info is not a dictionary")
+	}
+
+	info := &Info{
+		Name:        dictString(dict, "name"),
+		PieceLength: dictInt(dict, "piece length"),
+		Private:     dictInt(dict, "private") == 1,
+	}
+	if utf8Name := dictString(dict, "name.utf-8"); utf8Name != "" {
+		info.Name = utf8Name
+	}
+	if !validComponent(info.Name) {
+		return nil, fmt.Errorf("torrent: invalid name %q", info.Name)
+	}
+	if info.PieceLength <= 0 {
+		return nil, errors.New("torrent: invalid piece length")
+	}
+
+	if files := dictList(dict, "files"); files != nil {
+		info.multiFile = true
+		var offset int64
+		for _, f := range files {
+			fd, _ := f.(map[string]any)
+			length := dictInt(fd, "length")
+			pathList := dictList(fd, "path.utf-8")
+			if pathList == nil {
+				pathList = dictList(fd, "path")
+			}
+			var parts []string
+			for _, p := range pathList {
+				p, _ := p.(string)
+				if !validComponent(p) {
+					return nil, fmt.Errorf("torrent: invalid file path %q", p)
+				}
+				parts = append(parts, p)
+			}
+			if len(parts) == 0 || length < 0 || offset+length > maxTorrentSize {
+				return nil, errors.New("torrent: invalid file entry")
+			}
+			info.Files = append(info.Files, File{Path: strings.Join(parts, "/"), Length: length, Offset: offset})
+			offset += length
+		}
+		if len(info.Files) == 0 {
+			return nil, errors.New("torrent: no files")
+		}
+	} else {
+		length := dictInt(dict, "length")
+		if length < 0 || length > maxTorrentSize {
+			return nil, errors.New("torrent: invalid length")
+		}
+		info.Files = []File{{Length: length}}
+	}
+
+	pieces := dictString(dict, "pieces")
+	if len(pieces)%20 != 0 {
+		return nil, errors.New("torrent: invalid piece hashes")
+	}
+	for i := 0; i < len(pieces); i += 20 {
+		var h [20]byte
+		copy(h[:], pieces[i:])
+		info.Pieces = append(info.Pieces, h)
+	}
+	total := info.TotalLength()
+	if want := (total + info.PieceLength - 1) / info.PieceLength; int64(len(info.Pieces)) != want || total == 0 {
+		return nil, fmt.Errorf("torrent: %d piece hashes for %d bytes", len(info.Pieces), total)
+	}
+	return info, nil
+}
+
+// validComponent reports whether name is safe to use as one file or
+// directory name
+func validComponent(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\\x00")
+}
+
+// ParseMagnet reads a magnet link. Only BitTorrent v1 info hashes (btih)
+// are supported.
+//
+//	magnet:?xt=urn:btih:<hash>&dn=<name>&tr=<tracker>&ws=<web seed>&x.pe=<host:port>
+func ParseMagnet(uri string) (*MetaInfo, error) {
+	u, err := url.Parse(uri)
+	if err != nil || !strings.EqualFold(u.Scheme, "magnet") {
+		return nil, errors.New("torrent: not a magnet link")
+	}
+	q := u.Query()
+
+	m := &MetaInfo{}
+	found := false
+	for key, values := range q {
+		// Hybrid links number their topics: xt.1, xt.2
+		if key != "xt" && !strings.HasPrefix(key, "xt.") {
+			continue
+		}
+		for _, xt := range values {
+			hash, ok := strings.CutPrefix(strings.ToLower(xt), "urn:btih:")
+			if !ok {
+				continue
+			}
+			if m.InfoHash, err = parseInfoHash(hash); err != nil {
+				return nil, err
+			}
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("torrent: magnet link has no BitTorrent v1 info hash (xt=urn:btih:)")
+	}
+
+	m.Name = q.Get("dn")
+	for _, tr := range q["tr"] {
+		m.Trackers = appendUnique(m.Trackers, tr)
+	}
+	for _, ws := range q["ws"] {
+		m.WebSeeds = appendUnique(m.WebSeeds, ws)
+	}
+	for _, pe := range q["x.pe"] {
+		m.Peers = appendUnique(m.Peers, pe)
+	}
+	return m, nil
+}
+
+// parseInfoHash reads a hex or base32 info hash
+func parseInfoHash(s string) ([20]byte, error) {
+	var h [20]byte
+	var b []byte
+	var err error
+	switch len(s) {
+	case 40:
+		b, err = hex.DecodeString(s)
+	case 32:
+		b, err = base32.StdEncoding.DecodeString(strings.ToUpper(s))
+	default:
+		err = errors.New("wrong length")
+	}
+	if err != nil || len(b) != 20 {
+		return h, fmt.Errorf("torrent: invalid info hash %q", s)
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// DisplayName returns the torrent's name, or its info hash if the name is
+// not known yet
+func (m *MetaInfo) DisplayName() string {
+	if m.Info != nil {
+		return m.Info.Name
+	}
+	if validComponent(m.Name) {
+		return m.Name
+	}
+	return hex.EncodeToString(m.InfoHash[:])
+}
+
+func appendUnique(list []string, s string) []string {
+	s = strings.TrimSpace(s)
+	for _, existing := range list {
+		if existing == s {
+			return list
+		}
+	}
+	if s == "" {
+		return list
+	}
+	return append(list, s)
+}
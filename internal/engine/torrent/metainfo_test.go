@@ -0,0 +1,217 @@
+package torrent
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testFile is one file of a torrent built by makeTorrent
+type testFile struct {
+	path string // Slash separated; empty for a single file torrent
+	data []byte
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// makeTorrent builds a .torrent file for files named name. extra adds keys
+// to the top level dictionary.
+func makeTorrent(t *testing.T, name string, pieceLength int, files []testFile, extra map[string]any) []byte {
+	t.Helper()
+	var all []byte
+	for _, f := range files {
+		all = append(all, f.data...)
+	}
+	var pieces []byte
+	for off := 0; off < len(all); off += pieceLength {
+		sum := sha1.Sum(all[off:min(off+pieceLength, len(all))])
+		pieces = append(pieces, sum[:]...)
+	}
+
+	info := map[string]any{"name": name, "piece length": pieceLength, "pieces": pieces}
+	if len(files) == 1 && files[0].path == "" {
+		info["length"] = len(files[0].data)
+	} else {
+		var list []any
+		for _, f := range files {
+			list = append(list, map[string]any{"length": len(f.data), "path": strings.Split(f.path, "/")})
+		}
+		info["files"] = list
+	}
+	top := map[string]any{"info": info}
+	for k, v := range extra {
+		top[k] = v
+	}
+	return encode(top)
+}
+
+// writeFiles lays out files under root the way the torrent stores them
+func writeFiles(t *testing.T, root string, files []testFile) {
+	t.Helper()
+	for _, f := range files {
+		p := root
+		if f.path != "" {
+			p = filepath.Join(root, filepath.FromSlash(f.path))
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, f.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseTorrent_SingleFile(t *testing.T) {
+	data := randomBytes(t, 100_000)
+	raw := makeTorrent(t, "file.bin", 32*1024, []testFile{{data: data}}, map[string]any{
+		"announce":      "http://tracker.example/announce",
+		"announce-list": []any{[]any{"udp://tracker.example:80", "http://tracker.example/announce"}},
+		"url-list":      "http://seed.example/file.bin",
+	})
+
+	m, err := ParseTorrent(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Info.MultiFile() || m.Info.Name != "file.bin" || m.Info.TotalLength() != 100_000 {
+		t.Errorf("info = %+v", m.Info)
+	}
+	if m.Info.NumPieces() != 4 || m.Info.PieceSize(3) != 100_000-3*32*1024 {
+		t.Errorf("pieces = %d, last = %d", m.Info.NumPieces(), m.Info.PieceSize(3))
+	}
+	if want := []string{"udp://tracker.example:80", "http://tracker.example/announce"}; !reflect.DeepEqual(m.Trackers, want) {
+		t.Errorf("trackers = %v, want %v", m.Trackers, want)
+	}
+	if want := []string{"http://seed.example/file.bin"}; !reflect.DeepEqual(m.WebSeeds, want) {
+		t.Errorf("web seeds = %v, want %v", m.WebSeeds, want)
+	}
+
+	// The info hash covers the info dictionary exactly as encoded
+	dict, spans, _ := decodeDict(raw)
+	if m.InfoHash != sha1.Sum(raw[spans["info"][0]:spans["info"][1]]) || dict["info"] == nil {
+		t.Error("info hash doesn't match the info dictionary")
+	}
+}
+
+func TestParseTorrent_MultiFile(t *testing.T) {
+	files := []testFile{
+		{path: "a.txt", data: randomBytes(t, 1000)},
+		{path: "sub/b.bin", data: randomBytes(t, 40_000)},
+		{path: "empty", data: nil},
+	}
+	m, err := ParseTorrent(makeTorrent(t, "dir", 16*1024, files, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Info.MultiFile() || len(m.Info.Files) != 3 {
+		t.Fatalf("files = %+v", m.Info.Files)
+	}
+	if f := m.Info.Files[1]; f.Path != "sub/b.bin" || f.Offset != 1000 || f.Length != 40_000 {
+		t.Errorf("second file = %+v", f)
+	}
+	if m.Info.TotalLength() != 41_000 {
+		t.Errorf("total = %d", m.Info.TotalLength())
+	}
+}
+
+func TestParseTorrent_Invalid(t *testing.T) {
+	good := []testFile{{path: "a", data: []byte("data")}}
+	tests := map[string][]byte{
+		"not bencode":     []byte("garbage"),
+		"no info":         encode(map[string]any{"announce": "x"}),
+		"path traversal":  makeTorrent(t, "dir", 16, []testFile{{path: "../evil", data: []byte("x")}}, nil),
+		"absolute name":   makeTorrent(t, "/etc", 16, good, nil),
+		"dot dot name":    makeTorrent(t, "..", 16, good, nil),
+		"empty":           makeTorrent(t, "dir", 16, []testFile{{path: "a"}}, nil),
+		"missing hashes":  encode(map[string]any{"info": map[string]any{"name": "x", "piece length": 16, "length": 100, "pieces": ""}}),
+		"no piece length": encode(map[string]any{"info": map[string]any{"name": "x", "length": 1, "pieces": strings.Repeat("x", 20)}}),
+	}
+	for name, raw := range tests {
+		if _, err := ParseTorrent(raw); err == nil {
+			t.Errorf("%s: ParseTorrent should fail", name)
+		}
+	}
+}
+
+func TestParseMagnet(t *testing.T) {
+	hash := strings.Repeat("ab", 20)
+	m, err := ParseMagnet("magnet:?xt=urn:btih:" + hash + "&dn=Some+Name&tr=udp%3A%2F%2Ft.example%3A80&tr=http%3A%2F%2Ft.example%2Fa&ws=http%3A%2F%2Fseed.example%2F&x.pe=10.0.0.1%3A6881")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(m.InfoHash[:]) != hash {
+		t.Errorf("info hash = %x", m.InfoHash)
+	}
+	if m.Name != "Some Name" || m.Info != nil {
+		t.Errorf("name = %q, info = %v", m.Name, m.Info)
+	}
+	if len(m.Trackers) != 2 || len(m.WebSeeds) != 1 || !reflect.DeepEqual(m.Peers, []string{"10.0.0.1:6881"}) {
+		t.Errorf("trackers = %v, web seeds = %v, peers = %v", m.Trackers, m.WebSeeds, m.Peers)
+	}
+	if m.DisplayName() != "Some Name" {
+		t.Errorf("DisplayName = %q", m.DisplayName())
+	}
+
+	// Base32 hashes, as older clients write them
+	b32 := base32.StdEncoding.EncodeToString(m.InfoHash[:])
+	m2, err := ParseMagnet("magnet:?xt=urn:btih:" + strings.ToLower(b32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m2.InfoHash != m.InfoHash {
+		t.Errorf("base32 hash = %x, want %x", m2.InfoHash, m.InfoHash)
+	}
+	if m2.DisplayName() != hash {
+		t.Errorf("DisplayName without dn = %q, want the hex hash", m2.DisplayName())
+	}
+
+	for _, bad := range []string{
+		"magnet:?dn=nothing",
+		"magnet:?xt=urn:btih:1234",
+		"magnet:?xt=urn:btmh:1220" + strings.Repeat("ab", 32),
+		"http://example.com/file.torrent",
+	} {
+		if _, err := ParseMagnet(bad); err == nil {
+			t.Errorf("ParseMagnet(%q) should fail", bad)
+		}
+	}
+}
+
+func TestIsTorrent(t *testing.T) {
+	tests := []struct {
+		source, contentType string
+		want                bool
+	}{
+		{"magnet:?xt=urn:btih:" + strings.Repeat("a", 40), "", true},
+		{"MAGNET:?xt=urn:btih:" + strings.Repeat("a", 40), "", true},
+		{"https://example.com/linux.iso.torrent", "", true},
+		{"https://example.com/linux.iso.TORRENT?session=1", "", true},
+		{"https://example.com/download?id=5", "application/x-bittorrent", true},
+		{"https://example.com/download?id=5", "application/x-bittorrent; charset=binary", true},
+		{"file:///tmp/a.torrent", "", true},
+		{"/home/me/a.torrent", "", true},
+		{`C:\Users\me\a.torrent`, "", true},
+		{"https://example.com/file.zip", "application/zip", false},
+		{"ftp://example.com/a.torrent", "", false},
+		{"https://example.com/torrent", "", false},
+	}
+	for _, tt := range tests {
+		if got := IsTorrent(tt.source, tt.contentType); got != tt.want {
+			t.Errorf("IsTorrent(%q, %q) = %v, want %v", tt.source, tt.contentType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,625 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	maxInflight      = 32 // Block requests outstanding per peer
+	maxPeerPieces    = 8  // Pieces fetched from one peer at a time
+	maxPeerRequests  = 256
+	maxBadPieces     = 3 // Pieces failing their hash check before the peer is dropped
+	snubTimeout      = 60 * time.Second
+	keepAliveEvery   = 2 * time.Minute
+	writeTimeout     = 30 * time.Second
+	metadataRetry    = 30 * time.Second
+	clientVersion    = "Surge"
+	metaMsgRequest   = 0
+	metaMsgData      = 1
+	metaMsgReject    = 2
+	maxUnknownPieces = 1 << 22 // Bounds HAVE indexes accepted before the info is known
+)
+
+var errBothComplete = errors.New("peer and we are both complete")
+
+// pieceWork is a piece being fetched from one peer
+type pieceWork struct {
+	index    int
+	data     []byte
+	asked    []bool // Blocks requested and not yet received
+	got      []bool
+	received int
+}
+
+func (w *pieceWork) blocks() int {
+	return len(w.got)
+}
+
+func (w *pieceWork) blockLen(b int) int {
+	return min(blockSize, len(w.data)-b*blockSize)
+}
+
+// blockRequest is a block a peer asked us for
+type blockRequest struct {
+	index         int
+	begin, length int64
+}
+
+// peerConn is a connection to one peer. Its state belongs to run's
+// goroutine, except has and counted which change under the session's lock.
+type peerConn struct {
+	s    *session
+	conn net.Conn
+	addr string
+	hs   *handshake
+
+	has     bitfield
+	counted bool // has is included in the picker's availability
+
+	amChoking      bool
+	amInterested   bool
+	peerChoking    bool
+	peerInterested bool
+	interestStale  bool
+
+	work      map[int]*pieceWork
+	inflight  int
+	requests  []blockRequest
+	badPieces int
+
+	metaID    byte // The peer's ut_metadata ID, 0 if it has none
+	metaAsked time.Time
+	lastData  time.Time
+	lastWrite time.Time
+	pokec     chan struct{}
+	havesMu   sync.Mutex
+	haves     []int // Pieces we finished, to announce
+}
+
+func newPeerConn(s *session, conn net.Conn, addr string, hs *handshake) *peerConn {
+	return &peerConn{
+		s:             s,
+		conn:          conn,
+		addr:          addr,
+		hs:            hs,
+		amChoking:     true,
+		peerChoking:   true,
+		interestStale: true,
+		work:          make(map[int]*pieceWork),
+		lastData:      time.Now(),
+		pokec:         make(chan struct{}, 1),
+	}
+}
+
+// poke makes the peer look for work again
+func (p *peerConn) poke() {
+	select {
+	case p.pokec <- struct{}{}:
+	default:
+	}
+}
+
+// notifyHave queues a HAVE for a piece we just finished
+func (p *peerConn) notifyHave(i int) {
+	p.havesMu.Lock()
+	p.haves = append(p.haves, i)
+	p.havesMu.Unlock()
+	p.poke()
+}
+
+func (p *peerConn) send(m *message) error {
+	_ = p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	p.lastWrite = time.Now()
+	return writeMessage(p.conn, m)
+}
+
+// run exchanges messages with the peer until the connection fails, the
+// peer misbehaves or ctx is done
+func (p *peerConn) run(ctx context.Context) error {
+	defer func() { _ = p.conn.Close() }()
+
+	type incoming struct {
+		m   *message
+		err error
+	}
+	in := make(chan incoming)
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		for {
+			m, err := readMessage(p.conn)
+			if err == nil && m != nil && m.id == msgPiece && p.s.progress != nil {
+				// Throttling the reads throttles the peer
+				err = p.s.progress.WaitBandwidth(ctx, len(m.payload))
+			}
+			select {
+			case in <- incoming{m, err}:
+			case <-quit:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := p.greet(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg := <-in:
+			if msg.err != nil {
+				return msg.err
+			}
+			if msg.m != nil {
+				if err := p.handle(msg.m); err != nil {
+					return err
+				}
+			}
+		case <-p.pokec:
+			p.interestStale = true
+		case <-ticker.C:
+			if err := p.tick(); err != nil {
+				return err
+			}
+		}
+		if err := p.update(); err != nil {
+			return err
+		}
+	}
+}
+
+// greet sends our bitfield and extension handshake
+func (p *peerConn) greet() error {
+	s := p.s
+	s.mu.Lock()
+	var have bitfield
+	if s.have != nil {
+		have = append(bitfield(nil), s.have...)
+	}
+	metaSize := len(s.infoBytes)
+	s.mu.Unlock()
+
+	if p.hs.supportsExtensions() {
+		hs := map[string]any{
+			"m": map[string]any{"ut_metadata": utMetadataID},
+			"v": clientVersion,
+		}
+		if s.port > 0 {
+			hs["p"] = s.port
+		}
+		if metaSize > 0 {
+			hs["metadata_size"] = metaSize
+		}
+		if err := p.send(extendedMessage(extHandshakeID, hs, nil)); err != nil {
+			return err
+		}
+	}
+	for _, b := range have {
+		if b != 0 {
+			return p.send(&message{id: msgBitfield, payload: have})
+		}
+	}
+	return nil
+}
+
+func (p *peerConn) handle(m *message) error {
+	s := p.s
+	switch m.id {
+	case msgChoke:
+		p.peerChoking = true
+		// Requests are dropped on choke; ask again after the unchoke
+		for _, w := range p.work {
+			for b := range w.asked {
+				w.asked[b] = false
+			}
+		}
+		p.inflight = 0
+	case msgUnchoke:
+		p.peerChoking = false
+	case msgInterested:
+		p.peerInterested = true
+		if p.amChoking && s.takeUploadSlot() {
+			p.amChoking = false
+			return p.send(&message{id: msgUnchoke})
+		}
+	case msgNotInterested:
+		p.peerInterested = false
+		p.requests = nil
+		if !p.amChoking {
+			p.amChoking = true
+			s.freeUploadSlot()
+			return p.send(&message{id: msgChoke})
+		}
+	case msgHave:
+		if len(m.payload) != 4 {
+			return errors.New("malformed have")
+		}
+		i := int(uint32(m.payload[0])<<24 | uint32(m.payload[1])<<16 | uint32(m.payload[2])<<8 | uint32(m.payload[3]))
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.info != nil {
+			if i >= s.info.NumPieces() {
+				return fmt.Errorf("have for piece %d out of range", i)
+			}
+		} else if i >= maxUnknownPieces {
+			return fmt.Errorf("have for piece %d out of range", i)
+		} else if i/8 >= len(p.has) {
+			p.has = resize(p.has, i+1)
+		}
+		if !p.has.has(i) {
+			p.has.set(i)
+			if p.counted {
+				s.picker.avail[i]++
+			}
+		}
+		p.interestStale = true
+	case msgBitfield:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if p.counted {
+			s.picker.removeAvail(p.has)
+		}
+		p.has = append(bitfield(nil), m.payload...)
+		if s.info != nil {
+			if len(p.has) != (s.info.NumPieces()+7)/8 {
+				return errors.New("bitfield of the wrong size")
+			}
+			p.has = resize(p.has, s.info.NumPieces())
+		}
+		if s.picker != nil {
+			s.picker.addAvail(p.has)
+			p.counted = true
+		}
+		p.interestStale = true
+	case msgRequest:
+		index, begin, length, err := parseRequest(m.payload)
+		if err != nil {
+			return err
+		}
+		if p.amChoking || len(p.requests) >= maxPeerRequests {
+			return nil
+		}
+		s.mu.Lock()
+		valid := s.have.has(index) && length > 0 && length <= maxRequestSize && begin+length <= s.info.PieceSize(index)
+		s.mu.Unlock()
+		if valid {
+			p.requests = append(p.requests, blockRequest{index, begin, length})
+		}
+	case msgCancel:
+		index, begin, length, err := parseRequest(m.payload)
+		if err != nil {
+			return err
+		}
+		for k, r := range p.requests {
+			if r == (blockRequest{index, begin, length}) {
+				p.requests = append(p.requests[:k], p.requests[k+1:]...)
+				break
+			}
+		}
+	case msgPiece:
+		index, begin, block, err := parsePiece(m.payload)
+		if err != nil {
+			return err
+		}
+		return p.receive(index, begin, block)
+	case msgExtended:
+		if len(m.payload) == 0 {
+			return errors.New("malformed extended message")
+		}
+		return p.handleExtended(m.payload[0], m.payload[1:])
+	}
+	return nil
+}
+
+// receive stores a block and checks the piece once it is whole
+func (p *peerConn) receive(index int, begin int64, block []byte) error {
+	w := p.work[index]
+	if w == nil || begin%blockSize != 0 {
+		return nil // Cancelled or unasked
+	}
+	b := int(begin / blockSize)
+	if b >= w.blocks() || w.got[b] || len(block) != w.blockLen(b) {
+		return nil
+	}
+	copy(w.data[begin:], block)
+	w.got[b] = true
+	if w.asked[b] {
+		w.asked[b] = false
+		p.inflight--
+	}
+	w.received++
+	p.lastData = time.Now()
+	if w.received < w.blocks() {
+		return nil
+	}
+
+	delete(p.work, index)
+	ok, err := p.s.verifyPiece(index, w.data)
+	p.s.releasePiece(index, !ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		p.badPieces++
+		if p.badPieces >= maxBadPieces {
+			return fmt.Errorf("%d pieces failed verification", p.badPieces)
+		}
+	}
+	return nil
+}
+
+func (p *peerConn) handleExtended(id byte, payload []byte) error {
+	s := p.s
+	v, n, err := decodePrefix(payload)
+	if err != nil {
+		return err
+	}
+	dict, _ := v.(map[string]any)
+
+	switch id {
+	case extHandshakeID:
+		if metaID := dictInt(dictDict(dict, "m"), "ut_metadata"); metaID > 0 && metaID < 256 {
+			p.metaID = byte(metaID)
+		}
+		if size := dictInt(dict, "metadata_size"); size > 0 {
+			s.setMetadataSize(int(size))
+		}
+	case utMetadataID:
+		piece := int(dictInt(dict, "piece"))
+		switch dictInt(dict, "msg_type") {
+		case metaMsgRequest:
+			if p.metaID == 0 {
+				return nil
+			}
+			s.mu.Lock()
+			raw := s.infoBytes
+			s.mu.Unlock()
+			start := piece * metadataPieceSize
+			if raw == nil || s.isPrivate() || piece < 0 || start >= len(raw) {
+				return p.send(extendedMessage(p.metaID, map[string]any{"msg_type": metaMsgReject, "piece": piece}, nil))
+			}
+			data := raw[start:min(start+metadataPieceSize, len(raw))]
+			return p.send(extendedMessage(p.metaID, map[string]any{"msg_type": metaMsgData, "piece": piece, "total_size": len(raw)}, data))
+		case metaMsgData:
+			s.metadataPiece(piece, payload[n:])
+		case metaMsgReject:
+			p.metaID = 0 // Don't ask this peer again
+		}
+	}
+	return nil
+}
+
+// tick runs the once a second checks
+func (p *peerConn) tick() error {
+	if p.inflight > 0 && time.Since(p.lastData) > snubTimeout {
+		return errors.New("peer stopped sending")
+	}
+	if time.Since(p.lastWrite) > keepAliveEvery {
+		_ = p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		p.lastWrite = time.Now()
+		if err := writeKeepAlive(p.conn); err != nil {
+			return err
+		}
+	}
+	// A peer that stayed interested gets a slot once one frees up
+	if p.peerInterested && p.amChoking && p.s.takeUploadSlot() {
+		p.amChoking = false
+		if err := p.send(&message{id: msgUnchoke}); err != nil {
+			return err
+		}
+	}
+
+	s := p.s
+	s.mu.Lock()
+	done := s.picker != nil && s.picker.left == 0
+	n := 0
+	if s.info != nil {
+		n = s.info.NumPieces()
+	}
+	s.mu.Unlock()
+	if done && n > 0 && p.hasAll(n) {
+		return errBothComplete
+	}
+	return nil
+}
+
+func (p *peerConn) hasAll(n int) bool {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		if !p.has.has(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// update sends what changed since the last message: HAVEs, interest,
+// block requests, metadata requests and the blocks the peer asked for
+func (p *peerConn) update() error {
+	s := p.s
+
+	p.havesMu.Lock()
+	haves := p.haves
+	p.haves = nil
+	p.havesMu.Unlock()
+	for _, i := range haves {
+		// Someone else finished a piece we were fetching too (end game)
+		if w := p.work[i]; w != nil {
+			for b, asked := range w.asked {
+				if asked {
+					length := int64(w.blockLen(b))
+					if err := p.send(requestMessage(msgCancel, i, int64(b)*blockSize, length)); err != nil {
+						return err
+					}
+					p.inflight--
+				}
+			}
+			delete(p.work, i)
+			s.releasePiece(i, false)
+		}
+		if err := p.send(haveMessage(i)); err != nil {
+			return err
+		}
+	}
+
+	if p.interestStale {
+		p.interestStale = false
+		interested := p.wantsSomething()
+		if interested != p.amInterested {
+			p.amInterested = interested
+			id := byte(msgNotInterested)
+			if interested {
+				id = msgInterested
+			}
+			if err := p.send(&message{id: id}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := p.requestBlocks(); err != nil {
+		return err
+	}
+	if err := p.requestMetadata(); err != nil {
+		return err
+	}
+	return p.serve()
+}
+
+// wantsSomething reports whether the peer has a piece we lack
+func (p *peerConn) wantsSomething() bool {
+	s := p.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.picker == nil {
+		return false
+	}
+	for i, done := range s.picker.done {
+		if !done && p.has.has(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestBlocks keeps the request pipeline full
+func (p *peerConn) requestBlocks() error {
+	if p.peerChoking || !p.amInterested {
+		return nil
+	}
+	if p.inflight == 0 {
+		// Nothing was outstanding, so the silence so far wasn't the peer's fault
+		p.lastData = time.Now()
+	}
+	s := p.s
+	for p.inflight < maxInflight {
+		w, b := p.nextBlock()
+		if w == nil {
+			if len(p.work) >= maxPeerPieces {
+				return nil
+			}
+			i, ok := s.pick(p.hasPiece, func(i int) bool { return p.work[i] != nil })
+			if !ok {
+				return nil
+			}
+			size := s.info.PieceSize(i)
+			blocks := int((size + blockSize - 1) / blockSize)
+			w = &pieceWork{index: i, data: make([]byte, size), asked: make([]bool, blocks), got: make([]bool, blocks)}
+			p.work[i] = w
+			b = 0
+		}
+		w.asked[b] = true
+		p.inflight++
+		if err := p.send(requestMessage(msgRequest, w.index, int64(b)*blockSize, int64(w.blockLen(b)))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextBlock finds a block of a piece in progress that isn't asked for yet
+func (p *peerConn) nextBlock() (*pieceWork, int) {
+	for _, w := range p.work {
+		for b := range w.got {
+			if !w.got[b] && !w.asked[b] {
+				return w, b
+			}
+		}
+	}
+	return nil, 0
+}
+
+func (p *peerConn) hasPiece(i int) bool {
+	// Called by the picker with the session's lock held
+	return p.has.has(i)
+}
+
+// requestMetadata asks for the metadata pieces still missing
+func (p *peerConn) requestMetadata() error {
+	if p.metaID == 0 || time.Since(p.metaAsked) < metadataRetry {
+		return nil
+	}
+	missing := p.s.missingMetadata()
+	if len(missing) == 0 {
+		return nil
+	}
+	p.metaAsked = time.Now()
+	for _, piece := range missing {
+		if err := p.send(extendedMessage(p.metaID, map[string]any{"msg_type": metaMsgRequest, "piece": piece}, nil)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serve answers one queued block request per round so uploads don't
+// starve the rest of the loop
+func (p *peerConn) serve() error {
+	if len(p.requests) == 0 || p.amChoking {
+		return nil
+	}
+	r := p.requests[0]
+	p.requests = p.requests[1:]
+
+	s := p.s
+	s.mu.Lock()
+	store := s.store
+	s.mu.Unlock()
+	if store == nil {
+		return nil
+	}
+	block := make([]byte, r.length)
+	if _, err := store.ReadAt(block, int64(r.index)*s.info.PieceLength+r.begin); err != nil {
+		return nil // Being moved into place; the peer will ask again
+	}
+	if err := p.send(pieceMessage(r.index, r.begin, block)); err != nil {
+		return err
+	}
+	s.uploaded.Add(r.length)
+	if len(p.requests) > 0 {
+		p.poke()
+	}
+	return nil
+}
+
+// resize returns b holding n pieces, dropping the bits past the end
+func resize(b bitfield, n int) bitfield {
+	out := newBitfield(n)
+	copy(out, b)
+	if n%8 != 0 && len(out) > 0 {
+		out[len(out)-1] &= ^byte(0xff >> (n % 8))
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+package torrent
+
+import "math/rand/v2"
+
+// picker decides which piece each peer or web seed fetches next. It is
+// guarded by the session's lock.
+type picker struct {
+	sequential bool
+	done       []bool
+	active     []int // How many peers or web seeds are fetching each piece
+	avail      []int // How many connected peers have each piece
+	left       int   // Pieces not done
+	pending    int   // Pieces not done that nobody is fetching
+	first      int   // Every piece before this one is done
+}
+
+func newPicker(n int, sequential bool) *picker {
+	return &picker{
+		sequential: sequential,
+		done:       make([]bool, n),
+		active:     make([]int, n),
+		avail:      make([]int, n),
+		left:       n,
+		pending:    n,
+	}
+}
+
+// pick returns a piece to fetch from a source that has the pieces has
+// reports. Pieces nobody is fetching come first: the lowest in sequential
+// mode, otherwise the one the fewest peers have. Once every missing piece is
+// being fetched, pieces are shared with the sources already on them (end
+// game) except those busy reports the caller fetching itself.
+func (p *picker) pick(has func(int) bool, busy func(int) bool) (int, bool) {
+	for p.first < len(p.done) && p.done[p.first] {
+		p.first++
+	}
+	n := len(p.done)
+
+	if p.pending > 0 {
+		best, bestAvail := -1, 0
+		// Equally rare pieces are spread over the peers by starting anywhere
+		offset := 0
+		if !p.sequential && n > p.first {
+			offset = rand.IntN(n - p.first)
+		}
+		for k := p.first; k < n; k++ {
+			i := k
+			if !p.sequential {
+				i = p.first + (k-p.first+offset)%(n-p.first)
+			}
+			if p.done[i] || p.active[i] > 0 || !has(i) {
+				continue
+			}
+			if p.sequential {
+				return i, true
+			}
+			if best < 0 || p.avail[i] < bestAvail {
+				best, bestAvail = i, p.avail[i]
+			}
+		}
+		// Without a piece here the source lacks everything nobody else is
+		// fetching, which isn't end game yet
+		return best, best >= 0
+	}
+
+	best := -1
+	for i := p.first; i < n; i++ {
+		if p.done[i] || !has(i) || busy(i) {
+			continue
+		}
+		if best < 0 || p.active[i] < p.active[best] {
+			best = i
+		}
+	}
+	return best, best >= 0
+}
+
+// start records that a source began fetching piece i
+func (p *picker) start(i int) {
+	if p.active[i] == 0 && !p.done[i] {
+		p.pending--
+	}
+	p.active[i]++
+}
+
+// release records that a source stopped fetching piece i
+func (p *picker) release(i int) {
+	p.active[i]--
+	if p.active[i] == 0 && !p.done[i] {
+		p.pending++
+	}
+}
+
+// finish marks piece i done, reporting false if it already was
+func (p *picker) finish(i int) bool {
+	if p.done[i] {
+		return false
+	}
+	p.done[i] = true
+	p.left--
+	if p.active[i] == 0 {
+		p.pending--
+	}
+	return true
+}
+
+// addAvail counts a peer's pieces as available
+func (p *picker) addAvail(b bitfield) {
+	for i := range p.avail {
+		if b.has(i) {
+			p.avail[i]++
+		}
+	}
+}
+
+// removeAvail forgets the pieces of a peer that went away
+func (p *picker) removeAvail(b bitfield) {
+	for i := range p.avail {
+		if b.has(i) {
+			p.avail[i]--
+		}
+	}
+}
+
+// bitfield is a set of piece indexes, the highest bit of the first byte
+// being piece 0
+type bitfield []byte
+
+func newBitfield(n int) bitfield {
+	return make(bitfield, (n+7)/8)
+}
+
+func (b bitfield) has(i int) bool {
+	return i >= 0 && i/8 < len(b) && b[i/8]&(0x80>>(i%8)) != 0
+}
+
+func (b bitfield) set(i int) {
+	if i >= 0 && i/8 < len(b) {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+}
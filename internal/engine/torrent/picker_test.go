@@ -0,0 +1,98 @@
+package torrent
+
+import "testing"
+
+func all(int) bool  { return true }
+func none(int) bool { return false }
+
+func TestPicker_Sequential(t *testing.T) {
+	p := newPicker(5, true)
+	p.finish(0)
+	for _, want := range []int{1, 2, 3, 4} {
+		i, ok := p.pick(all, none)
+		if !ok || i != want {
+			t.Fatalf("pick = %d, %v, want %d", i, ok, want)
+		}
+		p.start(i)
+	}
+	// Everything is being fetched; end game shares the least busy piece
+	i, ok := p.pick(all, func(i int) bool { return i == 1 })
+	if !ok || i == 1 || i == 0 {
+		t.Errorf("end game pick = %d, %v", i, ok)
+	}
+}
+
+func TestPicker_RarestFirst(t *testing.T) {
+	p := newPicker(4, false)
+	common := bitfield{0xf0}
+	p.addAvail(common)
+	p.addAvail(common)
+	p.addAvail(bitfield{0xd0}) // Pieces 0, 1 and 3; piece 2 is the rarest
+
+	i, ok := p.pick(all, none)
+	if !ok || i != 2 {
+		t.Fatalf("pick = %d, want the rarest piece 2", i)
+	}
+	p.start(i)
+
+	// A source without the pieces nobody fetches gets nothing before end game
+	if i, ok := p.pick(func(i int) bool { return i == 2 }, none); ok {
+		t.Errorf("pick = %d, want nothing outside end game", i)
+	}
+
+	p.removeAvail(common)
+	p.removeAvail(common)
+	if p.avail[2] != 0 || p.avail[0] != 1 {
+		t.Errorf("avail = %v", p.avail)
+	}
+}
+
+func TestPicker_FinishAndRelease(t *testing.T) {
+	p := newPicker(3, true)
+	p.start(0)
+	p.start(0) // End game: two sources on one piece
+	if p.pending != 2 {
+		t.Fatalf("pending = %d, want 2", p.pending)
+	}
+	if !p.finish(0) || p.finish(0) {
+		t.Error("finish should report only the first completion")
+	}
+	p.release(0)
+	p.release(0)
+	if p.pending != 2 || p.left != 2 {
+		t.Errorf("pending = %d, left = %d, want 2 and 2", p.pending, p.left)
+	}
+
+	// A released piece that isn't done goes back to the pending pool
+	p.start(1)
+	p.release(1)
+	if i, ok := p.pick(all, none); !ok || i != 1 {
+		t.Errorf("pick = %d, %v, want the released piece 1", i, ok)
+	}
+	p.finish(1)
+	p.finish(2)
+	if _, ok := p.pick(all, none); ok || p.left != 0 {
+		t.Errorf("a complete torrent has nothing to pick (left = %d)", p.left)
+	}
+}
+
+func TestBitfield(t *testing.T) {
+	b := newBitfield(10)
+	if len(b) != 2 {
+		t.Fatalf("len = %d, want 2", len(b))
+	}
+	b.set(0)
+	b.set(9)
+	b.set(16) // Out of range, ignored
+	if !b.has(0) || !b.has(9) || b.has(1) || b.has(16) || b.has(-1) {
+		t.Errorf("bitfield = %08b", b)
+	}
+	if b[0] != 0x80 || b[1] != 0x40 {
+		t.Errorf("bits = %08b, want the highest bit first", b)
+	}
+
+	r := resize(bitfield{0xff, 0xff}, 10)
+	if r[1] != 0xc0 {
+		t.Errorf("resize kept spare bits: %08b", r)
+	}
+}
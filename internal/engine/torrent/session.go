@@ -0,0 +1,878 @@
+package torrent
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/surge-downloader/surge/internal/engine/concurrent"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+const (
+	peerIDPrefix        = "-SG0100-"
+	uploadSlots         = 8 // Peers unchoked at once
+	dialTimeout         = 10 * time.Second
+	handshakeTimeout    = 10 * time.Second
+	minAnnounceInterval = time.Minute
+	maxAnnounceInterval = 30 * time.Minute
+	maxMetadataSize     = 16 * types.MB
+)
+
+// sessions are the torrents being downloaded or seeded, by info hash
+var (
+	sessionsMu sync.Mutex
+	sessions   = make(map[[20]byte]*session)
+)
+
+// session is one torrent being downloaded and then seeded: its peers,
+// trackers, DHT lookups and web seeds
+type session struct {
+	id       string // Download ID
+	meta     *MetaInfo
+	peerID   [20]byte
+	runtime  *types.RuntimeConfig
+	progress *types.ProgressState
+	client   *http.Client
+	port     int // Where incoming peers connect, 0 if nowhere
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+
+	uploaded   atomic.Int64
+	downloaded atomic.Int64
+
+	gotInfo      chan struct{} // Closed once the info dictionary is known
+	complete     chan struct{} // Closed once every piece is verified
+	completeOnce sync.Once
+	errc         chan error    // Storage failures that end the download
+	wake         chan struct{} // New addresses for the dialer
+
+	writeMu sync.Mutex // Orders piece writes against swapping the storage
+
+	mu        sync.Mutex
+	info      *Info
+	infoBytes []byte
+	metaSize  int // ut_metadata transfer in progress
+	metaBuf   []byte
+	metaGot   []bool
+	store     *storage
+	have      bitfield
+	picker    *picker
+	seeding   bool
+	peers     map[*peerConn]struct{}
+	dialing   int
+	known     map[string]bool
+	queue     []string
+	unchoked  int
+}
+
+// newSession registers a session for meta. Only one session per torrent
+// may run at a time.
+func newSession(id string, meta *MetaInfo, runtime *types.RuntimeConfig, progress *types.ProgressState) (*session, error) {
+	s := makeSession(id, meta, runtime, progress)
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if sessions[meta.InfoHash] != nil {
+		return nil, fmt.Errorf("torrent %s is already being downloaded or seeded", hex.EncodeToString(meta.InfoHash[:]))
+	}
+	sessions[meta.InfoHash] = s
+	return s, nil
+}
+
+func makeSession(id string, meta *MetaInfo, runtime *types.RuntimeConfig, progress *types.ProgressState) *session {
+	s := &session{
+		id:       id,
+		meta:     meta,
+		runtime:  runtime,
+		progress: progress,
+		client:   concurrent.NewHTTPClient(runtime, webSeedWorkers),
+		gotInfo:  make(chan struct{}),
+		complete: make(chan struct{}),
+		errc:     make(chan error, 1),
+		wake:     make(chan struct{}, 1),
+		peers:    make(map[*peerConn]struct{}),
+		known:    make(map[string]bool),
+	}
+	copy(s.peerID[:], peerIDPrefix)
+	_, _ = rand.Read(s.peerID[len(peerIDPrefix):])
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	if meta.Info != nil {
+		s.info, s.infoBytes = meta.Info, meta.infoBytes
+		close(s.gotInfo)
+	}
+	return s
+}
+
+// Stop ends the session of download id, if it is downloading or seeding
+func Stop(id string) {
+	sessionsMu.Lock()
+	var found []*session
+	for _, s := range sessions {
+		if s.id == id {
+			found = append(found, s)
+		}
+	}
+	sessionsMu.Unlock()
+	for _, s := range found {
+		s.stop()
+	}
+}
+
+// StopAll ends every torrent session, telling the trackers we're gone
+func StopAll() {
+	sessionsMu.Lock()
+	var all []*session
+	for _, s := range sessions {
+		all = append(all, s)
+	}
+	sessionsMu.Unlock()
+	for _, s := range all {
+		s.stop()
+	}
+}
+
+func lookupSession(infoHash [20]byte) *session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	return sessions[infoHash]
+}
+
+// proxied reports whether a proxy is configured. UDP can't go through it, so
+// the DHT and UDP trackers are skipped rather than leak around it.
+func (s *session) proxied() bool {
+	return s.runtime != nil && s.runtime.ProxyURL != ""
+}
+
+// start looks for peers through the trackers, the DHT and the addresses in
+// a magnet link
+func (s *session) start() {
+	port := 0
+	if s.runtime != nil {
+		port = s.runtime.TorrentPort
+	}
+	s.port = listen(port)
+	s.addPeers(s.meta.Peers)
+
+	s.wg.Add(1)
+	go s.dialLoop()
+	for _, tracker := range s.meta.Trackers {
+		if strings.HasPrefix(tracker, "udp:") && s.proxied() {
+			continue
+		}
+		s.wg.Add(1)
+		go s.trackerLoop(tracker)
+	}
+	if s.runtime != nil && s.runtime.EnableDHT && !s.proxied() {
+		s.wg.Add(1)
+		go s.dhtLoop()
+	}
+}
+
+// begin starts fetching pieces into store once the info is known. done
+// lists the pieces a paused download already has.
+func (s *session) begin(store *storage, done []bool) {
+	s.mu.Lock()
+	n := s.info.NumPieces()
+	s.store = store
+	s.have = newBitfield(n)
+	s.picker = newPicker(n, s.runtime != nil && s.runtime.SequentialDownload)
+	for i, d := range done {
+		if d {
+			s.picker.finish(i)
+			s.have.set(i)
+		}
+	}
+	// Peers that connected before the info arrived sent bitfields of unknown size
+	for p := range s.peers {
+		p.has = resize(p.has, n)
+		s.picker.addAvail(p.has)
+		p.counted = true
+	}
+	complete := s.picker.left == 0
+	s.mu.Unlock()
+
+	if complete {
+		s.completeOnce.Do(func() { close(s.complete) })
+	}
+	for _, seed := range s.meta.WebSeeds {
+		s.startWebSeed(seed)
+	}
+	s.wakePeers()
+}
+
+// stop disconnects every peer, waits for the session's goroutines and
+// closes the files
+func (s *session) stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		s.mu.Lock()
+		for p := range s.peers {
+			_ = p.conn.Close()
+		}
+		s.mu.Unlock()
+		s.wg.Wait()
+
+		sessionsMu.Lock()
+		if sessions[s.meta.InfoHash] == s {
+			delete(sessions, s.meta.InfoHash)
+		}
+		sessionsMu.Unlock()
+
+		s.mu.Lock()
+		store := s.store
+		s.store = nil
+		s.mu.Unlock()
+		if store != nil {
+			_ = store.Close()
+		}
+		s.announceStopped()
+	})
+}
+
+func (s *session) fail(err error) {
+	select {
+	case s.errc <- err:
+	default:
+	}
+}
+
+func (s *session) isPrivate() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.info != nil && s.info.Private
+}
+
+// left returns how many bytes are still missing
+func (s *session) left() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.picker == nil {
+		// Unknown, but a tracker must not take us for a seeder
+		return blockSize
+	}
+	var left int64
+	for i, done := range s.picker.done {
+		if !done {
+			left += s.info.PieceSize(i)
+		}
+	}
+	return left
+}
+
+// Peer discovery
+
+func (s *session) addPeers(addrs []string) {
+	s.mu.Lock()
+	for _, addr := range addrs {
+		if !s.known[addr] {
+			s.known[addr] = true
+			s.queue = append(s.queue, addr)
+		}
+	}
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *session) trackerLoop(tracker string) {
+	defer s.wg.Done()
+	event := "started"
+	complete := s.complete
+	failures := 0
+	for {
+		req := announceRequest{
+			infoHash:   s.meta.InfoHash,
+			peerID:     s.peerID,
+			port:       s.port,
+			uploaded:   s.uploaded.Load(),
+			downloaded: s.downloaded.Load(),
+			left:       s.left(),
+			event:      event,
+		}
+		ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+		resp, err := announce(ctx, s.client, tracker, req)
+		cancel()
+
+		var wait time.Duration
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+			failures++
+			wait = min(time.Duration(failures)*minAnnounceInterval, maxAnnounceInterval)
+			utils.Debug("Torrent %s: tracker %s failed: %v", s.id, tracker, err)
+		} else {
+			failures = 0
+			event = ""
+			utils.Debug("Torrent %s: tracker %s returned %d peers", s.id, tracker, len(resp.peers))
+			s.addPeers(resp.peers)
+			wait = min(max(resp.interval, minAnnounceInterval), maxAnnounceInterval)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		case <-complete:
+			timer.Stop()
+			complete = nil
+			event = "completed"
+		}
+	}
+}
+
+// announceStopped tells the trackers we left, without waiting for them
+func (s *session) announceStopped() {
+	req := announceRequest{
+		infoHash:   s.meta.InfoHash,
+		peerID:     s.peerID,
+		port:       s.port,
+		uploaded:   s.uploaded.Load(),
+		downloaded: s.downloaded.Load(),
+		left:       s.left(),
+		event:      "stopped",
+	}
+	for _, tracker := range s.meta.Trackers {
+		if strings.HasPrefix(tracker, "udp:") && s.proxied() {
+			continue
+		}
+		go func(tracker string) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, _ = announce(ctx, s.client, tracker, req)
+		}(tracker)
+	}
+}
+
+func (s *session) dhtLoop() {
+	defer s.wg.Done()
+	d, err := newDHT()
+	if err != nil {
+		utils.Debug("Torrent %s: DHT unavailable: %v", s.id, err)
+		return
+	}
+	defer d.close()
+	for !s.isPrivate() {
+		ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+		d.getPeers(ctx, s.meta.InfoHash, s.port, s.addPeers)
+		cancel()
+
+		timer := time.NewTimer(dhtInterval)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// dialLoop connects to queued addresses while there is room for more peers
+func (s *session) dialLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		for len(s.queue) > 0 && len(s.peers)+s.dialing < s.runtime.GetMaxPeers() {
+			addr := s.queue[0]
+			s.queue = s.queue[1:]
+			s.dialing++
+			s.wg.Add(1)
+			go s.dial(addr)
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *session) dial(addr string) {
+	defer s.wg.Done()
+	conn, err := s.dialPeer(addr)
+	s.mu.Lock()
+	s.dialing--
+	if err != nil {
+		// A later announce may hand it out again
+		delete(s.known, addr)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		utils.Debug("Torrent %s: dialing %s: %v", s.id, addr, err)
+		return
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	err = writeHandshake(conn, s.meta.InfoHash, s.peerID)
+	var hs *handshake
+	if err == nil {
+		hs, err = readHandshake(conn)
+	}
+	if err == nil && hs.infoHash != s.meta.InfoHash {
+		err = errors.New("peer has a different torrent")
+	}
+	if err != nil {
+		_ = conn.Close()
+		s.forget(addr)
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	s.runPeer(conn, addr, hs)
+}
+
+// dialPeer connects to addr, through the proxy when it is a SOCKS5 one
+func (s *session) dialPeer(addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, dialTimeout)
+	defer cancel()
+	if s.proxied() {
+		if u, err := url.Parse(s.runtime.ProxyURL); err == nil && strings.HasPrefix(u.Scheme, "socks5") {
+			var auth *proxy.Auth
+			if u.User != nil {
+				password, _ := u.User.Password()
+				auth = &proxy.Auth{User: u.User.Username(), Password: password}
+			}
+			dialer, err := proxy.SOCKS5("tcp", u.Host, auth, &net.Dialer{Timeout: dialTimeout})
+			if err != nil {
+				return nil, err
+			}
+			if cd, ok := dialer.(proxy.ContextDialer); ok {
+				return cd.DialContext(ctx, "tcp", addr)
+			}
+			return dialer.Dial("tcp", addr)
+		}
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// accept takes an incoming connection whose handshake named this torrent
+func (s *session) accept(conn net.Conn, hs *handshake) {
+	s.mu.Lock()
+	if s.ctx.Err() != nil || len(s.peers) >= s.runtime.GetMaxPeers() {
+		s.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+
+	if err := writeHandshake(conn, s.meta.InfoHash, s.peerID); err != nil {
+		_ = conn.Close()
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	s.runPeer(conn, conn.RemoteAddr().String(), hs)
+}
+
+func (s *session) forget(addr string) {
+	s.mu.Lock()
+	delete(s.known, addr)
+	s.mu.Unlock()
+}
+
+// runPeer talks to a connected peer until it or the session goes away
+func (s *session) runPeer(conn net.Conn, addr string, hs *handshake) {
+	if hs.peerID == s.peerID {
+		// Ourselves, through a tracker or the DHT
+		_ = conn.Close()
+		return
+	}
+	p := newPeerConn(s, conn, addr, hs)
+
+	s.mu.Lock()
+	if s.ctx.Err() != nil {
+		s.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	s.peers[p] = struct{}{}
+	s.known[addr] = true
+	s.mu.Unlock()
+	if s.progress != nil {
+		s.progress.ActiveWorkers.Add(1)
+	}
+
+	err := p.run(s.ctx)
+	utils.Debug("Torrent %s: peer %s disconnected: %v", s.id, addr, err)
+
+	if s.progress != nil {
+		s.progress.ActiveWorkers.Add(-1)
+	}
+	s.mu.Lock()
+	delete(s.peers, p)
+	delete(s.known, addr)
+	if p.counted {
+		s.picker.removeAvail(p.has)
+	}
+	if !p.amChoking {
+		s.unchoked--
+	}
+	s.mu.Unlock()
+	for i := range p.work {
+		s.releasePiece(i, false)
+	}
+}
+
+func (s *session) wakePeers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p := range s.peers {
+		p.poke()
+	}
+}
+
+// takeUploadSlot reserves one of the upload slots for a peer we unchoke
+func (s *session) takeUploadSlot() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.unchoked >= uploadSlots {
+		return false
+	}
+	s.unchoked++
+	return true
+}
+
+func (s *session) freeUploadSlot() {
+	s.mu.Lock()
+	s.unchoked--
+	s.mu.Unlock()
+}
+
+// Pieces
+
+// pick hands out a piece to a peer or web seed
+func (s *session) pick(has func(int) bool, busy func(int) bool) (int, bool) {
+	s.mu.Lock()
+	if s.picker == nil || s.store == nil {
+		s.mu.Unlock()
+		return 0, false
+	}
+	i, ok := s.picker.pick(has, busy)
+	if ok {
+		s.picker.start(i)
+	}
+	s.mu.Unlock()
+
+	if ok && s.progress != nil {
+		s.progress.UpdateChunkStatus(int64(i)*s.info.PieceLength, s.info.PieceSize(i), types.ChunkDownloading)
+	}
+	return i, ok
+}
+
+// releasePiece gives a piece back after its fetch ended. A piece that failed
+// its hash check shows as failed until someone fetches it again.
+func (s *session) releasePiece(i int, failed bool) {
+	s.mu.Lock()
+	s.picker.release(i)
+	idle := !s.picker.done[i] && s.picker.active[i] == 0
+	s.mu.Unlock()
+
+	if s.progress != nil && (idle || failed) {
+		status := types.ChunkPending
+		if failed {
+			status = types.ChunkFailed
+		}
+		s.progress.UpdateChunkStatus(int64(i)*s.info.PieceLength, s.info.PieceSize(i), status)
+	}
+}
+
+// verifyPiece checks data against the hash of piece i and stores it
+func (s *session) verifyPiece(i int, data []byte) (bool, error) {
+	if sha1.Sum(data) != s.info.Pieces[i] {
+		return false, nil
+	}
+	return true, s.savePiece(i, data)
+}
+
+// savePiece writes a verified piece and tells every peer we have it
+func (s *session) savePiece(i int, data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	store := s.store
+	if s.picker.done[i] || store == nil {
+		// Another peer got it first in end game
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	offset := int64(i) * s.info.PieceLength
+	if _, err := store.WriteAt(data, offset); err != nil {
+		err = fmt.Errorf("write error: %w", err)
+		s.fail(err)
+		return err
+	}
+
+	s.mu.Lock()
+	s.picker.finish(i)
+	s.have.set(i)
+	complete := s.picker.left == 0
+	peers := make([]*peerConn, 0, len(s.peers))
+	for p := range s.peers {
+		peers = append(peers, p)
+	}
+	s.mu.Unlock()
+
+	n := int64(len(data))
+	s.downloaded.Add(n)
+	if s.progress != nil {
+		s.progress.UpdateChunkStatus(offset, n, types.ChunkCompleted)
+		s.progress.Downloaded.Add(n)
+	}
+	for _, p := range peers {
+		p.notifyHave(i)
+	}
+	if complete {
+		s.completeOnce.Do(func() { close(s.complete) })
+	}
+	return nil
+}
+
+// missing returns the byte ranges of the pieces not done yet, merged where
+// they touch, for the paused state
+func (s *session) missing() []types.Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tasks []types.Task
+	for i, done := range s.picker.done {
+		if done {
+			continue
+		}
+		offset, size := int64(i)*s.info.PieceLength, s.info.PieceSize(i)
+		if n := len(tasks); n > 0 && tasks[n-1].Offset+tasks[n-1].Length == offset {
+			tasks[n-1].Length += size
+		} else {
+			tasks = append(tasks, types.Task{Offset: offset, Length: size})
+		}
+	}
+	return tasks
+}
+
+// moveTo closes the finished data at workingPath, renames it to destPath
+// and reopens it there read-only for seeding
+func (s *session) moveTo(workingPath, destPath string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	store := s.store
+	s.store = nil
+	s.mu.Unlock()
+	if store != nil {
+		if err := store.Sync(); err != nil {
+			return fmt.Errorf("failed to sync file: %w", err)
+		}
+		_ = store.Close()
+	}
+	if err := os.Rename(workingPath, destPath); err != nil {
+		return fmt.Errorf("failed to rename completed file: %w", err)
+	}
+
+	seedStore, err := openStorage(destPath, s.info, false)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.store = seedStore
+	s.seeding = true
+	s.mu.Unlock()
+	return nil
+}
+
+// seed serves the finished torrent until the upload reaches SeedRatio times
+// its size or SeedTime has passed, then ends the session. Without either
+// limit the torrent isn't seeded at all.
+func (s *session) seed() {
+	var ratio float64
+	var limit time.Duration
+	if s.runtime != nil {
+		ratio, limit = s.runtime.SeedRatio, s.runtime.SeedTime
+	}
+	if ratio <= 0 && limit <= 0 {
+		s.stop()
+		return
+	}
+	utils.Debug("Torrent %s: seeding (ratio %.2f, time %v)", s.id, ratio, limit)
+
+	size := float64(s.info.TotalLength())
+	started := time.Now()
+	go func() {
+		defer s.stop()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if ratio > 0 && float64(s.uploaded.Load()) >= ratio*size {
+				utils.Debug("Torrent %s: seed ratio reached", s.id)
+				return
+			}
+			if limit > 0 && time.Since(started) >= limit {
+				utils.Debug("Torrent %s: seed time reached", s.id)
+				return
+			}
+		}
+	}()
+}
+
+// Metadata exchange (BEP 9)
+
+// setMetadataSize prepares to collect an info dictionary of size bytes
+func (s *session) setMetadataSize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.info != nil || s.metaSize != 0 || size <= 0 || size > maxMetadataSize {
+		return
+	}
+	s.metaSize = size
+	s.metaBuf = make([]byte, size)
+	s.metaGot = make([]bool, (size+metadataPieceSize-1)/metadataPieceSize)
+}
+
+// missingMetadata returns the metadata pieces not received yet
+func (s *session) missingMetadata() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var missing []int
+	if s.info == nil {
+		for i, got := range s.metaGot {
+			if !got {
+				missing = append(missing, i)
+			}
+		}
+	}
+	return missing
+}
+
+// metadataPiece stores one piece of the info dictionary. Once all are in
+// and their hash matches the info hash, the download can start.
+func (s *session) metadataPiece(piece int, data []byte) {
+	s.mu.Lock()
+	if s.info != nil || piece < 0 || piece >= len(s.metaGot) {
+		s.mu.Unlock()
+		return
+	}
+	start := piece * metadataPieceSize
+	if len(data) != min(metadataPieceSize, s.metaSize-start) {
+		s.mu.Unlock()
+		return
+	}
+	copy(s.metaBuf[start:], data)
+	s.metaGot[piece] = true
+	for _, got := range s.metaGot {
+		if !got {
+			s.mu.Unlock()
+			return
+		}
+	}
+	raw := s.metaBuf
+	s.metaSize, s.metaBuf, s.metaGot = 0, nil, nil
+	s.mu.Unlock()
+
+	if sha1.Sum(raw) != s.meta.InfoHash {
+		utils.Debug("Torrent %s: metadata from peers doesn't match the info hash", s.id)
+		return
+	}
+	info, err := parseInfo(raw)
+	if err != nil {
+		utils.Debug("Torrent %s: %v", s.id, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.info == nil {
+		s.info, s.infoBytes = info, raw
+		close(s.gotInfo)
+	}
+}
+
+// Incoming connections are accepted on one port for every torrent
+
+var (
+	listenMu   sync.Mutex
+	listenPort int
+)
+
+// listen starts the shared listener on port, or any port if that one is
+// taken, and returns the port it got. 0 means incoming peers can't connect.
+func listen(port int) int {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	if listenPort != 0 {
+		return listenPort
+	}
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil && port != 0 {
+		utils.Debug("Torrent: port %d unavailable (%v), listening on any port", port, err)
+		ln, err = net.Listen("tcp", ":0")
+	}
+	if err != nil {
+		utils.Debug("Torrent: can't accept incoming peers: %v", err)
+		return 0
+	}
+	listenPort = ln.Addr().(*net.TCPAddr).Port
+	go acceptLoop(ln, lookupSession)
+	return listenPort
+}
+
+// acceptLoop hands incoming connections to the session their handshake names
+func acceptLoop(ln net.Listener, lookup func([20]byte) *session) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return
+		}
+		go func() {
+			_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+			hs, err := readHandshake(conn)
+			if err != nil {
+				_ = conn.Close()
+				return
+			}
+			s := lookup(hs.infoHash)
+			if s == nil {
+				_ = conn.Close()
+				return
+			}
+			s.accept(conn, hs)
+		}()
+	}
+}
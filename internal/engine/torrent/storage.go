@@ -0,0 +1,154 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// storage maps the torrent's data onto its files: a single file torrent is
+// the file at root, a multi file torrent the directory at root. Files are
+// opened on first use.
+type storage struct {
+	root     string
+	info     *Info
+	writable bool
+
+	mu    sync.Mutex
+	files []*os.File
+}
+
+// openStorage lays out the torrent's files under root. A writable storage
+// creates missing files and sizes them to their final length.
+func openStorage(root string, info *Info, writable bool) (*storage, error) {
+	s := &storage{root: root, info: info, writable: writable, files: make([]*os.File, len(info.Files))}
+	if !writable {
+		return s, nil
+	}
+	for i := range info.Files {
+		p := s.path(i)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_RDWR, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file: %w", err)
+		}
+		fi, err := f.Stat()
+		if err == nil && fi.Size() != info.Files[i].Length {
+			err = f.Truncate(info.Files[i].Length)
+		}
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to preallocate file: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func (s *storage) path(i int) string {
+	if !s.info.MultiFile() {
+		return s.root
+	}
+	return filepath.Join(s.root, filepath.FromSlash(s.info.Files[i].Path))
+}
+
+func (s *storage) file(i int) (*os.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		return nil, os.ErrClosed
+	}
+	if s.files[i] == nil {
+		flag := os.O_RDONLY
+		if s.writable {
+			flag = os.O_RDWR
+		}
+		f, err := os.OpenFile(s.path(i), flag, 0)
+		if err != nil {
+			return nil, err
+		}
+		s.files[i] = f
+	}
+	return s.files[i], nil
+}
+
+// ReadAt reads torrent data at off, across file boundaries
+func (s *storage) ReadAt(p []byte, off int64) (int, error) {
+	return s.span(p, off, func(f *os.File, b []byte, at int64) (int, error) {
+		n, err := f.ReadAt(b, at)
+		if errors.Is(err, io.EOF) && n < len(b) {
+			// A file shorter than the torrent says
+			return n, io.ErrUnexpectedEOF
+		}
+		return n, nil
+	})
+}
+
+// WriteAt writes torrent data at off, across file boundaries
+func (s *storage) WriteAt(p []byte, off int64) (int, error) {
+	return s.span(p, off, func(f *os.File, b []byte, at int64) (int, error) {
+		return f.WriteAt(b, at)
+	})
+}
+
+// span runs op on each file p overlaps when placed at off
+func (s *storage) span(p []byte, off int64, op func(f *os.File, b []byte, at int64) (int, error)) (int, error) {
+	done := 0
+	for i, fi := range s.info.Files {
+		if done == len(p) {
+			break
+		}
+		pos := off + int64(done)
+		if fi.Length == 0 || pos >= fi.Offset+fi.Length || pos < fi.Offset {
+			continue
+		}
+		f, err := s.file(i)
+		if err != nil {
+			return done, err
+		}
+		n := int(min(int64(len(p)-done), fi.Offset+fi.Length-pos))
+		m, err := op(f, p[done:done+n], pos-fi.Offset)
+		done += m
+		if err != nil {
+			return done, err
+		}
+	}
+	if done < len(p) {
+		return done, io.ErrUnexpectedEOF
+	}
+	return done, nil
+}
+
+// Sync flushes every open file
+func (s *storage) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.files {
+		if f != nil {
+			if err := f.Sync(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes every open file; the storage can't be used afterwards
+func (s *storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	for _, f := range s.files {
+		if f != nil {
+			if err := f.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	s.files = nil
+	return firstErr
+}
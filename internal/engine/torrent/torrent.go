@@ -0,0 +1,117 @@
+// Package torrent downloads BitTorrent torrents from .torrent files and
+// magnet links.
+//
+// Peers are found through the torrent's HTTP and UDP trackers and the
+// mainline DHT. A magnet link's info dictionary is fetched from peers with
+// the metadata extension (BEP 9). Pieces are picked rarest first, or in
+// order when sequential download is enabled, and web seeds (BEP 19) are
+// fetched over HTTP next to the peers. A finished torrent is seeded until the
+// configured ratio or time is reached. Only BitTorrent v1 is supported, and
+// peer connections are plain TCP without encryption.
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/concurrent"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// ContentType is the media type of .torrent files
+const ContentType = "application/x-bittorrent"
+
+// maxMetaInfoSize bounds how much of a .torrent file is read
+const maxMetaInfoSize = 32 * types.MB
+
+// IsMagnet reports whether source is a magnet link
+func IsMagnet(source string) bool {
+	return len(source) > 7 && strings.EqualFold(source[:7], "magnet:")
+}
+
+// IsTorrent reports whether source is a magnet link or a .torrent file,
+// judged by its extension or by contentType when a server sent one
+func IsTorrent(source, contentType string) bool {
+	if IsMagnet(source) {
+		return true
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && strings.EqualFold(mediaType, ContentType) {
+		return true
+	}
+	p := source
+	// A one letter scheme is a Windows drive
+	if u, err := url.Parse(source); err == nil && len(u.Scheme) > 1 {
+		switch strings.ToLower(u.Scheme) {
+		case "http", "https", "file":
+			p = u.Path
+		default:
+			return false
+		}
+	}
+	return strings.EqualFold(path.Ext(strings.ReplaceAll(p, "\\", "/")), ".torrent")
+}
+
+// Resolve reads the torrent source names: a magnet link, or a .torrent file
+// fetched over HTTP or read from disk
+func Resolve(ctx context.Context, source string, headers map[string]string, runtime *types.RuntimeConfig) (*MetaInfo, error) {
+	if IsMagnet(source) {
+		return ParseMagnet(source)
+	}
+
+	var data []byte
+	u, err := url.Parse(source)
+	switch {
+	case err == nil && (u.Scheme == "http" || u.Scheme == "https"):
+		data, err = fetch(ctx, source, headers, runtime)
+	case err == nil && u.Scheme == "file":
+		data, err = readFile(u.Path)
+	default:
+		data, err = readFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseTorrent(data)
+}
+
+func readFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("torrent: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	return io.ReadAll(io.LimitReader(f, maxMetaInfoSize))
+}
+
+func fetch(ctx context.Context, rawurl string, headers map[string]string, runtime *types.RuntimeConfig) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, val := range headers {
+		if key != "Range" {
+			req.Header.Set(key, val)
+		}
+	}
+	runtime.ApplyCredentials(req)
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", runtime.GetUserAgent())
+	}
+
+	resp, err := concurrent.NewHTTPClient(runtime, 1).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("torrent: failed to fetch %s: %w", rawurl, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("torrent: %s returned %d", rawurl, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxMetaInfoSize))
+}
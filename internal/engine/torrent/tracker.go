@@ -0,0 +1,221 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// announceRequest is what a client tells a tracker
+type announceRequest struct {
+	infoHash   [20]byte
+	peerID     [20]byte
+	port       int
+	uploaded   int64
+	downloaded int64
+	left       int64
+	event      string // "started", "completed", "stopped" or empty
+}
+
+// announceResponse is what a tracker answers
+type announceResponse struct {
+	interval time.Duration
+	peers    []string // host:port
+}
+
+// udpTimeout bounds each UDP tracker exchange
+const udpTimeout = 5 * time.Second
+
+// announce sends req to an http(s):// or udp:// tracker
+func announce(ctx context.Context, client *http.Client, tracker string, req announceRequest) (*announceResponse, error) {
+	u, err := url.Parse(tracker)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return announceHTTP(ctx, client, u, req)
+	case "udp":
+		return announceUDP(ctx, u, req)
+	}
+	return nil, fmt.Errorf("unsupported tracker scheme %q", u.Scheme)
+}
+
+func announceHTTP(ctx context.Context, client *http.Client, u *url.URL, req announceRequest) (*announceResponse, error) {
+	q := url.Values{}
+	q.Set("info_hash", string(req.infoHash[:]))
+	q.Set("peer_id", string(req.peerID[:]))
+	q.Set("port", strconv.Itoa(req.port))
+	q.Set("uploaded", strconv.FormatInt(req.uploaded, 10))
+	q.Set("downloaded", strconv.FormatInt(req.downloaded, 10))
+	q.Set("left", strconv.FormatInt(req.left, 10))
+	q.Set("compact", "1")
+	if req.event != "" {
+		q.Set("event", req.event)
+	}
+	announceURL := *u
+	if announceURL.RawQuery != "" {
+		announceURL.RawQuery += "&" + q.Encode()
+	} else {
+		announceURL.RawQuery = q.Encode()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, announceURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tracker returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := decode(body)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.New("tracker response is not a dictionary")
+	}
+	if reason := dictString(dict, "failure reason"); reason != "" {
+		return nil, fmt.Errorf("tracker: %s", reason)
+	}
+
+	res := &announceResponse{interval: time.Duration(dictInt(dict, "interval")) * time.Second}
+	switch peers := dict["peers"].(type) {
+	case string:
+		res.peers = parseCompactPeers([]byte(peers), net.IPv4len)
+	case []any:
+		// The original non-compact form
+		for _, p := range peers {
+			pd, _ := p.(map[string]any)
+			ip, port := dictString(pd, "ip"), dictInt(pd, "port")
+			if ip != "" && port > 0 && port < 65536 {
+				res.peers = append(res.peers, net.JoinHostPort(ip, strconv.FormatInt(port, 10)))
+			}
+		}
+	}
+	res.peers = append(res.peers, parseCompactPeers([]byte(dictString(dict, "peers6")), net.IPv6len)...)
+	return res, nil
+}
+
+// parseCompactPeers reads addresses packed as IP followed by a big endian port
+func parseCompactPeers(b []byte, ipLen int) []string {
+	var peers []string
+	for i := 0; i+ipLen+2 <= len(b); i += ipLen + 2 {
+		ip := net.IP(b[i : i+ipLen])
+		port := binary.BigEndian.Uint16(b[i+ipLen:])
+		if port == 0 {
+			continue
+		}
+		peers = append(peers, net.JoinHostPort(ip.String(), strconv.Itoa(int(port))))
+	}
+	return peers
+}
+
+// UDP tracker protocol (BEP 15)
+const (
+	udpProtocolID     = 0x41727101980
+	udpActionConnect  = 0
+	udpActionAnnounce = 1
+	udpActionError    = 3
+)
+
+func announceUDP(ctx context.Context, u *url.URL, req announceRequest) (*announceResponse, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	connect := make([]byte, 16)
+	binary.BigEndian.PutUint64(connect[0:], udpProtocolID)
+	binary.BigEndian.PutUint32(connect[8:], udpActionConnect)
+	resp, err := udpExchange(ctx, conn, connect, 16)
+	if err != nil {
+		return nil, err
+	}
+	connID := binary.BigEndian.Uint64(resp[8:16])
+
+	events := map[string]uint32{"": 0, "completed": 1, "started": 2, "stopped": 3}
+	packet := make([]byte, 98)
+	binary.BigEndian.PutUint64(packet[0:], connID)
+	binary.BigEndian.PutUint32(packet[8:], udpActionAnnounce)
+	copy(packet[16:], req.infoHash[:])
+	copy(packet[36:], req.peerID[:])
+	binary.BigEndian.PutUint64(packet[56:], uint64(req.downloaded))
+	binary.BigEndian.PutUint64(packet[64:], uint64(req.left))
+	binary.BigEndian.PutUint64(packet[72:], uint64(req.uploaded))
+	binary.BigEndian.PutUint32(packet[80:], events[req.event])
+	_, _ = rand.Read(packet[88:92])                     // Key
+	binary.BigEndian.PutUint32(packet[92:], 0xffffffff) // As many peers as the tracker likes
+	binary.BigEndian.PutUint16(packet[96:], uint16(req.port))
+	resp, err = udpExchange(ctx, conn, packet, 20)
+	if err != nil {
+		return nil, err
+	}
+	return &announceResponse{
+		interval: time.Duration(binary.BigEndian.Uint32(resp[8:12])) * time.Second,
+		peers:    parseCompactPeers(resp[20:], net.IPv4len),
+	}, nil
+}
+
+// udpExchange sends packet with a fresh transaction ID and waits for the
+// matching reply of at least minLen bytes
+func udpExchange(ctx context.Context, conn net.Conn, packet []byte, minLen int) ([]byte, error) {
+	_, _ = rand.Read(packet[12:16])
+	action := binary.BigEndian.Uint32(packet[8:12])
+	buf := make([]byte, 64*1024)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		deadline := time.Now().Add(udpTimeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		_ = conn.SetDeadline(deadline)
+		if _, err := conn.Write(packet); err != nil {
+			return nil, err
+		}
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+					break // Send again
+				}
+				return nil, err
+			}
+			if n < 8 || !bytes.Equal(buf[4:8], packet[12:16]) {
+				continue
+			}
+			switch binary.BigEndian.Uint32(buf[0:4]) {
+			case action:
+				if n < minLen {
+					return nil, errors.New("short tracker response")
+				}
+				return append([]byte(nil), buf[:n]...), nil
+			case udpActionError:
+				return nil, fmt.Errorf("tracker: %s", buf[8:n])
+			}
+		}
+	}
+	return nil, errors.New("tracker didn't answer")
+}
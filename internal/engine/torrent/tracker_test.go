@@ -0,0 +1,152 @@
+package torrent
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testAnnounce() announceRequest {
+	req := announceRequest{port: 6881, left: 1000, event: "started"}
+	copy(req.infoHash[:], "01234567890123456789")
+	copy(req.peerID[:], "-SG0100-abcdefghijkl")
+	return req
+}
+
+func TestAnnounceHTTP(t *testing.T) {
+	req := testAnnounce()
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		_, _ = w.Write(encode(map[string]any{
+			"interval": 900,
+			"peers":    string([]byte{10, 0, 0, 1, 0x1a, 0xe1, 10, 0, 0, 2, 0x1a, 0xe2}),
+			"peers6":   string(append(net.ParseIP("::1").To16(), 0x1a, 0xe3)),
+		}))
+	}))
+	defer server.Close()
+
+	resp, err := announce(context.Background(), server.Client(), server.URL+"/announce?key=abc", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.0.0.1:6881", "10.0.0.2:6882", "[::1]:6883"}; !reflect.DeepEqual(resp.peers, want) {
+		t.Errorf("peers = %v, want %v", resp.peers, want)
+	}
+	if resp.interval != 900*time.Second {
+		t.Errorf("interval = %v", resp.interval)
+	}
+	if query["info_hash"][0] != string(req.infoHash[:]) || query["event"][0] != "started" || query["compact"][0] != "1" || query["key"][0] != "abc" {
+		t.Errorf("query = %v", query)
+	}
+}
+
+func TestAnnounceHTTP_DictPeersAndFailure(t *testing.T) {
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			_, _ = w.Write(encode(map[string]any{"failure reason": "unregistered torrent"}))
+			return
+		}
+		_, _ = w.Write(encode(map[string]any{
+			"interval": 60,
+			"peers":    []any{map[string]any{"ip": "192.168.1.5", "port": 51413}, map[string]any{"ip": "x", "port": 0}},
+		}))
+	}))
+	defer server.Close()
+
+	resp, err := announce(context.Background(), server.Client(), server.URL, testAnnounce())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"192.168.1.5:51413"}; !reflect.DeepEqual(resp.peers, want) {
+		t.Errorf("peers = %v, want %v", resp.peers, want)
+	}
+
+	fail = true
+	if _, err := announce(context.Background(), server.Client(), server.URL, testAnnounce()); err == nil || err.Error() != "tracker: unregistered torrent" {
+		t.Errorf("err = %v, want the failure reason", err)
+	}
+}
+
+// fakeUDPTracker answers BEP 15 connect and announce requests
+func fakeUDPTracker(t *testing.T, peers []byte, announced chan<- []byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	const connID = 0x1122334455667788
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			action := binary.BigEndian.Uint32(buf[8:12])
+			tid := buf[12:16]
+			var resp []byte
+			switch {
+			case action == udpActionConnect && n == 16 && binary.BigEndian.Uint64(buf[0:8]) == udpProtocolID:
+				resp = binary.BigEndian.AppendUint32(nil, udpActionConnect)
+				resp = append(resp, tid...)
+				resp = binary.BigEndian.AppendUint64(resp, connID)
+			case action == udpActionAnnounce && n == 98 && binary.BigEndian.Uint64(buf[0:8]) == connID:
+				announced <- append([]byte(nil), buf[:n]...)
+				resp = binary.BigEndian.AppendUint32(nil, udpActionAnnounce)
+				resp = append(resp, tid...)
+				resp = binary.BigEndian.AppendUint32(resp, 1800) // Interval
+				resp = binary.BigEndian.AppendUint32(resp, 0)    // Leechers
+				resp = binary.BigEndian.AppendUint32(resp, 1)    // Seeders
+				resp = append(resp, peers...)
+			default:
+				resp = binary.BigEndian.AppendUint32(nil, udpActionError)
+				resp = append(resp, tid...)
+				resp = append(resp, "bad request"...)
+			}
+			_, _ = conn.WriteTo(resp, addr)
+		}
+	}()
+	return "udp://" + conn.LocalAddr().String() + "/announce"
+}
+
+func TestAnnounceUDP(t *testing.T) {
+	announced := make(chan []byte, 1)
+	tracker := fakeUDPTracker(t, []byte{127, 0, 0, 1, 0x1a, 0xe1}, announced)
+	req := testAnnounce()
+
+	resp, err := announce(context.Background(), http.DefaultClient, tracker, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"127.0.0.1:6881"}; !reflect.DeepEqual(resp.peers, want) {
+		t.Errorf("peers = %v, want %v", resp.peers, want)
+	}
+	if resp.interval != 30*time.Minute {
+		t.Errorf("interval = %v", resp.interval)
+	}
+
+	packet := <-announced
+	if string(packet[16:36]) != string(req.infoHash[:]) {
+		t.Error("announce carries the wrong info hash")
+	}
+	if event := binary.BigEndian.Uint32(packet[80:84]); event != 2 {
+		t.Errorf("event = %d, want 2 (started)", event)
+	}
+	if port := binary.BigEndian.Uint16(packet[96:98]); port != 6881 {
+		t.Errorf("port = %d", port)
+	}
+}
+
+func TestAnnounce_UnsupportedScheme(t *testing.T) {
+	if _, err := announce(context.Background(), http.DefaultClient, "wss://tracker.example", testAnnounce()); err == nil {
+		t.Error("WebTorrent trackers should be rejected")
+	}
+}
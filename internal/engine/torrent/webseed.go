@@ -0,0 +1,222 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// webSeedWorkers is how many pieces one web seed fetches at a time, further
+// capped by the host's connection limit
+const webSeedWorkers = 4
+
+// errSeedGone means the web seed doesn't have the torrent's files
+var errSeedGone = errors.New("web seed doesn't have the file")
+
+// webSeed is an HTTP server holding the torrent's files (BEP 19)
+type webSeed struct {
+	s    *session
+	base *url.URL
+
+	mu       sync.Mutex
+	busy     map[int]bool // Pieces this seed's workers are fetching
+	failures int          // Failed fetches in a row
+	dead     bool
+}
+
+// startWebSeed fetches pieces from seed next to the peers
+func (s *session) startWebSeed(seed string) {
+	u, err := url.Parse(seed)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		utils.Debug("Torrent %s: skipping web seed %q", s.id, seed)
+		return
+	}
+	w := &webSeed{s: s, base: u, busy: make(map[int]bool)}
+	workers := min(webSeedWorkers, s.runtime.GetHostConnectionLimit(types.HostKey(u)))
+	for range workers {
+		s.wg.Add(1)
+		go w.work()
+	}
+}
+
+func (w *webSeed) isDead() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dead
+}
+
+func (w *webSeed) fetching(i int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.busy[i]
+}
+
+func (w *webSeed) setBusy(i int, busy bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if busy {
+		w.busy[i] = true
+	} else {
+		delete(w.busy, i)
+	}
+}
+
+// work fetches pieces until the torrent is complete or the seed fails
+func (w *webSeed) work() {
+	s := w.s
+	defer s.wg.Done()
+	for !w.isDead() {
+		i, ok := s.pick(func(int) bool { return true }, w.fetching)
+		if !ok {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-s.complete:
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		w.setBusy(i, true)
+		data, err := w.fetchPiece(i)
+		valid := false
+		if err == nil {
+			valid, err = s.verifyPiece(i, data)
+			if err == nil && !valid {
+				err = errors.New("piece failed verification")
+			}
+		}
+		w.setBusy(i, false)
+		s.releasePiece(i, err != nil && data != nil)
+		if s.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if !w.failed(err) {
+				return
+			}
+			continue
+		}
+		w.mu.Lock()
+		w.failures = 0
+		w.mu.Unlock()
+	}
+}
+
+// failed records a failed fetch and backs off before the next one. It
+// reports false once the seed is given up on.
+func (w *webSeed) failed(err error) bool {
+	s := w.s
+	w.mu.Lock()
+	w.failures++
+	failures := w.failures
+	if errors.Is(err, errSeedGone) || failures > s.runtime.GetMaxTaskRetries() {
+		w.dead = true
+	}
+	dead := w.dead
+	w.mu.Unlock()
+
+	utils.Debug("Torrent %s: web seed %s: %v", s.id, w.base.Redacted(), err)
+	if dead {
+		return false
+	}
+	select {
+	case <-s.ctx.Done():
+		return false
+	case <-time.After(time.Duration(failures) * time.Second):
+		return true
+	}
+}
+
+// fetchPiece downloads piece i, with one range request per file it spans
+func (w *webSeed) fetchPiece(i int) ([]byte, error) {
+	info := w.s.info
+	start := int64(i) * info.PieceLength
+	data := make([]byte, info.PieceSize(i))
+	for _, f := range info.Files {
+		lo := max(start, f.Offset)
+		hi := min(start+int64(len(data)), f.Offset+f.Length)
+		if lo >= hi {
+			continue
+		}
+		if err := w.fetchRange(w.fileURL(f), lo-f.Offset, data[lo-start:hi-start]); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// fileURL locates a torrent file on the seed: a URL ending in "/" is the
+// directory holding the torrent, anything else the single file itself
+func (w *webSeed) fileURL(f File) string {
+	info := w.s.info
+	base := w.base.String()
+	if !info.MultiFile() {
+		if strings.HasSuffix(base, "/") {
+			return base + url.PathEscape(info.Name)
+		}
+		return base
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	parts := []string{url.PathEscape(info.Name)}
+	for _, part := range strings.Split(f.Path, "/") {
+		parts = append(parts, url.PathEscape(part))
+	}
+	return base + strings.Join(parts, "/")
+}
+
+// fetchRange reads len(buf) bytes of the file at fileURL from offset
+func (w *webSeed) fetchRange(fileURL string, offset int64, buf []byte) error {
+	s := w.s
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", s.runtime.GetUserAgent())
+	s.runtime.ApplyCredentials(req)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+int64(len(buf))-1))
+
+	release, err := s.runtime.AcquireHostSlot(s.ctx, types.HostKey(req.URL))
+	if err != nil {
+		return err
+	}
+	defer release()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+	case resp.StatusCode == http.StatusOK && offset == 0:
+		// Ranges unsupported, but the start of the file is what we want
+	case resp.StatusCode == http.StatusForbidden, resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusGone:
+		return fmt.Errorf("%w (%s)", errSeedGone, resp.Status)
+	default:
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	for done := 0; done < len(buf); {
+		n := min(len(buf)-done, s.progress.BandwidthChunk(types.WorkerBuffer))
+		if err := s.progress.WaitBandwidth(s.ctx, n); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(resp.Body, buf[done:done+n]); err != nil {
+			return err
+		}
+		done += n
+	}
+	return nil
+}
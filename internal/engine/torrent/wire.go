@@ -0,0 +1,163 @@
+package torrent
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Peer wire protocol (BEP 3) with the extension protocol (BEP 10)
+
+const protocolName = "BitTorrent protocol"
+
+// Message IDs
+const (
+	msgChoke         = 0
+	msgUnchoke       = 1
+	msgInterested    = 2
+	msgNotInterested = 3
+	msgHave          = 4
+	msgBitfield      = 5
+	msgRequest       = 6
+	msgPiece         = 7
+	msgCancel        = 8
+	msgExtended      = 20
+)
+
+const (
+	blockSize         = 16 * 1024       // Bytes asked for per request
+	maxRequestSize    = 128 * 1024      // Largest request served to peers
+	maxMessageSize    = 2 * 1024 * 1024 // Longer messages drop the peer
+	extHandshakeID    = 0               // Extended message carrying the extension handshake
+	utMetadataID      = 1               // Our ID for ut_metadata (BEP 9)
+	metadataPieceSize = 16 * 1024       // ut_metadata transfers the info dictionary in these pieces
+)
+
+// handshake opens every peer connection
+type handshake struct {
+	reserved [8]byte
+	infoHash [20]byte
+	peerID   [20]byte
+}
+
+// supportsExtensions reports whether the peer speaks the extension protocol
+func (h *handshake) supportsExtensions() bool {
+	return h.reserved[5]&0x10 != 0
+}
+
+func writeHandshake(w io.Writer, infoHash, peerID [20]byte) error {
+	buf := make([]byte, 0, 68)
+	buf = append(buf, byte(len(protocolName)))
+	buf = append(buf, protocolName...)
+	var reserved [8]byte
+	reserved[5] |= 0x10 // Extension protocol
+	buf = append(buf, reserved[:]...)
+	buf = append(buf, infoHash[:]...)
+	buf = append(buf, peerID[:]...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readHandshake(r io.Reader) (*handshake, error) {
+	var buf [68]byte
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return nil, err
+	}
+	if int(buf[0]) != len(protocolName) {
+		return nil, errors.New("not a BitTorrent handshake")
+	}
+	if _, err := io.ReadFull(r, buf[1:]); err != nil {
+		return nil, err
+	}
+	if string(buf[1:20]) != protocolName {
+		return nil, errors.New("not a BitTorrent handshake")
+	}
+	h := &handshake{}
+	copy(h.reserved[:], buf[20:28])
+	copy(h.infoHash[:], buf[28:48])
+	copy(h.peerID[:], buf[48:68])
+	return h, nil
+}
+
+// message is one peer wire message; nil is a keep-alive
+type message struct {
+	id      byte
+	payload []byte
+}
+
+func readMessage(r io.Reader) (*message, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(lenBuf[:])
+	if n == 0 {
+		return nil, nil
+	}
+	if n > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes is too long", n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return &message{id: buf[0], payload: buf[1:]}, nil
+}
+
+func writeMessage(w io.Writer, m *message) error {
+	buf := make([]byte, 4, 5+len(m.payload))
+	binary.BigEndian.PutUint32(buf, uint32(1+len(m.payload)))
+	buf = append(buf, m.id)
+	buf = append(buf, m.payload...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func writeKeepAlive(w io.Writer) error {
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// Payload builders and parsers for the fixed size messages
+
+func haveMessage(index int) *message {
+	payload := binary.BigEndian.AppendUint32(nil, uint32(index))
+	return &message{id: msgHave, payload: payload}
+}
+
+func requestMessage(id byte, index int, begin, length int64) *message {
+	payload := make([]byte, 12)
+	binary.BigEndian.PutUint32(payload[0:], uint32(index))
+	binary.BigEndian.PutUint32(payload[4:], uint32(begin))
+	binary.BigEndian.PutUint32(payload[8:], uint32(length))
+	return &message{id: id, payload: payload}
+}
+
+func parseRequest(payload []byte) (index int, begin, length int64, err error) {
+	if len(payload) != 12 {
+		return 0, 0, 0, errors.New("malformed request")
+	}
+	return int(binary.BigEndian.Uint32(payload[0:])),
+		int64(binary.BigEndian.Uint32(payload[4:])),
+		int64(binary.BigEndian.Uint32(payload[8:])), nil
+}
+
+func pieceMessage(index int, begin int64, block []byte) *message {
+	payload := make([]byte, 8, 8+len(block))
+	binary.BigEndian.PutUint32(payload[0:], uint32(index))
+	binary.BigEndian.PutUint32(payload[4:], uint32(begin))
+	return &message{id: msgPiece, payload: append(payload, block...)}
+}
+
+func parsePiece(payload []byte) (index int, begin int64, block []byte, err error) {
+	if len(payload) < 8 {
+		return 0, 0, nil, errors.New("malformed piece")
+	}
+	return int(binary.BigEndian.Uint32(payload[0:])), int64(binary.BigEndian.Uint32(payload[4:])), payload[8:], nil
+}
+
+func extendedMessage(extID byte, dict map[string]any, trailer []byte) *message {
+	payload := append([]byte{extID}, encode(dict)...)
+	return &message{id: msgExtended, payload: append(payload, trailer...)}
+}
@@ -117,3 +117,53 @@ func TestRecalculateProgress(t *testing.T) {
 		t.Errorf("Expected Chunk 2 to be Completed (Full), got %v", state.GetChunkState(2))
 	}
 }
+
+func TestChunkPendingRollsBackProgress(t *testing.T) {
+	state := types.NewProgressState("test-rollback", 4*1024*1024)
+	state.InitBitmap(4*1024*1024, 1024*1024)
+
+	state.UpdateChunkStatus(0, 2*1024*1024, types.ChunkCompleted)
+	if got := state.VerifiedProgress.Load(); got != 2*1024*1024 {
+		t.Fatalf("VerifiedProgress = %d, want 2MB", got)
+	}
+
+	// A bad piece straddling chunks 0 and 1 is thrown away
+	state.UpdateChunkStatus(768*1024, 512*1024, types.ChunkPending)
+
+	if got := state.VerifiedProgress.Load(); got != 1536*1024 {
+		t.Errorf("VerifiedProgress = %d, want 1.5MB", got)
+	}
+	if state.GetChunkState(0) != types.ChunkDownloading || state.GetChunkState(1) != types.ChunkDownloading {
+		t.Errorf("chunks 0 and 1 should be back to Downloading, got %v and %v", state.GetChunkState(0), state.GetChunkState(1))
+	}
+
+	// Dropping the rest of chunk 1 empties it
+	state.UpdateChunkStatus(1024*1024, 1024*1024, types.ChunkPending)
+	if state.GetChunkState(1) != types.ChunkPending {
+		t.Errorf("chunk 1 = %v, want Pending", state.GetChunkState(1))
+	}
+	if got := state.VerifiedProgress.Load(); got != 768*1024 {
+		t.Errorf("VerifiedProgress = %d, want 768KB", got)
+	}
+}
+
+func TestChunkFailedUntilRefetched(t *testing.T) {
+	state := types.NewProgressState("test-failed", 2*1024*1024)
+	state.InitBitmap(2*1024*1024, 1024*1024)
+	state.UpdateChunkStatus(0, 2*1024*1024, types.ChunkCompleted)
+
+	state.UpdateChunkStatus(1024*1024, 256*1024, types.ChunkFailed)
+	if state.GetChunkState(1) != types.ChunkFailed {
+		t.Fatalf("chunk 1 = %v, want Failed", state.GetChunkState(1))
+	}
+	if got := state.VerifiedProgress.Load(); got != 1792*1024 {
+		t.Errorf("VerifiedProgress = %d, want 1.75MB", got)
+	}
+
+	// Fetching it again clears the mark
+	state.UpdateChunkStatus(1024*1024, 256*1024, types.ChunkDownloading)
+	state.UpdateChunkStatus(1024*1024, 256*1024, types.ChunkCompleted)
+	if state.GetChunkState(1) != types.ChunkCompleted {
+		t.Errorf("chunk 1 = %v, want Completed", state.GetChunkState(1))
+	}
+}
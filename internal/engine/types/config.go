@@ -1,7 +1,15 @@
 package types
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
 )
 
 // Size constants
@@ -15,6 +23,10 @@ const (
 
 	// IncompleteSuffix is appended to files while downloading
 	IncompleteSuffix = ".surge"
+
+	// PartsSuffix is appended to the .surge path for the directory where
+	// stream downloads keep finished segments until they are merged
+	PartsSuffix = ".parts"
 )
 
 // Chunk size constants for concurrent downloads
@@ -64,6 +76,56 @@ type DownloadConfig struct {
 	Runtime    *RuntimeConfig    // Dynamic settings from user config
 	Mirrors    []string          // List of mirror URLs (including primary)
 	Headers    map[string]string // Custom HTTP headers from browser (cookies, auth, etc.)
+	RateLimit  int64             // Per-download bandwidth limit in bytes/sec (0 = unlimited)
+	Checksum   string            // Expected digest of the finished file ("sha256:abcd..."), empty to skip
+	Priority   Priority          // Queue priority, higher starts first
+	QueueOrder int64             // Place within its priority, lower starts first (0 = end of the queue)
+	Pieces     *PieceHashes      // Hashes to verify each piece against, nil to load them from state
+	BatchID    string            // Batch the download belongs to, paused and resumed together
+	BatchName  string            // Name of the batch, passed on to clients when the download is queued
+	Category   string            // Category the download was added in, "" to match one after probing
+	Conflict   string            // Conflict policy of the download, "" = Runtime.ConflictPolicy
+}
+
+// AddOptions are the less common settings of a new download
+type AddOptions struct {
+	Pieces    *PieceHashes // Piece hashes from a manifest, checked as each piece completes
+	BatchID   string       // Groups the download with others added at the same time
+	BatchName string       // Name the batch is created with if it is new
+	Category  string       // Category to file the download under instead of matching one by its rules
+	Conflict  string       // Conflict policy replacing the configured one
+	Proxy     string       // Proxy for the download's requests replacing the configured one
+
+	// Hooks replace the configured completion and error hooks where set
+	Hooks *config.HookSettings
+}
+
+// RequestSettings are the headers and proxy a download's requests are made
+// with, and the conflict policy it was added with. They are stored with the
+// download so that it looks like the same client to the server, and settles
+// its file the same way, when it is resumed after a restart.
+type RequestSettings struct {
+	Headers  map[string]string `json:"headers,omitempty"`
+	Proxy    string            `json:"proxy,omitempty"`
+	Conflict string            `json:"conflict,omitempty"`
+}
+
+// ValidateProxyURL checks that a proxy URL is one the downloaders can use:
+// http, https or socks5 with a host
+func ValidateProxyURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("invalid proxy URL %q: scheme must be http, https or socks5", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid proxy URL %q: no host", raw)
+	}
+	return nil
 }
 
 // RuntimeConfig holds dynamic settings that can override defaults
@@ -82,6 +144,63 @@ type RuntimeConfig struct {
 	SpeedEmaAlpha         float64
 	SkipTLSVerification   bool
 	PreserveURLPath       bool
+	DiscoverChecksums     bool
+	StreamVariant         string         // HLS/DASH variant to fetch: "highest" (default), "lowest" or a height like "720p"
+	PathTemplate          string         // Path of the file below the output directory, "" = just the file name
+	ConflictPolicy        string         // What to do when the file exists, see config.ConflictPolicies
+	AutoExtract           bool           // Unpack finished archives next to them
+	DeleteAfterExtract    bool           // and remove the archive afterwards
+	HostConnectionLimits  map[string]int // Per-host overrides of MaxConnectionsPerHost
+	HostSlots             HostSlots      // Connection budget shared by all downloads, nil = none
+	CookiesFile           string         // Netscape cookies.txt to send cookies from
+	NetrcFile             string         // .netrc to take logins from
+	Credentials           Credentials    // Stored logins and cookies, nil = none
+
+	EnableDHT   bool          // Find torrent peers through the mainline DHT
+	TorrentPort int           // Port for incoming torrent peers, 0 = any
+	MaxPeers    int           // Peers per torrent
+	SeedRatio   float64       // Seed a finished torrent until uploaded/size reaches this, 0 = no ratio limit
+	SeedTime    time.Duration // or until this long has passed, 0 = no time limit
+
+	Categories         []config.Category // Sort downloads added without one by their probed name and type
+	DefaultDownloadDir string            // Downloads into it move to their category's directory
+}
+
+// HostSlots hands out connection slots per "host:port" so that concurrent
+// downloads share one budget instead of each opening its own connections.
+type HostSlots interface {
+	// Acquire blocks until fewer than limit slots for host are in use or ctx is done
+	Acquire(ctx context.Context, host string, limit int) error
+	// Release returns a slot taken with Acquire
+	Release(host string)
+}
+
+// Credentials adds stored logins, tokens and cookies to outgoing requests
+type Credentials interface {
+	// Apply sets what is stored for req's host, leaving headers req already has
+	Apply(req *http.Request)
+}
+
+// HostKey returns the "host:port" a URL connects to, filling in the
+// scheme's default port so both spellings share a budget.
+func HostKey(u *url.URL) string {
+	host := strings.ToLower(u.Host)
+	if u.Port() != "" {
+		return host
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return net.JoinHostPort(strings.ToLower(u.Hostname()), "443")
+	case "http":
+		return net.JoinHostPort(strings.ToLower(u.Hostname()), "80")
+	case "ftp", "ftpes":
+		return net.JoinHostPort(strings.ToLower(u.Hostname()), "21")
+	case "ftps":
+		return net.JoinHostPort(strings.ToLower(u.Hostname()), "990")
+	case "sftp":
+		return net.JoinHostPort(strings.ToLower(u.Hostname()), "22")
+	}
+	return host
 }
 
 // GetUserAgent returns the configured user agent or the default
@@ -100,6 +219,118 @@ func (r *RuntimeConfig) GetMaxConnectionsPerHost() int {
 	return r.MaxConnectionsPerHost
 }
 
+// GetHostConnectionLimit returns how many connections all downloads together
+// may open to host ("host:port"): an override for host:port or the bare host
+// name if one is configured, otherwise MaxConnectionsPerHost.
+func (r *RuntimeConfig) GetHostConnectionLimit(host string) int {
+	if r != nil && len(r.HostConnectionLimits) > 0 {
+		host = strings.ToLower(host)
+		if n := r.HostConnectionLimits[host]; n > 0 {
+			return n
+		}
+		if name, _, err := net.SplitHostPort(host); err == nil {
+			if n := r.HostConnectionLimits[name]; n > 0 {
+				return n
+			}
+		}
+	}
+	return r.GetMaxConnectionsPerHost()
+}
+
+// AcquireHostSlot takes a connection slot for host ("host:port") from the
+// shared budget, blocking until one is free. The returned release func is
+// never nil on success; without a budget it does nothing.
+func (r *RuntimeConfig) AcquireHostSlot(ctx context.Context, host string) (func(), error) {
+	if r == nil || r.HostSlots == nil {
+		return func() {}, nil
+	}
+	if err := r.HostSlots.Acquire(ctx, host, r.GetHostConnectionLimit(host)); err != nil {
+		return nil, err
+	}
+	return func() { r.HostSlots.Release(host) }, nil
+}
+
+// ApplyCredentials adds the stored credentials for req's host to req. Call
+// it after the download's own headers are set, which take precedence.
+func (r *RuntimeConfig) ApplyCredentials(req *http.Request) {
+	if r == nil || r.Credentials == nil {
+		return
+	}
+	r.Credentials.Apply(req)
+}
+
+// CopyRedirectHeaders copies the headers of the first request of a redirect
+// chain onto req, except Range. When req goes to another host, what the
+// stored credentials added for the first host is left behind and req gets
+// those stored for its own host instead. The download's own headers are
+// kept either way.
+func (r *RuntimeConfig) CopyRedirectHeaders(req *http.Request, via []*http.Request) {
+	if len(via) == 0 {
+		return
+	}
+	first := via[0]
+	var stored http.Header
+	if r != nil && r.Credentials != nil && HostKey(first.URL) != HostKey(req.URL) {
+		bare := &http.Request{URL: first.URL, Header: make(http.Header)}
+		r.Credentials.Apply(bare)
+		stored = bare.Header
+	}
+	for key, vals := range first.Header {
+		if key == "Range" {
+			continue
+		}
+		if s := stored.Get(key); s != "" {
+			if vals = withoutStored(key, vals, s); len(vals) == 0 {
+				delete(req.Header, key)
+				continue
+			}
+		}
+		req.Header[key] = vals
+	}
+	if stored != nil {
+		r.Credentials.Apply(req)
+	}
+}
+
+// withoutStored drops the values of a header that came from the stored
+// credentials. Cookies are dropped one by one, as stored cookies are added
+// to those the download brought.
+func withoutStored(key string, vals []string, stored string) []string {
+	var kept []string
+	for _, v := range vals {
+		if key == "Cookie" {
+			drop := make(map[string]bool)
+			for _, c := range strings.Split(stored, "; ") {
+				drop[c] = true
+			}
+			var own []string
+			for _, c := range strings.Split(v, "; ") {
+				if !drop[c] {
+					own = append(own, c)
+				}
+			}
+			v = strings.Join(own, "; ")
+		} else if v == stored {
+			v = ""
+		}
+		if v != "" {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// DefaultMaxPeers is how many peers a torrent connects to by default
+const DefaultMaxPeers = 50
+
+// GetMaxPeers returns configured value or default
+func (r *RuntimeConfig) GetMaxPeers() int {
+	if r == nil || r.MaxPeers <= 0 {
+		return DefaultMaxPeers
+	}
+	return r.MaxPeers
+}
+
 // GetMinChunkSize returns configured value or default
 func (r *RuntimeConfig) GetMinChunkSize() int64 {
 	if r == nil || r.MinChunkSize <= 0 {
@@ -8,6 +8,8 @@ func ConvertRuntimeConfig(rc *config.RuntimeConfig) *RuntimeConfig {
 		MaxConnectionsPerHost: rc.MaxConnectionsPerHost,
 		UserAgent:             rc.UserAgent,
 		ProxyURL:              rc.ProxyURL,
+		CookiesFile:           rc.CookiesFile,
+		NetrcFile:             rc.NetrcFile,
 		SequentialDownload:    rc.SequentialDownload,
 		MinChunkSize:          rc.MinChunkSize,
 		WorkerBufferSize:      rc.WorkerBufferSize,
@@ -18,5 +20,19 @@ func ConvertRuntimeConfig(rc *config.RuntimeConfig) *RuntimeConfig {
 		SpeedEmaAlpha:         rc.SpeedEmaAlpha,
 		SkipTLSVerification:   rc.SkipTLSVerification,
 		PreserveURLPath:       rc.PreserveURLPath,
+		PathTemplate:          rc.PathTemplate,
+		ConflictPolicy:        rc.ConflictPolicy,
+		DiscoverChecksums:     rc.DiscoverChecksums,
+		StreamVariant:         rc.StreamVariant,
+		AutoExtract:           rc.AutoExtract,
+		DeleteAfterExtract:    rc.DeleteAfterExtract,
+		HostConnectionLimits:  rc.HostConnectionLimits,
+		EnableDHT:             rc.EnableDHT,
+		TorrentPort:           rc.TorrentPort,
+		MaxPeers:              rc.MaxPeers,
+		SeedRatio:             rc.SeedRatio,
+		SeedTime:              rc.SeedTime,
+		Categories:            rc.Categories,
+		DefaultDownloadDir:    rc.DefaultDownloadDir,
 	}
 }
@@ -15,6 +15,8 @@ func TestConvertRuntimeConfig_AllFieldsCopied(t *testing.T) {
 		MaxConnectionsPerHost: 48,
 		UserAgent:             "TestAgent/1.0",
 		ProxyURL:              "http://127.0.0.1:8080",
+		CookiesFile:           "/home/me/cookies.txt",
+		NetrcFile:             "/home/me/.netrc",
 		SequentialDownload:    true,
 		MinChunkSize:          4 * 1024 * 1024,
 		WorkerBufferSize:      512 * 1024,
@@ -25,6 +27,20 @@ func TestConvertRuntimeConfig_AllFieldsCopied(t *testing.T) {
 		SpeedEmaAlpha:         0.4,
 		SkipTLSVerification:   true,
 		PreserveURLPath:       true,
+		PathTemplate:          "{host}/{filename}",
+		ConflictPolicy:        "skip",
+		DiscoverChecksums:     true,
+		StreamVariant:         "720p",
+		AutoExtract:           true,
+		DeleteAfterExtract:    true,
+		HostConnectionLimits:  map[string]int{"example.com": 4},
+		EnableDHT:             true,
+		TorrentPort:           51413,
+		MaxPeers:              80,
+		SeedRatio:             2.5,
+		SeedTime:              time.Hour,
+		Categories:            []config.Category{{Name: "Video", Dir: "/videos"}},
+		DefaultDownloadDir:    "/downloads",
 	}
 
 	result := ConvertRuntimeConfig(input)
@@ -42,6 +58,9 @@ func TestConvertRuntimeConfig_AllFieldsCopied(t *testing.T) {
 	if result.ProxyURL != input.ProxyURL {
 		t.Errorf("ProxyURL: got %q, want %q", result.ProxyURL, input.ProxyURL)
 	}
+	if result.CookiesFile != input.CookiesFile || result.NetrcFile != input.NetrcFile {
+		t.Errorf("CookiesFile/NetrcFile: got %q, %q", result.CookiesFile, result.NetrcFile)
+	}
 	if result.SequentialDownload != input.SequentialDownload {
 		t.Errorf("SequentialDownload: got %v, want %v", result.SequentialDownload, input.SequentialDownload)
 	}
@@ -72,6 +91,45 @@ func TestConvertRuntimeConfig_AllFieldsCopied(t *testing.T) {
 	if result.PreserveURLPath != input.PreserveURLPath {
 		t.Errorf("PreserveURLPath: got %v, want %v", result.PreserveURLPath, input.PreserveURLPath)
 	}
+	if result.PathTemplate != input.PathTemplate {
+		t.Errorf("PathTemplate: got %q, want %q", result.PathTemplate, input.PathTemplate)
+	}
+	if result.ConflictPolicy != input.ConflictPolicy {
+		t.Errorf("ConflictPolicy: got %q, want %q", result.ConflictPolicy, input.ConflictPolicy)
+	}
+	if result.DiscoverChecksums != input.DiscoverChecksums {
+		t.Errorf("DiscoverChecksums: got %v, want %v", result.DiscoverChecksums, input.DiscoverChecksums)
+	}
+	if result.StreamVariant != input.StreamVariant {
+		t.Errorf("StreamVariant: got %q, want %q", result.StreamVariant, input.StreamVariant)
+	}
+	if result.AutoExtract != input.AutoExtract || result.DeleteAfterExtract != input.DeleteAfterExtract {
+		t.Errorf("AutoExtract/DeleteAfterExtract: got %v/%v, want %v/%v", result.AutoExtract, result.DeleteAfterExtract, input.AutoExtract, input.DeleteAfterExtract)
+	}
+	if result.HostConnectionLimits["example.com"] != 4 {
+		t.Errorf("HostConnectionLimits: got %v, want %v", result.HostConnectionLimits, input.HostConnectionLimits)
+	}
+	if result.EnableDHT != input.EnableDHT {
+		t.Errorf("EnableDHT: got %v, want %v", result.EnableDHT, input.EnableDHT)
+	}
+	if result.TorrentPort != input.TorrentPort {
+		t.Errorf("TorrentPort: got %d, want %d", result.TorrentPort, input.TorrentPort)
+	}
+	if result.MaxPeers != input.MaxPeers {
+		t.Errorf("MaxPeers: got %d, want %d", result.MaxPeers, input.MaxPeers)
+	}
+	if result.SeedRatio != input.SeedRatio {
+		t.Errorf("SeedRatio: got %f, want %f", result.SeedRatio, input.SeedRatio)
+	}
+	if result.SeedTime != input.SeedTime {
+		t.Errorf("SeedTime: got %v, want %v", result.SeedTime, input.SeedTime)
+	}
+	if len(result.Categories) != 1 || result.Categories[0].Dir != "/videos" {
+		t.Errorf("Categories: got %v, want %v", result.Categories, input.Categories)
+	}
+	if result.DefaultDownloadDir != input.DefaultDownloadDir {
+		t.Errorf("DefaultDownloadDir: got %q, want %q", result.DefaultDownloadDir, input.DefaultDownloadDir)
+	}
 }
 
 // TestConvertRuntimeConfig_EmptyProxyURL ensures empty proxy doesn't cause issues.
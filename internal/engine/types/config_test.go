@@ -1,6 +1,8 @@
 package types
 
 import (
+	"net/http"
+	"net/url"
 	"testing"
 	"time"
 )
@@ -36,6 +38,9 @@ func TestRuntimeConfig_Getters(t *testing.T) {
 		if got := r.GetSpeedEmaAlpha(); got != SpeedEMAAlpha {
 			t.Errorf("GetSpeedEmaAlpha = %f, want %f", got, SpeedEMAAlpha)
 		}
+		if got := r.GetMaxPeers(); got != DefaultMaxPeers {
+			t.Errorf("GetMaxPeers = %d, want %d", got, DefaultMaxPeers)
+		}
 	})
 
 	t.Run("zero values return defaults", func(t *testing.T) {
@@ -64,6 +69,7 @@ func TestRuntimeConfig_Getters(t *testing.T) {
 			SlowWorkerGracePeriod: 10 * time.Second,
 			StallTimeout:          15 * time.Second,
 			SpeedEmaAlpha:         0.5,
+			MaxPeers:              20,
 		}
 
 		if got := r.GetMaxConnectionsPerHost(); got != 128 {
@@ -94,6 +100,9 @@ func TestRuntimeConfig_Getters(t *testing.T) {
 		if got := r.GetSpeedEmaAlpha(); got != 0.5 {
 			t.Errorf("GetSpeedEmaAlpha = %f, want 0.5", got)
 		}
+		if got := r.GetMaxPeers(); got != 20 {
+			t.Errorf("GetMaxPeers = %d, want 20", got)
+		}
 	})
 }
 
@@ -193,3 +202,109 @@ func TestDownloadConfig_Fields(t *testing.T) {
 		t.Error("Runtime not set correctly")
 	}
 }
+
+func TestHostKey(t *testing.T) {
+	tests := []struct {
+		rawurl string
+		want   string
+	}{
+		{"https://Example.com/file.zip", "example.com:443"},
+		{"http://example.com/file.zip", "example.com:80"},
+		{"http://example.com:8080/file.zip", "example.com:8080"},
+		{"https://[::1]/file.zip", "[::1]:443"},
+		{"ftp://mirror.example.com/pub/file.iso", "mirror.example.com:21"},
+		{"ftpes://mirror.example.com/pub/file.iso", "mirror.example.com:21"},
+		{"ftps://mirror.example.com/pub/file.iso", "mirror.example.com:990"},
+		{"sftp://builder@ci.internal/artifacts/app.tar", "ci.internal:22"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.rawurl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := HostKey(u); got != tt.want {
+			t.Errorf("HostKey(%q) = %q, want %q", tt.rawurl, got, tt.want)
+		}
+	}
+}
+
+func TestGetHostConnectionLimit(t *testing.T) {
+	r := &RuntimeConfig{
+		MaxConnectionsPerHost: 16,
+		HostConnectionLimits: map[string]int{
+			"example.com":      4,
+			"example.com:8080": 2,
+		},
+	}
+
+	tests := []struct {
+		host string
+		want int
+	}{
+		{"example.com:443", 4},
+		{"EXAMPLE.com:80", 4},
+		{"example.com:8080", 2},
+		{"other.org:443", 16},
+	}
+	for _, tt := range tests {
+		if got := r.GetHostConnectionLimit(tt.host); got != tt.want {
+			t.Errorf("GetHostConnectionLimit(%q) = %d, want %d", tt.host, got, tt.want)
+		}
+	}
+
+	var nilCfg *RuntimeConfig
+	if got := nilCfg.GetHostConnectionLimit("example.com:443"); got != PerHostMax {
+		t.Errorf("nil config limit = %d, want %d", got, PerHostMax)
+	}
+}
+
+// hostCredentials stores headers per host, like the keyring does
+type hostCredentials map[string]map[string]string
+
+func (c hostCredentials) Apply(req *http.Request) {
+	for name, value := range c[req.URL.Host] {
+		switch {
+		case name == "Cookie" && req.Header.Get("Cookie") != "":
+			req.Header.Set("Cookie", req.Header.Get("Cookie")+"; "+value)
+		case req.Header.Get(name) == "":
+			req.Header.Set(name, value)
+		}
+	}
+}
+
+func TestCopyRedirectHeaders(t *testing.T) {
+	r := &RuntimeConfig{Credentials: hostCredentials{
+		"a.example": {"Authorization": "Basic a", "X-Key": "ka", "Cookie": "s=a"},
+		"b.example": {"Authorization": "Basic b"},
+	}}
+	first, _ := http.NewRequest(http.MethodGet, "https://a.example/file", nil)
+	first.Header.Set("User-Agent", "own/1.0")
+	first.Header.Set("Cookie", "own=1")
+	first.Header.Set("Range", "bytes=0-")
+	r.ApplyCredentials(first)
+
+	redirect := func(target string) *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("X-Key", first.Header.Get("X-Key")) // Go copies headers it doesn't consider sensitive
+		r.CopyRedirectHeaders(req, []*http.Request{first})
+		return req
+	}
+
+	same := redirect("https://a.example:443/mirror")
+	for _, name := range []string{"Authorization", "X-Key", "Cookie", "User-Agent"} {
+		if got, want := same.Header.Get(name), first.Header.Get(name); got != want {
+			t.Errorf("same host: %s = %q, want %q", name, got, want)
+		}
+	}
+	if same.Header.Get("Range") != "" {
+		t.Error("same host: Range was copied")
+	}
+
+	other := redirect("https://b.example/cdn")
+	want := map[string]string{"Authorization": "Basic b", "X-Key": "", "Cookie": "own=1", "User-Agent": "own/1.0"}
+	for name, value := range want {
+		if got := other.Header.Get(name); got != value {
+			t.Errorf("other host: %s = %q, want %q", name, got, value)
+		}
+	}
+}
@@ -5,4 +5,12 @@ import "errors"
 // Common errors
 var (
 	ErrPaused = errors.New("download paused")
+
+	// ErrRemoteChanged means the file on the server is no longer the one
+	// the download started from, so the received bytes can't be combined
+	ErrRemoteChanged = errors.New("remote file changed")
+
+	// ErrCorruptPiece means a piece kept failing its hash no matter how often
+	// it was fetched again
+	ErrCorruptPiece = errors.New("piece failed verification")
 )
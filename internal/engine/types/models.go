@@ -1,9 +1,18 @@
 package types
 
+import (
+	"fmt"
+	"strings"
+)
+
 // Task represents a byte range to download
 type Task struct {
 	Offset int64 `json:"offset"`
 	Length int64 `json:"length"`
+
+	// Avoid is a mirror that served a corrupt copy of this range; another
+	// one is used if there is any. Not persisted.
+	Avoid string `json:"-"`
 }
 
 // DownloadState represents persisted download state for resume
@@ -27,6 +36,61 @@ type DownloadState struct {
 
 	// Integrity verification
 	FileHash string `json:"file_hash,omitempty"` // SHA-256 hash of the .surge file at pause time
+
+	RateLimit int64 `json:"rate_limit,omitempty"` // Per-download bandwidth limit in bytes/sec
+
+	Checksum string `json:"checksum,omitempty"` // Expected digest of the finished file ("algo:hex")
+
+	// Remote validators from the probe, compared on resume (TotalSize holds Content-Length)
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	// Queue placement, restored when the download is resumed
+	Priority   Priority `json:"priority,omitempty"`
+	QueueOrder int64    `json:"queue_order,omitempty"`
+
+	BatchID  string `json:"batch_id,omitempty"` // Batch the download was added in, empty for none
+	Category string `json:"category,omitempty"`
+}
+
+// ValidateRemote checks that a fresh probe still describes the file this state
+// was saved from. Validators missing on either side are not compared.
+// Returns an error wrapping ErrRemoteChanged on mismatch.
+func (s *DownloadState) ValidateRemote(size int64, etag, lastModified string) error {
+	switch {
+	case s.TotalSize > 0 && size > 0 && s.TotalSize != size:
+		return fmt.Errorf("%w: size %d -> %d", ErrRemoteChanged, s.TotalSize, size)
+	case s.ETag != "" && etag != "" && s.ETag != etag:
+		return fmt.Errorf("%w: etag %s -> %s", ErrRemoteChanged, s.ETag, etag)
+	case s.LastModified != "" && lastModified != "" && s.LastModified != lastModified:
+		return fmt.Errorf("%w: last-modified %s -> %s", ErrRemoteChanged, s.LastModified, lastModified)
+	}
+	return nil
+}
+
+// IfRange returns the validator to send in an If-Range header: the ETag when it
+// is strong (weak ETags aren't allowed there), otherwise Last-Modified.
+func IfRange(etag, lastModified string) string {
+	if etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return lastModified
+}
+
+// PieceHashes are the digests of consecutive pieces of a file, as published
+// in a metalink. Every piece is Length bytes except possibly the last.
+type PieceHashes struct {
+	Algorithm string   // Canonical checksum algorithm name, e.g. "sha256"
+	Length    int64    // Piece size in bytes
+	Hashes    []string // Lowercase hex digest of each piece, in order
+}
+
+// Count returns how many pieces a file of size bytes has
+func (p *PieceHashes) Count(size int64) int {
+	if p.Length <= 0 {
+		return 0
+	}
+	return int((size + p.Length - 1) / p.Length)
 }
 
 // DownloadEntry represents a download in the master list
@@ -43,6 +107,18 @@ type DownloadEntry struct {
 	TimeTaken   int64    `json:"time_taken"`   // Duration in milliseconds (for completed)
 	AvgSpeed    float64  `json:"avg_speed"`    // Average speed in bytes/sec (for completed)
 	Mirrors     []string `json:"mirrors,omitempty"`
+	RateLimit   int64    `json:"rate_limit,omitempty"` // Per-download bandwidth limit in bytes/sec
+
+	Checksum       string `json:"checksum,omitempty"`        // Expected digest ("algo:hex")
+	ChecksumStatus string `json:"checksum_status,omitempty"` // "verified" or "mismatch" once checked
+
+	Priority   Priority `json:"priority,omitempty"`
+	QueueOrder int64    `json:"queue_order,omitempty"`
+
+	BatchID  string `json:"batch_id,omitempty"` // Downloads added together, e.g. by "surge mirror"
+	Category string `json:"category,omitempty"`
+
+	HookOutput string `json:"hook_output,omitempty"` // What the completion or error hooks printed
 }
 
 // MasterList holds all tracked downloads
@@ -62,9 +138,56 @@ type DownloadStatus struct {
 	Speed       float64 `json:"speed"`    // MB/s
 	Status      string  `json:"status"`   // "queued", "paused", "downloading", "completed", "error"
 	Error       string  `json:"error,omitempty"`
-	ETA         int64   `json:"eta"`         // Estimated seconds remaining
-	Connections int     `json:"connections"` // Active connections
-	AddedAt     int64   `json:"added_at"`    // Unix timestamp when added
-	TimeTaken   int64   `json:"time_taken"`  // Duration in milliseconds (completed only)
-	AvgSpeed    float64 `json:"avg_speed"`   // Average speed in bytes/sec (completed only)
+	ETA         int64   `json:"eta"`                  // Estimated seconds remaining
+	Connections int     `json:"connections"`          // Active connections
+	AddedAt     int64   `json:"added_at"`             // Unix timestamp when added
+	TimeTaken   int64   `json:"time_taken"`           // Duration in milliseconds (completed only)
+	AvgSpeed    float64 `json:"avg_speed"`            // Average speed in bytes/sec (completed only)
+	RateLimit   int64   `json:"rate_limit,omitempty"` // Per-download bandwidth limit in bytes/sec
+
+	Checksum       string `json:"checksum,omitempty"`        // Expected digest ("algo:hex")
+	ChecksumStatus string `json:"checksum_status,omitempty"` // "verified" or "mismatch" once checked
+
+	Priority      string `json:"priority,omitempty"`       // "high", "normal" or "low"
+	QueuePosition int    `json:"queue_position,omitempty"` // 1-based place in the queue while queued
+
+	BatchID   string `json:"batch_id,omitempty"`
+	BatchName string `json:"batch_name,omitempty"`
+	Category  string `json:"category,omitempty"`
+
+	HookOutput string `json:"hook_output,omitempty"` // What the completion or error hooks printed
+}
+
+// Batch is a group of downloads added together, e.g. from a batch file or by
+// "surge mirror"
+type Batch struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"created_at"` // Unix timestamp
+}
+
+// BatchStatus sums up the downloads of a batch
+type BatchStatus struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Status     string   `json:"status"` // "downloading", "queued", "paused", "error" or "completed"
+	Count      int      `json:"count"`
+	Completed  int      `json:"completed"`
+	Failed     int      `json:"failed,omitempty"`
+	TotalSize  int64    `json:"total_size"`
+	Downloaded int64    `json:"downloaded"`
+	Progress   float64  `json:"progress"` // Percentage 0-100
+	Speed      float64  `json:"speed"`    // MB/s
+	ETA        int64    `json:"eta"`      // Estimated seconds remaining
+	CreatedAt  int64    `json:"created_at,omitempty"`
+	IDs        []string `json:"ids"`
+}
+
+// VerifyResult is the outcome of re-hashing a finished or paused download
+type VerifyResult struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`             // "verified", "mismatch", "repaired" or "requeued"
+	Pieces   int    `json:"pieces,omitempty"`   // Pieces hashed, 0 when only the whole file was checked
+	Failed   int    `json:"failed,omitempty"`   // Pieces that didn't match
+	Repaired int    `json:"repaired,omitempty"` // Pieces fetched again and now matching
 }
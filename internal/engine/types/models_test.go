@@ -0,0 +1,56 @@
+package types
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDownloadState_ValidateRemote(t *testing.T) {
+	saved := &DownloadState{
+		TotalSize:    1000,
+		ETag:         `"abc"`,
+		LastModified: "Mon, 02 Jan 2006 15:04:05 GMT",
+	}
+
+	tests := []struct {
+		name         string
+		size         int64
+		etag         string
+		lastModified string
+		changed      bool
+	}{
+		{"unchanged", 1000, `"abc"`, "Mon, 02 Jan 2006 15:04:05 GMT", false},
+		{"validators missing", 1000, "", "", false},
+		{"size changed", 2000, `"abc"`, "Mon, 02 Jan 2006 15:04:05 GMT", true},
+		{"etag changed", 1000, `"def"`, "Mon, 02 Jan 2006 15:04:05 GMT", true},
+		{"last-modified changed", 1000, "", "Tue, 03 Jan 2006 15:04:05 GMT", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := saved.ValidateRemote(tt.size, tt.etag, tt.lastModified)
+			if got := errors.Is(err, ErrRemoteChanged); got != tt.changed {
+				t.Errorf("ValidateRemote() = %v, changed = %v", err, tt.changed)
+			}
+		})
+	}
+
+	// States saved before validators were recorded are never rejected on them
+	legacy := &DownloadState{TotalSize: 1000}
+	if err := legacy.ValidateRemote(1000, `"abc"`, "Mon, 02 Jan 2006 15:04:05 GMT"); err != nil {
+		t.Errorf("legacy state: unexpected error %v", err)
+	}
+}
+
+func TestIfRange(t *testing.T) {
+	const lm = "Mon, 02 Jan 2006 15:04:05 GMT"
+	if got := IfRange(`"abc"`, lm); got != `"abc"` {
+		t.Errorf("strong etag: got %q", got)
+	}
+	if got := IfRange(`W/"abc"`, lm); got != lm {
+		t.Errorf("weak etag should fall back to Last-Modified, got %q", got)
+	}
+	if got := IfRange("", ""); got != "" {
+		t.Errorf("no validators: got %q", got)
+	}
+}
@@ -0,0 +1,50 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Priority decides which queued downloads start first
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// String returns "high", "normal" or "low"
+func (p Priority) String() string {
+	switch {
+	case p > PriorityNormal:
+		return "high"
+	case p < PriorityNormal:
+		return "low"
+	default:
+		return "normal"
+	}
+}
+
+// ParsePriority parses "high", "normal" or "low" (case-insensitive)
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "high":
+		return PriorityHigh, nil
+	case "normal", "":
+		return PriorityNormal, nil
+	case "low":
+		return PriorityLow, nil
+	}
+	return PriorityNormal, fmt.Errorf("invalid priority %q (want high, normal or low)", s)
+}
+
+// QueuedBefore reports whether a download with priority p and queue order
+// order starts before one with priority q and queue order qOrder. Higher
+// priorities go first; within a priority the lower queue order wins.
+func QueuedBefore(p Priority, order int64, q Priority, qOrder int64) bool {
+	if p != q {
+		return p > q
+	}
+	return order < qOrder
+}
@@ -0,0 +1,48 @@
+package types
+
+import "testing"
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Priority
+		wantErr bool
+	}{
+		{"high", PriorityHigh, false},
+		{"HIGH", PriorityHigh, false},
+		{" low ", PriorityLow, false},
+		{"normal", PriorityNormal, false},
+		{"", PriorityNormal, false},
+		{"urgent", PriorityNormal, true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePriority(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePriority(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParsePriority(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+		if !tt.wantErr && tt.in != "" {
+			if back, _ := ParsePriority(got.String()); back != got {
+				t.Errorf("String() of %v does not round-trip", got)
+			}
+		}
+	}
+}
+
+func TestQueuedBefore(t *testing.T) {
+	if !QueuedBefore(PriorityHigh, 100, PriorityNormal, 1) {
+		t.Error("higher priority should start first regardless of order")
+	}
+	if QueuedBefore(PriorityLow, 1, PriorityNormal, 100) {
+		t.Error("lower priority should start later regardless of order")
+	}
+	if !QueuedBefore(PriorityNormal, 1, PriorityNormal, 2) {
+		t.Error("lower queue order should start first within a priority")
+	}
+	if QueuedBefore(PriorityNormal, 2, PriorityNormal, 2) {
+		t.Error("equal entries are not ordered")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
@@ -36,6 +37,23 @@ type ProgressState struct {
 	ActualChunkSize int64   // Size of each actual chunk in bytes
 	BitmapWidth     int     // Number of chunks tracked
 
+	// Bandwidth limiting
+	limiter       *ratelimit.Limiter // Per-download limit (rate 0 = unlimited)
+	globalLimiter *ratelimit.Limiter // Shared limit across all downloads (set by the pool)
+
+	checksum string // Expected digest, kept here so pause state can persist it
+
+	// Queue placement, kept here so pause state can persist it
+	priority   Priority
+	queueOrder int64
+
+	batchID  string
+	category string
+
+	// Adaptive connection count, shown in the TUI
+	targetConns int
+	connsReason string
+
 	mu sync.Mutex // Protects TotalSize, StartTime, SessionStartBytes, SavedElapsed, Mirrors
 }
 
@@ -74,6 +92,7 @@ func NewProgressState(id string, totalSize int64) *ProgressState {
 		ID:        id,
 		TotalSize: totalSize,
 		StartTime: time.Now(),
+		limiter:   ratelimit.New(0),
 	}
 }
 
@@ -231,6 +250,131 @@ func (ps *ProgressState) GetMirrors() []MirrorStatus {
 	return mirrors
 }
 
+// SetRateLimit changes the per-download bandwidth limit in bytes/sec (0 = unlimited).
+// Takes effect immediately for a running download.
+func (ps *ProgressState) SetRateLimit(bytesPerSec int64) {
+	ps.mu.Lock()
+	if ps.limiter == nil {
+		ps.limiter = ratelimit.New(0)
+	}
+	l := ps.limiter
+	ps.mu.Unlock()
+	l.SetRate(bytesPerSec)
+}
+
+// GetRateLimit returns the per-download bandwidth limit in bytes/sec (0 = unlimited)
+func (ps *ProgressState) GetRateLimit() int64 {
+	ps.mu.Lock()
+	l := ps.limiter
+	ps.mu.Unlock()
+	return l.Rate()
+}
+
+// SetChecksum sets the expected digest of the finished file ("algo:hex")
+func (ps *ProgressState) SetChecksum(checksum string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.checksum = checksum
+}
+
+// GetChecksum returns the expected digest of the finished file, or ""
+func (ps *ProgressState) GetChecksum() string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.checksum
+}
+
+// SetPriority records the download's queue priority and order
+func (ps *ProgressState) SetPriority(priority Priority, queueOrder int64) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.priority = priority
+	ps.queueOrder = queueOrder
+}
+
+// GetPriority returns the download's queue priority and order
+func (ps *ProgressState) GetPriority() (Priority, int64) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.priority, ps.queueOrder
+}
+
+// SetBatchID records the batch the download was added in
+func (ps *ProgressState) SetBatchID(batchID string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.batchID = batchID
+}
+
+// GetBatchID returns the download's batch, or ""
+func (ps *ProgressState) GetBatchID() string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.batchID
+}
+
+// SetCategory records the category the download is filed under
+func (ps *ProgressState) SetCategory(category string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.category = category
+}
+
+// GetCategory returns the download's category, or ""
+func (ps *ProgressState) GetCategory() string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.category
+}
+
+// SetConnectionTarget records the worker count chosen by the connection tuner and why
+func (ps *ProgressState) SetConnectionTarget(n int, reason string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.targetConns = n
+	ps.connsReason = reason
+}
+
+// GetConnectionTarget returns the tuner's worker count and the reason for the last change
+func (ps *ProgressState) GetConnectionTarget() (int, string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.targetConns, ps.connsReason
+}
+
+// SetGlobalLimiter attaches the limiter shared by every download in the pool
+func (ps *ProgressState) SetGlobalLimiter(l *ratelimit.Limiter) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.globalLimiter = l
+}
+
+func (ps *ProgressState) limiters() (*ratelimit.Limiter, *ratelimit.Limiter) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.limiter, ps.globalLimiter
+}
+
+// WaitBandwidth blocks until n bytes may be consumed under both the
+// per-download and global limits. Returns ctx.Err() if cancelled while waiting.
+func (ps *ProgressState) WaitBandwidth(ctx context.Context, n int) error {
+	local, global := ps.limiters()
+	return ratelimit.Wait(ctx, n, local, global)
+}
+
+// BandwidthChunk returns the read size workers should use so limited
+// transfers stay smooth. Returns max when no limit is active.
+func (ps *ProgressState) BandwidthChunk(max int) int {
+	local, global := ps.limiters()
+	return ratelimit.ChunkSize(max, local, global)
+}
+
+// IsThrottled reports whether a bandwidth limit currently applies to this download
+func (ps *ProgressState) IsThrottled() bool {
+	local, global := ps.limiters()
+	return ratelimit.AnyLimited(local, global)
+}
+
 // ChunkStatus represents the status of a visualization chunk
 type ChunkStatus int
 
@@ -238,6 +382,7 @@ const (
 	ChunkPending     ChunkStatus = 0 // 00
 	ChunkDownloading ChunkStatus = 1 // 01
 	ChunkCompleted   ChunkStatus = 2 // 10 (Bit 2 set)
+	ChunkFailed      ChunkStatus = 3 // 11 Failed piece verification, waiting to be fetched again
 )
 
 // InitBitmap initializes the chunk bitmap
@@ -431,6 +576,20 @@ func (ps *ProgressState) UpdateChunkStatus(offset, length int64, status ChunkSta
 			if current != ChunkCompleted {
 				ps.setChunkState(i, ChunkDownloading)
 			}
+		case ChunkPending, ChunkFailed:
+			// Bytes were thrown away (a piece that failed verification) and
+			// have to be fetched again
+			decrement := min(overlap, ps.ChunkProgress[i])
+			ps.ChunkProgress[i] -= decrement
+			ps.VerifiedProgress.Add(-decrement)
+			switch {
+			case status == ChunkFailed:
+				ps.setChunkState(i, ChunkFailed)
+			case ps.ChunkProgress[i] > 0:
+				ps.setChunkState(i, ChunkDownloading)
+			default:
+				ps.setChunkState(i, ChunkPending)
+			}
 		}
 	}
 }
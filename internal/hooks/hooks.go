@@ -0,0 +1,156 @@
+// Package hooks runs the commands and webhooks configured for finished
+// downloads.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+)
+
+const (
+	EventComplete = "complete"
+	EventError    = "error"
+)
+
+// maxOutput caps how much of a hook's output is kept
+const maxOutput = 4096
+
+// Event describes the download a hook runs for
+type Event struct {
+	Type     string `json:"event"` // EventComplete or EventError
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	Path     string `json:"path"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	Hash     string `json:"hash,omitempty"`  // Expected checksum, "algo:hex"
+	Error    string `json:"error,omitempty"` // Why the download failed
+	BatchID  string `json:"batch_id,omitempty"`
+}
+
+// Env returns the event as SURGE_* environment variables
+func (e Event) Env() []string {
+	return []string{
+		"SURGE_EVENT=" + e.Type,
+		"SURGE_ID=" + e.ID,
+		"SURGE_URL=" + e.URL,
+		"SURGE_PATH=" + e.Path,
+		"SURGE_FILENAME=" + e.Filename,
+		"SURGE_SIZE=" + strconv.FormatInt(e.Size, 10),
+		"SURGE_HASH=" + e.Hash,
+		"SURGE_ERROR=" + e.Error,
+		"SURGE_BATCH_ID=" + e.BatchID,
+	}
+}
+
+// Configured reports whether h runs anything for an event of the given type
+func Configured(h config.HookSettings, eventType string) bool {
+	return h.WebhookURL != "" || command(h, eventType) != ""
+}
+
+func command(h config.HookSettings, eventType string) string {
+	if eventType == EventError {
+		return h.OnError
+	}
+	return h.OnComplete
+}
+
+// Run runs the command for the event's type and posts the event to the
+// webhook, whichever of them are set. It returns their combined output,
+// which is kept even when a hook fails.
+func Run(ctx context.Context, h config.HookSettings, ev Event) (string, error) {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = config.DefaultHookTimeout
+	}
+
+	var outputs []string
+	var errs []error
+	if c := command(h, ev.Type); c != "" {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		out, err := runCommand(ctx, c, ev)
+		cancel()
+		if out != "" {
+			outputs = append(outputs, out)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("command: %w", err))
+		}
+	}
+	if h.WebhookURL != "" {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		out, err := postWebhook(ctx, h.WebhookURL, ev)
+		cancel()
+		if out != "" {
+			outputs = append(outputs, out)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		}
+	}
+	return strings.Join(outputs, "\n"), errors.Join(errs...)
+}
+
+func runCommand(ctx context.Context, command string, ev Event) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), ev.Env()...)
+	// Don't wait for children of the shell that keep the output open
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out")
+	}
+	return truncate(strings.TrimSpace(string(out))), err
+}
+
+func postWebhook(ctx context.Context, url string, ev Event) (string, error) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, maxOutput))
+	out := "webhook: " + resp.Status
+	if text := strings.TrimSpace(string(reply)); text != "" {
+		out += "\n" + text
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return truncate(out), fmt.Errorf("server returned %s", resp.Status)
+	}
+	return truncate(out), nil
+}
+
+func truncate(s string) string {
+	if len(s) > maxOutput {
+		return s[:maxOutput] + "…"
+	}
+	return s
+}
@@ -0,0 +1,101 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+)
+
+var testEvent = Event{
+	Type:     EventComplete,
+	ID:       "3f2a1c9e",
+	URL:      "https://example.com/file.iso",
+	Path:     "/downloads/file.iso",
+	Filename: "file.iso",
+	Size:     1024,
+	Hash:     "sha256:abcd",
+}
+
+func TestRun_Command(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+
+	out, err := Run(context.Background(), config.HookSettings{
+		OnComplete: `echo "$SURGE_EVENT $SURGE_FILENAME $SURGE_SIZE $SURGE_HASH"`,
+		OnError:    "echo should not run",
+	}, testEvent)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if out != "complete file.iso 1024 sha256:abcd" {
+		t.Errorf("output = %q", out)
+	}
+
+	ev := testEvent
+	ev.Type = EventError
+	ev.Error = "connection reset"
+	out, err = Run(context.Background(), config.HookSettings{OnError: `echo "$SURGE_ERROR"; exit 3`}, ev)
+	if err == nil || out != "connection reset" {
+		t.Errorf("Run = %q, %v; want the output and the exit status", out, err)
+	}
+
+	// Nothing configured for this event
+	out, err = Run(context.Background(), config.HookSettings{OnError: "echo nope"}, testEvent)
+	if out != "" || err != nil {
+		t.Errorf("Run = %q, %v; want nothing run", out, err)
+	}
+}
+
+func TestRun_Timeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+
+	start := time.Now()
+	_, err := Run(context.Background(), config.HookSettings{OnComplete: "sleep 5", Timeout: 100 * time.Millisecond}, testEvent)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("the hook ran for %v despite the timeout", time.Since(start))
+	}
+}
+
+func TestRun_Webhook(t *testing.T) {
+	var got Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte("queued for processing"))
+	}))
+	defer server.Close()
+
+	out, err := Run(context.Background(), config.HookSettings{WebhookURL: server.URL}, testEvent)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if got != testEvent {
+		t.Errorf("payload = %+v, want %+v", got, testEvent)
+	}
+	if !strings.Contains(out, "200 OK") || !strings.Contains(out, "queued for processing") {
+		t.Errorf("output = %q", out)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	if _, err := Run(context.Background(), config.HookSettings{WebhookURL: failing.URL}, testEvent); err == nil {
+		t.Error("expected an error for a failing webhook")
+	}
+}
@@ -0,0 +1,450 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// FTPTLSMode selects how an FTPServer encrypts connections
+type FTPTLSMode int
+
+const (
+	FTPPlain    FTPTLSMode = iota // No TLS (ftp://)
+	FTPExplicit                   // AUTH TLS on the control connection (ftpes://)
+	FTPImplicit                   // TLS from the first byte (ftps://)
+)
+
+// FTPServer is an in-process FTP server for download testing. It serves
+// files from memory in passive mode and supports SIZE, MDTM, REST and TLS.
+type FTPServer struct {
+	listener net.Listener
+
+	// Configuration
+	User           string        // Required user name; empty accepts anyone
+	Password       string        // Required password when User is set
+	SupportsRest   bool          // Whether REST is accepted
+	SupportsEPSV   bool          // Whether EPSV is accepted; PASV always is
+	MaxConnections int           // Control connections allowed at once (0 = unlimited)
+	ChunkLatency   time.Duration // Delay per 32KB written to a data connection
+	TLSMode        FTPTLSMode
+
+	// Tracking
+	Logins       atomic.Int64
+	ActiveConns  atomic.Int64
+	PeakConns    atomic.Int64
+	Rejected     atomic.Int64 // Connections refused with 421
+	Retrievals   atomic.Int64
+	RestCommands atomic.Int64
+	BytesServed  atomic.Int64
+
+	mu       sync.Mutex
+	files    map[string][]byte
+	modTimes map[string]string
+	tls      *tls.Config
+	wg       sync.WaitGroup
+	closed   chan struct{}
+}
+
+// FTPServerOption is a function that configures an FTPServer.
+type FTPServerOption func(*FTPServer)
+
+// WithFTPCredentials requires a user name and password to log in.
+func WithFTPCredentials(user, password string) FTPServerOption {
+	return func(s *FTPServer) {
+		s.User = user
+		s.Password = password
+	}
+}
+
+// WithFTPRest enables or disables REST support.
+func WithFTPRest(enabled bool) FTPServerOption {
+	return func(s *FTPServer) {
+		s.SupportsRest = enabled
+	}
+}
+
+// WithFTPEPSV enables or disables EPSV, leaving only PASV.
+func WithFTPEPSV(enabled bool) FTPServerOption {
+	return func(s *FTPServer) {
+		s.SupportsEPSV = enabled
+	}
+}
+
+// WithFTPMaxConnections refuses control connections above n with 421.
+func WithFTPMaxConnections(n int) FTPServerOption {
+	return func(s *FTPServer) {
+		s.MaxConnections = n
+	}
+}
+
+// WithFTPLatency adds a delay per 32KB sent on data connections.
+func WithFTPLatency(d time.Duration) FTPServerOption {
+	return func(s *FTPServer) {
+		s.ChunkLatency = d
+	}
+}
+
+// WithFTPTLS serves FTPS with a self-signed certificate.
+func WithFTPTLS(mode FTPTLSMode) FTPServerOption {
+	return func(s *FTPServer) {
+		s.TLSMode = mode
+	}
+}
+
+// NewFTPServerT starts an FTP server on 127.0.0.1 and closes it when the
+// test ends. The test is skipped if binding fails.
+func NewFTPServerT(t *testing.T, opts ...FTPServerOption) *FTPServer {
+	t.Helper()
+	s := &FTPServer{
+		SupportsRest: true,
+		SupportsEPSV: true,
+		files:        make(map[string][]byte),
+		modTimes:     make(map[string]string),
+		closed:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.TLSMode != FTPPlain {
+		cfg, err := selfSignedTLS()
+		if err != nil {
+			t.Fatalf("failed to create certificate: %v", err)
+		}
+		s.tls = cfg
+	}
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("tcp4 listener unavailable: %v", err)
+		return nil
+	}
+	s.listener = ln
+
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// AddFile serves data under name, reported by MDTM as modTime
+// (YYYYMMDDhhmmss; empty for a fixed default).
+func (s *FTPServer) AddFile(name string, data []byte, modTime string) {
+	if modTime == "" {
+		modTime = "20240301120000"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[strings.TrimPrefix(name, "/")] = data
+	s.modTimes[strings.TrimPrefix(name, "/")] = modTime
+}
+
+// URL returns the URL of name on this server with the scheme matching TLSMode.
+func (s *FTPServer) URL(name string) string {
+	scheme := "ftp"
+	switch s.TLSMode {
+	case FTPExplicit:
+		scheme = "ftpes"
+	case FTPImplicit:
+		scheme = "ftps"
+	}
+	auth := ""
+	if s.User != "" {
+		auth = s.User + ":" + s.Password + "@"
+	}
+	return fmt.Sprintf("%s://%s%s/%s", scheme, auth, s.listener.Addr().String(), strings.TrimPrefix(name, "/"))
+}
+
+// Close stops the server and waits for open sessions to end.
+func (s *FTPServer) Close() {
+	select {
+	case <-s.closed:
+		return
+	default:
+	}
+	close(s.closed)
+	_ = s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *FTPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// ftpSession is the state of one control connection
+type ftpSession struct {
+	conn     net.Conn
+	text     *textproto.Conn
+	user     string
+	loggedIn bool
+	protect  bool
+	rest     int64
+	passive  net.Listener
+}
+
+func (s *FTPServer) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	active := s.ActiveConns.Add(1)
+	defer s.ActiveConns.Add(-1)
+	if s.MaxConnections > 0 && active > int64(s.MaxConnections) {
+		s.Rejected.Add(1)
+		_, _ = fmt.Fprintf(conn, "421 Too many connections\r\n")
+		return
+	}
+	for {
+		peak := s.PeakConns.Load()
+		if active <= peak || s.PeakConns.CompareAndSwap(peak, active) {
+			break
+		}
+	}
+
+	if s.TLSMode == FTPImplicit {
+		conn = tls.Server(conn, s.tls)
+	}
+	sess := &ftpSession{conn: conn, text: textproto.NewConn(conn)}
+	defer func() {
+		if sess.passive != nil {
+			_ = sess.passive.Close()
+		}
+	}()
+
+	// Unblock reads when the server shuts down
+	go func() {
+		<-s.closed
+		_ = conn.Close()
+	}()
+
+	s.reply(sess, 220, "Surge test FTP server ready")
+	for {
+		line, err := sess.text.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		if !s.command(sess, strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+func (s *FTPServer) reply(sess *ftpSession, code int, msg string) {
+	_ = sess.text.PrintfLine("%d %s", code, msg)
+}
+
+// command handles one command and returns false when the session ends
+func (s *FTPServer) command(sess *ftpSession, cmd, arg string) bool {
+	switch cmd {
+	case "QUIT":
+		s.reply(sess, 221, "Bye")
+		return false
+	case "AUTH":
+		if s.TLSMode != FTPExplicit || !strings.EqualFold(arg, "TLS") {
+			s.reply(sess, 502, "TLS not available")
+			return true
+		}
+		s.reply(sess, 234, "AUTH TLS OK")
+		sess.conn = tls.Server(sess.conn, s.tls)
+		sess.text = textproto.NewConn(sess.conn)
+		return true
+	case "USER":
+		sess.user = arg
+		s.reply(sess, 331, "Password required")
+		return true
+	case "PASS":
+		if s.User != "" && (sess.user != s.User || arg != s.Password) {
+			s.reply(sess, 530, "Login incorrect")
+			return true
+		}
+		sess.loggedIn = true
+		s.Logins.Add(1)
+		s.reply(sess, 230, "Logged in")
+		return true
+	case "FEAT":
+		s.reply(sess, 211, "No features")
+		return true
+	}
+
+	if !sess.loggedIn {
+		s.reply(sess, 530, "Please login")
+		return true
+	}
+
+	switch cmd {
+	case "PBSZ":
+		s.reply(sess, 200, "PBSZ=0")
+	case "PROT":
+		sess.protect = strings.EqualFold(arg, "P")
+		s.reply(sess, 200, "Protection set")
+	case "TYPE":
+		s.reply(sess, 200, "Type set")
+	case "NOOP":
+		s.reply(sess, 200, "OK")
+	case "SIZE":
+		if data, ok := s.file(arg); ok {
+			s.reply(sess, 213, strconv.Itoa(len(data)))
+		} else {
+			s.reply(sess, 550, "No such file")
+		}
+	case "MDTM":
+		s.mu.Lock()
+		modTime, ok := s.modTimes[strings.TrimPrefix(arg, "/")]
+		s.mu.Unlock()
+		if ok {
+			s.reply(sess, 213, modTime)
+		} else {
+			s.reply(sess, 550, "No such file")
+		}
+	case "REST":
+		offset, err := strconv.ParseInt(arg, 10, 64)
+		if !s.SupportsRest || err != nil || offset < 0 {
+			s.reply(sess, 502, "REST not supported")
+			return true
+		}
+		sess.rest = offset
+		s.RestCommands.Add(1)
+		s.reply(sess, 350, "Restarting at "+arg)
+	case "EPSV", "PASV":
+		if cmd == "EPSV" && !s.SupportsEPSV {
+			s.reply(sess, 502, "EPSV not supported")
+			return true
+		}
+		if sess.passive != nil {
+			_ = sess.passive.Close()
+		}
+		ln, err := net.Listen("tcp4", "127.0.0.1:0")
+		if err != nil {
+			s.reply(sess, 425, "Can't open data connection")
+			return true
+		}
+		sess.passive = ln
+		port := ln.Addr().(*net.TCPAddr).Port
+		if cmd == "EPSV" {
+			s.reply(sess, 229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+		} else {
+			// A bogus address: clients should use the control connection's host
+			s.reply(sess, 227, fmt.Sprintf("Entering Passive Mode (10,0,0,1,%d,%d)", port>>8, port&0xff))
+		}
+	case "RETR":
+		s.retr(sess, arg)
+	default:
+		s.reply(sess, 502, "Command not implemented")
+	}
+	return true
+}
+
+func (s *FTPServer) file(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[strings.TrimPrefix(name, "/")]
+	return data, ok
+}
+
+func (s *FTPServer) retr(sess *ftpSession, name string) {
+	offset := sess.rest
+	sess.rest = 0
+
+	data, ok := s.file(name)
+	if !ok {
+		s.reply(sess, 550, "No such file")
+		return
+	}
+	if sess.passive == nil {
+		s.reply(sess, 425, "Use PASV or EPSV first")
+		return
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	s.Retrievals.Add(1)
+
+	ln := sess.passive
+	sess.passive = nil
+	defer func() { _ = ln.Close() }()
+
+	s.reply(sess, 150, "Opening BINARY mode data connection")
+	_ = ln.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+	dc, err := ln.Accept()
+	if err != nil {
+		s.reply(sess, 425, "Data connection failed")
+		return
+	}
+	defer func() { _ = dc.Close() }()
+	if sess.protect && s.tls != nil {
+		tlsConn := tls.Server(dc, s.tls)
+		if err := tlsConn.Handshake(); err != nil {
+			s.reply(sess, 522, "Data connection TLS failed")
+			return
+		}
+		dc = tlsConn
+	}
+
+	const chunk = 32 * 1024
+	for pos := offset; pos < int64(len(data)); pos += chunk {
+		end := min(pos+chunk, int64(len(data)))
+		n, err := dc.Write(data[pos:end])
+		s.BytesServed.Add(int64(n))
+		if err != nil {
+			s.reply(sess, 426, "Connection closed; transfer aborted")
+			return
+		}
+		if s.ChunkLatency > 0 {
+			select {
+			case <-s.closed:
+				return
+			case <-time.After(s.ChunkLatency):
+			}
+		}
+	}
+	_ = dc.Close()
+	s.reply(sess, 226, "Transfer complete")
+}
+
+// selfSignedTLS creates a certificate for 127.0.0.1
+func selfSignedTLS() (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "surge-test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}, nil
+}
@@ -0,0 +1,383 @@
+package testutil
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPServer is an in-process SSH server with the SFTP subsystem for
+// download testing. It serves read-only files from memory and accepts the
+// client key written by SetupClientT.
+type SFTPServer struct {
+	listener  net.Listener
+	hostKey   ssh.Signer
+	clientKey ed25519.PrivateKey
+
+	// Configuration
+	User        string        // Required user name
+	Password    string        // Accepted as an alternative to the client key when set
+	ReadLatency time.Duration // Delay per read request
+	DropAfter   int64         // Close every connection once this many bytes are served (0 = never)
+
+	// Tracking
+	Connections  atomic.Int64 // Successful logins
+	OpenHandles  atomic.Int64
+	PeakHandles  atomic.Int64 // Most files open at once
+	Reads        atomic.Int64
+	BytesServed  atomic.Int64
+	Disconnected atomic.Int64 // Connections closed by DropAfter
+
+	mu      sync.Mutex
+	files   map[string]*sftpTestFile
+	conns   map[net.Conn]struct{}
+	dropped bool
+	wg      sync.WaitGroup
+	closed  chan struct{}
+}
+
+type sftpTestFile struct {
+	name    string
+	data    []byte
+	modTime time.Time
+}
+
+// SFTPServerOption is a function that configures an SFTPServer.
+type SFTPServerOption func(*SFTPServer)
+
+// WithSFTPPassword also accepts password logins.
+func WithSFTPPassword(password string) SFTPServerOption {
+	return func(s *SFTPServer) {
+		s.Password = password
+	}
+}
+
+// WithSFTPLatency adds a delay to every read request.
+func WithSFTPLatency(d time.Duration) SFTPServerOption {
+	return func(s *SFTPServer) {
+		s.ReadLatency = d
+	}
+}
+
+// WithSFTPDropAfter closes all connections once, after n bytes were served.
+func WithSFTPDropAfter(n int64) SFTPServerOption {
+	return func(s *SFTPServer) {
+		s.DropAfter = n
+	}
+}
+
+// NewSFTPServerT starts an SFTP server on 127.0.0.1 and closes it when the
+// test ends. The test is skipped if binding fails.
+func NewSFTPServerT(t *testing.T, opts ...SFTPServerOption) *SFTPServer {
+	t.Helper()
+	s := &SFTPServer{
+		User:   "surge",
+		files:  make(map[string]*sftpTestFile),
+		conns:  make(map[net.Conn]struct{}),
+		closed: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %v", err)
+	}
+	if s.hostKey, err = ssh.NewSignerFromKey(hostPriv); err != nil {
+		t.Fatalf("failed to create host key signer: %v", err)
+	}
+	if _, s.clientKey, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		t.Fatalf("failed to generate client key: %v", err)
+	}
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("tcp4 listener unavailable: %v", err)
+		return nil
+	}
+	s.listener = ln
+
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// SetupClientT points HOME at a temporary directory whose .ssh holds a key
+// the server accepts and a known_hosts entry for the server, and disables
+// the SSH agent for the rest of the test. It returns the .ssh directory.
+func (s *SFTPServer) SetupClientT(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.MkdirAll(sshDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(s.clientKey, "surge-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sshDir, "id_ed25519"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	line := knownhosts.Line([]string{s.listener.Addr().String()}, s.hostKey.PublicKey())
+	if err := os.WriteFile(filepath.Join(sshDir, "known_hosts"), []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return sshDir
+}
+
+// AddFile serves data at the absolute path name with the given modification time.
+func (s *SFTPServer) AddFile(name string, data []byte, modTime time.Time) {
+	name = path.Clean("/" + name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = &sftpTestFile{name: path.Base(name), data: data, modTime: modTime}
+}
+
+// URL returns the sftp:// URL of name for the server's user.
+func (s *SFTPServer) URL(name string) string {
+	return fmt.Sprintf("sftp://%s@%s%s", s.User, s.listener.Addr().String(), path.Clean("/"+name))
+}
+
+// Close stops the server and waits for open sessions to end.
+func (s *SFTPServer) Close() {
+	select {
+	case <-s.closed:
+		return
+	default:
+	}
+	close(s.closed)
+	_ = s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *SFTPServer) serverConfig() *ssh.ServerConfig {
+	clientPub, _ := ssh.NewPublicKey(s.clientKey.Public())
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() == s.User && string(key.Marshal()) == string(clientPub.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", meta.User())
+		},
+	}
+	if s.Password != "" {
+		config.PasswordCallback = func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == s.User && string(password) == s.Password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("wrong password for %s", meta.User())
+		}
+	}
+	config.AddHostKey(s.hostKey)
+	return config
+}
+
+func (s *SFTPServer) serve() {
+	defer s.wg.Done()
+	config := s.serverConfig()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				_ = conn.Close()
+			}()
+			s.handle(conn, config)
+		}()
+	}
+}
+
+func (s *SFTPServer) handle(conn net.Conn, config *ssh.ServerConfig) {
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer func() { _ = sshConn.Close() }()
+	s.Connections.Add(1)
+	go ssh.DiscardRequests(reqs)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { _ = channel.Close() }()
+			for req := range requests {
+				// The payload is the length-prefixed subsystem name
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if ok {
+					go ssh.DiscardRequests(requests)
+					server := sftp.NewRequestServer(channel, sftp.Handlers{
+						FileGet:  s,
+						FilePut:  s,
+						FileCmd:  s,
+						FileList: s,
+					})
+					_ = server.Serve()
+					_ = server.Close()
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (s *SFTPServer) lookup(name string) (*sftpTestFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.files[path.Clean(name)]; ok {
+		return f, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// Fileread opens a file for reading.
+func (s *SFTPServer) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	f, err := s.lookup(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	open := s.OpenHandles.Add(1)
+	for {
+		peak := s.PeakHandles.Load()
+		if open <= peak || s.PeakHandles.CompareAndSwap(peak, open) {
+			break
+		}
+	}
+	return &sftpTestReader{s: s, file: f}, nil
+}
+
+// Filewrite rejects uploads; the server is read-only.
+func (s *SFTPServer) Filewrite(*sftp.Request) (io.WriterAt, error) {
+	return nil, os.ErrPermission
+}
+
+// Filecmd rejects changes; the server is read-only.
+func (s *SFTPServer) Filecmd(*sftp.Request) error {
+	return os.ErrPermission
+}
+
+// Filelist answers Stat requests.
+func (s *SFTPServer) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	if r.Method != "Stat" && r.Method != "Lstat" {
+		return nil, os.ErrPermission
+	}
+	f, err := s.lookup(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	return sftpTestLister{sftpTestFileInfo{f}}, nil
+}
+
+// dropConnections closes every connection the first time it is called
+func (s *SFTPServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dropped {
+		return
+	}
+	s.dropped = true
+	for conn := range s.conns {
+		_ = conn.Close()
+		s.Disconnected.Add(1)
+	}
+}
+
+type sftpTestReader struct {
+	s    *SFTPServer
+	file *sftpTestFile
+}
+
+func (r *sftpTestReader) ReadAt(p []byte, off int64) (int, error) {
+	r.s.Reads.Add(1)
+	if r.s.ReadLatency > 0 {
+		time.Sleep(r.s.ReadLatency)
+	}
+	if off >= int64(len(r.file.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.file.data[off:])
+	if served := r.s.BytesServed.Add(int64(n)); r.s.DropAfter > 0 && served >= r.s.DropAfter {
+		r.s.dropConnections()
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *sftpTestReader) Close() error {
+	r.s.OpenHandles.Add(-1)
+	return nil
+}
+
+type sftpTestFileInfo struct {
+	file *sftpTestFile
+}
+
+func (fi sftpTestFileInfo) Name() string       { return fi.file.name }
+func (fi sftpTestFileInfo) Size() int64        { return int64(len(fi.file.data)) }
+func (fi sftpTestFileInfo) Mode() os.FileMode  { return 0o644 }
+func (fi sftpTestFileInfo) ModTime() time.Time { return fi.file.modTime }
+func (fi sftpTestFileInfo) IsDir() bool        { return false }
+func (fi sftpTestFileInfo) Sys() any           { return nil }
+
+type sftpTestLister []os.FileInfo
+
+func (l sftpTestLister) ListAt(dst []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(dst, l[offset:])
+	if n < len(dst) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,273 @@
+package testutil
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// StreamVariant is one rendition served by a StreamServer
+type StreamVariant struct {
+	Name      string // Path prefix, e.g. "720p"
+	Bandwidth int64
+	Width     int
+	Height    int
+}
+
+// StreamServer serves an HLS master playlist (/master.m3u8) with a media
+// playlist per variant (/<name>/index.m3u8), and the same renditions as a
+// DASH presentation (/manifest.mpd). Segments are generated from the
+// variant name and index so each variant's output is distinct.
+type StreamServer struct {
+	*httptest.Server
+
+	// Configuration
+	Variants     []StreamVariant
+	SegmentCount int
+	SegmentSize  int
+	Encrypt      bool          // Encrypt HLS segments with AES-128
+	Latency      time.Duration // Delay before each segment response
+	MediaSeq     int64         // EXT-X-MEDIA-SEQUENCE of the media playlists
+
+	// Tracking
+	SegmentRequests atomic.Int64
+	InFlight        atomic.Int64
+	PeakInFlight    atomic.Int64
+	KeyRequests     atomic.Int64
+
+	key     []byte
+	mu      sync.Mutex
+	hit     map[string]int
+	removed map[string]bool
+}
+
+// StreamServerOption is a function that configures a StreamServer.
+type StreamServerOption func(*StreamServer)
+
+// WithStreamEncryption encrypts the HLS segments with AES-128.
+func WithStreamEncryption() StreamServerOption {
+	return func(s *StreamServer) {
+		s.Encrypt = true
+	}
+}
+
+// WithStreamLatency delays every segment response.
+func WithStreamLatency(d time.Duration) StreamServerOption {
+	return func(s *StreamServer) {
+		s.Latency = d
+	}
+}
+
+// WithStreamSegments sets the number and size of segments per variant.
+func WithStreamSegments(count, size int) StreamServerOption {
+	return func(s *StreamServer) {
+		s.SegmentCount = count
+		s.SegmentSize = size
+	}
+}
+
+// NewStreamServerT starts a stream server that is closed when the test ends.
+func NewStreamServerT(t *testing.T, opts ...StreamServerOption) *StreamServer {
+	t.Helper()
+	s := &StreamServer{
+		Variants: []StreamVariant{
+			{Name: "360p", Bandwidth: 400_000, Width: 640, Height: 360},
+			{Name: "1080p", Bandwidth: 2_400_000, Width: 1920, Height: 1080},
+			{Name: "720p", Bandwidth: 1_200_000, Width: 1280, Height: 720},
+		},
+		SegmentCount: 12,
+		SegmentSize:  64 * 1024,
+		MediaSeq:     7,
+		key:          []byte("0123456789abcdef"),
+		hit:          make(map[string]int),
+		removed:      make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Segment returns the plain content of segment index of a variant. Index -1
+// is the DASH initialization segment.
+func (s *StreamServer) Segment(variant string, index int) []byte {
+	pattern := []byte(fmt.Sprintf("[%s #%d]", variant, index))
+	size := s.SegmentSize + index // Uneven sizes catch ordering mistakes
+	if index < 0 {
+		size = 100
+	}
+	return bytes.Repeat(pattern, size/len(pattern)+1)[:size]
+}
+
+// Expected returns what the merged HLS download of a variant contains
+func (s *StreamServer) Expected(variant string) []byte {
+	var out []byte
+	for i := 0; i < s.SegmentCount; i++ {
+		out = append(out, s.Segment(variant, i)...)
+	}
+	return out
+}
+
+// ExpectedDASH returns what the merged DASH download of a variant contains
+func (s *StreamServer) ExpectedDASH(variant string) []byte {
+	return append(s.Segment(variant, -1), s.Expected(variant)...)
+}
+
+// Hits returns how often path was requested
+func (s *StreamServer) Hits(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hit[path]
+}
+
+// Remove makes path answer 404 while the playlists still list it
+func (s *StreamServer) Remove(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removed[path] = true
+}
+
+func (s *StreamServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.hit[r.URL.Path]++
+	removed := s.removed[r.URL.Path]
+	s.mu.Unlock()
+	if removed {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case path == "master.m3u8":
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		_, _ = w.Write([]byte(s.masterPlaylist()))
+	case path == "manifest.mpd":
+		w.Header().Set("Content-Type", "application/dash+xml")
+		_, _ = w.Write([]byte(s.mpd()))
+	case path == "key.bin":
+		s.KeyRequests.Add(1)
+		_, _ = w.Write(s.key)
+	case strings.HasSuffix(path, "/index.m3u8"):
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		_, _ = w.Write([]byte(s.mediaPlaylist()))
+	default:
+		s.serveSegment(w, r, path)
+	}
+}
+
+func (s *StreamServer) masterPlaylist() string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, v := range s.Variants {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=\"avc1.4d401f,mp4a.40.2\"\n%s/index.m3u8\n",
+			v.Bandwidth, v.Width, v.Height, v.Name)
+	}
+	return b.String()
+}
+
+func (s *StreamServer) mediaPlaylist() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:%d\n", s.MediaSeq)
+	if s.Encrypt {
+		b.WriteString("#EXT-X-KEY:METHOD=AES-128,URI=\"/key.bin\"\n")
+	}
+	for i := 0; i < s.SegmentCount; i++ {
+		fmt.Fprintf(&b, "#EXTINF:4.000,\nseg%d.ts\n", i)
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
+
+func (s *StreamServer) mpd() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT%dS" minBufferTime="PT2S">
+  <Period>
+    <AdaptationSet contentType="audio" mimeType="audio/mp4">
+      <SegmentTemplate media="audio/$Number$.m4s" initialization="audio/init.mp4" duration="4" startNumber="0"/>
+      <Representation id="audio" bandwidth="128000"/>
+    </AdaptationSet>
+    <AdaptationSet contentType="video" mimeType="video/mp4">
+      <SegmentTemplate media="$RepresentationID$/chunk-$Number%%03d$.m4s" initialization="$RepresentationID$/init.mp4" timescale="1000" duration="4000" startNumber="0"/>
+`, s.SegmentCount*4)
+	for _, v := range s.Variants {
+		fmt.Fprintf(&b, "      <Representation id=\"%s\" bandwidth=\"%d\" width=\"%d\" height=\"%d\"/>\n", v.Name, v.Bandwidth, v.Width, v.Height)
+	}
+	b.WriteString("    </AdaptationSet>\n  </Period>\n</MPD>\n")
+	return b.String()
+}
+
+// serveSegment serves <variant>/seg<N>.ts, <variant>/chunk-<NNN>.m4s and
+// <variant>/init.mp4
+func (s *StreamServer) serveSegment(w http.ResponseWriter, r *http.Request, path string) {
+	variant, name, ok := strings.Cut(path, "/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var (
+		index int
+		err   error
+		hls   bool
+	)
+	switch {
+	case name == "init.mp4":
+		index = -1
+	case strings.HasPrefix(name, "seg") && strings.HasSuffix(name, ".ts"):
+		index, err = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "seg"), ".ts"))
+		hls = true
+	case strings.HasPrefix(name, "chunk-") && strings.HasSuffix(name, ".m4s"):
+		index, err = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "chunk-"), ".m4s"))
+	default:
+		err = fmt.Errorf("unknown segment")
+	}
+	if err != nil || index >= s.SegmentCount {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.SegmentRequests.Add(1)
+	inFlight := s.InFlight.Add(1)
+	defer s.InFlight.Add(-1)
+	for {
+		peak := s.PeakInFlight.Load()
+		if inFlight <= peak || s.PeakInFlight.CompareAndSwap(peak, inFlight) {
+			break
+		}
+	}
+	if s.Latency > 0 {
+		time.Sleep(s.Latency)
+	}
+
+	data := s.Segment(variant, index)
+	if hls && s.Encrypt {
+		data = s.encrypt(data, s.MediaSeq+int64(index))
+	}
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+}
+
+// encrypt applies HLS AES-128 with the sequence number as IV
+func (s *StreamServer) encrypt(data []byte, sequence int64) []byte {
+	block, _ := aes.NewCipher(s.key)
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(sequence))
+
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	padded := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	out := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+	return out
+}
@@ -0,0 +1,239 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/surge-downloader/surge/internal/tui/components"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// BatchItem implements list.Item for the header row of a batch in the
+// grouped view. Its totals cover every download of the batch, whichever tab
+// they are in.
+type BatchItem struct {
+	ID        string
+	Name      string
+	Downloads []*DownloadModel
+	Collapsed bool
+}
+
+func (i BatchItem) Title() string {
+	marker := "▾"
+	if i.Collapsed {
+		marker = "▸"
+	}
+	name := i.Name
+	if name == "" {
+		name = "Batch " + shortBatchID(i.ID)
+	}
+	return fmt.Sprintf("%s %s (%d)", marker, name, len(i.Downloads))
+}
+
+// batchTotals adds up the downloads of a batch
+type batchTotals struct {
+	done, failed, paused, active int
+	downloaded, total            int64
+	speed                        float64 // bytes per second
+}
+
+func (i BatchItem) totals() batchTotals {
+	var t batchTotals
+	for _, d := range i.Downloads {
+		t.downloaded += d.Downloaded
+		t.total += d.Total
+		switch {
+		case d.err != nil:
+			t.failed++
+			t.done++
+		case d.done:
+			t.done++
+		case d.paused || d.pausing:
+			t.paused++
+		default:
+			t.active++
+			t.speed += d.Speed
+		}
+	}
+	return t
+}
+
+func (i BatchItem) Description() string {
+	t := i.totals()
+	allDone := t.done == len(i.Downloads)
+	status := components.DetermineStatus(allDone, t.active == 0 && t.paused > 0, allDone && t.failed > 0, t.speed, t.downloaded).Render()
+
+	pct := 0.0
+	if t.total > 0 {
+		pct = float64(t.downloaded) / float64(t.total) * 100
+	}
+	info := fmt.Sprintf("%s • %d/%d done • %.0f%%", status, t.done, len(i.Downloads), pct)
+	if t.speed > 0 {
+		info += fmt.Sprintf(" • %.2f MB/s", t.speed/Megabyte)
+		if remaining := t.total - t.downloaded; remaining > 0 {
+			info += " • ETA " + formatDurationForUI(time.Duration(float64(remaining)/t.speed)*time.Second)
+		}
+	}
+	return info + " • " + utils.ConvertBytesToHumanReadable(t.total)
+}
+
+func (i BatchItem) FilterValue() string {
+	return i.Name
+}
+
+func shortBatchID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// batchMembers returns every download of a batch
+func (m *RootModel) batchMembers(batchID string) []*DownloadModel {
+	var members []*DownloadModel
+	for _, d := range m.downloads {
+		if d.BatchID == batchID {
+			members = append(members, d)
+		}
+	}
+	return members
+}
+
+// groupedItems lists the downloads of the current tab with the ones of a
+// batch under its header, at the place of the batch's first download.
+// Members of a collapsed batch are left out.
+func (m *RootModel) groupedItems(filtered []*DownloadModel) []list.Item {
+	var items []list.Item
+	seen := make(map[string]bool)
+	for _, d := range filtered {
+		if d.BatchID == "" {
+			items = append(items, DownloadItem{download: d})
+			continue
+		}
+		if seen[d.BatchID] {
+			continue
+		}
+		seen[d.BatchID] = true
+
+		header := BatchItem{
+			ID:        d.BatchID,
+			Name:      d.BatchName,
+			Downloads: m.batchMembers(d.BatchID),
+			Collapsed: m.collapsedBatches[d.BatchID],
+		}
+		items = append(items, header)
+		if header.Collapsed {
+			continue
+		}
+		for _, member := range filtered {
+			if member.BatchID == d.BatchID {
+				items = append(items, DownloadItem{download: member, inBatch: true})
+			}
+		}
+	}
+	return items
+}
+
+// GetSelectedBatch returns the batch whose header is selected, or nil
+func (m *RootModel) GetSelectedBatch() *BatchItem {
+	if item := m.list.SelectedItem(); item != nil {
+		if bi, ok := item.(BatchItem); ok {
+			return &bi
+		}
+	}
+	return nil
+}
+
+// toggleBatchPause pauses a batch with anything still running, and resumes
+// one where everything unfinished is paused
+func (m *RootModel) toggleBatchPause(b *BatchItem) {
+	if b.totals().active > 0 {
+		for _, d := range b.Downloads {
+			if d.done || d.paused || d.pausing {
+				continue
+			}
+			if err := m.Service.Pause(d.ID); err != nil {
+				m.addLogEntry(LogStyleError.Render("✖ Pause failed: " + err.Error()))
+				continue
+			}
+			d.resuming = false
+			d.pausing = true
+		}
+		return
+	}
+
+	var ids []string
+	var paused []*DownloadModel
+	for _, d := range b.Downloads {
+		if !d.done && d.paused {
+			ids = append(ids, d.ID)
+			paused = append(paused, d)
+		}
+	}
+	for i, err := range m.Service.ResumeBatch(ids) {
+		if err != nil {
+			m.addLogEntry(LogStyleError.Render("✖ Resume failed: " + err.Error()))
+			continue
+		}
+		paused[i].paused = false
+		paused[i].resuming = true
+	}
+}
+
+// deleteBatch removes every download of a batch
+func (m *RootModel) deleteBatch(b *BatchItem) {
+	for _, d := range b.Downloads {
+		if err := m.Service.Delete(d.ID); err != nil {
+			m.addLogEntry(LogStyleError.Render("✖ Delete failed: " + err.Error()))
+			continue
+		}
+		m.removeDownloadByID(d.ID)
+	}
+}
+
+// renderBatchDetails renders the detail pane for a selected batch header
+func renderBatchDetails(b *BatchItem, w int) string {
+	contentWidth := w - 4
+	if contentWidth < 0 {
+		contentWidth = 0
+	}
+	t := b.totals()
+
+	name := b.Name
+	if name == "" {
+		name = "Batch " + shortBatchID(b.ID)
+	}
+	title := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ColorGray).
+		Width(contentWidth).
+		Align(lipgloss.Center).
+		Render(truncateString(name, contentWidth-2))
+
+	pct := 0.0
+	if t.total > 0 {
+		pct = float64(t.downloaded) / float64(t.total)
+	}
+	eta := "∞"
+	switch {
+	case t.done == len(b.Downloads):
+		eta = "Done"
+	case t.speed > 0 && t.total > t.downloaded:
+		eta = formatDurationForUI(time.Duration(float64(t.total-t.downloaded)/t.speed) * time.Second)
+	}
+
+	row := func(label, value string) string {
+		return lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Width(11).Render(label), StatsValueStyle.Render(value))
+	}
+	stats := lipgloss.NewStyle().Width(contentWidth).Padding(0, 1).Render(lipgloss.JoinVertical(lipgloss.Left,
+		row("ID:", b.ID),
+		row("Downloads:", fmt.Sprintf("%d (%d active, %d paused, %d done, %d failed)", len(b.Downloads), t.active, t.paused, t.done-t.failed, t.failed)),
+		row("Progress:", fmt.Sprintf("%.0f%%", pct*100)),
+		row("Size:", fmt.Sprintf("%s / %s", utils.ConvertBytesToHumanReadable(t.downloaded), utils.ConvertBytesToHumanReadable(t.total))),
+		row("Speed:", fmt.Sprintf("%.2f MB/s", t.speed/Megabyte)),
+		row("ETA:", eta),
+	))
+	return lipgloss.JoinVertical(lipgloss.Left, title, "", stats)
+}
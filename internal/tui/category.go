@@ -0,0 +1,74 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/surge-downloader/surge/internal/tui/components"
+)
+
+// categoryNames returns the configured categories in the order they are
+// cycled through
+func (m RootModel) categoryNames() []string {
+	if m.Settings == nil {
+		return nil
+	}
+	names := make([]string, 0, len(m.Settings.Categories))
+	for _, c := range m.Settings.Categories {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// cycleCategoryFilter moves the category filter on to the next category,
+// and back to showing all downloads after the last one
+func (m *RootModel) cycleCategoryFilter() {
+	names := m.categoryNames()
+	next := ""
+	if m.categoryFilter == "" {
+		if len(names) > 0 {
+			next = names[0]
+		}
+	} else {
+		for i, name := range names {
+			if strings.EqualFold(name, m.categoryFilter) && i+1 < len(names) {
+				next = names[i+1]
+			}
+		}
+	}
+	m.categoryFilter = next
+}
+
+// inCategory reports whether a download passes the category filter
+func (m RootModel) inCategory(d *DownloadModel) bool {
+	return m.categoryFilter == "" || strings.EqualFold(d.Category, m.categoryFilter)
+}
+
+// renderCategoryTab renders the tab showing the category filter and how
+// many downloads it lets through, or "" when no categories are configured
+func (m RootModel) renderCategoryTab() string {
+	if len(m.categoryNames()) == 0 {
+		return ""
+	}
+	tab := components.Tab{Label: "All", Count: -1}
+	active := -1
+	if m.categoryFilter != "" {
+		tab = components.Tab{Label: m.categoryFilter}
+		for _, d := range m.downloads {
+			if m.inCategory(d) {
+				tab.Count++
+			}
+		}
+		active = 0
+	}
+	tab.Label = "◆ " + tab.Label
+	return components.RenderTabBar([]components.Tab{tab}, active, ActiveTabStyle, TabStyle)
+}
+
+// withCategoryTab adds the category tab to the right of the status tabs
+func (m RootModel) withCategoryTab(tabBar string) string {
+	if tab := m.renderCategoryTab(); tab != "" {
+		return lipgloss.JoinHorizontal(lipgloss.Top, tabBar, " ", tab)
+	}
+	return tabBar
+}
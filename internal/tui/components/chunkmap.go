@@ -115,6 +115,7 @@ func (m ChunkMapModel) View() string {
 		var downloadedInBlock int64
 		allCompleted := true
 		hasApproximateProgress := false
+		failed := false
 
 		for cIdx := startChunkIdx; cIdx <= endChunkIdx; cIdx++ {
 			chunkStartByte := int64(cIdx) * m.ActualChunkSize
@@ -126,6 +127,9 @@ func (m ChunkMapModel) View() string {
 			if state != types.ChunkCompleted {
 				allCompleted = false
 			}
+			if state == types.ChunkFailed {
+				failed = true
+			}
 
 			// Intersection of Chunk and VisualBlock
 			intersectStart := blockStartByte
@@ -182,7 +186,10 @@ func (m ChunkMapModel) View() string {
 		}
 
 		// Determine Status
-		if allCompleted || (!hasApproximateProgress && downloadedInBlock >= blockSize) {
+		if failed {
+			// A bad piece stands out until it has been fetched again
+			visualChunks[i] = types.ChunkFailed
+		} else if allCompleted || (!hasApproximateProgress && downloadedInBlock >= blockSize) {
 			visualChunks[i] = types.ChunkCompleted
 		} else if downloadedInBlock > 0 {
 			// If we have ANY bytes in this visual block, it is "Downloading" (or Paused Partial)
@@ -200,6 +207,7 @@ func (m ChunkMapModel) View() string {
 	downloadingStyle := lipgloss.NewStyle().Foreground(colors.NeonPink)       // Neon Pink
 	pausedStyle := lipgloss.NewStyle().Foreground(colors.StatePaused)         // Yellow/Gold for paused Partial
 	completedStyle := lipgloss.NewStyle().Foreground(colors.StateDownloading) // Neon Green / Cyan
+	failedStyle := lipgloss.NewStyle().Foreground(colors.StateError)          // Red
 
 	block := "■"
 
@@ -219,6 +227,8 @@ func (m ChunkMapModel) View() string {
 			} else {
 				s.WriteString(downloadingStyle.Render(block))
 			}
+		case types.ChunkFailed:
+			s.WriteString(failedStyle.Render(block))
 		default: // ChunkPending
 			s.WriteString(pendingStyle.Render(block))
 		}
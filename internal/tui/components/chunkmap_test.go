@@ -250,3 +250,25 @@ func TestChunkMap_BlockTurnsCompletedWhenItsByteRangeIsFullyDownloaded(t *testin
 		t.Errorf("Row 0 should not be Downloading (pink) when fully covered by downloaded bytes")
 	}
 }
+
+func TestChunkMap_FailedPiece(t *testing.T) {
+	chunkCount := 4
+	bitmap := make([]byte, 1)
+	for i := 0; i < chunkCount; i++ {
+		setChunk(bitmap, i, int(types.ChunkCompleted))
+	}
+	progress := []int64{1024, 1024, 1024, 1024}
+	healthy := NewChunkMapModel(bitmap, chunkCount, 8, 0, false, 4096, 1024, progress).View()
+
+	setChunk(bitmap, 2, int(types.ChunkFailed))
+	progress[2] = 0
+	out := NewChunkMapModel(bitmap, chunkCount, 8, 0, false, 4096, 1024, progress).View()
+
+	failed := lipgloss.NewStyle().Foreground(colors.StateError).Render("■")
+	if !strings.Contains(out, failed) {
+		t.Error("a failed chunk should render in the error color")
+	}
+	if strings.Contains(healthy, failed) {
+		t.Error("completed chunks should not render as failed")
+	}
+}
@@ -15,6 +15,7 @@ const (
 	StatusPaused
 	StatusComplete
 	StatusError
+	StatusSkipped
 )
 
 // statusInfo holds the display properties for each status
@@ -30,6 +31,7 @@ var statusMap = map[DownloadStatus]statusInfo{
 	StatusPaused:      {"⏸", "Paused", colors.StatePaused},
 	StatusComplete:    {"✔", "Completed", colors.StateDone},
 	StatusError:       {"✖", "Error", colors.StateError},
+	StatusSkipped:     {"↷", "Skipped", colors.StateDone},
 }
 
 // Icon returns the status icon
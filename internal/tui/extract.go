@@ -0,0 +1,31 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Values of DownloadModel.ExtractStatus
+const (
+	extractRunning = "extracting"
+	extractDone    = "extracted"
+	extractFailed  = "failed"
+)
+
+// extractInfo summarizes the unpacking of a finished archive, or returns ""
+// when nothing was unpacked
+func extractInfo(d *DownloadModel) string {
+	switch d.ExtractStatus {
+	case extractRunning:
+		if d.ExtractTotal > 0 {
+			return fmt.Sprintf("⇲ Extracting %.0f%%", float64(d.ExtractDone)/float64(d.ExtractTotal)*100)
+		}
+		return "⇲ Extracting " + utils.ConvertBytesToHumanReadable(d.ExtractDone)
+	case extractDone:
+		return "✔ Extracted"
+	case extractFailed:
+		return "✖ Extract failed"
+	}
+	return ""
+}
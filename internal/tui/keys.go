@@ -22,6 +22,7 @@ type DashboardKeyMap struct {
 	TabActive   key.Binding
 	TabDone     key.Binding
 	NextTab     key.Binding
+	Category    key.Binding
 	Add         key.Binding
 	BatchImport key.Binding
 	Search      key.Binding
@@ -31,6 +32,11 @@ type DashboardKeyMap struct {
 	Log         key.Binding
 	History     key.Binding
 	OpenFile    key.Binding
+	RateLimit   key.Binding
+	MoveUp      key.Binding
+	MoveDown    key.Binding
+	Group       key.Binding
+	Collapse    key.Binding
 	Quit        key.Binding
 	ForceQuit   key.Binding
 	// Navigation
@@ -142,6 +148,10 @@ var Keys = KeyMap{
 			key.WithKeys("tab"),
 			key.WithHelp("tab", "next tab"),
 		),
+		Category: key.NewBinding(
+			key.WithKeys("c"),
+			key.WithHelp("c", "category filter"),
+		),
 		Add: key.NewBinding(
 			key.WithKeys("a"),
 			key.WithHelp("a", "add download"),
@@ -178,6 +188,26 @@ var Keys = KeyMap{
 			key.WithKeys("o"),
 			key.WithHelp("o", "open file"),
 		),
+		RateLimit: key.NewBinding(
+			key.WithKeys("t"),
+			key.WithHelp("t", "speed limit"),
+		),
+		MoveUp: key.NewBinding(
+			key.WithKeys("K", "shift+up"),
+			key.WithHelp("K", "move up in queue"),
+		),
+		MoveDown: key.NewBinding(
+			key.WithKeys("J", "shift+down"),
+			key.WithHelp("J", "move down in queue"),
+		),
+		Group: key.NewBinding(
+			key.WithKeys("v"),
+			key.WithHelp("v", "group by batch"),
+		),
+		Collapse: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "expand/collapse batch"),
+		),
 		Quit: key.NewBinding(
 			key.WithKeys("ctrl+c", "ctrl+q"),
 			key.WithHelp("ctrl+q", "quit"),
@@ -415,9 +445,9 @@ func (k DashboardKeyMap) ShortHelp() []key.Binding {
 // FullHelp returns keybindings for the expanded help view
 func (k DashboardKeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.TabQueued, k.TabActive, k.TabDone, k.NextTab},
-		{k.Add, k.Search, k.Pause, k.Delete, k.Settings},
-		{k.Log, k.History, k.Quit},
+		{k.TabQueued, k.TabActive, k.TabDone, k.NextTab, k.Category},
+		{k.Add, k.Search, k.Pause, k.Delete, k.RateLimit, k.Settings},
+		{k.MoveUp, k.MoveDown, k.Group, k.Collapse, k.Log, k.History, k.Quit},
 	}
 }
 
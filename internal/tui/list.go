@@ -17,6 +17,7 @@ import (
 // DownloadItem implements list.Item interface for downloads
 type DownloadItem struct {
 	download *DownloadModel
+	inBatch  bool // Listed under its batch's header in the grouped view
 }
 
 func (i DownloadItem) Title() string {
@@ -33,6 +34,8 @@ func (i DownloadItem) Description() string {
 		styledStatus = lipgloss.NewStyle().Foreground(colors.StatePaused).Render("⏸ Pausing...")
 	} else if d.resuming {
 		styledStatus = lipgloss.NewStyle().Foreground(colors.StateDownloading).Render("▶ Resuming...")
+	} else if d.skipped {
+		styledStatus = components.StatusSkipped.Render()
 	} else {
 		styledStatus = components.DetermineStatus(d.done, d.paused, d.err != nil, d.Speed, d.Downloaded).Render()
 	}
@@ -53,7 +56,11 @@ func (i DownloadItem) Description() string {
 		speedInfo = fmt.Sprintf(" • %.2f MB/s", d.Speed/Megabyte)
 	}
 
-	return fmt.Sprintf("%s • %.0f%%%s • %s", styledStatus, pct, speedInfo, sizeInfo)
+	info := fmt.Sprintf("%s • %.0f%%%s • %s", styledStatus, pct, speedInfo, sizeInfo)
+	if extract := extractInfo(d); extract != "" {
+		info += " • " + extract
+	}
+	return info
 }
 
 func (i DownloadItem) FilterValue() string {
@@ -97,8 +104,19 @@ func (d downloadDelegate) Update(msg tea.Msg, m *list.Model) tea.Cmd {
 }
 
 func (d downloadDelegate) Render(w io.Writer, m list.Model, index int, listItem list.Item) {
-	i, ok := listItem.(DownloadItem)
-	if !ok {
+	var (
+		title, desc string
+		indent      string
+	)
+	switch i := listItem.(type) {
+	case DownloadItem:
+		title, desc = i.Title(), i.Description()
+		if i.inBatch {
+			indent = "  "
+		}
+	case BatchItem:
+		title, desc = i.Title(), i.Description()
+	default:
 		return
 	}
 
@@ -130,19 +148,18 @@ func (d downloadDelegate) Render(w io.Writer, m list.Model, index int, listItem
 	}
 
 	// Truncate title if needed
-	width := m.Width() - 6
+	width := m.Width() - 6 - len(indent)
 	if width < 20 {
 		width = 20
 	}
-	title := i.Title()
 	maxTitleWidth := width - 10
 	if len(title) > maxTitleWidth {
 		title = title[:maxTitleWidth-3] + "..."
 	}
 
 	// Render lines
-	line1 := prefix + titleStyle.Render(title)
-	line2 := prefix + descStyle.Render(i.Description())
+	line1 := prefix + indent + titleStyle.Render(title)
+	line2 := prefix + indent + descStyle.Render(desc)
 
 	_, _ = fmt.Fprintf(w, "%s\n%s", line1, line2)
 }
@@ -197,12 +214,7 @@ func (m *RootModel) UpdateListItems() {
 	// If the user manually switched tabs, don't try to preserve/follow selection
 	if m.ManualTabSwitch {
 		m.ManualTabSwitch = false
-		filtered := m.getFilteredDownloads()
-		items := make([]list.Item, len(filtered))
-		for i, d := range filtered {
-			items[i] = DownloadItem{download: d}
-		}
-		m.list.SetItems(items)
+		m.list.SetItems(m.listItems())
 		// Reset cursor to top when manually switching tabs (standard behavior)
 		m.list.Select(0)
 		return
@@ -210,21 +222,28 @@ func (m *RootModel) UpdateListItems() {
 
 	// Capture currently selected ID if we don't have a forced one
 	targetID := m.SelectedDownloadID
+	targetBatch := ""
 	if targetID == "" {
 		if d := m.GetSelectedDownload(); d != nil {
 			targetID = d.ID
+		} else if b := m.GetSelectedBatch(); b != nil {
+			targetBatch = b.ID
 		}
 	}
 
-	filtered := m.getFilteredDownloads()
-	items := make([]list.Item, len(filtered))
-	for i, d := range filtered {
-		items[i] = DownloadItem{download: d}
-	}
+	items := m.listItems()
 	m.list.SetItems(items)
 
 	// Restore selection
 	found := false
+	if targetBatch != "" {
+		for i, item := range items {
+			if bi, ok := item.(BatchItem); ok && bi.ID == targetBatch {
+				m.list.Select(i)
+				break
+			}
+		}
+	}
 	if targetID != "" {
 		for i, item := range items {
 			if di, ok := item.(DownloadItem); ok {
@@ -272,6 +291,20 @@ func (m *RootModel) UpdateListItems() {
 	m.SelectedDownloadID = ""
 }
 
+// listItems returns the list rows of the current tab, grouped by batch when
+// the grouped view is on
+func (m *RootModel) listItems() []list.Item {
+	filtered := m.getFilteredDownloads()
+	if m.groupBatches {
+		return m.groupedItems(filtered)
+	}
+	items := make([]list.Item, len(filtered))
+	for i, d := range filtered {
+		items[i] = DownloadItem{download: d}
+	}
+	return items
+}
+
 // GetSelectedDownload returns the currently selected download from the list
 func (m *RootModel) GetSelectedDownload() *DownloadModel {
 	if item := m.list.SelectedItem(); item != nil {
@@ -36,6 +36,7 @@ const (
 	BatchFilePickerState                      // BatchFilePickerState is 9
 	BatchConfirmState                         // BatchConfirmState is 10
 	UpdateAvailableState                      // UpdateAvailableState is 11
+	RateLimitInputState                       // RateLimitInputState is 12
 )
 
 const (
@@ -54,6 +55,21 @@ type DownloadModel struct {
 	Downloaded    int64
 	Speed         float64
 	Connections   int
+	TargetConns   int    // Worker count chosen by the connection tuner
+	ConnsReason   string // Why it last changed
+	RateLimit     int64  // Per-download bandwidth limit in bytes/sec (0 = unlimited)
+	Checksum      string // "verified" or "mismatch" once the finished file was checked
+	Priority      string // Queue priority: "high", "normal" or "low"
+	BatchID       string // Batch the download was added in, if any
+	BatchName     string
+	Category      string // Category the download is filed under, if any
+
+	// Unpacking of a finished archive
+	ExtractStatus string // "extracting", "extracted" or "failed"
+	ExtractDir    string
+	ExtractDone   int64
+	ExtractTotal  int64 // 0 when unknown
+	ExtractError  string
 
 	StartTime time.Time
 	Elapsed   time.Duration
@@ -66,6 +82,7 @@ type DownloadModel struct {
 	state *types.ProgressState // Keep for now if needed for details view, but mostly passive
 
 	done     bool
+	skipped  bool // Done without downloading, the file was already there
 	err      error
 	paused   bool
 	pausing  bool // UI state: transitioning to pause
@@ -104,6 +121,8 @@ type RootModel struct {
 	pendingFilename string   // Filename pending confirmation
 	pendingMirrors  []string // Mirrors pending confirmation
 	pendingHeaders  map[string]string
+	pendingChecksum string // Expected checksum pending confirmation
+	pendingOptions  *types.AddOptions
 	duplicateInfo   string // Info about the duplicate
 
 	// Graph Data
@@ -133,10 +152,20 @@ type RootModel struct {
 	searchActive bool            // Whether search mode is active
 	searchQuery  string          // Current search query
 
+	categoryFilter string // Only downloads of this category are listed, "" for all
+
+	// Per-download bandwidth limit editing
+	rateLimitInput    textinput.Model // Input for the limit in MB/s
+	rateLimitTargetID string          // Download being limited
+
 	// Batch import
 	pendingBatchURLs []string // URLs pending batch import
 	batchFilePath    string   // Path to the batch file
 
+	// Grouped view: downloads of a batch under one collapsible header
+	groupBatches     bool
+	collapsedBatches map[string]bool // Batch ID -> header collapsed
+
 	// Keybindings
 	keys KeyMap
 
@@ -145,6 +174,10 @@ type RootModel struct {
 	ServerHost string
 	IsRemote   bool
 
+	// Bandwidth schedule
+	ScheduleProfile string // Active schedule profile ("" when scheduling is disabled)
+	SchedulePaused  bool   // Whether the active profile pauses downloads
+
 	// Update check
 	UpdateInfo     *version.UpdateInfo // Update information (nil if no update available)
 	CurrentVersion string              // Current version of Surge
@@ -243,6 +276,10 @@ func InitialRootModel(serverPort int, currentVersion string, service core.Downlo
 				case "completed":
 					dm.done = true
 					dm.progress.SetPercent(1.0)
+				case "skipped":
+					dm.done = true
+					dm.skipped = true
+					dm.progress.SetPercent(1.0)
 				case "pausing":
 					dm.pausing = true
 				case "paused":
@@ -266,6 +303,12 @@ func InitialRootModel(serverPort int, currentVersion string, service core.Downlo
 				} else if s.Speed > 0 {
 					dm.Speed = s.Speed * Megabyte
 				}
+				dm.RateLimit = s.RateLimit
+				dm.Checksum = s.ChecksumStatus
+				dm.Priority = s.Priority
+				dm.BatchID = s.BatchID
+				dm.BatchName = s.BatchName
+				dm.Category = s.Category
 				if s.Status == "completed" && s.TimeTaken > 0 {
 					dm.Elapsed = time.Duration(s.TimeTaken) * time.Millisecond
 				}
@@ -288,6 +331,12 @@ func InitialRootModel(serverPort int, currentVersion string, service core.Downlo
 	settingsInput.Width = 40
 	settingsInput.Prompt = ""
 
+	// Initialize rate limit input
+	rateLimitInput := textinput.New()
+	rateLimitInput.Placeholder = "0 = unlimited"
+	rateLimitInput.Width = 20
+	rateLimitInput.Prompt = ""
+
 	// Initialize search input
 	searchInput := textinput.New()
 	searchInput.Placeholder = "Type to search..."
@@ -309,6 +358,8 @@ func InitialRootModel(serverPort int, currentVersion string, service core.Downlo
 		Settings:              settings,
 		SettingsInput:         settingsInput,
 		searchInput:           searchInput,
+		rateLimitInput:        rateLimitInput,
+		collapsedBatches:      make(map[string]bool),
 		keys:                  Keys,
 		ServerPort:            serverPort,
 		CurrentVersion:        currentVersion,
@@ -400,6 +451,10 @@ func (m RootModel) getFilteredDownloads() []*DownloadModel {
 			}
 		}
 
+		if !m.inCategory(d) {
+			continue
+		}
+
 		// Apply search filter if query is set
 		if m.searchQuery != "" {
 			if !strings.Contains(strings.ToLower(d.FilenameLower), searchLower) {
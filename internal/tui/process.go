@@ -19,6 +19,8 @@ func (m *RootModel) processProgressMsg(msg events.ProgressMsg) {
 			d.Speed = msg.Speed
 			d.Elapsed = msg.Elapsed
 			d.Connections = msg.ActiveConnections
+			d.TargetConns = msg.TargetConnections
+			d.ConnsReason = msg.ConnectionReason
 
 			// Keep "Resuming..." visible until we observe actual transfer.
 			if d.resuming && (d.Speed > 0 || d.Downloaded > prevDownloaded) {
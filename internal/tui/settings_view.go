@@ -9,6 +9,7 @@ import (
 
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/tui/components"
+	"github.com/surge-downloader/surge/internal/utils"
 
 	"github.com/charmbracelet/lipgloss"
 )
@@ -254,6 +255,12 @@ func (m RootModel) getSettingsValues(category string) map[string]interface{} {
 		values["auto_resume"] = m.Settings.General.AutoResume
 		values["skip_update_check"] = m.Settings.General.SkipUpdateCheck
 		values["preserve_url_path"] = m.Settings.General.PreserveURLPath
+		values["path_template"] = m.Settings.General.PathTemplate
+		values["conflict_policy"] = m.Settings.General.ConflictPolicy
+		values["discover_checksums"] = m.Settings.General.DiscoverChecksums
+		values["stream_variant"] = m.Settings.General.StreamVariant
+		values["auto_extract"] = m.Settings.General.AutoExtract
+		values["delete_after_extract"] = m.Settings.General.DeleteAfterExtract
 
 		values["clipboard_monitor"] = m.Settings.General.ClipboardMonitor
 		values["theme"] = m.Settings.General.Theme
@@ -265,16 +272,32 @@ func (m RootModel) getSettingsValues(category string) map[string]interface{} {
 		values["max_concurrent_downloads"] = m.Settings.Network.MaxConcurrentDownloads
 		values["user_agent"] = m.Settings.Network.UserAgent
 		values["proxy_url"] = m.Settings.Network.ProxyURL
+		values["cookies_file"] = m.Settings.Network.CookiesFile
+		values["netrc_file"] = m.Settings.Network.NetrcFile
 		values["sequential_download"] = m.Settings.Network.SequentialDownload
 		values["min_chunk_size"] = m.Settings.Network.MinChunkSize
 		values["worker_buffer_size"] = m.Settings.Network.WorkerBufferSize
 		values["skip_tls_verification"] = m.Settings.Network.SkipTLSVerification
+		values["global_rate_limit"] = m.Settings.Network.GlobalRateLimit
+		values["download_rate_limit"] = m.Settings.Network.DownloadRateLimit
 	case "Performance":
 		values["max_task_retries"] = m.Settings.Performance.MaxTaskRetries
 		values["slow_worker_threshold"] = m.Settings.Performance.SlowWorkerThreshold
 		values["slow_worker_grace_period"] = m.Settings.Performance.SlowWorkerGracePeriod
 		values["stall_timeout"] = m.Settings.Performance.StallTimeout
 		values["speed_ema_alpha"] = m.Settings.Performance.SpeedEmaAlpha
+	case "Torrent":
+		values["enable_dht"] = m.Settings.Torrent.EnableDHT
+		values["listen_port"] = m.Settings.Torrent.ListenPort
+		values["max_peers"] = m.Settings.Torrent.MaxPeers
+		values["seed_ratio"] = m.Settings.Torrent.SeedRatio
+		values["seed_time"] = m.Settings.Torrent.SeedTime
+	case "Hooks":
+		values["on_complete"] = m.Settings.Hooks.OnComplete
+		values["on_error"] = m.Settings.Hooks.OnError
+		values["webhook_url"] = m.Settings.Hooks.WebhookURL
+		values["timeout"] = m.Settings.Hooks.Timeout
+		values["allow_remote_commands"] = m.Settings.Hooks.AllowRemoteCommands
 	}
 
 	return values
@@ -300,6 +323,10 @@ func (m *RootModel) setSettingValue(category, key, value string) error {
 		return m.setNetworkSetting(key, value, meta.Type)
 	case "Performance":
 		return m.setPerformanceSetting(key, value, meta.Type)
+	case "Torrent":
+		return m.setTorrentSetting(key, value, meta.Type)
+	case "Hooks":
+		return m.setHooksSetting(key, value, meta.Type)
 	}
 
 	return nil
@@ -319,6 +346,28 @@ func (m *RootModel) setGeneralSetting(key, value, typ string) error {
 		m.Settings.General.SkipUpdateCheck = !m.Settings.General.SkipUpdateCheck
 	case "preserve_url_path":
 		m.Settings.General.PreserveURLPath = !m.Settings.General.PreserveURLPath
+	case "path_template":
+		value = strings.TrimSpace(value)
+		if value != "" {
+			if err := utils.ValidatePathTemplate(value); err != nil {
+				return err
+			}
+		}
+		m.Settings.General.PathTemplate = value
+	case "conflict_policy":
+		value = strings.ToLower(strings.TrimSpace(value))
+		if !config.ValidConflictPolicy(value) {
+			return fmt.Errorf("conflict policy must be one of %s", strings.Join(config.ConflictPolicies, ", "))
+		}
+		m.Settings.General.ConflictPolicy = value
+	case "discover_checksums":
+		m.Settings.General.DiscoverChecksums = !m.Settings.General.DiscoverChecksums
+	case "stream_variant":
+		m.Settings.General.StreamVariant = strings.ToLower(strings.TrimSpace(value))
+	case "auto_extract":
+		m.Settings.General.AutoExtract = !m.Settings.General.AutoExtract
+	case "delete_after_extract":
+		m.Settings.General.DeleteAfterExtract = !m.Settings.General.DeleteAfterExtract
 	case "clipboard_monitor":
 		m.Settings.General.ClipboardMonitor = !m.Settings.General.ClipboardMonitor
 
@@ -377,6 +426,10 @@ func (m *RootModel) setNetworkSetting(key, value, typ string) error {
 		m.Settings.Network.UserAgent = value
 	case "proxy_url":
 		m.Settings.Network.ProxyURL = value
+	case "cookies_file":
+		m.Settings.Network.CookiesFile = value
+	case "netrc_file":
+		m.Settings.Network.NetrcFile = value
 	case "sequential_download":
 		// Toggle logic handled by generic bool toggle in Update, but just in case
 		if value == "" {
@@ -403,6 +456,14 @@ func (m *RootModel) setNetworkSetting(key, value, typ string) error {
 		if v, err := strconv.ParseFloat(value, 64); err == nil {
 			m.Settings.Network.WorkerBufferSize = int(v * 1024)
 		}
+	case "global_rate_limit":
+		if v, ok := parseRateLimitMB(value); ok {
+			m.Settings.Network.GlobalRateLimit = v
+		}
+	case "download_rate_limit":
+		if v, ok := parseRateLimitMB(value); ok {
+			m.Settings.Network.DownloadRateLimit = v
+		}
 	}
 	return nil
 }
@@ -453,6 +514,62 @@ func (m *RootModel) setPerformanceSetting(key, value, typ string) error {
 	return nil
 }
 
+func (m *RootModel) setTorrentSetting(key, value, typ string) error {
+	switch key {
+	case "enable_dht":
+		m.Settings.Torrent.EnableDHT = !m.Settings.Torrent.EnableDHT
+	case "listen_port":
+		if v, err := strconv.Atoi(value); err == nil && v >= 0 && v <= 65535 {
+			m.Settings.Torrent.ListenPort = v
+		}
+	case "max_peers":
+		if v, err := strconv.Atoi(value); err == nil {
+			if v < 1 {
+				v = 1
+			}
+			m.Settings.Torrent.MaxPeers = v
+		}
+	case "seed_ratio":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			if v < 0 {
+				v = 0
+			}
+			m.Settings.Torrent.SeedRatio = v
+		}
+	case "seed_time":
+		// Check if it's just a number, if so treat it as minutes
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			value += "m"
+		}
+		if v, err := time.ParseDuration(value); err == nil && v >= 0 {
+			m.Settings.Torrent.SeedTime = v
+		}
+	}
+	return nil
+}
+
+func (m *RootModel) setHooksSetting(key, value, typ string) error {
+	switch key {
+	case "on_complete":
+		m.Settings.Hooks.OnComplete = strings.TrimSpace(value)
+	case "on_error":
+		m.Settings.Hooks.OnError = strings.TrimSpace(value)
+	case "webhook_url":
+		m.Settings.Hooks.WebhookURL = strings.TrimSpace(value)
+	case "timeout":
+		// Check if it's just a number, if so treat it as seconds
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			value += "s"
+		}
+		if v, err := time.ParseDuration(value); err == nil && v > 0 {
+			m.Settings.Hooks.Timeout = v
+		}
+	case "allow_remote_commands":
+		m.Settings.Hooks.AllowRemoteCommands = !m.Settings.Hooks.AllowRemoteCommands
+	}
+	return nil
+}
+
 // getCurrentSettingKey returns the key of the currently selected setting
 func (m RootModel) getCurrentSettingKey() string {
 	categories := config.CategoryOrder()
@@ -513,12 +630,18 @@ func (m RootModel) getSettingUnit() string {
 		return " MB"
 	case "worker_buffer_size":
 		return " KB"
+	case "global_rate_limit", "download_rate_limit":
+		return " MB/s (0 = unlimited)"
 	case "max_task_retries":
 		return " retries"
 	case "slow_worker_grace_period", "stall_timeout":
 		return " seconds"
 	case "slow_worker_threshold", "speed_ema_alpha":
 		return " (0.0-1.0)"
+	case "seed_time":
+		return " minutes"
+	case "seed_ratio":
+		return " (0 = no limit)"
 	default:
 		return ""
 	}
@@ -532,6 +655,10 @@ func formatSettingValueForEdit(value interface{}, typ, key string) string {
 			mb := float64(v) / (1024 * 1024)
 			return fmt.Sprintf("%.1f", mb)
 		}
+	case "global_rate_limit", "download_rate_limit":
+		if v, ok := value.(int64); ok {
+			return formatRateLimitMB(v)
+		}
 	case "worker_buffer_size":
 		v := reflect.ValueOf(value)
 		if v.Kind() == reflect.Int {
@@ -543,6 +670,10 @@ func formatSettingValueForEdit(value interface{}, typ, key string) string {
 		if d, ok := value.(time.Duration); ok {
 			return fmt.Sprintf("%.0f", d.Seconds())
 		}
+	case "seed_time":
+		if d, ok := value.(time.Duration); ok {
+			return fmt.Sprintf("%.0f", d.Minutes())
+		}
 	}
 
 	if key == "theme" {
@@ -633,6 +764,16 @@ func (m *RootModel) resetSettingToDefault(category, key string, defaults *config
 			m.Settings.General.AutoResume = defaults.General.AutoResume
 		case "skip_update_check":
 			m.Settings.General.SkipUpdateCheck = defaults.General.SkipUpdateCheck
+		case "path_template":
+			m.Settings.General.PathTemplate = defaults.General.PathTemplate
+		case "conflict_policy":
+			m.Settings.General.ConflictPolicy = defaults.General.ConflictPolicy
+		case "stream_variant":
+			m.Settings.General.StreamVariant = defaults.General.StreamVariant
+		case "auto_extract":
+			m.Settings.General.AutoExtract = defaults.General.AutoExtract
+		case "delete_after_extract":
+			m.Settings.General.DeleteAfterExtract = defaults.General.DeleteAfterExtract
 
 		case "clipboard_monitor":
 			m.Settings.General.ClipboardMonitor = defaults.General.ClipboardMonitor
@@ -652,12 +793,20 @@ func (m *RootModel) resetSettingToDefault(category, key string, defaults *config
 			m.Settings.Network.MaxConcurrentDownloads = defaults.Network.MaxConcurrentDownloads
 		case "user_agent":
 			m.Settings.Network.UserAgent = defaults.Network.UserAgent
+		case "cookies_file":
+			m.Settings.Network.CookiesFile = defaults.Network.CookiesFile
+		case "netrc_file":
+			m.Settings.Network.NetrcFile = defaults.Network.NetrcFile
 		case "sequential_download":
 			m.Settings.Network.SequentialDownload = defaults.Network.SequentialDownload
 		case "min_chunk_size":
 			m.Settings.Network.MinChunkSize = defaults.Network.MinChunkSize
 		case "worker_buffer_size":
 			m.Settings.Network.WorkerBufferSize = defaults.Network.WorkerBufferSize
+		case "global_rate_limit":
+			m.Settings.Network.GlobalRateLimit = defaults.Network.GlobalRateLimit
+		case "download_rate_limit":
+			m.Settings.Network.DownloadRateLimit = defaults.Network.DownloadRateLimit
 		}
 	case "Performance":
 		switch key {
@@ -672,5 +821,54 @@ func (m *RootModel) resetSettingToDefault(category, key string, defaults *config
 		case "speed_ema_alpha":
 			m.Settings.Performance.SpeedEmaAlpha = defaults.Performance.SpeedEmaAlpha
 		}
+	case "Torrent":
+		switch key {
+		case "enable_dht":
+			m.Settings.Torrent.EnableDHT = defaults.Torrent.EnableDHT
+		case "listen_port":
+			m.Settings.Torrent.ListenPort = defaults.Torrent.ListenPort
+		case "max_peers":
+			m.Settings.Torrent.MaxPeers = defaults.Torrent.MaxPeers
+		case "seed_ratio":
+			m.Settings.Torrent.SeedRatio = defaults.Torrent.SeedRatio
+		case "seed_time":
+			m.Settings.Torrent.SeedTime = defaults.Torrent.SeedTime
+		}
+	case "Hooks":
+		switch key {
+		case "on_complete":
+			m.Settings.Hooks.OnComplete = defaults.Hooks.OnComplete
+		case "on_error":
+			m.Settings.Hooks.OnError = defaults.Hooks.OnError
+		case "webhook_url":
+			m.Settings.Hooks.WebhookURL = defaults.Hooks.WebhookURL
+		case "timeout":
+			m.Settings.Hooks.Timeout = defaults.Hooks.Timeout
+		case "allow_remote_commands":
+			m.Settings.Hooks.AllowRemoteCommands = defaults.Hooks.AllowRemoteCommands
+		}
+	}
+}
+
+// parseRateLimitMB parses a bandwidth limit entered in MB/s into bytes/sec.
+// Empty input and "0" both mean unlimited.
+func parseRateLimitMB(value string) (int64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, true
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || v < 0 {
+		return 0, false
+	}
+	return int64(v * 1024 * 1024), true
+}
+
+// formatRateLimitMB formats a bytes/sec limit as MB/s for editing
+func formatRateLimitMB(bytesPerSec int64) string {
+	if bytesPerSec <= 0 {
+		return "0"
 	}
+	mb := fmt.Sprintf("%.2f", float64(bytesPerSec)/(1024*1024))
+	return strings.TrimRight(strings.TrimRight(mb, "0"), ".")
 }
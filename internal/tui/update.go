@@ -2,16 +2,20 @@ package tui
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/clipboard"
 	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/checksum"
 	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
@@ -22,6 +26,7 @@ import (
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/progress"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/google/uuid"
 )
 
 // notificationTickMsg is sent to check if a notification should be cleared
@@ -144,6 +149,16 @@ func (m *RootModel) addLogEntry(msg string) {
 	m.logViewport.GotoBottom()
 }
 
+// findDownload returns the download with the given ID, or nil
+func (m *RootModel) findDownload(id string) *DownloadModel {
+	for _, d := range m.downloads {
+		if d.ID == id {
+			return d
+		}
+	}
+	return nil
+}
+
 // removeDownloadByID removes a download from the in-memory list.
 // Returns true if a download was removed.
 func (m *RootModel) removeDownloadByID(id string) bool {
@@ -156,6 +171,33 @@ func (m *RootModel) removeDownloadByID(id string) bool {
 	return false
 }
 
+// applyQueueOrder reorders queued downloads to match the engine's queue.
+// They swap among the slots they already occupy; other downloads keep their place.
+func (m *RootModel) applyQueueOrder(order []string, priorities map[string]string) {
+	rank := make(map[string]int, len(order))
+	for i, id := range order {
+		rank[id] = i
+	}
+
+	var slots []int
+	var queued []*DownloadModel
+	for i, d := range m.downloads {
+		if _, ok := rank[d.ID]; ok {
+			slots = append(slots, i)
+			queued = append(queued, d)
+		}
+		if p, ok := priorities[d.ID]; ok {
+			d.Priority = p
+		}
+	}
+	sort.SliceStable(queued, func(i, j int) bool {
+		return rank[queued[i].ID] < rank[queued[j].ID]
+	})
+	for i, slot := range slots {
+		m.downloads[slot] = queued[i]
+	}
+}
+
 // checkForDuplicate checks if a compatible download already exists
 func (m RootModel) checkForDuplicate(url string) *DownloadModel {
 	if !m.Settings.General.WarnOnDuplicate {
@@ -176,7 +218,7 @@ func (m RootModel) checkForDuplicate(url string) *DownloadModel {
 }
 
 // startDownload initiates a new download
-func (m RootModel) startDownload(url string, mirrors []string, headers map[string]string, path, filename, id string) (RootModel, tea.Cmd) {
+func (m RootModel) startDownload(url string, mirrors []string, headers map[string]string, expectedChecksum string, opts *types.AddOptions, path, filename, id string) (RootModel, tea.Cmd) {
 	if m.Service == nil {
 		m.addLogEntry(LogStyleError.Render("✖ Service unavailable"))
 		return m, nil
@@ -188,14 +230,18 @@ func (m RootModel) startDownload(url string, mirrors []string, headers map[strin
 	// Generate unique filename to avoid overwriting (if not provided)
 	// For Local Service, we can generate it here. For Remote, the server might do it,
 	// but sending a unique filename is safer.
-	finalFilename := m.generateUniqueFilename(path, filename)
+	// Under other conflict policies the name is kept for the download to settle
+	finalFilename := filename
+	if policy := m.Settings.General.ConflictPolicy; policy == "" || policy == config.ConflictRename {
+		finalFilename = m.generateUniqueFilename(path, filename)
+	}
 
 	// Call Service Add
 	// Note: We don't construct DownloadConfig/DownloadModel manually here for the queue
 	// We rely on the event stream to update the UI, OR we add it optimistically.
 	// Optimistic addition gives better UX.
 
-	newID, err := m.Service.Add(url, path, finalFilename, mirrors, headers)
+	newID, err := m.Service.Add(url, path, finalFilename, mirrors, headers, expectedChecksum, opts)
 	if err != nil {
 		m.addLogEntry(LogStyleError.Render("✖ Failed to add download: " + err.Error()))
 		return m, nil
@@ -204,6 +250,10 @@ func (m RootModel) startDownload(url string, mirrors []string, headers map[strin
 	// Create optimistic model
 	newDownload := NewDownloadModel(newID, url, "Queued", 0)
 	newDownload.Destination = filepath.Join(path, finalFilename)
+	if opts != nil {
+		newDownload.BatchID = opts.BatchID
+		newDownload.BatchName = opts.BatchName
+	}
 	m.downloads = append(m.downloads, newDownload)
 
 	m.SelectedDownloadID = newID
@@ -256,6 +306,8 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.pendingURL = msg.URL
 			m.pendingMirrors = msg.Mirrors
 			m.pendingHeaders = msg.Headers
+			m.pendingChecksum = msg.Checksum
+			m.pendingOptions = msg.Options
 			m.pendingPath = path
 			m.pendingFilename = msg.Filename
 			m.duplicateInfo = duplicate.Filename
@@ -267,6 +319,8 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.pendingURL = msg.URL
 			m.pendingMirrors = msg.Mirrors
 			m.pendingHeaders = msg.Headers
+			m.pendingChecksum = msg.Checksum
+			m.pendingOptions = msg.Options
 			m.pendingPath = path
 			m.pendingFilename = msg.Filename
 			m.inputs[2].SetValue(path)
@@ -280,7 +334,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
-		return m.startDownload(msg.URL, msg.Mirrors, msg.Headers, path, msg.Filename, msg.ID)
+		return m.startDownload(msg.URL, msg.Mirrors, msg.Headers, msg.Checksum, msg.Options, path, msg.Filename, msg.ID)
 
 	case events.DownloadStartedMsg:
 		found := false
@@ -290,6 +344,9 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				d.FilenameLower = strings.ToLower(msg.Filename)
 				d.Total = msg.Total
 				d.Destination = msg.DestPath
+				if msg.Category != "" {
+					d.Category = msg.Category
+				}
 				d.StartTime = time.Now()
 				d.paused = false
 				d.pausing = false
@@ -312,6 +369,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if !found {
 			newDownload := NewDownloadModel(msg.DownloadID, msg.URL, msg.Filename, msg.Total)
 			newDownload.Destination = msg.DestPath
+			newDownload.Category = msg.Category
 			if msg.State != nil {
 				newDownload.state = msg.State
 			}
@@ -357,12 +415,72 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.UpdateListItems()
 		return m, tea.Batch(cmds...)
 
+	case events.DownloadSkippedMsg:
+		if d := m.findDownload(msg.DownloadID); d != nil && !d.done {
+			d.Filename = msg.Filename
+			d.FilenameLower = strings.ToLower(msg.Filename)
+			d.Destination = msg.DestPath
+			d.done = true
+			d.skipped = true
+			cmds = append(cmds, d.progress.SetPercent(1.0))
+			m.addLogEntry(LogStyleComplete.Render("↷ Skipped: " + msg.Filename + " (already present)"))
+		}
+		m.UpdateListItems()
+		return m, tea.Batch(cmds...)
+
+	case events.DownloadVerifiedMsg:
+		for _, d := range m.downloads {
+			if d.ID == msg.DownloadID {
+				d.Checksum = checksum.StatusVerified
+				m.addLogEntry(LogStyleComplete.Render(fmt.Sprintf("✔ Verified: %s (%s)", d.Filename, msg.Algorithm)))
+				break
+			}
+		}
+		return m, nil
+
+	case events.ExtractStartedMsg:
+		if d := m.findDownload(msg.DownloadID); d != nil {
+			d.ExtractStatus = extractRunning
+			d.ExtractDir = msg.Dir
+			d.ExtractDone, d.ExtractTotal = 0, 0
+			d.ExtractError = ""
+			m.addLogEntry(LogStyleStarted.Render("⇲ Extracting: " + d.Filename))
+		}
+		return m, nil
+
+	case events.ExtractProgressMsg:
+		if d := m.findDownload(msg.DownloadID); d != nil {
+			d.ExtractDone, d.ExtractTotal = msg.Done, msg.Total
+		}
+		return m, nil
+
+	case events.ExtractCompleteMsg:
+		if d := m.findDownload(msg.DownloadID); d != nil {
+			d.ExtractStatus = extractDone
+			d.ExtractDir = msg.Dir
+			d.ExtractDone = d.ExtractTotal
+			m.addLogEntry(LogStyleComplete.Render(fmt.Sprintf("✔ Extracted: %s (%d files)", d.Filename, msg.Files)))
+		}
+		return m, nil
+
+	case events.ExtractErrorMsg:
+		if d := m.findDownload(msg.DownloadID); d != nil {
+			d.ExtractStatus = extractFailed
+			d.ExtractError = msg.Error
+			m.addLogEntry(LogStyleError.Render("✖ Extract failed: " + d.Filename))
+		}
+		return m, nil
+
 	case events.DownloadErrorMsg:
 		for _, d := range m.downloads {
 			if d.ID == msg.DownloadID {
 				d.err = msg.Err
 				d.done = true
-				m.addLogEntry(LogStyleError.Render("✖ Error: " + d.Filename))
+				if errors.Is(msg.Err, types.ErrRemoteChanged) {
+					m.addLogEntry(LogStyleError.Render("✖ Changed on server: " + d.Filename))
+				} else {
+					m.addLogEntry(LogStyleError.Render("✖ Error: " + d.Filename))
+				}
 				break
 			}
 		}
@@ -402,6 +520,13 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		found := false
 		for _, d := range m.downloads {
 			if d.ID == msg.DownloadID {
+				if d.BatchID == "" {
+					d.BatchID = msg.BatchID
+					d.BatchName = msg.BatchName
+				}
+				if d.Category == "" {
+					d.Category = msg.Category
+				}
 				found = true
 				break
 			}
@@ -409,6 +534,9 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if !found {
 			// Add placeholder
 			newDownload := NewDownloadModel(msg.DownloadID, "", msg.Filename, 0)
+			newDownload.BatchID = msg.BatchID
+			newDownload.BatchName = msg.BatchName
+			newDownload.Category = msg.Category
 			m.downloads = append(m.downloads, newDownload)
 			m.UpdateListItems()
 		}
@@ -429,6 +557,19 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, tea.Batch(cmds...)
 
+	case events.QueueReorderedMsg:
+		m.applyQueueOrder(msg.Order, msg.Priorities)
+		m.UpdateListItems()
+		return m, tea.Batch(cmds...)
+
+	case events.ScheduleChangedMsg:
+		m.ScheduleProfile = msg.Profile
+		m.SchedulePaused = msg.Paused
+		if msg.Profile != "" {
+			m.addLogEntry(LogStyleStarted.Render("◷ Schedule: " + formatScheduleProfile(msg.Profile, msg.Paused, msg.RateLimit)))
+		}
+		return m, tea.Batch(cmds...)
+
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
@@ -590,6 +731,12 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.UpdateListItems()
 				return m, nil
 			}
+			if key.Matches(msg, m.keys.Dashboard.Category) {
+				m.cycleCategoryFilter()
+				m.ManualTabSwitch = true
+				m.UpdateListItems()
+				return m, nil
+			}
 			// Quit
 			if key.Matches(msg, m.keys.Dashboard.Quit) {
 				// Graceful shutdown
@@ -648,6 +795,14 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if key.Matches(msg, m.keys.Dashboard.Delete) {
 				if m.list.FilterState() == list.Filtering {
 					// Fall through
+				} else if b := m.GetSelectedBatch(); b != nil {
+					if m.Service == nil {
+						m.addLogEntry(LogStyleError.Render("✖ Service unavailable"))
+						return m, nil
+					}
+					m.deleteBatch(b)
+					m.UpdateListItems()
+					return m, nil
 				} else if d := m.GetSelectedDownload(); d != nil {
 					if m.Service == nil {
 						m.addLogEntry(LogStyleError.Render("✖ Service unavailable"))
@@ -686,7 +841,13 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			// Pause/Resume toggle
 			if key.Matches(msg, m.keys.Dashboard.Pause) {
-				if d := m.GetSelectedDownload(); d != nil {
+				if b := m.GetSelectedBatch(); b != nil {
+					if m.Service == nil {
+						m.addLogEntry(LogStyleError.Render("✖ Service unavailable"))
+						return m, nil
+					}
+					m.toggleBatchPause(b)
+				} else if d := m.GetSelectedDownload(); d != nil {
 					if m.Service == nil {
 						m.addLogEntry(LogStyleError.Render("✖ Service unavailable"))
 						return m, nil
@@ -731,6 +892,50 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 
+			// Per-download speed limit
+			if key.Matches(msg, m.keys.Dashboard.RateLimit) {
+				if d := m.GetSelectedDownload(); d != nil && !d.done {
+					m.rateLimitTargetID = d.ID
+					m.rateLimitInput.SetValue(formatRateLimitMB(d.RateLimit))
+					m.rateLimitInput.CursorEnd()
+					m.rateLimitInput.Focus()
+					m.state = RateLimitInputState
+				}
+				return m, nil
+			}
+
+			// Reorder the queue; the engine's QueueReorderedMsg updates the list
+			if key.Matches(msg, m.keys.Dashboard.MoveUp) || key.Matches(msg, m.keys.Dashboard.MoveDown) {
+				if d := m.GetSelectedDownload(); d != nil && !d.done {
+					if m.Service == nil {
+						m.addLogEntry(LogStyleError.Render("✖ Service unavailable"))
+						return m, nil
+					}
+					to := download.MoveDown
+					if key.Matches(msg, m.keys.Dashboard.MoveUp) {
+						to = download.MoveUp
+					}
+					if err := m.Service.Move(d.ID, to); err != nil {
+						m.addLogEntry(LogStyleError.Render("✖ Move failed: " + err.Error()))
+					}
+				}
+				return m, nil
+			}
+
+			// Grouped view of batches
+			if key.Matches(msg, m.keys.Dashboard.Group) {
+				m.groupBatches = !m.groupBatches
+				m.UpdateListItems()
+				return m, nil
+			}
+			if key.Matches(msg, m.keys.Dashboard.Collapse) {
+				if b := m.GetSelectedBatch(); b != nil {
+					m.collapsedBatches[b.ID] = !b.Collapsed
+					m.UpdateListItems()
+					return m, nil
+				}
+			}
+
 			// Other keys...
 			if key.Matches(msg, m.keys.Dashboard.Log) {
 				m.logFocused = !m.logFocused
@@ -877,6 +1082,8 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.pendingURL = url
 					m.pendingMirrors = mirrors
 					m.pendingHeaders = nil
+					m.pendingChecksum = ""
+					m.pendingOptions = nil
 					m.pendingPath = path
 					m.pendingFilename = filename
 					m.duplicateInfo = d.Filename
@@ -891,7 +1098,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.inputs[2].SetValue(path) // Keep path
 				m.inputs[3].SetValue("")
 
-				return m.startDownload(url, mirrors, nil, path, filename, "")
+				return m.startDownload(url, mirrors, nil, "", nil, path, filename, "")
 			}
 
 			// Up/Down navigation between inputs
@@ -1019,7 +1226,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if key.Matches(msg, m.keys.Duplicate.Continue) {
 				// Continue anyway - startDownload handles unique filename generation
 				m.state = DashboardState
-				return m.startDownload(m.pendingURL, m.pendingMirrors, m.pendingHeaders, m.pendingPath, m.pendingFilename, "")
+				return m.startDownload(m.pendingURL, m.pendingMirrors, m.pendingHeaders, m.pendingChecksum, m.pendingOptions, m.pendingPath, m.pendingFilename, "")
 			}
 			if key.Matches(msg, m.keys.Duplicate.Cancel) {
 				// Cancel - don't add
@@ -1091,7 +1298,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 				// No duplicate (or warning disabled) - add to queue
 				m.state = DashboardState
-				return m.startDownload(m.pendingURL, nil, m.pendingHeaders, m.pendingPath, m.pendingFilename, "")
+				return m.startDownload(m.pendingURL, nil, m.pendingHeaders, m.pendingChecksum, m.pendingOptions, m.pendingPath, m.pendingFilename, "")
 			}
 			if key.Matches(msg, m.keys.Extension.Cancel) {
 				// Cancelled
@@ -1171,6 +1378,11 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					path = "."
 				}
 
+				// The URLs of one file form a batch
+				opts := &types.AddOptions{
+					BatchID:   uuid.New().String(),
+					BatchName: filepath.Base(m.batchFilePath),
+				}
 				added := 0
 				skipped := 0
 				for _, url := range m.pendingBatchURLs {
@@ -1179,7 +1391,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						skipped++
 						continue
 					}
-					m, _ = m.startDownload(url, nil, nil, path, "", "")
+					m, _ = m.startDownload(url, nil, nil, "", opts, path, "", "")
 					added++
 				}
 
@@ -1236,6 +1448,18 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if key.Matches(msg, m.keys.Settings.Close) {
 				// Save settings and exit
 				_ = config.SaveSettings(m.Settings)
+				if m.Service != nil {
+					// Local services cache settings; refresh so new downloads use the saved defaults
+					if r, ok := m.Service.(interface{ ReloadSettings() error }); ok {
+						_ = r.ReloadSettings()
+					}
+					if err := m.Service.SetGlobalRateLimit(m.Settings.Network.GlobalRateLimit); err != nil {
+						m.addLogEntry(LogStyleError.Render("✖ Failed to apply speed limit: " + err.Error()))
+					}
+					if err := m.Service.SetMaxDownloads(m.Settings.Network.MaxConcurrentDownloads); err != nil {
+						m.addLogEntry(LogStyleError.Render("✖ Failed to apply max downloads: " + err.Error()))
+					}
+				}
 				m.state = DashboardState
 				return m, nil
 			}
@@ -1367,6 +1591,42 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			return m, nil
 
+		case RateLimitInputState:
+			if key.Matches(msg, m.keys.SettingsEditor.Cancel) {
+				m.rateLimitInput.Blur()
+				m.state = DashboardState
+				return m, nil
+			}
+			if key.Matches(msg, m.keys.SettingsEditor.Confirm) {
+				m.rateLimitInput.Blur()
+				m.state = DashboardState
+
+				limit, ok := parseRateLimitMB(m.rateLimitInput.Value())
+				if !ok {
+					m.addLogEntry(LogStyleError.Render("✖ Invalid speed limit: " + m.rateLimitInput.Value()))
+					return m, nil
+				}
+				if m.Service == nil {
+					m.addLogEntry(LogStyleError.Render("✖ Service unavailable"))
+					return m, nil
+				}
+				if err := m.Service.SetRateLimit(m.rateLimitTargetID, limit); err != nil {
+					m.addLogEntry(LogStyleError.Render("✖ Speed limit failed: " + err.Error()))
+					return m, nil
+				}
+				for _, d := range m.downloads {
+					if d.ID == m.rateLimitTargetID {
+						d.RateLimit = limit
+						break
+					}
+				}
+				return m, nil
+			}
+
+			var cmd tea.Cmd
+			m.rateLimitInput, cmd = m.rateLimitInput.Update(msg)
+			return m, cmd
+
 		case UpdateAvailableState:
 			if key.Matches(msg, m.keys.Update.OpenGitHub) {
 				// Open the release page in browser
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -500,3 +501,145 @@ func TestUpdate_DownloadRequestMsg(t *testing.T) {
 		t.Errorf("Expected no prompt state, got %v", newRoot.state)
 	}
 }
+
+func TestUpdate_GroupAndCollapseBatches(t *testing.T) {
+	a := NewDownloadModel("id-a", "http://example.com/a", "a.iso", 100)
+	b := NewDownloadModel("id-b", "http://example.com/b", "b.iso", 100)
+	loose := NewDownloadModel("id-c", "http://example.com/c", "c.iso", 100)
+	for _, d := range []*DownloadModel{a, b} {
+		d.BatchID = "batch-1"
+		d.BatchName = "isos.txt"
+	}
+	m := RootModel{
+		state:            DashboardState,
+		keys:             Keys,
+		downloads:        []*DownloadModel{a, loose, b},
+		list:             NewDownloadList(80, 20),
+		logViewport:      viewport.New(40, 5),
+		collapsedBatches: make(map[string]bool),
+	}
+	m.UpdateListItems()
+	if got := len(m.list.Items()); got != 3 {
+		t.Fatalf("expected 3 flat items, got %d", got)
+	}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'v'}})
+	m = updated.(RootModel)
+	items := m.list.Items()
+	if len(items) != 4 {
+		t.Fatalf("expected a header, two members and one loose download, got %d items", len(items))
+	}
+	header, ok := items[0].(BatchItem)
+	if !ok || header.ID != "batch-1" || len(header.Downloads) != 2 {
+		t.Fatalf("expected the batch header first, got %#v", items[0])
+	}
+	if di, ok := items[1].(DownloadItem); !ok || !di.inBatch || di.download.ID != "id-a" {
+		t.Errorf("expected a.iso under the header, got %#v", items[1])
+	}
+	if di, ok := items[3].(DownloadItem); !ok || di.inBatch || di.download.ID != "id-c" {
+		t.Errorf("expected c.iso outside the batch last, got %#v", items[3])
+	}
+
+	m.list.Select(0)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(RootModel)
+	if got := len(m.list.Items()); got != 2 {
+		t.Fatalf("expected the collapsed batch to hide its members, got %d items", got)
+	}
+	if sel := m.GetSelectedBatch(); sel == nil || !sel.Collapsed {
+		t.Errorf("expected the collapsed header to stay selected, got %#v", sel)
+	}
+}
+
+func TestUpdate_CycleCategoryFilter(t *testing.T) {
+	movie := NewDownloadModel("id-a", "http://example.com/a.mkv", "a.mkv", 100)
+	movie.Category = "Video"
+	doc := NewDownloadModel("id-b", "http://example.com/b.pdf", "b.pdf", 100)
+	doc.Category = "Docs"
+	other := NewDownloadModel("id-c", "http://example.com/c.bin", "c.bin", 100)
+	m := RootModel{
+		state:       DashboardState,
+		keys:        Keys,
+		Settings:    config.DefaultSettings(),
+		downloads:   []*DownloadModel{movie, doc, other},
+		list:        NewDownloadList(80, 20),
+		logViewport: viewport.New(40, 5),
+	}
+	m.UpdateListItems()
+
+	press := func() {
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'c'}})
+		m = updated.(RootModel)
+	}
+	press()
+	if m.categoryFilter != "Video" {
+		t.Fatalf("expected the first category, got %q", m.categoryFilter)
+	}
+	items := m.list.Items()
+	if len(items) != 1 || items[0].(DownloadItem).download.ID != "id-a" {
+		t.Fatalf("expected only the video, got %d items", len(items))
+	}
+
+	for range len(m.Settings.Categories) {
+		press()
+	}
+	if m.categoryFilter != "" || len(m.list.Items()) != 3 {
+		t.Errorf("expected all downloads after the last category, got %q with %d items", m.categoryFilter, len(m.list.Items()))
+	}
+}
+
+func TestUpdate_DownloadSkipped(t *testing.T) {
+	d := NewDownloadModel("id-a", "http://example.com/a.iso", "Queued", 0)
+	m := RootModel{
+		state:       DashboardState,
+		downloads:   []*DownloadModel{d},
+		list:        NewDownloadList(80, 20),
+		logViewport: viewport.New(40, 5),
+	}
+
+	updated, _ := m.Update(events.DownloadSkippedMsg{DownloadID: "id-a", Filename: "a.iso", DestPath: "/data/a.iso"})
+	m = updated.(RootModel)
+	if !d.done || !d.skipped || d.err != nil {
+		t.Fatalf("expected a finished, skipped download, got done=%v skipped=%v err=%v", d.done, d.skipped, d.err)
+	}
+	if d.Filename != "a.iso" || d.Destination != "/data/a.iso" {
+		t.Errorf("expected the kept file, got %s at %s", d.Filename, d.Destination)
+	}
+	if got := getDownloadStatus(d); !strings.Contains(got, "Skipped") {
+		t.Errorf("status = %q, want Skipped", got)
+	}
+}
+
+func TestUpdate_ExtractEvents(t *testing.T) {
+	d := NewDownloadModel("id-a", "http://example.com/a.zip", "a.zip", 100)
+	d.done = true
+	m := RootModel{
+		state:       DashboardState,
+		downloads:   []*DownloadModel{d},
+		list:        NewDownloadList(80, 20),
+		logViewport: viewport.New(40, 5),
+	}
+
+	updated, _ := m.Update(events.ExtractStartedMsg{DownloadID: "id-a", Filename: "a.zip", Dir: "/dl/a"})
+	m = updated.(RootModel)
+	updated, _ = m.Update(events.ExtractProgressMsg{DownloadID: "id-a", Done: 25, Total: 100})
+	m = updated.(RootModel)
+	if d.ExtractStatus != extractRunning || extractInfo(d) != "⇲ Extracting 25%" {
+		t.Fatalf("while extracting: status %q, info %q", d.ExtractStatus, extractInfo(d))
+	}
+
+	updated, _ = m.Update(events.ExtractCompleteMsg{DownloadID: "id-a", Filename: "a.zip", Dir: "/dl/a", Files: 3})
+	m = updated.(RootModel)
+	if d.ExtractStatus != extractDone || d.ExtractDir != "/dl/a" {
+		t.Errorf("after extracting: status %q, dir %q", d.ExtractStatus, d.ExtractDir)
+	}
+
+	updated, _ = m.Update(events.ExtractErrorMsg{DownloadID: "id-a", Filename: "a.zip", Error: "zip: not a valid zip file"})
+	m = updated.(RootModel)
+	if d.ExtractStatus != extractFailed || d.ExtractError == "" {
+		t.Errorf("after a failure: status %q, error %q", d.ExtractStatus, d.ExtractError)
+	}
+	if len(m.logEntries) != 3 {
+		t.Errorf("expected 3 log entries, got %d", len(m.logEntries))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/engine/checksum"
 	"github.com/surge-downloader/surge/internal/tui/colors"
 	"github.com/surge-downloader/surge/internal/tui/components"
 	"github.com/surge-downloader/surge/internal/utils"
@@ -168,6 +169,32 @@ func (m RootModel) View() string {
 		return m.renderModalWithOverlay(box)
 	}
 
+	if m.state == RateLimitInputState {
+		url := ""
+		for _, d := range m.downloads {
+			if d.ID == m.rateLimitTargetID {
+				url = d.URL
+				break
+			}
+		}
+		modal := components.AddDownloadModal{
+			Title:           "Speed Limit (MB/s)",
+			Inputs:          []textinput.Model{m.rateLimitInput},
+			Labels:          []string{"Limit:"},
+			FocusedInput:    0,
+			ShowURL:         true,
+			URL:             truncateString(url, 50),
+			BrowseHintIndex: -1,
+			Help:            m.help,
+			HelpKeys:        m.keys.SettingsEditor,
+			BorderColor:     ColorNeonCyan,
+			Width:           60,
+			Height:          10,
+		}
+		box := modal.RenderWithBtopBox(renderBtopBox, PaneTitleStyle)
+		return m.renderModalWithOverlay(box)
+	}
+
 	if m.state == UpdateAvailableState && m.UpdateInfo != nil {
 		modal := components.ConfirmationModal{
 			Title:       "⬆ Update Available",
@@ -245,6 +272,8 @@ func (m RootModel) View() string {
 
 	if selected != nil {
 		detailContent = renderFocusedDetails(selected, detailWidth)
+	} else if batch := m.GetSelectedBatch(); batch != nil {
+		detailContent = renderBatchDetails(batch, detailWidth)
 	} else {
 		// Default Placeholder
 		detailContent = lipgloss.Place(detailWidth, 8, lipgloss.Center, lipgloss.Center,
@@ -422,7 +451,16 @@ func (m RootModel) View() string {
 		logoBoxHeight = 1
 	}
 	logoBox := lipgloss.Place(logoWidth, logoBoxHeight, lipgloss.Center, lipgloss.Center, logoContent)
-	serverBox := renderBtopBox("", PaneTitleStyle.Render(" Server "), serverPortContent, logoWidth, serverBoxHeight, ColorGray)
+	// Active bandwidth schedule profile sits opposite the server title
+	scheduleTitle := ""
+	if m.ScheduleProfile != "" {
+		profile := m.ScheduleProfile
+		if m.SchedulePaused {
+			profile += " ⏸"
+		}
+		scheduleTitle = PaneTitleStyle.Render(" ◷ " + truncateString(profile, logoWidth-16) + " ")
+	}
+	serverBox := renderBtopBox(scheduleTitle, PaneTitleStyle.Render(" Server "), serverPortContent, logoWidth, serverBoxHeight, ColorGray)
 
 	// Combine logo and server box vertically
 	logoColumn := lipgloss.JoinVertical(lipgloss.Left, logoBox, serverBox)
@@ -595,7 +633,7 @@ func (m RootModel) View() string {
 
 	// --- SECTION 3: DOWNLOAD LIST (Bottom Left) ---
 	// Tab Bar
-	tabBar := renderTabs(m.activeTab, active, queued, downloaded)
+	tabBar := m.withCategoryTab(renderTabs(m.activeTab, active, queued, downloaded))
 
 	// Search bar (shown when search is active or has a query)
 	var leftTitle string
@@ -756,11 +794,31 @@ func renderFocusedDetails(d *DownloadModel, w int) string {
 	statusBox := statusStyle.Render(statusStr)
 
 	// --- 2. File Information Section ---
-	fileInfoContent := lipgloss.JoinVertical(lipgloss.Left,
+	fileInfoLines := []string{
 		lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Render("File: "), StatsValueStyle.Render(truncateString(d.Filename, contentWidth-8))),
 		lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Render("Path: "), StatsValueStyle.Render(truncateString(d.Destination, contentWidth-8))),
 		lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Render("ID:   "), lipgloss.NewStyle().Foreground(ColorLightGray).Render(d.ID)),
-	)
+	}
+	if d.BatchID != "" {
+		batchName := d.BatchName
+		if batchName == "" {
+			batchName = shortBatchID(d.BatchID)
+		}
+		fileInfoLines = append(fileInfoLines, lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Render("Batch:"), StatsValueStyle.Render(" "+truncateString(batchName, contentWidth-8))))
+	}
+	if d.Category != "" {
+		fileInfoLines = append(fileInfoLines, lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Render("Type: "), StatsValueStyle.Render(truncateString(d.Category, contentWidth-8))))
+	}
+	if extract := extractInfo(d); extract != "" {
+		switch d.ExtractStatus {
+		case extractFailed:
+			extract += ": " + d.ExtractError
+		default:
+			extract += " → " + d.ExtractDir
+		}
+		fileInfoLines = append(fileInfoLines, lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Render("Unpack:"), StatsValueStyle.Render(" "+truncateString(extract, contentWidth-9))))
+	}
+	fileInfoContent := lipgloss.JoinVertical(lipgloss.Left, fileInfoLines...)
 	fileSection := sectionStyle.Render(fileInfoContent)
 
 	// --- 3. Progress Section ---
@@ -852,13 +910,33 @@ func renderFocusedDetails(d *DownloadModel, w int) string {
 		if d.Connections > 0 {
 			connStr = fmt.Sprintf("%d", d.Connections)
 		}
+		if d.TargetConns > 0 && d.TargetConns != d.Connections {
+			connStr += fmt.Sprintf(" → %d", d.TargetConns)
+		}
 		leftColItems = append(leftColItems, lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Width(7).Render("Conns:"), StatsValueStyle.Render(connStr)))
 	}
+	switch d.Checksum {
+	case checksum.StatusVerified:
+		leftColItems = append(leftColItems, lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Width(7).Render("Hash:"), StatsValueStyle.Render("✔ verified")))
+	case checksum.StatusMismatch:
+		leftColItems = append(leftColItems, lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Width(7).Render("Hash:"), StatsValueStyle.Render("✖ mismatch")))
+	}
 	leftCol := lipgloss.JoinVertical(lipgloss.Left, leftColItems...)
-	rightCol := lipgloss.JoinVertical(lipgloss.Left,
+	rightColItems := []string{
 		lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Width(7).Render("Time:"), StatsValueStyle.Render(timeStr)),
 		lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Width(7).Render("ETA:"), StatsValueStyle.Render(etaStr)),
-	)
+	}
+	if d.RateLimit > 0 {
+		limitStr := fmt.Sprintf("%.1f MB/s", float64(d.RateLimit)/Megabyte)
+		rightColItems = append(rightColItems, lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Width(7).Render("Limit:"), StatsValueStyle.Render(limitStr)))
+	}
+	if d.Priority != "" && d.Priority != "normal" && !d.done {
+		rightColItems = append(rightColItems, lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Width(7).Render("Prio:"), StatsValueStyle.Render(d.Priority)))
+	}
+	if isActive && d.ConnsReason != "" {
+		rightColItems = append(rightColItems, lipgloss.JoinHorizontal(lipgloss.Left, StatsLabelStyle.Width(7).Render("Tuning:"), StatsValueStyle.Render(d.ConnsReason)))
+	}
+	rightCol := lipgloss.JoinVertical(lipgloss.Left, rightColItems...)
 
 	statsContent := lipgloss.JoinHorizontal(lipgloss.Top,
 		lipgloss.NewStyle().Width(colWidth).Render(leftCol),
@@ -929,6 +1007,9 @@ func getDownloadStatus(d *DownloadModel) string {
 	if d.resuming {
 		return lipgloss.NewStyle().Foreground(colors.StateDownloading).Render("▶ Resuming...")
 	}
+	if d.skipped {
+		return components.StatusSkipped.Render()
+	}
 	status := components.DetermineStatus(d.done, d.paused, d.err != nil, d.Speed, d.Downloaded)
 	return status.Render()
 }
@@ -948,6 +1029,10 @@ func (m RootModel) calcTotalSpeed() float64 {
 func (m RootModel) ComputeViewStats() ViewStats {
 	var stats ViewStats
 	for _, d := range m.downloads {
+		stats.TotalDownloaded += d.Downloaded
+		if !m.inCategory(d) {
+			continue // The tabs count what the list would show
+		}
 		if d.done {
 			stats.DownloadedCount++
 		} else if d.Speed > 0 {
@@ -955,11 +1040,22 @@ func (m RootModel) ComputeViewStats() ViewStats {
 		} else {
 			stats.QueuedCount++
 		}
-		stats.TotalDownloaded += d.Downloaded
 	}
 	return stats
 }
 
+// formatScheduleProfile describes a schedule profile for the activity log
+func formatScheduleProfile(profile string, paused bool, rateLimit int64) string {
+	switch {
+	case paused:
+		return profile + " (downloads paused)"
+	case rateLimit > 0:
+		return fmt.Sprintf("%s (%s MB/s)", profile, formatRateLimitMB(rateLimit))
+	default:
+		return profile + " (unlimited)"
+	}
+}
+
 func truncateString(s string, i int) string {
 	if i <= 0 {
 		return ""
@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
 	"path/filepath"
 )
 
@@ -16,3 +20,24 @@ func EnsureAbsPath(path string) string {
 	}
 	return path
 }
+
+// RenameNoReplace renames oldpath to newpath unless newpath exists, in which
+// case it returns an error matching fs.ErrExist and leaves both alone.
+func RenameNoReplace(oldpath, newpath string) error {
+	// A hard link fails atomically if newpath exists
+	err := os.Link(oldpath, newpath)
+	if err == nil {
+		return os.Remove(oldpath)
+	}
+	if errors.Is(err, fs.ErrExist) || errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	// Filesystems without hard links
+	if _, statErr := os.Lstat(newpath); statErr == nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrExist}
+	}
+	if err := os.Rename(oldpath, newpath); err != nil {
+		return fmt.Errorf("rename %s: %w", oldpath, err)
+	}
+	return nil
+}
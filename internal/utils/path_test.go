@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"testing"
@@ -48,3 +50,33 @@ func TestEnsureAbsPath(t *testing.T) {
 		})
 	}
 }
+
+func TestRenameNoReplace(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "file.surge")
+	to := filepath.Join(dir, "file")
+	if err := os.WriteFile(from, []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RenameNoReplace(from, to); err != nil {
+		t.Fatalf("RenameNoReplace: %v", err)
+	}
+	if _, err := os.Stat(from); !os.IsNotExist(err) {
+		t.Error("source still exists after the rename")
+	}
+
+	if err := os.WriteFile(from, []byte("newer"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := RenameNoReplace(from, to)
+	if !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("RenameNoReplace onto an existing file = %v, want fs.ErrExist", err)
+	}
+	if got, _ := os.ReadFile(to); string(got) != "new" {
+		t.Errorf("existing file replaced: %q", got)
+	}
+	if _, err := os.Stat(from); err != nil {
+		t.Errorf("source removed although the rename failed: %v", err)
+	}
+}
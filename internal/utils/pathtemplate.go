@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultDateLayout formats {date} when the template gives no layout
+const DefaultDateLayout = "2006-01-02"
+
+// PathVars are the values a path template can refer to
+type PathVars struct {
+	URL      string
+	Filename string
+	Category string
+	Batch    string
+	Time     time.Time
+}
+
+// RenderPathTemplate turns a template such as "{host}/{date}/{filename}" into
+// a path relative to the download directory. The variables are:
+//
+//	{host}        host of the URL, without the port
+//	{path}        directories of the URL's path, e.g. "a/b" for /a/b/file.zip
+//	{filename}    file name, e.g. "file.zip"
+//	{name}        file name without its extension, e.g. "file"
+//	{ext}         extension without the dot, e.g. "zip"
+//	{date}        date the download started, {date:LAYOUT} takes a Go time layout
+//	{category}    category of the download
+//	{batch}       name of the batch the download was added in
+//
+// Every element of the result is sanitized like a file name, and elements
+// that render empty are dropped, so "{category}/{filename}" is just the file
+// name for a download without a category. Templates that fail
+// ValidatePathTemplate are refused.
+func RenderPathTemplate(tmpl string, vars PathVars) (string, error) {
+	if err := ValidatePathTemplate(tmpl); err != nil {
+		return "", err
+	}
+	// Variables other than {path} and {date} can't add directories, as their
+	// values are sanitized before they are put in
+	rendered, err := expandTemplate(filepath.ToSlash(tmpl), vars)
+	if err != nil {
+		return "", err
+	}
+	var elems []string
+	for _, elem := range strings.Split(rendered, "/") {
+		if elem = sanitizeElem(elem); elem != "" && elem != ".." {
+			elems = append(elems, elem)
+		}
+	}
+	if len(elems) == 0 {
+		return "", fmt.Errorf("path template %q renders to an empty path", tmpl)
+	}
+	return filepath.Join(elems...), nil
+}
+
+// ValidatePathTemplate checks that a template only uses known variables and
+// names the file, so downloads don't all end up at the same path.
+func ValidatePathTemplate(tmpl string) error {
+	if _, err := expandTemplate(tmpl, PathVars{}); err != nil {
+		return err
+	}
+	if !strings.Contains(tmpl, "{filename}") && !strings.Contains(tmpl, "{name}") {
+		return fmt.Errorf("path template %q needs {filename} or {name}", tmpl)
+	}
+	return nil
+}
+
+func expandTemplate(tmpl string, vars PathVars) (string, error) {
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(tmpl, '{')
+		if open < 0 {
+			b.WriteString(tmpl)
+			return b.String(), nil
+		}
+		end := strings.IndexByte(tmpl[open:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unclosed { in path template")
+		}
+		b.WriteString(tmpl[:open])
+		value, err := templateVar(tmpl[open+1:open+end], vars)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+		tmpl = tmpl[open+end+1:]
+	}
+}
+
+func templateVar(name string, vars PathVars) (string, error) {
+	name, layout, hasLayout := strings.Cut(name, ":")
+	if hasLayout && name != "date" {
+		return "", fmt.Errorf("{%s} takes no format", name)
+	}
+
+	var u *url.URL
+	if vars.URL != "" {
+		u, _ = url.Parse(vars.URL)
+	}
+	ext := strings.TrimPrefix(filepath.Ext(vars.Filename), ".")
+
+	switch name {
+	case "host":
+		if u == nil {
+			return "", nil
+		}
+		return u.Hostname(), nil
+	case "path":
+		if u == nil {
+			return "", nil
+		}
+		dir := path.Dir(strings.TrimPrefix(u.Path, "/"))
+		if dir == "." {
+			return "", nil
+		}
+		// Keep the URL's directories apart, but sanitize each one
+		segments := strings.Split(dir, "/")
+		for i, s := range segments {
+			segments[i] = sanitizeElem(s)
+		}
+		return strings.Join(segments, "/"), nil
+	case "filename":
+		return sanitizeElem(vars.Filename), nil
+	case "name":
+		return sanitizeElem(strings.TrimSuffix(vars.Filename, filepath.Ext(vars.Filename))), nil
+	case "ext":
+		return sanitizeElem(ext), nil
+	case "date":
+		if layout == "" {
+			layout = DefaultDateLayout
+		}
+		t := vars.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		return t.Format(layout), nil
+	case "category":
+		return sanitizeElem(vars.Category), nil
+	case "batch":
+		return sanitizeElem(vars.Batch), nil
+	}
+	return "", fmt.Errorf("unknown variable {%s} in path template", name)
+}
+
+// sanitizeElem sanitizes one element of a path, leaving empty ones empty
+func sanitizeElem(s string) string {
+	if s = sanitizeFilename(s); s == "." {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRenderPathTemplate(t *testing.T) {
+	vars := PathVars{
+		URL:      "https://cdn.example.com:8443/releases/v1.2/app.tar.gz?token=x",
+		Filename: "app.tar.gz",
+		Category: "Archives",
+		Batch:    "nightly: builds",
+		Time:     time.Date(2024, 3, 9, 15, 4, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"{filename}", "app.tar.gz"},
+		{"{host}/{path}/{filename}", filepath.Join("cdn.example.com", "releases", "v1.2", "app.tar.gz")},
+		{"{date}/{name}.{ext}", filepath.Join("2024-03-09", "app.tar.gz")},
+		{"{date:2006/01}/{filename}", filepath.Join("2024", "03", "app.tar.gz")},
+		{"{date:15:04}-{filename}", "15_04-app.tar.gz"},
+		{"{category}/{batch}/{filename}", filepath.Join("Archives", "nightly_ builds", "app.tar.gz")},
+		{"../{filename}", "app.tar.gz"},
+	}
+	for _, tt := range tests {
+		got, err := RenderPathTemplate(tt.tmpl, vars)
+		if err != nil {
+			t.Errorf("RenderPathTemplate(%q): %v", tt.tmpl, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("RenderPathTemplate(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestRenderPathTemplate_EmptyValues(t *testing.T) {
+	vars := PathVars{URL: "https://example.com/file.bin", Filename: "file.bin"}
+
+	// No category, no batch and no directories in the URL
+	got, err := RenderPathTemplate("{category}/{batch}/{path}/{filename}", vars)
+	if err != nil || got != "file.bin" {
+		t.Errorf("got %q, %v, want file.bin", got, err)
+	}
+
+	// A file name can't add directories
+	vars.Filename = "../../etc/passwd"
+	got, err = RenderPathTemplate("{host}/{filename}", vars)
+	if err != nil || got != filepath.Join("example.com", "passwd") {
+		t.Errorf("got %q, %v", got, err)
+	}
+
+	if _, err := RenderPathTemplate("{category}/{filename}", PathVars{}); err == nil {
+		t.Error("expected an error for an empty path")
+	}
+}
+
+func TestValidatePathTemplate(t *testing.T) {
+	for _, tmpl := range []string{"{filename}", "{host}/{date:2006}/{name}.{ext}"} {
+		if err := ValidatePathTemplate(tmpl); err != nil {
+			t.Errorf("ValidatePathTemplate(%q): %v", tmpl, err)
+		}
+	}
+	for _, tmpl := range []string{"{host}/{date}", "{size}/{filename}", "{filename", "{host:x}/{filename}"} {
+		if err := ValidatePathTemplate(tmpl); err == nil {
+			t.Errorf("ValidatePathTemplate(%q): expected an error", tmpl)
+		}
+	}
+}